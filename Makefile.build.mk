@@ -1,6 +1,6 @@
 GO_BUILD_TAGS   := continuous_profiler_stackdriver
 
-.PHONY: all setup generate-mocks build clean
+.PHONY: all setup generate-mocks generate-proto build clean
 
 all: gitlab-pages
 
@@ -18,6 +18,15 @@ generate-mocks: .GOPATH/.ok
 	$Q bin/mockgen -source=internal/interface.go -destination=internal/mocks/mocks.go -package=mocks
 	$Q bin/mockgen -source=internal/source/source.go -destination=internal/mocks/source.go -package=mocks
 
+# requires protoc, the Go plugins are installed at the versions matching go.mod
+generate-proto: .GOPATH/.ok
+	$Q GOBIN=$(CURDIR)/bin go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.27.1
+	$Q GOBIN=$(CURDIR)/bin go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.2.0
+	$Q cd internal/source/gitlab/pagespb && PATH=$(CURDIR)/bin:$$PATH protoc \
+		--go_out=. --go_opt=paths=source_relative \
+		--go-grpc_out=. --go-grpc_opt=paths=source_relative \
+		pages_lookup.proto
+
 build: .GOPATH/.ok
 	$Q GOBIN=$(CURDIR)/bin go install $(if $V,-v) $(VERSION_FLAGS) -tags "${GO_BUILD_TAGS}" -buildmode exe $(IMPORT_PATH)
 
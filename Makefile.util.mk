@@ -1,4 +1,4 @@
-.PHONY: lint test race acceptance bench cover list deps-check deps-download changelog
+.PHONY: lint test race acceptance bench bench-gate bench-baseline cover list deps-check deps-download changelog
 
 OUT_FORMAT ?= colored-line-number
 LINT_FLAGS ?=  $(if $V,-v)
@@ -24,6 +24,14 @@ acceptance: .GOPATH/.ok .GOPATH/.ok bin/gotestsum gitlab-pages
 bench: .GOPATH/.ok gitlab-pages
 	go test -bench=. -run=^$$ $(allpackages)
 
+# Compare the serving benchmarks against test/benchmarks/testdata/baseline.json
+bench-gate: .GOPATH/.ok
+	go test -count=1 -run=TestServingRegressions ./test/benchmarks -bench-gate $(if $(BENCH_TOLERANCE),-bench-tolerance=$(BENCH_TOLERANCE))
+
+# Refresh test/benchmarks/testdata/baseline.json with the results of the current machine
+bench-baseline: .GOPATH/.ok
+	go test -count=1 -run=TestServingRegressions ./test/benchmarks -bench-update
+
 # The acceptance tests cannot count for coverage
 cover: gitlab-pages
 	@echo "NOTE: make cover does not exit 1 on failure, don't use it to check for tests success!"
@@ -4,11 +4,13 @@ import (
 	"context"
 	cryptotls "crypto/tls"
 	"errors"
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"sync"
+	"syscall"
 	"time"
 
 	ghandlers "github.com/gorilla/handlers"
@@ -24,21 +26,45 @@ import (
 	"gitlab.com/gitlab-org/gitlab-pages/internal/acme"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/artifact"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/auth"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/bodylimiter"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/cacheadmin"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/compress"
 	cfg "gitlab.com/gitlab-org/gitlab-pages/internal/config"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config/tls"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/customheaders"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/deprecation"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/export"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/handlers"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/headerlimiter"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/htmlinject"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/invalidation"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/mirror"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/netutil"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/prefetch"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/readonly"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/redirects"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/rejectmethods"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/requestid"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/routing"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/runtimeadmin"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/local"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/zip"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/proxy"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/unpublished"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/share"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/stapling"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/status"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/tarpit"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/tracing"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/urilimiter"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/weight"
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
 
@@ -58,6 +84,11 @@ type theApp struct {
 	Handlers       *handlers.Handlers
 	AcmeMiddleware *acme.Middleware
 	CustomHeaders  http.Header
+	Weight         *weight.Scorer
+	Exporter       *export.Exporter
+	Stapler        *stapling.Stapler
+	// RootCertificate is served to the domains without their own certificate
+	RootCertificate *tls.RootCertificate
 }
 
 func (a *theApp) isReady() bool {
@@ -71,12 +102,43 @@ func (a *theApp) ServeTLS(ch *cryptotls.ClientHelloInfo) (*cryptotls.Certificate
 
 	if domain, _ := a.domain(context.Background(), ch.ServerName); domain != nil {
 		tls, _ := domain.EnsureCertificate()
-		return tls, nil
+		return a.Stapler.Staple(tls), nil
 	}
 
 	return nil, nil
 }
 
+// ServeTLSConfig returns the TLS configuration of the domain requested by
+// the client, when it overrides the base configuration of the listener. The
+// handshake is refused when the domain cannot be looked up, as its policy may
+// be stricter than the base configuration.
+func (a *theApp) ServeTLSConfig(base *cryptotls.Config) func(*cryptotls.ClientHelloInfo) (*cryptotls.Config, error) {
+	return func(ch *cryptotls.ClientHelloInfo) (*cryptotls.Config, error) {
+		if ch.ServerName == "" {
+			return nil, nil
+		}
+
+		d, err := a.domain(context.Background(), ch.ServerName)
+		if err != nil && !errors.Is(err, domain.ErrDomainDoesNotExist) {
+			log.WithError(err).WithField("domain", ch.ServerName).Error("failed to look up the TLS policy")
+			return nil, err
+		}
+
+		if d == nil || d.TLSPolicy == nil {
+			return nil, nil
+		}
+
+		cfg, err := d.TLSConfig(base)
+		if err != nil {
+			// refuse the handshake rather than falling back to a weaker policy
+			log.WithError(err).WithField("domain", ch.ServerName).Error("invalid TLS policy")
+			return nil, err
+		}
+
+		return cfg, nil
+	}
+}
+
 func (a *theApp) redirectToHTTPS(w http.ResponseWriter, r *http.Request, statusCode int) {
 	u := *r.URL
 	u.Scheme = request.SchemeHTTPS
@@ -115,14 +177,15 @@ func (a *theApp) tryAuxiliaryHandlers(w http.ResponseWriter, r *http.Request, ht
 	}
 
 	if !a.isReady() {
-		httperrors.Serve503(w)
+		httperrors.Serve503(w, r)
 		return true
 	}
 
-	if _, err := domain.GetLookupPath(r); err != nil {
+	lookupPath, err := domain.GetLookupPath(r)
+	if err != nil {
 		if errors.Is(err, gitlab.ErrDiskDisabled) {
 			errortracking.Capture(err, errortracking.WithStackTrace())
-			httperrors.Serve500(w)
+			httperrors.Serve500(w, r)
 			return true
 		}
 
@@ -136,18 +199,39 @@ func (a *theApp) tryAuxiliaryHandlers(w http.ResponseWriter, r *http.Request, ht
 		return true
 	}
 
+	// the download of the archive is authorized by its own token, before the
+	// access control of the site
+	if a.Exporter.TryServe(w, r, lookupPath) {
+		return true
+	}
+
 	return false
 }
 
+// apiVersioner is implemented by domain sources that talk to a versioned
+// GitLab API
+type apiVersioner interface {
+	APIVersion() int
+}
+
 // healthCheckMiddleware is serving the application status check
 func (a *theApp) healthCheckMiddleware(handler http.Handler) (http.Handler, error) {
-	healthCheck := http.HandlerFunc(func(w http.ResponseWriter, _r *http.Request) {
-		if a.isReady() {
-			w.Write([]byte("success\n"))
-		} else {
-			http.Error(w, "not yet ready", http.StatusServiceUnavailable)
-		}
-	})
+	opts := status.Options{
+		Version:  VERSION,
+		Revision: REVISION,
+		Ready:    a.isReady,
+		JSON:     a.config.General.StatusJSON,
+	}
+
+	if v, ok := a.source.(apiVersioner); ok {
+		opts.APIVersion = v.APIVersion
+	}
+
+	if a.Weight != nil {
+		opts.Weight = a.Weight.Weight
+	}
+
+	healthCheck := status.NewHandler(opts)
 
 	loggedHealthCheck, err := logging.BasicAccessLogger(healthCheck, a.config.Log.Format, nil)
 	if err != nil {
@@ -190,6 +274,10 @@ func (a *theApp) serveFileOrNotFoundHandler() http.Handler {
 		domain := domain.FromRequest(r)
 		fileServed := domain.ServeFileHTTP(w, r)
 
+		if !fileServed && a.config.Redirects.NamespaceFallback {
+			fileServed = domain.ServeNamespaceRedirectsHTTP(w, r)
+		}
+
 		if !fileServed {
 			// We need to trigger authentication flow here if file does not exist to prevent exposing possibly private project existence,
 			// because the projects override the paths of the namespace project and they might be private even though
@@ -240,6 +328,8 @@ func setRequestScheme(r *http.Request) *http.Request {
 func (a *theApp) buildHandlerPipeline() (http.Handler, error) {
 	// Handlers should be applied in a reverse order
 	handler := a.serveFileOrNotFoundHandler()
+	handler = htmlinject.NewMiddleware(handler, &a.config.HTMLInjection)
+	handler = compress.NewMiddleware(handler, &a.config.Compression)
 	if !a.config.General.DisableCrossOriginRequests {
 		handler = corsHandler.Handler(handler)
 	}
@@ -255,10 +345,20 @@ func (a *theApp) buildHandlerPipeline() (http.Handler, error) {
 	// Metrics
 	metricsMiddleware := labmetrics.NewHandlerFactory(labmetrics.WithNamespace("gitlab_pages"))
 	handler = metricsMiddleware(handler)
+	handler = a.Weight.Middleware(handler)
 
 	handler = routing.NewMiddleware(handler, a.source)
 
-	handler = handlers.Ratelimiter(handler, &a.config.RateLimit)
+	// Mirroring happens after rate limiting so blocked requests are not mirrored
+	m, err := mirror.New(&a.config.Mirror)
+	if err != nil {
+		return nil, err
+	}
+	handler = mirror.NewMiddleware(handler, m)
+
+	tp := tarpit.New(&a.config.Tarpit)
+	handler = handlers.Ratelimiter(handler, &a.config.RateLimit, a.source, tp)
+	handler = tp.Middleware(handler)
 
 	// Health Check
 	handler, err = a.healthCheckMiddleware(handler)
@@ -275,13 +375,17 @@ func (a *theApp) buildHandlerPipeline() (http.Handler, error) {
 		correlationOpts = append(correlationOpts, correlation.WithPropagation())
 	}
 	handler = handlePanicMiddleware(handler)
+	handler = requestid.NewMiddleware(handler, a.config.General.RequestIDHeader)
+	handler = tracing.NewMiddleware(handler)
 	handler = correlation.InjectCorrelationID(handler, correlationOpts...)
 
 	// These middlewares MUST be added in the end.
 	// Being last means they will be evaluated first
 	// preventing any operation on bogus requests.
+	handler = bodylimiter.NewMiddleware(handler, a.config.General.MaxBodyBytes)
+	handler = headerlimiter.NewMiddleware(handler, a.config.General.MaxHeaderBytes)
 	handler = urilimiter.NewMiddleware(handler, a.config.General.MaxURILength)
-	handler = rejectmethods.NewMiddleware(handler)
+	handler = rejectmethods.NewMiddleware(handler, a.config.General.AllowedMethods)
 
 	return handler, nil
 }
@@ -330,11 +434,21 @@ func (a *theApp) Run() {
 		a.ListenHTTPSProxyv2FD(&wg, fd, httpHandler, limiter)
 	}
 
+	// Listen for HTTP PROXYv2 requests
+	for _, fd := range a.config.Listeners.HTTPProxyv2 {
+		a.listenHTTPProxyv2FD(&wg, fd, httpHandler, limiter)
+	}
+
 	// Serve metrics for Prometheus
 	if a.config.ListenMetrics != 0 {
 		a.listenMetricsFD(&wg, a.config.ListenMetrics)
 	}
 
+	// Report the weight of the node to the load balancer
+	if a.config.ListenWeightAgent != 0 {
+		a.listenWeightAgentFD(&wg, a.config.ListenWeightAgent)
+	}
+
 	wg.Wait()
 }
 
@@ -392,6 +506,18 @@ func (a *theApp) ListenHTTPSProxyv2FD(wg *sync.WaitGroup, fd uintptr, httpHandle
 	}()
 }
 
+// listenHTTPProxyv2FD serves the plaintext HTTP requests of the connections
+// starting with a PROXY protocol header
+func (a *theApp) listenHTTPProxyv2FD(wg *sync.WaitGroup, fd uintptr, httpHandler http.Handler, limiter *netutil.Limiter) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := a.listenAndServe(listenerConfig{fd: fd, handler: httpHandler, limiter: limiter, isProxyV2: true}); err != nil {
+			capturingFatal(err, errortracking.WithField("listener", request.SchemeHTTP))
+		}
+	}()
+}
+
 func (a *theApp) listenMetricsFD(wg *sync.WaitGroup, fd uintptr) {
 	wg.Add(1)
 	go func() {
@@ -402,9 +528,46 @@ func (a *theApp) listenMetricsFD(wg *sync.WaitGroup, fd uintptr) {
 			capturingFatal(fmt.Errorf("failed to listen on FD %d: %v", fd, err), errortracking.WithField("listener", "metrics"))
 		}
 
+		// metrics are served by Pages to stream and compress large scrapes
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.Handle("/-/deprecations", deprecation.Handler())
+		if a.Weight != nil {
+			mux.Handle("/-/weight", a.Weight)
+		}
+		if archives, ok := a.source.(prefetch.Archives); ok && len(a.config.GitLab.APISecretKey) > 0 {
+			mux.Handle("/-/deployments", prefetch.NewHandler(a.config.GitLab.APISecretKey, archives, zip.Prefetch))
+		}
+		if e, ok := a.source.(invalidation.Evictor); ok && len(a.config.GitLab.APISecretKey) > 0 {
+			mux.Handle(invalidation.PathPrefix, invalidation.NewHandler(a.config.GitLab.APISecretKey, e))
+		}
+		if len(a.config.GitLab.APISecretKey) > 0 {
+			domains, _ := a.source.(cacheadmin.DomainCache)
+			mux.Handle(cacheadmin.PathPrefix, cacheadmin.NewHandler(a.config.GitLab.APISecretKey, domains, zip.Archives()))
+			mux.Handle(runtimeadmin.Path, runtimeadmin.NewHandler(a.config.GitLab.APISecretKey))
+		}
+		if a.Auth != nil && a.config.Authentication.ShareLinks {
+			linkKey, err := share.LinkKey(a.config.Authentication.Secret)
+			if err != nil {
+				capturingFatal(err, errortracking.WithField("listener", "metrics"))
+			}
+
+			mux.Handle("/-/shares", share.NewHandler(a.config.GitLab.APISecretKey, linkKey, a.config.Authentication.ShareLinkMaxLifetime))
+		}
+
 		monitoringOpts := []monitoring.Option{
 			monitoring.WithBuildInformation(VERSION, ""),
 			monitoring.WithListener(l),
+			monitoring.WithServeMux(mux),
+			monitoring.WithoutMetrics(),
+		}
+
+		// the profiles are only served on the metrics listener, monitoring
+		// mounts the pprof handlers on mux
+		if a.config.General.EnablePprof {
+			mux.Handle("/debug/vars", expvar.Handler())
+		} else {
+			monitoringOpts = append(monitoringOpts, monitoring.WithoutPprof())
 		}
 
 		err = monitoring.Start(monitoringOpts...)
@@ -414,6 +577,22 @@ func (a *theApp) listenMetricsFD(wg *sync.WaitGroup, fd uintptr) {
 	}()
 }
 
+func (a *theApp) listenWeightAgentFD(wg *sync.WaitGroup, fd uintptr) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		l, err := net.FileListener(os.NewFile(fd, "[socket]"))
+		if err != nil {
+			capturingFatal(fmt.Errorf("failed to listen on FD %d: %v", fd, err), errortracking.WithField("listener", "weight-agent"))
+		}
+
+		if err := a.Weight.ServeAgent(l); err != nil {
+			capturingFatal(err, errortracking.WithField("listener", "weight-agent"))
+		}
+	}()
+}
+
 func runApp(config *cfg.Config) {
 	source, err := gitlab.New(&config.GitLab)
 	if err != nil {
@@ -422,19 +601,58 @@ func runApp(config *cfg.Config) {
 
 	a := theApp{config: config, source: source}
 
-	err = logging.ConfigureLogging(a.config.Log.Format, a.config.Log.Verbose)
+	err = logging.ConfigureLogging(&a.config.Log)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to initialize logging")
 	}
 
-	if config.ArtifactsServer.URL != "" {
-		a.Artifact = artifact.New(config.ArtifactsServer.URL, config.ArtifactsServer.TimeoutSeconds, config.General.Domain)
+	logging.ReopenOnSignal(syscall.SIGUSR2)
+
+	httptransport.ConfigureOutboundLogging(a.config.Log.OutboundPercentage)
+
+	shutdownTracing, err := tracing.Configure(config.Tracing)
+	if err != nil {
+		log.WithError(err).Fatal("could not configure tracing")
+	}
+	defer shutdownTracing(context.Background())
+
+	if len(config.ArtifactsServer.URLs) > 0 {
+		a.Artifact = artifact.New(config.ArtifactsServer.URLs, config.ArtifactsServer.TimeoutSeconds, config.General.Domains,
+			artifact.WithCache(config.ArtifactsServer.CacheTTL, config.ArtifactsServer.CacheSize))
 	}
 
 	a.setAuth(config)
 
 	a.Handlers = handlers.New(a.Auth, a.Artifact)
 
+	if config.GitLab.DeploymentExport {
+		a.Exporter, err = export.New(config.GitLab.APISecretKey, config.Zip.AllowedPaths)
+		if err != nil {
+			log.WithError(err).Fatal("could not initialize the deployment export")
+		}
+	}
+
+	if len(config.General.RootCertificate) > 0 {
+		a.RootCertificate, err = tls.NewRootCertificate(config.General.RootCertificate, config.General.RootKey,
+			config.General.RootCertificatePath, config.General.RootKeyPath)
+		if err != nil {
+			log.WithError(err).Fatal("could not load the root certificate")
+		}
+
+		a.RootCertificate.ReloadOnSignal(syscall.SIGHUP)
+	}
+
+	if config.TLS.OCSPStapling {
+		a.Stapler = stapling.New()
+		a.Stapler.Start(stapling.RefreshInterval)
+	}
+
+	a.Weight = weight.New(a.isReady)
+	a.Weight.Start(config.General.WeightInterval)
+
+	readonly.Set(config.General.ReadOnly)
+	readonly.ToggleOnSignal(syscall.SIGUSR1)
+
 	// TODO: This if was introduced when `gitlab-server` wasn't a required parameter
 	// once we completely remove support for legacy architecture and make it required
 	// we can just remove this if statement https://gitlab.com/gitlab-org/gitlab-pages/-/issues/581
@@ -450,6 +668,8 @@ func runApp(config *cfg.Config) {
 		a.CustomHeaders = customHeaders
 	}
 
+	a.CustomHeaders = customheaders.WithSecurityHeaders(config.General.SecurityHeaders, a.CustomHeaders)
+
 	if err := mimedb.LoadTypes(); err != nil {
 		log.WithError(err).Warn("Loading extended MIME database failed")
 	}
@@ -460,6 +680,30 @@ func runApp(config *cfg.Config) {
 		fatal(err, "failed to reconfigure zip VFS")
 	}
 
+	// the local VFS is never used without disk access, its caches are left
+	// unallocated
+	if config.GitLab.EnableDisk {
+		if err := local.Instance().Reconfigure(config); err != nil {
+			fatal(err, "failed to reconfigure local VFS")
+		}
+	}
+
+	if err := unpublished.Instance().Reconfigure(config); err != nil {
+		fatal(err, "failed to reconfigure unpublished serving")
+	}
+
+	if err := proxy.Instance().Reconfigure(config); err != nil {
+		fatal(err, "failed to reconfigure proxy serving")
+	}
+
+	redirects.ConfigureProxyHosts(config.Proxy.RedirectsAllowedHosts)
+	redirects.ConfigureLimits(config.Redirects.MaxRuleCount, config.Redirects.MaxPathSegments)
+	redirects.ConfigurePreserveQuery(config.Redirects.PreserveQuery)
+
+	if err := httperrors.LoadTemplates(config.General.ErrorPages); err != nil {
+		fatal(err, "failed to load custom error pages")
+	}
+
 	a.Run()
 }
 
@@ -469,11 +713,39 @@ func (a *theApp) setAuth(config *cfg.Config) {
 	}
 
 	var err error
-	a.Auth, err = auth.New(config.General.Domain, config.Authentication.Secret, config.Authentication.ClientID, config.Authentication.ClientSecret,
+	a.Auth, err = auth.New(config.General.Domains, config.Authentication.Secret, config.Authentication.ClientID, config.Authentication.ClientSecret,
 		config.Authentication.RedirectURI, config.GitLab.InternalServer, config.GitLab.PublicServer, config.Authentication.Scope)
 	if err != nil {
 		log.WithError(err).Fatal("could not initialize auth package")
 	}
+
+	if config.Authentication.Provider == cfg.AuthProviderOIDC {
+		namespaces, err := config.Authentication.OIDCNamespaceMapping()
+		if err != nil {
+			log.WithError(err).Fatal("could not initialize OIDC authentication")
+		}
+
+		a.Auth.UseOIDC(auth.OIDC{
+			Issuer:     config.Authentication.OIDCIssuer,
+			Claim:      config.Authentication.OIDCClaim,
+			Namespaces: namespaces,
+		})
+	}
+
+	a.Auth.LimitSessionAge(config.Authentication.SessionMaxAge)
+
+	if config.Authentication.SessionStore == cfg.AuthSessionStoreRedis {
+		a.Auth.UseRedisSessions(config.Authentication.RedisAddress, config.Authentication.RedisPassword)
+	}
+
+	if config.Authentication.ShareLinks {
+		linkKey, err := share.LinkKey(config.Authentication.Secret)
+		if err != nil {
+			log.WithError(err).Fatal("could not derive the share link key")
+		}
+
+		a.Auth.UseShareLinks(share.NewVerifier(linkKey, config.Authentication.ShareLinkMaxLifetime))
+	}
 }
 
 // fatal will log a fatal error and exit.
@@ -482,8 +754,29 @@ func fatal(err error, message string) {
 }
 
 func (a *theApp) TLSConfig() (*cryptotls.Config, error) {
-	return tls.Create(a.config.General.RootCertificate, a.config.General.RootKey, a.ServeTLS,
+	tlsConfig, err := tls.Create(a.config.General.RootCertificate, a.config.General.RootKey, a.ServeTLS,
 		a.config.General.InsecureCiphers, a.config.TLS.MinVersion, a.config.TLS.MaxVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.RootCertificate != nil {
+		// the root certificate is served when no domain certificate is, the
+		// current one since it is reloaded
+		getCertificate := tlsConfig.GetCertificate
+		tlsConfig.GetCertificate = func(ch *cryptotls.ClientHelloInfo) (*cryptotls.Certificate, error) {
+			cert, err := getCertificate(ch)
+			if cert != nil || err != nil {
+				return cert, err
+			}
+
+			return a.Stapler.Staple(a.RootCertificate.Get()), nil
+		}
+	}
+
+	tlsConfig.GetConfigForClient = a.ServeTLSConfig(tlsConfig.Clone())
+
+	return tlsConfig, nil
 }
 
 // handlePanicMiddleware logs and captures the recover() information from any panic
@@ -491,12 +784,18 @@ func handlePanicMiddleware(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			i := recover()
+			// aborted handlers, such as proxied streams closed midway, are
+			// handled by the server
+			if i == http.ErrAbortHandler {
+				panic(i)
+			}
+
 			if i != nil {
 				err := fmt.Errorf("panic trace: %v", i)
 				metrics.PanicRecoveredCount.Inc()
 				logging.LogRequest(r).WithError(err).Error("recovered from panic")
 				errortracking.Capture(err, errortracking.WithRequest(r), errortracking.WithContext(r.Context()), errortracking.WithStackTrace())
-				httperrors.Serve500(w)
+				httperrors.Serve500(w, r)
 			}
 		}()
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,10 +10,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/mock/gomock"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/mocks"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab"
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
@@ -147,3 +151,36 @@ func TestHandlePanicMiddleware(t *testing.T) {
 	counterCount := testutil.ToFloat64(metrics.PanicRecoveredCount)
 	require.Equal(t, float64(1), counterCount, "metric not updated")
 }
+
+func TestServeTLSConfigLookupErrors(t *testing.T) {
+	tests := map[string]struct {
+		err         error
+		expectedErr bool
+	}{
+		"unknown_domain": {
+			err: domain.ErrDomainDoesNotExist,
+		},
+		"lookup_failed": {
+			err:         errors.New("the GitLab API is unavailable"),
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			source := mocks.NewMockSource(gomock.NewController(t))
+			source.EXPECT().GetDomain(gomock.Any(), "group.gitlab-example.com").Return(nil, tt.err)
+
+			app := theApp{config: &config.Config{}, source: source}
+
+			cfg, err := app.ServeTLSConfig(&tls.Config{})(&tls.ClientHelloInfo{ServerName: "group.gitlab-example.com"})
+			require.Nil(t, cfg)
+
+			if tt.expectedErr {
+				require.Error(t, err, "the handshake is refused")
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"os"
 
 	"gitlab.com/gitlab-org/labkit/errortracking"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/netutil"
 )
 
 // Be careful: if you let either of the return values get garbage
-// collected by Go they will be closed automatically.
+// collected by Go they will be closed automatically. The socket options of
+// addr are described by netutil.ListenOptions.
 func createSocket(addr string) (net.Listener, *os.File) {
-	l, err := net.Listen("tcp", addr)
+	l, err := netutil.Listen(addr)
 	if err != nil {
 		fatal(err, "could not create socket")
 	}
@@ -18,6 +21,14 @@ func createSocket(addr string) (net.Listener, *os.File) {
 	return l, fileForListener(l)
 }
 
+// hasProxyProtocol reports whether the listener of addr requires the PROXY
+// protocol
+func hasProxyProtocol(addr string) bool {
+	_, opts, _ := netutil.ParseListenAddress(addr)
+
+	return opts.ProxyProtocol
+}
+
 func fileForListener(l net.Listener) *os.File {
 	type filer interface {
 		File() (*os.File, error)
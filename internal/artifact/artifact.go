@@ -1,6 +1,7 @@
 package artifact
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"gitlab.com/gitlab-org/labkit/errortracking"
@@ -17,12 +19,15 @@ import (
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/proxy"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/tracing"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
 
 const (
-	// Format a non-/-suffixed URL, an escaped project full_path, a job ID and
-	// a /-prefixed file path into an URL string
-	apiURLTemplate = "%s/projects/%s/jobs/%s/artifacts%s"
+	// Format an escaped project full_path, a job ID and a /-prefixed file
+	// path into the path of an URL string, relative to the artifacts server
+	apiPathTemplate = "/projects/%s/jobs/%s/artifacts%s"
 
 	minStatusCode = 200
 	maxStatusCode = 299
@@ -32,29 +37,74 @@ const (
 )
 
 var (
+	// forwardedRequestHeaders are passed through to the artifacts server so
+	// that artifact files can be requested in part and revalidated
+	forwardedRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+	// relayedResponseHeaders are passed through from the artifacts server
+	// along with the Content-Type and Content-Length
+	relayedResponseHeaders = []string{"Accept-Ranges", "Content-Range", "ETag", "Last-Modified"}
+
 	// Captures subgroup + project, job ID and artifacts path
 	pathExtractor       = regexp.MustCompile(`(?i)\A/-/(.*)/-/jobs/(\d+)/artifacts(/[^?]*)\z`)
 	errArtifactResponse = errors.New("artifact request response was not successful")
+	errServerTimeout    = errors.New("the artifacts server did not respond")
 )
 
-// Artifact proxies requests for artifact files to the GitLab artifacts API
+// Artifact proxies requests for artifact files to the GitLab artifacts API.
+// The files are streamed to the client as they arrive, with the idle timeout
+// and size limit of the proxy lookups, and connection upgrades are proxied.
 type Artifact struct {
-	server string
-	suffix string
-	client *http.Client
+	// servers are the non-/-suffixed URLs of the artifacts servers, which
+	// are requested in round-robin order
+	servers  []string
+	next     uint32
+	suffixes []string
+	client   *http.Client
+	// timeout bounds the wait for the response headers of a server, the
+	// body is streamed for as long as it is not idle
+	timeout time.Duration
+	cache   *responseCache
+}
+
+// Option configures an Artifact
+type Option func(*Artifact)
+
+// WithCache keeps the successful responses of the artifacts server in memory
+// for ttl, up to size responses. A ttl of 0 disables the cache.
+func WithCache(ttl time.Duration, size int64) Option {
+	return func(a *Artifact) {
+		a.cache = newResponseCache(ttl, size)
+	}
 }
 
 // New when provided the arguments defined herein, returns a pointer to an
 // Artifact that is used to proxy requests.
-func New(server string, timeoutSeconds int, pagesDomain string) *Artifact {
-	return &Artifact{
-		server: strings.TrimRight(server, "/"),
-		suffix: "." + strings.ToLower(pagesDomain),
+func New(servers []string, timeoutSeconds int, pagesDomains []string, opts ...Option) *Artifact {
+	trimmed := make([]string, 0, len(servers))
+	for _, server := range servers {
+		trimmed = append(trimmed, strings.TrimRight(server, "/"))
+	}
+
+	suffixes := make([]string, 0, len(pagesDomains))
+	for _, pagesDomain := range pagesDomains {
+		suffixes = append(suffixes, "."+strings.ToLower(pagesDomain))
+	}
+
+	a := &Artifact{
+		servers:  trimmed,
+		suffixes: suffixes,
 		client: &http.Client{
-			Timeout:   time.Second * time.Duration(timeoutSeconds),
-			Transport: httptransport.DefaultTransport,
+			Transport: tracing.NewRoundTripper(httptransport.DefaultTransport, "artifacts"),
 		},
+		timeout: time.Second * time.Duration(timeoutSeconds),
 	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
 }
 
 // TryMakeRequest will attempt to proxy a request and write it to the argument
@@ -62,7 +112,7 @@ func New(server string, timeoutSeconds int, pagesDomain string) *Artifact {
 // http.ResponseWriter has been written to in any capacity. Additional handler func
 // may be given which should return true if it did handle the response.
 func (a *Artifact) TryMakeRequest(host string, w http.ResponseWriter, r *http.Request, token string, additionalHandler func(*http.Response) bool) bool {
-	if a == nil || a.server == "" || host == "" {
+	if a == nil || len(a.servers) == 0 || host == "" {
 		return false
 	}
 
@@ -77,41 +127,88 @@ func (a *Artifact) TryMakeRequest(host string, w http.ResponseWriter, r *http.Re
 }
 
 func (a *Artifact) makeRequest(w http.ResponseWriter, r *http.Request, reqURL *url.URL, token string, additionalHandler func(*http.Response) bool) {
+	// the path is requested from every artifacts server, and cached
+	// regardless of the server it was fetched from
+	artifactPath := strings.TrimPrefix(reqURL.String(), a.servers[0])
+
+	if proxy.IsUpgrade(r) {
+		a.serveUpgrade(w, r, artifactPath, token)
+		return
+	}
+
 	req, err := http.NewRequestWithContext(r.Context(), "GET", reqURL.String(), nil)
 	if err != nil {
 		logging.LogRequest(r).WithError(err).Error(createArtifactRequestErrMsg)
 		errortracking.Capture(err, errortracking.WithRequest(r), errortracking.WithStackTrace())
-		httperrors.Serve500(w)
+		httperrors.Serve500(w, r)
 		return
 	}
 
 	if token != "" {
 		req.Header.Add("Authorization", "Bearer "+token)
 	}
-	resp, err := a.client.Do(req)
+
+	// partial and conditional requests are not served from the cache
+	cache := a.cache
+	for _, header := range forwardedRequestHeaders {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+			cache = nil
+		}
+	}
+
+	handled := false
+	cached, resp, err := cache.get(artifactPath, token, func() (*http.Response, error) {
+		resp, err := a.do(req, artifactPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if additionalHandler(resp) {
+			resp.Body.Close()
+			handled = true
+			return nil, errNotCached
+		}
+
+		return resp, nil
+	})
+
+	if handled {
+		return
+	}
+
+	if cached != nil {
+		serveCachedResponse(w, cached, token)
+		return
+	}
+
+	if errors.Is(err, errNotCached) {
+		err = nil
+	}
+
+	if httperrors.IsClientAborted(r, err) {
+		httperrors.ServeClientAborted(w, r, "artifact", err)
+		return
+	}
 
 	if err != nil {
 		logging.LogRequest(r).WithError(err).Error(artifactRequestErrMsg)
 		errortracking.Capture(err, errortracking.WithRequest(r), errortracking.WithStackTrace())
-		httperrors.Serve502(w)
+		httperrors.Serve502(w, r)
 		return
 	}
 
 	defer resp.Body.Close()
 
-	if additionalHandler(resp) {
-		return
-	}
-
 	if resp.StatusCode == http.StatusNotFound {
-		httperrors.Serve404(w)
+		httperrors.Serve404(w, r)
 		return
 	}
 
 	if resp.StatusCode == http.StatusInternalServerError {
 		logging.LogRequest(r).Error(errArtifactResponse)
 		errortracking.Capture(errArtifactResponse, errortracking.WithRequest(r), errortracking.WithStackTrace())
-		httperrors.Serve500(w)
+		httperrors.Serve500(w, r)
 		return
 	}
 
@@ -120,10 +217,172 @@ func (a *Artifact) makeRequest(w http.ResponseWriter, r *http.Request, reqURL *u
 		addCacheHeader(w, resp)
 	}
 
+	for _, header := range relayedResponseHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+
+	// a 304 has no body
+	if resp.StatusCode == http.StatusNotModified {
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+
 	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
-	w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+
+	body := proxy.Stream(resp.Body)
+	defer body.Close()
+
+	copyFlushing(w, body)
+}
+
+// serveUpgrade proxies a request for a connection upgrade to the next
+// artifacts server, it is neither cached nor failed over
+func (a *Artifact) serveUpgrade(w http.ResponseWriter, r *http.Request, artifactPath, token string) {
+	server := a.servers[int(atomic.AddUint32(&a.next, 1)-1)%len(a.servers)]
+
+	target, err := url.Parse(server + artifactPath)
+	if err != nil {
+		logging.LogRequest(r).WithError(err).Error(createArtifactRequestErrMsg)
+		httperrors.Serve500(w, r)
+		return
+	}
+
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	proxy.ServeUpgrade(w, r, target, header)
+}
+
+// copyFlushing copies body to w, flushing every read so that the artifacts
+// streamed by the server reach the client as they arrive
+func copyFlushing(w http.ResponseWriter, body io.Reader) {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// do sends req for artifactPath to the artifacts servers in turn, starting
+// with the next one in round-robin order. Connection errors and 5xx responses
+// fail over to the following server, the response or error of the last one
+// is returned.
+func (a *Artifact) do(req *http.Request, artifactPath string) (*http.Response, error) {
+	start := int(atomic.AddUint32(&a.next, 1) - 1)
+
+	var resp *http.Response
+	var err error
+
+	for i := range a.servers {
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		server := a.servers[(start+i)%len(a.servers)]
+
+		resp, err = a.doServer(req, server, artifactPath)
+		if req.Context().Err() != nil {
+			// the client is gone, the server is not to blame
+			return resp, err
+		}
+
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			metrics.ArtifactsServerUp.WithLabelValues(server).Set(1)
+			return resp, nil
+		}
+
+		metrics.ArtifactsServerUp.WithLabelValues(server).Set(0)
+		metrics.ArtifactsServerFailures.WithLabelValues(server).Inc()
+	}
+
+	return resp, err
+}
+
+func (a *Artifact) doServer(req *http.Request, server, artifactPath string) (*http.Response, error) {
+	u, err := url.Parse(server + artifactPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// the timeout only covers the response headers, the context is
+	// canceled once the body is closed
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(a.timeout, cancel)
+
+	serverReq := req.Clone(ctx)
+	serverReq.URL = u
+	serverReq.Host = u.Host
+
+	resp, err := a.client.Do(serverReq)
+	if !timer.Stop() {
+		// the context is canceled, the body cannot be read anyway
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		cancel()
+		return nil, fmt.Errorf("%w within %v", errServerTimeout, a.timeout)
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelingBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// cancelingBody cancels the context of the request of a response once its
+// body is closed
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
+
+func serveCachedResponse(w http.ResponseWriter, cached *cachedResponse, token string) {
+	if token == "" {
+		w.Header().Set("Cache-Control", "max-age=3600")
+	}
+
+	for name, values := range cached.header {
+		w.Header()[name] = values
+	}
+
+	w.Header().Set("Content-Type", cached.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(cached.body)))
+	w.WriteHeader(cached.statusCode)
+	w.Write(cached.body)
 }
 
 func addCacheHeader(w http.ResponseWriter, resp *http.Response) {
@@ -148,20 +407,40 @@ func encodePathSegments(path string) string {
 	return strings.Join(encoded, "/")
 }
 
+// matchingSuffix returns the longest suffix of the pages domains host ends
+// with, so that a pages domain nested under another one is trimmed whole
+func (a *Artifact) matchingSuffix(host string) string {
+	host = strings.ToLower(host)
+
+	var matching string
+	for _, suffix := range a.suffixes {
+		if strings.HasSuffix(host, suffix) && len(suffix) > len(matching) {
+			matching = suffix
+		}
+	}
+
+	return matching
+}
+
 // BuildURL returns a pointer to a url.URL for where the request should be
 // proxied to. The returned bool will indicate if there is some sort of issue
 // with the url while it is being generated.
 //
 // The URL is generated from the host (which contains the top-level group and
-// ends with the pagesDomain) and the path (which contains any subgroups, the
+// ends with one of the pagesDomains) and the path (which contains any subgroups, the
 // project, a job ID and a path
 // for the artifact file we want to download)
 func (a *Artifact) BuildURL(host, requestPath string) (*url.URL, bool) {
-	if !strings.HasSuffix(strings.ToLower(host), a.suffix) {
+	if len(a.servers) == 0 {
+		return nil, false
+	}
+
+	suffix := a.matchingSuffix(host)
+	if suffix == "" {
 		return nil, false
 	}
 
-	topGroup := host[0 : len(host)-len(a.suffix)]
+	topGroup := host[0 : len(host)-len(suffix)]
 
 	parts := pathExtractor.FindAllStringSubmatch(requestPath, 1)
 	if len(parts) != 1 || len(parts[0]) != 4 {
@@ -177,7 +456,7 @@ func (a *Artifact) BuildURL(host, requestPath string) (*url.URL, bool) {
 	artifactPath := encodePathSegments(parts[0][3])
 
 	projectID := url.PathEscape(path.Join(topGroup, restOfPath))
-	generated := fmt.Sprintf(apiURLTemplate, a.server, projectID, jobID, artifactPath)
+	generated := a.servers[0] + fmt.Sprintf(apiPathTemplate, projectID, jobID, artifactPath)
 
 	u, err := url.Parse(generated)
 	if err != nil {
@@ -1,11 +1,16 @@
 package artifact_test
 
 import (
+	"bufio"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -76,7 +81,7 @@ func TestTryMakeRequest(t *testing.T) {
 			reqURL, err := url.Parse("/-/subgroup/project/-/jobs/1/artifacts" + c.Path)
 			require.NoError(t, err)
 			r := &http.Request{URL: reqURL}
-			art := artifact.New(testServer.URL, 1, "gitlab-example.io")
+			art := artifact.New([]string{testServer.URL}, 1, []string{"gitlab-example.io"})
 
 			require.True(t, art.TryMakeRequest("group.gitlab-example.io", result, r, c.Token, func(resp *http.Response) bool { return false }))
 			require.Equal(t, c.Status, result.Code)
@@ -88,6 +93,294 @@ func TestTryMakeRequest(t *testing.T) {
 	}
 }
 
+func TestTryMakeRequestCache(t *testing.T) {
+	content := "<!DOCTYPE html><html><head><title>Title of the document</title></head><body></body></html>"
+
+	var requests int32
+	testServer := makeArtifactServerStub(t, content, "text/html; charset=utf-8")
+	countingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		testServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer testServer.Close()
+	defer countingServer.Close()
+
+	art := artifact.New([]string{countingServer.URL}, 1, []string{"gitlab-example.io"}, artifact.WithCache(time.Minute, 10))
+
+	request := func(path, token string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		result := httptest.NewRecorder()
+		reqURL, err := url.Parse("/-/subgroup/project/-/jobs/1/artifacts" + path)
+		require.NoError(t, err)
+
+		r := &http.Request{URL: reqURL}
+		require.True(t, art.TryMakeRequest("group.gitlab-example.io", result, r, token, func(resp *http.Response) bool { return false }))
+
+		return result
+	}
+
+	tests := []struct {
+		path         string
+		token        string
+		status       int
+		cacheControl string
+		requests     int32
+	}{
+		{"/200.html", "", http.StatusOK, "max-age=3600", 1},
+		{"/200.html", "", http.StatusOK, "max-age=3600", 1},
+		{"/200.html", "token", http.StatusOK, "", 2},
+		{"/200.html", "token", http.StatusOK, "", 2},
+		{"/200.html", "other-token", http.StatusOK, "", 3},
+		{"/500.html", "", http.StatusInternalServerError, "", 4},
+		{"/500.html", "", http.StatusInternalServerError, "", 5},
+	}
+
+	for _, tt := range tests {
+		result := request(tt.path, tt.token)
+
+		require.Equal(t, tt.status, result.Code)
+		require.Equal(t, tt.cacheControl, result.Header().Get("Cache-Control"))
+		require.Equal(t, tt.requests, atomic.LoadInt32(&requests), "%s requested with %q", tt.path, tt.token)
+
+		if tt.status == http.StatusOK {
+			require.Equal(t, "text/html; charset=utf-8", result.Header().Get("Content-Type"))
+			require.Equal(t, "90", result.Header().Get("Content-Length"))
+			require.Equal(t, content, result.Body.String())
+		}
+	}
+}
+
+func TestTryMakeRequestPassThrough(t *testing.T) {
+	content := "<!DOCTYPE html><html><head><title>Title of the document</title></head><body></body></html>"
+	modTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, "200.html", modTime, strings.NewReader(content))
+	}))
+	defer testServer.Close()
+
+	tests := map[string]struct {
+		header       http.Header
+		status       int
+		content      string
+		contentRange string
+	}{
+		"full": {
+			status:  http.StatusOK,
+			content: content,
+		},
+		"range": {
+			header:       http.Header{"Range": []string{"bytes=0-14"}},
+			status:       http.StatusPartialContent,
+			content:      "<!DOCTYPE html>",
+			contentRange: "bytes 0-14/90",
+		},
+		"if_none_match": {
+			header: http.Header{"If-None-Match": []string{`"etag"`}},
+			status: http.StatusNotModified,
+		},
+		"if_modified_since": {
+			header: http.Header{"If-Modified-Since": []string{modTime.Format(http.TimeFormat)}},
+			status: http.StatusNotModified,
+		},
+		"if_none_match_changed": {
+			header:  http.Header{"If-None-Match": []string{`"changed"`}},
+			status:  http.StatusOK,
+			content: content,
+		},
+	}
+
+	art := artifact.New([]string{testServer.URL}, 1, []string{"gitlab-example.io"}, artifact.WithCache(time.Minute, 10))
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := httptest.NewRecorder()
+			reqURL, err := url.Parse("/-/subgroup/project/-/jobs/1/artifacts/200.html")
+			require.NoError(t, err)
+
+			r := &http.Request{URL: reqURL, Header: tt.header}
+			require.True(t, art.TryMakeRequest("group.gitlab-example.io", result, r, "", func(resp *http.Response) bool { return false }))
+
+			require.Equal(t, tt.status, result.Code)
+			require.Equal(t, tt.content, result.Body.String())
+			require.Equal(t, tt.contentRange, result.Header().Get("Content-Range"))
+			require.Equal(t, `"etag"`, result.Header().Get("ETag"))
+			if tt.status != http.StatusNotModified {
+				require.Equal(t, modTime.Format(http.TimeFormat), result.Header().Get("Last-Modified"))
+			}
+		})
+	}
+}
+
+func TestTryMakeRequestFailover(t *testing.T) {
+	content := "<!DOCTYPE html><html><head><title>Title of the document</title></head><body></body></html>"
+	testServer := makeArtifactServerStub(t, content, "text/html; charset=utf-8")
+	defer testServer.Close()
+
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failingServer.Close()
+
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+
+	var requests int32
+	countingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		testServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer countingServer.Close()
+
+	request := func(art *artifact.Artifact, path string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		result := httptest.NewRecorder()
+		reqURL, err := url.Parse("/-/subgroup/project/-/jobs/1/artifacts" + path)
+		require.NoError(t, err)
+
+		r := &http.Request{URL: reqURL}
+		require.True(t, art.TryMakeRequest("group.gitlab-example.io", result, r, "", func(resp *http.Response) bool { return false }))
+
+		return result
+	}
+
+	t.Run("fails_over", func(t *testing.T) {
+		art := artifact.New([]string{closedServer.URL, failingServer.URL, testServer.URL}, 1, []string{"gitlab-example.io"})
+
+		for i := 0; i < 3; i++ {
+			result := request(art, "/200.html")
+			require.Equal(t, http.StatusOK, result.Code)
+			require.Equal(t, content, result.Body.String())
+		}
+	})
+
+	t.Run("round_robin", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		art := artifact.New([]string{countingServer.URL, testServer.URL}, 1, []string{"gitlab-example.io"})
+
+		for i := 0; i < 4; i++ {
+			require.Equal(t, http.StatusOK, request(art, "/200.html").Code)
+		}
+
+		require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("all_failing", func(t *testing.T) {
+		art := artifact.New([]string{closedServer.URL, failingServer.URL}, 1, []string{"gitlab-example.io"})
+
+		require.Equal(t, http.StatusBadGateway, request(art, "/200.html").Code)
+	})
+}
+
+func TestTryMakeRequestStreams(t *testing.T) {
+	release := make(chan struct{})
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "first\n")
+		w.(http.Flusher).Flush()
+
+		<-release
+		fmt.Fprint(w, "second\n")
+	}))
+	defer testServer.Close()
+
+	art := artifact.New([]string{testServer.URL}, 1, []string{"gitlab-example.io"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		art.TryMakeRequest("group.gitlab-example.io", w, r, "", func(resp *http.Response) bool { return false })
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/-/subgroup/project/-/jobs/1/artifacts/events.log")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "first\n", line, "the body is flushed as it arrives")
+
+	// the timeout of the server only covers the response headers
+	time.Sleep(1500 * time.Millisecond)
+	close(release)
+
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "second\n", line)
+}
+
+func TestTryMakeRequestHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer testServer.Close()
+
+	art := artifact.New([]string{testServer.URL}, 1, []string{"gitlab-example.io"})
+
+	reqURL, err := url.Parse("/-/subgroup/project/-/jobs/1/artifacts/200.html")
+	require.NoError(t, err)
+
+	result := httptest.NewRecorder()
+	require.True(t, art.TryMakeRequest("group.gitlab-example.io", result, &http.Request{URL: reqURL}, "", func(resp *http.Response) bool { return false }))
+	require.Equal(t, http.StatusBadGateway, result.Code)
+}
+
+func TestTryMakeRequestUpgrade(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/projects/group%2Fsubgroup%2Fproject/jobs/1/artifacts/socket", r.URL.RawPath)
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		require.Empty(t, r.Header.Get("Cookie"), "the session cookie is not forwarded")
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+
+		line, err := rw.ReadString('\n')
+		if err == nil {
+			rw.WriteString(line)
+			rw.Flush()
+		}
+	}))
+	defer testServer.Close()
+
+	art := artifact.New([]string{testServer.URL}, 1, []string{"gitlab-example.io"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		art.TryMakeRequest("group.gitlab-example.io", w, r, "token", func(resp *http.Response) bool { return false })
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	fmt.Fprint(conn, "GET /-/subgroup/project/-/jobs/1/artifacts/socket HTTP/1.1\r\nHost: group.gitlab-example.io\r\nCookie: gitlab-pages=session\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	fmt.Fprint(conn, "hello\n")
+
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", line)
+}
+
 // provide stub for testing different artifact responses
 func makeArtifactServerStub(t *testing.T, content string, contentType string) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -260,7 +553,7 @@ func TestBuildURL(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.Description, func(t *testing.T) {
-			a := artifact.New(c.RawServer, 1, c.PagesDomain)
+			a := artifact.New([]string{c.RawServer}, 1, []string{c.PagesDomain})
 			u, ok := a.BuildURL(c.Host, c.Path)
 
 			msg := c.Description + " - generated URL: "
@@ -275,3 +568,24 @@ func TestBuildURL(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildURLMultiplePagesDomains(t *testing.T) {
+	a := artifact.New([]string{"https://gitlab.com/api/v4"}, 1, []string{"example.io", "pages.example.io", "example.dev"})
+
+	tests := map[string]string{
+		"group.example.io":       "https://gitlab.com/api/v4/projects/group%2Fproject/jobs/1/artifacts/",
+		"group.example.dev":      "https://gitlab.com/api/v4/projects/group%2Fproject/jobs/1/artifacts/",
+		"group.pages.example.io": "https://gitlab.com/api/v4/projects/group%2Fproject/jobs/1/artifacts/",
+	}
+
+	for host, expected := range tests {
+		t.Run(host, func(t *testing.T) {
+			u, ok := a.BuildURL(host, "/-/project/-/jobs/1/artifacts/")
+			require.True(t, ok)
+			require.Equal(t, expected, u.String())
+		})
+	}
+
+	_, ok := a.BuildURL("group.example.com", "/-/project/-/jobs/1/artifacts/")
+	require.False(t, ok)
+}
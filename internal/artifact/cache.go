@@ -0,0 +1,129 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/lru"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// maxCachedResponseSize is the size in bytes of the largest artifact file
+// kept in memory, larger files are always requested from the artifacts server
+const maxCachedResponseSize = 1 << 20
+
+// errNotCached is returned by the fetch of a response which is not cached,
+// the response is served as is
+var errNotCached = errors.New("artifact response is not cached")
+
+// responseCache keeps the successful responses of the artifacts server in
+// memory. Responses are cached per URL and per token, so that the artifacts
+// of a private project are only served to the users who requested them.
+// A nil *responseCache is valid and never caches anything.
+type responseCache struct {
+	cache *lru.Cache
+}
+
+type cachedResponse struct {
+	statusCode  int
+	contentType string
+	// header holds the relayedResponseHeaders of the response
+	header http.Header
+	body   []byte
+}
+
+func newResponseCache(ttl time.Duration, size int64) *responseCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &responseCache{
+		cache: lru.New("artifacts",
+			lru.WithExpirationInterval(ttl),
+			lru.WithMaxSize(size),
+			lru.WithCachedEntriesMetric(metrics.ArtifactsCachedEntries),
+			lru.WithCachedRequestsMetric(metrics.ArtifactsCacheRequests),
+		),
+	}
+}
+
+// get returns the cached response for reqURL requested with token, or calls
+// fetch to request it. The responses which are not cached are returned by
+// fetch along with errNotCached, their body is left unread.
+func (c *responseCache) get(reqURL, token string, fetch func() (*http.Response, error)) (*cachedResponse, *http.Response, error) {
+	if c == nil {
+		resp, err := fetch()
+		if err == nil {
+			err = errNotCached
+		}
+
+		return nil, resp, err
+	}
+
+	var resp *http.Response
+
+	value, err := c.cache.FindOrFetch(tokenScope(token), reqURL, func() (interface{}, error) {
+		var err error
+
+		resp, err = fetch()
+		if err != nil {
+			return nil, err
+		}
+
+		if !cacheable(resp) {
+			return nil, errNotCached
+		}
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, resp.ContentLength))
+		if err != nil {
+			return nil, err
+		}
+
+		header := make(http.Header)
+		for _, name := range relayedResponseHeaders {
+			if value := resp.Header.Get(name); value != "" {
+				header.Set(name, value)
+			}
+		}
+
+		return &cachedResponse{
+			statusCode:  resp.StatusCode,
+			contentType: resp.Header.Get("Content-Type"),
+			header:      header,
+			body:        body,
+		}, nil
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return value.(*cachedResponse), nil, nil
+}
+
+// cacheable reports whether a response is kept in memory, only successful
+// and complete responses of a known and small enough size are
+func cacheable(resp *http.Response) bool {
+	return resp.StatusCode != http.StatusPartialContent &&
+		resp.StatusCode >= minStatusCode &&
+		resp.StatusCode <= maxStatusCode &&
+		resp.ContentLength >= 0 &&
+		resp.ContentLength <= maxCachedResponseSize
+}
+
+// tokenScope returns the cache namespace of the responses requested with
+// token, the token itself is not kept in memory
+func tokenScope(token string) string {
+	if token == "" {
+		return "public:"
+	}
+
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:]) + ":"
+}
@@ -0,0 +1,173 @@
+// Package assetmanifest parses the asset manifests produced by static site
+// generators and bundlers, which map logical asset names such as main.js to
+// the fingerprinted files of a deployment such as static/js/main.3f2a1b.js.
+// Fingerprinted files never change content, so they can be cached forever.
+package assetmanifest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+)
+
+const (
+	// ManifestFile is the name of the manifest at the root of a deployment
+	ManifestFile = "asset-manifest.json"
+
+	maxManifestSize = 512 * 1024
+
+	// maxEntries is the maximum number of assets read from a manifest
+	maxEntries = 10000
+)
+
+var (
+	errNeedRegularFile = errors.New("asset-manifest.json needs to be a regular file")
+	errFileTooLarge    = errors.New("asset-manifest.json file too large")
+	errTooManyEntries  = fmt.Errorf("asset-manifest.json cannot contain more than %d entries", maxEntries)
+)
+
+// Manifest maps the logical paths of a deployment to fingerprinted files.
+// Paths are relative to the root of the deployment. A nil *Manifest is
+// valid and empty.
+type Manifest struct {
+	assets        map[string]string
+	fingerprinted map[string]bool
+}
+
+// Lookup returns the fingerprinted file of the logical path
+func (m *Manifest) Lookup(logicalPath string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+
+	target, ok := m.assets[strings.TrimPrefix(logicalPath, "/")]
+
+	return target, ok
+}
+
+// Immutable reports whether the file is a fingerprinted target of the
+// manifest, whose content never changes under the same name
+func (m *Manifest) Immutable(filePath string) bool {
+	return m != nil && m.fingerprinted[strings.TrimPrefix(filePath, "/")]
+}
+
+// Parse reads the manifest of the deployment served under prefix from root.
+// A deployment without a manifest has an empty one. Three layouts are
+// understood:
+//   - a flat object, {"main.js": "main.3f2a1b.js"}
+//   - the files of Create React App, {"files": {"main.js": "/static/js/main.3f2a1b.js"}}
+//   - the chunks of Vite, {"src/main.ts": {"file": "assets/main.3f2a1b.js"}}
+//
+// Targets outside of the deployment, such as files on a CDN, are ignored.
+func Parse(ctx context.Context, root vfs.Root, prefix string) (*Manifest, error) {
+	fi, err := root.Lstat(ctx, ManifestFile)
+	if err != nil {
+		return &Manifest{}, nil
+	}
+
+	if !fi.Mode().IsRegular() {
+		return nil, errNeedRegularFile
+	}
+
+	if fi.Size() > maxManifestSize {
+		return nil, errFileTooLarge
+	}
+
+	reader, err := root.Open(ctx, ManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, maxManifestSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse asset-manifest.json: %w", err)
+	}
+
+	if files, ok := entries["files"]; ok {
+		var nested map[string]json.RawMessage
+		if err := json.Unmarshal(files, &nested); err == nil {
+			entries = nested
+		}
+	}
+
+	if len(entries) > maxEntries {
+		return nil, errTooManyEntries
+	}
+
+	m := &Manifest{
+		assets:        make(map[string]string, len(entries)),
+		fingerprinted: make(map[string]bool, len(entries)),
+	}
+
+	for name, value := range entries {
+		logical, ok := normalize(name, prefix)
+		if !ok {
+			continue
+		}
+
+		target, ok := normalize(targetOf(value), prefix)
+		if !ok || target == logical {
+			continue
+		}
+
+		m.assets[logical] = target
+
+		// files moved without renaming them, e.g. favicon.ico to
+		// static/favicon.ico, are not fingerprinted and may still change
+		if path.Base(target) != path.Base(logical) {
+			m.fingerprinted[target] = true
+		}
+	}
+
+	return m, nil
+}
+
+// targetOf returns the file of a manifest entry, either a string or an
+// object with a file
+func targetOf(value json.RawMessage) string {
+	var target string
+	if err := json.Unmarshal(value, &target); err == nil {
+		return target
+	}
+
+	var chunk struct {
+		File string `json:"file"`
+	}
+	if err := json.Unmarshal(value, &chunk); err == nil {
+		return chunk.File
+	}
+
+	return ""
+}
+
+// normalize returns p relative to the root of the deployment served under
+// prefix, and false if it points outside of the deployment
+func normalize(p, prefix string) (string, bool) {
+	if p == "" || strings.HasPrefix(p, "//") || strings.Contains(p, "://") {
+		return "", false
+	}
+
+	if strings.HasPrefix(p, "/") {
+		// absolute paths include the prefix of project sites
+		p = "/" + strings.TrimPrefix(p, strings.TrimSuffix(prefix, "/")+"/")
+	}
+
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return "", false
+	}
+
+	return strings.TrimPrefix(p, "/"), true
+}
@@ -0,0 +1,121 @@
+package assetmanifest
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/testhelpers"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name              string
+		manifest          string
+		prefix            string
+		expectedAssets    map[string]string
+		expectedImmutable []string
+		expectedErr       string
+	}{
+		{
+			name: "no manifest",
+		},
+		{
+			name:              "flat",
+			manifest:          `{"main.js": "main.3f2a1b.js", "css/app.css": "/css/app.9e8d7c.css"}`,
+			prefix:            "/",
+			expectedAssets:    map[string]string{"main.js": "main.3f2a1b.js", "css/app.css": "css/app.9e8d7c.css"},
+			expectedImmutable: []string{"main.3f2a1b.js", "css/app.9e8d7c.css"},
+		},
+		{
+			name:              "create react app in a project site",
+			manifest:          `{"files": {"main.js": "/project/static/js/main.3f2a1b.js", "index.html": "/project/index.html"}, "entrypoints": ["static/js/main.3f2a1b.js"]}`,
+			prefix:            "/project/",
+			expectedAssets:    map[string]string{"main.js": "static/js/main.3f2a1b.js"},
+			expectedImmutable: []string{"static/js/main.3f2a1b.js"},
+		},
+		{
+			name:              "vite",
+			manifest:          `{"src/main.ts": {"file": "assets/main.3f2a1b.js", "isEntry": true}}`,
+			prefix:            "/project",
+			expectedAssets:    map[string]string{"src/main.ts": "assets/main.3f2a1b.js"},
+			expectedImmutable: []string{"assets/main.3f2a1b.js"},
+		},
+		{
+			name:           "moved without fingerprint",
+			manifest:       `{"favicon.ico": "static/favicon.ico"}`,
+			prefix:         "/",
+			expectedAssets: map[string]string{"favicon.ico": "static/favicon.ico"},
+		},
+		{
+			name:           "targets outside of the deployment",
+			manifest:       `{"a.js": "https://cdn.example.com/a.1.js", "b.js": "//cdn.example.com/b.1.js", "c.js": "../../c.1.js", "d.js": 1}`,
+			prefix:         "/",
+			expectedAssets: map[string]string{"c.js": "c.1.js"},
+			// the cleaned path stays inside of the deployment
+			expectedImmutable: []string{"c.1.js"},
+		},
+		{
+			name:        "invalid JSON",
+			manifest:    `{"main.js":`,
+			expectedErr: "failed to parse asset-manifest.json",
+		},
+		{
+			name:        "too large",
+			manifest:    `{"a": "` + strings.Repeat("a", maxManifestSize) + `"}`,
+			expectedErr: errFileTooLarge.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, tmpDir := testhelpers.TmpDir(t, "ParseAssetManifest_tests")
+
+			if tt.manifest != "" {
+				err := os.WriteFile(path.Join(tmpDir, ManifestFile), []byte(tt.manifest), 0600)
+				require.NoError(t, err)
+			}
+
+			manifest, err := Parse(context.Background(), root, tt.prefix)
+			if tt.expectedErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedAssets, manifest.assets)
+			require.Len(t, manifest.fingerprinted, len(tt.expectedImmutable))
+
+			for _, file := range tt.expectedImmutable {
+				require.True(t, manifest.Immutable(file), file)
+			}
+		})
+	}
+}
+
+func TestManifestLookup(t *testing.T) {
+	manifest := &Manifest{
+		assets:        map[string]string{"main.js": "main.3f2a1b.js"},
+		fingerprinted: map[string]bool{"main.3f2a1b.js": true},
+	}
+
+	target, ok := manifest.Lookup("/main.js")
+	require.True(t, ok)
+	require.Equal(t, "main.3f2a1b.js", target)
+
+	_, ok = manifest.Lookup("main.3f2a1b.js")
+	require.False(t, ok)
+
+	require.True(t, manifest.Immutable("/main.3f2a1b.js"))
+	require.False(t, manifest.Immutable("main.js"))
+
+	var empty *Manifest
+	_, ok = empty.Lookup("main.js")
+	require.False(t, ok)
+	require.False(t, empty.Immutable("main.3f2a1b.js"))
+}
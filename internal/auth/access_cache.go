@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// accessCacheTTL is how long a successful access check is reused, long
+	// enough to cover the assets of a single page load
+	accessCacheTTL = 5 * time.Second
+	// rejectedTokenTTL is how long a header token rejected by the GitLab API
+	// is rejected without asking it again
+	rejectedTokenTTL = 30 * time.Second
+	// accessCacheMaxSessions bounds the number of sessions remembered at once
+	accessCacheMaxSessions = 10000
+)
+
+// accessCache remembers for a short time which projects a session was
+// allowed to access, so the assets of a page do not each trigger a call to
+// the GitLab API. Only positive decisions are cached and access tokens are
+// stored hashed, a separate accessCache remembers the rejected header tokens.
+type accessCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]map[uint64]time.Time // session -> project ID -> expiry
+}
+
+func newAccessCache(ttl time.Duration) *accessCache {
+	return &accessCache{
+		ttl:     ttl,
+		entries: make(map[string]map[uint64]time.Time),
+	}
+}
+
+// allowed reports whether token was granted access to projectID within the TTL
+func (c *accessCache) allowed(token string, projectID uint64, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiry, ok := c.entries[sessionKey(token)][projectID]
+
+	return ok && now.Before(expiry)
+}
+
+// allow records that token was granted access to projectID
+func (c *accessCache) allow(token string, projectID uint64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := sessionKey(token)
+
+	projects, ok := c.entries[key]
+	if !ok {
+		if len(c.entries) >= accessCacheMaxSessions {
+			c.removeExpired(now)
+		}
+
+		if len(c.entries) >= accessCacheMaxSessions {
+			// checking access again is always safe
+			return
+		}
+
+		projects = make(map[uint64]time.Time)
+		c.entries[key] = projects
+	}
+
+	projects[projectID] = now.Add(c.ttl)
+}
+
+// rejected reports whether token was rejected for any project within the TTL
+func (c *accessCache) rejected(token string, now time.Time) bool {
+	return c.allowed(token, 0, now)
+}
+
+// reject records that token was rejected for any project
+func (c *accessCache) reject(token string, now time.Time) {
+	c.allow(token, 0, now)
+}
+
+// invalidate drops all the decisions cached for token
+func (c *accessCache) invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, sessionKey(token))
+}
+
+func (c *accessCache) removeExpired(now time.Time) {
+	for key, projects := range c.entries {
+		for projectID, expiry := range projects {
+			if !now.Before(expiry) {
+				delete(projects, projectID)
+			}
+		}
+
+		if len(projects) == 0 {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func sessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
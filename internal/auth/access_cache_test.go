@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessCache(t *testing.T) {
+	c := newAccessCache(time.Second)
+	now := time.Now()
+
+	require.False(t, c.allowed("token", 1, now))
+
+	c.allow("token", 1, now)
+	require.True(t, c.allowed("token", 1, now.Add(500*time.Millisecond)))
+	require.False(t, c.allowed("token", 1, now.Add(time.Second)), "decision expired")
+	require.False(t, c.allowed("token", 2, now), "other project")
+	require.False(t, c.allowed("other-token", 1, now), "other session")
+
+	c.allow("token", 2, now)
+	c.invalidate("token")
+	require.False(t, c.allowed("token", 1, now))
+	require.False(t, c.allowed("token", 2, now))
+}
+
+func TestAccessCacheStoresHashedTokens(t *testing.T) {
+	c := newAccessCache(time.Second)
+	c.allow("secret-token", 1, time.Now())
+
+	for key := range c.entries {
+		require.NotContains(t, key, "secret-token")
+	}
+}
+
+func TestAccessCacheRemovesExpiredWhenFull(t *testing.T) {
+	c := newAccessCache(time.Second)
+	now := time.Now()
+
+	for i := 0; i < accessCacheMaxSessions; i++ {
+		c.allow(string(rune(i)), 1, now)
+	}
+
+	c.allow("new", 1, now)
+	require.False(t, c.allowed("new", 1, now), "cache is full")
+
+	later := now.Add(2 * time.Second)
+	c.allow("new", 1, later)
+	require.True(t, c.allowed("new", 1, later))
+	require.Len(t, c.entries, 1)
+}
@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/sirupsen/logrus"
@@ -25,9 +26,13 @@ import (
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/share"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source"
 )
 
+// CallbackPath is the path of the OAuth callback and auth proxying endpoint
+const CallbackPath = "/auth"
+
 // nolint: gosec
 // gosec: G101: Potential hardcoded credentials
 // auth constants, not credentials
@@ -36,7 +41,6 @@ const (
 	apiURLProjectTemplate  = "%s/api/v4/projects/%d/pages_access"
 	authorizeURLTemplate   = "%s/oauth/authorize?client_id=%s&redirect_uri=%s&response_type=code&state=%s&scope=%s"
 	tokenURLTemplate       = "%s/oauth/token"
-	callbackPath           = "/auth"
 	authorizeProxyTemplate = "%s?domain=%s&state=%s"
 	authSessionMaxAge      = 60 * 10 // 10 minutes
 
@@ -54,7 +58,7 @@ var (
 
 // Auth handles authenticating users with GitLab API
 type Auth struct {
-	pagesDomain          string
+	pagesDomains         []string
 	clientID             string
 	clientSecret         string
 	redirectURI          string
@@ -66,6 +70,15 @@ type Auth struct {
 	jwtExpiry            time.Duration
 	apiClient            *http.Client
 	store                sessions.Store
+	sessionCodecs        []securecookie.Codec
+	redis                *redis.Client // stores the sessions and the one-time share links redeemed when set
+	sessionMaxAge        time.Duration // access tokens are refreshed for this duration after signing in
+	accessCache          *accessCache
+	rejectedTokens       *accessCache // header tokens which the GitLab API rejected
+	refreshes            *refreshes
+	shares               *share.Verifier
+	shareCookies         *securecookie.SecureCookie
+	oidc                 *oidcProvider    // authenticates against an external provider instead of GitLab when set
 	now                  func() time.Time // allows to stub time.Now() easily in tests
 }
 
@@ -74,6 +87,7 @@ type tokenResponse struct {
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int    `json:"expires_in"`
 	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
 }
 
 type errorResponse struct {
@@ -109,7 +123,7 @@ func (a *Auth) checkSession(w http.ResponseWriter, r *http.Request) (*sessions.S
 		if errsave != nil {
 			logRequest(r).WithError(errsave).Error(saveSessionErrMsg)
 			captureErrWithReqAndStackTrace(errsave, r)
-			httperrors.Serve500(w)
+			httperrors.Serve500(w, r)
 			return nil, errsave
 		}
 
@@ -132,7 +146,7 @@ func (a *Auth) TryAuthenticate(w http.ResponseWriter, r *http.Request, domains s
 	}
 
 	// Request is for auth
-	if r.URL.Path != callbackPath {
+	if r.URL.Path != CallbackPath {
 		return false
 	}
 
@@ -171,7 +185,7 @@ func (a *Auth) checkAuthenticationResponse(session *sessions.Session, w http.Res
 	redirectURI, ok := session.Values["uri"].(string)
 	if !ok {
 		logRequest(r).Error("Can not extract redirect uri from session")
-		httperrors.Serve500(w)
+		httperrors.Serve500(w, r)
 		return
 	}
 
@@ -179,12 +193,23 @@ func (a *Auth) checkAuthenticationResponse(session *sessions.Session, w http.Res
 	if err != nil {
 		logRequest(r).WithError(err).Error("failed to decrypt secure code")
 		captureErrWithReqAndStackTrace(err, r)
-		httperrors.Serve500(w)
+		httperrors.Serve500(w, r)
+		return
+	}
+
+	if _, err := validateReturnURL(redirectURI, r.Host); err != nil {
+		logRequest(r).WithError(err).WithField("redirect_uri", redirectURI).Warn("Refusing to redirect to invalid return URL")
+		httperrors.Serve401(w)
 		return
 	}
 
 	// Fetch access token with authorization code
 	token, err := a.fetchAccessToken(r.Context(), decryptedCode)
+	if httperrors.IsClientAborted(r, err) {
+		httperrors.ServeClientAborted(w, r, "fetchAccessToken", err)
+		return
+	}
+
 	if err != nil {
 		// Fetching token not OK
 		logRequest(r).WithError(err).WithField(
@@ -197,18 +222,32 @@ func (a *Auth) checkAuthenticationResponse(session *sessions.Session, w http.Res
 			errortracking.WithStackTrace(),
 		)
 
-		httperrors.Serve503(w)
+		httperrors.Serve503(w, r)
 		return
 	}
 
+	if a.oidc != nil {
+		// the state is the nonce of the ID token, see authorizeURL
+		values, expiry, err := a.oidc.verify(r.Context(), token.IDToken, a.clientID, session.Values["state"].(string))
+		if err != nil {
+			logRequest(r).WithError(err).Warn("failed to verify the OIDC ID token")
+			httperrors.Serve401(w)
+			return
+		}
+
+		session.Values["oidc_claims"] = values
+		session.Values["oidc_expiry"] = expiry
+	}
+
 	// Store access token
-	session.Values["access_token"] = token.AccessToken
+	a.storeToken(session, token)
+	session.Values["session_start"] = a.now().Unix()
 	err = session.Save(r, w)
 	if err != nil {
 		logRequest(r).WithError(err).Error(saveSessionErrMsg)
 		captureErrWithReqAndStackTrace(err, r)
 
-		httperrors.Serve500(w)
+		httperrors.Serve500(w, r)
 		return
 	}
 
@@ -221,10 +260,10 @@ func (a *Auth) checkAuthenticationResponse(session *sessions.Session, w http.Res
 }
 
 func (a *Auth) domainAllowed(ctx context.Context, name string, domains source.Source) bool {
-	isConfigured := (name == a.pagesDomain) || strings.HasSuffix(name, "."+a.pagesDomain)
-
-	if isConfigured {
-		return true
+	for _, pagesDomain := range a.pagesDomains {
+		if name == pagesDomain || strings.HasSuffix(name, "."+pagesDomain) {
+			return true
+		}
 	}
 
 	domain, err := domains.GetDomain(ctx, name)
@@ -239,16 +278,10 @@ func (a *Auth) handleProxyingAuth(session *sessions.Session, w http.ResponseWrit
 		domain := r.URL.Query().Get("domain")
 		state := r.URL.Query().Get("state")
 
-		proxyurl, err := url.Parse(domain)
+		proxyurl, err := validateAuthDomain(domain)
 		if err != nil {
-			logRequest(r).WithField("domain", domain).Error(queryParameterErrMsg)
-			errortracking.Capture(err,
-				errortracking.WithRequest(r),
-				errortracking.WithField("domain", domain),
-				errortracking.WithStackTrace(),
-			)
-
-			httperrors.Serve500(w)
+			logRequest(r).WithError(err).WithField("domain", domain).Warn(queryParameterErrMsg)
+			httperrors.Serve401(w)
 			return true
 		}
 		host, _, err := net.SplitHostPort(proxyurl.Host)
@@ -262,6 +295,9 @@ func (a *Auth) handleProxyingAuth(session *sessions.Session, w http.ResponseWrit
 			return true
 		}
 
+		// only keep the validated scheme and host so nothing else can be smuggled into the redirect
+		domain = proxyurl.Scheme + "://" + proxyurl.Host
+
 		logRequest(r).WithField("domain", domain).Info("User is authenticating via domain")
 
 		session.Values["proxy_auth_domain"] = domain
@@ -271,7 +307,26 @@ func (a *Auth) handleProxyingAuth(session *sessions.Session, w http.ResponseWrit
 			logRequest(r).WithError(err).Error(saveSessionErrMsg)
 			captureErrWithReqAndStackTrace(err, r)
 
-			httperrors.Serve500(w)
+			httperrors.Serve500(w, r)
+			return true
+		}
+
+		if a.oidc != nil {
+			url, err := a.oidc.authorizeURL(r.Context(), a.clientID, a.redirectURI, state, a.authScope)
+			if err != nil {
+				logRequest(r).WithError(err).Error("failed to discover the OIDC provider")
+				captureErrWithReqAndStackTrace(err, r)
+
+				httperrors.Serve503(w, r)
+				return true
+			}
+
+			logRequest(r).WithFields(logrus.Fields{
+				"oidc_issuer":  a.oidc.Issuer,
+				"pages_domain": domain,
+			}).Info("Redirecting user to the OIDC provider")
+
+			http.Redirect(w, r, url, http.StatusFound)
 			return true
 		}
 
@@ -302,7 +357,7 @@ func (a *Auth) handleProxyingAuth(session *sessions.Session, w http.ResponseWrit
 			logRequest(r).WithError(err).Error(saveSessionErrMsg)
 			captureErrWithReqAndStackTrace(err, r)
 
-			httperrors.Serve500(w)
+			httperrors.Serve500(w, r)
 			return true
 		}
 
@@ -316,7 +371,7 @@ func (a *Auth) handleProxyingAuth(session *sessions.Session, w http.ResponseWrit
 			logRequest(r).WithError(err).Error(saveSessionErrMsg)
 			captureErrWithReqAndStackTrace(err, r)
 
-			httperrors.Serve503(w)
+			httperrors.Serve503(w, r)
 			return true
 		}
 
@@ -380,26 +435,43 @@ func verifyCodeAndStateGiven(r *http.Request) bool {
 }
 
 func (a *Auth) fetchAccessToken(ctx context.Context, code string) (tokenResponse, error) {
+	content := url.Values{}
+	content.Set("code", code)
+	content.Set("grant_type", "authorization_code")
+	content.Set("redirect_uri", a.redirectURI)
+
+	return a.requestToken(ctx, content)
+}
+
+// requestToken requests a token from the token endpoint of the provider for
+// the grant of content
+func (a *Auth) requestToken(ctx context.Context, content url.Values) (tokenResponse, error) {
 	token := tokenResponse{}
 
 	// Prepare request
-	fetchURL, err := url.Parse(fmt.Sprintf(tokenURLTemplate, a.internalGitlabServer))
+	tokenURL := fmt.Sprintf(tokenURLTemplate, a.internalGitlabServer)
+	if a.oidc != nil {
+		var err error
+		if tokenURL, err = a.oidc.tokenURL(ctx); err != nil {
+			return token, err
+		}
+	}
+
+	fetchURL, err := url.Parse(tokenURL)
 	if err != nil {
 		return token, err
 	}
 
-	content := url.Values{}
 	content.Set("client_id", a.clientID)
 	content.Set("client_secret", a.clientSecret)
-	content.Set("code", code)
-	content.Set("grant_type", "authorization_code")
-	content.Set("redirect_uri", a.redirectURI)
 
 	req, err := http.NewRequestWithContext(ctx, "POST", fetchURL.String(), strings.NewReader(content.Encode()))
 	if err != nil {
 		return token, err
 	}
 
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
 	// Request token
 	resp, err := a.apiClient.Do(req)
 
@@ -430,6 +502,10 @@ func (a *Auth) checkSessionIsValid(w http.ResponseWriter, r *http.Request) *sess
 		return nil
 	}
 
+	if a.renewExpiredToken(session, w, r) {
+		return nil
+	}
+
 	// redirect to /auth?domain=%s&state=%s
 	if a.checkTokenExists(session, w, r) {
 		return nil
@@ -456,7 +532,7 @@ func (a *Auth) checkTokenExists(session *sessions.Session, w http.ResponseWriter
 			logRequest(r).WithError(err).Error(saveSessionErrMsg)
 			captureErrWithReqAndStackTrace(err, r)
 
-			httperrors.Serve500(w)
+			httperrors.Serve500(w, r)
 			return true
 		}
 
@@ -478,12 +554,22 @@ func destroySession(session *sessions.Session, w http.ResponseWriter, r *http.Re
 
 	// Invalidate access token and redirect back for refreshing and re-authenticating
 	delete(session.Values, "access_token")
+	delete(session.Values, "oidc_claims")
+	delete(session.Values, "oidc_expiry")
+	deleteRefreshToken(session)
+
+	saveSessionAndRedirect(session, w, r)
+}
+
+// saveSessionAndRedirect saves the session and redirects back to the
+// requested address, to serve the request again with the saved session
+func saveSessionAndRedirect(session *sessions.Session, w http.ResponseWriter, r *http.Request) {
 	err := session.Save(r, w)
 	if err != nil {
 		logRequest(r).WithError(err).Error(saveSessionErrMsg)
 		captureErrWithReqAndStackTrace(err, r)
 
-		httperrors.Serve500(w)
+		httperrors.Serve500(w, r)
 		return
 	}
 
@@ -496,12 +582,32 @@ func (a *Auth) IsAuthSupported() bool {
 }
 
 func (a *Auth) checkAuthentication(w http.ResponseWriter, r *http.Request, domain domain) bool {
+	// tokens of an external provider are not GitLab access tokens
+	if header, token := headerToken(r); token != "" && a.oidc == nil {
+		return a.checkHeaderToken(w, r, domain, header, token)
+	}
+
 	session := a.checkSessionIsValid(w, r)
 	if session == nil {
 		return true
 	}
 
+	if a.oidc != nil {
+		return a.checkOIDCAuthorization(session, w, r, domain)
+	}
+
+	ssoGroupID, served := a.checkGroupSSO(session, w, r, domain)
+	if served {
+		return true
+	}
+
+	token := session.Values["access_token"].(string)
 	projectID := domain.GetProjectID(r)
+	// the SSO of a group is proven by the API only, never by the cache
+	if ssoGroupID == 0 && a.accessCache.allowed(token, projectID, a.now()) {
+		return false
+	}
+
 	// Access token exists, authorize request
 	var url string
 	if projectID > 0 {
@@ -515,11 +621,11 @@ func (a *Auth) checkAuthentication(w http.ResponseWriter, r *http.Request, domai
 		logRequest(r).WithError(err).Error(failAuthErrMsg)
 		captureErrWithReqAndStackTrace(err, r)
 
-		httperrors.Serve500(w)
+		httperrors.Serve500(w, r)
 		return true
 	}
 
-	req.Header.Add("Authorization", "Bearer "+session.Values["access_token"].(string))
+	req.Header.Add("Authorization", "Bearer "+token)
 	resp, err := a.apiClient.Do(req)
 
 	if err != nil {
@@ -532,10 +638,24 @@ func (a *Auth) checkAuthentication(w http.ResponseWriter, r *http.Request, domai
 
 	defer resp.Body.Close()
 
-	if checkResponseForInvalidToken(resp, session, w, r) {
+	if resp.StatusCode != http.StatusOK {
+		a.accessCache.invalidate(token)
+	}
+
+	if a.checkResponseForInvalidToken(resp, session, w, r) {
 		return true
 	}
 
+	if ssoGroupID != 0 {
+		if err := a.recordGroupSSO(session, w, r, ssoGroupID, resp.StatusCode == http.StatusOK); err != nil {
+			logRequest(r).WithError(err).Error(saveSessionErrMsg)
+			captureErrWithReqAndStackTrace(err, r)
+
+			httperrors.Serve500(w, r)
+			return true
+		}
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		// call serve404 handler when auth fails
 		err := fmt.Errorf("unexpected response fetching access token status: %d", resp.StatusCode)
@@ -545,6 +665,48 @@ func (a *Auth) checkAuthentication(w http.ResponseWriter, r *http.Request, domai
 		return true
 	}
 
+	a.accessCache.allow(token, projectID, a.now())
+
+	return false
+}
+
+// checkOIDCAuthorization authorizes the request with the claims of the ID
+// token stored in the session, any authenticated user is allowed when the
+// request is not for a project. The claims are refreshed with the refresh
+// token of the session once the ID token expired.
+func (a *Auth) checkOIDCAuthorization(session *sessions.Session, w http.ResponseWriter, r *http.Request, domain domain) bool {
+	expiry, _ := session.Values["oidc_expiry"].(int64)
+	if a.now().Unix() >= expiry {
+		if !a.refreshToken(session, r) {
+			logRequest(r).Info("OIDC ID token expired, destroying session")
+
+			destroySession(session, w, r)
+			return true
+		}
+
+		logRequest(r).Debug("OIDC ID token expired, refreshed it")
+
+		if err := session.Save(r, w); err != nil {
+			logRequest(r).WithError(err).Error(saveSessionErrMsg)
+			captureErrWithReqAndStackTrace(err, r)
+
+			httperrors.Serve500(w, r)
+			return true
+		}
+	}
+
+	if domain.GetProjectID(r) == 0 {
+		return false
+	}
+
+	values, _ := session.Values["oidc_claims"].([]string)
+	if !a.oidc.allowed(values, r.Host, a.pagesDomains) {
+		logRequest(r).WithField("host", r.Host).Info("OIDC claims do not grant access to the namespace")
+
+		domain.ServeNotFoundAuthFailed(w, r)
+		return true
+	}
+
 	return false
 }
 
@@ -569,6 +731,11 @@ func (a *Auth) GetTokenIfExists(w http.ResponseWriter, r *http.Request) (string,
 		return "", errors.New("error retrieving the session")
 	}
 
+	// tokens of an external provider must not be sent to GitLab
+	if a.oidc != nil {
+		return "", nil
+	}
+
 	if session.Values["access_token"] != nil {
 		return session.Values["access_token"].(string), nil
 	}
@@ -590,7 +757,7 @@ func (a *Auth) CheckAuthentication(w http.ResponseWriter, r *http.Request, domai
 		logRequest(r).Error(errAuthNotConfigured)
 		captureErrWithReqAndStackTrace(errAuthNotConfigured, r)
 
-		httperrors.Serve500(w)
+		httperrors.Serve500(w, r)
 		return true
 	}
 
@@ -610,14 +777,18 @@ func (a *Auth) CheckResponseForInvalidToken(w http.ResponseWriter, r *http.Reque
 		return true
 	}
 
-	if checkResponseForInvalidToken(resp, session, w, r) {
+	if token, ok := session.Values["access_token"].(string); ok && resp.StatusCode == http.StatusUnauthorized {
+		a.accessCache.invalidate(token)
+	}
+
+	if a.checkResponseForInvalidToken(resp, session, w, r) {
 		return true
 	}
 
 	return false
 }
 
-func checkResponseForInvalidToken(resp *http.Response, session *sessions.Session, w http.ResponseWriter, r *http.Request) bool {
+func (a *Auth) checkResponseForInvalidToken(resp *http.Response, session *sessions.Session, w http.ResponseWriter, r *http.Request) bool {
 	if resp.StatusCode == http.StatusUnauthorized {
 		errResp := errorResponse{}
 
@@ -630,6 +801,13 @@ func checkResponseForInvalidToken(resp *http.Response, session *sessions.Session
 		}
 
 		if errResp.Error == "invalid_token" {
+			if a.refreshToken(session, r) {
+				logRequest(r).Info("Access token was invalid, refreshed it")
+
+				saveSessionAndRedirect(session, w, r)
+				return true
+			}
+
 			// Token is invalid
 			logRequest(r).Warn("Access token was invalid, destroying session")
 
@@ -668,15 +846,18 @@ func generateKeys(secret string, count int) ([][]byte, error) {
 }
 
 // New when authentication supported this will be used to create authentication handler
-func New(pagesDomain, storeSecret, clientID, clientSecret, redirectURI, internalGitlabServer, publicGitlabServer, authScope string) (*Auth, error) {
-	// generate 3 keys, 2 for the cookie store and 1 for JWT signing
-	keys, err := generateKeys(storeSecret, 3)
+func New(pagesDomains []string, storeSecret, clientID, clientSecret, redirectURI, internalGitlabServer, publicGitlabServer, authScope string) (*Auth, error) {
+	// generate 4 keys, 2 for the cookie store, 1 for JWT signing and 1 for
+	// the share cookies
+	keys, err := generateKeys(storeSecret, 4)
 	if err != nil {
 		return nil, err
 	}
 
+	cookieStore := sessions.NewCookieStore(keys[0], keys[1])
+
 	return &Auth{
-		pagesDomain:          pagesDomain,
+		pagesDomains:         pagesDomains,
 		clientID:             clientID,
 		clientSecret:         clientSecret,
 		redirectURI:          redirectURI,
@@ -686,12 +867,18 @@ func New(pagesDomain, storeSecret, clientID, clientSecret, redirectURI, internal
 			Timeout:   5 * time.Second,
 			Transport: httptransport.DefaultTransport,
 		},
-		store:         sessions.NewCookieStore(keys[0], keys[1]),
-		authSecret:    storeSecret,
-		authScope:     authScope,
-		jwtSigningKey: keys[2],
-		jwtExpiry:     time.Minute,
-		now:           time.Now,
+		store:          cookieStore,
+		sessionCodecs:  cookieStore.Codecs,
+		authSecret:     storeSecret,
+		authScope:      authScope,
+		jwtSigningKey:  keys[2],
+		shareCookies:   newShareCookies(keys[3]),
+		jwtExpiry:      time.Minute,
+		accessCache:    newAccessCache(accessCacheTTL),
+		rejectedTokens: newAccessCache(rejectedTokenTTL),
+		refreshes:      newRefreshes(),
+		sessionMaxAge:  defaultSessionMaxAge,
+		now:            time.Now,
 	}, nil
 }
 
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/sessions"
@@ -22,7 +23,7 @@ import (
 func createTestAuth(t *testing.T, internalServer string, publicServer string) *Auth {
 	t.Helper()
 
-	a, err := New("pages.gitlab-example.com",
+	a, err := New([]string{"pages.gitlab-example.com"},
 		"something-very-secret",
 		"id",
 		"secret",
@@ -220,7 +221,7 @@ func testTryAuthenticateWithCodeAndState(t *testing.T, https bool) {
 	r.Host = strings.TrimPrefix(apiServer.URL, "http://")
 
 	setSessionValues(t, r, auth.store, map[interface{}]interface{}{
-		"uri":   "https://pages.gitlab-example.com/project/",
+		"uri":   "https://" + r.Host + "/project/",
 		"state": "state",
 	})
 
@@ -235,7 +236,7 @@ func testTryAuthenticateWithCodeAndState(t *testing.T, https bool) {
 	defer res.Body.Close()
 
 	require.Equal(t, http.StatusFound, result.Code)
-	require.Equal(t, "https://pages.gitlab-example.com/project/", result.Header().Get("Location"))
+	require.Equal(t, "https://"+r.Host+"/project/", result.Header().Get("Location"))
 	require.Equal(t, 600, res.Cookies()[0].MaxAge)
 	require.Equal(t, https, res.Cookies()[0].Secure)
 }
@@ -284,6 +285,48 @@ func TestCheckAuthenticationWhenAccess(t *testing.T) {
 	require.Equal(t, http.StatusOK, result.Code)
 }
 
+func TestCheckAuthenticationCachesAccess(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v4/projects/1000/pages_access", r.URL.Path)
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer apiServer.Close()
+
+	auth := createTestAuth(t, apiServer.URL, "")
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+
+	check := func() bool {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/style.css", nil)
+		setSessionValues(t, r, auth.store, map[interface{}]interface{}{"access_token": "abc"})
+
+		return auth.CheckAuthentication(httptest.NewRecorder(), r, &domainMock{projectID: 1000})
+	}
+
+	require.False(t, check())
+	require.False(t, check())
+	require.Equal(t, 1, calls, "access is checked once")
+
+	now = now.Add(accessCacheTTL)
+	require.False(t, check())
+	require.Equal(t, 2, calls, "expired decisions are checked again")
+
+	// a 401 from an asset request drops the cached decisions right away
+	r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/-/project/-/jobs/1/artifacts/file.txt", nil)
+	setSessionValues(t, r, auth.store, map[interface{}]interface{}{"access_token": "abc"})
+	resp := &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(strings.NewReader("{}"))}
+	auth.CheckResponseForInvalidToken(httptest.NewRecorder(), r, resp)
+
+	status = http.StatusUnauthorized
+	require.True(t, check())
+	require.Equal(t, 3, calls)
+}
+
 func TestCheckAuthenticationWhenNoAccess(t *testing.T) {
 	apiServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
@@ -563,3 +606,19 @@ func TestDomainAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestDomainAllowedMultiplePagesDomains(t *testing.T) {
+	auth := createTestAuth(t, "", "")
+	auth.pagesDomains = []string{"example.io", "example.dev"}
+
+	mockCtrl := gomock.NewController(t)
+	mockSource := mocks.NewMockSource(mockCtrl)
+
+	ctx := context.Background()
+
+	require.True(t, auth.domainAllowed(ctx, "group.example.io", mockSource))
+	require.True(t, auth.domainAllowed(ctx, "example.dev", mockSource))
+
+	mockSource.EXPECT().GetDomain(ctx, "group.example.com").Return(nil, nil)
+	require.False(t, auth.domainAllowed(ctx, "group.example.com", mockSource))
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+)
+
+// groupSSOMaxAge is how long a visitor who went through the SSO page of a
+// group views its private sites before going through it again, the length of
+// a SAML session of GitLab
+const groupSSOMaxAge = 24 * time.Hour
+
+// groupSSOPendingKey holds the group whose SSO page the visitor was sent to,
+// until the GitLab API grants the access token of the OAuth flow that follows
+// access to a project of the group
+const groupSSOPendingKey = "group_sso_pending"
+
+// groupSSODomain is implemented by the domains whose projects can belong to a
+// group enforcing its SSO
+type groupSSODomain interface {
+	GetGroupSSO(r *http.Request) (uint64, string)
+}
+
+func groupSSOKey(groupID uint64) string {
+	return fmt.Sprintf("group_sso_%d", groupID)
+}
+
+// checkGroupSSO sends the visitor through the SSO page of the group of the
+// project when it enforces its SSO and the visitor did not go through it
+// recently. The access token is dropped, so that the visitor authorizes
+// Pages again right after the SSO page. Coming back from the OAuth flow does
+// not prove the visitor went through the SSO page: it returns the group
+// pending, whose SSO is only recorded once the GitLab API grants the new
+// access token access to the project, and true when the request was served.
+func (a *Auth) checkGroupSSO(session *sessions.Session, w http.ResponseWriter, r *http.Request, domain domain) (uint64, bool) {
+	d, ok := domain.(groupSSODomain)
+	if !ok {
+		return 0, false
+	}
+
+	groupID, signInURL := d.GetGroupSSO(r)
+	if groupID == 0 {
+		return 0, false
+	}
+
+	if expiry, ok := session.Values[groupSSOKey(groupID)].(int64); ok && a.now().Unix() < expiry {
+		return 0, false
+	}
+
+	if pending, ok := session.Values[groupSSOPendingKey].(int64); ok && uint64(pending) == groupID {
+		return groupID, false
+	}
+
+	redirectURL, err := groupSSORedirectURL(signInURL, getRequestAddress(r))
+	if err != nil {
+		// fail closed, the site must not be served without the SSO
+		logRequest(r).WithError(err).WithField("group_id", groupID).Error("Invalid SSO page of the group")
+		domain.ServeNotFoundAuthFailed(w, r)
+		return 0, true
+	}
+
+	delete(session.Values, "access_token")
+	deleteRefreshToken(session)
+	session.Values[groupSSOPendingKey] = int64(groupID)
+
+	if err := session.Save(r, w); err != nil {
+		logRequest(r).WithError(err).Error(saveSessionErrMsg)
+		captureErrWithReqAndStackTrace(err, r)
+
+		httperrors.Serve500(w, r)
+		return 0, true
+	}
+
+	logRequest(r).WithField("group_id", groupID).Info("Group enforces SSO, redirecting user to the SSO page of the group")
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+	return 0, true
+}
+
+// recordGroupSSO remembers whether the visitor went through the SSO page of
+// the group pending, as proven by the GitLab API granting their access token
+// access to a project of the group. When it did not, the visitor is sent to
+// the SSO page again by their next request.
+func (a *Auth) recordGroupSSO(session *sessions.Session, w http.ResponseWriter, r *http.Request, groupID uint64, granted bool) error {
+	delete(session.Values, groupSSOPendingKey)
+
+	if granted {
+		session.Values[groupSSOKey(groupID)] = a.now().Add(groupSSOMaxAge).Unix()
+	}
+
+	return session.Save(r, w)
+}
+
+// groupSSORedirectURL adds the return address to the SSO page of a group,
+// keeping the parameters GitLab set, such as its token
+func groupSSORedirectURL(signInURL, returnTo string) (string, error) {
+	u, err := url.Parse(signInURL)
+	if err != nil {
+		return "", err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("the SSO page %q is not an absolute http(s) URL", signInURL)
+	}
+
+	query := u.Query()
+	query.Set("redirect", returnTo)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type groupSSODomainMock struct {
+	domainMock
+	groupID   uint64
+	signInURL string
+}
+
+func (dm *groupSSODomainMock) GetGroupSSO(r *http.Request) (uint64, string) {
+	return dm.groupID, dm.signInURL
+}
+
+func TestCheckAuthenticationWithGroupSSO(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v4/projects/1000/pages_access", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiServer.Close()
+
+	now := time.Now()
+	signInURL := "https://gitlab.example.com/groups/group/-/saml/sso?token=abc"
+	// the query keeps the token of GitLab
+	expectedRedirect := "https://gitlab.example.com/groups/group/-/saml/sso?redirect=" +
+		url.QueryEscape("https://group.gitlab-example.com/project/") + "&token=abc"
+
+	tests := map[string]struct {
+		signInURL        string
+		ssoExpiry        interface{}
+		expectedServed   bool
+		expectedStatus   int
+		expectedRedirect string
+	}{
+		"without_sso": {
+			signInURL:        signInURL,
+			expectedServed:   true,
+			expectedStatus:   http.StatusFound,
+			expectedRedirect: expectedRedirect,
+		},
+		"after_sso": {
+			signInURL:      signInURL,
+			ssoExpiry:      now.Add(time.Hour).Unix(),
+			expectedServed: false,
+			expectedStatus: http.StatusOK,
+		},
+		"expired_sso": {
+			signInURL:        signInURL,
+			ssoExpiry:        now.Add(-time.Second).Unix(),
+			expectedServed:   true,
+			expectedStatus:   http.StatusFound,
+			expectedRedirect: expectedRedirect,
+		},
+		"invalid_sign_in_url": {
+			signInURL:      "/groups/group/-/saml/sso",
+			expectedServed: true,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			auth := createTestAuth(t, apiServer.URL, "")
+			auth.now = func() time.Time { return now }
+
+			values := map[interface{}]interface{}{"access_token": "abc"}
+			if tt.ssoExpiry != nil {
+				values[groupSSOKey(7)] = tt.ssoExpiry
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/", nil)
+			r.RequestURI = "/project/"
+			setSessionValues(t, r, auth.store, values)
+
+			result := httptest.NewRecorder()
+			domain := &groupSSODomainMock{domainMock: domainMock{projectID: 1000}, groupID: 7, signInURL: tt.signInURL}
+
+			require.Equal(t, tt.expectedServed, auth.CheckAuthentication(result, r, domain))
+			require.Equal(t, tt.expectedStatus, result.Code)
+
+			if tt.expectedRedirect == "" {
+				return
+			}
+
+			require.Equal(t, tt.expectedRedirect, result.Header().Get("Location"))
+
+			// the visitor authorizes Pages again after the SSO page
+			next := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/", nil)
+			for _, cookie := range result.Result().Cookies() {
+				next.AddCookie(cookie)
+			}
+
+			session, err := auth.store.Get(next, "gitlab-pages")
+			require.NoError(t, err)
+			require.NotContains(t, session.Values, "access_token")
+			require.Equal(t, int64(7), session.Values[groupSSOPendingKey])
+		})
+	}
+}
+
+func TestCheckAuthenticationProvesGroupSSO(t *testing.T) {
+	var requests int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		// GitLab denies the visitors without an SSO session of the group
+		if r.URL.Path != "/api/v4/projects/1000/pages_access" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiServer.Close()
+
+	now := time.Now()
+
+	tests := map[string]struct {
+		projectID      uint64
+		expectedServed bool
+		expectedStatus int
+		expectedSSO    interface{}
+	}{
+		"granted": {
+			projectID:      1000,
+			expectedServed: false,
+			expectedStatus: http.StatusOK,
+			expectedSSO:    now.Add(groupSSOMaxAge).Unix(),
+		},
+		"denied": {
+			projectID:      2000,
+			expectedServed: true,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			auth := createTestAuth(t, apiServer.URL, "")
+			auth.now = func() time.Time { return now }
+			atomic.StoreInt32(&requests, 0)
+
+			domain := &groupSSODomainMock{
+				domainMock: domainMock{projectID: tt.projectID},
+				groupID:    7,
+				signInURL:  "https://gitlab.example.com/groups/group/-/saml/sso",
+			}
+
+			// the access token of the OAuth flow following the SSO page
+			auth.accessCache.allow("abc", tt.projectID, now)
+
+			r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/", nil)
+			setSessionValues(t, r, auth.store, map[interface{}]interface{}{
+				"access_token":     "abc",
+				groupSSOPendingKey: int64(7),
+			})
+
+			result := httptest.NewRecorder()
+			require.Equal(t, tt.expectedServed, auth.CheckAuthentication(result, r, domain))
+			require.Equal(t, tt.expectedStatus, result.Code)
+			require.Equal(t, int32(1), atomic.LoadInt32(&requests), "the SSO is not proven by the cache")
+
+			next := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/", nil)
+			for _, cookie := range result.Result().Cookies() {
+				next.AddCookie(cookie)
+			}
+
+			session, err := auth.store.Get(next, "gitlab-pages")
+			require.NoError(t, err)
+			require.NotContains(t, session.Values, groupSSOPendingKey)
+			require.Equal(t, tt.expectedSSO, session.Values[groupSSOKey(7)])
+		})
+	}
+}
+
+func TestRecordGroupSSO(t *testing.T) {
+	auth := createTestAuth(t, "", "")
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+
+	r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/", nil)
+	session, err := auth.store.Get(r, "gitlab-pages")
+	require.NoError(t, err)
+
+	session.Values[groupSSOPendingKey] = int64(7)
+	require.NoError(t, auth.recordGroupSSO(session, httptest.NewRecorder(), r, 7, false))
+	require.Empty(t, session.Values)
+
+	session.Values[groupSSOPendingKey] = int64(7)
+	require.NoError(t, auth.recordGroupSSO(session, httptest.NewRecorder(), r, 7, true))
+
+	require.NotContains(t, session.Values, groupSSOPendingKey)
+	require.Equal(t, now.Add(groupSSOMaxAge).Unix(), session.Values[groupSSOKey(7)])
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+)
+
+// privateTokenHeader holds a personal, group or project access token, as
+// accepted by the GitLab API
+const privateTokenHeader = "PRIVATE-TOKEN"
+
+// headerToken returns the header holding the access token of the request and
+// its value, for scripts and CI jobs which cannot go through the OAuth flow
+func headerToken(r *http.Request) (string, string) {
+	if token := r.Header.Get(privateTokenHeader); token != "" {
+		return privateTokenHeader, token
+	}
+
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		return "Authorization", authorization
+	}
+
+	return "", ""
+}
+
+// checkHeaderToken authorizes the request with the access token of its
+// header, which is validated against the GitLab API and never stored in the
+// session. The header is removed once authorized, so that the token is not
+// passed on. A rejected token is not checked again for a while, so that
+// garbage tokens do not each cost a call to the API. The tokens are refused
+// for the projects of a group enforcing its SSO, as the visitor cannot be sent
+// through the SSO page. It returns true when the request was served.
+func (a *Auth) checkHeaderToken(w http.ResponseWriter, r *http.Request, domain domain, header, token string) bool {
+	if d, ok := domain.(groupSSODomain); ok {
+		if groupID, _ := d.GetGroupSSO(r); groupID != 0 {
+			logRequest(r).WithField("group_id", groupID).Info("Group enforces SSO, refusing the access token of the request header")
+			httperrors.Serve403(w, r)
+			return true
+		}
+	}
+
+	projectID := domain.GetProjectID(r)
+
+	if a.rejectedTokens.rejected(token, a.now()) {
+		httperrors.Serve401(w)
+		return true
+	}
+
+	if !a.accessCache.allowed(token, projectID, a.now()) {
+		var url string
+		if projectID > 0 {
+			url = fmt.Sprintf(apiURLProjectTemplate, a.internalGitlabServer, projectID)
+		} else {
+			url = fmt.Sprintf(apiURLUserTemplate, a.internalGitlabServer)
+		}
+
+		req, err := http.NewRequestWithContext(r.Context(), "GET", url, nil)
+		if err != nil {
+			logRequest(r).WithError(err).Error(failAuthErrMsg)
+			captureErrWithReqAndStackTrace(err, r)
+
+			httperrors.Serve500(w, r)
+			return true
+		}
+
+		req.Header.Set(header, token)
+
+		resp, err := a.apiClient.Do(req)
+		if err != nil {
+			logRequest(r).WithError(err).Error("Failed to retrieve info with the token of the request header")
+			captureErrWithReqAndStackTrace(err, r)
+			domain.ServeNotFoundAuthFailed(w, r)
+			return true
+		}
+
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			a.accessCache.allow(token, projectID, a.now())
+		case http.StatusUnauthorized:
+			logRequest(r).Info("Access token of the request header was invalid")
+			a.rejectedTokens.reject(token, a.now())
+			httperrors.Serve401(w)
+			return true
+		default:
+			domain.ServeNotFoundAuthFailed(w, r)
+			return true
+		}
+	}
+
+	r.Header.Del(header)
+
+	return false
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAuthenticationWithHeaderToken(t *testing.T) {
+	var requests int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		authorized := r.Header.Get("PRIVATE-TOKEN") == "pat" || r.Header.Get("Authorization") == "Bearer pat"
+
+		switch {
+		case !authorized:
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/api/v4/projects/1000/pages_access", r.URL.Path == "/api/v4/user":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer apiServer.Close()
+
+	tests := map[string]struct {
+		header        string
+		value         string
+		projectID     uint64
+		contentServed bool
+		status        int
+	}{
+		"private_token": {
+			header:    "PRIVATE-TOKEN",
+			value:     "pat",
+			projectID: 1000,
+		},
+		"bearer_token": {
+			header:    "Authorization",
+			value:     "Bearer pat",
+			projectID: 1000,
+		},
+		"without_project": {
+			header: "PRIVATE-TOKEN",
+			value:  "pat",
+		},
+		"invalid_token": {
+			header:        "PRIVATE-TOKEN",
+			value:         "invalid",
+			projectID:     1000,
+			contentServed: true,
+			status:        http.StatusUnauthorized,
+		},
+		"no_access": {
+			header:        "PRIVATE-TOKEN",
+			value:         "pat",
+			projectID:     2000,
+			contentServed: true,
+			status:        http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			auth := createTestAuth(t, apiServer.URL, "")
+
+			result := httptest.NewRecorder()
+			reqURL, err := url.Parse("/index.html")
+			require.NoError(t, err)
+			r := &http.Request{URL: reqURL, Host: "group.pages.gitlab-example.com", Header: http.Header{}}
+			r.Header.Set(tt.header, tt.value)
+
+			contentServed := auth.CheckAuthentication(result, r, &domainMock{projectID: tt.projectID})
+			require.Equal(t, tt.contentServed, contentServed)
+			require.Empty(t, result.Header().Get("Set-Cookie"), "the token is not stored in a session")
+
+			if contentServed {
+				require.Equal(t, tt.status, result.Code)
+			} else {
+				require.Empty(t, r.Header.Get(tt.header), "the token is not passed on")
+			}
+		})
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		auth := createTestAuth(t, apiServer.URL, "")
+		atomic.StoreInt32(&requests, 0)
+
+		for i := 0; i < 2; i++ {
+			reqURL, err := url.Parse("/index.html")
+			require.NoError(t, err)
+			r := &http.Request{URL: reqURL, Host: "group.pages.gitlab-example.com", Header: http.Header{}}
+			r.Header.Set("PRIVATE-TOKEN", "pat")
+
+			require.False(t, auth.CheckAuthentication(httptest.NewRecorder(), r, &domainMock{projectID: 1000}))
+		}
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("rejected_cached", func(t *testing.T) {
+		auth := createTestAuth(t, apiServer.URL, "")
+		atomic.StoreInt32(&requests, 0)
+
+		now := time.Now()
+		auth.now = func() time.Time { return now }
+
+		check := func(projectID uint64) int {
+			reqURL, err := url.Parse("/index.html")
+			require.NoError(t, err)
+			r := &http.Request{URL: reqURL, Host: "group.pages.gitlab-example.com", Header: http.Header{}}
+			r.Header.Set("PRIVATE-TOKEN", "garbage")
+
+			result := httptest.NewRecorder()
+			require.True(t, auth.CheckAuthentication(result, r, &domainMock{projectID: projectID}))
+
+			return result.Code
+		}
+
+		require.Equal(t, http.StatusUnauthorized, check(1000))
+		require.Equal(t, http.StatusUnauthorized, check(1000))
+		require.Equal(t, http.StatusUnauthorized, check(2000), "the token is rejected for any project")
+		require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+		now = now.Add(rejectedTokenTTL)
+		require.Equal(t, http.StatusUnauthorized, check(1000))
+		require.Equal(t, int32(2), atomic.LoadInt32(&requests), "the token is checked again once expired")
+	})
+}
+
+func TestCheckAuthenticationWithHeaderTokenAndGroupSSO(t *testing.T) {
+	var requests int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiServer.Close()
+
+	auth := createTestAuth(t, apiServer.URL, "")
+
+	for _, header := range []string{"PRIVATE-TOKEN", "Authorization"} {
+		t.Run(header, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/", nil)
+			if header == "Authorization" {
+				r.Header.Set(header, "Bearer pat")
+			} else {
+				r.Header.Set(header, "pat")
+			}
+
+			domain := &groupSSODomainMock{
+				domainMock: domainMock{projectID: 1000},
+				groupID:    7,
+				signInURL:  "https://gitlab.example.com/groups/group/-/saml/sso",
+			}
+
+			result := httptest.NewRecorder()
+			require.True(t, auth.CheckAuthentication(result, r, domain))
+			require.Equal(t, http.StatusForbidden, result.Code)
+		})
+	}
+
+	require.Zero(t, atomic.LoadInt32(&requests))
+}
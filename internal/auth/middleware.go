@@ -25,8 +25,12 @@ func (a *Auth) AuthorizationMiddleware(handler http.Handler) http.Handler {
 
 		// Only for projects that have access control enabled
 		if domain.IsAccessControlEnabled(r) {
+			if a.redeemShareLink(w, r, domain) {
+				return
+			}
+
 			// accessControlMiddleware
-			if a.CheckAuthentication(w, r, domain) {
+			if !a.sharedWith(r, domain) && a.CheckAuthentication(w, r, domain) {
 				return
 			}
 		}
@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// oidcKeysRefreshInterval prevents tokens signed with an unknown key from
+// triggering a request to the JWKS endpoint every time
+const oidcKeysRefreshInterval = time.Minute
+
+var (
+	errOIDCUnknownKey   = errors.New("ID token is signed with an unknown key")
+	errOIDCInvalidToken = errors.New("ID token is invalid")
+)
+
+// OIDC configures authentication against an external OpenID Connect
+// provider instead of GitLab. Users are authorized based on the values of
+// Claim in their ID token, each value grants access to the namespaces it is
+// mapped to in Namespaces. A namespace is either the first label of a
+// domain under the pages domain, such as group for group.example.io, or a
+// custom domain.
+type OIDC struct {
+	Issuer     string
+	Claim      string
+	Namespaces map[string][]string
+}
+
+type oidcProvider struct {
+	OIDC
+
+	client *http.Client
+
+	mu        sync.Mutex
+	endpoints *oidcEndpoints
+	keys      map[string]*rsa.PublicKey
+	keysTime  time.Time
+}
+
+// oidcEndpoints is the subset of the provider metadata used by Pages
+type oidcEndpoints struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// UseOIDC authenticates users against the OpenID Connect provider described
+// by cfg instead of GitLab. The auth scope must include openid.
+func (a *Auth) UseOIDC(cfg OIDC) {
+	a.oidc = &oidcProvider{
+		OIDC:   cfg,
+		client: a.apiClient,
+	}
+	a.oidc.Issuer = strings.TrimRight(cfg.Issuer, "/")
+}
+
+// discover fetches the provider metadata once, failures are retried on the
+// next authentication
+func (p *oidcProvider) discover(ctx context.Context) (*oidcEndpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	endpoints := &oidcEndpoints{}
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", endpoints); err != nil {
+		return nil, fmt.Errorf("discovering OIDC provider: %w", err)
+	}
+
+	if endpoints.AuthorizationEndpoint == "" || endpoints.TokenEndpoint == "" || endpoints.JWKSURI == "" {
+		return nil, errors.New("OIDC provider metadata is incomplete")
+	}
+
+	p.endpoints = endpoints
+
+	return endpoints, nil
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errResponseNotOk
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *oidcProvider) authorizeURL(ctx context.Context, clientID, redirectURI, state, scope string) (string, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("client_id", clientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("response_type", "code")
+	query.Set("state", state)
+	query.Set("scope", scope)
+	// the state is kept in the session of the domain being accessed, so it
+	// also binds the ID token to that session
+	query.Set("nonce", state)
+
+	separator := "?"
+	if strings.Contains(endpoints.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return endpoints.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (p *oidcProvider) tokenURL(ctx context.Context) (string, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return endpoints.TokenEndpoint, nil
+}
+
+// key returns the public key kid of the provider, the keys are fetched again
+// when kid is unknown so rotated keys are picked up
+func (p *oidcProvider) key(ctx context.Context, jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+
+	if time.Since(p.keysTime) < oidcKeysRefreshInterval {
+		return nil, errOIDCUnknownKey
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching OIDC keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		key, err := parseRSAKey(jwk)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	p.keys = keys
+	p.keysTime = time.Now()
+
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+
+	return nil, errOIDCUnknownKey
+}
+
+func (p *oidcProvider) findKey(kid string) *rsa.PublicKey {
+	// tokens without a key ID can only be verified with a single key
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+
+	return p.keys[kid]
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus of key %q: %w", jwk.Kid, err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent of key %q: %w", jwk.Kid, err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid exponent of key %q", jwk.Kid)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// verify checks the signature and the claims of an ID token and returns the
+// values of the authorization claim that are mapped to namespaces, along
+// with the expiry of the token. An empty nonce is not checked, for the ID
+// tokens of a refresh.
+func (p *oidcProvider) verify(ctx context.Context, rawIDToken, clientID, nonce string) ([]string, int64, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	claims := jwt.MapClaims{}
+	parser := jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512"}}
+
+	_, err = parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, endpoints.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	exp, _ := claims["exp"].(float64)
+
+	switch {
+	case !claims.VerifyIssuer(endpoints.Issuer, true):
+		return nil, 0, fmt.Errorf("%w: unexpected issuer", errOIDCInvalidToken)
+	case !claims.VerifyAudience(clientID, true):
+		return nil, 0, fmt.Errorf("%w: unexpected audience", errOIDCInvalidToken)
+	case exp == 0:
+		return nil, 0, fmt.Errorf("%w: missing expiry", errOIDCInvalidToken)
+	case nonce != "" && claims["nonce"] != nonce:
+		return nil, 0, fmt.Errorf("%w: unexpected nonce", errOIDCInvalidToken)
+	}
+
+	// only the values granting access are kept, the session is a cookie
+	var values []string
+	for _, value := range claimValues(claims[p.Claim]) {
+		if _, ok := p.Namespaces[value]; ok {
+			values = append(values, value)
+		}
+	}
+
+	return values, int64(exp), nil
+}
+
+func claimValues(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return []string{claim}
+	case []interface{}:
+		values := make([]string, 0, len(claim))
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values
+	}
+
+	return nil
+}
+
+// allowed returns true if one of values grants access to the namespace of
+// host
+func (p *oidcProvider) allowed(values []string, host string, pagesDomains []string) bool {
+	namespace := requestNamespace(host, pagesDomains)
+
+	for _, value := range values {
+		for _, allowed := range p.Namespaces[value] {
+			if strings.EqualFold(allowed, namespace) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// requestNamespace returns the namespace of host under the longest of
+// pagesDomains it ends with, or host itself for a custom domain
+func requestNamespace(host string, pagesDomains []string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(host)
+
+	namespace := host
+	for _, pagesDomain := range pagesDomains {
+		if trimmed := strings.TrimSuffix(host, "."+strings.ToLower(pagesDomain)); len(trimmed) < len(namespace) {
+			namespace = trimmed
+		}
+	}
+
+	return namespace
+}
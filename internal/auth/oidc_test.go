@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/mocks"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
+)
+
+// fakeIdP is an OpenID Connect provider issuing ID tokens with claims
+type fakeIdP struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &fakeIdP{key: key}
+
+	idp.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 idp.URL,
+				"authorization_endpoint": idp.URL + "/authorize",
+				"token_endpoint":         idp.URL + "/token",
+				"jwks_uri":               idp.URL + "/jwks",
+			})
+		case "/jwks":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]string{{
+					"kty": "RSA",
+					"kid": "key-1",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				}},
+			})
+		case "/token":
+			require.Equal(t, http.MethodPost, r.Method)
+
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+			token.Header["kid"] = "key-1"
+
+			idToken, err := token.SignedString(key)
+			require.NoError(t, err)
+
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "abc", "id_token": idToken})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(idp.Close)
+
+	idp.claims = jwt.MapClaims{
+		"iss":    idp.URL,
+		"aud":    "id",
+		"sub":    "user",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"nonce":  "state",
+		"groups": []string{"admins", "unmapped"},
+	}
+
+	return idp
+}
+
+func createTestOIDCAuth(t *testing.T, idp *fakeIdP) *Auth {
+	t.Helper()
+
+	a := createTestAuth(t, "", "")
+	a.UseOIDC(OIDC{
+		Issuer: idp.URL,
+		Claim:  "groups",
+		Namespaces: map[string][]string{
+			"admins": {"group", "docs.example.com"},
+		},
+	})
+
+	return a
+}
+
+func TestOIDCRedirectsToProvider(t *testing.T) {
+	idp := newFakeIdP(t)
+	auth := createTestOIDCAuth(t, idp)
+
+	result := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/auth?domain=https%3A%2F%2Fgroup.pages.gitlab-example.com&state=state", nil)
+
+	require.True(t, auth.TryAuthenticate(result, r, mocks.NewMockSource(gomock.NewController(t))))
+	require.Equal(t, http.StatusFound, result.Code)
+
+	redirect, err := url.Parse(result.Header().Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, idp.URL+"/authorize", redirect.Scheme+"://"+redirect.Host+redirect.Path)
+	require.Equal(t, "id", redirect.Query().Get("client_id"))
+	require.Equal(t, "state", redirect.Query().Get("state"))
+	require.Equal(t, "state", redirect.Query().Get("nonce"))
+}
+
+func TestOIDCCallback(t *testing.T) {
+	tests := map[string]struct {
+		claims         func(jwt.MapClaims)
+		expectedStatus int
+		expectedClaims []string
+	}{
+		"valid_token": {
+			claims:         func(jwt.MapClaims) {},
+			expectedStatus: http.StatusFound,
+			expectedClaims: []string{"admins"},
+		},
+		"invalid_nonce": {
+			claims:         func(c jwt.MapClaims) { c["nonce"] = "other" },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"invalid_audience": {
+			claims:         func(c jwt.MapClaims) { c["aud"] = "other" },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"invalid_issuer": {
+			claims:         func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"expired": {
+			claims:         func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			tt.claims(idp.claims)
+			auth := createTestOIDCAuth(t, idp)
+
+			code, err := auth.EncryptAndSignCode("https://group.pages.gitlab-example.com", "1")
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodGet, "https://group.pages.gitlab-example.com/auth?code="+code+"&state=state", nil)
+			r.URL.Scheme = request.SchemeHTTPS
+			setSessionValues(t, r, auth.store, map[interface{}]interface{}{
+				"uri":   "https://group.pages.gitlab-example.com/project/",
+				"state": "state",
+			})
+
+			result := httptest.NewRecorder()
+			require.True(t, auth.TryAuthenticate(result, r, mocks.NewMockSource(gomock.NewController(t))))
+			require.Equal(t, tt.expectedStatus, result.Code)
+
+			if tt.expectedStatus != http.StatusFound {
+				return
+			}
+
+			next := httptest.NewRequest(http.MethodGet, "https://group.pages.gitlab-example.com/project/", nil)
+			for _, cookie := range result.Result().Cookies() {
+				next.AddCookie(cookie)
+			}
+
+			session, err := auth.store.Get(next, "gitlab-pages")
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedClaims, session.Values["oidc_claims"])
+			require.Equal(t, idp.claims["exp"], session.Values["oidc_expiry"])
+		})
+	}
+}
+
+func TestCheckOIDCAuthorization(t *testing.T) {
+	tests := map[string]struct {
+		host            string
+		projectID       uint64
+		claims          []string
+		expiry          time.Duration
+		expectedServed  bool
+		expectedStatus  int
+		expectedContent string
+	}{
+		"namespace_allowed": {
+			host:           "group.pages.gitlab-example.com",
+			projectID:      1000,
+			claims:         []string{"admins"},
+			expiry:         time.Hour,
+			expectedStatus: http.StatusOK,
+		},
+		"custom_domain_allowed": {
+			host:           "docs.example.com",
+			projectID:      1000,
+			claims:         []string{"admins"},
+			expiry:         time.Hour,
+			expectedStatus: http.StatusOK,
+		},
+		"namespace_not_allowed": {
+			host:            "other.pages.gitlab-example.com",
+			projectID:       1000,
+			claims:          []string{"admins"},
+			expiry:          time.Hour,
+			expectedServed:  true,
+			expectedStatus:  http.StatusNotFound,
+			expectedContent: "not found",
+		},
+		"no_claims": {
+			host:            "group.pages.gitlab-example.com",
+			projectID:       1000,
+			expiry:          time.Hour,
+			expectedServed:  true,
+			expectedStatus:  http.StatusNotFound,
+			expectedContent: "not found",
+		},
+		"without_project": {
+			host:           "other.pages.gitlab-example.com",
+			expiry:         time.Hour,
+			expectedStatus: http.StatusOK,
+		},
+		"expired": {
+			host:           "group.pages.gitlab-example.com",
+			projectID:      1000,
+			claims:         []string{"admins"},
+			expiry:         -time.Minute,
+			expectedServed: true,
+			expectedStatus: http.StatusFound,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			auth := createTestOIDCAuth(t, newFakeIdP(t))
+
+			result := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://"+tt.host+"/project/", nil)
+
+			session, err := auth.store.Get(r, "gitlab-pages")
+			require.NoError(t, err)
+
+			session.Values["access_token"] = "abc"
+			session.Values["oidc_claims"] = tt.claims
+			session.Values["oidc_expiry"] = time.Now().Add(tt.expiry).Unix()
+			session.Save(r, result)
+
+			served := auth.CheckAuthentication(result, r, &domainMock{projectID: tt.projectID, notFoundContent: "not found"})
+			require.Equal(t, tt.expectedServed, served)
+			require.Equal(t, tt.expectedStatus, result.Code)
+			if tt.expectedContent != "" {
+				require.Equal(t, tt.expectedContent, result.Body.String())
+			}
+		})
+	}
+}
+
+func TestCheckOIDCAuthorizationRefreshes(t *testing.T) {
+	tests := map[string]struct {
+		groups         []string
+		refreshToken   string
+		expectedServed bool
+		expectedStatus int
+		expectedClaims []string
+	}{
+		"refreshed": {
+			groups:         []string{"admins"},
+			refreshToken:   "refresh",
+			expectedStatus: http.StatusOK,
+			expectedClaims: []string{"admins"},
+		},
+		"claims_revoked": {
+			groups:         []string{"unmapped"},
+			refreshToken:   "refresh",
+			expectedServed: true,
+			expectedStatus: http.StatusNotFound,
+		},
+		"without_refresh_token": {
+			groups:         []string{"admins"},
+			expectedServed: true,
+			expectedStatus: http.StatusFound,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			idp.claims["groups"] = tt.groups
+			auth := createTestOIDCAuth(t, idp)
+
+			result := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://group.pages.gitlab-example.com/project/", nil)
+
+			session, err := auth.store.Get(r, "gitlab-pages")
+			require.NoError(t, err)
+
+			session.Values["access_token"] = "abc"
+			session.Values["oidc_claims"] = []string{"admins"}
+			session.Values["oidc_expiry"] = time.Now().Add(-time.Minute).Unix()
+			session.Values["session_start"] = time.Now().Add(-time.Hour).Unix()
+			if tt.refreshToken != "" {
+				session.Values["refresh_token"] = tt.refreshToken
+			}
+			session.Save(r, result)
+
+			served := auth.CheckAuthentication(result, r, &domainMock{projectID: 1000, notFoundContent: "not found"})
+			require.Equal(t, tt.expectedServed, served)
+			require.Equal(t, tt.expectedStatus, result.Code)
+
+			if tt.expectedClaims != nil {
+				require.Equal(t, tt.expectedClaims, session.Values["oidc_claims"])
+				require.Equal(t, idp.claims["exp"], session.Values["oidc_expiry"])
+			}
+		})
+	}
+}
+
+func TestGetTokenIfExistsWithOIDC(t *testing.T) {
+	auth := createTestOIDCAuth(t, newFakeIdP(t))
+
+	result := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "https://group.pages.gitlab-example.com/", nil)
+
+	session, err := auth.store.Get(r, "gitlab-pages")
+	require.NoError(t, err)
+
+	session.Values["access_token"] = "abc"
+	session.Save(r, result)
+
+	token, err := auth.GetTokenIfExists(result, r)
+	require.NoError(t, err)
+	require.Empty(t, token, "tokens of the OIDC provider are not meant for GitLab")
+}
+
+func TestRequestNamespace(t *testing.T) {
+	pagesDomains := []string{"example.io", "pages.example.io", "example.dev"}
+
+	tests := map[string]string{
+		"group.example.io":       "group",
+		"Group.Example.Dev:443":  "group",
+		"group.pages.example.io": "group",
+		"docs.example.com":       "docs.example.com",
+	}
+
+	for host, expected := range tests {
+		t.Run(host, func(t *testing.T) {
+			require.Equal(t, expected, requestNamespace(host, pagesDomains))
+		})
+	}
+}
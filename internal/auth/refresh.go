@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/sync/singleflight"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+)
+
+// defaultSessionMaxAge is how long after signing in the access token of a
+// visitor is refreshed, before they go through the OAuth flow again
+const defaultSessionMaxAge = 24 * time.Hour
+
+// tokenExpiryMargin renews the access tokens slightly before they expire, so
+// that they do not expire while a request is served
+const tokenExpiryMargin = 30 * time.Second
+
+// refreshGrace is how long the token a refresh token was exchanged for is
+// handed to the other requests of the session, which still send the refresh
+// token rotated by the exchange until the browser stores the new session
+const refreshGrace = 30 * time.Second
+
+// refreshes exchanges each refresh token once, however many requests of the
+// session find their access token expired at the same time
+type refreshes struct {
+	group singleflight.Group
+
+	mu        sync.Mutex
+	refreshed map[string]refreshedToken // refresh token hash -> exchanged token
+}
+
+type refreshedToken struct {
+	token  tokenResponse
+	expiry time.Time
+}
+
+func newRefreshes() *refreshes {
+	return &refreshes{refreshed: make(map[string]refreshedToken)}
+}
+
+// do returns the token refreshToken was exchanged for within the
+// refreshGrace, or exchanges it with exchange
+func (rs *refreshes) do(refreshToken string, now func() time.Time, exchange func() (tokenResponse, error)) (tokenResponse, error) {
+	key := sessionKey(refreshToken)
+
+	token, err, _ := rs.group.Do(key, func() (interface{}, error) {
+		if token, ok := rs.get(key, now()); ok {
+			return token, nil
+		}
+
+		token, err := exchange()
+		if err != nil {
+			return token, err
+		}
+
+		rs.put(key, token, now())
+
+		return token, nil
+	})
+
+	return token.(tokenResponse), err
+}
+
+func (rs *refreshes) get(key string, now time.Time) (tokenResponse, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	refreshed, ok := rs.refreshed[key]
+	if !ok || !now.Before(refreshed.expiry) {
+		return tokenResponse{}, false
+	}
+
+	return refreshed.token, true
+}
+
+func (rs *refreshes) put(key string, token tokenResponse, now time.Time) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for k, refreshed := range rs.refreshed {
+		if !now.Before(refreshed.expiry) {
+			delete(rs.refreshed, k)
+		}
+	}
+
+	if len(rs.refreshed) >= accessCacheMaxSessions {
+		// the requests racing the exchange refresh their token again
+		return
+	}
+
+	rs.refreshed[key] = refreshedToken{token: token, expiry: now.Add(refreshGrace)}
+}
+
+// LimitSessionAge refreshes the access tokens of the visitors for maxAge
+// after they signed in, before they go through the OAuth flow again. A maxAge
+// of 0 never refreshes the access tokens.
+func (a *Auth) LimitSessionAge(maxAge time.Duration) {
+	a.sessionMaxAge = maxAge
+}
+
+// storeToken stores the access token and the refresh token of token in the
+// session, which is encrypted
+func (a *Auth) storeToken(session *sessions.Session, token tokenResponse) {
+	session.Values["access_token"] = token.AccessToken
+
+	// the refresh token is not rotated by every provider
+	if token.RefreshToken != "" {
+		session.Values["refresh_token"] = token.RefreshToken
+	}
+
+	if token.ExpiresIn > 0 {
+		session.Values["token_expiry"] = a.now().Add(time.Duration(token.ExpiresIn) * time.Second).Unix()
+	} else {
+		delete(session.Values, "token_expiry")
+	}
+}
+
+func deleteRefreshToken(session *sessions.Session) {
+	delete(session.Values, "refresh_token")
+	delete(session.Values, "token_expiry")
+}
+
+// refreshToken renews the access token of the session with its refresh
+// token. The concurrent requests of a session share a single exchange, so
+// that a provider rotating the refresh tokens does not reject all but the
+// first of them. It returns false when the session has no refresh token, is
+// older than the sessionMaxAge or the refresh fails, the session must then go
+// through the OAuth flow again.
+func (a *Auth) refreshToken(session *sessions.Session, r *http.Request) bool {
+	if a.sessionMaxAge <= 0 {
+		return false
+	}
+
+	refreshToken, _ := session.Values["refresh_token"].(string)
+	started, _ := session.Values["session_start"].(int64)
+	if refreshToken == "" || a.now().Sub(time.Unix(started, 0)) >= a.sessionMaxAge {
+		return false
+	}
+
+	content := url.Values{}
+	content.Set("refresh_token", refreshToken)
+	content.Set("grant_type", "refresh_token")
+	content.Set("redirect_uri", a.redirectURI)
+
+	token, err := a.refreshes.do(refreshToken, a.now, func() (tokenResponse, error) {
+		// the exchange is shared, it must not fail when the request which
+		// started it is canceled
+		return a.requestToken(context.Background(), content)
+	})
+	if err != nil {
+		logRequest(r).WithError(err).Warn("failed to refresh the access token")
+		return false
+	}
+
+	if a.oidc != nil && !a.refreshOIDCClaims(session, r, token) {
+		return false
+	}
+
+	if expired, ok := session.Values["access_token"].(string); ok {
+		a.accessCache.invalidate(expired)
+	}
+
+	a.storeToken(session, token)
+
+	return true
+}
+
+// refreshOIDCClaims stores the claims of the ID token returned by a refresh.
+// A provider returning no ID token on refresh keeps the claims of the session
+// valid until the new access token expires.
+func (a *Auth) refreshOIDCClaims(session *sessions.Session, r *http.Request, token tokenResponse) bool {
+	if token.IDToken == "" {
+		if token.ExpiresIn <= 0 {
+			return false
+		}
+
+		session.Values["oidc_expiry"] = a.now().Add(time.Duration(token.ExpiresIn) * time.Second).Unix()
+		return true
+	}
+
+	// the ID tokens of a refresh come from the token endpoint directly, they
+	// are not bound to the nonce of the sign in
+	values, expiry, err := a.oidc.verify(r.Context(), token.IDToken, a.clientID, "")
+	if err != nil {
+		logRequest(r).WithError(err).Warn("failed to verify the refreshed OIDC ID token")
+		return false
+	}
+
+	session.Values["oidc_claims"] = values
+	session.Values["oidc_expiry"] = expiry
+
+	return true
+}
+
+// renewExpiredToken refreshes the access token of the session when it
+// expired, or drops it for the visitor to go through the OAuth flow again
+// when it cannot be refreshed. It returns true when the request was served.
+func (a *Auth) renewExpiredToken(session *sessions.Session, w http.ResponseWriter, r *http.Request) bool {
+	expiry, ok := session.Values["token_expiry"].(int64)
+	if !ok || session.Values["access_token"] == nil || a.now().Add(tokenExpiryMargin).Unix() < expiry {
+		return false
+	}
+
+	if !a.refreshToken(session, r) {
+		logRequest(r).Debug("Access token expired, dropping it")
+
+		delete(session.Values, "access_token")
+		deleteRefreshToken(session)
+		return false
+	}
+
+	logRequest(r).Debug("Access token expired, refreshed it")
+
+	if err := session.Save(r, w); err != nil {
+		logRequest(r).WithError(err).Error(saveSessionErrMsg)
+		captureErrWithReqAndStackTrace(err, r)
+
+		httperrors.Serve500(w, r)
+		return true
+	}
+
+	return false
+}
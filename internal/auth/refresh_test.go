@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newRefreshTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "refresh_token", r.Form.Get("grant_type"))
+
+			if r.Form.Get("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			fmt.Fprint(w, `{"access_token":"renewed","refresh_token":"rotated","expires_in":7200}`)
+		case "/api/v4/projects/1000/pages_access":
+			if r.Header.Get("Authorization") != "Bearer renewed" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"invalid_token"}`)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Logf("Unexpected r.URL.RawPath: %q", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCheckAuthenticationRefreshesToken(t *testing.T) {
+	apiServer := newRefreshTestServer(t)
+	defer apiServer.Close()
+
+	now := time.Now()
+
+	tests := map[string]struct {
+		values        map[interface{}]interface{}
+		contentServed bool
+		accessToken   interface{}
+		refreshToken  interface{}
+	}{
+		"invalid_token": {
+			values: map[interface{}]interface{}{
+				"access_token":  "expired",
+				"refresh_token": "refresh",
+				"session_start": now.Add(-time.Hour).Unix(),
+			},
+			contentServed: true,
+			accessToken:   "renewed",
+			refreshToken:  "rotated",
+		},
+		"expired_token": {
+			values: map[interface{}]interface{}{
+				"access_token":  "expired",
+				"refresh_token": "refresh",
+				"token_expiry":  now.Add(-time.Minute).Unix(),
+				"session_start": now.Add(-time.Hour).Unix(),
+			},
+			contentServed: false,
+			accessToken:   "renewed",
+			refreshToken:  "rotated",
+		},
+		"session_too_old": {
+			values: map[interface{}]interface{}{
+				"access_token":  "expired",
+				"refresh_token": "refresh",
+				"session_start": now.Add(-defaultSessionMaxAge).Unix(),
+			},
+			contentServed: true,
+		},
+		"refresh_failed": {
+			values: map[interface{}]interface{}{
+				"access_token":  "expired",
+				"refresh_token": "revoked",
+				"token_expiry":  now.Add(-time.Minute).Unix(),
+				"session_start": now.Add(-time.Hour).Unix(),
+			},
+			contentServed: true,
+		},
+		"without_refresh_token": {
+			values: map[interface{}]interface{}{
+				"access_token": "expired",
+			},
+			contentServed: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			auth := createTestAuth(t, apiServer.URL, "")
+			auth.now = func() time.Time { return now }
+
+			result := httptest.NewRecorder()
+			reqURL, err := url.Parse("/index.html")
+			require.NoError(t, err)
+			r := &http.Request{URL: reqURL, Host: "group.pages.gitlab-example.com"}
+
+			session, err := auth.store.Get(r, "gitlab-pages")
+			require.NoError(t, err)
+			session.Values = tt.values
+
+			contentServed := auth.CheckAuthentication(result, r, &domainMock{projectID: 1000})
+			require.Equal(t, tt.contentServed, contentServed)
+			if contentServed {
+				require.Equal(t, http.StatusFound, result.Code)
+			}
+
+			require.Equal(t, tt.accessToken, session.Values["access_token"])
+			require.Equal(t, tt.refreshToken, session.Values["refresh_token"])
+		})
+	}
+}
+
+func TestCheckAuthenticationSharesRotatedRefreshToken(t *testing.T) {
+	var exchanges int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			require.NoError(t, r.ParseForm())
+
+			// the refresh token is rotated by the first exchange
+			if r.Form.Get("refresh_token") != "refresh" || atomic.AddInt32(&exchanges, 1) > 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant"}`)
+				return
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprint(w, `{"access_token":"renewed","refresh_token":"rotated","expires_in":7200}`)
+		case "/api/v4/projects/1000/pages_access":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer apiServer.Close()
+
+	now := time.Now()
+
+	auth := createTestAuth(t, apiServer.URL, "")
+	auth.now = func() time.Time { return now }
+
+	check := func() map[interface{}]interface{} {
+		reqURL, err := url.Parse("/index.html")
+		require.NoError(t, err)
+		r := &http.Request{URL: reqURL, Host: "group.pages.gitlab-example.com"}
+
+		session, err := auth.store.Get(r, "gitlab-pages")
+		require.NoError(t, err)
+		session.Values = map[interface{}]interface{}{
+			"access_token":  "expired",
+			"refresh_token": "refresh",
+			"token_expiry":  now.Add(-time.Minute).Unix(),
+			"session_start": now.Add(-time.Hour).Unix(),
+		}
+
+		require.False(t, auth.CheckAuthentication(httptest.NewRecorder(), r, &domainMock{projectID: 1000}))
+
+		return session.Values
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			values := check()
+			require.Equal(t, "renewed", values["access_token"])
+			require.Equal(t, "rotated", values["refresh_token"])
+		}()
+	}
+	wg.Wait()
+
+	// a request sent before the browser stored the rotated token
+	now = now.Add(refreshGrace - time.Second)
+	values := check()
+	require.Equal(t, "renewed", values["access_token"])
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&exchanges))
+}
+
+func TestCheckAuthenticationWithoutSessionMaxAge(t *testing.T) {
+	apiServer := newRefreshTestServer(t)
+	defer apiServer.Close()
+
+	auth := createTestAuth(t, apiServer.URL, "")
+	auth.LimitSessionAge(0)
+
+	result := httptest.NewRecorder()
+	reqURL, err := url.Parse("/index.html")
+	require.NoError(t, err)
+	r := &http.Request{URL: reqURL, Host: "group.pages.gitlab-example.com"}
+
+	session, err := auth.store.Get(r, "gitlab-pages")
+	require.NoError(t, err)
+	session.Values["access_token"] = "expired"
+	session.Values["refresh_token"] = "refresh"
+	session.Values["session_start"] = time.Now().Unix()
+
+	require.True(t, auth.CheckAuthentication(result, r, &domainMock{projectID: 1000}))
+	require.Nil(t, session.Values["access_token"])
+	require.Nil(t, session.Values["refresh_token"])
+}
+
+func TestStoreToken(t *testing.T) {
+	auth := createTestAuth(t, "", "")
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+
+	r, err := http.NewRequest("GET", "/", nil)
+	require.NoError(t, err)
+
+	session, err := auth.store.Get(r, "gitlab-pages")
+	require.NoError(t, err)
+
+	auth.storeToken(session, tokenResponse{AccessToken: "abc", RefreshToken: "refresh", ExpiresIn: 60})
+	require.Equal(t, "abc", session.Values["access_token"])
+	require.Equal(t, "refresh", session.Values["refresh_token"])
+	require.Equal(t, now.Add(time.Minute).Unix(), session.Values["token_expiry"])
+
+	// the refresh token is kept when the provider does not rotate it
+	auth.storeToken(session, tokenResponse{AccessToken: "def"})
+	require.Equal(t, "def", session.Values["access_token"])
+	require.Equal(t, "refresh", session.Values["refresh_token"])
+	require.Nil(t, session.Values["token_expiry"])
+}
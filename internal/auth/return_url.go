@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var (
+	errInvalidReturnURL  = errors.New("invalid return URL")
+	errReturnURLScheme   = errors.New("return URL scheme must be http or https")
+	errReturnURLHost     = errors.New("return URL host does not match originating domain")
+	errReturnURLPath     = errors.New("return URL path is not allowed")
+	errInvalidAuthDomain = errors.New("invalid auth domain")
+)
+
+// validateReturnURL makes sure the URL the user is sent back to after a successful
+// login is an absolute http(s) URL pointing at the originating host. Protocol-relative
+// paths, embedded credentials and encoded separators are rejected so the auth flow
+// can't be used as an open redirect.
+func validateReturnURL(rawURL, host string) (*url.URL, error) {
+	if containsUnsafeChars(rawURL) {
+		return nil, errInvalidReturnURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errInvalidReturnURL
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errReturnURLScheme
+	}
+
+	if u.User != nil || u.Opaque != "" || u.Host == "" {
+		return nil, errInvalidReturnURL
+	}
+
+	if !strings.EqualFold(u.Host, host) {
+		return nil, errReturnURLHost
+	}
+
+	if !allowedReturnPath(u) {
+		return nil, errReturnURLPath
+	}
+
+	return u, nil
+}
+
+// validateAuthDomain makes sure the domain query parameter used to proxy the auth
+// callback only contains a scheme and a host, e.g. https://namespace.gitlab.io
+func validateAuthDomain(rawURL string) (*url.URL, error) {
+	if containsUnsafeChars(rawURL) {
+		return nil, errInvalidAuthDomain
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errInvalidAuthDomain
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errInvalidAuthDomain
+	}
+
+	if u.User != nil || u.Opaque != "" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" ||
+		(u.Path != "" && u.Path != "/") {
+		return nil, errInvalidAuthDomain
+	}
+
+	return u, nil
+}
+
+func allowedReturnPath(u *url.URL) bool {
+	if u.Path == "" {
+		return true
+	}
+
+	// u.Path is already unescaped, so this also catches percent-encoded
+	// protocol-relative paths such as /%2F%2Fevil.com or /%5Cevil.com
+	return strings.HasPrefix(u.Path, "/") &&
+		!strings.HasPrefix(u.Path, "//") &&
+		!strings.HasPrefix(u.Path, "/\\")
+}
+
+// containsUnsafeChars reports whether rawURL contains characters browsers are
+// known to normalize in surprising ways (backslashes, control characters and
+// whitespace), either literally or percent-encoded in the authority section.
+func containsUnsafeChars(rawURL string) bool {
+	if strings.Contains(rawURL, "\\") {
+		return true
+	}
+
+	for _, c := range rawURL {
+		if c < 0x21 || c == 0x7f {
+			return true
+		}
+	}
+
+	authority := rawURL
+	if i := strings.Index(authority, "://"); i >= 0 {
+		authority = authority[i+3:]
+	}
+	if i := strings.IndexAny(authority, "/?#"); i >= 0 {
+		authority = authority[:i]
+	}
+
+	return strings.Contains(authority, "%")
+}
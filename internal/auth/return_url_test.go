@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReturnURL(t *testing.T) {
+	tests := map[string]struct {
+		url         string
+		host        string
+		expectedErr error
+	}{
+		"same_host": {
+			url:  "https://group.gitlab.io/project/index.html?a=b",
+			host: "group.gitlab.io",
+		},
+		"same_host_with_port": {
+			url:  "http://group.gitlab.io:8080/project/",
+			host: "group.gitlab.io:8080",
+		},
+		"host_is_case_insensitive": {
+			url:  "https://Group.GitLab.io/",
+			host: "group.gitlab.io",
+		},
+		"empty_path": {
+			url:  "https://group.gitlab.io",
+			host: "group.gitlab.io",
+		},
+		"external_host": {
+			url:         "https://evil.com/project/",
+			host:        "group.gitlab.io",
+			expectedErr: errReturnURLHost,
+		},
+		"suffix_of_host": {
+			url:         "https://group.gitlab.io.evil.com/",
+			host:        "group.gitlab.io",
+			expectedErr: errReturnURLHost,
+		},
+		"javascript_scheme": {
+			url:         "javascript:alert(1)",
+			host:        "group.gitlab.io",
+			expectedErr: errReturnURLScheme,
+		},
+		"protocol_relative": {
+			url:         "//evil.com/",
+			host:        "group.gitlab.io",
+			expectedErr: errReturnURLScheme,
+		},
+		"relative_path": {
+			url:         "/project/",
+			host:        "group.gitlab.io",
+			expectedErr: errReturnURLScheme,
+		},
+		"user_info": {
+			url:         "https://group.gitlab.io@evil.com/",
+			host:        "group.gitlab.io",
+			expectedErr: errInvalidReturnURL,
+		},
+		"protocol_relative_path": {
+			url:         "https://group.gitlab.io//evil.com/",
+			host:        "group.gitlab.io",
+			expectedErr: errReturnURLPath,
+		},
+		"encoded_protocol_relative_path": {
+			url:         "https://group.gitlab.io/%2F%2Fevil.com/",
+			host:        "group.gitlab.io",
+			expectedErr: errReturnURLPath,
+		},
+		"encoded_backslash_path": {
+			url:         "https://group.gitlab.io/%5Cevil.com/",
+			host:        "group.gitlab.io",
+			expectedErr: errReturnURLPath,
+		},
+		"backslash": {
+			url:         "https://group.gitlab.io\\@evil.com/",
+			host:        "group.gitlab.io",
+			expectedErr: errInvalidReturnURL,
+		},
+		"encoded_host": {
+			url:         "https://group.gitlab.io%2eevil.com/",
+			host:        "group.gitlab.io",
+			expectedErr: errInvalidReturnURL,
+		},
+		"encoded_at_sign": {
+			url:         "https://group.gitlab.io%40evil.com/",
+			host:        "group.gitlab.io",
+			expectedErr: errInvalidReturnURL,
+		},
+		"tab_in_url": {
+			url:         "https://group.gitlab.io/\t/evil.com",
+			host:        "group.gitlab.io",
+			expectedErr: errInvalidReturnURL,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			u, err := validateReturnURL(tt.url, tt.host)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				require.Nil(t, u)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, u)
+		})
+	}
+}
+
+func TestValidateAuthDomain(t *testing.T) {
+	tests := map[string]struct {
+		domain      string
+		expectedErr bool
+	}{
+		"https_domain":           {domain: "https://group.gitlab.io"},
+		"http_domain_with_port":  {domain: "http://group.gitlab.io:8080"},
+		"trailing_slash":         {domain: "https://group.gitlab.io/"},
+		"with_path":              {domain: "https://group.gitlab.io/project", expectedErr: true},
+		"with_query":             {domain: "https://group.gitlab.io?next=//evil.com", expectedErr: true},
+		"with_fragment":          {domain: "https://group.gitlab.io#evil", expectedErr: true},
+		"protocol_relative":      {domain: "//evil.com", expectedErr: true},
+		"javascript_scheme":      {domain: "javascript:alert(1)", expectedErr: true},
+		"user_info":              {domain: "https://group.gitlab.io@evil.com", expectedErr: true},
+		"backslash":              {domain: "https://evil.com\\.group.gitlab.io", expectedErr: true},
+		"encoded_host_separator": {domain: "https://evil.com%2fgroup.gitlab.io", expectedErr: true},
+		"empty":                  {domain: "", expectedErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := validateAuthDomain(tt.domain)
+			if tt.expectedErr {
+				require.ErrorIs(t, err, errInvalidAuthDomain)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	redisSessionKeyPrefix    = "gitlab-pages:session:"
+	redisRedemptionKeyPrefix = "gitlab-pages:share-redeemed:"
+)
+
+// sessionBackend keeps the encoded values of the sessions by ID
+type sessionBackend interface {
+	// load returns nil for a session which does not exist or expired
+	load(ctx context.Context, id string) ([]byte, error)
+	save(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	delete(ctx context.Context, id string) error
+}
+
+// serverStore is a sessions.Store keeping the sessions server side in a
+// sessionBackend, the cookie only holds the signed ID of the session. A
+// session deleted from the backend is revoked.
+type serverStore struct {
+	backend sessionBackend
+	codecs  []securecookie.Codec
+}
+
+func newServerStore(backend sessionBackend, codecs []securecookie.Codec) *serverStore {
+	return &serverStore{
+		backend: backend,
+		codecs:  codecs,
+	}
+}
+
+// Get returns the session of the request, see sessions.Store
+func (s *serverStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns the session stored for the ID of the cookie, or a new session
+// when there is none, see sessions.Store
+func (s *serverStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	session.Options = &sessions.Options{Path: "/", MaxAge: authSessionMaxAge}
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	if err := securecookie.DecodeMulti(name, cookie.Value, &session.ID, s.codecs...); err != nil {
+		return session, err
+	}
+
+	data, err := s.backend.load(r.Context(), session.ID)
+	if err != nil {
+		return session, err
+	}
+
+	if data == nil {
+		// the session expired or was revoked, a new one gets a new ID
+		session.ID = ""
+		return session, nil
+	}
+
+	if err := securecookie.DecodeMulti(name, string(data), &session.Values, s.codecs...); err != nil {
+		return session, err
+	}
+
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Save stores the values of the session and sets its cookie, a negative
+// MaxAge deletes the session, see sessions.Store
+func (s *serverStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.backend.delete(r.Context(), session.ID); err != nil {
+				return err
+			}
+		}
+
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		id, err := newSessionID()
+		if err != nil {
+			return err
+		}
+
+		session.ID = id
+	}
+
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.codecs...)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Duration(session.Options.MaxAge) * time.Second
+	if err := s.backend.save(r.Context(), session.ID, []byte(data), ttl); err != nil {
+		return err
+	}
+
+	encodedID, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encodedID, session.Options))
+
+	return nil
+}
+
+func newSessionID() (string, error) {
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(id), "="), nil
+}
+
+type redisBackend struct {
+	client *redis.Client
+}
+
+func (b *redisBackend) load(ctx context.Context, id string) ([]byte, error) {
+	data, err := b.client.Get(ctx, redisSessionKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+func (b *redisBackend) save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	return b.client.Set(ctx, redisSessionKeyPrefix+id, data, ttl).Err()
+}
+
+func (b *redisBackend) delete(ctx context.Context, id string) error {
+	return b.client.Del(ctx, redisSessionKeyPrefix+id).Err()
+}
+
+// redisRedemptions remember the one-time share links redeemed by all the
+// Pages instances sharing the Redis server
+type redisRedemptions struct {
+	client *redis.Client
+}
+
+// Redeem returns whether the one-time token id was not redeemed yet, see
+// share.Redemptions
+func (r *redisRedemptions) Redeem(ctx context.Context, id string, expiry time.Time) (bool, error) {
+	ttl := time.Until(expiry)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	return r.client.SetNX(ctx, redisRedemptionKeyPrefix+id, 1, ttl).Result()
+}
+
+// UseRedisSessions keeps the sessions in the Redis server at address instead
+// of cookies, so that they can be revoked by deleting their key. The one-time
+// share links of UseShareLinks are then redeemed in the Redis server too.
+func (a *Auth) UseRedisSessions(address, password string) {
+	a.redis = redis.NewClient(&redis.Options{
+		Addr:     address,
+		Password: password,
+	})
+	a.store = newServerStore(&redisBackend{client: a.redis}, a.sessionCodecs)
+
+	if a.shares != nil {
+		a.shares.UseRedemptions(&redisRedemptions{client: a.redis})
+	}
+}
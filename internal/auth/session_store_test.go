@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memoryBackend struct {
+	mu       sync.Mutex
+	sessions map[string][]byte
+	ttls     map[string]time.Duration
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{
+		sessions: make(map[string][]byte),
+		ttls:     make(map[string]time.Duration),
+	}
+}
+
+func (b *memoryBackend) load(_ context.Context, id string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.sessions[id], nil
+}
+
+func (b *memoryBackend) save(_ context.Context, id string, data []byte, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sessions[id] = data
+	b.ttls[id] = ttl
+
+	return nil
+}
+
+func (b *memoryBackend) delete(_ context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.sessions, id)
+	delete(b.ttls, id)
+
+	return nil
+}
+
+func (b *memoryBackend) revokeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sessions = make(map[string][]byte)
+}
+
+func TestServerStore(t *testing.T) {
+	auth := createTestAuth(t, "", "")
+	backend := newMemoryBackend()
+	store := newServerStore(backend, auth.sessionCodecs)
+
+	r, err := http.NewRequest("GET", "/", nil)
+	require.NoError(t, err)
+
+	setSessionValues(t, r, store, map[interface{}]interface{}{"access_token": "abc"})
+
+	require.Len(t, backend.sessions, 1)
+	for id, ttl := range backend.ttls {
+		require.Equal(t, authSessionMaxAge*time.Second, ttl)
+
+		cookie, err := r.Cookie("gitlab-pages")
+		require.NoError(t, err)
+		require.NotContains(t, cookie.Value, id, "the cookie holds the encoded ID")
+		require.Less(t, len(cookie.Value), 200, "the cookie does not hold the values")
+	}
+
+	session, err := store.Get(r, "gitlab-pages")
+	require.NoError(t, err)
+	require.False(t, session.IsNew)
+	require.Equal(t, "abc", session.Values["access_token"])
+
+	t.Run("revoked", func(t *testing.T) {
+		backend.revokeAll()
+
+		revoked, err := http.NewRequest("GET", "/", nil)
+		require.NoError(t, err)
+		revoked.Header.Set("Cookie", r.Header.Get("Cookie"))
+
+		session, err := store.Get(revoked, "gitlab-pages")
+		require.NoError(t, err)
+		require.True(t, session.IsNew)
+		require.Empty(t, session.Values)
+		require.Empty(t, session.ID)
+	})
+
+	t.Run("tampered_cookie", func(t *testing.T) {
+		tampered, err := http.NewRequest("GET", "/", nil)
+		require.NoError(t, err)
+		tampered.AddCookie(&http.Cookie{Name: "gitlab-pages", Value: "invalid"})
+
+		session, err := store.Get(tampered, "gitlab-pages")
+		require.Error(t, err)
+		require.True(t, session.IsNew)
+	})
+}
+
+func TestServerStoreDelete(t *testing.T) {
+	auth := createTestAuth(t, "", "")
+	backend := newMemoryBackend()
+	store := newServerStore(backend, auth.sessionCodecs)
+
+	r, err := http.NewRequest("GET", "/", nil)
+	require.NoError(t, err)
+
+	session, err := store.Get(r, "gitlab-pages")
+	require.NoError(t, err)
+
+	session.Values["access_token"] = "abc"
+	require.NoError(t, session.Save(r, httptest.NewRecorder()))
+	require.Len(t, backend.sessions, 1)
+
+	session.Options.MaxAge = -1
+	result := httptest.NewRecorder()
+	require.NoError(t, session.Save(r, result))
+	require.Empty(t, backend.sessions)
+	require.True(t, strings.HasPrefix(result.Header().Get("Set-Cookie"), "gitlab-pages=;"))
+}
+
+func TestUseRedisSessions(t *testing.T) {
+	auth := createTestAuth(t, "", "")
+	auth.UseRedisSessions("localhost:6379", "")
+
+	require.IsType(t, &serverStore{}, auth.store)
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/share"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// shareCookiePrefix is followed by the project ID, so that a visitor can hold
+// the share links of several projects of a domain
+const shareCookiePrefix = "gitlab-pages-share-"
+
+// shareGrant is the access granted by a redeemed share link
+type shareGrant struct {
+	Host      string
+	ProjectID uint64
+	Expiry    int64
+}
+
+func newShareCookies(hashKey []byte) *securecookie.SecureCookie {
+	// the grant holds its own expiry, which can be longer than the default
+	// max age
+	return securecookie.New(hashKey, nil).MaxAge(0)
+}
+
+// UseShareLinks lets the visitors with a share link verified by verifier view
+// the project the link was minted for, without signing in. The one-time links
+// are redeemed in the Redis server of UseRedisSessions, if any, so that they
+// are redeemed once across all the Pages instances.
+func (a *Auth) UseShareLinks(verifier *share.Verifier) {
+	a.shares = verifier
+
+	if a.redis != nil {
+		a.shares.UseRedemptions(&redisRedemptions{client: a.redis})
+	}
+}
+
+// redeemShareLink verifies the share link of the request and remembers the
+// access it grants in a cookie, before redirecting to the URL without the
+// link. It returns true when the request was served.
+func (a *Auth) redeemShareLink(w http.ResponseWriter, r *http.Request, domain domain) bool {
+	if a == nil || a.shares == nil {
+		return false
+	}
+
+	token := r.URL.Query().Get(share.QueryParam)
+	if token == "" {
+		return false
+	}
+
+	host := request.GetHostWithoutPort(r)
+	projectID := domain.GetProjectID(r)
+
+	claims, err := a.shares.Verify(r.Context(), token, host, projectID)
+	if err != nil {
+		logRequest(r).WithError(err).Info("Refusing share link")
+		metrics.ShareLinks.WithLabelValues("refused").Inc()
+
+		domain.ServeNotFoundAuthFailed(w, r)
+		return true
+	}
+
+	grant := shareGrant{Host: strings.ToLower(host), ProjectID: projectID, Expiry: claims.ExpiresAt.Unix()}
+	name := fmt.Sprintf("%s%d", shareCookiePrefix, projectID)
+
+	value, err := a.shareCookies.Encode(name, grant)
+	if err != nil {
+		logRequest(r).WithError(err).Error("failed to encode the share cookie")
+		captureErrWithReqAndStackTrace(err, r)
+
+		httperrors.Serve500(w, r)
+		return true
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  claims.ExpiresAt.Time,
+		HttpOnly: true,
+		Secure:   request.IsHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	logRequest(r).WithField("project_id", projectID).Info("Share link was redeemed, redirecting visitor to the shared page")
+	metrics.ShareLinks.WithLabelValues("redeemed").Inc()
+
+	// keep the token out of the history and the referrers
+	u := *r.URL
+	query := u.Query()
+	query.Del(share.QueryParam)
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.RequestURI(), http.StatusFound)
+	return true
+}
+
+// sharedWith returns whether the visitor redeemed a share link of the
+// project of the request which has not expired yet
+func (a *Auth) sharedWith(r *http.Request, domain domain) bool {
+	if a == nil || a.shares == nil {
+		return false
+	}
+
+	projectID := domain.GetProjectID(r)
+	if projectID == 0 {
+		return false
+	}
+
+	cookie, err := r.Cookie(fmt.Sprintf("%s%d", shareCookiePrefix, projectID))
+	if err != nil {
+		return false
+	}
+
+	var grant shareGrant
+	if err := a.shareCookies.Decode(cookie.Name, cookie.Value, &grant); err != nil {
+		return false
+	}
+
+	return grant.ProjectID == projectID &&
+		strings.EqualFold(grant.Host, request.GetHostWithoutPort(r)) &&
+		a.now().Before(time.Unix(grant.Expiry, 0))
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/share"
+)
+
+var shareSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestShareLink(t *testing.T) {
+	auth := createTestAuth(t, "", "")
+	auth.UseShareLinks(share.NewVerifier(shareSecret, time.Hour))
+
+	domain := &domainMock{projectID: 1000, notFoundContent: "Generic 404"}
+
+	token, err := share.Mint(shareSecret, "group.gitlab-example.com", 1000, time.Now().Add(time.Minute), false)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "http://group.gitlab-example.com/project/page.html?a=b&"+share.QueryParam+"="+token, nil)
+	require.False(t, auth.sharedWith(r, domain))
+
+	result := httptest.NewRecorder()
+	require.True(t, auth.redeemShareLink(result, r, domain))
+
+	res := result.Result()
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusFound, res.StatusCode)
+	require.Equal(t, "/project/page.html?a=b", res.Header.Get("Location"))
+	require.Len(t, res.Cookies(), 1)
+
+	cookie := res.Cookies()[0]
+	require.Equal(t, "gitlab-pages-share-1000", cookie.Name)
+	require.True(t, cookie.HttpOnly)
+
+	r = httptest.NewRequest(http.MethodGet, "http://group.gitlab-example.com/project/page.html?a=b", nil)
+	r.AddCookie(cookie)
+	require.False(t, auth.redeemShareLink(httptest.NewRecorder(), r, domain))
+	require.True(t, auth.sharedWith(r, domain))
+
+	t.Run("other_project", func(t *testing.T) {
+		require.False(t, auth.sharedWith(r, &domainMock{projectID: 1001}))
+	})
+
+	t.Run("other_host", func(t *testing.T) {
+		other := httptest.NewRequest(http.MethodGet, "http://other.gitlab-example.com/project/", nil)
+		other.AddCookie(cookie)
+
+		require.False(t, auth.sharedWith(other, domain))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		auth.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		defer func() { auth.now = time.Now }()
+
+		require.False(t, auth.sharedWith(r, domain))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		require.False(t, createTestAuth(t, "", "").sharedWith(r, domain))
+	})
+}
+
+func TestShareLinkRefused(t *testing.T) {
+	auth := createTestAuth(t, "", "")
+	auth.UseShareLinks(share.NewVerifier(shareSecret, time.Hour))
+
+	domain := &domainMock{projectID: 1000, notFoundContent: "Generic 404"}
+
+	token, err := share.Mint(shareSecret, "group.gitlab-example.com", 1001, time.Now().Add(time.Minute), false)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "http://group.gitlab-example.com/project/?"+share.QueryParam+"="+token, nil)
+	result := httptest.NewRecorder()
+	require.True(t, auth.redeemShareLink(result, r, domain))
+
+	res := result.Result()
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+	require.Empty(t, res.Cookies())
+}
@@ -0,0 +1,43 @@
+package bodylimiter
+
+import (
+	"net/http"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// NewMiddleware returns middleware which rejects requests whose body is
+// larger than limit bytes with 413 Request Entity Too Large. The bodies of
+// unknown length, sent with chunked encoding, fail to be read past limit.
+func NewMiddleware(handler http.Handler, limit int64) http.Handler {
+	if limit == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			metrics.OversizedRequestsCount.WithLabelValues("body").Inc()
+
+			log.WithFields(log.Fields{
+				"host":         r.Host,
+				"method":       r.Method,
+				"content_size": r.ContentLength,
+				"limit":        limit,
+			}).Info("request body too large")
+
+			// the body is not read to reuse the connection
+			w.Header().Set("Connection", "close")
+			httperrors.Serve413(w)
+			return
+		}
+
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,81 @@
+package bodylimiter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestNewMiddleware(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		io.WriteString(w, "hello")
+	})
+
+	tests := map[string]struct {
+		limit          int64
+		body           string
+		unknownLength  bool
+		expectedStatus int
+		oversized      bool
+	}{
+		"with_disabled_middleware": {
+			limit:          0,
+			body:           strings.Repeat("a", 1024),
+			expectedStatus: http.StatusOK,
+		},
+		"with_limit_set_to_body_size": {
+			limit:          10,
+			body:           strings.Repeat("a", 10),
+			expectedStatus: http.StatusOK,
+		},
+		"with_body_size_exceeding_the_limit": {
+			limit:          10,
+			body:           strings.Repeat("a", 11),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			oversized:      true,
+		},
+		"with_unknown_body_size_exceeding_the_limit": {
+			limit:          10,
+			body:           strings.Repeat("a", 11),
+			unknownLength:  true,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			middleware := NewMiddleware(handler, tt.limit)
+			oversized := testutil.ToFloat64(metrics.OversizedRequestsCount.WithLabelValues("body"))
+
+			ww := httptest.NewRecorder()
+			rr := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.unknownLength {
+				rr.ContentLength = -1
+			}
+
+			middleware.ServeHTTP(ww, rr)
+
+			res := ww.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tt.expectedStatus, res.StatusCode)
+
+			if tt.oversized {
+				require.Equal(t, oversized+1, testutil.ToFloat64(metrics.OversizedRequestsCount.WithLabelValues("body")))
+				require.Equal(t, "close", res.Header.Get("Connection"))
+			}
+		})
+	}
+}
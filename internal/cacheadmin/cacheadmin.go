@@ -0,0 +1,238 @@
+// Package cacheadmin clears the caches of the daemon, purges the zip archives
+// of a project and reports on the caches, so that the incidents caused by
+// cached state are handled without restarting the daemon.
+//
+// The requests are authorized by a JWT signed with the secret shared with
+// GitLab.
+package cacheadmin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/jwtauth"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/status"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	// PathPrefix of the cache admin endpoints
+	PathPrefix = "/-/cache/"
+
+	clearPath    = PathPrefix + "clear"
+	statsPath    = PathPrefix + "stats"
+	projectsPath = PathPrefix + "projects/"
+
+	audience = "gitlab-pages-cache-admin"
+
+	// maxLifetime bounds the lifetime of the tokens, they are minted for a
+	// single operation
+	maxLifetime = 5 * time.Minute
+)
+
+var (
+	errNoProject = errors.New("the path must be /-/cache/projects/{id}/archives")
+)
+
+// DomainCache is the cache of the domain lookups
+type DomainCache interface {
+	CachedDomains() int
+	ClearDomains() int
+	// ProjectArchives returns the cache keys of the zip archives of a project
+	ProjectArchives(projectID int) []string
+}
+
+// ArchiveCache is the cache of the zip archives
+type ArchiveCache interface {
+	CacheEntries() map[string]int
+	PurgeArchives(keys ...string) int
+	ClearArchives() int
+}
+
+// Stats of a cache, the hits and misses are counted since the start of the
+// daemon
+type Stats struct {
+	Entries  int     `json:"entries"`
+	Hits     float64 `json:"hits"`
+	Misses   float64 `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// Handler serves the cache admin endpoints
+type Handler struct {
+	verifier *jwtauth.Verifier
+	domains  DomainCache
+	archives ArchiveCache
+}
+
+// NewHandler returns a Handler of the domains and archives caches, for the
+// requests authorized by a token signed with secret. domains is nil when the
+// domains are not cached.
+func NewHandler(secret []byte, domains DomainCache, archives ArchiveCache) *Handler {
+	return &Handler{
+		verifier: jwtauth.NewVerifier(secret, audience, maxLifetime),
+		domains:  domains,
+		archives: archives,
+	}
+}
+
+// ServeHTTP serves `POST /-/cache/clear`, `GET /-/cache/stats` and
+// `DELETE /-/cache/projects/{id}/archives`
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	op, method := operation(r.URL.Path)
+	if op == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.authorize(r); err != nil {
+		metrics.CacheAdminRequests.WithLabelValues(op, "unauthorized").Inc()
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gitlab-pages"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch op {
+	case "clear":
+		h.clear(w)
+	case "stats":
+		h.stats(w)
+	case "purge":
+		h.purge(w, r)
+	}
+}
+
+// operation returns the operation of path and the method it accepts
+func operation(path string) (string, string) {
+	switch {
+	case path == clearPath:
+		return "clear", http.MethodPost
+	case path == statsPath:
+		return "stats", http.MethodGet
+	case strings.HasPrefix(path, projectsPath):
+		return "purge", http.MethodDelete
+	}
+
+	return "", ""
+}
+
+func (h *Handler) clear(w http.ResponseWriter) {
+	cleared := map[string]int{"archives": h.archives.ClearArchives()}
+	if h.domains != nil {
+		cleared["domains"] = h.domains.ClearDomains()
+	}
+
+	metrics.CacheAdminRequests.WithLabelValues("clear", "ok").Inc()
+	log.WithFields(log.Fields{
+		"domains":  cleared["domains"],
+		"archives": cleared["archives"],
+	}).Info("cleared the caches")
+
+	writeJSON(w, map[string]map[string]int{"cleared": cleared})
+}
+
+func (h *Handler) stats(w http.ResponseWriter) {
+	caches := map[string]Stats{}
+	for name, cache := range status.Caches() {
+		stats := Stats{
+			Entries: int(cache.Entries),
+			Hits:    cache.Hits,
+			Misses:  cache.Misses,
+		}
+		if requests := cache.Hits + cache.Misses; requests > 0 {
+			stats.HitRatio = cache.Hits / requests
+		}
+
+		caches[name] = stats
+	}
+
+	// the entries are reported from the caches rather than from the metrics,
+	// which drift when the caches are replaced on reconfiguration
+	for name, entries := range h.archives.CacheEntries() {
+		stats := caches[name]
+		stats.Entries = entries
+		caches[name] = stats
+	}
+
+	if h.domains != nil {
+		stats := caches["domains"]
+		stats.Entries = h.domains.CachedDomains()
+		caches["domains"] = stats
+	} else {
+		delete(caches, "domains")
+	}
+
+	metrics.CacheAdminRequests.WithLabelValues("stats", "ok").Inc()
+
+	writeJSON(w, map[string]map[string]Stats{"caches": caches})
+}
+
+func (h *Handler) purge(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseProjectID(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var keys []string
+	if h.domains != nil {
+		keys = h.domains.ProjectArchives(projectID)
+	}
+
+	purged := h.archives.PurgeArchives(keys...)
+	if purged == 0 {
+		metrics.CacheAdminRequests.WithLabelValues("purge", "not_cached").Inc()
+
+		http.Error(w, "the project has no cached archives", http.StatusNotFound)
+		return
+	}
+
+	metrics.CacheAdminRequests.WithLabelValues("purge", "ok").Inc()
+	log.WithFields(log.Fields{
+		"project_id": projectID,
+		"archives":   purged,
+	}).Info("purged the archives of the project")
+
+	writeJSON(w, map[string]int{"purged": purged})
+}
+
+// parseProjectID returns the ID of a `/-/cache/projects/{id}/archives` path
+func parseProjectID(path string) (int, error) {
+	if !strings.HasSuffix(path, "/archives") {
+		return 0, errNoProject
+	}
+
+	projectID, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, projectsPath), "/archives"))
+	if err != nil || projectID <= 0 {
+		return 0, errNoProject
+	}
+
+	return projectID, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	json.NewEncoder(w).Encode(v)
+}
+
+// authorize verifies that the token of the request grants the cache admin
+func (h *Handler) authorize(r *http.Request) error {
+	return h.verifier.Verify(jwtauth.BearerToken(r), &jwt.RegisteredClaims{})
+}
@@ -0,0 +1,253 @@
+package cacheadmin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("secret")
+
+type domainsMock map[string][]string
+
+func (d domainsMock) CachedDomains() int {
+	return len(d)
+}
+
+func (d domainsMock) ClearDomains() int {
+	cleared := len(d)
+	for name := range d {
+		delete(d, name)
+	}
+
+	return cleared
+}
+
+func (d domainsMock) ProjectArchives(projectID int) []string {
+	if projectID != 1 {
+		return nil
+	}
+
+	var keys []string
+	for _, archives := range d {
+		keys = append(keys, archives...)
+	}
+
+	return keys
+}
+
+type archivesMock map[string]bool
+
+func (a archivesMock) CacheEntries() map[string]int {
+	return map[string]int{"archive": len(a), "data-offset": 3, "readlink": 0}
+}
+
+func (a archivesMock) PurgeArchives(keys ...string) int {
+	purged := 0
+	for _, key := range keys {
+		if a[key] {
+			delete(a, key)
+			purged++
+		}
+	}
+
+	return purged
+}
+
+func (a archivesMock) ClearArchives() int {
+	cleared := len(a)
+	for key := range a {
+		delete(a, key)
+	}
+
+	return cleared
+}
+
+func mint(t *testing.T, key []byte, aud string, expiresIn time.Duration) string {
+	t.Helper()
+
+	claims := jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{aud},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	require.NoError(t, err)
+
+	return token
+}
+
+func TestHandler(t *testing.T) {
+	tests := map[string]struct {
+		method           string
+		path             string
+		token            string
+		expectedStatus   int
+		expectedArchives int
+	}{
+		"clear": {
+			method:           http.MethodPost,
+			path:             "/-/cache/clear",
+			token:            mint(t, secret, audience, time.Minute),
+			expectedStatus:   http.StatusOK,
+			expectedArchives: 0,
+		},
+		"stats": {
+			method:           http.MethodGet,
+			path:             "/-/cache/stats",
+			token:            mint(t, secret, audience, time.Minute),
+			expectedStatus:   http.StatusOK,
+			expectedArchives: 3,
+		},
+		"purge": {
+			method:           http.MethodDelete,
+			path:             "/-/cache/projects/1/archives",
+			token:            mint(t, secret, audience, time.Minute),
+			expectedStatus:   http.StatusOK,
+			expectedArchives: 2,
+		},
+		"purge_not_cached": {
+			method:           http.MethodDelete,
+			path:             "/-/cache/projects/2/archives",
+			token:            mint(t, secret, audience, time.Minute),
+			expectedStatus:   http.StatusNotFound,
+			expectedArchives: 3,
+		},
+		"purge_invalid_project": {
+			method:           http.MethodDelete,
+			path:             "/-/cache/projects/group/archives",
+			token:            mint(t, secret, audience, time.Minute),
+			expectedStatus:   http.StatusBadRequest,
+			expectedArchives: 3,
+		},
+		"purge_no_archives_suffix": {
+			method:           http.MethodDelete,
+			path:             "/-/cache/projects/1",
+			token:            mint(t, secret, audience, time.Minute),
+			expectedStatus:   http.StatusBadRequest,
+			expectedArchives: 3,
+		},
+		"unknown_path": {
+			method:           http.MethodGet,
+			path:             "/-/cache/other",
+			token:            mint(t, secret, audience, time.Minute),
+			expectedStatus:   http.StatusNotFound,
+			expectedArchives: 3,
+		},
+		"clear_get": {
+			method:           http.MethodGet,
+			path:             "/-/cache/clear",
+			token:            mint(t, secret, audience, time.Minute),
+			expectedStatus:   http.StatusMethodNotAllowed,
+			expectedArchives: 3,
+		},
+		"no_token": {
+			method:           http.MethodPost,
+			path:             "/-/cache/clear",
+			expectedStatus:   http.StatusUnauthorized,
+			expectedArchives: 3,
+		},
+		"invalid_signature": {
+			method:           http.MethodPost,
+			path:             "/-/cache/clear",
+			token:            mint(t, []byte("other"), audience, time.Minute),
+			expectedStatus:   http.StatusUnauthorized,
+			expectedArchives: 3,
+		},
+		"other_audience": {
+			method:           http.MethodPost,
+			path:             "/-/cache/clear",
+			token:            mint(t, secret, "gitlab-pages-cache", time.Minute),
+			expectedStatus:   http.StatusUnauthorized,
+			expectedArchives: 3,
+		},
+		"expired": {
+			method:           http.MethodPost,
+			path:             "/-/cache/clear",
+			token:            mint(t, secret, audience, -time.Minute),
+			expectedStatus:   http.StatusUnauthorized,
+			expectedArchives: 3,
+		},
+		"long_lived": {
+			method:           http.MethodPost,
+			path:             "/-/cache/clear",
+			token:            mint(t, secret, audience, time.Hour),
+			expectedStatus:   http.StatusUnauthorized,
+			expectedArchives: 3,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			domains := domainsMock{"group.gitlab.io": {"first", "missing"}, "other.gitlab.io": nil}
+			archives := archivesMock{"first": true, "second": true, "third": true}
+			h := NewHandler(secret, domains, archives)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+			require.Len(t, archives, tt.expectedArchives)
+		})
+	}
+}
+
+func TestHandlerResponses(t *testing.T) {
+	serve := func(h *Handler, method, path string) map[string]interface{} {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+mint(t, secret, audience, time.Minute))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+
+		return body
+	}
+
+	t.Run("stats", func(t *testing.T) {
+		h := NewHandler(secret, domainsMock{"group.gitlab.io": nil}, archivesMock{"first": true})
+
+		caches := serve(h, http.MethodGet, "/-/cache/stats")["caches"].(map[string]interface{})
+		require.Equal(t, 1.0, caches["domains"].(map[string]interface{})["entries"])
+		require.Equal(t, 1.0, caches["archive"].(map[string]interface{})["entries"])
+		require.Equal(t, 3.0, caches["data-offset"].(map[string]interface{})["entries"])
+		require.Contains(t, caches["archive"], "hit_ratio")
+	})
+
+	t.Run("stats_without_domains", func(t *testing.T) {
+		h := NewHandler(secret, nil, archivesMock{})
+
+		caches := serve(h, http.MethodGet, "/-/cache/stats")["caches"].(map[string]interface{})
+		require.NotContains(t, caches, "domains")
+		require.Contains(t, caches, "readlink")
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		domains := domainsMock{"group.gitlab.io": nil, "other.gitlab.io": nil}
+		h := NewHandler(secret, domains, archivesMock{"first": true})
+
+		cleared := serve(h, http.MethodPost, "/-/cache/clear")["cleared"]
+		require.Equal(t, map[string]interface{}{"domains": 2.0, "archives": 1.0}, cleared)
+		require.Empty(t, domains)
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		h := NewHandler(secret, domainsMock{"group.gitlab.io": {"first", "second"}}, archivesMock{"first": true, "second": true, "third": true})
+
+		require.Equal(t, 2.0, serve(h, http.MethodDelete, "/-/cache/projects/1/archives")["purged"])
+	})
+}
@@ -0,0 +1,125 @@
+// Package compress compresses the responses of the deployments which do not
+// precompress their files with gzip, while they are streamed to the client.
+// The files served precompressed, or with another Content-Encoding, are
+// served as they are.
+package compress
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/responsewriter"
+)
+
+// compressibleTypes are the media types, besides text/*, +json and +xml,
+// worth compressing
+var compressibleTypes = map[string]bool{
+	"application/javascript": true,
+	"application/json":       true,
+	"application/wasm":       true,
+	"application/xml":        true,
+	"image/bmp":              true,
+	"image/svg+xml":          true,
+	"image/x-icon":           true,
+	"font/otf":               true,
+	"font/ttf":               true,
+}
+
+// NewMiddleware returns middleware compressing the responses of handler
+// with gzip, when the client accepts it and they are compressible and at
+// least cfg.MinSize bytes long. It is disabled unless cfg.Enabled.
+func NewMiddleware(handler http.Handler, cfg *config.Compression) http.Handler {
+	if !cfg.Enabled {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// byte ranges apply to the identity encoding, the compressed
+		// length of a response is not known before it is sent
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressingWriter{
+			Wrapper:  responsewriter.Wrapper{ResponseWriter: w},
+			minSize:  cfg.MinSize,
+			accepted: acceptsGzip(r.Header),
+		}
+		defer cw.finish()
+
+		handler.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip returns true if the Accept-Encoding of header accepts gzip
+func acceptsGzip(header http.Header) bool {
+	accepted := false
+
+	for _, value := range header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			name, params := coding, ""
+			if i := strings.Index(coding, ";"); i >= 0 {
+				name, params = coding[:i], coding[i+1:]
+			}
+
+			name = strings.TrimSpace(name)
+			q := qValue(params)
+
+			switch {
+			case strings.EqualFold(name, "gzip"):
+				// an explicit gzip takes precedence over *
+				return q > 0
+			case name == "*":
+				accepted = q > 0
+			}
+		}
+	}
+
+	return accepted
+}
+
+// qValue returns the quality value of the parameters of a coding, 1 when
+// it is not set
+func qValue(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		param = strings.TrimSpace(param)
+		if !strings.HasPrefix(param, "q=") {
+			continue
+		}
+
+		q, err := strconv.ParseFloat(param[len("q="):], 64)
+		if err != nil {
+			return 0
+		}
+
+		return q
+	}
+
+	return 1
+}
+
+// compressible returns true if the response with header is unencoded,
+// allows transformations and has a compressible media type
+func compressible(header http.Header) bool {
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return false
+	}
+
+	if strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		compressibleTypes[mediaType]
+}
@@ -0,0 +1,217 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const minSize = 64
+
+func TestNewMiddleware(t *testing.T) {
+	long := strings.Repeat("<p>compressible</p>", 16)
+	short := "<p>short</p>"
+
+	tests := map[string]struct {
+		acceptEncoding   string
+		rangeHeader      string
+		status           int
+		contentType      string
+		encoding         string
+		cacheControl     string
+		body             string
+		withoutLength    bool
+		chunkSize        int
+		expectCompressed bool
+		expectVary       bool
+	}{
+		"compressed": {
+			acceptEncoding:   "gzip, deflate, br",
+			body:             long,
+			expectCompressed: true,
+			expectVary:       true,
+		},
+		"compressed_without_length": {
+			acceptEncoding:   "gzip",
+			body:             long,
+			withoutLength:    true,
+			chunkSize:        10,
+			expectCompressed: true,
+			expectVary:       true,
+		},
+		"short": {
+			acceptEncoding: "gzip",
+			body:           short,
+			expectVary:     true,
+		},
+		"short_without_length": {
+			acceptEncoding: "gzip",
+			body:           short,
+			withoutLength:  true,
+			chunkSize:      3,
+			expectVary:     true,
+		},
+		"not_accepted": {
+			acceptEncoding: "br",
+			body:           long,
+			expectVary:     true,
+		},
+		"gzip_refused": {
+			acceptEncoding: "*, gzip;q=0",
+			body:           long,
+			expectVary:     true,
+		},
+		"not_compressible": {
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			body:           long,
+		},
+		"precompressed": {
+			acceptEncoding: "gzip",
+			encoding:       "br",
+			body:           long,
+		},
+		"no_transform": {
+			acceptEncoding: "gzip",
+			cacheControl:   "public, no-transform",
+			body:           long,
+		},
+		"not_found": {
+			acceptEncoding: "gzip",
+			status:         http.StatusNotFound,
+			body:           long,
+		},
+		"range": {
+			acceptEncoding: "gzip",
+			rangeHeader:    "bytes=0-9",
+			body:           long,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType := tt.contentType
+				if contentType == "" {
+					contentType = "text/html; charset=utf-8"
+				}
+
+				w.Header().Set("Content-Type", contentType)
+				w.Header().Set("ETag", `"digest"`)
+				w.Header().Set("Accept-Ranges", "bytes")
+				if !tt.withoutLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				}
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+
+				chunkSize := tt.chunkSize
+				if chunkSize == 0 {
+					chunkSize = len(tt.body)
+				}
+
+				for body := tt.body; len(body) > 0; {
+					n := chunkSize
+					if n > len(body) {
+						n = len(body)
+					}
+
+					w.Write([]byte(body[:n]))
+					body = body[n:]
+				}
+			})
+
+			middleware := NewMiddleware(handler, &config.Compression{Enabled: true, MinSize: minSize})
+
+			r := httptest.NewRequest(http.MethodGet, "http://group.example.com/", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			if tt.rangeHeader != "" {
+				r.Header.Set("Range", tt.rangeHeader)
+			}
+
+			before := testutil.ToFloat64(metrics.CompressedResponses)
+
+			w := httptest.NewRecorder()
+			middleware.ServeHTTP(w, r)
+
+			if tt.expectVary {
+				require.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			} else {
+				require.Empty(t, w.Header().Get("Vary"))
+			}
+
+			if !tt.expectCompressed {
+				require.Equal(t, tt.body, w.Body.String())
+				require.Equal(t, `"digest"`, w.Header().Get("ETag"))
+				require.Equal(t, before, testutil.ToFloat64(metrics.CompressedResponses))
+				return
+			}
+
+			require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+			require.Equal(t, `W/"digest"`, w.Header().Get("ETag"))
+			require.Empty(t, w.Header().Get("Content-Length"))
+			require.Empty(t, w.Header().Get("Accept-Ranges"))
+			require.Less(t, w.Body.Len(), len(tt.body))
+			require.Equal(t, before+1, testutil.ToFloat64(metrics.CompressedResponses))
+
+			gz, err := gzip.NewReader(w.Body)
+			require.NoError(t, err)
+
+			body, err := io.ReadAll(gz)
+			require.NoError(t, err)
+			require.Equal(t, tt.body, string(body))
+		})
+	}
+}
+
+func TestNewMiddlewareDisabled(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	middleware := NewMiddleware(handler, &config.Compression{MinSize: minSize})
+	require.IsType(t, handler, middleware)
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                      false,
+		"gzip":                  true,
+		"GZIP":                  true,
+		"br, gzip;q=0.5":        true,
+		"gzip;q=0":              false,
+		"gzip; q=0.0":           false,
+		"*":                     true,
+		"*;q=0":                 false,
+		"*, gzip;q=0":           false,
+		"identity":              false,
+		"deflate, br;q=1.0, *":  true,
+		"gzip;q=invalid, br":    false,
+		"compress, x-gzip-like": false,
+	}
+
+	for acceptEncoding, expected := range tests {
+		t.Run(acceptEncoding, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Accept-Encoding", acceptEncoding)
+
+			require.Equal(t, expected, acceptsGzip(header))
+		})
+	}
+}
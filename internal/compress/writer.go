@@ -0,0 +1,193 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/responsewriter"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// compressingWriter compresses the body of successful, compressible
+// responses. The responses without a Content-Length are buffered until they
+// reach minSize, the shorter ones are sent uncompressed.
+type compressingWriter struct {
+	responsewriter.Wrapper
+	minSize  int64
+	accepted bool
+
+	wroteHeader bool
+	status      int
+	buffering   bool
+	buf         []byte
+
+	gz         *gzip.Writer
+	compressed countingWriter
+	plain      int64
+}
+
+func (cw *compressingWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	cw.wroteHeader = true
+	cw.status = status
+
+	header := cw.Header()
+	if status != http.StatusOK || !compressible(header) {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	// the response depends on the Accept-Encoding even when it is not
+	// compressed, for the caches in front of Pages
+	header.Add("Vary", "Accept-Encoding")
+
+	if !cw.accepted {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if length := header.Get("Content-Length"); length != "" {
+		if n, err := strconv.ParseInt(length, 10, 64); err == nil && n < cw.minSize {
+			cw.ResponseWriter.WriteHeader(status)
+			return
+		}
+
+		cw.start()
+		return
+	}
+
+	cw.buffering = true
+}
+
+func (cw *compressingWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.buffering {
+		cw.buf = append(cw.buf, p...)
+		if int64(len(cw.buf)) < cw.minSize {
+			return len(p), nil
+		}
+
+		cw.buffering = false
+		cw.start()
+
+		buf := cw.buf
+		cw.buf = nil
+
+		if _, err := cw.gzWrite(buf); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	if cw.gz != nil {
+		return cw.gzWrite(p)
+	}
+
+	return cw.ResponseWriter.Write(p)
+}
+
+// start sends the header of the compressed response
+func (cw *compressingWriter) start() {
+	header := cw.Header()
+
+	header.Del("Content-Length")
+	header.Del("Accept-Ranges")
+	header.Set("Content-Encoding", "gzip")
+
+	// the compressed representation is not byte for byte the one of the
+	// strong ETag
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+
+	cw.compressed.w = cw.ResponseWriter
+	cw.gz = gzipWriters.Get().(*gzip.Writer)
+	cw.gz.Reset(&cw.compressed)
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressingWriter) gzWrite(p []byte) (int, error) {
+	n, err := cw.gz.Write(p)
+	cw.plain += int64(n)
+
+	return n, err
+}
+
+// sendBuffered sends the buffered response uncompressed
+func (cw *compressingWriter) sendBuffered() {
+	cw.buffering = false
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) > 0 {
+		cw.ResponseWriter.Write(cw.buf) // nolint:errcheck // the client went away
+		cw.buf = nil
+	}
+}
+
+// Flush sends the bytes written so far. A buffered response is then sent
+// uncompressed.
+func (cw *compressingWriter) Flush() {
+	if cw.buffering {
+		cw.sendBuffered()
+	}
+
+	if cw.gz != nil {
+		cw.gz.Flush() // nolint:errcheck // the client went away
+	}
+
+	cw.Wrapper.Flush()
+}
+
+// finish sends a response shorter than minSize, or ends the compressed
+// stream
+func (cw *compressingWriter) finish() {
+	if cw.buffering {
+		cw.sendBuffered()
+		return
+	}
+
+	if cw.gz == nil {
+		return
+	}
+
+	cw.gz.Close() // nolint:errcheck // the client went away
+	cw.gz.Reset(io.Discard)
+	gzipWriters.Put(cw.gz)
+	cw.gz = nil
+
+	metrics.CompressedResponses.Inc()
+	if saved := cw.plain - cw.compressed.n; saved > 0 {
+		metrics.CompressionSavedBytes.Add(float64(saved))
+	}
+}
@@ -3,7 +3,11 @@ package config
 import (
 	"encoding/base64"
 	"fmt"
+	"mime"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,6 +15,7 @@ import (
 	"gitlab.com/gitlab-org/labkit/log"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config/tls"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/deprecation"
 )
 
 // Config stores all the config options relevant to GitLab Pages.
@@ -25,12 +30,29 @@ type Config struct {
 	Sentry          Sentry
 	TLS             TLS
 	Zip             ZipServing
+	Disk            DiskServing
+	HTMLCache       HTMLCache
+	Charset         Charset
+	AssetCache      AssetCache
+	Proxy           Proxy
+	Mirror          Mirror
+	Tracing         Tracing
+	Tarpit          Tarpit
+	HTMLInjection   HTMLInjection
+	AssetManifest   AssetManifest
+	Compression     Compression
+	CacheControl    CacheControl
+	MIMETypes       MIMETypes
+	Redirects       Redirects
 
 	// Fields used to share information between files. These are not directly
 	// set by command line flags, but rather populated based on info from them.
 	// ListenMetrics points to a file descriptor of a socket, whose address is
 	// specified by `Config.General.MetricsAddress`.
 	ListenMetrics uintptr
+	// ListenWeightAgent points to a file descriptor of a socket, whose address
+	// is specified by `Config.General.WeightAgentAddress`.
+	ListenWeightAgent uintptr
 
 	// These fields contain the raw strings passed for listen-http,
 	// listen-https, listen-proxy and listen-https-proxyv2 settings. It is used
@@ -42,26 +64,67 @@ type Config struct {
 	ListenHTTPSProxyv2Strings MultiStringFlag
 }
 
+// defaultPagesDomain is served when no -pages-domain is set
+const defaultPagesDomain = "gitlab-example.com"
+
 // General groups settings that are general to GitLab Pages and can not
 // be categorized under other head.
 type General struct {
-	Domain          string
+	// Domains are the root domains the namespaces are served under, e.g.
+	// group.example.io for example.io
+	Domains         []string
 	MaxConns        int
 	MaxURILength    int
+	MaxHeaderBytes  int
+	MaxBodyBytes    int64
+	AllowedMethods  []string
 	MetricsAddress  string
+	EnablePprof     bool
 	RedirectHTTP    bool
 	RootCertificate []byte
 	RootDir         string
 	RootKey         []byte
 	StatusPath      string
+	StatusJSON      bool
+
+	// RootCertificatePath and RootKeyPath are read again when the root
+	// certificate is reloaded, from the pages root, so they are absolute
+	RootCertificatePath string
+	RootKeyPath         string
+
+	// UnpublishedPage is served for deployments outside of their publication window
+	UnpublishedPage []byte
+	// ErrorPages is the directory or zip archive of custom error page templates
+	ErrorPages string
 
 	DisableCrossOriginRequests bool
 	InsecureCiphers            bool
 	PropagateCorrelationID     bool
 
+	// RequestIDHeader is the response header echoing the correlation ID of
+	// requests, empty to disable it
+	RequestIDHeader string
+
+	// DeprecationWarningInterval is the interval between two warnings about
+	// the same deprecated feature
+	DeprecationWarningInterval time.Duration
+
+	// WeightAgentAddress is the address of the HAProxy agent-check reporting
+	// the weight of the node, which is updated every WeightInterval
+	WeightAgentAddress string
+	WeightInterval     time.Duration
+
+	// ReadOnly serves only the cached domains and archives, and the local
+	// disk, without new API lookups or archive fetches
+	ReadOnly bool
+
 	ShowVersion bool
 
 	CustomHeaders []string
+
+	// SecurityHeaders is the preset of security headers set on every
+	// response, the -header flag overrides its headers
+	SecurityHeaders string
 }
 
 // RateLimit config struct
@@ -70,23 +133,232 @@ type RateLimit struct {
 	SourceIPBurst          int
 	DomainLimitPerSecond   float64
 	DomainBurst            int
+	AuthLimitPerSecond     float64
+	AuthBurst              int
+
+	// DryRun logs and counts the requests above the limits without rejecting them
+	DryRun bool
+
+	// SourceIPAllowlist are the CIDRs or IPs exempt from the source IP limit,
+	// and SourceIPDenylist the ones rejected, see Networks
+	SourceIPAllowlist []string
+	SourceIPDenylist  []string
+
+	// PathRules are the raw `/pattern=limit:burst` limits of the paths of
+	// each domain, see PathLimits
+	PathRules []string
+}
+
+// RateLimitPath is the limit of the requests to the paths of a domain which
+// match Pattern, where * matches any sequence of characters
+type RateLimitPath struct {
+	Pattern        string
+	LimitPerSecond float64
+	Burst          int
+}
+
+// PathLimits returns the limits of PathRules, in order
+func (rl *RateLimit) PathLimits() ([]RateLimitPath, error) {
+	limits := make([]RateLimitPath, 0, len(rl.PathRules))
+
+	for _, entry := range rl.PathRules {
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrRateLimitPath, entry)
+		}
+
+		pattern := strings.TrimSpace(entry[:i])
+		j := strings.Index(entry[i+1:], ":")
+		if !strings.HasPrefix(pattern, "/") || j < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrRateLimitPath, entry)
+		}
+
+		limit, err := strconv.ParseFloat(strings.TrimSpace(entry[i+1:i+1+j]), 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrRateLimitPath, entry)
+		}
+
+		burst, err := strconv.Atoi(strings.TrimSpace(entry[i+2+j:]))
+		if err != nil || burst <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrRateLimitPath, entry)
+		}
+
+		limits = append(limits, RateLimitPath{Pattern: pattern, LimitPerSecond: limit, Burst: burst})
+	}
+
+	return limits, nil
+}
+
+// readRateLimitPathFile returns the rules of a file with one
+// `/pattern=limit:burst` rule per line, ignoring the empty lines and the
+// comments starting with #
+func readRateLimitPathFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rules = append(rules, line)
+	}
+
+	return rules, nil
+}
+
+// Networks returns the networks of the source IP allowlist and denylist
+func (rl *RateLimit) Networks() (allowed, denied []*net.IPNet, err error) {
+	if allowed, err = parseNetworks(rl.SourceIPAllowlist, ErrRateLimitSourceIPAllow); err != nil {
+		return nil, nil, err
+	}
+
+	if denied, err = parseNetworks(rl.SourceIPDenylist, ErrRateLimitSourceIPDeny); err != nil {
+		return nil, nil, err
+	}
+
+	return allowed, denied, nil
+}
+
+// parseNetworks parses CIDRs, and IPs as networks of a single address
+func parseNetworks(entries []string, errFormat error) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", errFormat, entry)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// Mirror groups settings related to mirroring read traffic to a secondary
+// Pages deployment
+type Mirror struct {
+	URL              string
+	SamplePercentage float64
+	Timeout          time.Duration
+	MaxInFlight      int
+}
+
+// Tracing groups settings related to exporting OpenTelemetry traces
+type Tracing struct {
+	// OTLPEndpoint is the URL of the OTLP/HTTP collector, tracing is disabled
+	// when empty
+	OTLPEndpoint string
+	SampleRatio  float64
 }
 
 // ArtifactsServer groups settings related to configuring Artifacts
 // server
 type ArtifactsServer struct {
-	URL            string
+	// URLs are requested in round-robin order, failing over to the next
+	// one on connection errors and 5xx responses
+	URLs           []string
 	TimeoutSeconds int
+	// CacheTTL keeps up to CacheSize successful responses in memory, 0
+	// disables the cache
+	CacheTTL  time.Duration
+	CacheSize int64
 }
 
+// Authentication providers
+const (
+	AuthProviderGitLab = "gitlab"
+	AuthProviderOIDC   = "oidc"
+)
+
+// Transports of the domain lookups
+const (
+	GitLabAPITransportHTTP = "http"
+	GitLabAPITransportGRPC = "grpc"
+)
+
+// Targets of the logs, besides stderr and the log file
+const (
+	LogTargetSyslog   = "syslog"
+	LogTargetJournald = "journald"
+)
+
+// Presets of the security headers
+const (
+	SecurityHeadersOff    = "off"
+	SecurityHeadersBasic  = "basic"
+	SecurityHeadersStrict = "strict"
+)
+
+// Authentication session stores
+const (
+	AuthSessionStoreCookie = "cookie"
+	AuthSessionStoreRedis  = "redis"
+)
+
 // Auth groups settings related to configuring Authentication with
-// GitLab
+// GitLab or an external OpenID Connect provider
 type Auth struct {
 	Secret       string
 	ClientID     string
 	ClientSecret string
 	RedirectURI  string
 	Scope        string
+	Provider     string
+
+	// OIDCNamespaces are the raw `claim-value=namespace` mappings, see
+	// OIDCNamespaceMapping
+	OIDCIssuer     string
+	OIDCClaim      string
+	OIDCNamespaces []string
+
+	ShareLinks           bool
+	ShareLinkMaxLifetime time.Duration
+
+	// SessionStore keeps the sessions in cookies, or in Redis at
+	// RedisAddress so that they can be revoked server side
+	SessionStore  string
+	RedisAddress  string
+	RedisPassword string
+
+	// SessionMaxAge is how long the access tokens are refreshed after
+	// signing in, 0 never refreshes them
+	SessionMaxAge time.Duration
+}
+
+// OIDCNamespaceMapping returns the namespaces granted by each value of the
+// OIDC claim
+func (a *Auth) OIDCNamespaceMapping() (map[string][]string, error) {
+	mapping := make(map[string][]string, len(a.OIDCNamespaces))
+
+	for _, entry := range a.OIDCNamespaces {
+		// namespaces never contain "=", claim values such as LDAP DNs might
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("%w: %q", ErrAuthOIDCNamespace, entry)
+		}
+
+		mapping[entry[:i]] = append(mapping[entry[:i]], entry[i+1:])
+	}
+
+	return mapping, nil
 }
 
 // Cache configuration for GitLab API
@@ -97,6 +369,21 @@ type Cache struct {
 	RetrievalTimeout     time.Duration
 	MaxRetrievalInterval time.Duration
 	MaxRetrievalRetries  int
+
+	// RemovedDomainGracePeriod is how long the last known lookup of a domain
+	// is served after GitLab reported the domain as removed, 0 disables it
+	RemovedDomainGracePeriod time.Duration
+
+	// LookupBatchSize is the maximum number of domains looked up with one
+	// request, sent LookupBatchWindow after the first one, 0 disables it
+	LookupBatchSize   int
+	LookupBatchWindow time.Duration
+
+	// MaxEntries bounds the number of cached domains, 0 means unlimited
+	MaxEntries int
+	// MaxStale is how long an expired domain is served while the GitLab API
+	// fails to refresh it, 0 disables it
+	MaxStale time.Duration
 }
 
 // GitLab groups settings related to configuring GitLab client used to
@@ -107,23 +394,95 @@ type GitLab struct {
 	APISecretKey       []byte
 	ClientHTTPTimeout  time.Duration
 	JWTTokenExpiration time.Duration
+	APIVersion         int
+	MaxLookupSize      int64
+	MaxLookupPaths     int
 	Cache              Cache
-	EnableDisk         bool
+	// EnableDisk is false when nothing is ever read from the pages-root
+	// directory
+	EnableDisk bool
+	// DeploymentExport serves the archives of the deployments to the
+	// holders of a token signed with the APISecretKey
+	DeploymentExport bool
+
+	// APITransport is the transport of the domain lookups, GRPCServer is
+	// the address of the gRPC server of GitLab for the grpc transport
+	APITransport string
+	GRPCServer   string
 }
 
 // Listeners groups settings related to configuring various listeners
-// (HTTP, HTTPS, Proxy, HTTPSProxyv2)
+// (HTTP, HTTPS, Proxy, HTTPSProxyv2, HTTPProxyv2)
 type Listeners struct {
 	HTTP         []uintptr
 	HTTPS        []uintptr
 	Proxy        []uintptr
 	HTTPSProxyv2 []uintptr
+	// HTTPProxyv2 are the HTTP listeners with the proxyprotocol option, the
+	// HTTPS ones are HTTPSProxyv2 listeners
+	HTTPProxyv2 []uintptr
 }
 
 // Log groups settings related to configuring logging
 type Log struct {
-	Format  string
-	Verbose bool
+	Format             string
+	Verbose            bool
+	OutboundPercentage float64
+
+	// File is the path of the log file, the logs are written to stderr when
+	// empty. It is rotated when it grows over FileMaxSize bytes or when it
+	// was opened longer than FileMaxAge ago, and FileMaxBackups rotated files
+	// are kept.
+	File           string
+	FileMaxSize    int64
+	FileMaxAge     time.Duration
+	FileMaxBackups int
+
+	// Target sends the logs to syslog or journald instead of stderr or the
+	// log file when set
+	Target        string
+	SyslogAddress string
+
+	// FieldMap are the raw `field=name` renames of the log fields, and
+	// StaticFields the raw `field=value` fields added to every log entry,
+	// see Fields
+	FieldMap     []string
+	StaticFields []string
+}
+
+// Fields returns the new name of each renamed log field, and the fields
+// added to every log entry
+func (l *Log) Fields() (fieldMap map[string]string, staticFields map[string]string, err error) {
+	fieldMap, err = parseLogFields(l.FieldMap, ErrLogFieldMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	staticFields, err = parseLogFields(l.StaticFields, ErrLogStaticField)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return fieldMap, staticFields, nil
+}
+
+func parseLogFields(entries []string, errFormat error) (map[string]string, error) {
+	fields := make(map[string]string, len(entries))
+
+	for _, entry := range entries {
+		field, value := entry, ""
+		if i := strings.Index(entry, "="); i >= 0 {
+			field, value = entry[:i], entry[i+1:]
+		}
+
+		if field == "" || value == "" {
+			return nil, fmt.Errorf("%w: %q", errFormat, entry)
+		}
+
+		fields[field] = value
+	}
+
+	return fields, nil
 }
 
 // Sentry groups settings related to configuring Sentry
@@ -136,6 +495,8 @@ type Sentry struct {
 type TLS struct {
 	MinVersion uint16
 	MaxVersion uint16
+	// OCSPStapling staples the OCSP responses of the served certificates
+	OCSPStapling bool
 }
 
 // ZipServing groups settings to be used by the zip VFS opening and caching
@@ -143,8 +504,213 @@ type ZipServing struct {
 	ExpirationInterval time.Duration
 	CleanupInterval    time.Duration
 	RefreshInterval    time.Duration
+	MaxArchives        int
 	OpenTimeout        time.Duration
 	AllowedPaths       []string
+	Mmap               bool
+	VerifySHA256       bool
+	MaxFiles           int
+	MaxPathDepth       int
+	// PrefetchConcurrency chunks of PrefetchChunkSize bytes are fetched
+	// concurrently while a file is streamed, 0 disables prefetching
+	PrefetchConcurrency int
+	PrefetchChunkSize   int64
+	// RangeCacheDir caches the ranges of at most RangeCacheMaxRangeSize bytes
+	// read from the object storage, up to RangeCacheSize bytes. Empty
+	// disables the cache.
+	RangeCacheDir          string
+	RangeCacheSize         int64
+	RangeCacheMaxRangeSize int64
+	// RangeFallbackSize is the size of the largest archive downloaded in
+	// full from an object storage which does not support range requests, 0
+	// disables the fallback
+	RangeFallbackSize int64
+	// ColdWorkers and ColdQueue bound the archives being opened, HotWorkers
+	// and HotQueue the files being read from opened archives. Requests are
+	// rejected once the queue is full, 0 workers means unlimited.
+	ColdWorkers int
+	ColdQueue   int
+	HotWorkers  int
+	HotQueue    int
+	// EgressBudget is the number of bytes read from the object storage per
+	// EgressBudgetWindow, above which archives are no longer opened. 0 means
+	// unlimited.
+	EgressBudget       int64
+	EgressBudgetWindow time.Duration
+}
+
+// DiskServing groups settings to be used by the local VFS, mostly useful when
+// the pages root is mounted over a network filesystem such as NFS or SMB
+type DiskServing struct {
+	AttributeCacheTTL  time.Duration
+	AttributeCacheSize int64
+	FileHandleCacheTTL time.Duration
+
+	// IsolationHeaders sets the cross-origin isolation headers of the
+	// `_headers` files of deployments
+	IsolationHeaders bool
+}
+
+// HTMLCache groups settings of the in-memory cache of HTML documents, which
+// are kept per deployment SHA so they never outlive a new deployment
+type HTMLCache struct {
+	TTL         time.Duration
+	Size        int64
+	MaxFileSize int64
+}
+
+// MIMETypes groups the media types of the file extensions which extend or
+// override the MIME database of the system
+type MIMETypes struct {
+	// Extensions are the raw `.ext=media/type` mappings, see Mapping
+	Extensions []string
+}
+
+// Mapping returns the media types by lowercased file extension
+func (m *MIMETypes) Mapping() (map[string]string, error) {
+	mapping := make(map[string]string, len(m.Extensions))
+
+	for _, entry := range m.Extensions {
+		i := strings.Index(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrMIMEType, entry)
+		}
+
+		ext := strings.ToLower(strings.TrimSpace(entry[:i]))
+		mediaType := strings.TrimSpace(entry[i+1:])
+
+		if !strings.HasPrefix(ext, ".") || len(ext) == 1 || strings.ContainsAny(ext, "/\\") {
+			return nil, fmt.Errorf("%w: %q", ErrMIMEType, entry)
+		}
+
+		if _, _, err := mime.ParseMediaType(mediaType); err != nil || !strings.Contains(mediaType, "/") {
+			return nil, fmt.Errorf("%w: %q", ErrMIMEType, entry)
+		}
+
+		mapping[ext] = mediaType
+	}
+
+	return mapping, nil
+}
+
+// Charset groups settings of the charset stated in the Content-Type of the
+// text/html and text/plain files served
+type Charset struct {
+	// Default is the charset of the files which do not declare one, empty
+	// leaves the charset out
+	Default string
+	// Sniff detects the charset from the start of the files
+	Sniff bool
+}
+
+// Proxy groups settings of the proxy serving type, which forwards the
+// requests of a lookup path to an upstream such as a preview backend
+type Proxy struct {
+	AllowedHosts []string
+	IdleTimeout  time.Duration
+	MaxBytes     int64
+
+	// RedirectsAllowedHosts are the upstream hosts the rewrites of
+	// `_redirects` to absolute URLs may proxy to
+	RedirectsAllowedHosts []string
+}
+
+// Redirects groups settings of the rules of `_redirects` files
+type Redirects struct {
+	MaxRuleCount    int
+	MaxPathSegments int
+
+	// PreserveQuery keeps the query of requests on the redirects to URLs
+	// without a query
+	PreserveQuery bool
+
+	// NamespaceFallback applies the rules of the namespace project to the
+	// requests the other projects of its domain do not serve
+	NamespaceFallback bool
+}
+
+// Tarpit groups settings of the slow responses served to scanners and to
+// requests above the rate limits
+type Tarpit struct {
+	Delay         time.Duration
+	MaxConcurrent int
+	PathSuffixes  []string
+}
+
+// Positions of the HTML injection snippet
+const (
+	HTMLInjectHead = "head"
+	HTMLInjectBody = "body"
+)
+
+// HTMLInjection groups settings of the snippet inserted into the HTML
+// documents served by all domains but the excluded ones
+type HTMLInjection struct {
+	Snippet         []byte
+	Position        string
+	ExcludedDomains []string
+}
+
+// Compression groups settings of the gzip compression of the responses of
+// the deployments which do not precompress their files
+type Compression struct {
+	Enabled bool
+	MinSize int64
+}
+
+// CacheControl groups the Cache-Control policies of the files of the
+// projects without access control
+type CacheControl struct {
+	// Default is the policy of the files without a policy for their type,
+	// no Cache-Control is sent when it is empty
+	Default string
+
+	// Types are the raw `media/type=policy` overrides, see TypePolicies
+	Types []string
+}
+
+// TypePolicies returns the policies by media type, or by `type/*` for all
+// the subtypes of a type
+func (c *CacheControl) TypePolicies() (map[string]string, error) {
+	policies := make(map[string]string, len(c.Types))
+
+	for _, entry := range c.Types {
+		// policies may contain "=", media types never do
+		i := strings.Index(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrCacheControlType, entry)
+		}
+
+		mediaType := strings.ToLower(strings.TrimSpace(entry[:i]))
+		if !strings.Contains(mediaType, "/") {
+			return nil, fmt.Errorf("%w: %q", ErrCacheControlType, entry)
+		}
+
+		policies[mediaType] = strings.TrimSpace(entry[i+1:])
+	}
+
+	return policies, nil
+}
+
+// AssetCache groups settings of the in-memory cache of static assets, whose
+// content is stored once per SHA-256 digest and shared across domains
+type AssetCache struct {
+	TTL         time.Duration
+	Size        int64
+	MaxFileSize int64
+}
+
+// Modes of serving the logical paths of asset manifests
+const (
+	AssetManifestDisabled = "disabled"
+	AssetManifestRewrite  = "rewrite"
+	AssetManifestRedirect = "redirect"
+)
+
+// AssetManifest groups settings of the asset manifests of deployments,
+// which map logical paths to fingerprinted files served as immutable
+type AssetManifest struct {
+	Mode string
 }
 
 func internalGitlabServerFromFlags() string {
@@ -179,20 +745,52 @@ func setGitLabAPISecretKey(secretFile string, config *Config) error {
 	return nil
 }
 
+// loadPagesDomains returns the lowercased -pages-domain values, or the
+// default domain when none is set
+func loadPagesDomains() []string {
+	var domains []string
+
+	for _, domain := range pagesDomains.Split() {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+
+	if len(domains) == 0 {
+		return []string{defaultPagesDomain}
+	}
+
+	return domains
+}
+
 func loadConfig() (*Config, error) {
 	config := &Config{
 		General: General{
-			Domain:                     strings.ToLower(*pagesDomain),
+			Domains:                    loadPagesDomains(),
 			MaxConns:                   *maxConns,
 			MaxURILength:               *maxURILength,
+			MaxHeaderBytes:             *maxHeaderBytes,
+			MaxBodyBytes:               *maxBodyBytes,
+			AllowedMethods:             allowedMethods.Split(),
 			MetricsAddress:             *metricsAddress,
+			EnablePprof:                *enablePprof,
 			RedirectHTTP:               *redirectHTTP,
 			RootDir:                    *pagesRoot,
 			StatusPath:                 *pagesStatus,
+			StatusJSON:                 *pagesStatusJSON,
+			RootCertificatePath:        *pagesRootCert,
+			RootKeyPath:                *pagesRootKey,
+			ErrorPages:                 *errorPages,
 			DisableCrossOriginRequests: *disableCrossOriginRequests,
 			InsecureCiphers:            *insecureCiphers,
 			PropagateCorrelationID:     *propagateCorrelationID,
+			RequestIDHeader:            *requestIDHeader,
+			DeprecationWarningInterval: *deprecationWarningInterval,
+			WeightAgentAddress:         *weightAgentAddress,
+			WeightInterval:             *weightInterval,
+			ReadOnly:                   *readOnly,
 			CustomHeaders:              header.Split(),
+			SecurityHeaders:            *securityHeaders,
 			ShowVersion:                *showVersion,
 		},
 		RateLimit: RateLimit{
@@ -200,11 +798,23 @@ func loadConfig() (*Config, error) {
 			SourceIPBurst:          *rateLimitSourceIPBurst,
 			DomainLimitPerSecond:   *rateLimitDomain,
 			DomainBurst:            *rateLimitDomainBurst,
+			AuthLimitPerSecond:     *rateLimitAuth,
+			AuthBurst:              *rateLimitAuthBurst,
+			DryRun:                 *rateLimitDryRun,
+			SourceIPAllowlist:      rateLimitSourceIPAllow.Split(),
+			SourceIPDenylist:       rateLimitSourceIPDeny.Split(),
+			PathRules:              rateLimitPaths.Split(),
 		},
 		GitLab: GitLab{
 			ClientHTTPTimeout:  *gitlabClientHTTPTimeout,
 			JWTTokenExpiration: *gitlabClientJWTExpiry,
+			APIVersion:         *gitlabAPIVersion,
+			MaxLookupSize:      *gitlabLookupMaxSize,
+			MaxLookupPaths:     *gitlabLookupMaxPaths,
 			EnableDisk:         *enableDisk,
+			DeploymentExport:   *deploymentExport,
+			APITransport:       *gitlabAPITransport,
+			GRPCServer:         *gitlabGRPCServer,
 			Cache: Cache{
 				CacheExpiry:          *gitlabCacheExpiry,
 				CacheCleanupInterval: *gitlabCacheCleanup,
@@ -212,11 +822,21 @@ func loadConfig() (*Config, error) {
 				RetrievalTimeout:     *gitlabRetrievalTimeout,
 				MaxRetrievalInterval: *gitlabRetrievalInterval,
 				MaxRetrievalRetries:  *gitlabRetrievalRetries,
+
+				RemovedDomainGracePeriod: *removedDomainGracePeriod,
+
+				LookupBatchSize:   *gitlabLookupBatchSize,
+				LookupBatchWindow: *gitlabLookupBatchWindow,
+
+				MaxEntries: *gitlabCacheMaxEntries,
+				MaxStale:   *gitlabCacheMaxStale,
 			},
 		},
 		ArtifactsServer: ArtifactsServer{
 			TimeoutSeconds: *artifactsServerTimeout,
-			URL:            *artifactsServer,
+			URLs:           artifactsServers.Split(),
+			CacheTTL:       *artifactsCacheTTL,
+			CacheSize:      *artifactsCacheSize,
 		},
 		Authentication: Auth{
 			Secret:       *secret,
@@ -224,25 +844,136 @@ func loadConfig() (*Config, error) {
 			ClientSecret: *clientSecret,
 			RedirectURI:  *redirectURI,
 			Scope:        *authScope,
+			Provider:     *authProvider,
+
+			OIDCIssuer:     *authOIDCIssuer,
+			OIDCClaim:      *authOIDCClaim,
+			OIDCNamespaces: authOIDCNamespaces.Split(),
+
+			ShareLinks:           *authShareLinks,
+			ShareLinkMaxLifetime: *authShareLinkMaxLifetime,
+
+			SessionStore:  *authSessionStore,
+			RedisAddress:  *authRedisAddress,
+			RedisPassword: *authRedisPassword,
+
+			SessionMaxAge: *authSessionMaxAge,
 		},
 		Log: Log{
-			Format:  *logFormat,
-			Verbose: *logVerbose,
+			Format:             *logFormat,
+			Verbose:            *logVerbose,
+			OutboundPercentage: *logOutboundPercentage,
+			FieldMap:           logFieldMap.Split(),
+			StaticFields:       logStaticFields.Split(),
+			File:               *logFile,
+			FileMaxSize:        *logFileMaxSize,
+			FileMaxAge:         *logFileMaxAge,
+			FileMaxBackups:     *logFileMaxBackups,
+			Target:             *logTarget,
+			SyslogAddress:      *logSyslogAddress,
 		},
 		Sentry: Sentry{
 			DSN:         *sentryDSN,
 			Environment: *sentryEnvironment,
 		},
 		TLS: TLS{
-			MinVersion: tls.AllTLSVersions[*tlsMinVersion],
-			MaxVersion: tls.AllTLSVersions[*tlsMaxVersion],
+			MinVersion:   tls.AllTLSVersions[*tlsMinVersion],
+			MaxVersion:   tls.AllTLSVersions[*tlsMaxVersion],
+			OCSPStapling: *tlsOCSPStapling,
 		},
 		Zip: ZipServing{
 			ExpirationInterval: *zipCacheExpiration,
 			CleanupInterval:    *zipCacheCleanup,
 			RefreshInterval:    *zipCacheRefresh,
+			MaxArchives:        *zipCacheMax,
 			OpenTimeout:        *zipOpenTimeout,
 			AllowedPaths:       []string{*pagesRoot},
+			Mmap:               *zipMmap,
+			VerifySHA256:       *zipVerifySHA256,
+			MaxFiles:           *zipMaxFiles,
+			MaxPathDepth:       *zipMaxPathDepth,
+			ColdWorkers:        *zipColdWorkers,
+			ColdQueue:          *zipColdQueue,
+			HotWorkers:         *zipHotWorkers,
+			HotQueue:           *zipHotQueue,
+			EgressBudget:       *zipEgressBudget,
+			EgressBudgetWindow: *zipEgressBudgetWindow,
+
+			PrefetchConcurrency: *zipPrefetchWorkers,
+			PrefetchChunkSize:   *zipPrefetchChunk,
+
+			RangeCacheDir:          *zipRangeCacheDir,
+			RangeCacheSize:         *zipRangeCacheSize,
+			RangeCacheMaxRangeSize: *zipRangeCacheMax,
+
+			RangeFallbackSize: *zipRangeFallback,
+		},
+		Mirror: Mirror{
+			URL:              *mirrorURL,
+			SamplePercentage: *mirrorSamplePercentage,
+			Timeout:          *mirrorTimeout,
+			MaxInFlight:      *mirrorMaxInFlight,
+		},
+		Tracing: Tracing{
+			OTLPEndpoint: *tracingOTLPEndpoint,
+			SampleRatio:  *tracingSampleRatio,
+		},
+		Disk: DiskServing{
+			AttributeCacheTTL:  *diskAttributeCacheTTL,
+			AttributeCacheSize: *diskAttributeCacheSize,
+			FileHandleCacheTTL: *diskFileHandleCacheTTL,
+			IsolationHeaders:   *isolationHeaders,
+		},
+		HTMLCache: HTMLCache{
+			TTL:         *htmlCacheTTL,
+			Size:        *htmlCacheSize,
+			MaxFileSize: *htmlCacheMaxFileSize,
+		},
+		Charset: Charset{
+			Default: *textCharset,
+			Sniff:   *textCharsetSniff,
+		},
+		MIMETypes: MIMETypes{
+			Extensions: mimeTypes.Split(),
+		},
+		Proxy: Proxy{
+			AllowedHosts: proxyAllowedHosts.Split(),
+			IdleTimeout:  *proxyIdleTimeout,
+			MaxBytes:     *proxyMaxBytes,
+
+			RedirectsAllowedHosts: redirectsProxyAllowedHosts.Split(),
+		},
+		Redirects: Redirects{
+			MaxRuleCount:    *redirectsMaxRuleCount,
+			MaxPathSegments: *redirectsMaxPathSegments,
+			PreserveQuery:   *redirectsPreserveQuery,
+
+			NamespaceFallback: *redirectsNamespaceFallback,
+		},
+		AssetCache: AssetCache{
+			TTL:         *assetCacheTTL,
+			Size:        *assetCacheSize,
+			MaxFileSize: *assetCacheMaxFileSize,
+		},
+		Tarpit: Tarpit{
+			Delay:         *tarpitDelay,
+			MaxConcurrent: *tarpitMaxConcurrent,
+			PathSuffixes:  tarpitPathSuffixes.Split(),
+		},
+		AssetManifest: AssetManifest{
+			Mode: *assetManifestMode,
+		},
+		HTMLInjection: HTMLInjection{
+			Position:        *htmlInjectPosition,
+			ExcludedDomains: htmlInjectExcludedDomains.Split(),
+		},
+		Compression: Compression{
+			Enabled: *compressResponses,
+			MinSize: *compressMinSize,
+		},
+		CacheControl: CacheControl{
+			Default: *cacheControl,
+			Types:   cacheControlTypes.Split(),
 		},
 
 		// Actual listener pointers will be populated in appMain. We populate the
@@ -256,6 +987,21 @@ func loadConfig() (*Config, error) {
 
 	var err error
 
+	// the paths opened again after the configuration is loaded are made
+	// absolute, as the working directory then changes to the pages root
+	for _, path := range []*string{
+		&config.Log.File,
+		&config.General.RootCertificatePath,
+		&config.General.RootKeyPath,
+		&config.General.ErrorPages,
+	} {
+		if *path != "" {
+			if *path, err = filepath.Abs(*path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// Populating remaining General settings
 	for _, file := range []struct {
 		contents *[]byte
@@ -263,6 +1009,8 @@ func loadConfig() (*Config, error) {
 	}{
 		{&config.General.RootCertificate, *pagesRootCert},
 		{&config.General.RootKey, *pagesRootKey},
+		{&config.General.UnpublishedPage, *unpublishedPage},
+		{&config.HTMLInjection.Snippet, *htmlInjectSnippet},
 	} {
 		if file.path != "" {
 			if *file.contents, err = os.ReadFile(file.path); err != nil {
@@ -271,6 +1019,20 @@ func loadConfig() (*Config, error) {
 		}
 	}
 
+	if *rateLimitPathFile != "" {
+		rules, err := readRateLimitPathFile(*rateLimitPathFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.RateLimit.PathRules = append(config.RateLimit.PathRules, rules...)
+	}
+
+	if !*enableDisk {
+		// neither are the zip archives on disk opened
+		config.Zip.AllowedPaths = nil
+	}
+
 	// Populating remaining GitLab settings
 	config.GitLab.PublicServer = *publicGitLabServer
 
@@ -285,47 +1047,173 @@ func loadConfig() (*Config, error) {
 
 func LogConfig(config *Config) {
 	log.WithFields(log.Fields{
-		"artifacts-server":              *artifactsServer,
+		"artifacts-server":              artifactsServers,
 		"artifacts-server-timeout":      *artifactsServerTimeout,
+		"artifacts-cache-ttl":           *artifactsCacheTTL,
+		"artifacts-cache-size":          *artifactsCacheSize,
 		"default-config-filename":       flag.DefaultConfigFlagname,
 		"disable-cross-origin-requests": *disableCrossOriginRequests,
-		"domain":                        config.General.Domain,
+		"domain":                        config.General.Domains,
 		"insecure-ciphers":              config.General.InsecureCiphers,
 		"listen-http":                   listenHTTP,
 		"listen-https":                  listenHTTPS,
 		"listen-proxy":                  listenProxy,
 		"listen-https-proxyv2":          listenHTTPSProxyv2,
 		"log-format":                    *logFormat,
+		"log-outbound-percentage":       config.Log.OutboundPercentage,
+		"log-field-map":                 config.Log.FieldMap,
+		"log-static-field":              config.Log.StaticFields,
+		"log-file":                      config.Log.File,
+		"log-file-max-size":             config.Log.FileMaxSize,
+		"log-file-max-age":              config.Log.FileMaxAge,
+		"log-file-max-backups":          config.Log.FileMaxBackups,
+		"log-target":                    config.Log.Target,
+		"log-syslog-address":            config.Log.SyslogAddress,
 		"metrics-address":               *metricsAddress,
-		"pages-domain":                  *pagesDomain,
+		"enable-pprof":                  config.General.EnablePprof,
+		"listen-weight-agent":           *weightAgentAddress,
+		"weight-interval":               *weightInterval,
+		"read-only":                     config.General.ReadOnly,
+		"pages-domain":                  pagesDomains,
 		"pages-root":                    *pagesRoot,
 		"pages-status":                  *pagesStatus,
 		"propagate-correlation-id":      *propagateCorrelationID,
+		"request-id-header":             config.General.RequestIDHeader,
+		"security-headers":              config.General.SecurityHeaders,
+		"deprecation-warning-interval":  config.General.DeprecationWarningInterval,
 		"redirect-http":                 config.General.RedirectHTTP,
-		"root-cert":                     *pagesRootKey,
-		"root-key":                      *pagesRootCert,
+		"root-cert":                     *pagesRootCert,
+		"root-key":                      *pagesRootKey,
 		"status_path":                   config.General.StatusPath,
+		"pages-status-json":             config.General.StatusJSON,
+		"unpublished-page":              *unpublishedPage,
+		"error-pages":                   config.General.ErrorPages,
 		"tls-min-version":               *tlsMinVersion,
 		"tls-max-version":               *tlsMaxVersion,
+		"tls-ocsp-stapling":             config.TLS.OCSPStapling,
 		"gitlab-server":                 config.GitLab.PublicServer,
 		"internal-gitlab-server":        config.GitLab.InternalServer,
 		"api-secret-key":                *gitLabAPISecretKey,
+		"gitlab-api-version":            config.GitLab.APIVersion,
+		"gitlab-lookup-max-size":        config.GitLab.MaxLookupSize,
+		"gitlab-lookup-max-paths":       config.GitLab.MaxLookupPaths,
+		"gitlab-cache-expiry":           config.GitLab.Cache.CacheExpiry,
+		"gitlab-cache-refresh":          config.GitLab.Cache.EntryRefreshTimeout,
+		"gitlab-cache-cleanup":          config.GitLab.Cache.CacheCleanupInterval,
+		"gitlab-cache-max-entries":      config.GitLab.Cache.MaxEntries,
+		"gitlab-cache-max-stale":        config.GitLab.Cache.MaxStale,
+		"gitlab-retrieval-timeout":      config.GitLab.Cache.RetrievalTimeout,
+		"gitlab-retrieval-interval":     config.GitLab.Cache.MaxRetrievalInterval,
+		"gitlab-retrieval-retries":      config.GitLab.Cache.MaxRetrievalRetries,
+		"gitlab-lookup-batch-size":      config.GitLab.Cache.LookupBatchSize,
+		"gitlab-lookup-batch-window":    config.GitLab.Cache.LookupBatchWindow,
+		"gitlab-api-transport":          config.GitLab.APITransport,
+		"gitlab-grpc-server":            config.GitLab.GRPCServer,
+		"removed-domain-grace-period":   config.GitLab.Cache.RemovedDomainGracePeriod,
 		"enable-disk":                   config.GitLab.EnableDisk,
+		"deployment-export":             config.GitLab.DeploymentExport,
 		"auth-redirect-uri":             config.Authentication.RedirectURI,
 		"auth-scope":                    config.Authentication.Scope,
+		"auth-provider":                 config.Authentication.Provider,
+		"auth-oidc-issuer":              config.Authentication.OIDCIssuer,
+		"auth-oidc-claim":               config.Authentication.OIDCClaim,
+		"auth-oidc-namespace":           config.Authentication.OIDCNamespaces,
+		"auth-share-links":              config.Authentication.ShareLinks,
+		"auth-share-link-max-lifetime":  config.Authentication.ShareLinkMaxLifetime,
+		"auth-session-store":            config.Authentication.SessionStore,
+		"auth-redis-address":            config.Authentication.RedisAddress,
+		"auth-session-max-age":          config.Authentication.SessionMaxAge,
 		"max-conns":                     config.General.MaxConns,
 		"max-uri-length":                config.General.MaxURILength,
+		"max-header-bytes":              config.General.MaxHeaderBytes,
+		"max-body-bytes":                config.General.MaxBodyBytes,
+		"allowed-methods":               config.General.AllowedMethods,
 		"zip-cache-expiration":          config.Zip.ExpirationInterval,
 		"zip-cache-cleanup":             config.Zip.CleanupInterval,
 		"zip-cache-refresh":             config.Zip.RefreshInterval,
+		"zip-cache-max-archives":        config.Zip.MaxArchives,
 		"zip-open-timeout":              config.Zip.OpenTimeout,
+		"zip-mmap":                      config.Zip.Mmap,
+		"zip-verify-sha256":             config.Zip.VerifySHA256,
+		"zip-max-files":                 config.Zip.MaxFiles,
+		"zip-max-path-depth":            config.Zip.MaxPathDepth,
+		"zip-prefetch-concurrency":      config.Zip.PrefetchConcurrency,
+		"zip-prefetch-chunk-size":       config.Zip.PrefetchChunkSize,
+		"zip-range-cache-dir":           config.Zip.RangeCacheDir,
+		"zip-range-cache-size":          config.Zip.RangeCacheSize,
+		"zip-range-cache-max-range":     config.Zip.RangeCacheMaxRangeSize,
+		"zip-range-fallback-size":       config.Zip.RangeFallbackSize,
+		"zip-cold-workers":              config.Zip.ColdWorkers,
+		"zip-cold-queue":                config.Zip.ColdQueue,
+		"zip-hot-workers":               config.Zip.HotWorkers,
+		"zip-hot-queue":                 config.Zip.HotQueue,
+		"zip-egress-budget":             config.Zip.EgressBudget,
+		"zip-egress-budget-window":      config.Zip.EgressBudgetWindow,
+		"mirror-url":                    config.Mirror.URL,
+		"mirror-sample-percentage":      config.Mirror.SamplePercentage,
+		"mirror-timeout":                config.Mirror.Timeout,
+		"mirror-max-in-flight":          config.Mirror.MaxInFlight,
+		"tracing-otlp-endpoint":         config.Tracing.OTLPEndpoint,
+		"tracing-sample-ratio":          config.Tracing.SampleRatio,
+		"disk-attribute-cache-ttl":      config.Disk.AttributeCacheTTL,
+		"disk-attribute-cache-size":     config.Disk.AttributeCacheSize,
+		"disk-file-handle-cache-ttl":    config.Disk.FileHandleCacheTTL,
+		"isolation-headers":             config.Disk.IsolationHeaders,
+		"html-cache-ttl":                config.HTMLCache.TTL,
+		"html-cache-size":               config.HTMLCache.Size,
+		"html-cache-max-file-size":      config.HTMLCache.MaxFileSize,
+		"text-charset":                  config.Charset.Default,
+		"text-charset-sniff":            config.Charset.Sniff,
+		"mime-type":                     config.MIMETypes.Extensions,
+		"proxy-allowed-hosts":           config.Proxy.AllowedHosts,
+		"proxy-idle-timeout":            config.Proxy.IdleTimeout,
+		"proxy-max-bytes":               config.Proxy.MaxBytes,
+		"redirects-proxy-allowed-hosts": config.Proxy.RedirectsAllowedHosts,
+		"redirects-max-rule-count":      config.Redirects.MaxRuleCount,
+		"redirects-max-path-segments":   config.Redirects.MaxPathSegments,
+		"redirects-preserve-query":      config.Redirects.PreserveQuery,
+		"redirects-namespace-fallback":  config.Redirects.NamespaceFallback,
+		"asset-cache-ttl":               config.AssetCache.TTL,
+		"asset-cache-size":              config.AssetCache.Size,
+		"asset-cache-max-file-size":     config.AssetCache.MaxFileSize,
+		"tarpit-delay":                  config.Tarpit.Delay,
+		"tarpit-max-concurrent":         config.Tarpit.MaxConcurrent,
+		"tarpit-path-suffix":            config.Tarpit.PathSuffixes,
+		"asset-manifest-mode":           config.AssetManifest.Mode,
+		"html-inject-snippet":           *htmlInjectSnippet,
+		"html-inject-position":          config.HTMLInjection.Position,
+		"html-inject-exclude-domain":    config.HTMLInjection.ExcludedDomains,
+		"compress-responses":            config.Compression.Enabled,
+		"compress-min-size":             config.Compression.MinSize,
+		"cache-control":                 config.CacheControl.Default,
+		"cache-control-type":            config.CacheControl.Types,
+		"rate-limit-auth":               config.RateLimit.AuthLimitPerSecond,
+		"rate-limit-auth-burst":         config.RateLimit.AuthBurst,
+		"rate-limit-dry-run":            config.RateLimit.DryRun,
+		"rate-limit-source-ip-allow":    config.RateLimit.SourceIPAllowlist,
+		"rate-limit-source-ip-deny":     config.RateLimit.SourceIPDenylist,
+		"rate-limit-path":               config.RateLimit.PathRules,
 	}).Debug("Start Pages with configuration")
 }
 
+// ReportDeprecatedFlags records the deprecated flags that are set, whether
+// on the command line, in the environment or in the config file
+func ReportDeprecatedFlags() {
+	flag.Visit(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Usage, "DEPRECATED") {
+			deprecation.Warn(deprecation.KindFlag, f.Name, fmt.Sprintf("flag %s is %s", f.Name, f.Usage))
+		}
+	})
+}
+
 // LoadConfig parses configuration settings passed as command line arguments or
 // via config file, and populates a Config object with those values
 func LoadConfig() (*Config, error) {
 	initFlags()
 
+	if err := loadYAMLFile(*configYAML); err != nil {
+		return nil, err
+	}
+
 	return loadConfig()
 }
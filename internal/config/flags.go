@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/namsral/flag"
@@ -14,15 +15,23 @@ var (
 	redirectHTTP            = flag.Bool("redirect-http", false, "Redirect pages from HTTP to HTTPS")
 	_                       = flag.Bool("use-http2", true, "DEPRECATED: HTTP2 is always enabled for pages")
 	pagesRoot               = flag.String("pages-root", "shared/pages", "The directory where pages are stored")
-	pagesDomain             = flag.String("pages-domain", "gitlab-example.com", "The domain to serve static pages")
 	rateLimitSourceIP       = flag.Float64("rate-limit-source-ip", 0.0, "Rate limit per source IP in number of requests per second, 0 means is disabled")
 	rateLimitSourceIPBurst  = flag.Int("rate-limit-source-ip-burst", 100, "Rate limit per source IP maximum burst allowed per second")
 	rateLimitDomain         = flag.Float64("rate-limit-domain", 0.0, "Rate limit per domain in number of requests per second, 0 means is disabled")
 	rateLimitDomainBurst    = flag.Int("rate-limit-domain-burst", 100, "Rate limit per domain maximum burst allowed per second")
-	artifactsServer         = flag.String("artifacts-server", "", "API URL to proxy artifact requests to, e.g.: 'https://gitlab.com/api/v4'")
+	rateLimitAuth           = flag.Float64("rate-limit-auth", 0.0, "Rate limit per source IP for the auth endpoints in number of requests per second, 0 means is disabled")
+	rateLimitAuthBurst      = flag.Int("rate-limit-auth-burst", 10, "Rate limit per source IP for the auth endpoints maximum burst allowed per second")
+	rateLimitDryRun         = flag.Bool("rate-limit-dry-run", false, "Log and count the requests above the rate limits without rejecting them")
+	rateLimitPathFile       = flag.String("rate-limit-path-file", "", "The path to a file of rate-limit-path rules, one per line, with # comments")
 	artifactsServerTimeout  = flag.Int("artifacts-server-timeout", 10, "Timeout (in seconds) for a proxied request to the artifacts server")
+	artifactsCacheTTL       = flag.Duration("artifacts-cache-ttl", 0, "Keep the successful responses of the artifacts server in memory for this duration. 0 disables the cache")
+	artifactsCacheSize      = flag.Int64("artifacts-cache-size", 1000, "Maximum number of artifacts server responses kept in memory, files larger than 1 MiB are never cached")
 	pagesStatus             = flag.String("pages-status", "", "The url path for a status page, e.g., /@status")
+	pagesStatusJSON         = flag.Bool("pages-status-json", false, "Serve a JSON document of the version, readiness and cache state of the daemon on the status page to the clients that accept application/json")
+	unpublishedPage         = flag.String("unpublished-page", "", "The path to an HTML page served for deployments before their publish_at or after their unpublish_at time, defaults to the 404 page")
+	errorPages              = flag.String("error-pages", "", "The path to a directory or zip archive of custom error page templates named after their status code, e.g. 404.html, replacing the built-in error pages")
 	metricsAddress          = flag.String("metrics-address", "", "The address to listen on for metrics requests")
+	enablePprof             = flag.Bool("enable-pprof", true, "Serve the net/http/pprof and expvar handlers on the metrics-address, to profile Pages during incidents")
 	sentryDSN               = flag.String("sentry-dsn", "", "The address for sending sentry crash reporting to")
 	sentryEnvironment       = flag.String("sentry-environment", "", "The environment for sentry crash reporting")
 	_                       = flag.Uint("daemon-uid", 0, "DEPRECATED and ignored, will be removed in 15.0")
@@ -30,8 +39,17 @@ var (
 	_                       = flag.Bool("daemon-enable-jail", false, "DEPRECATED and ignored, will be removed in 15.0")
 	_                       = flag.Bool("daemon-inplace-chroot", false, "DEPRECATED and ignored, will be removed in 15.0") // TODO: https://gitlab.com/gitlab-org/gitlab-pages/-/issues/599
 	propagateCorrelationID  = flag.Bool("propagate-correlation-id", false, "Reuse existing Correlation-ID from the incoming request header `X-Request-ID` if present")
+	requestIDHeader         = flag.String("request-id-header", "X-Request-Id", "Response header echoing the correlation ID of the request, so users can report it. Empty to disable")
+	securityHeaders         = flag.String("security-headers", "off", "Preset of security headers set on every response: 'strict', 'basic' or 'off'. The -header flag overrides its headers")
 	logFormat               = flag.String("log-format", "json", "The log output format: 'text' or 'json'")
 	logVerbose              = flag.Bool("log-verbose", false, "Verbose logging")
+	logFile                 = flag.String("log-file", "", "Write the logs to this file instead of stderr, the file is reopened on SIGUSR2 for external rotation such as logrotate")
+	logFileMaxSize          = flag.Int64("log-file-max-size", 0, "Rotate the log-file when it grows over this size in bytes. 0 disables size-based rotation")
+	logFileMaxAge           = flag.Duration("log-file-max-age", 0, "Rotate the log-file when it was opened longer than this duration ago. 0 disables age-based rotation")
+	logFileMaxBackups       = flag.Int("log-file-max-backups", 0, "Maximum number of rotated log files kept, the oldest ones are removed. 0 keeps them all")
+	logTarget               = flag.String("log-target", "", "Send the logs to 'syslog' or 'journald' instead of stderr or the log-file")
+	logSyslogAddress        = flag.String("log-syslog-address", "unix:///dev/log", "Address of the syslog server of the syslog log-target, as udp://host:port, tcp://host:port or unix:///path")
+	logOutboundPercentage   = flag.Float64("log-outbound-percentage", 0, "Percentage of the requests to the GitLab API and object storage that are logged with their target, duration, status and size, 0 disables these logs")
 	secret                  = flag.String("auth-secret", "", "Cookie store hash key, should be at least 32 bytes long")
 	publicGitLabServer      = flag.String("gitlab-server", "", "Public GitLab server, for example https://www.gitlab.com")
 	internalGitLabServer    = flag.String("internal-gitlab-server", "", "Internal GitLab server used for API requests, useful if you want to send that traffic over an internal load balancer, example value https://gitlab.example.internal (defaults to value of gitlab-server)")
@@ -41,31 +59,130 @@ var (
 	gitlabCacheExpiry       = flag.Duration("gitlab-cache-expiry", 10*time.Minute, "The maximum time a domain's configuration is stored in the cache")
 	gitlabCacheRefresh      = flag.Duration("gitlab-cache-refresh", time.Minute, "The interval at which a domain's configuration is set to be due to refresh")
 	gitlabCacheCleanup      = flag.Duration("gitlab-cache-cleanup", time.Minute, "The interval at which expired items are removed from the cache")
+	gitlabCacheMaxEntries   = flag.Int("gitlab-cache-max-entries", 0, "The maximum number of domains' configurations stored in the cache, the entries closest to their expiry are evicted when it is full, 0 means unlimited")
+	gitlabCacheMaxStale     = flag.Duration("gitlab-cache-max-stale", 0, "The maximum time an expired domain's configuration is served while the GitLab API fails to refresh it, 0 disables the stale configurations")
 	gitlabRetrievalTimeout  = flag.Duration("gitlab-retrieval-timeout", 30*time.Second, "The maximum time to wait for a response from the GitLab API per request")
 	gitlabRetrievalInterval = flag.Duration("gitlab-retrieval-interval", time.Second, "The interval to wait before retrying to resolve a domain's configuration via the GitLab API")
 	gitlabRetrievalRetries  = flag.Int("gitlab-retrieval-retries", 3, "The maximum number of times to retry to resolve a domain's configuration via the API")
+	gitlabAPIVersion        = flag.Int("gitlab-api-version", 0, "Version of the internal Pages API to request from GitLab, 0 negotiates the highest version supported by both sides. Responses of a higher version than supported are rejected")
+	gitlabLookupMaxSize     = flag.Int64("gitlab-lookup-max-size", 16*1024*1024, "Maximum size in bytes of a domain's configuration received from the GitLab API, 0 means unlimited")
+	gitlabLookupMaxPaths    = flag.Int("gitlab-lookup-max-paths", 10000, "Maximum number of lookup paths in a domain's configuration received from the GitLab API, 0 means unlimited")
+	gitlabLookupBatchSize   = flag.Int("gitlab-lookup-batch-size", 0, "Maximum number of domains which are not cached looked up with a single GitLab API request, 0 disables the batch lookups")
+	gitlabLookupBatchWindow = flag.Duration("gitlab-lookup-batch-window", 10*time.Millisecond, "The time to wait for more domains to look up after the first domain of a batch")
+	gitlabAPITransport      = flag.String("gitlab-api-transport", GitLabAPITransportHTTP, "Transport of the domain lookups, http for the internal API or grpc for the gRPC server of GitLab set with gitlab-grpc-server")
+	gitlabGRPCServer        = flag.String("gitlab-grpc-server", "", "gRPC server of GitLab used for the domain lookups with the grpc transport, for example grpcs://gitlab.example.internal:8155, grpc:// disables TLS")
 
 	_          = flag.String("domain-config-source", "gitlab", "DEPRECATED and has not affect, see https://gitlab.com/gitlab-org/gitlab-pages/-/merge_requests/541")
-	enableDisk = flag.Bool("enable-disk", true, "Enable disk access, shall be disabled in environments where shared disk storage isn't available")
+	enableDisk = flag.Bool("enable-disk", true, "Enable disk access, shall be disabled in environments where shared disk storage isn't available. When disabled, nothing is read from the pages-root directory and the GitLab API is required")
+
+	deploymentExport = flag.Bool("deployment-export", false, "Let the owners of a project download the archive of its deployment at <project>/-/deployment.zip, with a token signed with the api-secret-key")
 
 	clientID           = flag.String("auth-client-id", "", "GitLab application Client ID")
 	clientSecret       = flag.String("auth-client-secret", "", "GitLab application Client Secret")
 	redirectURI        = flag.String("auth-redirect-uri", "", "GitLab application redirect URI")
 	authScope          = flag.String("auth-scope", "api", "Scope to be used for authentication (must match GitLab Pages OAuth application settings)")
+	authProvider       = flag.String("auth-provider", AuthProviderGitLab, "Provider authenticating users of access controlled sites, gitlab or oidc for an external OpenID Connect provider")
+	authOIDCIssuer     = flag.String("auth-oidc-issuer", "", "Issuer URL of the OpenID Connect provider, its configuration is discovered from /.well-known/openid-configuration")
+	authOIDCClaim      = flag.String("auth-oidc-claim", "groups", "Claim of the OpenID Connect ID token whose values are mapped to namespaces by auth-oidc-namespace")
 	maxConns           = flag.Int("max-conns", 0, "Limit on the number of concurrent connections to the HTTP, HTTPS or proxy listeners, 0 for no limit")
 	maxURILength       = flag.Int("max-uri-length", 1024, "Limit the length of URI, 0 for unlimited.")
+	maxHeaderBytes     = flag.Int("max-header-bytes", http.DefaultMaxHeaderBytes, "Limit the total size of the request headers, 0 for the Go default.")
+	maxBodyBytes       = flag.Int64("max-body-bytes", 1024*1024, "Limit the size of the request bodies, 0 for unlimited.")
 	insecureCiphers    = flag.Bool("insecure-ciphers", false, "Use default list of cipher suites, may contain insecure ones like 3DES and RC4")
 	tlsMinVersion      = flag.String("tls-min-version", "tls1.2", tls.FlagUsage("min"))
 	tlsMaxVersion      = flag.String("tls-max-version", "", tls.FlagUsage("max"))
+	tlsOCSPStapling    = flag.Bool("tls-ocsp-stapling", false, "Staple the OCSP responses of the served certificates, fetched from the responders of their CAs in the background")
 	zipCacheExpiration = flag.Duration("zip-cache-expiration", 60*time.Second, "Zip serving archive cache expiration interval")
 	zipCacheCleanup    = flag.Duration("zip-cache-cleanup", 30*time.Second, "Zip serving archive cache cleanup interval")
 	zipCacheRefresh    = flag.Duration("zip-cache-refresh", 30*time.Second, "Zip serving archive cache refresh interval")
+	zipCacheMax        = flag.Int("zip-cache-max-archives", 0, "Maximum number of zip archives cached, the ones closest to expiring are evicted first. 0 means unlimited")
 	zipOpenTimeout     = flag.Duration("zip-open-timeout", 30*time.Second, "Zip archive open timeout")
+	zipMmap            = flag.Bool("zip-mmap", false, "Map the file:// zip archives in memory instead of reading them with system calls, an archive truncated or replaced in place while mapped fails the requests reading it")
+	zipVerifySHA256    = flag.Bool("zip-verify-sha256", false, "Verify the zip archives against the SHA256 of their deployment when opening them, archives which don't match are not served")
+	zipMaxFiles        = flag.Int("zip-max-files", 0, "Maximum number of entries of a zip archive, larger archives are not served. 0 means unlimited")
+	zipMaxPathDepth    = flag.Int("zip-max-path-depth", 0, "Maximum depth of the paths served from a zip archive, deeper entries are ignored. 0 means unlimited")
+	zipPrefetchWorkers = flag.Int("zip-prefetch-concurrency", 0, "Number of chunks of a zip archive fetched concurrently from the object storage while a file is streamed. 0 disables prefetching")
+	zipPrefetchChunk   = flag.Int64("zip-prefetch-chunk-size", 1<<20, "Size in bytes of the chunks of zip-prefetch-concurrency")
+	zipRangeCacheDir   = flag.String("zip-range-cache-dir", "", "Directory where the ranges read from the zip archives in the object storage are cached. Empty disables the cache")
+	zipRangeCacheSize  = flag.Int64("zip-range-cache-size", 1<<30, "Size in bytes of zip-range-cache-dir, the least recently used ranges are evicted")
+	zipRangeCacheMax   = flag.Int64("zip-range-cache-max-range", 1<<20, "Size in bytes of the largest range cached in zip-range-cache-dir")
+	zipRangeFallback   = flag.Int64("zip-range-fallback-size", 0, "Size in bytes of the largest zip archive downloaded in full to a temporary file when the object storage does not support range requests. 0 disables the fallback")
+	zipColdWorkers     = flag.Int("zip-cold-workers", 100, "Maximum number of zip archives opened concurrently. 0 means unlimited")
+	zipColdQueue       = flag.Int("zip-cold-queue", 1000, "Maximum number of zip archives waiting to be opened, more are rejected")
+	zipHotWorkers      = flag.Int("zip-hot-workers", 1000, "Maximum number of concurrent reads being set up from opened zip archives. 0 means unlimited")
+	zipHotQueue        = flag.Int("zip-hot-queue", 10000, "Maximum number of files waiting to be read from opened zip archives, more are rejected")
+
+	zipEgressBudget       = flag.Int64("zip-egress-budget", 0, "Maximum number of bytes read from the object storage per zip-egress-budget-window, above which only the archives already opened are served. 0 means unlimited")
+	zipEgressBudgetWindow = flag.Duration("zip-egress-budget-window", time.Hour, "The time window of zip-egress-budget")
+
+	mirrorURL              = flag.String("mirror-url", "", "URL of a secondary Pages deployment to mirror a sample of the read requests to, e.g. for load testing a new release")
+	mirrorSamplePercentage = flag.Float64("mirror-sample-percentage", 0, "Percentage of GET and HEAD requests mirrored to mirror-url, 0 disables mirroring")
+	mirrorTimeout          = flag.Duration("mirror-timeout", 5*time.Second, "Timeout of a mirrored request")
+	mirrorMaxInFlight      = flag.Int("mirror-max-in-flight", 100, "Maximum number of mirrored requests in flight, requests are not mirrored above this limit")
+
+	tracingOTLPEndpoint = flag.String("tracing-otlp-endpoint", "", "URL of an OTLP/HTTP collector the OpenTelemetry traces are exported to, e.g. http://localhost:4318. Empty disables tracing")
+	tracingSampleRatio  = flag.Float64("tracing-sample-ratio", 1, "Ratio of the traces started by Pages which are sampled, between 0 and 1. The traces started by Workhorse or Rails follow their sampling decision")
+
+	diskAttributeCacheTTL  = flag.Duration("disk-attribute-cache-ttl", 0, "Cache file attributes and symlink targets of disk serving for this duration, useful for network filesystems. 0 disables the cache")
+	diskAttributeCacheSize = flag.Int64("disk-attribute-cache-size", 10000, "Maximum number of file attributes and symlink targets cached by disk serving")
+	diskFileHandleCacheTTL = flag.Duration("disk-file-handle-cache-ttl", 0, "Reuse open file handles of disk serving for this duration, useful for network filesystems. 0 disables pooling")
+	isolationHeaders       = flag.Bool("isolation-headers", false, "Set the cross-origin isolation headers of the _headers file of deployments with a SHA")
+
+	htmlCacheTTL         = flag.Duration("html-cache-ttl", 0, "Keep HTML documents in memory for this duration, they are invalidated as soon as the project is deployed again. 0 disables the cache")
+	htmlCacheSize        = flag.Int64("html-cache-size", 1000, "Maximum number of HTML documents kept in memory")
+	htmlCacheMaxFileSize = flag.Int64("html-cache-max-file-size", 256*1024, "Maximum size in bytes of an HTML document kept in memory, larger documents are always read from storage")
+
+	textCharset      = flag.String("text-charset", "utf-8", "The charset stated in the Content-Type of text/html and text/plain files which do not declare one, empty to leave it out")
+	textCharsetSniff = flag.Bool("text-charset-sniff", false, "Detect the charset of text/html and text/plain files from their byte order mark, their meta charset and whether they are valid UTF-8")
+
+	proxyIdleTimeout = flag.Duration("proxy-idle-timeout", time.Minute, "Close proxied responses and upgraded connections, such as websockets, after being idle for this duration")
+	proxyMaxBytes    = flag.Int64("proxy-max-bytes", 100*1024*1024, "Maximum number of bytes of a proxied request, response or upgraded connection, 0 means unlimited")
+
+	redirectsMaxRuleCount      = flag.Int("redirects-max-rule-count", 1000, "Maximum number of rules of a _redirects file which are processed, the next ones are ignored")
+	redirectsMaxPathSegments   = flag.Int("redirects-max-path-segments", 25, "Maximum number of path segments of the URLs of _redirects rules, longer rules are invalid")
+	redirectsNamespaceFallback = flag.Bool("redirects-namespace-fallback", false, "Apply the _redirects rules of the namespace project of a group to the requests its other projects do not serve")
+	redirectsPreserveQuery     = flag.Bool("redirects-preserve-query", false, "Keep the query string of requests on the 301 and 302 redirects of _redirects rules whose URL has no query")
+
+	assetCacheTTL         = flag.Duration("asset-cache-ttl", 0, "Keep static assets in memory for this duration, identical files deployed by different projects are stored once. 0 disables the cache")
+	assetCacheSize        = flag.Int64("asset-cache-size", 10000, "Maximum number of distinct static assets kept in memory")
+	assetCacheMaxFileSize = flag.Int64("asset-cache-max-file-size", 1024*1024, "Maximum size in bytes of a static asset kept in memory, larger assets are always read from storage")
+
+	tarpitDelay         = flag.Duration("tarpit-delay", 0, "Respond to scanners and to requests above the enforced rate limits after this delay with a minimal response. 0 disables the tarpit")
+	tarpitMaxConcurrent = flag.Int("tarpit-max-concurrent", 100, "Maximum number of requests held by the tarpit at once, more are answered immediately")
+
+	assetManifestMode = flag.String("asset-manifest-mode", AssetManifestDisabled, "Serve the logical paths of a deployment's asset-manifest.json by 'rewrite' or 'redirect' to their fingerprinted files, which are cached as immutable, or 'disabled'. Only deployments with a SHA are affected")
+
+	htmlInjectSnippet  = flag.String("html-inject-snippet", "", "The path to an HTML snippet inserted into the HTML documents of all domains, e.g. a cookie-consent banner or an announcement")
+	htmlInjectPosition = flag.String("html-inject-position", HTMLInjectHead, "Insert html-inject-snippet before the closing tag of the 'head' or of the 'body' element")
+
+	compressResponses = flag.Bool("compress-responses", false, "Compress the responses with gzip when the client accepts it and the file is not served precompressed")
+	compressMinSize   = flag.Int64("compress-min-size", 1024, "Minimum size in bytes of a response compressed by compress-responses")
+
+	cacheControl = flag.String("cache-control", "max-age=600", "The Cache-Control of the files of the projects without access control, none is sent when empty")
+
+	weightAgentAddress = flag.String("listen-weight-agent", "", "The address to listen on for HAProxy agent-check connections, which are answered with the weight of the node")
+	weightInterval     = flag.Duration("weight-interval", 10*time.Second, "The interval at which the weight of the node reported to the load balancer is updated")
+
+	readOnly = flag.Bool("read-only", false, "Serve only the cached domains and archives and the local disk, responding with 503 to domains which need a GitLab API lookup or an archive fetch. SIGUSR1 toggles the mode at runtime")
+
+	deprecationWarningInterval = flag.Duration("deprecation-warning-interval", time.Hour, "Log a warning about the same deprecated flag, serving source or API payload at most once per interval")
+
+	removedDomainGracePeriod = flag.Duration("removed-domain-grace-period", 0, "Keep serving the last known content of a domain for this duration after GitLab reports it as removed, 0 disables the grace period")
+
+	authShareLinks           = flag.Bool("auth-share-links", false, "Let visitors with a share link signed with the api-secret-key view the access controlled project it was minted for, without signing in. One-time links are redeemed once per Pages instance, unless auth-session-store is redis")
+	authShareLinkMaxLifetime = flag.Duration("auth-share-link-max-lifetime", 7*24*time.Hour, "Share links expiring later than this are refused")
+	authSessionStore         = flag.String("auth-session-store", AuthSessionStoreCookie, "Store of the sessions of access controlled sites, cookie or redis to keep them server side and only their ID in the cookie")
+	authRedisAddress         = flag.String("auth-redis-address", "", "Address of the Redis server storing the sessions when auth-session-store is redis, e.g. localhost:6379")
+	authRedisPassword        = flag.String("auth-redis-password", "", "Password of the Redis server storing the sessions")
+	authSessionMaxAge        = flag.Duration("auth-session-max-age", 24*time.Hour, "Refresh the expired access tokens of the visitors for this duration after they signed in, before they sign in again. 0 never refreshes them")
 
 	disableCrossOriginRequests = flag.Bool("disable-cross-origin-requests", false, "Disable cross-origin requests")
 
 	showVersion = flag.Bool("version", false, "Show version")
 
+	// See initFlags()
+	configYAML *string
+
 	// See initFlags()
 	listenHTTP         = MultiStringFlag{separator: ","}
 	listenHTTPS        = MultiStringFlag{separator: ","}
@@ -73,18 +190,59 @@ var (
 	listenHTTPSProxyv2 = MultiStringFlag{separator: ","}
 
 	header = MultiStringFlag{separator: ";;"}
+
+	allowedMethods = MultiStringFlag{separator: ","}
+
+	pagesDomains = MultiStringFlag{separator: ","}
+
+	artifactsServers = MultiStringFlag{separator: ","}
+
+	authOIDCNamespaces = MultiStringFlag{separator: ";;"}
+	proxyAllowedHosts  = MultiStringFlag{separator: ","}
+	tarpitPathSuffixes = MultiStringFlag{separator: ","}
+
+	rateLimitSourceIPAllow = MultiStringFlag{separator: ","}
+	rateLimitSourceIPDeny  = MultiStringFlag{separator: ","}
+	rateLimitPaths         = MultiStringFlag{separator: ","}
+
+	redirectsProxyAllowedHosts = MultiStringFlag{separator: ","}
+
+	htmlInjectExcludedDomains = MultiStringFlag{separator: ","}
+
+	cacheControlTypes = MultiStringFlag{separator: ";;"}
+
+	mimeTypes = MultiStringFlag{separator: ","}
+
+	logFieldMap     = MultiStringFlag{separator: ","}
+	logStaticFields = MultiStringFlag{separator: ","}
 )
 
 // initFlags will be called from LoadConfig
 func initFlags() {
-	flag.Var(&listenHTTP, "listen-http", "The address(es) to listen on for HTTP requests")
-	flag.Var(&listenHTTPS, "listen-https", "The address(es) to listen on for HTTPS requests")
+	flag.Var(&listenHTTP, "listen-http", "The address(es) to listen on for HTTP requests, optionally followed by socket options such as ?network=tcp6&reuseport=true&fastopen=256")
+	flag.Var(&listenHTTPS, "listen-https", "The address(es) to listen on for HTTPS requests, optionally followed by socket options such as ?proxyprotocol=true")
 	flag.Var(&listenProxy, "listen-proxy", "The address(es) to listen on for proxy requests")
 	flag.Var(&listenHTTPSProxyv2, "listen-https-proxyv2", "The address(es) to listen on for HTTPS PROXYv2 requests (https://www.haproxy.org/download/1.8/doc/proxy-protocol.txt)")
+	flag.Var(&pagesDomains, "pages-domain", "The domain(s) to serve static pages, defaults to "+defaultPagesDomain)
+	flag.Var(&artifactsServers, "artifacts-server", "API URL(s) to proxy artifact requests to, e.g.: 'https://gitlab.com/api/v4', requested in round-robin order with failover")
 	flag.Var(&header, "header", "The additional http header(s) that should be send to the client")
+	flag.Var(&allowedMethods, "allowed-methods", "The HTTP method(s) of the requests served, the others are rejected with 405 Method Not Allowed, defaults to GET,HEAD,OPTIONS")
+	flag.Var(&proxyAllowedHosts, "proxy-allowed-hosts", "The upstream host(s) lookup paths of the proxy type are allowed to forward requests to")
+	flag.Var(&redirectsProxyAllowedHosts, "redirects-proxy-allowed-hosts", "The upstream host(s) the rewrites of _redirects with status 200 are allowed to proxy requests to")
+	flag.Var(&rateLimitSourceIPAllow, "rate-limit-source-ip-allow", "The CIDR(s) or IP(s) exempt from the source IP rate limit, e.g. monitoring or CDN egress ranges")
+	flag.Var(&rateLimitSourceIPDeny, "rate-limit-source-ip-deny", "The CIDR(s) or IP(s) whose requests are rejected with a 403 before any rate limit")
+	flag.Var(&rateLimitPaths, "rate-limit-path", "Rate limit the requests to the paths of each domain matching a pattern, where * matches any characters, as `/pattern=limit:burst`, e.g. /*.zip=1:5")
+	flag.Var(&tarpitPathSuffixes, "tarpit-path-suffix", "The path suffix(es) probed by scanners which are tarpitted, e.g. /wp-login.php, defaults to a list of well-known paths")
+	flag.Var(&htmlInjectExcludedDomains, "html-inject-exclude-domain", "The domain(s) whose HTML documents are served without html-inject-snippet")
+	flag.Var(&cacheControlTypes, "cache-control-type", "Override cache-control for the files of a media type, or of all the subtypes of type/*, as `media/type=policy`, e.g. text/html=no-cache")
+	flag.Var(&mimeTypes, "mime-type", "The media type(s) of the files with an extension, as `.ext=media/type`, overriding the MIME database of the system, e.g. .avif=image/avif")
+	flag.Var(&logFieldMap, "log-field-map", "Rename the log field(s), including msg, level and time, as `field=name`")
+	flag.Var(&logStaticFields, "log-static-field", "Add the field(s) to every log entry, as `field=value`")
+	flag.Var(&authOIDCNamespaces, "auth-oidc-namespace", "Grant the users whose auth-oidc-claim has a value access to a namespace or custom domain, as `claim-value=namespace`")
 
 	// read from -config=/path/to/gitlab-pages-config
 	flag.String(flag.DefaultConfigFlagname, "", "path to config file")
+	configYAML = flag.String("config-yaml", "", "path to a YAML config file with the options in nested sections, e.g. tls: {min-version: tls1.2}, overridden by the other config methods")
 
 	flag.Parse()
 }
@@ -0,0 +1,75 @@
+package tls
+
+import (
+	"crypto/tls"
+	"os"
+	"os/signal"
+	"sync/atomic"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// RootCertificate is the certificate served to the domains without their own.
+// It is reloaded from its files without a restart, the handshakes that follow
+// a reload get the new certificate while the established connections are
+// kept.
+type RootCertificate struct {
+	certPath string
+	keyPath  string
+	current  atomic.Value
+}
+
+// NewRootCertificate returns the RootCertificate of the PEM encoded cert and
+// key, reloaded from certPath and keyPath
+func NewRootCertificate(cert, key []byte, certPath, keyPath string) (*RootCertificate, error) {
+	certificate, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &RootCertificate{certPath: certPath, keyPath: keyPath}
+	c.current.Store(&certificate)
+
+	return c, nil
+}
+
+// Get returns the current certificate
+func (c *RootCertificate) Get() *tls.Certificate {
+	return c.current.Load().(*tls.Certificate)
+}
+
+// Reload reads the files of the certificate again. The current certificate is
+// kept when they are not a valid key pair, such as while they are replaced.
+func (c *RootCertificate) Reload() error {
+	certificate, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		metrics.RootCertificateReloads.WithLabelValues("error").Inc()
+		return err
+	}
+
+	c.current.Store(&certificate)
+	metrics.RootCertificateReloads.WithLabelValues("success").Inc()
+
+	return nil
+}
+
+// ReloadOnSignal reloads the certificate every time the process receives sig
+func (c *RootCertificate) ReloadOnSignal(sig os.Signal) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig)
+
+	go func() {
+		for range signals {
+			logger := log.WithFields(log.Fields{"root-cert": c.certPath, "root-key": c.keyPath})
+
+			if err := c.Reload(); err != nil {
+				logger.WithError(err).Error("failed to reload the root certificate, keeping the current one")
+				continue
+			}
+
+			logger.Info("reloaded the root certificate")
+		}
+	}()
+}
@@ -0,0 +1,104 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newKeyPair returns a PEM encoded self-signed certificate and its key
+func newKeyPair(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "*.gitlab-example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeKeyPair(t *testing.T, certPath, keyPath string, cert, key []byte) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(certPath, cert, 0600))
+	require.NoError(t, os.WriteFile(keyPath, key, 0600))
+}
+
+func TestRootCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "root.crt"), filepath.Join(dir, "root.key")
+
+	writeKeyPair(t, certPath, keyPath, cert, key)
+
+	root, err := NewRootCertificate(cert, key, certPath, keyPath)
+	require.NoError(t, err)
+
+	initial := root.Get()
+
+	newCert, newKey := newKeyPair(t)
+	writeKeyPair(t, certPath, keyPath, newCert, newKey)
+
+	require.NoError(t, root.Reload())
+
+	reloaded := root.Get()
+	require.NotEqual(t, initial.Certificate, reloaded.Certificate)
+
+	newBlock, _ := pem.Decode(newCert)
+	require.Equal(t, newBlock.Bytes, reloaded.Certificate[0])
+
+	// a certificate replaced without its key is not a valid key pair
+	otherCert, _ := newKeyPair(t)
+	require.NoError(t, os.WriteFile(certPath, otherCert, 0600))
+
+	require.Error(t, root.Reload())
+	require.Same(t, reloaded, root.Get())
+}
+
+func TestNewRootCertificateInvalidKeyPair(t *testing.T) {
+	_, err := NewRootCertificate(cert, []byte("invalid"), "", "")
+	require.EqualError(t, err, "tls: failed to find any PEM data in key input")
+}
+
+func TestRootCertificateReloadOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "root.crt"), filepath.Join(dir, "root.key")
+
+	root, err := NewRootCertificate(cert, key, certPath, keyPath)
+	require.NoError(t, err)
+
+	root.ReloadOnSignal(syscall.SIGHUP)
+
+	newCert, newKey := newKeyPair(t)
+	writeKeyPair(t, certPath, keyPath, newCert, newKey)
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+
+	newBlock, _ := pem.Decode(newCert)
+	require.Eventually(t, func() bool {
+		return string(root.Get().Certificate[0]) == string(newBlock.Bytes)
+	}, time.Second, 10*time.Millisecond)
+}
@@ -2,22 +2,113 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/hashicorp/go-multierror"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/net/http/httpguts"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config/tls"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/netutil"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
 )
 
 var (
 	ErrNoListener                       = errors.New("no listener defined, please specify at least one --listen-* flag")
+	ErrListenerOptions                  = errors.New("listener options must be network=tcp|tcp4|tcp6, reuseport=true|false, fastopen=<queue length> or proxyprotocol=true|false")
+	ErrListenerProxyProtocol            = errors.New("the proxyprotocol listener option is only supported by listen-http and listen-https")
 	ErrAuthNoSecret                     = errors.New("auth-secret must be defined if authentication is supported")
 	ErrAuthNoClientID                   = errors.New("auth-client-id must be defined if authentication is supported")
 	ErrAuthNoClientSecret               = errors.New("auth-client-secret must be defined if authentication is supported")
 	ErrAuthNoGitlabServer               = errors.New("gitlab-server must be defined if authentication is supported")
 	ErrAuthNoRedirect                   = errors.New("auth-redirect-uri must be defined if authentication is supported")
+	ErrAuthProvider                     = fmt.Errorf("auth-provider must be either %s or %s", AuthProviderGitLab, AuthProviderOIDC)
+	ErrAuthSessionStore                 = fmt.Errorf("auth-session-store must be either %s or %s", AuthSessionStoreCookie, AuthSessionStoreRedis)
+	ErrAuthRedisNoAddress               = errors.New("auth-redis-address must be defined if auth-session-store is redis")
+	ErrAuthSessionMaxAge                = errors.New("auth-session-max-age must not be negative")
+	ErrAuthOIDCNoIssuer                 = errors.New("auth-oidc-issuer must be defined if auth-provider is oidc")
+	ErrAuthOIDCScope                    = errors.New("auth-scope must include openid if auth-provider is oidc")
+	ErrAuthOIDCNoClaim                  = errors.New("auth-oidc-claim must be defined if auth-provider is oidc")
+	ErrAuthOIDCNoNamespace              = errors.New("auth-oidc-namespace must be defined if auth-provider is oidc")
+	ErrAuthOIDCNamespace                = errors.New("auth-oidc-namespace must be formatted as claim-value=namespace")
+	ErrAuthShareLinksNoAuth             = errors.New("auth-share-links requires authentication to be configured")
+	ErrAuthShareLinkMaxLifetime         = errors.New("auth-share-link-max-lifetime must be greater than 0")
 	ErrArtifactsServerUnsupportedScheme = errors.New("artifacts-server scheme must be either http:// or https://")
 	ErrArtifactsServerInvalidTimeout    = errors.New("artifacts-server-timeout must be greater than or equal to 1")
+	ErrArtifactsCacheTTL                = errors.New("artifacts-cache-ttl must not be negative")
+	ErrArtifactsCacheSize               = errors.New("artifacts-cache-size must be greater than 0 when the artifacts cache is enabled")
+	ErrGitLabAPIVersion                 = fmt.Errorf("gitlab-api-version must be between 0 and %d", api.MaxVersion)
+	ErrMirrorUnsupportedScheme          = errors.New("mirror-url scheme must be either http:// or https://")
+	ErrMirrorInvalidSamplePercentage    = errors.New("mirror-sample-percentage must be between 0 and 100")
+	ErrMirrorInvalidTimeout             = errors.New("mirror-timeout must be greater than 0")
+	ErrMirrorInvalidMaxInFlight         = errors.New("mirror-max-in-flight must be greater than 0")
+	ErrTracingUnsupportedScheme         = errors.New("tracing-otlp-endpoint scheme must be either http:// or https://")
+	ErrTracingInvalidSampleRatio        = errors.New("tracing-sample-ratio must be between 0 and 1")
+	ErrDiskAttributeCacheTTL            = errors.New("disk-attribute-cache-ttl must not be negative")
+	ErrDiskAttributeCacheSize           = errors.New("disk-attribute-cache-size must be greater than 0 when the attribute cache is enabled")
+	ErrDiskFileHandleCacheTTL           = errors.New("disk-file-handle-cache-ttl must not be negative")
+	ErrHTMLCacheTTL                     = errors.New("html-cache-ttl must not be negative")
+	ErrHTMLCacheSize                    = errors.New("html-cache-size must be greater than 0 when the HTML cache is enabled")
+	ErrHTMLCacheMaxFileSize             = errors.New("html-cache-max-file-size must be greater than 0 when the HTML cache is enabled")
+	ErrTextCharset                      = errors.New("text-charset must be a charset known to browsers, such as utf-8 or windows-1252")
+	ErrGitLabRemovedDomainGracePeriod   = errors.New("removed-domain-grace-period must not be negative")
+	ErrGitLabLookupMaxSize              = errors.New("gitlab-lookup-max-size must not be negative")
+	ErrGitLabLookupMaxPaths             = errors.New("gitlab-lookup-max-paths must not be negative")
+	ErrGitLabCacheDurations             = errors.New("gitlab-cache-expiry, gitlab-cache-refresh, gitlab-cache-cleanup and gitlab-retrieval-timeout must be greater than 0")
+	ErrGitLabCacheMaxEntries            = errors.New("gitlab-cache-max-entries must not be negative")
+	ErrGitLabCacheMaxStale              = errors.New("gitlab-cache-max-stale must not be negative")
+	ErrGitLabRetrievalInterval          = errors.New("gitlab-retrieval-interval must not be negative")
+	ErrGitLabRetrievalRetries           = errors.New("gitlab-retrieval-retries must be greater than 0")
+	ErrGitLabLookupBatchSize            = errors.New("gitlab-lookup-batch-size must not be negative")
+	ErrGitLabLookupBatchWindow          = errors.New("gitlab-lookup-batch-window must be greater than 0 when the batch lookups are enabled")
+	ErrGitLabAPITransport               = fmt.Errorf("gitlab-api-transport must be either %s or %s", GitLabAPITransportHTTP, GitLabAPITransportGRPC)
+	ErrGitLabGRPCServer                 = errors.New("gitlab-grpc-server must be a grpc:// or grpcs:// URL when gitlab-api-transport is grpc")
+	ErrDiskDisabledNoGitLabServer       = errors.New("gitlab-server or internal-gitlab-server must be an http(s) URL when enable-disk is disabled")
+	ErrDiskDisabledNoAPISecret          = errors.New("api-secret-key must be defined when enable-disk is disabled")
+	ErrDeploymentExportNoAPISecret      = errors.New("api-secret-key must be defined when deployment-export is enabled")
+	ErrLogOutboundPercentage            = errors.New("log-outbound-percentage must be between 0 and 100")
+	ErrLogFieldMap                      = errors.New("log-field-map must be formatted as field=name")
+	ErrLogStaticField                   = errors.New("log-static-field must be formatted as field=value")
+	ErrLogFileRotation                  = errors.New("log-file-max-size, log-file-max-age and log-file-max-backups must not be negative")
+	ErrLogFileRotationNoFile            = errors.New("log-file-max-size, log-file-max-age and log-file-max-backups require a log-file")
+	ErrLogTarget                        = fmt.Errorf("log-target must be either %s or %s", LogTargetSyslog, LogTargetJournald)
+	ErrLogTargetFile                    = errors.New("log-target cannot be combined with log-file")
+	ErrLogSyslogAddress                 = errors.New("log-syslog-address must be formatted as udp://host:port, tcp://host:port or unix:///path")
+	ErrZipCacheMaxArchives              = errors.New("zip-cache-max-archives must not be negative")
+	ErrZipMaxFiles                      = errors.New("zip-max-files must not be negative")
+	ErrZipMaxPathDepth                  = errors.New("zip-max-path-depth must not be negative")
+	ErrZipPrefetchConcurrency           = errors.New("zip-prefetch-concurrency must not be negative")
+	ErrZipPrefetchChunkSize             = errors.New("zip-prefetch-chunk-size must be greater than 0 when zip-prefetch-concurrency is set")
+	ErrZipRangeCacheSize                = errors.New("zip-range-cache-size and zip-range-cache-max-range must be greater than 0 when zip-range-cache-dir is set")
+	ErrZipRangeFallbackSize             = errors.New("zip-range-fallback-size must not be negative")
+	ErrZipWorkers                       = errors.New("zip-cold-workers and zip-hot-workers must not be negative")
+	ErrZipQueue                         = errors.New("zip-cold-queue and zip-hot-queue must not be negative")
+	ErrZipEgressBudget                  = errors.New("zip-egress-budget must not be negative")
+	ErrZipEgressBudgetWindow            = errors.New("zip-egress-budget-window must be greater than 0 when zip-egress-budget is set")
+	ErrRequestIDHeader                  = errors.New("request-id-header must be a valid header name")
+	ErrMaxBodyBytes                     = errors.New("max-body-bytes must not be negative")
+	ErrAllowedMethods                   = errors.New("allowed-methods must be uppercase HTTP methods, e.g. GET,HEAD,OPTIONS")
+	ErrSecurityHeaders                  = fmt.Errorf("security-headers must be either %s, %s or %s", SecurityHeadersStrict, SecurityHeadersBasic, SecurityHeadersOff)
+	ErrProxyIdleTimeout                 = errors.New("proxy-idle-timeout must be greater than 0")
+	ErrProxyMaxBytes                    = errors.New("proxy-max-bytes must not be negative")
+	ErrRateLimitSourceIPAllow           = errors.New("rate-limit-source-ip-allow must be CIDRs or IP addresses")
+	ErrRateLimitSourceIPDeny            = errors.New("rate-limit-source-ip-deny must be CIDRs or IP addresses")
+	ErrRateLimitPath                    = errors.New("rate-limit-path must be formatted as /pattern=limit:burst with a positive limit and burst")
+	ErrTarpitDelay                      = errors.New("tarpit-delay must not be negative")
+	ErrTarpitMaxConcurrent              = errors.New("tarpit-max-concurrent must be greater than 0 when the tarpit is enabled")
+	ErrWeightInterval                   = errors.New("weight-interval must be greater than 0")
+	ErrAssetManifestMode                = errors.New("asset-manifest-mode must be disabled, rewrite or redirect")
+	ErrHTMLInjectPosition               = errors.New("html-inject-position must be head or body")
+	ErrMIMEType                         = errors.New("mime-type must be .ext=media/type")
+	ErrRedirectsMaxRuleCount            = errors.New("redirects-max-rule-count must be greater than 0")
+	ErrRedirectsMaxPathSegments         = errors.New("redirects-max-path-segments must be greater than 0")
+	ErrCacheControlType                 = errors.New("cache-control-type must be media/type=policy")
+	ErrCompressMinSize                  = errors.New("compress-min-size must not be negative")
+	ErrAssetCacheTTL                    = errors.New("asset-cache-ttl must not be negative")
+	ErrAssetCacheSize                   = errors.New("asset-cache-size must be greater than 0 when the asset cache is enabled")
+	ErrAssetCacheMaxFileSize            = errors.New("asset-cache-max-file-size must be greater than 0 when the asset cache is enabled")
 )
 
 // Validate values populated in Config
@@ -28,6 +119,34 @@ func Validate(config *Config) error {
 		validateListeners(config),
 		validateAuthConfig(config),
 		validateArtifactsServerConfig(config),
+		validateGitLabAPIVersion(config),
+		validateGitLabCacheConfig(config),
+		validateGitLabRemovedDomainGracePeriod(config),
+		validateGitLabLookupLimits(config),
+		validateGitLabAPITransport(config),
+		validateDiskConfig(config),
+		validateDeploymentExportConfig(config),
+		validateZipServingConfig(config),
+		validateMirrorConfig(config),
+		validateTracingConfig(config),
+		validateLogConfig(config),
+		validateDiskServingConfig(config),
+		validateHTMLCacheConfig(config),
+		validateCharsetConfig(config),
+		validateAssetCacheConfig(config),
+		validateProxyConfig(config),
+		validateRequestIDHeader(config),
+		validateSecurityHeaders(config),
+		validateRequestLimits(config),
+		validateRateLimitConfig(config),
+		validateTarpitConfig(config),
+		validateHTMLInjectionConfig(config),
+		validateCompressionConfig(config),
+		validateCacheControlConfig(config),
+		validateMIMETypesConfig(config),
+		validateRedirectsConfig(config),
+		validateAssetManifestConfig(config),
+		validateWeightConfig(config),
 		tls.ValidateTLSVersions(*tlsMinVersion, *tlsMaxVersion),
 	)
 
@@ -42,12 +161,39 @@ func validateListeners(config *Config) error {
 		return ErrNoListener
 	}
 
+	var addrs []string
+	for _, listeners := range []MultiStringFlag{
+		config.ListenHTTPStrings,
+		config.ListenHTTPSStrings,
+		config.ListenHTTPSProxyv2Strings,
+		config.ListenProxyStrings,
+	} {
+		addrs = append(addrs, listeners.Split()...)
+	}
+
+	for _, addr := range addrs {
+		if _, _, err := netutil.ParseListenAddress(addr); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrListenerOptions, addr, err)
+		}
+	}
+
+	// the proxy listeners already know the address of the client
+	for _, addr := range append(config.ListenHTTPSProxyv2Strings.Split(), config.ListenProxyStrings.Split()...) {
+		if _, opts, _ := netutil.ParseListenAddress(addr); opts.ProxyProtocol {
+			return fmt.Errorf("%w: %s", ErrListenerProxyProtocol, addr)
+		}
+	}
+
 	return nil
 }
 
 func validateAuthConfig(config *Config) error {
 	if config.Authentication.Secret == "" && config.Authentication.ClientID == "" &&
 		config.Authentication.ClientSecret == "" && config.Authentication.RedirectURI == "" {
+		if config.Authentication.ShareLinks {
+			return ErrAuthShareLinksNoAuth
+		}
+
 		return nil
 	}
 
@@ -67,29 +213,578 @@ func validateAuthConfig(config *Config) error {
 	if config.Authentication.RedirectURI == "" {
 		result = multierror.Append(result, ErrAuthNoRedirect)
 	}
+
+	switch config.Authentication.Provider {
+	case AuthProviderGitLab:
+	case AuthProviderOIDC:
+		result = multierror.Append(result, validateAuthOIDCConfig(&config.Authentication))
+	default:
+		result = multierror.Append(result, ErrAuthProvider)
+	}
+
+	if config.Authentication.ShareLinks && config.Authentication.ShareLinkMaxLifetime <= 0 {
+		result = multierror.Append(result, ErrAuthShareLinkMaxLifetime)
+	}
+
+	switch config.Authentication.SessionStore {
+	case AuthSessionStoreCookie:
+	case AuthSessionStoreRedis:
+		if config.Authentication.RedisAddress == "" {
+			result = multierror.Append(result, ErrAuthRedisNoAddress)
+		}
+	default:
+		result = multierror.Append(result, ErrAuthSessionStore)
+	}
+
+	if config.Authentication.SessionMaxAge < 0 {
+		result = multierror.Append(result, ErrAuthSessionMaxAge)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateAuthOIDCConfig(auth *Auth) error {
+	var result *multierror.Error
+
+	if auth.OIDCIssuer == "" {
+		result = multierror.Append(result, ErrAuthOIDCNoIssuer)
+	}
+	if !scopeIncludes(auth.Scope, "openid") {
+		result = multierror.Append(result, ErrAuthOIDCScope)
+	}
+	if auth.OIDCClaim == "" {
+		result = multierror.Append(result, ErrAuthOIDCNoClaim)
+	}
+	if len(auth.OIDCNamespaces) == 0 {
+		result = multierror.Append(result, ErrAuthOIDCNoNamespace)
+	}
+	if _, err := auth.OIDCNamespaceMapping(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
 	return result.ErrorOrNil()
 }
 
+func scopeIncludes(scope, value string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == value {
+			return true
+		}
+	}
+
+	return false
+}
+
 func validateArtifactsServerConfig(config *Config) error {
-	if config.ArtifactsServer.URL == "" {
+	if len(config.ArtifactsServer.URLs) == 0 {
+		return nil
+	}
+
+	var result *multierror.Error
+
+	for _, rawURL := range config.ArtifactsServer.URLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+
+		// url.Parse ensures that the Scheme attribute is always lower case.
+		if u.Scheme != "http" && u.Scheme != "https" {
+			result = multierror.Append(result, ErrArtifactsServerUnsupportedScheme)
+		}
+	}
+
+	if config.ArtifactsServer.TimeoutSeconds < 1 {
+		result = multierror.Append(result, ErrArtifactsServerInvalidTimeout)
+	}
+
+	if config.ArtifactsServer.CacheTTL < 0 {
+		result = multierror.Append(result, ErrArtifactsCacheTTL)
+	}
+
+	if config.ArtifactsServer.CacheTTL > 0 && config.ArtifactsServer.CacheSize <= 0 {
+		result = multierror.Append(result, ErrArtifactsCacheSize)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateGitLabAPIVersion(config *Config) error {
+	if config.GitLab.APIVersion < 0 || config.GitLab.APIVersion > api.MaxVersion {
+		return ErrGitLabAPIVersion
+	}
+
+	return nil
+}
+
+func validateGitLabCacheConfig(config *Config) error {
+	var result *multierror.Error
+
+	cc := config.GitLab.Cache
+	if cc.CacheExpiry <= 0 || cc.EntryRefreshTimeout <= 0 || cc.CacheCleanupInterval <= 0 || cc.RetrievalTimeout <= 0 {
+		result = multierror.Append(result, ErrGitLabCacheDurations)
+	}
+
+	if cc.MaxEntries < 0 {
+		result = multierror.Append(result, ErrGitLabCacheMaxEntries)
+	}
+
+	if cc.MaxStale < 0 {
+		result = multierror.Append(result, ErrGitLabCacheMaxStale)
+	}
+
+	if cc.MaxRetrievalInterval < 0 {
+		result = multierror.Append(result, ErrGitLabRetrievalInterval)
+	}
+
+	if cc.MaxRetrievalRetries <= 0 {
+		result = multierror.Append(result, ErrGitLabRetrievalRetries)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateGitLabRemovedDomainGracePeriod(config *Config) error {
+	if config.GitLab.Cache.RemovedDomainGracePeriod < 0 {
+		return ErrGitLabRemovedDomainGracePeriod
+	}
+
+	return nil
+}
+
+func validateGitLabLookupLimits(config *Config) error {
+	var result *multierror.Error
+
+	if config.GitLab.MaxLookupSize < 0 {
+		result = multierror.Append(result, ErrGitLabLookupMaxSize)
+	}
+
+	if config.GitLab.MaxLookupPaths < 0 {
+		result = multierror.Append(result, ErrGitLabLookupMaxPaths)
+	}
+
+	if config.GitLab.Cache.LookupBatchSize < 0 {
+		result = multierror.Append(result, ErrGitLabLookupBatchSize)
+	}
+
+	if config.GitLab.Cache.LookupBatchSize > 0 && config.GitLab.Cache.LookupBatchWindow <= 0 {
+		result = multierror.Append(result, ErrGitLabLookupBatchWindow)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateGitLabAPITransport(config *Config) error {
+	switch config.GitLab.APITransport {
+	case GitLabAPITransportHTTP:
+		return nil
+	case GitLabAPITransportGRPC:
+	default:
+		return ErrGitLabAPITransport
+	}
+
+	u, err := url.Parse(config.GitLab.GRPCServer)
+	if err != nil || (u.Scheme != "grpc" && u.Scheme != "grpcs") || u.Host == "" {
+		return ErrGitLabGRPCServer
+	}
+
+	return nil
+}
+
+// validateDiskConfig refuses to start without the GitLab API, the only source
+// of the deployments when the pages-root directory is not used
+func validateDiskConfig(config *Config) error {
+	if config.GitLab.EnableDisk {
+		return nil
+	}
+
+	var result *multierror.Error
+
+	u, err := url.Parse(config.GitLab.InternalServer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		result = multierror.Append(result, ErrDiskDisabledNoGitLabServer)
+	}
+
+	if len(config.GitLab.APISecretKey) == 0 {
+		result = multierror.Append(result, ErrDiskDisabledNoAPISecret)
+	}
+
+	return result.ErrorOrNil()
+}
+
+// validateDeploymentExportConfig refuses the downloads of the archives without
+// the secret their tokens are signed with
+func validateDeploymentExportConfig(config *Config) error {
+	if config.GitLab.DeploymentExport && len(config.GitLab.APISecretKey) == 0 {
+		return ErrDeploymentExportNoAPISecret
+	}
+
+	return nil
+}
+
+func validateMirrorConfig(config *Config) error {
+	if config.Mirror.URL == "" {
+		return nil
+	}
+
+	var result *multierror.Error
+
+	u, err := url.Parse(config.Mirror.URL)
+	if err != nil {
+		result = multierror.Append(result, err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		result = multierror.Append(result, ErrMirrorUnsupportedScheme)
+	}
+
+	if config.Mirror.SamplePercentage < 0 || config.Mirror.SamplePercentage > 100 {
+		result = multierror.Append(result, ErrMirrorInvalidSamplePercentage)
+	}
+
+	if config.Mirror.Timeout <= 0 {
+		result = multierror.Append(result, ErrMirrorInvalidTimeout)
+	}
+
+	if config.Mirror.MaxInFlight <= 0 {
+		result = multierror.Append(result, ErrMirrorInvalidMaxInFlight)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateTracingConfig(config *Config) error {
+	if config.Tracing.OTLPEndpoint == "" {
 		return nil
 	}
 
-	u, err := url.Parse(config.ArtifactsServer.URL)
+	var result *multierror.Error
+
+	u, err := url.Parse(config.Tracing.OTLPEndpoint)
 	if err != nil {
-		return err
+		result = multierror.Append(result, err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		result = multierror.Append(result, ErrTracingUnsupportedScheme)
+	}
+
+	if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+		result = multierror.Append(result, ErrTracingInvalidSampleRatio)
 	}
 
+	return result.ErrorOrNil()
+}
+
+func validateZipServingConfig(config *Config) error {
 	var result *multierror.Error
 
-	// url.Parse ensures that the Scheme attribute is always lower case.
-	if u.Scheme != "http" && u.Scheme != "https" {
-		result = multierror.Append(result, ErrArtifactsServerUnsupportedScheme)
+	if config.Zip.MaxArchives < 0 {
+		result = multierror.Append(result, ErrZipCacheMaxArchives)
 	}
 
-	if config.ArtifactsServer.TimeoutSeconds < 1 {
-		result = multierror.Append(result, ErrArtifactsServerInvalidTimeout)
+	if config.Zip.MaxFiles < 0 {
+		result = multierror.Append(result, ErrZipMaxFiles)
+	}
+
+	if config.Zip.MaxPathDepth < 0 {
+		result = multierror.Append(result, ErrZipMaxPathDepth)
+	}
+
+	if config.Zip.PrefetchConcurrency < 0 {
+		result = multierror.Append(result, ErrZipPrefetchConcurrency)
+	}
+
+	if config.Zip.PrefetchConcurrency > 0 && config.Zip.PrefetchChunkSize <= 0 {
+		result = multierror.Append(result, ErrZipPrefetchChunkSize)
+	}
+
+	if config.Zip.RangeCacheDir != "" && (config.Zip.RangeCacheSize <= 0 || config.Zip.RangeCacheMaxRangeSize <= 0) {
+		result = multierror.Append(result, ErrZipRangeCacheSize)
+	}
+
+	if config.Zip.RangeFallbackSize < 0 {
+		result = multierror.Append(result, ErrZipRangeFallbackSize)
+	}
+
+	if config.Zip.ColdWorkers < 0 || config.Zip.HotWorkers < 0 {
+		result = multierror.Append(result, ErrZipWorkers)
+	}
+
+	if config.Zip.ColdQueue < 0 || config.Zip.HotQueue < 0 {
+		result = multierror.Append(result, ErrZipQueue)
+	}
+
+	if config.Zip.EgressBudget < 0 {
+		result = multierror.Append(result, ErrZipEgressBudget)
+	}
+
+	if config.Zip.EgressBudget > 0 && config.Zip.EgressBudgetWindow <= 0 {
+		result = multierror.Append(result, ErrZipEgressBudgetWindow)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateLogConfig(config *Config) error {
+	var result *multierror.Error
+
+	if config.Log.OutboundPercentage < 0 || config.Log.OutboundPercentage > 100 {
+		result = multierror.Append(result, ErrLogOutboundPercentage)
+	}
+
+	if _, _, err := config.Log.Fields(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if config.Log.FileMaxSize < 0 || config.Log.FileMaxAge < 0 || config.Log.FileMaxBackups < 0 {
+		result = multierror.Append(result, ErrLogFileRotation)
+	} else if config.Log.File == "" && (config.Log.FileMaxSize > 0 || config.Log.FileMaxAge > 0 || config.Log.FileMaxBackups > 0) {
+		result = multierror.Append(result, ErrLogFileRotationNoFile)
+	}
+
+	switch config.Log.Target {
+	case "":
+	case LogTargetSyslog:
+		if !validSyslogAddress(config.Log.SyslogAddress) {
+			result = multierror.Append(result, ErrLogSyslogAddress)
+		}
+	case LogTargetJournald:
+	default:
+		result = multierror.Append(result, ErrLogTarget)
+	}
+
+	if config.Log.Target != "" && config.Log.File != "" {
+		result = multierror.Append(result, ErrLogTargetFile)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validSyslogAddress(address string) bool {
+	u, err := url.Parse(address)
+	if err != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "udp", "tcp":
+		return u.Host != ""
+	case "unix":
+		return u.Host == "" && u.Path != ""
+	}
+
+	return false
+}
+
+func validateDiskServingConfig(config *Config) error {
+	var result *multierror.Error
+
+	if config.Disk.AttributeCacheTTL < 0 {
+		result = multierror.Append(result, ErrDiskAttributeCacheTTL)
+	}
+
+	if config.Disk.AttributeCacheTTL > 0 && config.Disk.AttributeCacheSize <= 0 {
+		result = multierror.Append(result, ErrDiskAttributeCacheSize)
+	}
+
+	if config.Disk.FileHandleCacheTTL < 0 {
+		result = multierror.Append(result, ErrDiskFileHandleCacheTTL)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateHTMLCacheConfig(config *Config) error {
+	if config.HTMLCache.TTL < 0 {
+		return ErrHTMLCacheTTL
+	}
+
+	if config.HTMLCache.TTL == 0 {
+		return nil
+	}
+
+	var result *multierror.Error
+
+	if config.HTMLCache.Size <= 0 {
+		result = multierror.Append(result, ErrHTMLCacheSize)
+	}
+
+	if config.HTMLCache.MaxFileSize <= 0 {
+		result = multierror.Append(result, ErrHTMLCacheMaxFileSize)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateCharsetConfig(config *Config) error {
+	if config.Charset.Default == "" {
+		return nil
+	}
+
+	if e, _ := charset.Lookup(config.Charset.Default); e == nil {
+		return ErrTextCharset
+	}
+
+	return nil
+}
+
+func validateAssetCacheConfig(config *Config) error {
+	if config.AssetCache.TTL < 0 {
+		return ErrAssetCacheTTL
+	}
+
+	if config.AssetCache.TTL == 0 {
+		return nil
+	}
+
+	var result *multierror.Error
+
+	if config.AssetCache.Size <= 0 {
+		result = multierror.Append(result, ErrAssetCacheSize)
+	}
+
+	if config.AssetCache.MaxFileSize <= 0 {
+		result = multierror.Append(result, ErrAssetCacheMaxFileSize)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateProxyConfig(config *Config) error {
+	var result *multierror.Error
+
+	if config.Proxy.IdleTimeout <= 0 {
+		result = multierror.Append(result, ErrProxyIdleTimeout)
+	}
+
+	if config.Proxy.MaxBytes < 0 {
+		result = multierror.Append(result, ErrProxyMaxBytes)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateRequestIDHeader(config *Config) error {
+	header := config.General.RequestIDHeader
+	if header != "" && !httpguts.ValidHeaderFieldName(header) {
+		return ErrRequestIDHeader
+	}
+
+	return nil
+}
+
+func validateSecurityHeaders(config *Config) error {
+	switch config.General.SecurityHeaders {
+	case "", SecurityHeadersOff, SecurityHeadersBasic, SecurityHeadersStrict:
+		return nil
+	default:
+		return ErrSecurityHeaders
+	}
+}
+
+func validateRequestLimits(config *Config) error {
+	var result *multierror.Error
+
+	if config.General.MaxBodyBytes < 0 {
+		result = multierror.Append(result, ErrMaxBodyBytes)
+	}
+
+	for _, method := range config.General.AllowedMethods {
+		if !httpguts.ValidHeaderFieldName(method) || method != strings.ToUpper(method) {
+			result = multierror.Append(result, ErrAllowedMethods)
+			break
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateRateLimitConfig(config *Config) error {
+	var result *multierror.Error
+
+	if _, _, err := config.RateLimit.Networks(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	if _, err := config.RateLimit.PathLimits(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateTarpitConfig(config *Config) error {
+	if config.Tarpit.Delay < 0 {
+		return ErrTarpitDelay
+	}
+
+	if config.Tarpit.Delay > 0 && config.Tarpit.MaxConcurrent <= 0 {
+		return ErrTarpitMaxConcurrent
+	}
+
+	return nil
+}
+
+func validateHTMLInjectionConfig(config *Config) error {
+	switch config.HTMLInjection.Position {
+	case HTMLInjectHead, HTMLInjectBody:
+		return nil
+	default:
+		return ErrHTMLInjectPosition
+	}
+}
+
+func validateCompressionConfig(config *Config) error {
+	if config.Compression.MinSize < 0 {
+		return ErrCompressMinSize
+	}
+
+	return nil
+}
+
+func validateCacheControlConfig(config *Config) error {
+	_, err := config.CacheControl.TypePolicies()
+
+	return err
+}
+
+func validateMIMETypesConfig(config *Config) error {
+	_, err := config.MIMETypes.Mapping()
+
+	return err
+}
+
+func validateRedirectsConfig(config *Config) error {
+	var result *multierror.Error
+
+	if config.Redirects.MaxRuleCount <= 0 {
+		result = multierror.Append(result, ErrRedirectsMaxRuleCount)
+	}
+
+	if config.Redirects.MaxPathSegments <= 0 {
+		result = multierror.Append(result, ErrRedirectsMaxPathSegments)
 	}
 
 	return result.ErrorOrNil()
 }
+
+func validateAssetManifestConfig(config *Config) error {
+	switch config.AssetManifest.Mode {
+	case AssetManifestDisabled, AssetManifestRewrite, AssetManifestRedirect:
+		return nil
+	default:
+		return ErrAssetManifestMode
+	}
+}
+
+func validateWeightConfig(config *Config) error {
+	if config.General.WeightInterval <= 0 {
+		return ErrWeightInterval
+	}
+
+	if addr := config.General.WeightAgentAddress; addr != "" {
+		if _, _, err := netutil.ParseListenAddress(addr); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrListenerOptions, addr, err)
+		}
+	}
+
+	return nil
+}
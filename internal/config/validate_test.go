@@ -2,7 +2,10 @@ package config
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -18,6 +21,24 @@ func TestConfigValidate(t *testing.T) {
 			cfg:         noListeners,
 			expectedErr: ErrNoListener,
 		},
+		{
+			name: "listener_options",
+			cfg:  listenerOptions,
+		},
+		{
+			name:        "listener_unknown_option",
+			cfg:         listenerUnknownOption,
+			expectedErr: ErrListenerOptions,
+		},
+		{
+			name: "listener_proxy_protocol",
+			cfg:  listenerProxyProtocol,
+		},
+		{
+			name:        "proxy_listener_proxy_protocol",
+			cfg:         proxyListenerProxyProtocol,
+			expectedErr: ErrListenerProxyProtocol,
+		},
 		{
 			name: "no_auth",
 			cfg:  noAuth,
@@ -47,6 +68,68 @@ func TestConfigValidate(t *testing.T) {
 			cfg:         authNoRedirect,
 			expectedErr: ErrAuthNoRedirect,
 		},
+		{
+			name:        "auth_invalid_provider",
+			cfg:         authInvalidProvider,
+			expectedErr: ErrAuthProvider,
+		},
+		{
+			name: "auth_oidc",
+			cfg:  authOIDC,
+		},
+		{
+			name:        "auth_oidc_no_issuer",
+			cfg:         authOIDCNoIssuer,
+			expectedErr: ErrAuthOIDCNoIssuer,
+		},
+		{
+			name:        "auth_oidc_no_openid_scope",
+			cfg:         authOIDCNoOpenIDScope,
+			expectedErr: ErrAuthOIDCScope,
+		},
+		{
+			name:        "auth_oidc_no_namespace",
+			cfg:         authOIDCNoNamespace,
+			expectedErr: ErrAuthOIDCNoNamespace,
+		},
+		{
+			name:        "auth_oidc_invalid_namespace",
+			cfg:         authOIDCInvalidNamespace,
+			expectedErr: ErrAuthOIDCNamespace,
+		},
+		{
+			name: "auth_share_links",
+			cfg:  authShareLinksEnabled,
+		},
+		{
+			name:        "auth_share_links_without_auth",
+			cfg:         authShareLinksWithoutAuth,
+			expectedErr: ErrAuthShareLinksNoAuth,
+		},
+		{
+			name:        "auth_share_links_no_max_lifetime",
+			cfg:         authShareLinksNoMaxLifetime,
+			expectedErr: ErrAuthShareLinkMaxLifetime,
+		},
+		{
+			name: "auth_redis_session_store",
+			cfg:  authRedisSessionStore,
+		},
+		{
+			name:        "auth_invalid_session_store",
+			cfg:         authInvalidSessionStore,
+			expectedErr: ErrAuthSessionStore,
+		},
+		{
+			name:        "auth_redis_session_store_no_address",
+			cfg:         authRedisSessionStoreNoAddress,
+			expectedErr: ErrAuthRedisNoAddress,
+		},
+		{
+			name:        "auth_negative_session_max_age",
+			cfg:         authNegativeSessionMaxAge,
+			expectedErr: ErrAuthSessionMaxAge,
+		},
 		{
 			name: "artifact_no_url",
 			cfg:  artifactsNoURL,
@@ -61,6 +144,480 @@ func TestConfigValidate(t *testing.T) {
 			cfg:         artifactsInvalidTimeout,
 			expectedErr: ErrArtifactsServerInvalidTimeout,
 		},
+		{
+			name:        "artifact_negative_cache_ttl",
+			cfg:         artifactsNegativeCacheTTL,
+			expectedErr: ErrArtifactsCacheTTL,
+		},
+		{
+			name:        "artifact_cache_without_size",
+			cfg:         artifactsCacheWithoutSize,
+			expectedErr: ErrArtifactsCacheSize,
+		},
+		{
+			name: "gitlab_api_version_pinned",
+			cfg:  gitlabAPIVersionPinned,
+		},
+		{
+			name:        "gitlab_api_version_unsupported",
+			cfg:         gitlabAPIVersionUnsupported,
+			expectedErr: ErrGitLabAPIVersion,
+		},
+		{
+			name: "gitlab_cache_max_entries",
+			cfg:  gitlabCacheMaxEntriesSet,
+		},
+		{
+			name:        "gitlab_cache_no_expiry",
+			cfg:         gitlabCacheNoExpiry,
+			expectedErr: ErrGitLabCacheDurations,
+		},
+		{
+			name:        "gitlab_cache_no_retrieval_timeout",
+			cfg:         gitlabCacheNoRetrievalTimeout,
+			expectedErr: ErrGitLabCacheDurations,
+		},
+		{
+			name:        "gitlab_cache_negative_max_entries",
+			cfg:         gitlabCacheNegativeMaxEntries,
+			expectedErr: ErrGitLabCacheMaxEntries,
+		},
+		{
+			name: "gitlab_cache_max_stale",
+			cfg:  gitlabCacheMaxStaleSet,
+		},
+		{
+			name:        "gitlab_cache_negative_max_stale",
+			cfg:         gitlabCacheNegativeMaxStale,
+			expectedErr: ErrGitLabCacheMaxStale,
+		},
+		{
+			name:        "gitlab_negative_retrieval_interval",
+			cfg:         gitlabNegativeRetrievalInterval,
+			expectedErr: ErrGitLabRetrievalInterval,
+		},
+		{
+			name:        "gitlab_no_retrieval_retries",
+			cfg:         gitlabNoRetrievalRetries,
+			expectedErr: ErrGitLabRetrievalRetries,
+		},
+		{
+			name: "gitlab_removed_domain_grace_period",
+			cfg:  gitlabRemovedDomainGracePeriodEnabled,
+		},
+		{
+			name:        "gitlab_negative_removed_domain_grace_period",
+			cfg:         gitlabNegativeRemovedDomainGracePeriod,
+			expectedErr: ErrGitLabRemovedDomainGracePeriod,
+		},
+		{
+			name:        "gitlab_negative_lookup_max_size",
+			cfg:         gitlabNegativeLookupMaxSize,
+			expectedErr: ErrGitLabLookupMaxSize,
+		},
+		{
+			name:        "gitlab_negative_lookup_max_paths",
+			cfg:         gitlabNegativeLookupMaxPaths,
+			expectedErr: ErrGitLabLookupMaxPaths,
+		},
+		{
+			name: "gitlab_lookup_batches",
+			cfg:  gitlabLookupBatches,
+		},
+		{
+			name:        "gitlab_negative_lookup_batch_size",
+			cfg:         gitlabNegativeLookupBatchSize,
+			expectedErr: ErrGitLabLookupBatchSize,
+		},
+		{
+			name:        "gitlab_lookup_batches_no_window",
+			cfg:         gitlabLookupBatchesNoWindow,
+			expectedErr: ErrGitLabLookupBatchWindow,
+		},
+		{
+			name: "gitlab_grpc_transport",
+			cfg:  gitlabGRPCTransport,
+		},
+		{
+			name:        "gitlab_unknown_api_transport",
+			cfg:         gitlabUnknownAPITransport,
+			expectedErr: ErrGitLabAPITransport,
+		},
+		{
+			name:        "gitlab_grpc_transport_no_server",
+			cfg:         gitlabGRPCTransportNoServer,
+			expectedErr: ErrGitLabGRPCServer,
+		},
+		{
+			name:        "gitlab_grpc_transport_http_server",
+			cfg:         gitlabGRPCTransportHTTPServer,
+			expectedErr: ErrGitLabGRPCServer,
+		},
+		{
+			name: "disk_disabled",
+			cfg:  diskDisabled,
+		},
+		{
+			name:        "disk_disabled_no_gitlab_server",
+			cfg:         diskDisabledNoGitLabServer,
+			expectedErr: ErrDiskDisabledNoGitLabServer,
+		},
+		{
+			name:        "disk_disabled_no_api_secret",
+			cfg:         diskDisabledNoAPISecret,
+			expectedErr: ErrDiskDisabledNoAPISecret,
+		},
+		{
+			name: "deployment_export_enabled",
+			cfg:  deploymentExportEnabled,
+		},
+		{
+			name:        "deployment_export_no_api_secret",
+			cfg:         deploymentExportNoAPISecret,
+			expectedErr: ErrDeploymentExportNoAPISecret,
+		},
+		{
+			name:        "zip_negative_cache_max_archives",
+			cfg:         zipNegativeCacheMaxArchives,
+			expectedErr: ErrZipCacheMaxArchives,
+		},
+		{
+			name:        "zip_negative_max_files",
+			cfg:         zipNegativeMaxFiles,
+			expectedErr: ErrZipMaxFiles,
+		},
+		{
+			name:        "zip_negative_max_path_depth",
+			cfg:         zipNegativeMaxPathDepth,
+			expectedErr: ErrZipMaxPathDepth,
+		},
+		{
+			name:        "zip_negative_prefetch_concurrency",
+			cfg:         zipNegativePrefetchConcurrency,
+			expectedErr: ErrZipPrefetchConcurrency,
+		},
+		{
+			name:        "zip_prefetch_without_chunk_size",
+			cfg:         zipPrefetchWithoutChunkSize,
+			expectedErr: ErrZipPrefetchChunkSize,
+		},
+		{
+			name:        "zip_range_cache_without_size",
+			cfg:         zipRangeCacheWithoutSize,
+			expectedErr: ErrZipRangeCacheSize,
+		},
+		{
+			name:        "zip_negative_range_fallback_size",
+			cfg:         zipNegativeRangeFallbackSize,
+			expectedErr: ErrZipRangeFallbackSize,
+		},
+		{
+			name:        "zip_negative_hot_workers",
+			cfg:         zipNegativeHotWorkers,
+			expectedErr: ErrZipWorkers,
+		},
+		{
+			name:        "zip_negative_cold_queue",
+			cfg:         zipNegativeColdQueue,
+			expectedErr: ErrZipQueue,
+		},
+		{
+			name: "zip_egress_budget",
+			cfg:  zipEgressBudgetEnabled,
+		},
+		{
+			name:        "zip_negative_egress_budget",
+			cfg:         zipNegativeEgressBudget,
+			expectedErr: ErrZipEgressBudget,
+		},
+		{
+			name:        "zip_egress_budget_without_window",
+			cfg:         zipEgressBudgetWithoutWindow,
+			expectedErr: ErrZipEgressBudgetWindow,
+		},
+		{
+			name: "mirror_enabled",
+			cfg:  mirrorEnabled,
+		},
+		{
+			name:        "mirror_malformed_scheme",
+			cfg:         mirrorMalformedScheme,
+			expectedErr: ErrMirrorUnsupportedScheme,
+		},
+		{
+			name:        "mirror_invalid_sample_percentage",
+			cfg:         mirrorInvalidSamplePercentage,
+			expectedErr: ErrMirrorInvalidSamplePercentage,
+		},
+		{
+			name:        "mirror_invalid_timeout",
+			cfg:         mirrorInvalidTimeout,
+			expectedErr: ErrMirrorInvalidTimeout,
+		},
+		{
+			name:        "mirror_invalid_max_in_flight",
+			cfg:         mirrorInvalidMaxInFlight,
+			expectedErr: ErrMirrorInvalidMaxInFlight,
+		},
+		{
+			name: "tracing_enabled",
+			cfg:  tracingEnabled,
+		},
+		{
+			name:        "tracing_malformed_scheme",
+			cfg:         tracingMalformedScheme,
+			expectedErr: ErrTracingUnsupportedScheme,
+		},
+		{
+			name:        "tracing_invalid_sample_ratio",
+			cfg:         tracingInvalidSampleRatio,
+			expectedErr: ErrTracingInvalidSampleRatio,
+		},
+		{
+			name: "log_outbound_enabled",
+			cfg:  logOutboundEnabled,
+		},
+		{
+			name:        "log_outbound_invalid_percentage",
+			cfg:         logOutboundInvalidPercentage,
+			expectedErr: ErrLogOutboundPercentage,
+		},
+		{
+			name: "log_fields",
+			cfg:  logFields,
+		},
+		{
+			name:        "log_field_map_without_name",
+			cfg:         logFieldMapWithoutName,
+			expectedErr: ErrLogFieldMap,
+		},
+		{
+			name:        "log_static_field_without_value",
+			cfg:         logStaticFieldWithoutValue,
+			expectedErr: ErrLogStaticField,
+		},
+		{
+			name: "log_file_rotated",
+			cfg:  logFileRotated,
+		},
+		{
+			name:        "log_file_negative_max_age",
+			cfg:         logFileNegativeMaxAge,
+			expectedErr: ErrLogFileRotation,
+		},
+		{
+			name:        "log_file_rotation_without_file",
+			cfg:         logFileRotationWithoutFile,
+			expectedErr: ErrLogFileRotationNoFile,
+		},
+		{
+			name: "log_target_syslog",
+			cfg:  logTargetSyslog,
+		},
+		{
+			name: "log_target_journald",
+			cfg:  logTargetJournald,
+		},
+		{
+			name:        "log_target_invalid",
+			cfg:         logTargetInvalid,
+			expectedErr: ErrLogTarget,
+		},
+		{
+			name:        "log_target_with_file",
+			cfg:         logTargetWithFile,
+			expectedErr: ErrLogTargetFile,
+		},
+		{
+			name:        "log_syslog_invalid_address",
+			cfg:         logSyslogInvalidAddress,
+			expectedErr: ErrLogSyslogAddress,
+		},
+		{
+			name: "disk_attribute_cache_enabled",
+			cfg:  diskAttributeCacheEnabled,
+		},
+		{
+			name:        "disk_negative_attribute_cache_ttl",
+			cfg:         diskNegativeAttributeCacheTTL,
+			expectedErr: ErrDiskAttributeCacheTTL,
+		},
+		{
+			name:        "disk_attribute_cache_no_size",
+			cfg:         diskAttributeCacheNoSize,
+			expectedErr: ErrDiskAttributeCacheSize,
+		},
+		{
+			name:        "disk_negative_file_handle_cache_ttl",
+			cfg:         diskNegativeFileHandleCacheTTL,
+			expectedErr: ErrDiskFileHandleCacheTTL,
+		},
+		{
+			name: "html_cache_enabled",
+			cfg:  htmlCacheEnabled,
+		},
+		{
+			name:        "html_cache_negative_ttl",
+			cfg:         htmlCacheNegativeTTL,
+			expectedErr: ErrHTMLCacheTTL,
+		},
+		{
+			name:        "html_cache_no_size",
+			cfg:         htmlCacheNoSize,
+			expectedErr: ErrHTMLCacheSize,
+		},
+		{
+			name:        "html_cache_no_max_file_size",
+			cfg:         htmlCacheNoMaxFileSize,
+			expectedErr: ErrHTMLCacheMaxFileSize,
+		},
+		{
+			name: "text_charset_alias",
+			cfg:  textCharsetAlias,
+		},
+		{
+			name: "text_charset_none",
+			cfg:  textCharsetNone,
+		},
+		{
+			name:        "text_charset_unknown",
+			cfg:         textCharsetUnknown,
+			expectedErr: ErrTextCharset,
+		},
+		{
+			name:        "request_id_header_invalid",
+			cfg:         requestIDHeaderInvalid,
+			expectedErr: ErrRequestIDHeader,
+		},
+		{
+			name:        "max_body_bytes_negative",
+			cfg:         maxBodyBytesNegative,
+			expectedErr: ErrMaxBodyBytes,
+		},
+		{
+			name:        "allowed_methods_lowercase",
+			cfg:         allowedMethodsLowercase,
+			expectedErr: ErrAllowedMethods,
+		},
+		{
+			name:        "allowed_methods_invalid",
+			cfg:         allowedMethodsInvalid,
+			expectedErr: ErrAllowedMethods,
+		},
+		{
+			name:        "security_headers_unknown",
+			cfg:         securityHeadersUnknown,
+			expectedErr: ErrSecurityHeaders,
+		},
+		{
+			name:        "rate_limit_invalid_allowed_network",
+			cfg:         rateLimitInvalidAllowedNetwork,
+			expectedErr: ErrRateLimitSourceIPAllow,
+		},
+		{
+			name:        "rate_limit_invalid_denied_network",
+			cfg:         rateLimitInvalidDeniedNetwork,
+			expectedErr: ErrRateLimitSourceIPDeny,
+		},
+		{
+			name:        "rate_limit_path_without_burst",
+			cfg:         rateLimitPathWithoutBurst,
+			expectedErr: ErrRateLimitPath,
+		},
+		{
+			name:        "rate_limit_path_relative_pattern",
+			cfg:         rateLimitPathRelativePattern,
+			expectedErr: ErrRateLimitPath,
+		},
+		{
+			name:        "tarpit_negative_delay",
+			cfg:         tarpitNegativeDelay,
+			expectedErr: ErrTarpitDelay,
+		},
+		{
+			name:        "tarpit_no_max_concurrent",
+			cfg:         tarpitNoMaxConcurrent,
+			expectedErr: ErrTarpitMaxConcurrent,
+		},
+		{
+			name:        "html_inject_invalid_position",
+			cfg:         htmlInjectInvalidPosition,
+			expectedErr: ErrHTMLInjectPosition,
+		},
+		{
+			name:        "compress_negative_min_size",
+			cfg:         compressNegativeMinSize,
+			expectedErr: ErrCompressMinSize,
+		},
+		{
+			name:        "cache_control_invalid_type",
+			cfg:         cacheControlInvalidType,
+			expectedErr: ErrCacheControlType,
+		},
+		{
+			name:        "mime_type_without_dot",
+			cfg:         mimeTypeWithoutDot,
+			expectedErr: ErrMIMEType,
+		},
+		{
+			name:        "mime_type_invalid_media_type",
+			cfg:         mimeTypeInvalidMediaType,
+			expectedErr: ErrMIMEType,
+		},
+		{
+			name:        "asset_manifest_invalid_mode",
+			cfg:         assetManifestInvalidMode,
+			expectedErr: ErrAssetManifestMode,
+		},
+		{
+			name:        "weight_no_interval",
+			cfg:         weightNoInterval,
+			expectedErr: ErrWeightInterval,
+		},
+		{
+			name:        "weight_agent_invalid_options",
+			cfg:         weightAgentInvalidOptions,
+			expectedErr: ErrListenerOptions,
+		},
+		{
+			name:        "proxy_no_idle_timeout",
+			cfg:         proxyNoIdleTimeout,
+			expectedErr: ErrProxyIdleTimeout,
+		},
+		{
+			name:        "proxy_negative_max_bytes",
+			cfg:         proxyNegativeMaxBytes,
+			expectedErr: ErrProxyMaxBytes,
+		},
+		{
+			name:        "redirects_no_max_rule_count",
+			cfg:         redirectsNoMaxRuleCount,
+			expectedErr: ErrRedirectsMaxRuleCount,
+		},
+		{
+			name:        "redirects_no_max_path_segments",
+			cfg:         redirectsNoMaxPathSegments,
+			expectedErr: ErrRedirectsMaxPathSegments,
+		},
+		{
+			name: "asset_cache_enabled",
+			cfg:  assetCacheEnabled,
+		},
+		{
+			name:        "asset_cache_negative_ttl",
+			cfg:         assetCacheNegativeTTL,
+			expectedErr: ErrAssetCacheTTL,
+		},
+		{
+			name:        "asset_cache_no_size",
+			cfg:         assetCacheNoSize,
+			expectedErr: ErrAssetCacheSize,
+		},
+		{
+			name:        "asset_cache_no_max_file_size",
+			cfg:         assetCacheNoMaxFileSize,
+			expectedErr: ErrAssetCacheMaxFileSize,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -84,6 +641,23 @@ func noListeners(cfg *Config) {
 	cfg.ListenHTTPSProxyv2Strings = MultiStringFlag{separator: ","}
 }
 
+func listenerOptions(cfg *Config) {
+	cfg.ListenHTTPStrings = MultiStringFlag{value: []string{"[::]:80?network=tcp6&reuseport=true&fastopen=256"}, separator: ","}
+}
+
+func listenerUnknownOption(cfg *Config) {
+	cfg.ListenHTTPSStrings = MultiStringFlag{value: []string{"0.0.0.0:443?backlog=1024"}, separator: ","}
+}
+
+func listenerProxyProtocol(cfg *Config) {
+	cfg.ListenHTTPStrings = MultiStringFlag{value: []string{"0.0.0.0:80?proxyprotocol=true"}, separator: ","}
+	cfg.ListenHTTPSStrings = MultiStringFlag{value: []string{"0.0.0.0:443?proxyprotocol=true"}, separator: ","}
+}
+
+func proxyListenerProxyProtocol(cfg *Config) {
+	cfg.ListenHTTPSProxyv2Strings = MultiStringFlag{value: []string{"0.0.0.0:8443?proxyprotocol=true"}, separator: ","}
+}
+
 func noAuth(cfg *Config) {
 	cfg.Authentication = Auth{}
 }
@@ -108,26 +682,538 @@ func authNoRedirect(cfg *Config) {
 	cfg.Authentication.RedirectURI = ""
 }
 
+func authInvalidProvider(cfg *Config) {
+	cfg.Authentication.Provider = "saml"
+}
+
+func authOIDC(cfg *Config) {
+	cfg.Authentication.Provider = AuthProviderOIDC
+	cfg.Authentication.Scope = "openid groups"
+	cfg.Authentication.OIDCIssuer = "https://idp.example.com"
+	cfg.Authentication.OIDCClaim = "groups"
+	cfg.Authentication.OIDCNamespaces = []string{"cn=admins,dc=example=group"}
+}
+
+func authOIDCNoIssuer(cfg *Config) {
+	authOIDC(cfg)
+	cfg.Authentication.OIDCIssuer = ""
+}
+
+func authOIDCNoOpenIDScope(cfg *Config) {
+	authOIDC(cfg)
+	cfg.Authentication.Scope = "api"
+}
+
+func authOIDCNoNamespace(cfg *Config) {
+	authOIDC(cfg)
+	cfg.Authentication.OIDCNamespaces = nil
+}
+
+func authOIDCInvalidNamespace(cfg *Config) {
+	authOIDC(cfg)
+	cfg.Authentication.OIDCNamespaces = []string{"admins="}
+}
+
+func authShareLinksEnabled(cfg *Config) {
+	cfg.Authentication.ShareLinks = true
+	cfg.Authentication.ShareLinkMaxLifetime = time.Hour
+}
+
+func authShareLinksWithoutAuth(cfg *Config) {
+	noAuth(cfg)
+	authShareLinksEnabled(cfg)
+}
+
+func authShareLinksNoMaxLifetime(cfg *Config) {
+	authShareLinksEnabled(cfg)
+	cfg.Authentication.ShareLinkMaxLifetime = 0
+}
+
+func authRedisSessionStore(cfg *Config) {
+	cfg.Authentication.SessionStore = AuthSessionStoreRedis
+	cfg.Authentication.RedisAddress = "localhost:6379"
+}
+
+func authInvalidSessionStore(cfg *Config) {
+	cfg.Authentication.SessionStore = "memcached"
+}
+
+func authRedisSessionStoreNoAddress(cfg *Config) {
+	authRedisSessionStore(cfg)
+	cfg.Authentication.RedisAddress = ""
+}
+
+func authNegativeSessionMaxAge(cfg *Config) {
+	cfg.Authentication.SessionMaxAge = -time.Hour
+}
+
 func artifactsNoURL(cfg *Config) {
-	cfg.ArtifactsServer.URL = ""
+	cfg.ArtifactsServer.URLs = nil
 }
 
 func artifactsMalformedScheme(cfg *Config) {
-	cfg.ArtifactsServer.URL = "foo://example.com"
+	cfg.ArtifactsServer.URLs = []string{"https://example.com", "foo://example.com"}
 }
 
 func artifactsInvalidTimeout(cfg *Config) {
 	cfg.ArtifactsServer.TimeoutSeconds = -1
 }
 
+func artifactsNegativeCacheTTL(cfg *Config) {
+	cfg.ArtifactsServer.CacheTTL = -time.Minute
+}
+
+func artifactsCacheWithoutSize(cfg *Config) {
+	cfg.ArtifactsServer.CacheTTL = time.Minute
+	cfg.ArtifactsServer.CacheSize = 0
+}
+
+func gitlabAPIVersionPinned(cfg *Config) {
+	cfg.GitLab.APIVersion = 1
+}
+
+func gitlabAPIVersionUnsupported(cfg *Config) {
+	cfg.GitLab.APIVersion = 100
+}
+
+func gitlabCacheMaxEntriesSet(cfg *Config) {
+	cfg.GitLab.Cache.MaxEntries = 100000
+}
+
+func gitlabCacheNoExpiry(cfg *Config) {
+	cfg.GitLab.Cache.CacheExpiry = 0
+}
+
+func gitlabCacheNoRetrievalTimeout(cfg *Config) {
+	cfg.GitLab.Cache.RetrievalTimeout = 0
+}
+
+func gitlabCacheNegativeMaxEntries(cfg *Config) {
+	cfg.GitLab.Cache.MaxEntries = -1
+}
+
+func gitlabCacheMaxStaleSet(cfg *Config) {
+	cfg.GitLab.Cache.MaxStale = time.Hour
+}
+
+func gitlabCacheNegativeMaxStale(cfg *Config) {
+	cfg.GitLab.Cache.MaxStale = -time.Second
+}
+
+func gitlabNegativeRetrievalInterval(cfg *Config) {
+	cfg.GitLab.Cache.MaxRetrievalInterval = -time.Second
+}
+
+func gitlabNoRetrievalRetries(cfg *Config) {
+	cfg.GitLab.Cache.MaxRetrievalRetries = 0
+}
+
+func gitlabRemovedDomainGracePeriodEnabled(cfg *Config) {
+	cfg.GitLab.Cache.RemovedDomainGracePeriod = time.Hour
+}
+
+func gitlabNegativeRemovedDomainGracePeriod(cfg *Config) {
+	cfg.GitLab.Cache.RemovedDomainGracePeriod = -time.Second
+}
+
+func gitlabNegativeLookupMaxSize(cfg *Config) {
+	cfg.GitLab.MaxLookupSize = -1
+}
+
+func gitlabNegativeLookupMaxPaths(cfg *Config) {
+	cfg.GitLab.MaxLookupPaths = -1
+}
+
+func gitlabLookupBatches(cfg *Config) {
+	cfg.GitLab.Cache.LookupBatchSize = 50
+	cfg.GitLab.Cache.LookupBatchWindow = 10 * time.Millisecond
+}
+
+func gitlabNegativeLookupBatchSize(cfg *Config) {
+	cfg.GitLab.Cache.LookupBatchSize = -1
+}
+
+func gitlabLookupBatchesNoWindow(cfg *Config) {
+	gitlabLookupBatches(cfg)
+	cfg.GitLab.Cache.LookupBatchWindow = 0
+}
+
+func gitlabGRPCTransport(cfg *Config) {
+	cfg.GitLab.APITransport = GitLabAPITransportGRPC
+	cfg.GitLab.GRPCServer = "grpcs://gitlab.example.com:8155"
+}
+
+func gitlabUnknownAPITransport(cfg *Config) {
+	cfg.GitLab.APITransport = "websocket"
+}
+
+func gitlabGRPCTransportNoServer(cfg *Config) {
+	cfg.GitLab.APITransport = GitLabAPITransportGRPC
+}
+
+func gitlabGRPCTransportHTTPServer(cfg *Config) {
+	gitlabGRPCTransport(cfg)
+	cfg.GitLab.GRPCServer = "https://gitlab.example.com"
+}
+
+func diskDisabled(cfg *Config) {
+	cfg.GitLab.EnableDisk = false
+	cfg.GitLab.InternalServer = "https://gitlab.example.com"
+	cfg.GitLab.APISecretKey = []byte("secret")
+}
+
+func diskDisabledNoGitLabServer(cfg *Config) {
+	diskDisabled(cfg)
+	cfg.GitLab.InternalServer = ""
+}
+
+func diskDisabledNoAPISecret(cfg *Config) {
+	diskDisabled(cfg)
+	cfg.GitLab.APISecretKey = nil
+}
+
+func deploymentExportEnabled(cfg *Config) {
+	cfg.GitLab.DeploymentExport = true
+	cfg.GitLab.APISecretKey = []byte("secret")
+}
+
+func deploymentExportNoAPISecret(cfg *Config) {
+	deploymentExportEnabled(cfg)
+	cfg.GitLab.APISecretKey = nil
+}
+
+func zipNegativeCacheMaxArchives(cfg *Config) {
+	cfg.Zip.MaxArchives = -1
+}
+
+func zipNegativeMaxFiles(cfg *Config) {
+	cfg.Zip.MaxFiles = -1
+}
+
+func zipNegativeMaxPathDepth(cfg *Config) {
+	cfg.Zip.MaxPathDepth = -1
+}
+
+func zipNegativePrefetchConcurrency(cfg *Config) {
+	cfg.Zip.PrefetchConcurrency = -1
+}
+
+func zipPrefetchWithoutChunkSize(cfg *Config) {
+	cfg.Zip.PrefetchConcurrency = 4
+	cfg.Zip.PrefetchChunkSize = 0
+}
+
+func zipRangeCacheWithoutSize(cfg *Config) {
+	cfg.Zip.RangeCacheDir = "/tmp/ranges"
+	cfg.Zip.RangeCacheSize = 0
+}
+
+func zipNegativeRangeFallbackSize(cfg *Config) {
+	cfg.Zip.RangeFallbackSize = -1
+}
+
+func zipNegativeHotWorkers(cfg *Config) {
+	cfg.Zip.HotWorkers = -1
+}
+
+func zipNegativeColdQueue(cfg *Config) {
+	cfg.Zip.ColdQueue = -1
+}
+
+func zipEgressBudgetEnabled(cfg *Config) {
+	cfg.Zip.EgressBudget = 100 * 1024 * 1024 * 1024
+	cfg.Zip.EgressBudgetWindow = time.Hour
+}
+
+func zipNegativeEgressBudget(cfg *Config) {
+	cfg.Zip.EgressBudget = -1
+}
+
+func zipEgressBudgetWithoutWindow(cfg *Config) {
+	cfg.Zip.EgressBudget = 1
+}
+
+func mirrorEnabled(cfg *Config) {
+	cfg.Mirror = Mirror{
+		URL:              "http://pages-canary.example.com",
+		SamplePercentage: 10,
+		Timeout:          time.Second,
+		MaxInFlight:      10,
+	}
+}
+
+func mirrorMalformedScheme(cfg *Config) {
+	mirrorEnabled(cfg)
+	cfg.Mirror.URL = "foo://pages-canary.example.com"
+}
+
+func mirrorInvalidSamplePercentage(cfg *Config) {
+	mirrorEnabled(cfg)
+	cfg.Mirror.SamplePercentage = 101
+}
+
+func mirrorInvalidTimeout(cfg *Config) {
+	mirrorEnabled(cfg)
+	cfg.Mirror.Timeout = 0
+}
+
+func mirrorInvalidMaxInFlight(cfg *Config) {
+	mirrorEnabled(cfg)
+	cfg.Mirror.MaxInFlight = 0
+}
+
+func tracingEnabled(cfg *Config) {
+	cfg.Tracing = Tracing{
+		OTLPEndpoint: "http://localhost:4318",
+		SampleRatio:  0.5,
+	}
+}
+
+func tracingMalformedScheme(cfg *Config) {
+	tracingEnabled(cfg)
+	cfg.Tracing.OTLPEndpoint = "grpc://localhost:4317"
+}
+
+func tracingInvalidSampleRatio(cfg *Config) {
+	tracingEnabled(cfg)
+	cfg.Tracing.SampleRatio = 1.5
+}
+
+func logOutboundEnabled(cfg *Config) {
+	cfg.Log.OutboundPercentage = 100
+}
+
+func logOutboundInvalidPercentage(cfg *Config) {
+	cfg.Log.OutboundPercentage = 101
+}
+
+func logFileRotated(cfg *Config) {
+	cfg.Log.File = "/var/log/gitlab-pages/current"
+	cfg.Log.FileMaxSize = 100 * 1024 * 1024
+	cfg.Log.FileMaxAge = 24 * time.Hour
+	cfg.Log.FileMaxBackups = 7
+}
+
+func logFileNegativeMaxAge(cfg *Config) {
+	logFileRotated(cfg)
+	cfg.Log.FileMaxAge = -time.Hour
+}
+
+func logFileRotationWithoutFile(cfg *Config) {
+	logFileRotated(cfg)
+	cfg.Log.File = ""
+}
+
+func logTargetSyslog(cfg *Config) {
+	cfg.Log.Target = LogTargetSyslog
+	cfg.Log.SyslogAddress = "tcp://syslog.example.com:601"
+}
+
+func logTargetJournald(cfg *Config) {
+	cfg.Log.Target = LogTargetJournald
+}
+
+func logTargetInvalid(cfg *Config) {
+	cfg.Log.Target = "stdout"
+}
+
+func logTargetWithFile(cfg *Config) {
+	logTargetJournald(cfg)
+	cfg.Log.File = "/var/log/gitlab-pages/current"
+}
+
+func logSyslogInvalidAddress(cfg *Config) {
+	logTargetSyslog(cfg)
+	cfg.Log.SyslogAddress = "syslog.example.com:514"
+}
+
+func logFields(cfg *Config) {
+	cfg.Log.FieldMap = []string{"msg=message", "pages_host=url.domain"}
+	cfg.Log.StaticFields = []string{"datacenter=eu-west-1", "labels=role=edge"}
+}
+
+func logFieldMapWithoutName(cfg *Config) {
+	cfg.Log.FieldMap = []string{"msg"}
+}
+
+func logStaticFieldWithoutValue(cfg *Config) {
+	cfg.Log.StaticFields = []string{"datacenter="}
+}
+
+func diskAttributeCacheEnabled(cfg *Config) {
+	cfg.Disk.AttributeCacheTTL = time.Second
+	cfg.Disk.AttributeCacheSize = 100
+	cfg.Disk.FileHandleCacheTTL = time.Second
+}
+
+func diskNegativeAttributeCacheTTL(cfg *Config) {
+	cfg.Disk.AttributeCacheTTL = -time.Second
+}
+
+func diskAttributeCacheNoSize(cfg *Config) {
+	cfg.Disk.AttributeCacheTTL = time.Second
+	cfg.Disk.AttributeCacheSize = 0
+}
+
+func diskNegativeFileHandleCacheTTL(cfg *Config) {
+	cfg.Disk.FileHandleCacheTTL = -time.Second
+}
+
+func textCharsetAlias(cfg *Config) {
+	cfg.Charset.Default = "latin1"
+}
+
+func textCharsetNone(cfg *Config) {
+	cfg.Charset.Default = ""
+}
+
+func textCharsetUnknown(cfg *Config) {
+	cfg.Charset.Default = "klingon"
+}
+
+func htmlCacheEnabled(cfg *Config) {
+	cfg.HTMLCache.TTL = time.Minute
+	cfg.HTMLCache.Size = 100
+	cfg.HTMLCache.MaxFileSize = 1024
+}
+
+func htmlCacheNegativeTTL(cfg *Config) {
+	cfg.HTMLCache.TTL = -time.Minute
+}
+
+func htmlCacheNoSize(cfg *Config) {
+	htmlCacheEnabled(cfg)
+	cfg.HTMLCache.Size = 0
+}
+
+func htmlCacheNoMaxFileSize(cfg *Config) {
+	htmlCacheEnabled(cfg)
+	cfg.HTMLCache.MaxFileSize = 0
+}
+
+func requestIDHeaderInvalid(cfg *Config) {
+	cfg.General.RequestIDHeader = "X Request Id"
+}
+
+func maxBodyBytesNegative(cfg *Config) {
+	cfg.General.MaxBodyBytes = -1
+}
+
+func allowedMethodsLowercase(cfg *Config) {
+	cfg.General.AllowedMethods = []string{"GET", "post"}
+}
+
+func allowedMethodsInvalid(cfg *Config) {
+	cfg.General.AllowedMethods = []string{"GET HEAD"}
+}
+
+func securityHeadersUnknown(cfg *Config) {
+	cfg.General.SecurityHeaders = "paranoid"
+}
+
+func rateLimitInvalidAllowedNetwork(cfg *Config) {
+	cfg.RateLimit.SourceIPAllowlist = []string{"10.0.0.0/8", "10.0.0.0/33"}
+}
+
+func rateLimitInvalidDeniedNetwork(cfg *Config) {
+	cfg.RateLimit.SourceIPDenylist = []string{"example.com"}
+}
+
+func rateLimitPathWithoutBurst(cfg *Config) {
+	cfg.RateLimit.PathRules = []string{"/*.zip=1"}
+}
+
+func rateLimitPathRelativePattern(cfg *Config) {
+	cfg.RateLimit.PathRules = []string{"*.zip=1:5"}
+}
+
+func tarpitNegativeDelay(cfg *Config) {
+	cfg.Tarpit.Delay = -time.Second
+}
+
+func tarpitNoMaxConcurrent(cfg *Config) {
+	cfg.Tarpit = Tarpit{Delay: time.Second}
+}
+
+func htmlInjectInvalidPosition(cfg *Config) {
+	cfg.HTMLInjection.Position = "html"
+}
+
+func compressNegativeMinSize(cfg *Config) {
+	cfg.Compression = Compression{Enabled: true, MinSize: -1}
+}
+
+func cacheControlInvalidType(cfg *Config) {
+	cfg.CacheControl.Types = []string{"text/html=no-cache", "html=no-cache"}
+}
+
+func mimeTypeWithoutDot(cfg *Config) {
+	cfg.MIMETypes.Extensions = []string{"avif=image/avif"}
+}
+
+func mimeTypeInvalidMediaType(cfg *Config) {
+	cfg.MIMETypes.Extensions = []string{".avif=avif"}
+}
+
+func assetManifestInvalidMode(cfg *Config) {
+	cfg.AssetManifest.Mode = "rename"
+}
+
+func weightNoInterval(cfg *Config) {
+	cfg.General.WeightInterval = 0
+}
+
+func weightAgentInvalidOptions(cfg *Config) {
+	cfg.General.WeightAgentAddress = "127.0.0.1:5555?network=udp"
+}
+
+func proxyNoIdleTimeout(cfg *Config) {
+	cfg.Proxy.IdleTimeout = 0
+}
+
+func proxyNegativeMaxBytes(cfg *Config) {
+	cfg.Proxy.MaxBytes = -1
+}
+
+func redirectsNoMaxRuleCount(cfg *Config) {
+	cfg.Redirects.MaxRuleCount = 0
+}
+
+func redirectsNoMaxPathSegments(cfg *Config) {
+	cfg.Redirects.MaxPathSegments = 0
+}
+
+func assetCacheEnabled(cfg *Config) {
+	cfg.AssetCache.TTL = time.Minute
+	cfg.AssetCache.Size = 100
+	cfg.AssetCache.MaxFileSize = 1024
+}
+
+func assetCacheNegativeTTL(cfg *Config) {
+	cfg.AssetCache.TTL = -time.Minute
+}
+
+func assetCacheNoSize(cfg *Config) {
+	assetCacheEnabled(cfg)
+	cfg.AssetCache.Size = 0
+}
+
+func assetCacheNoMaxFileSize(cfg *Config) {
+	assetCacheEnabled(cfg)
+	cfg.AssetCache.MaxFileSize = 0
+}
+
 func validConfig() Config {
 	cfg := Config{
 		ListenHTTPStrings: MultiStringFlag{
 			value:     []string{"127.0.0.1:80"},
 			separator: ",",
 		},
+		General: General{
+			WeightInterval: 10 * time.Second,
+		},
 		ArtifactsServer: ArtifactsServer{
-			URL:            "https://example.com",
+			URLs:           []string{"https://example.com"},
 			TimeoutSeconds: 1,
 		},
 		Authentication: Auth{
@@ -135,11 +1221,78 @@ func validConfig() Config {
 			ClientID:     "bar",
 			ClientSecret: "bar-secret",
 			RedirectURI:  "https://example.com",
+			Provider:     AuthProviderGitLab,
+			SessionStore: AuthSessionStoreCookie,
+		},
+		Proxy: Proxy{
+			IdleTimeout: time.Minute,
+		},
+		HTMLInjection: HTMLInjection{
+			Position: HTMLInjectHead,
+		},
+		Redirects: Redirects{
+			MaxRuleCount:    1000,
+			MaxPathSegments: 25,
+		},
+		AssetManifest: AssetManifest{
+			Mode: AssetManifestRewrite,
 		},
 		GitLab: GitLab{
 			PublicServer: "https://gitlab.example.com",
+			EnableDisk:   true,
+			APITransport: GitLabAPITransportHTTP,
+			Cache: Cache{
+				CacheExpiry:          10 * time.Minute,
+				CacheCleanupInterval: time.Minute,
+				EntryRefreshTimeout:  time.Minute,
+				RetrievalTimeout:     30 * time.Second,
+				MaxRetrievalInterval: time.Second,
+				MaxRetrievalRetries:  3,
+			},
 		},
 	}
 
 	return cfg
 }
+
+func TestRateLimitNetworks(t *testing.T) {
+	rl := RateLimit{
+		SourceIPAllowlist: []string{"10.0.0.0/8", " 192.168.1.1"},
+		SourceIPDenylist:  []string{"2001:db8::/32", "2001:db8::1"},
+	}
+
+	allowed, denied, err := rl.Networks()
+	require.NoError(t, err)
+
+	require.Equal(t, "10.0.0.0/8", allowed[0].String())
+	require.Equal(t, "192.168.1.1/32", allowed[1].String())
+	require.Equal(t, "2001:db8::/32", denied[0].String())
+	require.Equal(t, "2001:db8::1/128", denied[1].String())
+}
+
+func TestRateLimitPathLimits(t *testing.T) {
+	rl := RateLimit{PathRules: []string{"/*.zip=0.5:5", " /api/* = 10 : 20 "}}
+
+	limits, err := rl.PathLimits()
+	require.NoError(t, err)
+	require.Equal(t, []RateLimitPath{
+		{Pattern: "/*.zip", LimitPerSecond: 0.5, Burst: 5},
+		{Pattern: "/api/*", LimitPerSecond: 10, Burst: 20},
+	}, limits)
+
+	for _, rule := range []string{"/*.zip=0:5", "/*.zip=1:0", "/*.zip=a:1", "=1:1"} {
+		rl := RateLimit{PathRules: []string{rule}}
+
+		_, err := rl.PathLimits()
+		require.ErrorIs(t, err, ErrRateLimitPath, rule)
+	}
+}
+
+func TestReadRateLimitPathFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules")
+	require.NoError(t, os.WriteFile(path, []byte("# downloads\n/*.zip=1:5\n\n  /api/*=10:20\n"), 0600))
+
+	rules, err := readRateLimitPathFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/*.zip=1:5", "/api/*=10:20"}, rules)
+}
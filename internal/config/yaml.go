@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/namsral/flag"
+	"gopkg.in/yaml.v3"
+)
+
+// loadYAMLFile sets the flags of the CommandLine from the YAML config file at
+// path, when it is not empty
+func loadYAMLFile(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := applyYAML(flag.CommandLine, data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+// applyYAML sets the flags of fs from the YAML document in data. The keys of
+// nested sections are joined with a "-" into the flag names, so that
+//
+//	tls:
+//	  min-version: tls1.2
+//
+// sets -tls-min-version. A list sets a flag once per item. The flags already
+// set, from the command line, the environment or the -config file, are kept.
+func applyYAML(fs *flag.FlagSet, data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	return applyYAMLNode(fs, set, "", doc.Content[0])
+}
+
+func applyYAMLNode(fs *flag.FlagSet, set map[string]bool, name string, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if name != "" {
+				key = name + "-" + key
+			}
+
+			if err := applyYAMLNode(fs, set, key, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: the items of %q must be values", item.Line, name)
+			}
+
+			if err := setYAMLFlag(fs, set, name, item); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case yaml.ScalarNode:
+		return setYAMLFlag(fs, set, name, node)
+	default:
+		return fmt.Errorf("line %d: unsupported value of %q", node.Line, name)
+	}
+}
+
+func setYAMLFlag(fs *flag.FlagSet, set map[string]bool, name string, node *yaml.Node) error {
+	if name == "" || name == flag.DefaultConfigFlagname || name == "config-yaml" || fs.Lookup(name) == nil {
+		return fmt.Errorf("line %d: unknown option %q", node.Line, name)
+	}
+
+	if set[name] {
+		return nil
+	}
+
+	if err := fs.Set(name, node.Value); err != nil {
+		return fmt.Errorf("line %d: invalid value %q for %q: %w", node.Line, node.Value, name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/stretchr/testify/require"
+)
+
+func newYAMLTestFlagSet() (*flag.FlagSet, *string, *int, *bool, *time.Duration, *MultiStringFlag) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	listen := &MultiStringFlag{separator: ","}
+	fs.Var(listen, "listen-http", "")
+
+	return fs,
+		fs.String("auth-client-id", "", ""),
+		fs.Int("artifacts-server-timeout", 10, ""),
+		fs.Bool("tls-ocsp-stapling", false, ""),
+		fs.Duration("auth-share-link-max-lifetime", time.Hour, ""),
+		listen
+}
+
+func TestApplyYAML(t *testing.T) {
+	fs, clientID, timeout, stapling, lifetime, listen := newYAMLTestFlagSet()
+	require.NoError(t, fs.Parse([]string{"-artifacts-server-timeout=30"}))
+
+	err := applyYAML(fs, []byte(`
+auth:
+  client-id: pages
+  share-link-max-lifetime: 24h
+artifacts:
+  server-timeout: 5
+tls:
+  ocsp-stapling: true
+listen-http:
+  - ":80"
+  - "[::]:80"
+`))
+	require.NoError(t, err)
+
+	require.Equal(t, "pages", *clientID)
+	require.Equal(t, 24*time.Hour, *lifetime)
+	require.True(t, *stapling)
+	require.Equal(t, []string{":80", "[::]:80"}, listen.value)
+
+	// the flags set on the command line take precedence
+	require.Equal(t, 30, *timeout)
+}
+
+func TestApplyYAMLErrors(t *testing.T) {
+	tests := map[string]struct {
+		yaml string
+		err  string
+	}{
+		"unknown option": {
+			yaml: "auth:\n  client: pages\n",
+			err:  `line 2: unknown option "auth-client"`,
+		},
+		"invalid value": {
+			yaml: "artifacts:\n  server-timeout: soon\n",
+			err:  `line 2: invalid value "soon" for "artifacts-server-timeout"`,
+		},
+		"nested list": {
+			yaml: "listen-http:\n  - [\":80\"]\n",
+			err:  `line 2: the items of "listen-http" must be values`,
+		},
+		"invalid yaml": {
+			yaml: "auth: [",
+			err:  "yaml: line 1: did not find expected node content",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			fs, _, _, _, _, _ := newYAMLTestFlagSet()
+			require.NoError(t, fs.Parse(nil))
+
+			err := applyYAML(fs, []byte(tt.yaml))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
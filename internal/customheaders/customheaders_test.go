@@ -144,3 +144,54 @@ func TestAddCustomHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestWithSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		preset        string
+		headerStrings []string
+		wantHeaders   map[string][]string
+	}{
+		{
+			name:        "off",
+			preset:      "off",
+			wantHeaders: map[string][]string{},
+		},
+		{
+			name:   "basic",
+			preset: "basic",
+			wantHeaders: map[string][]string{
+				"X-Content-Type-Options": {"nosniff"},
+				"Referrer-Policy":        {"strict-origin-when-cross-origin"},
+				"X-Frame-Options":        {"SAMEORIGIN"},
+			},
+		},
+		{
+			name:          "strict with overridden headers",
+			preset:        "strict",
+			headerStrings: []string{"content-security-policy: default-src 'self' *.example.com", "X-Test: Testing"},
+			wantHeaders: map[string][]string{
+				"X-Content-Type-Options":  {"nosniff"},
+				"Referrer-Policy":         {"no-referrer"},
+				"X-Frame-Options":         {"DENY"},
+				"Content-Security-Policy": {"default-src 'self' *.example.com"},
+				"X-Test":                  {"Testing"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, err := customheaders.ParseHeaderString(tt.headerStrings)
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			customheaders.AddCustomHeaders(w, customheaders.WithSecurityHeaders(tt.preset, headers))
+
+			require.Len(t, w.Header(), len(tt.wantHeaders))
+			for k, v := range tt.wantHeaders {
+				require.Equal(t, v, w.Header().Values(k), k)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package deprecation keeps track of the deprecated features in use, such as
+// flags or serving sources. Each of them is logged as a structured warning at
+// most once per interval and listed by Handler, so operators can migrate
+// before the features are removed.
+package deprecation
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// Kinds of deprecated features
+const (
+	KindFlag   = "flag"
+	KindSource = "source"
+)
+
+// DefaultInterval between two warnings about the same deprecated feature
+const DefaultInterval = time.Hour
+
+// Warning describes a deprecated feature in use
+type Warning struct {
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Message   string    `json:"message"`
+	Count     int64     `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type record struct {
+	Warning
+	lastLogged time.Time
+	// count is the number of uses since the last warning was logged
+	count int64
+}
+
+// Registry records the uses of deprecated features
+type Registry struct {
+	mu       sync.Mutex
+	interval time.Duration
+	now      func() time.Time
+	records  map[string]*record
+}
+
+var defaultRegistry = NewRegistry(DefaultInterval)
+
+// NewRegistry returns a Registry logging each deprecated feature at most
+// once per interval
+func NewRegistry(interval time.Duration) *Registry {
+	return &Registry{
+		interval: interval,
+		now:      time.Now,
+		records:  make(map[string]*record),
+	}
+}
+
+// SetInterval changes the interval between two warnings of the default
+// registry
+func SetInterval(interval time.Duration) {
+	defaultRegistry.mu.Lock()
+	defer defaultRegistry.mu.Unlock()
+
+	defaultRegistry.interval = interval
+}
+
+// Warn records a use of a deprecated feature in the default registry
+func Warn(kind, name, message string) {
+	defaultRegistry.Warn(kind, name, message)
+}
+
+// Handler lists the deprecated features used since the start of the process
+func Handler() http.Handler {
+	return defaultRegistry
+}
+
+// Warn records a use of the deprecated feature name, message should tell
+// how to migrate away from it
+func (r *Registry) Warn(kind, name, message string) {
+	metrics.DeprecationsUsed.WithLabelValues(kind, name).Inc()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	key := kind + ":" + name
+
+	rec, ok := r.records[key]
+	if !ok {
+		rec = &record{Warning: Warning{Kind: kind, Name: name, FirstSeen: now}}
+		r.records[key] = rec
+	}
+
+	rec.Message = message
+	rec.Count++
+	rec.LastSeen = now
+	rec.count++
+
+	if ok && now.Sub(rec.lastLogged) < r.interval {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"deprecation_kind":  kind,
+		"deprecation_name":  name,
+		"deprecation_count": rec.count,
+	}).Warn(message)
+
+	rec.lastLogged = now
+	rec.count = 0
+}
+
+// Warnings returns the deprecated features used, sorted by kind and name
+func (r *Registry) Warnings() []Warning {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	warnings := make([]Warning, 0, len(r.records))
+	for _, rec := range r.records {
+		warnings = append(warnings, rec.Warning)
+	}
+
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Kind != warnings[j].Kind {
+			return warnings[i].Kind < warnings[j].Kind
+		}
+
+		return warnings[i].Name < warnings[j].Name
+	})
+
+	return warnings
+}
+
+// ServeHTTP responds with the deprecated features used as JSON
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	json.NewEncoder(w).Encode(struct {
+		Deprecations []Warning `json:"deprecations"`
+	}{r.Warnings()})
+}
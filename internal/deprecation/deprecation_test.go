@@ -0,0 +1,71 @@
+package deprecation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	testlog "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarn(t *testing.T) {
+	hook := testlog.NewGlobal()
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewRegistry(time.Hour)
+	r.now = func() time.Time { return now }
+
+	r.Warn(KindFlag, "daemon-uid", "flag daemon-uid is DEPRECATED")
+	require.Len(t, hook.AllEntries(), 1)
+	require.Equal(t, "daemon-uid", hook.LastEntry().Data["deprecation_name"])
+	require.Equal(t, int64(1), hook.LastEntry().Data["deprecation_count"])
+
+	// further uses within the interval are only counted
+	now = now.Add(time.Minute)
+	r.Warn(KindFlag, "daemon-uid", "flag daemon-uid is DEPRECATED")
+	r.Warn(KindFlag, "daemon-uid", "flag daemon-uid is DEPRECATED")
+	require.Len(t, hook.AllEntries(), 1)
+
+	// other deprecations are logged independently
+	r.Warn(KindSource, "file", "serving from disk is deprecated")
+	require.Len(t, hook.AllEntries(), 2)
+
+	now = now.Add(time.Hour)
+	r.Warn(KindFlag, "daemon-uid", "flag daemon-uid is DEPRECATED")
+	require.Len(t, hook.AllEntries(), 3)
+	require.Equal(t, int64(3), hook.LastEntry().Data["deprecation_count"], "uses since the last warning")
+
+	warnings := r.Warnings()
+	require.Len(t, warnings, 2)
+	require.Equal(t, Warning{
+		Kind:      KindFlag,
+		Name:      "daemon-uid",
+		Message:   "flag daemon-uid is DEPRECATED",
+		Count:     4,
+		FirstSeen: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		LastSeen:  now,
+	}, warnings[0])
+	require.Equal(t, KindSource, warnings[1].Kind)
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry(time.Hour)
+	r.Warn(KindSource, "file", "serving from disk is deprecated")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/deprecations", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var body struct {
+		Deprecations []Warning `json:"deprecations"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	require.Len(t, body.Deprecations, 1)
+	require.Equal(t, "file", body.Deprecations[0].Name)
+	require.Equal(t, int64(1), body.Deprecations[0].Count)
+}
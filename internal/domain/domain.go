@@ -17,6 +17,10 @@ import (
 // for a domain could not be resolved
 var ErrDomainDoesNotExist = errors.New("domain does not exist")
 
+// DeprecatedHeader is set on the responses of a domain that has been removed
+// from GitLab but is still served during a grace period
+const DeprecatedHeader = "X-Pages-Deprecated"
+
 // Domain is a domain that gitlab-pages can serve.
 type Domain struct {
 	Name            string
@@ -25,9 +29,29 @@ type Domain struct {
 
 	Resolver Resolver
 
+	// TLSPolicy overrides the instance TLS settings when set
+	TLSPolicy *TLSPolicy
+
+	// RateLimit overrides the instance rate limit of the domain when set
+	RateLimit *RateLimit
+
+	// Deprecated is true when the domain has been removed from GitLab and is
+	// served during a grace period
+	Deprecated bool
+
 	certificate      *tls.Certificate
 	certificateError error
 	certificateOnce  sync.Once
+
+	tlsConfig      *tls.Config
+	tlsPolicyError error
+	tlsPolicyOnce  sync.Once
+}
+
+// RateLimit holds the rate limit of a domain, as sent by GitLab
+type RateLimit struct {
+	LimitPerSecond float64
+	Burst          int
 }
 
 // New creates a new domain with a resolver and existing certificates
@@ -101,6 +125,16 @@ func (d *Domain) GetProjectID(r *http.Request) uint64 {
 	return 0
 }
 
+// GetGroupSSO returns the group enforcing its SSO on the visitors of the
+// project and the SSO page of the group, if any
+func (d *Domain) GetGroupSSO(r *http.Request) (uint64, string) {
+	if lookupPath, _ := d.GetLookupPath(r); lookupPath != nil {
+		return lookupPath.SSOGroupID, lookupPath.SSOSignInURL
+	}
+
+	return 0, ""
+}
+
 // EnsureCertificate parses the PEM-encoded certificate for the domain
 func (d *Domain) EnsureCertificate() (*tls.Certificate, error) {
 	if d == nil || len(d.CertificateKey) == 0 || len(d.CertificateCert) == 0 {
@@ -127,30 +161,56 @@ func (d *Domain) ServeFileHTTP(w http.ResponseWriter, r *http.Request) bool {
 	if err != nil {
 		if errors.Is(err, ErrDomainDoesNotExist) {
 			// serve generic 404
-			httperrors.Serve404(w)
+			httperrors.Serve404(w, r)
 			return true
 		}
 
-		errortracking.Capture(err, errortracking.WithRequest(r), errortracking.WithStackTrace())
-		httperrors.Serve503(w)
+		serveResolveError(w, r, err)
 		return true
 	}
 
 	return request.ServeFileHTTP(w, r)
 }
 
+// ServeNamespaceRedirectsHTTP applies the `_redirects` rules of the
+// namespace project to a request its project did not serve, so groups can
+// move the pages of all their projects in one place. It returns false if
+// the request belongs to the namespace project, which has already applied
+// them, or no rule matches.
+func (d *Domain) ServeNamespaceRedirectsHTTP(w http.ResponseWriter, r *http.Request) bool {
+	request, err := d.resolve(r)
+	if err != nil || request.LookupPath.Prefix == "/" {
+		return false
+	}
+
+	// clone r and override the path to resolve the namespace project
+	clonedReq := r.Clone(r.Context())
+	clonedReq.URL.Path = "/"
+
+	namespaceRequest, err := d.Resolver.Resolve(clonedReq)
+	if err != nil || namespaceRequest.LookupPath.Prefix != "/" {
+		return false
+	}
+
+	// the visitor may not be allowed to read the namespace project
+	if namespaceRequest.LookupPath.HasAccessControl {
+		return false
+	}
+
+	return namespaceRequest.ServeRedirectsHTTP(w, r)
+}
+
 // ServeNotFoundHTTP serves the not found pages from the projects.
 func (d *Domain) ServeNotFoundHTTP(w http.ResponseWriter, r *http.Request) {
 	request, err := d.resolve(r)
 	if err != nil {
 		if errors.Is(err, ErrDomainDoesNotExist) {
 			// serve generic 404
-			httperrors.Serve404(w)
+			httperrors.Serve404(w, r)
 			return
 		}
 
-		errortracking.Capture(err, errortracking.WithRequest(r), errortracking.WithStackTrace())
-		httperrors.Serve503(w)
+		serveResolveError(w, r, err)
 		return
 	}
 
@@ -169,12 +229,11 @@ func (d *Domain) serveNamespaceNotFound(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		if errors.Is(err, ErrDomainDoesNotExist) {
 			// serve generic 404
-			httperrors.Serve404(w)
+			httperrors.Serve404(w, r)
 			return
 		}
 
-		errortracking.Capture(err, errortracking.WithRequest(r), errortracking.WithStackTrace())
-		httperrors.Serve503(w)
+		serveResolveError(w, r, err)
 		return
 	}
 
@@ -184,7 +243,7 @@ func (d *Domain) serveNamespaceNotFound(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	httperrors.Serve404(w)
+	httperrors.Serve404(w, r)
 }
 
 // ServeNotFoundAuthFailed handler to be called when auth failed so the correct custom
@@ -192,7 +251,7 @@ func (d *Domain) serveNamespaceNotFound(w http.ResponseWriter, r *http.Request)
 func (d *Domain) ServeNotFoundAuthFailed(w http.ResponseWriter, r *http.Request) {
 	lookupPath, err := d.GetLookupPath(r)
 	if err != nil {
-		httperrors.Serve404(w)
+		httperrors.Serve404(w, r)
 		return
 	}
 
@@ -203,3 +262,15 @@ func (d *Domain) ServeNotFoundAuthFailed(w http.ResponseWriter, r *http.Request)
 
 	d.serveNamespaceNotFound(w, r)
 }
+
+// serveResolveError serves the failure to resolve the domain of r, which is
+// not reported when the client aborted the request
+func serveResolveError(w http.ResponseWriter, r *http.Request, err error) {
+	if httperrors.IsClientAborted(r, err) {
+		httperrors.ServeClientAborted(w, r, "resolve", err)
+		return
+	}
+
+	errortracking.Capture(err, errortracking.WithRequest(r), errortracking.WithStackTrace())
+	httperrors.Serve503(w, r)
+}
@@ -5,10 +5,12 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"gitlab.com/gitlab-org/gitlab-pages/internal/feature"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/fixture"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/local"
@@ -219,3 +221,95 @@ func TestServeNamespaceNotFound(t *testing.T) {
 		})
 	}
 }
+
+// namespaceResolver resolves the requests for "/" to the namespace project
+// and the others to project
+type namespaceResolver struct {
+	namespace *serving.LookupPath
+	project   *serving.LookupPath
+}
+
+func (resolver *namespaceResolver) Resolve(r *http.Request) (*serving.Request, error) {
+	lookupPath := resolver.project
+	if r.URL.Path == "/" {
+		lookupPath = resolver.namespace
+	}
+
+	if lookupPath == nil {
+		return nil, ErrDomainDoesNotExist
+	}
+
+	return &serving.Request{
+		Serving:    local.Instance(),
+		LookupPath: lookupPath,
+		SubPath:    strings.TrimPrefix(r.URL.Path, lookupPath.Prefix),
+	}, nil
+}
+
+func TestServeNamespaceRedirectsHTTP(t *testing.T) {
+	defer setUpTests(t)()
+	testhelpers.StubFeatureFlagValue(t, feature.RedirectsPlaceholders.EnvVariable, true)
+
+	namespace := &serving.LookupPath{
+		Prefix:             "/",
+		Path:               "group.redirects/group.redirects.gitlab-example.com/public/",
+		IsNamespaceProject: true,
+	}
+	project := &serving.LookupPath{
+		Prefix: "/jobs/",
+		Path:   "group.redirects/project-redirects/public/",
+	}
+
+	tests := map[string]struct {
+		resolver         *namespaceResolver
+		path             string
+		expectedServed   bool
+		expectedLocation string
+	}{
+		"namespace_rule": {
+			resolver:         &namespaceResolver{namespace: namespace, project: project},
+			path:             "/jobs/assistant.html",
+			expectedServed:   true,
+			expectedLocation: "/careers/assistant.html",
+		},
+		"no_matching_rule": {
+			resolver: &namespaceResolver{namespace: namespace, project: project},
+			path:     "/unknown.html",
+		},
+		"namespace_project": {
+			resolver: &namespaceResolver{namespace: namespace, project: namespace},
+			path:     "/jobs/assistant.html",
+		},
+		"no_namespace_project": {
+			resolver: &namespaceResolver{project: project},
+			path:     "/jobs/assistant.html",
+		},
+		"private_namespace_project": {
+			resolver: &namespaceResolver{
+				namespace: &serving.LookupPath{
+					Prefix:             "/",
+					Path:               namespace.Path,
+					IsNamespaceProject: true,
+					HasAccessControl:   true,
+				},
+				project: project,
+			},
+			path: "/jobs/assistant.html",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := New("group.redirects.gitlab-example.com", "", "", tt.resolver)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "http://group.redirects.gitlab-example.com"+tt.path, nil)
+
+			require.Equal(t, tt.expectedServed, d.ServeNamespaceRedirectsHTTP(w, r))
+			if tt.expectedServed {
+				require.Equal(t, http.StatusMovedPermanently, w.Code)
+				require.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// Client authentication modes supported by TLSPolicy.ClientAuth
+const (
+	ClientAuthNone          = "none"
+	ClientAuthRequest       = "request"
+	ClientAuthVerifyIfGiven = "verify_if_given"
+	ClientAuthRequire       = "require"
+)
+
+var tlsVersions = map[string]uint16{
+	"":       0,
+	"tls1.2": tls.VersionTLS12,
+	"tls1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                      tls.NoClientCert,
+	ClientAuthNone:          tls.NoClientCert,
+	ClientAuthRequest:       tls.RequestClientCert,
+	ClientAuthVerifyIfGiven: tls.VerifyClientCertIfGiven,
+	ClientAuthRequire:       tls.RequireAndVerifyClientCert,
+}
+
+var errClientCAsRequired = errors.New("client certificate verification requires client CA certificates")
+
+// TLSPolicy holds transport settings of a domain that are stricter than the
+// instance defaults, as sent by GitLab
+type TLSPolicy struct {
+	// MinVersion is the minimum TLS version, "tls1.2" or "tls1.3"
+	MinVersion string
+	// ClientAuth is one of the ClientAuth* modes
+	ClientAuth string
+	// ClientCACertificates are the PEM-encoded CAs used to verify client certificates
+	ClientCACertificates string
+}
+
+// TLSConfig returns a copy of base with the TLS policy of the domain applied.
+// It returns nil if the domain has no TLS policy. A policy can only make the
+// settings stricter, a minimum version lower than the one of base is ignored.
+func (d *Domain) TLSConfig(base *tls.Config) (*tls.Config, error) {
+	if d == nil || d.TLSPolicy == nil {
+		return nil, nil
+	}
+
+	d.tlsPolicyOnce.Do(func() {
+		d.tlsConfig, d.tlsPolicyError = d.TLSPolicy.apply(base)
+	})
+
+	return d.tlsConfig, d.tlsPolicyError
+}
+
+func (p *TLSPolicy) apply(base *tls.Config) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[p.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("invalid minimum TLS version: %q", p.MinVersion)
+	}
+
+	clientAuth, ok := clientAuthTypes[p.ClientAuth]
+	if !ok {
+		return nil, fmt.Errorf("invalid client auth: %q", p.ClientAuth)
+	}
+
+	cfg := base.Clone()
+	// the policy of the domain is final
+	cfg.GetConfigForClient = nil
+
+	if minVersion > cfg.MinVersion {
+		cfg.MinVersion = minVersion
+	}
+
+	if cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+		return nil, fmt.Errorf("minimum TLS version %q is above the maximum version of the instance", p.MinVersion)
+	}
+
+	cfg.ClientAuth = clientAuth
+
+	if p.ClientCACertificates != "" {
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM([]byte(p.ClientCACertificates)) {
+			return nil, errors.New("could not parse client CA certificates")
+		}
+	}
+
+	if clientAuth >= tls.VerifyClientCertIfGiven && cfg.ClientCAs == nil {
+		return nil, errClientCAsRequired
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/fixture"
+)
+
+func TestTLSConfig(t *testing.T) {
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	tests := map[string]struct {
+		policy             *TLSPolicy
+		base               *tls.Config
+		expectedMinVersion uint16
+		expectedClientAuth tls.ClientAuthType
+		expectedErr        bool
+	}{
+		"no_policy": {},
+		"tls13_only": {
+			policy:             &TLSPolicy{MinVersion: "tls1.3"},
+			expectedMinVersion: tls.VersionTLS13,
+		},
+		"lower_min_version_is_ignored": {
+			policy:             &TLSPolicy{MinVersion: "tls1.2"},
+			base:               &tls.Config{MinVersion: tls.VersionTLS13},
+			expectedMinVersion: tls.VersionTLS13,
+		},
+		"min_version_above_instance_max_version": {
+			policy:      &TLSPolicy{MinVersion: "tls1.3"},
+			base:        &tls.Config{MinVersion: tls.VersionTLS12, MaxVersion: tls.VersionTLS12},
+			expectedErr: true,
+		},
+		"invalid_min_version": {
+			policy:      &TLSPolicy{MinVersion: "tls1.0"},
+			expectedErr: true,
+		},
+		"request_client_cert": {
+			policy:             &TLSPolicy{ClientAuth: ClientAuthRequest},
+			expectedMinVersion: tls.VersionTLS12,
+			expectedClientAuth: tls.RequestClientCert,
+		},
+		"require_client_cert": {
+			policy:             &TLSPolicy{ClientAuth: ClientAuthRequire, ClientCACertificates: fixture.Certificate},
+			expectedMinVersion: tls.VersionTLS12,
+			expectedClientAuth: tls.RequireAndVerifyClientCert,
+		},
+		"require_client_cert_without_cas": {
+			policy:      &TLSPolicy{ClientAuth: ClientAuthRequire},
+			expectedErr: true,
+		},
+		"invalid_client_cas": {
+			policy:      &TLSPolicy{ClientAuth: ClientAuthRequire, ClientCACertificates: "invalid"},
+			expectedErr: true,
+		},
+		"invalid_client_auth": {
+			policy:      &TLSPolicy{ClientAuth: "always"},
+			expectedErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := New("group.gitlab.io", "", "", nil)
+			d.TLSPolicy = tt.policy
+
+			b := base
+			if tt.base != nil {
+				b = tt.base
+			}
+
+			cfg, err := d.TLSConfig(b)
+			if tt.expectedErr {
+				require.Error(t, err)
+				require.Nil(t, cfg)
+				return
+			}
+
+			require.NoError(t, err)
+
+			if tt.policy == nil {
+				require.Nil(t, cfg)
+				return
+			}
+
+			require.Equal(t, tt.expectedMinVersion, cfg.MinVersion)
+			require.Equal(t, tt.expectedClientAuth, cfg.ClientAuth)
+			require.NotSame(t, b, cfg, "base config must not be modified")
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package export lets the owners of a site download the archive of the
+// deployment that is served, for debugging and backups. Downloads support
+// Range requests, so that large archives are resumed.
+//
+// The download is authorized by a JWT signed with the secret shared with
+// GitLab, so that GitLab grants it to the owners of the project.
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httpfs"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httprange"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/jwtauth"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	// Path of the download under the prefix of a project
+	Path = "-/deployment.zip"
+
+	// QueryParam holds the token of the download when it is not sent in the
+	// Authorization header, e.g. for browsers. It is named so that it is
+	// masked in the logs.
+	QueryParam = "pages_export_token"
+
+	audience = "gitlab-pages-export"
+
+	// maxLifetime bounds the lifetime of the tokens, a resumed download
+	// reuses the token of the first request
+	maxLifetime = 24 * time.Hour
+)
+
+var (
+	errInvalidToken = errors.New("the token is not valid for this project")
+	errNotAnArchive = errors.New("the deployment is not served from an archive")
+)
+
+// Claims of the token of a download
+type Claims struct {
+	jwt.RegisteredClaims
+	Host      string `json:"host"`
+	ProjectID uint64 `json:"project_id"`
+}
+
+// Exporter serves the archives of the deployments
+type Exporter struct {
+	verifier   *jwtauth.Verifier
+	httpClient *http.Client
+}
+
+// New returns an Exporter of the downloads authorized by tokens signed with
+// secret. The archives on disk are only read from allowedPaths, none when it
+// is empty.
+func New(secret []byte, allowedPaths []string) (*Exporter, error) {
+	transport := httptransport.NewTransport()
+
+	if len(allowedPaths) > 0 {
+		fs, err := httpfs.NewFileSystemPath(append([]string(nil), allowedPaths...))
+		if err != nil {
+			return nil, err
+		}
+
+		transport.RegisterProtocol("file", http.NewFileTransport(fs))
+	}
+
+	return &Exporter{
+		verifier:   jwtauth.NewVerifier(secret, audience, maxLifetime),
+		httpClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+// TryServe serves the archive of the deployment of lookupPath when the
+// request is for its download. It returns true when the request was served.
+func (e *Exporter) TryServe(w http.ResponseWriter, r *http.Request, lookupPath *serving.LookupPath) bool {
+	if e == nil || lookupPath == nil || r.URL.Path != strings.TrimSuffix(lookupPath.Prefix, "/")+"/"+Path {
+		return false
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return true
+	}
+
+	if err := e.authorize(r, lookupPath.ProjectID); err != nil {
+		logging.LogRequest(r).WithError(err).Info("Refusing deployment download")
+		metrics.DeploymentExports.WithLabelValues("refused").Inc()
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gitlab-pages"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return true
+	}
+
+	if lookupPath.ServingType != "zip" {
+		metrics.DeploymentExports.WithLabelValues("unavailable").Inc()
+
+		http.Error(w, errNotAnArchive.Error(), http.StatusNotFound)
+		return true
+	}
+
+	if err := e.serve(r.Context(), w, r, lookupPath); err != nil {
+		logging.LogRequest(r).WithError(err).Error("failed to open the deployment archive")
+		metrics.DeploymentExports.WithLabelValues("unavailable").Inc()
+
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return true
+	}
+
+	metrics.DeploymentExports.WithLabelValues("served").Inc()
+
+	return true
+}
+
+func (e *Exporter) serve(ctx context.Context, w http.ResponseWriter, r *http.Request, lookupPath *serving.LookupPath) error {
+	resource, err := httprange.NewResource(ctx, lookupPath.Path, e.httpClient)
+	if err != nil {
+		return err
+	}
+
+	reader := httprange.NewReader(ctx, resource, 0, resource.Size)
+	defer reader.Close()
+
+	// the archive of a deployment never changes, its SHA is a strong ETag
+	// which lets clients resume the download with If-Range
+	if lookupPath.SHA256 != "" {
+		w.Header().Set("ETag", fmt.Sprintf("%q", lookupPath.SHA256))
+	}
+
+	modTime, _ := http.ParseTime(resource.LastModified)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="deployment.zip"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	http.ServeContent(w, r, "", modTime, reader)
+
+	return nil
+}
+
+// authorize verifies that the token of the request grants the download of
+// the project at the host of the request
+func (e *Exporter) authorize(r *http.Request, projectID uint64) error {
+	token := jwtauth.BearerToken(r)
+	if token == "" {
+		token = r.URL.Query().Get(QueryParam)
+	}
+
+	claims := &Claims{}
+	if err := e.verifier.Verify(token, claims); err != nil {
+		return err
+	}
+
+	if projectID == 0 || claims.ProjectID != projectID || !strings.EqualFold(claims.Host, request.GetHostWithoutPort(r)) {
+		return errInvalidToken
+	}
+
+	return nil
+}
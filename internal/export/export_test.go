@@ -0,0 +1,246 @@
+package export
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/labkit/mask"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+)
+
+var secret = []byte("secret")
+
+const archive = "PK\x05\x06 the archive of the deployment"
+
+func newExporter(t *testing.T) (*Exporter, *serving.LookupPath) {
+	t.Helper()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "deployment.zip")
+	require.NoError(t, os.WriteFile(path, []byte(archive), 0600))
+
+	e, err := New(secret, []string{dir})
+	require.NoError(t, err)
+
+	return e, &serving.LookupPath{
+		ServingType: "zip",
+		Prefix:      "/project/",
+		Path:        "file://" + path,
+		SHA256:      "c0ffee",
+		ProjectID:   1234,
+	}
+}
+
+func token(t *testing.T, method jwt.SigningMethod, claims *Claims) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(method, claims).SignedString(secret)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func validClaims() *Claims {
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Host:      "group.gitlab-example.com",
+		ProjectID: 1234,
+	}
+}
+
+func TestTryServe(t *testing.T) {
+	e, lookupPath := newExporter(t)
+
+	r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/-/deployment.zip", nil)
+	r.Header.Set("Authorization", "Bearer "+token(t, jwt.SigningMethodHS256, validClaims()))
+
+	w := httptest.NewRecorder()
+	require.True(t, e.TryServe(w, r, lookupPath))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, archive, w.Body.String())
+	require.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	require.Equal(t, `attachment; filename="deployment.zip"`, w.Header().Get("Content-Disposition"))
+	require.Equal(t, `"c0ffee"`, w.Header().Get("ETag"))
+	require.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+}
+
+func TestTryServeResumesDownload(t *testing.T) {
+	e, lookupPath := newExporter(t)
+
+	tests := map[string]struct {
+		ifRange      string
+		expectedCode int
+		expectedBody string
+	}{
+		"range": {
+			expectedCode: http.StatusPartialContent,
+			expectedBody: archive[4:],
+		},
+		"same deployment": {
+			ifRange:      `"c0ffee"`,
+			expectedCode: http.StatusPartialContent,
+			expectedBody: archive[4:],
+		},
+		"new deployment": {
+			ifRange:      `"deadbeef"`,
+			expectedCode: http.StatusOK,
+			expectedBody: archive,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/-/deployment.zip?"+QueryParam+"="+token(t, jwt.SigningMethodHS256, validClaims()), nil)
+			r.Header.Set("Range", "bytes=4-")
+			if tt.ifRange != "" {
+				r.Header.Set("If-Range", tt.ifRange)
+			}
+
+			w := httptest.NewRecorder()
+			require.True(t, e.TryServe(w, r, lookupPath))
+
+			require.Equal(t, tt.expectedCode, w.Code)
+			require.Equal(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestTryServeRefusesToken(t *testing.T) {
+	e, lookupPath := newExporter(t)
+
+	tests := map[string]func(*Claims) (jwt.SigningMethod, bool){
+		"no token": func(*Claims) (jwt.SigningMethod, bool) {
+			return nil, false
+		},
+		"other project": func(c *Claims) (jwt.SigningMethod, bool) {
+			c.ProjectID = 4321
+			return jwt.SigningMethodHS256, true
+		},
+		"other host": func(c *Claims) (jwt.SigningMethod, bool) {
+			c.Host = "other.gitlab-example.com"
+			return jwt.SigningMethodHS256, true
+		},
+		"other audience": func(c *Claims) (jwt.SigningMethod, bool) {
+			c.Audience = jwt.ClaimStrings{"gitlab-pages-share"}
+			return jwt.SigningMethodHS256, true
+		},
+		"expired": func(c *Claims) (jwt.SigningMethod, bool) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			return jwt.SigningMethodHS256, true
+		},
+		"no expiry": func(c *Claims) (jwt.SigningMethod, bool) {
+			c.ExpiresAt = nil
+			return jwt.SigningMethodHS256, true
+		},
+		"too long lifetime": func(c *Claims) (jwt.SigningMethod, bool) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(maxLifetime + time.Hour))
+			return jwt.SigningMethodHS256, true
+		},
+		"unsigned": func(c *Claims) (jwt.SigningMethod, bool) {
+			return jwt.SigningMethodNone, true
+		},
+	}
+
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/-/deployment.zip", nil)
+
+			claims := validClaims()
+			if method, ok := mutate(claims); ok {
+				signed, err := jwt.NewWithClaims(method, claims).SignedString(signingKey(method))
+				require.NoError(t, err)
+
+				r.Header.Set("Authorization", "Bearer "+signed)
+			}
+
+			w := httptest.NewRecorder()
+			require.True(t, e.TryServe(w, r, lookupPath))
+
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+			require.NotContains(t, w.Body.String(), archive)
+		})
+	}
+}
+
+func signingKey(method jwt.SigningMethod) interface{} {
+	if method == jwt.SigningMethodNone {
+		return jwt.UnsafeAllowNoneSignatureType
+	}
+
+	return secret
+}
+
+func TestTryServeSkipsOtherRequests(t *testing.T) {
+	e, lookupPath := newExporter(t)
+
+	for _, target := range []string{"/project/", "/project/-/deployment.zip/", "/other/-/deployment.zip"} {
+		r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com"+target, nil)
+
+		require.False(t, e.TryServe(httptest.NewRecorder(), r, lookupPath), target)
+	}
+
+	var disabled *Exporter
+
+	r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/-/deployment.zip", nil)
+	require.False(t, disabled.TryServe(httptest.NewRecorder(), r, lookupPath))
+}
+
+func TestTryServeOnlyGetAndHead(t *testing.T) {
+	e, lookupPath := newExporter(t)
+
+	r := httptest.NewRequest(http.MethodPost, "https://group.gitlab-example.com/project/-/deployment.zip", nil)
+
+	w := httptest.NewRecorder()
+	require.True(t, e.TryServe(w, r, lookupPath))
+
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	require.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+}
+
+func TestTryServeWithoutArchive(t *testing.T) {
+	e, lookupPath := newExporter(t)
+	lookupPath.ServingType = "file"
+
+	r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/-/deployment.zip", nil)
+	r.Header.Set("Authorization", "Bearer "+token(t, jwt.SigningMethodHS256, validClaims()))
+
+	w := httptest.NewRecorder()
+	require.True(t, e.TryServe(w, r, lookupPath))
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTryServeArchiveOutsideAllowedPaths(t *testing.T) {
+	e, err := New(secret, nil)
+	require.NoError(t, err)
+
+	_, lookupPath := newExporter(t)
+
+	r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/-/deployment.zip", nil)
+	r.Header.Set("Authorization", "Bearer "+token(t, jwt.SigningMethodHS256, validClaims()))
+
+	w := httptest.NewRecorder()
+	require.True(t, e.TryServe(w, r, lookupPath))
+
+	require.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func TestQueryParamIsMasked(t *testing.T) {
+	masked := mask.URL("https://group.gitlab-example.com/project/-/deployment.zip?" + QueryParam + "=secret-token")
+
+	require.NotContains(t, masked, "secret-token")
+}
@@ -1,10 +1,29 @@
 package feature
 
-import "os"
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrNotRuntime is returned when a feature flag that is only read on start
+// is set at runtime
+var ErrNotRuntime = errors.New("the feature flag cannot be set at runtime")
+
+var (
+	overridesMux sync.RWMutex
+	// overrides are the states set at runtime, by environment variable
+	overrides = map[string]bool{}
+)
 
 type Feature struct {
 	EnvVariable    string
 	defaultEnabled bool
+	// runtime is set for the flags read on every request, which can be set
+	// while Pages runs
+	runtime bool
 }
 
 // EnforceIPRateLimits enforces IP rate limiter to drop requests
@@ -23,12 +42,22 @@ var EnforceDomainRateLimits = Feature{
 // TODO: remove https://gitlab.com/gitlab-org/gitlab-pages/-/issues/620
 var RedirectsPlaceholders = Feature{
 	EnvVariable: "FF_ENABLE_PLACEHOLDERS",
+	runtime:     true,
 }
 
 // Enabled reads the environment variable responsible for the feature flag
 // if FF is disabled by default, the environment variable needs to be "true" to explicitly enable it
 // if FF is enabled by default, variable needs to be "false" to explicitly disable it
+// A state set at runtime takes precedence over the environment variable.
 func (f Feature) Enabled() bool {
+	overridesMux.RLock()
+	enabled, overridden := overrides[f.EnvVariable]
+	overridesMux.RUnlock()
+
+	if overridden {
+		return enabled
+	}
+
 	env := os.Getenv(f.EnvVariable)
 
 	if f.defaultEnabled {
@@ -37,3 +66,66 @@ func (f Feature) Enabled() bool {
 
 	return env == "true"
 }
+
+// Runtime returns true if the flag can be set while Pages runs
+func (f Feature) Runtime() bool {
+	return f.runtime
+}
+
+// Set overrides the state of the flag until Reset, it fails for the flags
+// which are only read on start
+func (f Feature) Set(enabled bool) error {
+	if !f.runtime {
+		return ErrNotRuntime
+	}
+
+	overridesMux.Lock()
+	defer overridesMux.Unlock()
+
+	overrides[f.EnvVariable] = enabled
+
+	return nil
+}
+
+// Reset drops the state set at runtime, the flag is read from its
+// environment variable again
+func (f Feature) Reset() {
+	overridesMux.Lock()
+	defer overridesMux.Unlock()
+
+	delete(overrides, f.EnvVariable)
+}
+
+// Find returns the feature flag of the environment variable name
+func Find(name string) (Feature, bool) {
+	for _, f := range All() {
+		if f.EnvVariable == name {
+			return f, true
+		}
+	}
+
+	return Feature{}, false
+}
+
+// All returns every feature flag of Pages
+func All() []Feature {
+	return []Feature{
+		EnforceIPRateLimits,
+		EnforceDomainRateLimits,
+		RedirectsPlaceholders,
+	}
+}
+
+// ExportMetrics sets gauge, labeled with the name and the state of every
+// feature flag, to 1 for the current state of the flag and 0 for the other
+func ExportMetrics(gauge *prometheus.GaugeVec) {
+	for _, f := range All() {
+		enabled, disabled := 0.0, 1.0
+		if f.Enabled() {
+			enabled, disabled = 1, 0
+		}
+
+		gauge.WithLabelValues(f.EnvVariable, "enabled").Set(enabled)
+		gauge.WithLabelValues(f.EnvVariable, "disabled").Set(disabled)
+	}
+}
@@ -3,6 +3,8 @@ package feature
 import (
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/testhelpers"
@@ -46,3 +48,40 @@ func TestEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestExportMetrics(t *testing.T) {
+	testhelpers.SetEnvironmentVariable(t, EnforceIPRateLimits.EnvVariable, "true")
+	testhelpers.SetEnvironmentVariable(t, EnforceDomainRateLimits.EnvVariable, "false")
+
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "feature_flag"}, []string{"name", "state"})
+	ExportMetrics(gauge)
+
+	require.Equal(t, 1.0, testutil.ToFloat64(gauge.WithLabelValues(EnforceIPRateLimits.EnvVariable, "enabled")))
+	require.Equal(t, 0.0, testutil.ToFloat64(gauge.WithLabelValues(EnforceIPRateLimits.EnvVariable, "disabled")))
+	require.Equal(t, 0.0, testutil.ToFloat64(gauge.WithLabelValues(EnforceDomainRateLimits.EnvVariable, "enabled")))
+	require.Equal(t, 1.0, testutil.ToFloat64(gauge.WithLabelValues(EnforceDomainRateLimits.EnvVariable, "disabled")))
+	require.Equal(t, 2*len(All()), testutil.CollectAndCount(gauge))
+}
+
+func TestSet(t *testing.T) {
+	testhelpers.SetEnvironmentVariable(t, RedirectsPlaceholders.EnvVariable, "true")
+	defer RedirectsPlaceholders.Reset()
+
+	require.NoError(t, RedirectsPlaceholders.Set(false))
+	require.False(t, RedirectsPlaceholders.Enabled(), "the runtime state takes precedence")
+
+	RedirectsPlaceholders.Reset()
+	require.True(t, RedirectsPlaceholders.Enabled())
+
+	require.ErrorIs(t, EnforceIPRateLimits.Set(true), ErrNotRuntime)
+	require.False(t, EnforceIPRateLimits.Enabled())
+}
+
+func TestFind(t *testing.T) {
+	f, ok := Find("FF_ENABLE_PLACEHOLDERS")
+	require.True(t, ok)
+	require.True(t, f.Runtime())
+
+	_, ok = Find("FF_UNKNOWN")
+	require.False(t, ok)
+}
@@ -0,0 +1,43 @@
+package fixturegen
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// APIHandler serves the payloads written to dir as the internal Pages API
+// of GitLab. Domains without a payload do not exist. The requests are not
+// authenticated.
+func APIHandler(dir string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/v4/internal/pages/status", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/api/v4/internal/pages", func(w http.ResponseWriter, r *http.Request) {
+		host := strings.ToLower(r.URL.Query().Get("host"))
+		if host == "" || host != filepath.Base(host) || strings.HasPrefix(host, ".") {
+			http.Error(w, "invalid host", http.StatusBadRequest)
+			return
+		}
+
+		payload, err := os.ReadFile(filepath.Join(dir, host+".json"))
+		if os.IsNotExist(err) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(payload)
+	})
+
+	return mux
+}
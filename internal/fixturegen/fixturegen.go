@@ -0,0 +1,266 @@
+// Package fixturegen generates the deployments of a large Pages instance: a
+// pages-root of zip archives, with `_redirects` and `_headers` files, and the
+// GitLab API payloads of their domains. Served with a stub of the GitLab API,
+// they reproduce the behavior of a daemon serving many domains.
+package fixturegen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/namsral/flag"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+)
+
+// CommandName is the name of the subcommand generating the fixtures
+const CommandName = "fixtures"
+
+const (
+	pagesDir = "pages"
+	apiDir   = "api"
+)
+
+var (
+	errNoOutputDir    = errors.New("output-dir must be defined")
+	errOutputNotEmpty = errors.New("output-dir must be empty")
+	errNoPagesDomain  = errors.New("pages-domain must be defined")
+	errScale          = errors.New("domains, projects and files must be greater than 0")
+	errNegative       = errors.New("file-size, redirects and headers must not be negative")
+)
+
+// Options configure the generated fixtures
+type Options struct {
+	// OutputDir receives the pages-root in `pages/` and the API payloads of
+	// the domains in `api/<domain>.json`
+	OutputDir   string
+	PagesDomain string
+	// Domains is the number of group domains, each with Projects projects of
+	// Files files. The first project of a group is served at its root.
+	Domains  int
+	Projects int
+	Files    int
+	// FileSize is the average size of the files in bytes
+	FileSize int
+	// Redirects and Headers are the number of rules of the `_redirects` and
+	// `_headers` files of each project, 0 to leave the file out
+	Redirects int
+	Headers   int
+	// Seed makes the generated content reproducible
+	Seed int64
+}
+
+// Summary describes the generated fixtures
+type Summary struct {
+	Domains  int   `json:"domains"`
+	Projects int   `json:"projects"`
+	Files    int   `json:"files"`
+	Bytes    int64 `json:"archive_bytes"`
+}
+
+// Main parses the subcommand arguments, generates the fixtures and writes
+// their summary, or serves the payloads of generated fixtures as the GitLab
+// API. It returns the process exit code.
+func Main(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(CommandName, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	opts := Options{}
+	flags.StringVar(&opts.OutputDir, "output-dir", "", "The empty directory where the pages-root and the API payloads are written to")
+	flags.StringVar(&opts.PagesDomain, "pages-domain", "example.io", "The domain the group domains are subdomains of")
+	flags.IntVar(&opts.Domains, "domains", 100, "The number of group domains")
+	flags.IntVar(&opts.Projects, "projects", 2, "The number of projects of each domain")
+	flags.IntVar(&opts.Files, "files", 20, "The number of files of each project")
+	flags.IntVar(&opts.FileSize, "file-size", 4096, "The average size of the files in bytes")
+	flags.IntVar(&opts.Redirects, "redirects", 5, "The number of rules of the _redirects file of each project, 0 to leave it out")
+	flags.IntVar(&opts.Headers, "headers", 2, "The number of rules of the _headers file of each project, 0 to leave it out")
+	flags.Int64Var(&opts.Seed, "seed", 1, "The seed of the generated content, the same seed generates the same fixtures")
+	listenAPI := flags.String("listen-api", "", "Serve the API payloads of the fixtures in output-dir as the GitLab API on this address, instead of generating fixtures")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *listenAPI != "" {
+		if opts.OutputDir == "" {
+			fmt.Fprintf(stderr, "%s: %v\n", CommandName, errNoOutputDir)
+			return 2
+		}
+
+		fmt.Fprintf(stderr, "%s: serving the GitLab API on %s\n", CommandName, *listenAPI)
+		if err := http.ListenAndServe(*listenAPI, APIHandler(filepath.Join(opts.OutputDir, apiDir))); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", CommandName, err)
+			return 1
+		}
+
+		return 0
+	}
+
+	summary, err := Run(opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", CommandName, err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(summary); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", CommandName, err)
+		return 1
+	}
+
+	return 0
+}
+
+// Run generates the fixtures described by opts. The domains are generated
+// concurrently, each from its own seed so the output does not depend on the
+// order they are generated in.
+func Run(opts Options) (*Summary, error) {
+	output, err := validateOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{pagesDir, apiDir} {
+		if err := os.MkdirAll(filepath.Join(output, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		summary  = &Summary{}
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	domains := make(chan int)
+
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for index := range domains {
+				stats, err := generateDomain(output, opts, index)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				summary.add(stats)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for index := 0; index < opts.Domains; index++ {
+		domains <- index
+	}
+	close(domains)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return summary, nil
+}
+
+func (s *Summary) add(other Summary) {
+	s.Domains += other.Domains
+	s.Projects += other.Projects
+	s.Files += other.Files
+	s.Bytes += other.Bytes
+}
+
+func validateOptions(opts Options) (string, error) {
+	if opts.OutputDir == "" {
+		return "", errNoOutputDir
+	}
+
+	if opts.PagesDomain == "" {
+		return "", errNoPagesDomain
+	}
+
+	if opts.Domains <= 0 || opts.Projects <= 0 || opts.Files <= 0 {
+		return "", errScale
+	}
+
+	if opts.FileSize < 0 || opts.Redirects < 0 || opts.Headers < 0 {
+		return "", errNegative
+	}
+
+	// the API payloads hold the absolute path of the archives
+	output, err := filepath.Abs(opts.OutputDir)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(output)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	if len(entries) > 0 {
+		return "", errOutputNotEmpty
+	}
+
+	return output, nil
+}
+
+// generateDomain writes the archives of the projects of the domain and the
+// API payload of the domain
+func generateDomain(output string, opts Options, index int) (Summary, error) {
+	group := fmt.Sprintf("group-%d", index)
+	host := fmt.Sprintf("%s.%s", group, opts.PagesDomain)
+	stats := Summary{Domains: 1}
+
+	domain := api.VirtualDomain{LookupPaths: make([]api.LookupPath, 0, opts.Projects)}
+
+	for p := 0; p < opts.Projects; p++ {
+		project, prefix := fmt.Sprintf("project-%d", p), fmt.Sprintf("/project-%d/", p)
+		if p == 0 {
+			// the namespace project is served at the root of the domain
+			project, prefix = host, "/"
+		}
+
+		archivePath := filepath.Join(output, pagesDir, group, project, "public.zip")
+		seed := opts.Seed + int64(index)*int64(opts.Projects) + int64(p)
+
+		archive, err := writeArchive(archivePath, newSite(opts, seed))
+		if err != nil {
+			return stats, fmt.Errorf("%s%s: %w", host, prefix, err)
+		}
+
+		stats.Projects++
+		stats.Files += archive.fileCount
+		stats.Bytes += archive.size
+
+		domain.LookupPaths = append(domain.LookupPaths, api.LookupPath{
+			ProjectID: index*opts.Projects + p + 1,
+			Prefix:    prefix,
+			Source: api.Source{
+				Type:   "zip",
+				Path:   "file://" + archivePath,
+				SHA256: archive.sha256,
+				Count:  archive.fileCount,
+				Size:   int(archive.size),
+			},
+		})
+	}
+
+	payload, err := json.Marshal(domain)
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, os.WriteFile(filepath.Join(output, apiDir, host+".json"), payload, 0644)
+}
@@ -0,0 +1,199 @@
+package fixturegen
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+)
+
+func testOptions(t *testing.T) Options {
+	t.Helper()
+
+	return Options{
+		OutputDir:   filepath.Join(t.TempDir(), "fixtures"),
+		PagesDomain: "example.io",
+		Domains:     3,
+		Projects:    2,
+		Files:       10,
+		FileSize:    128,
+		Redirects:   2,
+		Headers:     1,
+		Seed:        1,
+	}
+}
+
+func readPayload(t *testing.T, opts Options, host string) api.VirtualDomain {
+	t.Helper()
+
+	payload, err := os.ReadFile(filepath.Join(opts.OutputDir, apiDir, host+".json"))
+	require.NoError(t, err)
+
+	var domain api.VirtualDomain
+	require.NoError(t, json.Unmarshal(payload, &domain))
+
+	return domain
+}
+
+func TestRun(t *testing.T) {
+	opts := testOptions(t)
+
+	summary, err := Run(opts)
+	require.NoError(t, err)
+	require.Equal(t, 3, summary.Domains)
+	require.Equal(t, 6, summary.Projects)
+	// each project has its files, `_redirects` and `_headers`
+	require.Equal(t, 6*12, summary.Files)
+
+	domain := readPayload(t, opts, "group-1.example.io")
+	require.Len(t, domain.LookupPaths, 2)
+	require.Equal(t, "/", domain.LookupPaths[0].Prefix)
+	require.Equal(t, "/project-1/", domain.LookupPaths[1].Prefix)
+	require.Equal(t, 4, domain.LookupPaths[1].ProjectID)
+
+	source := domain.LookupPaths[0].Source
+	require.Equal(t, "zip", source.Type)
+	require.Equal(t, "file://"+filepath.Join(opts.OutputDir, pagesDir, "group-1", "group-1.example.io", "public.zip"), source.Path)
+
+	archive, err := os.ReadFile(strings.TrimPrefix(source.Path, "file://"))
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(archive)
+	require.Equal(t, hex.EncodeToString(sum[:]), source.SHA256)
+	require.Equal(t, len(archive), source.Size)
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+	require.Len(t, zr.File, source.Count)
+
+	names := make(map[string]bool, len(zr.File))
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	require.True(t, names["public/index.html"])
+	require.True(t, names["public/404.html"])
+	require.True(t, names["public/_redirects"])
+	require.True(t, names["public/_headers"])
+}
+
+func TestRunIsReproducible(t *testing.T) {
+	first, second := testOptions(t), testOptions(t)
+
+	_, err := Run(first)
+	require.NoError(t, err)
+	_, err = Run(second)
+	require.NoError(t, err)
+
+	require.Equal(t,
+		readPayload(t, first, "group-2.example.io").LookupPaths[1].Source.SHA256,
+		readPayload(t, second, "group-2.example.io").LookupPaths[1].Source.SHA256,
+	)
+}
+
+func TestRunValidation(t *testing.T) {
+	tests := map[string]struct {
+		mutate      func(*Options)
+		expectedErr error
+	}{
+		"no_output_dir": {
+			mutate:      func(o *Options) { o.OutputDir = "" },
+			expectedErr: errNoOutputDir,
+		},
+		"no_pages_domain": {
+			mutate:      func(o *Options) { o.PagesDomain = "" },
+			expectedErr: errNoPagesDomain,
+		},
+		"no_domains": {
+			mutate:      func(o *Options) { o.Domains = 0 },
+			expectedErr: errScale,
+		},
+		"negative_file_size": {
+			mutate:      func(o *Options) { o.FileSize = -1 },
+			expectedErr: errNegative,
+		},
+		"output_dir_not_empty": {
+			mutate: func(o *Options) {
+				require.NoError(t, os.MkdirAll(o.OutputDir, 0755))
+				require.NoError(t, os.WriteFile(filepath.Join(o.OutputDir, "file"), nil, 0644))
+			},
+			expectedErr: errOutputNotEmpty,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := testOptions(t)
+			tt.mutate(&opts)
+
+			_, err := Run(opts)
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestAPIHandler(t *testing.T) {
+	opts := testOptions(t)
+	opts.Domains = 1
+
+	_, err := Run(opts)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(APIHandler(filepath.Join(opts.OutputDir, apiDir)))
+	defer server.Close()
+
+	tests := map[string]struct {
+		path           string
+		expectedStatus int
+	}{
+		"status":           {path: "/api/v4/internal/pages/status", expectedStatus: http.StatusNoContent},
+		"domain":           {path: "/api/v4/internal/pages?host=GROUP-0.example.io", expectedStatus: http.StatusOK},
+		"unknown_domain":   {path: "/api/v4/internal/pages?host=group-1.example.io", expectedStatus: http.StatusNoContent},
+		"path_traversal":   {path: "/api/v4/internal/pages?host=../group-0.example.io", expectedStatus: http.StatusBadRequest},
+		"hidden_file_host": {path: "/api/v4/internal/pages?host=.example.io", expectedStatus: http.StatusBadRequest},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := http.Get(server.URL + tt.path)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			require.Equal(t, tt.expectedStatus, res.StatusCode)
+
+			if tt.expectedStatus == http.StatusOK {
+				require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				require.Contains(t, string(body), `"prefix":"/"`)
+			}
+		})
+	}
+}
+
+func TestMainGeneratesFixtures(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	code := Main([]string{"-output-dir", dir, "-domains", "2", "-files", "4", "-file-size", "64"}, &stdout, &stderr)
+	require.Zero(t, code, stderr.String())
+
+	var summary Summary
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &summary))
+	require.Equal(t, 2, summary.Domains)
+	require.Equal(t, 4, summary.Projects)
+
+	require.Equal(t, 2, Main([]string{"-unknown"}, &stdout, &stderr))
+}
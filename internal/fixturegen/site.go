@@ -0,0 +1,169 @@
+package fixturegen
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// file is a file of a generated site, its path is relative to `public/`
+type file struct {
+	path    string
+	content []byte
+}
+
+type archiveStats struct {
+	sha256    string
+	fileCount int
+	size      int64
+}
+
+// newSite generates the files of a site: an index and a 404 page, and a mix
+// of HTML pages, scripts, stylesheets and incompressible images
+func newSite(opts Options, seed int64) []file {
+	rng := rand.New(rand.NewSource(seed))
+
+	files := []file{
+		{path: "index.html", content: htmlPage("index", pageSize(rng, opts.FileSize))},
+		{path: "404.html", content: htmlPage("not found", pageSize(rng, opts.FileSize))},
+	}
+
+	for i := len(files); i < opts.Files; i++ {
+		size := pageSize(rng, opts.FileSize)
+
+		switch i % 4 {
+		case 0:
+			files = append(files, file{path: fmt.Sprintf("docs/page-%d/index.html", i), content: htmlPage(fmt.Sprintf("page %d", i), size)})
+		case 1:
+			files = append(files, file{path: fmt.Sprintf("assets/app-%d.js", i), content: text("console.log('app');\n", size)})
+		case 2:
+			files = append(files, file{path: fmt.Sprintf("assets/style-%d.css", i), content: text("body { margin: 0; }\n", size)})
+		case 3:
+			image := make([]byte, size)
+			rng.Read(image)
+			files = append(files, file{path: fmt.Sprintf("images/image-%d.png", i), content: image})
+		}
+	}
+
+	if opts.Redirects > 0 {
+		files = append(files, file{path: "_redirects", content: redirects(opts.Redirects)})
+	}
+
+	if opts.Headers > 0 {
+		files = append(files, file{path: "_headers", content: headers(opts.Headers)})
+	}
+
+	return files
+}
+
+// pageSize returns an exponentially distributed size around average, as
+// most files of a site are small and a few are large
+func pageSize(rng *rand.Rand, average int) int {
+	return int(rng.ExpFloat64() * float64(average))
+}
+
+func htmlPage(title string, size int) []byte {
+	head := fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head><title>%s</title></head>\n<body>\n", title)
+	tail := "</body>\n</html>\n"
+
+	page := append([]byte(head), text("<p>Lorem ipsum dolor sit amet.</p>\n", size-len(head)-len(tail))...)
+
+	return append(page, tail...)
+}
+
+// text repeats line up to size bytes
+func text(line string, size int) []byte {
+	if size <= 0 {
+		return []byte{}
+	}
+
+	return []byte(strings.Repeat(line, size/len(line)+1)[:size])
+}
+
+func redirects(rules int) []byte {
+	var b bytes.Buffer
+
+	for i := 0; i < rules; i++ {
+		// the generated pages are every fourth file
+		fmt.Fprintf(&b, "/old-%d /docs/page-%d/ 301\n", i, (i+1)*4)
+	}
+
+	return b.Bytes()
+}
+
+func headers(rules int) []byte {
+	var b bytes.Buffer
+
+	for i := 0; i < rules; i++ {
+		if i%2 == 0 {
+			fmt.Fprintf(&b, "/assets/*\n  Cache-Control: public, max-age=%d\n", 3600*(i+1))
+		} else {
+			fmt.Fprintf(&b, "/docs/*\n  X-Frame-Options: DENY\n")
+		}
+	}
+
+	return b.Bytes()
+}
+
+// writeArchive writes files to a zip archive at archivePath, with all the
+// entries under `public/`, the layout expected by zip serving
+func writeArchive(archivePath string, files []file) (*archiveStats, error) {
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(f, hash)}
+
+	zw := zip.NewWriter(counter)
+
+	for _, file := range files {
+		w, err := zw.Create("public/" + file.path)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write(file.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	return &archiveStats{
+		sha256:    hex.EncodeToString(hash.Sum(nil)),
+		fileCount: len(files),
+		size:      counter.n,
+	}, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
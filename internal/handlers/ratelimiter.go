@@ -2,17 +2,30 @@ package handlers
 
 import (
 	"net/http"
+	"path"
 
+	"gitlab.com/gitlab-org/gitlab-pages/internal/auth"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/feature"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/ratelimiter"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/tarpit"
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
 
-// Ratelimiter configures the ratelimiter middleware
+// Ratelimiter configures the ratelimiter middleware, requests above the
+// enforced limits of the source IP and domain limiters are tarpitted by tp
+// when it is not nil. The domains of s can override the domain limit. The
+// source IP allowlist and denylist are evaluated before the source IP limit.
 // TODO: make this unexported once https://gitlab.com/gitlab-org/gitlab-pages/-/issues/670 is done
-func Ratelimiter(handler http.Handler, config *config.RateLimit) http.Handler {
+func Ratelimiter(handler http.Handler, config *config.RateLimit, s source.Source, tp *tarpit.Tarpit) http.Handler {
+	limited := tp.Handler(tarpit.ReasonRateLimited, http.StatusTooManyRequests, http.HandlerFunc(httperrors.Serve429))
+
+	// the networks are checked by config.Validate
+	allowed, denied, _ := config.Networks()
+
 	sourceIPLimiter := ratelimiter.New(
 		"source_ip",
 		ratelimiter.WithCacheMaxSize(ratelimiter.DefaultSourceIPCacheSize),
@@ -21,11 +34,13 @@ func Ratelimiter(handler http.Handler, config *config.RateLimit) http.Handler {
 		ratelimiter.WithBlockedCountMetric(metrics.RateLimitSourceIPBlockedCount),
 		ratelimiter.WithLimitPerSecond(config.SourceIPLimitPerSecond),
 		ratelimiter.WithBurstSize(config.SourceIPBurst),
-		ratelimiter.WithEnforce(feature.EnforceIPRateLimits.Enabled()),
+		ratelimiter.WithDecisionsMetric(metrics.RateLimitDecisions),
+		ratelimiter.WithEnforce(!config.DryRun && feature.EnforceIPRateLimits.Enabled()),
+		ratelimiter.WithLimitedHandler(limited),
+		ratelimiter.WithAllowedNetworks(allowed),
+		ratelimiter.WithDeniedNetworks(denied),
 	)
 
-	handler = sourceIPLimiter.Middleware(handler)
-
 	domainLimiter := ratelimiter.New(
 		"domain",
 		ratelimiter.WithCacheMaxSize(ratelimiter.DefaultDomainCacheSize),
@@ -35,8 +50,147 @@ func Ratelimiter(handler http.Handler, config *config.RateLimit) http.Handler {
 		ratelimiter.WithBlockedCountMetric(metrics.RateLimitDomainBlockedCount),
 		ratelimiter.WithLimitPerSecond(config.DomainLimitPerSecond),
 		ratelimiter.WithBurstSize(config.DomainBurst),
-		ratelimiter.WithEnforce(feature.EnforceDomainRateLimits.Enabled()),
+		ratelimiter.WithLimitFunc(domainLimits(s)),
+		ratelimiter.WithDecisionsMetric(metrics.RateLimitDecisions),
+		ratelimiter.WithEnforce(!config.DryRun && feature.EnforceDomainRateLimits.Enabled()),
+		ratelimiter.WithLimitedHandler(limited),
 	)
 
-	return domainLimiter.Middleware(handler)
+	// middleware is evaluated in reverse order, the source IP limiter comes first
+	// so that the denied networks are rejected before any token bucket
+	handler = authRatelimiter(handler, config)
+	handler = pathRatelimiter(handler, config, limited)
+	handler = domainLimiter.Middleware(handler)
+
+	return sourceIPLimiter.Middleware(handler)
+}
+
+// domainLimits returns the rate limit configured in GitLab for the domain of
+// the request. The domains are looked up before routing, from the cache of the
+// source for the domains already served.
+func domainLimits(s source.Source) ratelimiter.LimitFunc {
+	if s == nil {
+		return nil
+	}
+
+	return func(r *http.Request) (float64, int, bool) {
+		d, err := s.GetDomain(r.Context(), request.GetHostWithoutPort(r))
+		if err != nil || d == nil || d.RateLimit == nil {
+			return 0, 0, false
+		}
+
+		return d.RateLimit.LimitPerSecond, d.RateLimit.Burst, true
+	}
+}
+
+// pathRatelimiter applies the limits of the paths matching the patterns of
+// config to each domain, so that large downloads get a budget of their own.
+// The first matching pattern applies, the other paths are not limited.
+func pathRatelimiter(handler http.Handler, config *config.RateLimit, limited http.Handler) http.Handler {
+	// the rules are checked by config.Validate
+	limits, _ := config.PathLimits()
+	if len(limits) == 0 {
+		return handler
+	}
+
+	match := func(r *http.Request) int {
+		urlPath := path.Clean(r.URL.Path)
+		for i := range limits {
+			if matchPathPattern(limits[i].Pattern, urlPath) {
+				return i
+			}
+		}
+
+		return -1
+	}
+
+	pathLimiter := ratelimiter.New(
+		"path",
+		ratelimiter.WithCacheMaxSize(ratelimiter.DefaultPathCacheSize),
+		ratelimiter.WithKeyFunc(func(r *http.Request) string {
+			if i := match(r); i >= 0 {
+				return request.GetHostWithoutPort(r) + limits[i].Pattern
+			}
+
+			return ""
+		}),
+		ratelimiter.WithLimitFunc(func(r *http.Request) (float64, int, bool) {
+			if i := match(r); i >= 0 {
+				return limits[i].LimitPerSecond, limits[i].Burst, true
+			}
+
+			return 0, 0, false
+		}),
+		ratelimiter.WithCachedEntriesMetric(metrics.RateLimitPathCachedEntries),
+		ratelimiter.WithCachedRequestsMetric(metrics.RateLimitPathCacheRequests),
+		ratelimiter.WithBlockedCountMetric(metrics.RateLimitPathBlockedCount),
+		ratelimiter.WithDecisionsMetric(metrics.RateLimitDecisions),
+		ratelimiter.WithEnforce(!config.DryRun),
+		ratelimiter.WithLimitedHandler(limited),
+	)
+
+	return pathLimiter.Middleware(handler)
+}
+
+// matchPathPattern returns true if urlPath matches pattern, where * matches
+// any sequence of characters, including slashes
+func matchPathPattern(pattern, urlPath string) bool {
+	p, u := 0, 0
+	star, mark := -1, 0
+
+	for u < len(urlPath) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, u
+			p++
+		case p < len(pattern) && pattern[p] == urlPath[u]:
+			p++
+			u++
+		case star >= 0:
+			// backtrack, the last * matches one more character
+			p = star + 1
+			mark++
+			u = mark
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// authRatelimiter applies a dedicated source IP rate limit to the auth endpoints
+// so OAuth state brute forcing and callback flooding can be throttled without
+// sharing buckets with regular content serving
+func authRatelimiter(handler http.Handler, config *config.RateLimit) http.Handler {
+	if config.AuthLimitPerSecond <= 0.0 {
+		return handler
+	}
+
+	authLimiter := ratelimiter.New(
+		"auth",
+		ratelimiter.WithCacheMaxSize(ratelimiter.DefaultAuthCacheSize),
+		ratelimiter.WithCachedEntriesMetric(metrics.RateLimitAuthCachedEntries),
+		ratelimiter.WithCachedRequestsMetric(metrics.RateLimitAuthCacheRequests),
+		ratelimiter.WithBlockedCountMetric(metrics.RateLimitAuthBlockedCount),
+		ratelimiter.WithLimitPerSecond(config.AuthLimitPerSecond),
+		ratelimiter.WithBurstSize(config.AuthBurst),
+		ratelimiter.WithDecisionsMetric(metrics.RateLimitDecisions),
+		ratelimiter.WithEnforce(!config.DryRun),
+	)
+
+	limited := authLimiter.Middleware(handler)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == auth.CallbackPath {
+			limited.ServeHTTP(w, r)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
 }
@@ -5,10 +5,13 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/feature"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/mocks"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/testhelpers"
 )
 
@@ -85,7 +88,7 @@ func TestRatelimiter(t *testing.T) {
 				DomainBurst:            1,
 			}
 
-			handler := Ratelimiter(next, &conf)
+			handler := Ratelimiter(next, &conf, nil, nil)
 
 			r1 := httptest.NewRequest(http.MethodGet, tc.firstTarget, nil)
 			r1.RemoteAddr = tc.firstRemoteAddr
@@ -100,3 +103,193 @@ func TestRatelimiter(t *testing.T) {
 		})
 	}
 }
+
+func TestRatelimiterDomainOverride(t *testing.T) {
+	testhelpers.StubFeatureFlagValue(t, feature.EnforceDomainRateLimits.EnvVariable, true)
+
+	conf := config.RateLimit{
+		DomainLimitPerSecond: 0.1,
+		DomainBurst:          1,
+	}
+
+	source := mocks.NewMockSource(gomock.NewController(t))
+	source.EXPECT().GetDomain(gomock.Any(), "busy.gitlab.io").
+		Return(&domain.Domain{Name: "busy.gitlab.io", RateLimit: &domain.RateLimit{LimitPerSecond: 0.1, Burst: 3}}, nil).
+		AnyTimes()
+	source.EXPECT().GetDomain(gomock.Any(), "domain.gitlab.io").
+		Return(&domain.Domain{Name: "domain.gitlab.io"}, nil).
+		AnyTimes()
+
+	handler := Ratelimiter(next, &conf, source, nil)
+
+	codes := func(target string) []int {
+		var codes []int
+		for i := 0; i < 4; i++ {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			r.RemoteAddr = "10.0.0.1"
+
+			code, _ := testhelpers.PerformRequest(t, handler, r)
+			codes = append(codes, code)
+		}
+
+		return codes
+	}
+
+	require.Equal(t, []int{http.StatusNoContent, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes("https://domain.gitlab.io"))
+	require.Equal(t, []int{http.StatusNoContent, http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests}, codes("https://busy.gitlab.io"))
+}
+
+func TestRatelimiterDeniedNetworks(t *testing.T) {
+	testhelpers.StubFeatureFlagValue(t, feature.EnforceDomainRateLimits.EnvVariable, true)
+
+	conf := config.RateLimit{
+		DomainLimitPerSecond: 0.1,
+		DomainBurst:          1,
+		SourceIPDenylist:     []string{"10.0.0.2"},
+	}
+
+	handler := Ratelimiter(next, &conf, nil, nil)
+
+	r1 := httptest.NewRequest(http.MethodGet, "https://domain.gitlab.io", nil)
+	r1.RemoteAddr = "10.0.0.2"
+	code, _ := testhelpers.PerformRequest(t, handler, r1)
+	require.Equal(t, http.StatusForbidden, code)
+
+	// the denied request did not take the token of the domain
+	r2 := httptest.NewRequest(http.MethodGet, "https://domain.gitlab.io", nil)
+	r2.RemoteAddr = "10.0.0.1"
+	code, _ = testhelpers.PerformRequest(t, handler, r2)
+	require.Equal(t, http.StatusNoContent, code)
+}
+
+func TestPathRatelimiter(t *testing.T) {
+	conf := config.RateLimit{
+		PathRules: []string{"/*.zip=0.1:1", "/api/*=0.1:2"},
+	}
+
+	handler := Ratelimiter(next, &conf, nil, nil)
+
+	codes := func(target string) []int {
+		var codes []int
+		for i := 0; i < 3; i++ {
+			code, _ := testhelpers.PerformRequest(t, handler, httptest.NewRequest(http.MethodGet, target, nil))
+			codes = append(codes, code)
+		}
+
+		return codes
+	}
+
+	require.Equal(t, []int{http.StatusNoContent, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes("https://domain.gitlab.io/public/site.zip"))
+	require.Equal(t, []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes("https://domain.gitlab.io/other.zip"), "the pattern has a single budget per domain")
+	require.Equal(t, []int{http.StatusNoContent, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes("https://different.gitlab.io/site.zip"))
+	require.Equal(t, []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests}, codes("https://domain.gitlab.io/api/v1/data.json"))
+	require.Equal(t, []int{http.StatusNoContent, http.StatusNoContent, http.StatusNoContent}, codes("https://domain.gitlab.io/index.html"))
+}
+
+func TestMatchPathPattern(t *testing.T) {
+	tests := map[string]struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		"extension":          {pattern: "/*.zip", path: "/site.zip", matches: true},
+		"nested_extension":   {pattern: "/*.zip", path: "/a/b/site.zip", matches: true},
+		"other_extension":    {pattern: "/*.zip", path: "/site.zip.html", matches: false},
+		"prefix":             {pattern: "/api/*", path: "/api/v1/data", matches: true},
+		"prefix_itself":      {pattern: "/api/*", path: "/api/", matches: true},
+		"other_prefix":       {pattern: "/api/*", path: "/apis/v1", matches: false},
+		"exact":              {pattern: "/feed.xml", path: "/feed.xml", matches: true},
+		"several_wildcards":  {pattern: "/*/downloads/*.iso", path: "/project/downloads/os.iso", matches: true},
+		"backtracking":       {pattern: "/*a*b", path: "/xaxxab", matches: true},
+		"backtracking_fails": {pattern: "/*a*b", path: "/xaxxa", matches: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.matches, matchPathPattern(tt.pattern, tt.path))
+		})
+	}
+}
+
+func TestAuthRatelimiter(t *testing.T) {
+	tt := map[string]struct {
+		firstTarget        string
+		secondRemoteAddr   string
+		secondTarget       string
+		expectedSecondCode int
+	}{
+		"auth_callback_rejected": {
+			firstTarget:        "https://pages.gitlab.io/auth?code=1&state=state",
+			secondRemoteAddr:   "10.0.0.1",
+			secondTarget:       "https://pages.gitlab.io/auth?code=2&state=state",
+			expectedSecondCode: http.StatusTooManyRequests,
+		},
+		"auth_proxy_rejected_on_different_domain": {
+			firstTarget:        "https://pages.gitlab.io/auth?domain=https://domain.gitlab.io&state=state",
+			secondRemoteAddr:   "10.0.0.1",
+			secondTarget:       "https://domain.gitlab.io/auth?code=1&state=state",
+			expectedSecondCode: http.StatusTooManyRequests,
+		},
+		"auth_from_different_ip_passes": {
+			firstTarget:        "https://pages.gitlab.io/auth?code=1&state=state",
+			secondRemoteAddr:   "10.0.0.2",
+			secondTarget:       "https://pages.gitlab.io/auth?code=2&state=state",
+			expectedSecondCode: http.StatusNoContent,
+		},
+		"content_is_not_limited": {
+			firstTarget:        "https://pages.gitlab.io/auth?code=1&state=state",
+			secondRemoteAddr:   "10.0.0.1",
+			secondTarget:       "https://pages.gitlab.io/index.html",
+			expectedSecondCode: http.StatusNoContent,
+		},
+	}
+
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			conf := config.RateLimit{
+				AuthLimitPerSecond: 0.1,
+				AuthBurst:          1,
+			}
+
+			handler := Ratelimiter(next, &conf, nil, nil)
+
+			r1 := httptest.NewRequest(http.MethodGet, tc.firstTarget, nil)
+			r1.RemoteAddr = "10.0.0.1"
+
+			firstCode, _ := testhelpers.PerformRequest(t, handler, r1)
+			require.Equal(t, http.StatusNoContent, firstCode)
+
+			r2 := httptest.NewRequest(http.MethodGet, tc.secondTarget, nil)
+			r2.RemoteAddr = tc.secondRemoteAddr
+			secondCode, _ := testhelpers.PerformRequest(t, handler, r2)
+			require.Equal(t, tc.expectedSecondCode, secondCode)
+		})
+	}
+}
+
+func TestRatelimiterDryRun(t *testing.T) {
+	testhelpers.StubFeatureFlagValue(t, feature.EnforceIPRateLimits.EnvVariable, true)
+	testhelpers.StubFeatureFlagValue(t, feature.EnforceDomainRateLimits.EnvVariable, true)
+
+	conf := config.RateLimit{
+		SourceIPLimitPerSecond: 0.1,
+		SourceIPBurst:          1,
+		DomainLimitPerSecond:   0.1,
+		DomainBurst:            1,
+		AuthLimitPerSecond:     0.1,
+		AuthBurst:              1,
+		DryRun:                 true,
+	}
+
+	handler := Ratelimiter(next, &conf, nil, nil)
+
+	for _, target := range []string{"https://domain.gitlab.io", "https://domain.gitlab.io/auth?code=1&state=state"} {
+		for i := 0; i < 3; i++ {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			r.RemoteAddr = "10.0.0.1"
+
+			code, _ := testhelpers.PerformRequest(t, handler, r)
+			require.Equal(t, http.StatusNoContent, code, "requests are never rejected in dry run mode")
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package headerlimiter
+
+import (
+	"net/http"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// maxLoggedHeaderName is the length header names are truncated to in the logs
+const maxLoggedHeaderName = 64
+
+// NewMiddleware returns middleware which rejects requests whose headers are
+// larger than limit bytes with 431 Request Header Fields Too Large
+func NewMiddleware(handler http.Handler, limit int) http.Handler {
+	if limit == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, largest := headerSize(r)
+		if size > limit {
+			metrics.OversizedRequestsCount.WithLabelValues("headers").Inc()
+
+			log.WithFields(log.Fields{
+				"host":           logging.Truncate(r.Host, maxLoggedHeaderName),
+				"headers_size":   size,
+				"largest_header": logging.Truncate(largest, maxLoggedHeaderName),
+				"limit":          limit,
+			}).Info("request headers too large")
+
+			httperrors.Serve431(w)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// headerSize returns the size of the headers the way they are sent on the
+// wire, `Name: value\r\n` for every value, and the name of the largest one
+func headerSize(r *http.Request) (int, string) {
+	size := len(r.Host)
+	largest, largestSize := "", 0
+
+	for name, values := range r.Header {
+		headerSize := 0
+		for _, value := range values {
+			headerSize += len(name) + len(value) + len(": \r\n")
+		}
+
+		if headerSize > largestSize {
+			largest, largestSize = name, headerSize
+		}
+
+		size += headerSize
+	}
+
+	return size, largest
+}
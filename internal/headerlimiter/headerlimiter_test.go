@@ -0,0 +1,73 @@
+package headerlimiter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestNewMiddleware(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+	})
+
+	// "example.com" and "Cookie: " + value + "\r\n"
+	const baseSize = len("example.com") + len("Cookie: \r\n")
+
+	tests := map[string]struct {
+		limit          int
+		cookie         string
+		expectedStatus int
+	}{
+		"with_disabled_middleware": {
+			limit:          0,
+			cookie:         strings.Repeat("a", 1024),
+			expectedStatus: http.StatusOK,
+		},
+		"with_limit_set_to_headers_size": {
+			limit:          baseSize + 10,
+			cookie:         strings.Repeat("a", 10),
+			expectedStatus: http.StatusOK,
+		},
+		"with_headers_size_exceeding_the_limit": {
+			limit:          baseSize + 10,
+			cookie:         strings.Repeat("a", 11),
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			middleware := NewMiddleware(handler, tt.limit)
+			oversized := testutil.ToFloat64(metrics.OversizedRequestsCount.WithLabelValues("headers"))
+
+			ww := httptest.NewRecorder()
+			rr := httptest.NewRequest(http.MethodGet, "http://example.com/index.html", nil)
+			rr.Header.Set("Cookie", tt.cookie)
+
+			middleware.ServeHTTP(ww, rr)
+
+			res := ww.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tt.expectedStatus, res.StatusCode)
+			if tt.expectedStatus == http.StatusOK {
+				b, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+
+				require.Equal(t, "hello", string(b))
+				require.Equal(t, oversized, testutil.ToFloat64(metrics.OversizedRequestsCount.WithLabelValues("headers")))
+			} else {
+				require.Equal(t, oversized+1, testutil.ToFloat64(metrics.OversizedRequestsCount.WithLabelValues("headers")))
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Package htmlinject inserts an operator-configured snippet, such as a
+// cookie-consent banner or an instance-wide announcement, into the HTML
+// documents served by Pages. Documents are rewritten while they are
+// streamed to the client, they are never buffered in memory.
+//
+// The ETag of a rewritten document is tagged with a hash of the snippet, so
+// that changing the snippet invalidates the documents cached by the clients,
+// and the byte ranges of the documents are not served.
+package htmlinject
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/responsewriter"
+)
+
+// NewMiddleware returns middleware inserting the snippet of cfg before the
+// closing tag of the head or body element of the documents served by
+// handler. An empty snippet disables the middleware.
+func NewMiddleware(handler http.Handler, cfg *config.HTMLInjection) http.Handler {
+	if len(cfg.Snippet) == 0 {
+		return handler
+	}
+
+	marker := []byte("</" + cfg.Position + ">")
+	suffix := etagSuffix(cfg.Snippet, marker)
+
+	excluded := make(map[string]bool, len(cfg.ExcludedDomains))
+	for _, domain := range cfg.ExcludedDomains {
+		excluded[strings.ToLower(domain)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || excluded[strings.ToLower(request.GetHostWithoutPort(r))] {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		r, notModified := untagConditions(r, suffix)
+
+		iw := &injectingWriter{
+			Wrapper:     responsewriter.Wrapper{ResponseWriter: w},
+			snippet:     cfg.Snippet,
+			marker:      marker,
+			etagSuffix:  suffix,
+			notModified: notModified,
+		}
+
+		handler.ServeHTTP(iw, r)
+		iw.finish()
+
+		if !iw.rangeIgnored {
+			return
+		}
+
+		// the document is served in full, with the snippet
+		r = r.Clone(r.Context())
+		r.Header.Del("Range")
+		r.Header.Del("If-Range")
+
+		iw.reset()
+		handler.ServeHTTP(iw, r)
+		iw.finish()
+	})
+}
+
+// etagSuffix identifies the snippet and its position in the ETag of the
+// rewritten documents
+func etagSuffix(snippet, marker []byte) string {
+	sum := sha256.Sum256(append(append([]byte{}, marker...), snippet...))
+
+	return "-inject-" + hex.EncodeToString(sum[:4])
+}
+
+// untagConditions returns r with the ETags of If-None-Match tagged with
+// suffix replaced by the ETags of the documents as they are stored, and
+// whether there was any. The ETags tagged for another snippet are kept, they
+// never match.
+func untagConditions(r *http.Request, suffix string) (*http.Request, bool) {
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if !strings.Contains(ifNoneMatch, suffix+`"`) {
+		return r, false
+	}
+
+	etags := strings.Split(ifNoneMatch, ",")
+	for i, etag := range etags {
+		etags[i] = strings.Replace(strings.TrimSpace(etag), suffix+`"`, `"`, 1)
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("If-None-Match", strings.Join(etags, ", "))
+
+	return r, true
+}
@@ -0,0 +1,268 @@
+package htmlinject
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+)
+
+const snippet = "<script>banner()</script>"
+
+func TestNewMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		position     string
+		host         string
+		status       int
+		contentType  string
+		encoding     string
+		body         string
+		chunkSize    int
+		expectedBody string
+		unmodified   bool
+	}{
+		"head": {
+			position:     config.HTMLInjectHead,
+			body:         "<html><head><title>t</title></head><body>b</body></html>",
+			expectedBody: "<html><head><title>t</title>" + snippet + "</head><body>b</body></html>",
+		},
+		"body": {
+			position:     config.HTMLInjectBody,
+			body:         "<html><head></head><body>b</body></html>",
+			expectedBody: "<html><head></head><body>b" + snippet + "</body></html>",
+		},
+		"upper_case_tag": {
+			position:     config.HTMLInjectBody,
+			body:         "<HTML><BODY>b</BODY></HTML>",
+			expectedBody: "<HTML><BODY>b" + snippet + "</BODY></HTML>",
+		},
+		"tag_split_across_writes": {
+			position:     config.HTMLInjectHead,
+			body:         "<html><head></head><body></body></html>",
+			chunkSize:    1,
+			expectedBody: "<html><head>" + snippet + "</head><body></body></html>",
+		},
+		"partial_tag_before_tag": {
+			position:     config.HTMLInjectBody,
+			body:         "<p>a</b</p></body>",
+			chunkSize:    7,
+			expectedBody: "<p>a</b</p>" + snippet + "</body>",
+		},
+		"no_tag": {
+			position:     config.HTMLInjectBody,
+			body:         "<p>a</bod",
+			chunkSize:    3,
+			expectedBody: "<p>a</bod",
+		},
+		"content_type_with_charset": {
+			position:     config.HTMLInjectBody,
+			contentType:  "text/html; charset=utf-8",
+			body:         "<body></body>",
+			expectedBody: "<body>" + snippet + "</body>",
+		},
+		"not_html": {
+			position:     config.HTMLInjectBody,
+			contentType:  "text/plain",
+			body:         "<body></body>",
+			expectedBody: "<body></body>",
+			unmodified:   true,
+		},
+		"encoded": {
+			position:     config.HTMLInjectBody,
+			encoding:     "gzip",
+			body:         "<body></body>",
+			expectedBody: "<body></body>",
+			unmodified:   true,
+		},
+		"not_found": {
+			position:     config.HTMLInjectBody,
+			status:       http.StatusNotFound,
+			body:         "<body></body>",
+			expectedBody: "<body></body>",
+			unmodified:   true,
+		},
+		"excluded_domain": {
+			position:     config.HTMLInjectBody,
+			host:         "Excluded.Example.com:8080",
+			body:         "<body></body>",
+			expectedBody: "<body></body>",
+			unmodified:   true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType := tt.contentType
+				if contentType == "" {
+					contentType = "text/html"
+				}
+
+				w.Header().Set("Content-Type", contentType)
+				w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+
+				chunkSize := tt.chunkSize
+				if chunkSize == 0 {
+					chunkSize = len(tt.body)
+				}
+
+				for body := tt.body; len(body) > 0; {
+					n := chunkSize
+					if n > len(body) {
+						n = len(body)
+					}
+
+					w.Write([]byte(body[:n]))
+					body = body[n:]
+				}
+			})
+
+			middleware := NewMiddleware(handler, &config.HTMLInjection{
+				Snippet:         []byte(snippet),
+				Position:        tt.position,
+				ExcludedDomains: []string{"excluded.example.com"},
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "http://group.example.com/", nil)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+
+			w := httptest.NewRecorder()
+			middleware.ServeHTTP(w, r)
+
+			require.Equal(t, tt.expectedBody, w.Body.String())
+
+			if tt.unmodified {
+				require.Equal(t, strconv.Itoa(len(tt.body)), w.Header().Get("Content-Length"))
+			} else {
+				require.Empty(t, w.Header().Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestNewMiddlewareDisabled(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", "13")
+		w.Write([]byte("<body></body>"))
+	})
+
+	middleware := NewMiddleware(handler, &config.HTMLInjection{Position: config.HTMLInjectHead})
+
+	w := httptest.NewRecorder()
+	middleware.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://group.example.com/", nil))
+
+	require.Equal(t, "<body></body>", w.Body.String())
+	require.Equal(t, "13", w.Header().Get("Content-Length"))
+}
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (r *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	return nil, nil, nil
+}
+
+func TestNewMiddlewareHijack(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		require.True(t, ok)
+
+		_, _, err := hijacker.Hijack()
+		require.NoError(t, err)
+	})
+
+	middleware := NewMiddleware(handler, &config.HTMLInjection{
+		Snippet:  []byte(snippet),
+		Position: config.HTMLInjectHead,
+	})
+
+	w := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	middleware.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://group.example.com/ws", nil))
+
+	require.True(t, w.hijacked)
+}
+
+func TestNewMiddlewareConditionalRequests(t *testing.T) {
+	const document = "<html><head></head><body>b</body></html>"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"sha"`)
+		http.ServeContent(w, r, "index.html", time.Time{}, strings.NewReader(document))
+	})
+
+	newMiddleware := func(snippet string) http.Handler {
+		return NewMiddleware(handler, &config.HTMLInjection{
+			Snippet:  []byte(snippet),
+			Position: config.HTMLInjectBody,
+		})
+	}
+
+	serve := func(middleware http.Handler, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "http://group.example.com/", nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+
+		w := httptest.NewRecorder()
+		middleware.ServeHTTP(w, r)
+
+		return w
+	}
+
+	middleware := newMiddleware(snippet)
+
+	w := serve(middleware, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEqual(t, `"sha"`, etag)
+	require.True(t, strings.HasPrefix(etag, `"sha-`))
+
+	t.Run("not_modified", func(t *testing.T) {
+		w := serve(middleware, http.Header{"If-None-Match": []string{etag}})
+
+		require.Equal(t, http.StatusNotModified, w.Code)
+		require.Equal(t, etag, w.Header().Get("ETag"))
+	})
+
+	t.Run("snippet_changed", func(t *testing.T) {
+		changed := newMiddleware("<script>other()</script>")
+
+		w := serve(changed, http.Header{"If-None-Match": []string{etag}})
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NotEqual(t, etag, w.Header().Get("ETag"))
+		require.Contains(t, w.Body.String(), "<script>other()</script>")
+	})
+
+	t.Run("range", func(t *testing.T) {
+		w := serve(middleware, http.Header{"Range": []string{"bytes=0-5"}})
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Empty(t, w.Header().Get("Content-Range"))
+		require.Empty(t, w.Header().Get("Accept-Ranges"))
+		require.Equal(t, etag, w.Header().Get("ETag"))
+		require.Equal(t, "<html><head></head><body>b"+snippet+"</body></html>", w.Body.String())
+	})
+}
@@ -0,0 +1,205 @@
+package htmlinject
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/responsewriter"
+)
+
+// injectingWriter inserts the snippet before the first occurrence of marker
+// in the body of successful, unencoded HTML responses. Only the bytes which
+// could be the start of a marker split across writes are held back, also by
+// Flush. The byte ranges of a document are discarded, for the middleware to
+// serve it again in full.
+type injectingWriter struct {
+	responsewriter.Wrapper
+	snippet    []byte
+	marker     []byte
+	etagSuffix string
+	// notModified is set when the request was conditional on the ETag of a
+	// rewritten document
+	notModified bool
+
+	wroteHeader  bool
+	inject       bool
+	rangeIgnored bool
+	pending      []byte
+}
+
+func (iw *injectingWriter) WriteHeader(status int) {
+	if iw.wroteHeader {
+		return
+	}
+
+	iw.wroteHeader = true
+
+	if status == http.StatusPartialContent && isHTML(iw.Header()) {
+		iw.rangeIgnored = true
+		return
+	}
+
+	iw.inject = status == http.StatusOK && isHTML(iw.Header())
+
+	if iw.inject {
+		// the length of the document changes, and byte ranges of the
+		// original document no longer apply
+		iw.Header().Del("Content-Length")
+		iw.Header().Del("Accept-Ranges")
+	}
+
+	if iw.inject || (status == http.StatusNotModified && iw.notModified) {
+		iw.tagETag()
+	}
+
+	iw.ResponseWriter.WriteHeader(status)
+}
+
+// tagETag adds the suffix of the snippet to the ETag of the document
+func (iw *injectingWriter) tagETag() {
+	etag := iw.Header().Get("ETag")
+	if !strings.HasSuffix(etag, `"`) || strings.HasSuffix(etag, iw.etagSuffix+`"`) {
+		return
+	}
+
+	iw.Header().Set("ETag", strings.TrimSuffix(etag, `"`)+iw.etagSuffix+`"`)
+}
+
+// reset prepares the writer to serve the document again, once its byte
+// ranges were discarded
+func (iw *injectingWriter) reset() {
+	for _, h := range []string{"Content-Range", "Content-Length", "Content-Type"} {
+		iw.Header().Del(h)
+	}
+
+	iw.wroteHeader = false
+	iw.inject = false
+	iw.rangeIgnored = false
+	iw.pending = nil
+}
+
+func (iw *injectingWriter) Write(p []byte) (int, error) {
+	if !iw.wroteHeader {
+		iw.WriteHeader(http.StatusOK)
+	}
+
+	if iw.rangeIgnored {
+		return len(p), nil
+	}
+
+	if !iw.inject {
+		return iw.ResponseWriter.Write(p)
+	}
+
+	data := p
+	if len(iw.pending) > 0 {
+		data = append(iw.pending, p...)
+		iw.pending = nil
+	}
+
+	if i := indexFold(data, iw.marker); i >= 0 {
+		iw.inject = false
+
+		if err := iw.write(data[:i], iw.snippet, data[i:]); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	keep := partialMarkerSuffix(data, iw.marker)
+	if err := iw.write(data[:len(data)-keep]); err != nil {
+		return 0, err
+	}
+
+	iw.pending = append(iw.pending, data[len(data)-keep:]...)
+
+	return len(p), nil
+}
+
+func (iw *injectingWriter) write(chunks ...[]byte) error {
+	for _, chunk := range chunks {
+		if len(chunk) == 0 {
+			continue
+		}
+
+		if _, err := iw.ResponseWriter.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// finish writes the bytes held back by a document without the marker, which
+// is served without the snippet
+func (iw *injectingWriter) finish() {
+	if len(iw.pending) > 0 {
+		iw.write(iw.pending) // nolint:errcheck // the client went away
+		iw.pending = nil
+	}
+}
+
+func isHTML(header http.Header) bool {
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+
+	return err == nil && mediaType == "text/html"
+}
+
+// indexFold returns the index of the first ASCII case-insensitive instance
+// of marker in data, or -1. marker must be lower case.
+func indexFold(data, marker []byte) int {
+	for i := 0; i+len(marker) <= len(data); i++ {
+		if hasPrefixFold(data[i:], marker) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// partialMarkerSuffix returns the length of the longest suffix of data which
+// is a proper prefix of marker
+func partialMarkerSuffix(data, marker []byte) int {
+	n := len(marker) - 1
+	if n > len(data) {
+		n = len(data)
+	}
+
+	for ; n > 0; n-- {
+		if hasPrefixFold(marker, data[len(data)-n:]) {
+			return n
+		}
+	}
+
+	return 0
+}
+
+// hasPrefixFold reports whether s starts with the ASCII case-insensitive
+// prefix, where either may be the lower case marker
+func hasPrefixFold(s, prefix []byte) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+
+	for i := range prefix {
+		if lower(s[i]) != lower(prefix[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+
+	return c
+}
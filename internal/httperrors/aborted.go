@@ -0,0 +1,53 @@
+package httperrors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+
+	"gitlab.com/gitlab-org/labkit/correlation"
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// StatusClientClosedRequest is the status logged for the requests the client
+// aborted before they were served, as nginx does. Clients never receive it.
+const StatusClientClosedRequest = 499
+
+// IsClientAborted reports whether err is caused by the client of r going away,
+// by cancelling the request or closing the connection, rather than by a
+// failure of the server
+func IsClientAborted(r *http.Request, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(r.Context().Err(), context.Canceled)
+}
+
+// LogClientAborted counts and logs the request the client aborted during op,
+// without reporting it as an error
+func LogClientAborted(r *http.Request, op string, err error) {
+	metrics.ClientAbortedRequests.WithLabelValues(op).Inc()
+
+	log.WithFields(log.Fields{
+		"correlation_id": correlation.ExtractFromContext(r.Context()),
+		"host":           r.Host,
+		"path":           r.URL.Path,
+		"op":             op,
+	}).WithError(err).Info("client aborted the request")
+}
+
+// ServeClientAborted counts and logs the request the client aborted during
+// op, and responds with StatusClientClosedRequest so that it is not counted as
+// an error of the server
+func ServeClientAborted(w http.ResponseWriter, r *http.Request, op string, err error) {
+	LogClientAborted(r, op, err)
+
+	w.WriteHeader(StatusClientClosedRequest)
+}
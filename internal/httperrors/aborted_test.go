@@ -0,0 +1,90 @@
+package httperrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestIsClientAborted(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := map[string]struct {
+		ctx      context.Context
+		err      error
+		expected bool
+	}{
+		"no error": {
+			ctx: canceled,
+		},
+		"context canceled": {
+			ctx:      context.Background(),
+			err:      fmt.Errorf("open archive: %w", context.Canceled),
+			expected: true,
+		},
+		"broken pipe": {
+			ctx:      context.Background(),
+			err:      &os.SyscallError{Syscall: "write", Err: syscall.EPIPE},
+			expected: true,
+		},
+		"connection reset": {
+			ctx:      context.Background(),
+			err:      &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET},
+			expected: true,
+		},
+		"request canceled": {
+			ctx:      canceled,
+			err:      errors.New("net/http: request canceled"),
+			expected: true,
+		},
+		"deadline exceeded": {
+			ctx: context.Background(),
+			err: context.DeadlineExceeded,
+		},
+		"server error": {
+			ctx: context.Background(),
+			err: errors.New("archive is corrupted"),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(tt.ctx)
+
+			require.Equal(t, tt.expected, IsClientAborted(r, tt.err))
+		})
+	}
+}
+
+func TestServe500WithRequestClientAborted(t *testing.T) {
+	before := testutil.ToFloat64(metrics.ClientAbortedRequests.WithLabelValues("root.Open"))
+
+	w := newTestResponseWriter(httptest.NewRecorder())
+	Serve500WithRequest(w, httptest.NewRequest(http.MethodGet, "/", nil), "root.Open", context.Canceled)
+
+	require.Equal(t, StatusClientClosedRequest, w.Status())
+	require.Empty(t, w.Content())
+	require.Equal(t, before+1, testutil.ToFloat64(metrics.ClientAbortedRequests.WithLabelValues("root.Open")))
+}
+
+func TestServe500WithRequestServerError(t *testing.T) {
+	before := testutil.ToFloat64(metrics.ClientAbortedRequests.WithLabelValues("root.Open"))
+
+	w := newTestResponseWriter(httptest.NewRecorder())
+	Serve500WithRequest(w, httptest.NewRequest(http.MethodGet, "/", nil), "root.Open", errors.New("archive is corrupted"))
+
+	require.Equal(t, http.StatusInternalServerError, w.Status())
+	require.Contains(t, w.Content(), content500.header)
+	require.Equal(t, before, testutil.ToFloat64(metrics.ClientAbortedRequests.WithLabelValues("root.Open")))
+}
@@ -1,8 +1,12 @@
 package httperrors
 
 import (
+	"encoding/json"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"gitlab.com/gitlab-org/labkit/correlation"
 	"gitlab.com/gitlab-org/labkit/errortracking"
@@ -25,6 +29,14 @@ var (
 		"You don't have permission to access the resource.",
 		`<p>The resource that you are attempting to access is protected and you don't have the necessary permissions to view it.</p>`,
 	}
+	content403 = content{
+		http.StatusForbidden,
+		"Forbidden (403)",
+		"403",
+		"You don't have permission to access the resource.",
+		`<p>Requests from your network are not allowed.</p>
+     <p>Please contact your GitLab administrator if you think this is a mistake.</p>`,
+	}
 	content404 = content{
 		http.StatusNotFound,
 		"The page you're looking for could not be found (404)",
@@ -43,6 +55,24 @@ var (
 			<p>Try to make the request URI shorter.</p>`,
 	}
 
+	content413 = content{
+		status:       http.StatusRequestEntityTooLarge,
+		title:        "Request Entity Too Large (413)",
+		statusString: "413",
+		header:       "Request Entity Too Large.",
+		subHeader: `<p>The request body was too large for the server to process.</p>
+			<p>Pages only serves content, try the request without a body.</p>`,
+	}
+
+	content431 = content{
+		status:       http.StatusRequestHeaderFieldsTooLarge,
+		title:        "Request Header Fields Too Large (431)",
+		statusString: "431",
+		header:       "Request Header Fields Too Large.",
+		subHeader: `<p>The request headers were too large for the server to process.</p>
+			<p>Try to clear the cookies of this site.</p>`,
+	}
+
 	content429 = content{
 		http.StatusTooManyRequests,
 		"Too many requests (429)",
@@ -175,55 +205,149 @@ func generateErrorHTML(c content) string {
 	return fmt.Sprintf(predefinedErrorPage, c.title, c.statusString, c.header, c.subHeader)
 }
 
-func serveErrorPage(w http.ResponseWriter, c content) {
+// serveErrorPage serves the custom error page of c if there is one, or the
+// embedded page otherwise. r can be nil.
+func serveErrorPage(w http.ResponseWriter, r *http.Request, c content) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(c.status)
+
+	if page := renderCustomPage(r, c); page != nil {
+		// nolint: errcheck
+		// the status has already been sent, there is nothing left to do on failure
+		w.Write(page)
+		return
+	}
+
 	fmt.Fprintln(w, generateErrorHTML(c))
 }
 
+// errorJSON is the body of the error responses served to clients accepting JSON
+type errorJSON struct {
+	Code          int    `json:"code"`
+	Message       string `json:"message"`
+	CorrelationID string `json:"correlation_id"`
+
+	// RetryAfter repeats the Retry-After header in seconds, when it is set
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// serveError serves c as JSON to the clients that ask for it, so that
+// applications hosted on Pages can handle failures programmatically, and as
+// an HTML page otherwise
+func serveError(w http.ResponseWriter, r *http.Request, c content) {
+	if !acceptsJSON(r) {
+		serveErrorPage(w, r, c)
+		return
+	}
+
+	retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(c.status)
+
+	// nolint: errcheck
+	// the status has already been sent, there is nothing left to do on failure
+	json.NewEncoder(w).Encode(errorJSON{
+		Code:          c.status,
+		Message:       c.header,
+		CorrelationID: correlation.ExtractFromContext(r.Context()),
+		RetryAfter:    retryAfter,
+	})
+}
+
+// acceptsJSON returns true if the Accept header of r lists application/json
+// without excluding it with a zero quality value
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil || mediaType != "application/json" {
+				continue
+			}
+
+			if q, ok := params["q"]; ok && strings.Trim(q, "0.") == "" {
+				continue
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
+
 // Serve401 returns a 401 error response / HTML page to the http.ResponseWriter
 func Serve401(w http.ResponseWriter) {
-	serveErrorPage(w, content401)
+	serveErrorPage(w, nil, content401)
 }
 
-// Serve404 returns a 404 error response / HTML page to the http.ResponseWriter
-func Serve404(w http.ResponseWriter) {
-	serveErrorPage(w, content404)
+// Serve403 returns a 403 error response / HTML page or JSON body, depending on
+// the Accept header of r, to the http.ResponseWriter
+func Serve403(w http.ResponseWriter, r *http.Request) {
+	serveError(w, r, content403)
+}
+
+// Serve404 returns a 404 error response / HTML page or JSON body, depending on
+// the Accept header of r, to the http.ResponseWriter
+func Serve404(w http.ResponseWriter, r *http.Request) {
+	serveError(w, r, content404)
 }
 
 // Serve414 returns a 414 error response / HTML page to the http.ResponseWriter
 func Serve414(w http.ResponseWriter) {
-	serveErrorPage(w, content414)
+	serveErrorPage(w, nil, content414)
+}
+
+// Serve413 returns a 413 error response / HTML page to the http.ResponseWriter
+func Serve413(w http.ResponseWriter) {
+	serveErrorPage(w, nil, content413)
 }
 
-// Serve429 returns a 429 error response / HTML page to the http.ResponseWriter
-func Serve429(w http.ResponseWriter) {
-	serveErrorPage(w, content429)
+// Serve431 returns a 431 error response / HTML page to the http.ResponseWriter
+func Serve431(w http.ResponseWriter) {
+	serveErrorPage(w, nil, content431)
 }
 
-// Serve500 returns a 500 error response / HTML page to the http.ResponseWriter
-func Serve500(w http.ResponseWriter) {
-	serveErrorPage(w, content500)
+// Serve429 returns a 429 error response / HTML page or JSON body, depending on
+// the Accept header of r, to the http.ResponseWriter. The JSON body holds the
+// Retry-After header already set on w.
+func Serve429(w http.ResponseWriter, r *http.Request) {
+	serveError(w, r, content429)
 }
 
-// Serve500WithRequest returns a 500 error response / HTML page to the http.ResponseWriter
+// Serve500 returns a 500 error response / HTML page or JSON body, depending on
+// the Accept header of r, to the http.ResponseWriter
+func Serve500(w http.ResponseWriter, r *http.Request) {
+	serveError(w, r, content500)
+}
+
+// Serve500WithRequest returns a 500 error response / HTML page to the http.ResponseWriter,
+// unless err is caused by the client aborting the request
 func Serve500WithRequest(w http.ResponseWriter, r *http.Request, reason string, err error) {
+	if IsClientAborted(r, err) {
+		ServeClientAborted(w, r, reason, err)
+		return
+	}
+
 	log.WithFields(log.Fields{
 		"correlation_id": correlation.ExtractFromContext(r.Context()),
 		"host":           r.Host,
 		"path":           r.URL.Path,
 	}).WithError(err).Error(reason)
 	errortracking.Capture(err, errortracking.WithRequest(r), errortracking.WithStackTrace())
-	serveErrorPage(w, content500)
+	serveError(w, r, content500)
 }
 
-// Serve502 returns a 502 error response / HTML page to the http.ResponseWriter
-func Serve502(w http.ResponseWriter) {
-	serveErrorPage(w, content502)
+// Serve502 returns a 502 error response / HTML page or JSON body, depending on
+// the Accept header of r, to the http.ResponseWriter
+func Serve502(w http.ResponseWriter, r *http.Request) {
+	serveError(w, r, content502)
 }
 
-// Serve503 returns a 503 error response / HTML page to the http.ResponseWriter
-func Serve503(w http.ResponseWriter) {
-	serveErrorPage(w, content503)
+// Serve503 returns a 503 error response / HTML page or JSON body, depending on
+// the Accept header of r, to the http.ResponseWriter
+func Serve503(w http.ResponseWriter, r *http.Request) {
+	serveError(w, r, content503)
 }
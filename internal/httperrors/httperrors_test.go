@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/labkit/correlation"
 )
 
 // creates a new implementation of http.ResponseWriter that allows the
@@ -62,7 +64,7 @@ func TestGenerateemailHTML(t *testing.T) {
 
 func TestServeErrorPage(t *testing.T) {
 	w := newTestResponseWriter(httptest.NewRecorder())
-	serveErrorPage(w, testingContent)
+	serveErrorPage(w, nil, testingContent)
 	require.Equal(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
 	require.Equal(t, w.Header().Get("X-Content-Type-Options"), "nosniff")
 	require.Equal(t, w.Status(), testingContent.status)
@@ -80,9 +82,21 @@ func TestServe401(t *testing.T) {
 	require.Contains(t, w.Content(), content401.subHeader)
 }
 
+func TestServe403(t *testing.T) {
+	w := newTestResponseWriter(httptest.NewRecorder())
+	Serve403(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
+	require.Equal(t, w.Header().Get("X-Content-Type-Options"), "nosniff")
+	require.Equal(t, w.Status(), content403.status)
+	require.Contains(t, w.Content(), content403.title)
+	require.Contains(t, w.Content(), content403.statusString)
+	require.Contains(t, w.Content(), content403.header)
+	require.Contains(t, w.Content(), content403.subHeader)
+}
+
 func TestServe404(t *testing.T) {
 	w := newTestResponseWriter(httptest.NewRecorder())
-	Serve404(w)
+	Serve404(w, httptest.NewRequest(http.MethodGet, "/", nil))
 	require.Equal(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
 	require.Equal(t, w.Header().Get("X-Content-Type-Options"), "nosniff")
 	require.Equal(t, w.Status(), content404.status)
@@ -104,9 +118,21 @@ func TestServe414(t *testing.T) {
 	require.Contains(t, w.Content(), content414.subHeader)
 }
 
+func TestServe431(t *testing.T) {
+	w := newTestResponseWriter(httptest.NewRecorder())
+	Serve431(w)
+	require.Equal(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
+	require.Equal(t, w.Header().Get("X-Content-Type-Options"), "nosniff")
+	require.Equal(t, w.Status(), content431.status)
+	require.Contains(t, w.Content(), content431.title)
+	require.Contains(t, w.Content(), content431.statusString)
+	require.Contains(t, w.Content(), content431.header)
+	require.Contains(t, w.Content(), content431.subHeader)
+}
+
 func TestServe500(t *testing.T) {
 	w := newTestResponseWriter(httptest.NewRecorder())
-	Serve500(w)
+	Serve500(w, httptest.NewRequest(http.MethodGet, "/", nil))
 	require.Equal(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
 	require.Equal(t, w.Header().Get("X-Content-Type-Options"), "nosniff")
 	require.Equal(t, w.Status(), content500.status)
@@ -118,7 +144,7 @@ func TestServe500(t *testing.T) {
 
 func TestServe502(t *testing.T) {
 	w := newTestResponseWriter(httptest.NewRecorder())
-	Serve502(w)
+	Serve502(w, httptest.NewRequest(http.MethodGet, "/", nil))
 	require.Equal(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
 	require.Equal(t, w.Header().Get("X-Content-Type-Options"), "nosniff")
 	require.Equal(t, w.Status(), content502.status)
@@ -127,3 +153,54 @@ func TestServe502(t *testing.T) {
 	require.Contains(t, w.Content(), content502.header)
 	require.Contains(t, w.Content(), content502.subHeader)
 }
+
+func TestServeJSON(t *testing.T) {
+	tests := map[string]struct {
+		accept       string
+		expectedJSON bool
+	}{
+		"json":                {accept: "application/json", expectedJSON: true},
+		"json_among_others":   {accept: "application/json, text/plain, */*", expectedJSON: true},
+		"json_with_quality":   {accept: "text/html, application/json;q=0.5", expectedJSON: true},
+		"json_excluded":       {accept: "application/json;q=0, */*", expectedJSON: false},
+		"browser":             {accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expectedJSON: false},
+		"no_accept_header":    {accept: "", expectedJSON: false},
+		"invalid_media_range": {accept: "application/json;;", expectedJSON: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(correlation.ContextWithCorrelation(r.Context(), "correlation-id"))
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			w := httptest.NewRecorder()
+			Serve404(w, r)
+			require.Equal(t, http.StatusNotFound, w.Code)
+			require.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+			if !tt.expectedJSON {
+				require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+				return
+			}
+
+			require.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+			require.JSONEq(t, `{"code":404,"message":"The page you're looking for could not be found.","correlation_id":"correlation-id"}`, w.Body.String())
+		})
+	}
+}
+
+func TestServeJSONRetryAfter(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/json")
+
+	w := httptest.NewRecorder()
+	w.Header().Set("Retry-After", "3")
+	Serve429(w, r)
+
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "3", w.Header().Get("Retry-After"))
+	require.JSONEq(t, `{"code":429,"message":"Too many requests.","correlation_id":"","retry_after":3}`, w.Body.String())
+}
@@ -0,0 +1,142 @@
+package httperrors
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"gitlab.com/gitlab-org/labkit/correlation"
+	"gitlab.com/gitlab-org/labkit/log"
+)
+
+// templateStatuses are the status codes that can have a custom error page
+var templateStatuses = []int{
+	http.StatusUnauthorized,
+	http.StatusNotFound,
+	http.StatusRequestURITooLong,
+	http.StatusTooManyRequests,
+	http.StatusRequestHeaderFieldsTooLarge,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+}
+
+var custom struct {
+	mu        sync.RWMutex
+	templates map[int]*template.Template
+}
+
+// TemplateData are the variables available to custom error page templates
+type TemplateData struct {
+	Status        int
+	Title         string
+	Header        string
+	Host          string
+	Path          string
+	CorrelationID string
+}
+
+// LoadTemplates replaces the embedded error pages by the templates found in
+// path, a directory or a zip archive holding files named after the status
+// code, such as 404.html. The templates use the html/template syntax and are
+// rendered with TemplateData. Error pages without a template keep the
+// embedded page, an empty path restores all of them.
+func LoadTemplates(path string) error {
+	if path == "" {
+		setTemplates(nil)
+		return nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		return loadTemplates(os.DirFS(path))
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("error pages must be a directory or a zip archive: %w", err)
+	}
+	defer archive.Close()
+
+	return loadTemplates(archive)
+}
+
+func loadTemplates(fsys fs.FS) error {
+	templates := make(map[int]*template.Template)
+
+	for _, status := range templateStatuses {
+		name := strconv.Itoa(status) + ".html"
+
+		content, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		tmpl, err := template.New(name).Parse(string(content))
+		if err != nil {
+			return err
+		}
+
+		templates[status] = tmpl
+	}
+
+	setTemplates(templates)
+
+	return nil
+}
+
+func setTemplates(templates map[int]*template.Template) {
+	custom.mu.Lock()
+	defer custom.mu.Unlock()
+
+	custom.templates = templates
+}
+
+func customTemplate(status int) *template.Template {
+	custom.mu.RLock()
+	defer custom.mu.RUnlock()
+
+	return custom.templates[status]
+}
+
+// renderCustomPage returns the custom error page of c, or nil if there is
+// none or it failed to render. r can be nil.
+func renderCustomPage(r *http.Request, c content) []byte {
+	tmpl := customTemplate(c.status)
+	if tmpl == nil {
+		return nil
+	}
+
+	data := TemplateData{
+		Status: c.status,
+		Title:  c.title,
+		Header: c.header,
+	}
+
+	if r != nil {
+		data.Host = r.Host
+		data.Path = r.URL.Path
+		data.CorrelationID = correlation.ExtractFromContext(r.Context())
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.WithError(err).WithField("status", c.status).Error("failed to render custom error page")
+		return nil
+	}
+
+	return buf.Bytes()
+}
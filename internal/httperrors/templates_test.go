@@ -0,0 +1,81 @@
+package httperrors
+
+import (
+	"archive/zip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testTemplate = `<h1>{{.Status}} {{.Header}}</h1><p>{{.Host}}{{.Path}}</p>`
+
+func TestLoadTemplatesFromDirectory(t *testing.T) {
+	t.Cleanup(func() { setTemplates(nil) })
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "404.html"), []byte(testTemplate), 0644))
+	require.NoError(t, LoadTemplates(dir))
+
+	w := httptest.NewRecorder()
+	Serve404(w, httptest.NewRequest(http.MethodGet, "http://group.gitlab-example.com/<script>", nil))
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Equal(t, "<h1>404 The page you&#39;re looking for could not be found.</h1><p>group.gitlab-example.com/&lt;script&gt;</p>", w.Body.String())
+
+	// error pages without a template keep the embedded page
+	w = httptest.NewRecorder()
+	Serve500(w, httptest.NewRequest(http.MethodGet, "http://group.gitlab-example.com/", nil))
+	require.Contains(t, w.Body.String(), content500.title)
+
+	require.NoError(t, LoadTemplates(""))
+
+	w = httptest.NewRecorder()
+	Serve404(w, httptest.NewRequest(http.MethodGet, "http://group.gitlab-example.com/", nil))
+	require.Contains(t, w.Body.String(), content404.title)
+}
+
+func TestLoadTemplatesFromArchive(t *testing.T) {
+	t.Cleanup(func() { setTemplates(nil) })
+
+	path := filepath.Join(t.TempDir(), "errors.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+
+	archive := zip.NewWriter(f)
+	page, err := archive.Create("503.html")
+	require.NoError(t, err)
+	_, err = page.Write([]byte(testTemplate))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	require.NoError(t, f.Close())
+
+	require.NoError(t, LoadTemplates(path))
+
+	w := httptest.NewRecorder()
+	Serve401(w)
+	require.Contains(t, w.Body.String(), content401.title)
+
+	w = httptest.NewRecorder()
+	Serve503(w, httptest.NewRequest(http.MethodGet, "http://group.gitlab-example.com/", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "<h1>503 "+content503.header+"</h1><p>group.gitlab-example.com/</p>", w.Body.String())
+}
+
+func TestLoadTemplatesErrors(t *testing.T) {
+	t.Cleanup(func() { setTemplates(nil) })
+
+	require.Error(t, LoadTemplates(filepath.Join(t.TempDir(), "missing")))
+
+	notArchive := filepath.Join(t.TempDir(), "404.html")
+	require.NoError(t, os.WriteFile(notArchive, []byte(testTemplate), 0644))
+	require.Error(t, LoadTemplates(notArchive))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "404.html"), []byte("{{.Status"), 0644))
+	require.Error(t, LoadTemplates(dir))
+}
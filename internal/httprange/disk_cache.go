@@ -0,0 +1,186 @@
+package httprange
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	diskCacheExt = ".range"
+	// diskCacheBlockSize is the least size accounted for a range, the block
+	// size of most file systems, so that the small ranges of the headers of
+	// the files of zip archives are bounded too
+	diskCacheBlockSize = 4096
+)
+
+// DiskCache stores the ranges read from the resources on disk, keyed by the
+// URL and ETag of their resource so that a changed resource is not served
+// from it. The least recently used ranges are evicted once the cache
+// exceeds its size.
+type DiskCache struct {
+	dir          string
+	maxSize      int64
+	maxRangeSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type diskCacheEntry struct {
+	key  string
+	size int64
+}
+
+// NewDiskCache creates a cache of maxSize bytes in dir, caching the ranges
+// of at most maxRangeSize bytes. The ranges cached in dir by a previous
+// process are removed.
+func NewDiskCache(dir string, maxSize, maxRangeSize int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	stale, err := filepath.Glob(filepath.Join(dir, "*"+diskCacheExt))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	metrics.HTTPRangeCacheSize.Set(0)
+
+	return &DiskCache{
+		dir:          dir,
+		maxSize:      maxSize,
+		maxRangeSize: maxRangeSize,
+		lru:          list.New(),
+		entries:      make(map[string]*list.Element),
+	}, nil
+}
+
+// key returns the key of a range of resource, or false if the resource
+// can't be cached because it has no ETag. The query of the URL is ignored,
+// as the signature of the URLs of the object storage changes.
+func (c *DiskCache) key(resource *Resource, offset, size int64) (string, bool) {
+	if c == nil || resource.file != nil || resource.ETag == "" || size <= 0 || size > c.maxRangeSize {
+		return "", false
+	}
+
+	u, err := url.Parse(resource.URL())
+	if err != nil {
+		return "", false
+	}
+
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s\n%d\n%d", u.String(), resource.ETag, offset, size)))
+
+	return hex.EncodeToString(h[:]), true
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key+diskCacheExt)
+}
+
+// get returns the range cached for key
+func (c *DiskCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(element)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		metrics.HTTPRangeCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		// evicted concurrently
+		metrics.HTTPRangeCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	metrics.HTTPRangeCacheRequests.WithLabelValues("hit").Inc()
+
+	return data, true
+}
+
+// put caches data for key, evicting the least recently used ranges to stay
+// within the size of the cache
+func (c *DiskCache) put(key string, data []byte) {
+	size := int64(len(data))
+	if size < diskCacheBlockSize {
+		size = diskCacheBlockSize
+	}
+
+	if size > c.maxSize {
+		return
+	}
+
+	// the range is written in full before being visible
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a range fetched concurrently replaced the file of the entry
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*diskCacheEntry)
+		c.size += size - entry.size
+		entry.size = size
+		c.lru.MoveToFront(element)
+	} else {
+		c.entries[key] = c.lru.PushFront(&diskCacheEntry{key: key, size: size})
+		c.size += size
+	}
+
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+		metrics.HTTPRangeCacheRequests.WithLabelValues("evicted").Inc()
+	}
+
+	metrics.HTTPRangeCacheSize.Set(float64(c.size))
+}
+
+// remove needs to be called with mu held
+func (c *DiskCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*diskCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+
+	os.Remove(c.path(entry.key))
+}
@@ -0,0 +1,137 @@
+package httprange
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stale"+diskCacheExt), []byte("stale"), 0600))
+
+	cache, err := NewDiskCache(dir, 2*diskCacheBlockSize, 16)
+	require.NoError(t, err)
+	require.NoFileExists(t, filepath.Join(dir, "stale"+diskCacheExt), "the ranges of a previous process are removed")
+
+	cache.put("first", []byte("first"))
+	cache.put("second", []byte("second"))
+
+	data, ok := cache.get("first")
+	require.True(t, ok)
+	require.Equal(t, "first", string(data))
+
+	// each range accounts for a block at least
+	evicted := testutil.ToFloat64(metrics.HTTPRangeCacheRequests.WithLabelValues("evicted"))
+	cache.put("third", []byte("third"))
+	require.Equal(t, evicted+1, testutil.ToFloat64(metrics.HTTPRangeCacheRequests.WithLabelValues("evicted")))
+
+	_, ok = cache.get("second")
+	require.False(t, ok, "the least recently used range is evicted")
+	require.NoFileExists(t, cache.path("second"))
+
+	_, ok = cache.get("first")
+	require.True(t, ok)
+
+	cache.put("first", []byte("replaced"))
+	data, ok = cache.get("first")
+	require.True(t, ok)
+	require.Equal(t, "replaced", string(data))
+	require.Equal(t, int64(2*diskCacheBlockSize), cache.size)
+}
+
+func TestDiskCacheKey(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1024, 16)
+	require.NoError(t, err)
+
+	resource := func(url, etag string) *Resource {
+		r := &Resource{ETag: etag}
+		r.SetURL(url)
+
+		return r
+	}
+
+	signed, ok := cache.key(resource("https://objects.example.com/public.zip?X-Amz-Signature=1", `"v1"`), 0, 16)
+	require.True(t, ok)
+
+	resigned, ok := cache.key(resource("https://objects.example.com/public.zip?X-Amz-Signature=2", `"v1"`), 0, 16)
+	require.True(t, ok)
+	require.Equal(t, signed, resigned, "the signature of the URL is ignored")
+
+	changed, ok := cache.key(resource("https://objects.example.com/public.zip", `"v2"`), 0, 16)
+	require.True(t, ok)
+	require.NotEqual(t, signed, changed)
+
+	_, ok = cache.key(resource("https://objects.example.com/public.zip", ""), 0, 16)
+	require.False(t, ok, "without ETag")
+
+	_, ok = cache.key(resource("https://objects.example.com/public.zip", `"v1"`), 0, 17)
+	require.False(t, ok, "larger than the largest range")
+
+	var disabled *DiskCache
+	_, ok = disabled.key(resource("https://objects.example.com/public.zip", `"v1"`), 0, 16)
+	require.False(t, ok)
+}
+
+func TestRangedReaderDiskCache(t *testing.T) {
+	var requests int64
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "data", time.Time{}, strings.NewReader(testData))
+	}))
+	defer testServer.Close()
+
+	cache, err := NewDiskCache(t.TempDir(), 1<<20, 16)
+	require.NoError(t, err)
+
+	resource, err := NewResource(context.Background(), testServer.URL, testClient)
+	require.NoError(t, err)
+
+	rr := NewRangedReader(resource).WithDiskCache(cache)
+
+	read := func(offset, size int64) string {
+		t.Helper()
+
+		reader := rr.SectionReader(context.Background(), offset, size)
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+
+		return string(data)
+	}
+
+	atomic.StoreInt64(&requests, 0)
+
+	require.Equal(t, testData[2:12], read(2, 10))
+	require.Equal(t, testData[2:12], read(2, 10))
+	require.Equal(t, int64(1), atomic.LoadInt64(&requests), "the range is read from the cache")
+
+	// larger ranges are not cached
+	require.Equal(t, testData, read(0, int64(testDataLen)))
+	require.Equal(t, testData, read(0, int64(testDataLen)))
+	require.Equal(t, int64(3), atomic.LoadInt64(&requests))
+
+	buf := make([]byte, 5)
+	for i := 0; i < 2; i++ {
+		n, err := rr.ReadAt(buf, 20)
+		require.NoError(t, err)
+		require.Equal(t, testData[20:25], string(buf[:n]))
+	}
+	require.Equal(t, int64(4), atomic.LoadInt64(&requests), "ReadAt reads from the cache")
+}
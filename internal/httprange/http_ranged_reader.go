@@ -10,6 +10,8 @@ import (
 type RangedReader struct {
 	Resource     *Resource
 	cachedReader *Reader
+	prefetch     Prefetch
+	diskCache    *DiskCache
 }
 
 func (rr *RangedReader) cachedRead(buf []byte, off int64) (int, error) {
@@ -31,17 +33,48 @@ func (rr *RangedReader) ephemeralRead(buf []byte, offset int64) (n int, err erro
 
 // SectionReader partitions a resource from `offset` with a specified `size`
 func (rr *RangedReader) SectionReader(ctx context.Context, offset, size int64) *Reader {
-	return NewReader(ctx, rr.Resource, offset, size)
+	reader := NewReader(ctx, rr.Resource, offset, size)
+	reader.prefetch = rr.prefetch
+	reader.cache = rr.diskCache
+
+	return reader
+}
+
+// WithDiskCache sets the disk cache of the ranges read, which may be nil
+func (rr *RangedReader) WithDiskCache(cache *DiskCache) *RangedReader {
+	rr.diskCache = cache
+
+	return rr
+}
+
+// WithPrefetch sets the prefetching of the section readers
+func (rr *RangedReader) WithPrefetch(prefetch Prefetch) *RangedReader {
+	rr.prefetch = prefetch
+
+	return rr
 }
 
 // ReadAt reads from cachedReader if exists, otherwise fetches a new Resource first.
 // Opens a resource and reads len(buf) bytes from offset into buf.
 func (rr *RangedReader) ReadAt(buf []byte, offset int64) (n int, err error) {
+	key, cacheable := rr.diskCache.key(rr.Resource, offset, int64(len(buf)))
+	if cacheable {
+		if data, ok := rr.diskCache.get(key); ok {
+			return copy(buf, data), nil
+		}
+	}
+
 	if rr.cachedReader != nil {
-		return rr.cachedRead(buf, offset)
+		n, err = rr.cachedRead(buf, offset)
+	} else {
+		n, err = rr.ephemeralRead(buf, offset)
+	}
+
+	if cacheable && err == nil {
+		rr.diskCache.put(key, buf[:n])
 	}
 
-	return rr.ephemeralRead(buf, offset)
+	return n, err
 }
 
 // WithCachedReader creates a Reader and saves it to the RangedReader instance.
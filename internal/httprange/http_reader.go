@@ -42,6 +42,14 @@ type Reader struct {
 	rangeSize int64
 	// offset defines a current place where data is being read from
 	offset int64
+	// prefetch options, sequential bytes read since the last seek and the
+	// prefetcher they started
+	prefetch   Prefetch
+	sequential int64
+	prefetcher *prefetcher
+	// cache the range is read from, once loaded in cached
+	cache  *DiskCache
+	cached []byte
 }
 
 // ensure that Reader is seekable
@@ -54,14 +62,9 @@ func (r *Reader) ensureResponse() error {
 		return nil
 	}
 
-	req, err := r.prepareRequest()
-	if err != nil {
-		return err
-	}
-
 	metrics.HTTPRangeOpenRequests.Inc()
 
-	res, err := r.Resource.httpClient.Do(req)
+	res, err := doWithRetry(r.ctx, r.Resource.httpClient, r.prepareRequest)
 	if err != nil {
 		metrics.HTTPRangeOpenRequests.Dec()
 		return err
@@ -154,6 +157,7 @@ func (r *Reader) Seek(offset int64, whence int) (int64, error) {
 	if newOffset != r.offset {
 		// recycle r.res
 		r.Close()
+		r.sequential = 0
 	}
 
 	r.offset = newOffset
@@ -166,20 +170,131 @@ func (r *Reader) Read(buf []byte) (int, error) {
 		return 0, nil
 	}
 
-	if err := r.ensureResponse(); err != nil {
+	if r.Resource.file != nil {
+		return r.readFile(buf)
+	}
+
+	if cached, err := r.cachedRange(); err != nil {
 		return 0, err
+	} else if cached != nil {
+		if r.offset >= r.rangeStart+r.rangeSize {
+			return 0, io.EOF
+		}
+
+		n := copy(buf, cached[r.offset-r.rangeStart:])
+		r.offset += int64(n)
+
+		return n, nil
+	}
+
+	if r.prefetching() {
+		n, err := r.prefetcher.read(buf, r.offset)
+		r.offset += int64(n)
+
+		return n, err
 	}
 
-	n, err := r.res.Body.Read(buf)
-	if err == nil || err == io.EOF {
+	for attempt := 0; ; attempt++ {
+		if err := r.ensureResponse(); err != nil {
+			return 0, err
+		}
+
+		n, err := r.res.Body.Read(buf)
 		r.offset += int64(n)
+		r.sequential += int64(n)
+
+		if err == nil || err == io.EOF || !transient(r.ctx, err) {
+			return n, err
+		}
+
+		// the response was cut short, the next read resumes it from the
+		// offset with a new request
+		r.Close()
+
+		if n > 0 {
+			return n, nil
+		}
+
+		if !allowRetry(r.ctx, attempt) || !backoff(r.ctx, attempt) {
+			return 0, err
+		}
 	}
+}
+
+// readFile reads the range of the reader from the file of the resource
+func (r *Reader) readFile(buf []byte) (int, error) {
+	end := r.rangeStart + r.rangeSize
+	if r.offset >= end {
+		return 0, io.EOF
+	}
+
+	if int64(len(buf)) > end-r.offset {
+		buf = buf[:end-r.offset]
+	}
+
+	n, err := r.Resource.file.ReadAt(buf, r.offset)
+	r.offset += int64(n)
 
 	return n, err
 }
 
+// cachedRange returns the range of the reader from the disk cache, fetching
+// it in full on a miss. It returns nil if the range can't be cached.
+func (r *Reader) cachedRange() ([]byte, error) {
+	if r.cached != nil || r.cache == nil {
+		return r.cached, nil
+	}
+
+	key, ok := r.cache.key(r.Resource, r.rangeStart, r.rangeSize)
+	if !ok {
+		r.cache = nil
+		return nil, nil
+	}
+
+	data, ok := r.cache.get(key)
+	if !ok {
+		reader := NewReader(r.ctx, r.Resource, r.rangeStart, r.rangeSize)
+		defer reader.Close()
+
+		data = make([]byte, r.rangeSize)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+
+		r.cache.put(key, data)
+	}
+
+	r.cached = data
+
+	return data, nil
+}
+
+// prefetching returns true if the reader reads from its prefetcher, which
+// starts once a chunk is read sequentially and more chunks are left
+func (r *Reader) prefetching() bool {
+	if r.prefetcher != nil {
+		return true
+	}
+
+	end := r.rangeStart + r.rangeSize
+	if !r.prefetch.enabled() || r.sequential < r.prefetch.ChunkSize || end-r.offset <= r.prefetch.ChunkSize {
+		return false
+	}
+
+	// the chunks replace the response
+	r.Close()
+	r.prefetcher = newPrefetcher(r.ctx, r.Resource, r.prefetch, r.offset, end)
+
+	return true
+}
+
 // Close closes a requests body
 func (r *Reader) Close() error {
+	if r.prefetcher != nil {
+		r.prefetcher.close()
+		r.prefetcher = nil
+	}
+
 	if r.res != nil {
 		// no need to read until the end
 		err := r.res.Body.Close()
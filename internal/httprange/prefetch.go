@@ -0,0 +1,115 @@
+package httprange
+
+import (
+	"context"
+	"io"
+)
+
+// Prefetch configures the readers to fetch the next Concurrency chunks of
+// ChunkSize bytes concurrently once they read a chunk sequentially, to
+// improve the throughput of large files streamed from a high-latency
+// storage. A Concurrency of 0 disables it.
+type Prefetch struct {
+	Concurrency int
+	ChunkSize   int64
+}
+
+func (p Prefetch) enabled() bool {
+	return p.Concurrency > 0 && p.ChunkSize > 0
+}
+
+// chunk is a range of the resource fetched in the background
+type chunk struct {
+	offset int64
+	data   []byte
+	err    error
+	done   chan struct{}
+}
+
+// prefetcher fetches the chunks following offset, and returns them in order
+type prefetcher struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	resource *Resource
+	options  Prefetch
+	// end of the range of the reader, and next offset to fetch
+	end  int64
+	next int64
+
+	chunks []*chunk
+}
+
+func newPrefetcher(ctx context.Context, resource *Resource, options Prefetch, offset, end int64) *prefetcher {
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &prefetcher{
+		ctx:      ctx,
+		cancel:   cancel,
+		resource: resource,
+		options:  options,
+		end:      end,
+		next:     offset,
+	}
+}
+
+// fill starts fetching chunks until Concurrency of them are in flight
+func (p *prefetcher) fill() {
+	for len(p.chunks) < p.options.Concurrency && p.next < p.end {
+		size := p.options.ChunkSize
+		if p.next+size > p.end {
+			size = p.end - p.next
+		}
+
+		c := &chunk{offset: p.next, done: make(chan struct{})}
+		p.chunks = append(p.chunks, c)
+		p.next += size
+
+		go p.fetch(c, size)
+	}
+}
+
+func (p *prefetcher) fetch(c *chunk, size int64) {
+	defer close(c.done)
+
+	// a bounded reader of the chunk, which retries its transient failures
+	reader := NewReader(p.ctx, p.resource, c.offset, size)
+	defer reader.Close()
+
+	c.data = make([]byte, size)
+	_, c.err = io.ReadFull(reader, c.data)
+}
+
+// read copies the bytes of the chunks from offset into buf
+func (p *prefetcher) read(buf []byte, offset int64) (int, error) {
+	p.fill()
+
+	if len(p.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	c := p.chunks[0]
+
+	select {
+	case <-c.done:
+	case <-p.ctx.Done():
+		return 0, p.ctx.Err()
+	}
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	n := copy(buf, c.data[offset-c.offset:])
+	if offset+int64(n) == c.offset+int64(len(c.data)) {
+		p.chunks = p.chunks[1:]
+		p.fill()
+	}
+
+	return n, nil
+}
+
+// close cancels the chunks in flight
+func (p *prefetcher) close() {
+	p.cancel()
+	p.chunks = nil
+}
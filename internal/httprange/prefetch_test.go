@@ -0,0 +1,111 @@
+package httprange
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readAll reads r with a small buffer, as a file streamed to a client
+func readAll(t *testing.T, r io.Reader) string {
+	t.Helper()
+
+	var content strings.Builder
+	buf := make([]byte, 3)
+
+	for {
+		n, err := r.Read(buf)
+		content.Write(buf[:n])
+		if err == io.EOF {
+			return content.String()
+		}
+		require.NoError(t, err)
+	}
+}
+
+func TestReaderPrefetch(t *testing.T) {
+	var requests, inFlight, maxInFlight int64
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+
+		for {
+			max := atomic.LoadInt64(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		// the chunks are requested while the others are in flight
+		time.Sleep(5 * time.Millisecond)
+
+		http.ServeContent(w, r, "data", time.Time{}, strings.NewReader(testData))
+	}))
+	defer testServer.Close()
+
+	resource, err := NewResource(context.Background(), testServer.URL, testClient)
+	require.NoError(t, err)
+
+	atomic.StoreInt64(&requests, 0)
+
+	rr := NewRangedReader(resource).WithPrefetch(Prefetch{Concurrency: 3, ChunkSize: 4})
+
+	reader := rr.SectionReader(context.Background(), 0, resource.Size)
+	defer reader.Close()
+
+	require.Equal(t, testData, readAll(t, reader))
+
+	// a response for the first 6 bytes read, then the 24 bytes left in 6
+	// chunks
+	require.Equal(t, int64(7), atomic.LoadInt64(&requests))
+	require.Greater(t, atomic.LoadInt64(&maxInFlight), int64(1))
+}
+
+func TestReaderPrefetchSeek(t *testing.T) {
+	testServer := newTestServer(t, nil)
+	defer testServer.Close()
+
+	resource, err := NewResource(context.Background(), testServer.URL+"/data", testClient)
+	require.NoError(t, err)
+
+	rr := NewRangedReader(resource).WithPrefetch(Prefetch{Concurrency: 2, ChunkSize: 4})
+
+	reader := rr.SectionReader(context.Background(), 5, 20)
+	defer reader.Close()
+
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(reader, buf)
+	require.NoError(t, err)
+	require.Equal(t, testData[5:15], string(buf))
+
+	// seeking stops the prefetching until a chunk is read again
+	_, err = reader.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	require.Nil(t, reader.prefetcher)
+
+	require.Equal(t, testData[7:25], readAll(t, reader))
+}
+
+func TestReaderPrefetchDisabled(t *testing.T) {
+	testServer := newTestServer(t, nil)
+	defer testServer.Close()
+
+	resource, err := NewResource(context.Background(), testServer.URL+"/data", testClient)
+	require.NoError(t, err)
+
+	reader := NewRangedReader(resource).SectionReader(context.Background(), 0, resource.Size)
+	defer reader.Close()
+
+	require.Equal(t, testData, readAll(t, reader))
+	require.Nil(t, reader.prefetcher)
+}
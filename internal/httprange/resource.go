@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -21,6 +22,9 @@ type Resource struct {
 	err atomic.Value
 
 	httpClient *http.Client
+	// file holds the resource downloaded in full from a server which does
+	// not support range requests, the resource is read from it instead
+	file *os.File
 }
 
 func (r *Resource) URL() string {
@@ -68,18 +72,32 @@ func (r *Resource) Request() (*http.Request, error) {
 	return req, nil
 }
 
+// NewResource creates a Resource for url, whose server must support range
+// requests
 func NewResource(ctx context.Context, url string, httpClient *http.Client) (*Resource, error) {
-	// the `h.URL` is likely pre-signed URL or a file:// scheme that only supports GET requests
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
+	return NewResourceWithFallback(ctx, url, httpClient, 0)
+}
+
+// NewResourceWithFallback creates a Resource for url. If its server does not
+// support range requests, a resource of up to fallbackMaxSize bytes is
+// downloaded in full to a temporary file to be read from it. A
+// fallbackMaxSize of 0 disables the fallback.
+func NewResourceWithFallback(ctx context.Context, url string, httpClient *http.Client, fallbackMaxSize int64) (*Resource, error) {
+	newRequest := func() (*http.Request, error) {
+		// the `h.URL` is likely pre-signed URL or a file:// scheme that only supports GET requests
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// we fetch a single byte and ensure that range requests is additionally supported
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", 0, 0))
 
-	// we fetch a single byte and ensure that range requests is additionally supported
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", 0, 0))
+		return req, nil
+	}
 
 	// body will be closed by discardAndClose
-	res, err := httpClient.Do(req)
+	res, err := doWithRetry(ctx, httpClient, newRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -99,6 +117,15 @@ func NewResource(ctx context.Context, url string, httpClient *http.Client) (*Res
 
 	switch res.StatusCode {
 	case http.StatusOK:
+		// the Range is ignored, the body is the whole resource
+		if fallbackMaxSize > 0 {
+			if err := resource.download(res.Body, fallbackMaxSize); err != nil {
+				return nil, err
+			}
+
+			return resource, nil
+		}
+
 		resource.Size = res.ContentLength
 		return resource, nil
 
@@ -126,3 +153,31 @@ func NewResource(ctx context.Context, url string, httpClient *http.Client) (*Res
 		return nil, fmt.Errorf("httprange: new resource %d: %q", res.StatusCode, res.Status)
 	}
 }
+
+// download copies body, of at most maxSize bytes, to a temporary file the
+// resource is read from. The file is unlinked right away, its space is
+// released once the resource is garbage collected and its file closed.
+func (r *Resource) download(body io.Reader, maxSize int64) error {
+	file, err := os.CreateTemp("", "gitlab-pages-resource-*")
+	if err != nil {
+		return err
+	}
+
+	os.Remove(file.Name())
+
+	size, err := io.Copy(file, io.LimitReader(body, maxSize+1))
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if size > maxSize {
+		file.Close()
+		return fmt.Errorf("%w: larger than %d bytes", ErrRangeRequestsNotSupported, maxSize)
+	}
+
+	r.Size = size
+	r.file = file
+
+	return nil
+}
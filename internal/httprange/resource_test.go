@@ -2,6 +2,7 @@ package httprange
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"sync/atomic"
@@ -106,3 +107,35 @@ func TestNewResource(t *testing.T) {
 		})
 	}
 }
+
+func TestNewResourceWithFallback(t *testing.T) {
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		// the Range header is ignored
+		w.Write([]byte("1234567890"))
+	}))
+	defer testServer.Close()
+
+	t.Run("downloaded", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+
+		resource, err := NewResourceWithFallback(context.Background(), testServer.URL, testClient, 10)
+		require.NoError(t, err)
+		require.Equal(t, int64(10), resource.Size)
+
+		rr := NewRangedReader(resource)
+		buf := make([]byte, 4)
+		n, err := rr.ReadAt(buf, 3)
+		require.NoError(t, err)
+		require.Equal(t, "4567", string(buf[:n]))
+
+		require.Equal(t, "890", readAll(t, rr.SectionReader(context.Background(), 7, 5)))
+		require.Equal(t, int32(1), atomic.LoadInt32(&requests), "the resource is downloaded once")
+	})
+
+	t.Run("too_large", func(t *testing.T) {
+		_, err := NewResourceWithFallback(context.Background(), testServer.URL, testClient, 9)
+		require.True(t, errors.Is(err, ErrRangeRequestsNotSupported))
+	})
+}
@@ -0,0 +1,143 @@
+package httprange
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+var (
+	// maxRetries is the number of times a request failing transiently is
+	// retried
+	maxRetries = 3
+	// retryBaseDelay and retryMaxDelay bound the jittered exponential
+	// backoff between the retries
+	retryBaseDelay = 50 * time.Millisecond
+	retryMaxDelay  = time.Second
+)
+
+const (
+	// retryBudgetMax is the number of retries made while all the requests
+	// fail, every retryBudgetRefill successful requests add a retry to the
+	// budget
+	retryBudgetMax    = 10
+	retryBudgetRefill = 10
+)
+
+// budget bounds the retries to a share of the successful requests, so that
+// an outage of the object storage is not amplified by the retries
+var budget = newRetryBudget(retryBudgetMax)
+
+// retryBudget counts its tokens in fractions of a retry
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens int
+}
+
+func newRetryBudget(retries int) *retryBudget {
+	return &retryBudget{tokens: retries * retryBudgetRefill}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < retryBudgetRefill {
+		return false
+	}
+
+	b.tokens -= retryBudgetRefill
+
+	return true
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < retryBudgetMax*retryBudgetRefill {
+		b.tokens++
+	}
+}
+
+// transient returns true if err, returned by a request or a read of its
+// body, is not caused by ctx
+func transient(ctx context.Context, err error) bool {
+	return ctx.Err() == nil &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// allowRetry returns true if the request can be retried after attempt,
+// withdrawing the retry from the budget
+func allowRetry(ctx context.Context, attempt int) bool {
+	if attempt >= maxRetries || ctx.Err() != nil || !budget.withdraw() {
+		return false
+	}
+
+	metrics.HTTPRangeRetriesTotal.Inc()
+
+	return true
+}
+
+// backoff waits for the jittered exponential backoff of attempt, returning
+// false if ctx is done before
+func backoff(ctx context.Context, attempt int) bool {
+	delay := retryBaseDelay << uint(attempt)
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(delay) + 1)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// doWithRetry does the request returned by newRequest, retrying the
+// transport errors and the 5xx responses
+func doWithRetry(ctx context.Context, client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			if !transient(ctx, err) || !allowRetry(ctx, attempt) || !backoff(ctx, attempt) {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if res.StatusCode < http.StatusInternalServerError {
+			budget.deposit()
+			return res, nil
+		}
+
+		// the last response is returned to report its status
+		if !allowRetry(ctx, attempt) {
+			return res, nil
+		}
+
+		io.Copy(io.Discard, io.LimitReader(res.Body, 4096)) // nolint:errcheck // the response is discarded
+		res.Body.Close()
+
+		if !backoff(ctx, attempt) {
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package httprange
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// withFastRetries resets the retry budget and shortens the backoff
+func withFastRetries(t *testing.T) {
+	t.Helper()
+
+	baseDelay, maxDelay := retryBaseDelay, retryMaxDelay
+	retryBaseDelay, retryMaxDelay = time.Millisecond, time.Millisecond
+	budget = newRetryBudget(retryBudgetMax)
+
+	t.Cleanup(func() {
+		retryBaseDelay, retryMaxDelay = baseDelay, maxDelay
+		budget = newRetryBudget(retryBudgetMax)
+	})
+}
+
+func TestNewResourceRetry(t *testing.T) {
+	withFastRetries(t)
+
+	var requests int64
+	testServer := newTestServer(t, nil)
+	defer testServer.Close()
+
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		http.Redirect(w, r, testServer.URL+"/data", http.StatusFound)
+	}))
+	defer flaky.Close()
+
+	retries := testutil.ToFloat64(metrics.HTTPRangeRetriesTotal)
+
+	resource, err := NewResource(context.Background(), flaky.URL, testClient)
+	require.NoError(t, err)
+	require.Equal(t, int64(testDataLen), resource.Size)
+	require.Equal(t, int64(3), atomic.LoadInt64(&requests))
+	require.Equal(t, retries+2, testutil.ToFloat64(metrics.HTTPRangeRetriesTotal))
+}
+
+func TestNewResourceRetriesExhausted(t *testing.T) {
+	withFastRetries(t)
+
+	var requests int64
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer testServer.Close()
+
+	_, err := NewResource(context.Background(), testServer.URL, testClient)
+	require.EqualError(t, err, `httprange: new resource 502: "502 Bad Gateway"`)
+	require.Equal(t, int64(maxRetries+1), atomic.LoadInt64(&requests))
+}
+
+func TestRetryBudget(t *testing.T) {
+	withFastRetries(t)
+
+	var requests int64
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer testServer.Close()
+
+	budget = newRetryBudget(1)
+
+	_, err := NewResource(context.Background(), testServer.URL, testClient)
+	require.Error(t, err)
+	require.Equal(t, int64(2), atomic.LoadInt64(&requests), "a single retry is left in the budget")
+
+	// successful requests refill the budget
+	for i := 0; i < retryBudgetRefill; i++ {
+		budget.deposit()
+	}
+	require.True(t, budget.withdraw())
+	require.False(t, budget.withdraw())
+}
+
+func TestReaderResumesTruncatedResponse(t *testing.T) {
+	withFastRetries(t)
+
+	var requests int64
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&requests, 1)
+
+		// the first range request is cut short after a few bytes
+		if n == 2 {
+			var start, end int
+			_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+			require.NoError(t, err)
+
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, testDataLen))
+			w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, testData[start:start+5])
+			w.(http.Flusher).Flush()
+
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "data", time.Time{}, strings.NewReader(testData))
+	}))
+	defer testServer.Close()
+
+	resource, err := NewResource(context.Background(), testServer.URL, testClient)
+	require.NoError(t, err)
+
+	reader := NewReader(context.Background(), resource, 0, resource.Size)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, testData, string(data))
+	require.Equal(t, int64(3), atomic.LoadInt64(&requests))
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/tracing"
 )
 
 type meteredRoundTripper struct {
@@ -41,7 +42,8 @@ func NewMeteredRoundTripper(transport http.RoundTripper, name string, tracerVec,
 }
 
 // RoundTrip wraps the original http.Transport into a meteredRoundTripper which
-// reports metrics on request duration, tracing and request count
+// reports metrics on request duration, tracing and request count, and sends
+// the request in an OpenTelemetry span
 func (mrt *meteredRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 	start := time.Now()
 
@@ -53,14 +55,26 @@ func (mrt *meteredRoundTripper) RoundTrip(r *http.Request) (*http.Response, erro
 
 	r = r.WithContext(ctx)
 
-	resp, err := mrt.next.RoundTrip(r)
+	var outbound *outboundLogger
+	if sampleOutbound() {
+		outbound = &outboundLogger{name: mrt.name, req: r, start: start}
+	}
+
+	resp, err := tracing.RoundTrip(mrt.next, mrt.name, r)
 	if err != nil {
 		mrt.counter.WithLabelValues("error").Inc()
+		if outbound != nil {
+			outbound.logError(err)
+		}
 		return nil, err
 	}
 
 	mrt.logResponse(r, resp)
 
+	if outbound != nil {
+		outbound.wrap(resp)
+	}
+
 	statusCode := strconv.Itoa(resp.StatusCode)
 	mrt.durations.WithLabelValues(statusCode).Observe(time.Since(start).Seconds())
 	mrt.counter.WithLabelValues(statusCode).Inc()
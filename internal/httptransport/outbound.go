@@ -0,0 +1,96 @@
+package httptransport
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/gitlab-org/labkit/correlation"
+	"gitlab.com/gitlab-org/labkit/log"
+)
+
+// outboundSampleRate is the share of outbound requests that are logged,
+// stored as float64 bits and accessed atomically
+var outboundSampleRate uint64
+
+// ConfigureOutboundLogging logs a sample of the requests sent by metered
+// round trippers, such as the requests to the GitLab API and to object
+// storage. A percentage of 0 disables the logs.
+func ConfigureOutboundLogging(samplePercentage float64) {
+	atomic.StoreUint64(&outboundSampleRate, math.Float64bits(samplePercentage/100))
+}
+
+func sampleOutbound() bool {
+	rate := math.Float64frombits(atomic.LoadUint64(&outboundSampleRate))
+
+	return rate > 0 && rand.Float64() < rate
+}
+
+// outboundLogger logs a single outbound request once its response has been
+// read, so the duration and the number of bytes cover the entire transfer
+type outboundLogger struct {
+	name  string
+	req   *http.Request
+	start time.Time
+}
+
+func (l *outboundLogger) fields() log.Fields {
+	return log.Fields{
+		"client_name":    l.name,
+		"correlation_id": correlation.ExtractFromContext(l.req.Context()),
+		"method":         l.req.Method,
+		"target":         redactedTarget(l.req.URL),
+		"duration_ms":    time.Since(l.start).Milliseconds(),
+	}
+}
+
+func (l *outboundLogger) logError(err error) {
+	log.WithFields(l.fields()).WithError(err).Info("outbound request")
+}
+
+// wrap logs resp once its body has been closed
+func (l *outboundLogger) wrap(resp *http.Response) {
+	resp.Body = &loggedBody{ReadCloser: resp.Body, logger: l, status: resp.StatusCode}
+}
+
+type loggedBody struct {
+	io.ReadCloser
+	logger *outboundLogger
+	status int
+	bytes  int64
+	once   sync.Once
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+
+	b.once.Do(func() {
+		fields := b.logger.fields()
+		fields["status"] = b.status
+		fields["bytes"] = b.bytes
+
+		log.WithFields(fields).Info("outbound request")
+	})
+
+	return err
+}
+
+// redactedTarget drops the query and credentials of u, object storage URLs
+// are pre-signed and carry their signature in the query
+func redactedTarget(u *url.URL) string {
+	target := url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path, RawPath: u.RawPath}
+
+	return target.String()
+}
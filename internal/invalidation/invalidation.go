@@ -0,0 +1,115 @@
+// Package invalidation evicts domains from the cache of the GitLab source on
+// request, so that a new certificate or deployment of a domain is served
+// without waiting for its cached lookup to expire.
+//
+// The eviction is authorized by a JWT signed with the secret shared with
+// GitLab, for the domain being evicted.
+package invalidation
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/jwtauth"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	// PathPrefix of the evictions, followed by the domain
+	PathPrefix = "/-/cache/domains/"
+
+	audience = "gitlab-pages-cache"
+
+	// maxLifetime bounds the lifetime of the tokens, they are minted for a
+	// single eviction
+	maxLifetime = 5 * time.Minute
+)
+
+var (
+	errInvalidToken = errors.New("the token is not valid for this domain")
+	errNoDomain     = errors.New("the path must end with a domain")
+)
+
+// Claims of the token of an eviction
+type Claims struct {
+	jwt.RegisteredClaims
+	Host string `json:"host"`
+}
+
+// Evictor removes the lookup of a domain from a cache, it returns false when
+// the domain is not cached
+type Evictor interface {
+	EvictDomain(name string) bool
+}
+
+// Handler evicts the domains of the requests from the cache
+type Handler struct {
+	verifier *jwtauth.Verifier
+	evictor  Evictor
+}
+
+// NewHandler returns a Handler evicting from evictor the domains of the
+// requests authorized by a token signed with secret
+func NewHandler(secret []byte, evictor Evictor) *Handler {
+	return &Handler{
+		verifier: jwtauth.NewVerifier(secret, audience, maxLifetime),
+		evictor:  evictor,
+	}
+}
+
+// ServeHTTP evicts the domain of a `DELETE /-/cache/domains/{name}` request,
+// it responds with 404 when the domain is not cached
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(r.URL.Path, PathPrefix))
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, errNoDomain.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authorize(r, name); err != nil {
+		metrics.DomainsSourceCacheEvictions.WithLabelValues("unauthorized").Inc()
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gitlab-pages"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !h.evictor.EvictDomain(name) {
+		metrics.DomainsSourceCacheEvictions.WithLabelValues("not_cached").Inc()
+
+		http.Error(w, "the domain is not cached", http.StatusNotFound)
+		return
+	}
+
+	metrics.DomainsSourceCacheEvictions.WithLabelValues("evicted").Inc()
+	log.WithField("domain", name).Info("evicted the domain from the cache")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize verifies that the token of the request grants the eviction of
+// name
+func (h *Handler) authorize(r *http.Request, name string) error {
+	claims := &Claims{}
+	if err := h.verifier.Verify(jwtauth.BearerToken(r), claims); err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(claims.Host, name) {
+		return errInvalidToken
+	}
+
+	return nil
+}
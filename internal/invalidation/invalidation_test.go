@@ -0,0 +1,124 @@
+package invalidation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("secret")
+
+type evictorMock map[string]bool
+
+func (e evictorMock) EvictDomain(name string) bool {
+	cached := e[name]
+	delete(e, name)
+
+	return cached
+}
+
+func mint(t *testing.T, key []byte, aud, host string, expiresIn time.Duration) string {
+	t.Helper()
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{aud},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+		Host: host,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	require.NoError(t, err)
+
+	return token
+}
+
+func TestHandler(t *testing.T) {
+	tests := map[string]struct {
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+		evicted        bool
+	}{
+		"evicted": {
+			path:           "/-/cache/domains/Group.GitLab.io",
+			token:          mint(t, secret, audience, "group.gitlab.io", time.Minute),
+			expectedStatus: http.StatusNoContent,
+			evicted:        true,
+		},
+		"not_cached": {
+			path:           "/-/cache/domains/other.gitlab.io",
+			token:          mint(t, secret, audience, "other.gitlab.io", time.Minute),
+			expectedStatus: http.StatusNotFound,
+		},
+		"get": {
+			method:         http.MethodGet,
+			path:           "/-/cache/domains/group.gitlab.io",
+			token:          mint(t, secret, audience, "group.gitlab.io", time.Minute),
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		"no_domain": {
+			path:           "/-/cache/domains/",
+			token:          mint(t, secret, audience, "", time.Minute),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"no_token": {
+			path:           "/-/cache/domains/group.gitlab.io",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"invalid_signature": {
+			path:           "/-/cache/domains/group.gitlab.io",
+			token:          mint(t, []byte("other"), audience, "group.gitlab.io", time.Minute),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"other_audience": {
+			path:           "/-/cache/domains/group.gitlab.io",
+			token:          mint(t, secret, "gitlab-pages-export", "group.gitlab.io", time.Minute),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"other_domain": {
+			path:           "/-/cache/domains/group.gitlab.io",
+			token:          mint(t, secret, audience, "other.gitlab.io", time.Minute),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"expired": {
+			path:           "/-/cache/domains/group.gitlab.io",
+			token:          mint(t, secret, audience, "group.gitlab.io", -time.Minute),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"long_lived": {
+			path:           "/-/cache/domains/group.gitlab.io",
+			token:          mint(t, secret, audience, "group.gitlab.io", time.Hour),
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			evictor := evictorMock{"group.gitlab.io": true}
+			h := NewHandler(secret, evictor)
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodDelete
+			}
+
+			req := httptest.NewRequest(method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+			require.Equal(t, tt.evicted, !evictor["group.gitlab.io"])
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Package isolation reads the cross-origin isolation headers a deployment
+// opts in to with a `_headers` file. Browsers only allow cross-origin
+// isolated pages to use SharedArrayBuffer, which the threads of WebAssembly
+// need.
+//
+// The file follows the Netlify `_headers` syntax, a path followed by
+// indented headers:
+//
+//	/*
+//	  Cross-Origin-Opener-Policy: same-origin
+//	  Cross-Origin-Embedder-Policy: require-corp
+//
+// Only the cross-origin policies are honored, other headers are ignored.
+package isolation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+)
+
+const (
+	// ConfigFile is the name of the headers file at the root of a deployment
+	ConfigFile = "_headers"
+
+	maxConfigSize = 64 * 1024
+
+	// maxRules is the maximum number of paths read from a headers file
+	maxRules = 1000
+)
+
+var (
+	errNeedRegularFile = errors.New("_headers needs to be a regular file")
+	errFileTooLarge    = errors.New("_headers file too large")
+	errTooManyRules    = fmt.Errorf("_headers cannot contain more than %d paths", maxRules)
+)
+
+// policies are the values allowed for each header
+var policies = map[string][]string{
+	"Cross-Origin-Opener-Policy":   {"same-origin", "same-origin-allow-popups", "unsafe-none"},
+	"Cross-Origin-Embedder-Policy": {"require-corp", "credentialless", "unsafe-none"},
+	"Cross-Origin-Resource-Policy": {"same-origin", "same-site", "cross-origin"},
+}
+
+type rule struct {
+	// pattern is a path relative to the root of the deployment, a trailing
+	// `*` matches any suffix
+	pattern string
+	headers http.Header
+}
+
+// Headers are the isolation headers of the paths of a deployment. A nil
+// *Headers is valid and empty.
+type Headers struct {
+	rules []*rule
+}
+
+// Apply sets the headers of the rules matching the path of the deployment
+// p to header, the later rules take precedence
+func (h *Headers) Apply(header http.Header, p string) {
+	if h == nil {
+		return
+	}
+
+	p = "/" + strings.TrimPrefix(p, "/")
+
+	for _, r := range h.rules {
+		if !r.matches(p) {
+			continue
+		}
+
+		for name, values := range r.headers {
+			header[name] = values
+		}
+	}
+}
+
+func (r *rule) matches(p string) bool {
+	if prefix := strings.TrimSuffix(r.pattern, "*"); prefix != r.pattern {
+		return strings.HasPrefix(p, prefix)
+	}
+
+	return p == r.pattern || (strings.HasSuffix(r.pattern, "/") && p == r.pattern+"index.html")
+}
+
+// Parse reads the headers file of the deployment served under prefix from
+// root. A deployment without it has no headers.
+func Parse(ctx context.Context, root vfs.Root, prefix string) (*Headers, error) {
+	fi, err := root.Lstat(ctx, ConfigFile)
+	if err != nil {
+		return &Headers{}, nil
+	}
+
+	if !fi.Mode().IsRegular() {
+		return nil, errNeedRegularFile
+	}
+
+	if fi.Size() > maxConfigSize {
+		return nil, errFileTooLarge
+	}
+
+	reader, err := root.Open(ctx, ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, maxConfigSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return parse(content, prefix)
+}
+
+func parse(content []byte, prefix string) (*Headers, error) {
+	h := &Headers{}
+	var current *rule
+	var paths int
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case line == trimmed:
+			// an unindented line starts the rule of a path
+			if paths++; paths > maxRules {
+				return nil, errTooManyRules
+			}
+
+			current = nil
+			if pattern, ok := normalize(trimmed, prefix); ok {
+				current = &rule{pattern: pattern, headers: http.Header{}}
+				h.rules = append(h.rules, current)
+			}
+		case current != nil:
+			name, value, ok := header(trimmed)
+			if ok {
+				current.headers.Set(name, value)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// header returns the isolation header of a line, and false for any other
+// header or a value which is not a valid policy
+func header(line string) (string, string, bool) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", "", false
+	}
+
+	name := http.CanonicalHeaderKey(strings.TrimSpace(line[:i]))
+	value := strings.ToLower(strings.TrimSpace(line[i+1:]))
+
+	for _, allowed := range policies[name] {
+		if value == allowed {
+			return name, value, true
+		}
+	}
+
+	return "", "", false
+}
+
+// normalize returns the pattern p relative to the root of the deployment
+// served under prefix, and false if it is not a path
+func normalize(p, prefix string) (string, bool) {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") {
+		return "", false
+	}
+
+	// absolute paths include the prefix of project sites
+	p = "/" + strings.TrimPrefix(p, strings.TrimSuffix(prefix, "/")+"/")
+
+	wildcard := strings.HasSuffix(p, "*")
+	p = strings.TrimSuffix(p, "*")
+	dir := strings.HasSuffix(p, "/")
+
+	p = path.Clean(p)
+	if dir && p != "/" {
+		p += "/"
+	}
+
+	if wildcard {
+		p += "*"
+	}
+
+	return p, true
+}
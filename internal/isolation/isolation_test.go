@@ -0,0 +1,148 @@
+package isolation
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/testhelpers"
+)
+
+const isolated = `
+# threads need SharedArrayBuffer
+/*
+  Cross-Origin-Opener-Policy: same-origin
+  Cross-Origin-Embedder-Policy: require-corp
+
+/project/embed/*
+  Cross-Origin-Embedder-Policy: credentialless
+  Set-Cookie: session=1
+
+/assets/
+  cross-origin-resource-policy: Cross-Origin
+  Cross-Origin-Opener-Policy: allow-everything
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		headers       string
+		prefix        string
+		path          string
+		expectedCOOP  string
+		expectedCOEP  string
+		expectedCORP  string
+		expectedCount int
+		expectedErr   string
+	}{
+		{
+			name: "no headers file",
+			path: "/index.html",
+		},
+		{
+			name:          "any path",
+			headers:       isolated,
+			prefix:        "/project/",
+			path:          "/worker.js",
+			expectedCOOP:  "same-origin",
+			expectedCOEP:  "require-corp",
+			expectedCount: 3,
+		},
+		{
+			name:          "later rules take precedence",
+			headers:       isolated,
+			prefix:        "/project/",
+			path:          "/embed/frame.html",
+			expectedCOOP:  "same-origin",
+			expectedCOEP:  "credentialless",
+			expectedCount: 3,
+		},
+		{
+			name:          "directory index",
+			headers:       isolated,
+			prefix:        "/",
+			path:          "/assets/index.html",
+			expectedCOOP:  "same-origin",
+			expectedCOEP:  "require-corp",
+			expectedCORP:  "cross-origin",
+			expectedCount: 3,
+		},
+		{
+			name:        "too large",
+			headers:     "/*\n  Cross-Origin-Opener-Policy: same-origin\n" + strings.Repeat("#", maxConfigSize),
+			expectedErr: errFileTooLarge.Error(),
+		},
+		{
+			name:        "too many paths",
+			headers:     strings.Repeat("/a\n", maxRules+1),
+			expectedErr: errTooManyRules.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, tmpDir := testhelpers.TmpDir(t, "ParseIsolationHeaders_tests")
+
+			if tt.headers != "" {
+				err := os.WriteFile(path.Join(tmpDir, ConfigFile), []byte(tt.headers), 0600)
+				require.NoError(t, err)
+			}
+
+			headers, err := Parse(context.Background(), root, tt.prefix)
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, headers.rules, tt.expectedCount)
+
+			header := http.Header{}
+			headers.Apply(header, tt.path)
+
+			require.Equal(t, tt.expectedCOOP, header.Get("Cross-Origin-Opener-Policy"))
+			require.Equal(t, tt.expectedCOEP, header.Get("Cross-Origin-Embedder-Policy"))
+			require.Equal(t, tt.expectedCORP, header.Get("Cross-Origin-Resource-Policy"))
+			require.Empty(t, header.Get("Set-Cookie"))
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]struct {
+		pattern  string
+		prefix   string
+		expected string
+		ok       bool
+	}{
+		"root":              {pattern: "/*", prefix: "/", expected: "/*", ok: true},
+		"project prefix":    {pattern: "/project/*", prefix: "/project/", expected: "/*", ok: true},
+		"without prefix":    {pattern: "/js/*", prefix: "/project/", expected: "/js/*", ok: true},
+		"partial name":      {pattern: "/app*", prefix: "/", expected: "/app*", ok: true},
+		"directory":         {pattern: "/a/../b/", prefix: "/", expected: "/b/", ok: true},
+		"file":              {pattern: "/b/app.wasm", prefix: "/", expected: "/b/app.wasm", ok: true},
+		"relative":          {pattern: "app.wasm", prefix: "/"},
+		"protocol relative": {pattern: "//cdn.example.com/*", prefix: "/"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			pattern, ok := normalize(tt.pattern, tt.prefix)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.expected, pattern)
+		})
+	}
+}
+
+func TestApplyNilHeaders(t *testing.T) {
+	var headers *Headers
+
+	header := http.Header{}
+	headers.Apply(header, "/index.html")
+	require.Empty(t, header)
+}
@@ -0,0 +1,92 @@
+// Package jwtauth verifies the JWTs authorizing the admin endpoints and the
+// downloads, signed with HS256 by the secret shared with GitLab for a single
+// audience.
+package jwtauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	// ErrNoToken is returned when the request has no token
+	ErrNoToken = errors.New("the request requires a token")
+	// ErrInvalidToken is returned when the token is for another audience
+	ErrInvalidToken = errors.New("the token is not valid for this endpoint")
+	// ErrLifetime is returned when the token does not expire, or expires after
+	// the maximum lifetime
+	ErrLifetime = errors.New("the token must expire within the maximum lifetime")
+)
+
+// Claims of a token, the types embedding jwt.RegisteredClaims implement it
+type Claims interface {
+	jwt.Claims
+	VerifyAudience(cmp string, req bool) bool
+	VerifyExpiresAt(cmp time.Time, req bool) bool
+}
+
+// Verifier verifies the tokens of an audience
+type Verifier struct {
+	secret      []byte
+	audience    string
+	maxLifetime time.Duration
+	now         func() time.Time
+}
+
+// NewVerifier returns a Verifier of the tokens signed with secret for
+// audience, that expire within maxLifetime
+func NewVerifier(secret []byte, audience string, maxLifetime time.Duration) *Verifier {
+	return &Verifier{
+		secret:      secret,
+		audience:    audience,
+		maxLifetime: maxLifetime,
+		now:         time.Now,
+	}
+}
+
+// Verify parses token into claims and verifies its signature, audience and
+// lifetime. The other claims are verified by the caller.
+func (v *Verifier) Verify(token string, claims Claims) error {
+	if token == "" {
+		return ErrNoToken
+	}
+
+	if _, err := jwt.ParseWithClaims(token, claims, v.signingKey); err != nil {
+		return err
+	}
+
+	if !claims.VerifyAudience(v.audience, true) {
+		return ErrInvalidToken
+	}
+
+	// the expiry is required, and must not be after the maximum lifetime
+	if !claims.VerifyExpiresAt(time.Time{}, true) || claims.VerifyExpiresAt(v.now().Add(v.maxLifetime), true) {
+		return ErrLifetime
+	}
+
+	return nil
+}
+
+func (v *Verifier) signingKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return v.secret, nil
+}
+
+// BearerToken returns the token of the Authorization header of r, empty when
+// it is not a Bearer token
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimPrefix(header, "Bearer ")
+}
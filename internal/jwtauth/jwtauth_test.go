@@ -0,0 +1,96 @@
+package jwtauth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, audience string, expiresAt *jwt.NumericDate) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: expiresAt,
+	}).SignedString(key)
+	require.NoError(t, err)
+
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	inAMinute := jwt.NewNumericDate(time.Now().Add(time.Minute))
+
+	tests := map[string]struct {
+		token       string
+		expectedErr error
+		valid       bool
+	}{
+		"valid": {
+			token: sign(t, jwt.SigningMethodHS256, secret, "gitlab-pages-test", inAMinute),
+			valid: true,
+		},
+		"no_token": {
+			expectedErr: ErrNoToken,
+		},
+		"other_audience": {
+			token:       sign(t, jwt.SigningMethodHS256, secret, "gitlab-pages-other", inAMinute),
+			expectedErr: ErrInvalidToken,
+		},
+		"no_expiry": {
+			token:       sign(t, jwt.SigningMethodHS256, secret, "gitlab-pages-test", nil),
+			expectedErr: ErrLifetime,
+		},
+		"too_long": {
+			token:       sign(t, jwt.SigningMethodHS256, secret, "gitlab-pages-test", jwt.NewNumericDate(time.Now().Add(time.Hour))),
+			expectedErr: ErrLifetime,
+		},
+		"expired": {
+			token: sign(t, jwt.SigningMethodHS256, secret, "gitlab-pages-test", jwt.NewNumericDate(time.Now().Add(-time.Minute))),
+		},
+		"other_secret": {
+			token: sign(t, jwt.SigningMethodHS256, []byte("other"), "gitlab-pages-test", inAMinute),
+		},
+		"unsigned": {
+			token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "gitlab-pages-test", inAMinute),
+		},
+	}
+
+	verifier := NewVerifier(secret, "gitlab-pages-test", 5*time.Minute)
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := verifier.Verify(tt.token, &jwt.RegisteredClaims{})
+			if tt.valid {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := map[string]string{
+		"Bearer token": "token",
+		"Basic token":  "",
+		"token":        "",
+		"":             "",
+	}
+
+	for header, expected := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", header)
+
+		require.Equal(t, expected, BearerToken(r), header)
+	}
+}
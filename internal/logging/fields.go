@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// fieldsFormatter renames the fields of the log entries and adds the static
+// fields to them, so that the logs conform to the schema expected by the log
+// pipeline, such as ECS or Splunk CIM
+type fieldsFormatter struct {
+	logrus.Formatter
+	fieldMap     map[string]string
+	staticFields logrus.Fields
+}
+
+// newFieldsFormatter wraps formatter when any field is renamed or added.
+// The msg, level and time fields are renamed by formatter itself.
+func newFieldsFormatter(formatter logrus.Formatter, fieldMap, staticFields map[string]string) logrus.Formatter {
+	if len(fieldMap) == 0 && len(staticFields) == 0 {
+		return formatter
+	}
+
+	builtinFields := logrus.FieldMap{}
+	dataFields := make(map[string]string, len(fieldMap))
+
+	for field, name := range fieldMap {
+		switch field {
+		case logrus.FieldKeyMsg:
+			builtinFields[logrus.FieldKeyMsg] = name
+		case logrus.FieldKeyLevel:
+			builtinFields[logrus.FieldKeyLevel] = name
+		case logrus.FieldKeyTime:
+			builtinFields[logrus.FieldKeyTime] = name
+		default:
+			dataFields[field] = name
+		}
+	}
+
+	switch f := formatter.(type) {
+	case *logrus.JSONFormatter:
+		f.FieldMap = builtinFields
+	case *logrus.TextFormatter:
+		f.FieldMap = builtinFields
+	}
+
+	static := make(logrus.Fields, len(staticFields))
+	for field, value := range staticFields {
+		static[field] = value
+	}
+
+	return &fieldsFormatter{
+		Formatter:    formatter,
+		fieldMap:     dataFields,
+		staticFields: static,
+	}
+}
+
+func (f *fieldsFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data)+len(f.staticFields))
+
+	for field, value := range f.staticFields {
+		data[field] = value
+	}
+
+	for field, value := range entry.Data {
+		if name, ok := f.fieldMap[field]; ok {
+			field = name
+		}
+
+		data[field] = value
+	}
+
+	// the entry may be retained by the caller, only the copy is changed
+	entryCopy := *entry
+	entryCopy.Data = data
+
+	return f.Formatter.Format(&entryCopy)
+}
+
+// Truncate shortens the value of a field logged for a request to length
+// bytes, so that oversized requests cannot flood the logs
+func Truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+
+	return s[:length] + "..."
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldsFormatter(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(newFieldsFormatter(&logrus.JSONFormatter{},
+		map[string]string{"msg": "message", "level": "log.level", "pages_host": "url.domain"},
+		map[string]string{"datacenter": "eu-west-1", "host": "static"},
+	))
+
+	entry := logger.WithFields(logrus.Fields{"pages_host": "group.gitlab.io", "host": "127.0.0.1"})
+	entry.Info("served")
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &fields))
+
+	require.Equal(t, "served", fields["message"])
+	require.Equal(t, "info", fields["log.level"])
+	require.Equal(t, "group.gitlab.io", fields["url.domain"])
+	require.Equal(t, "eu-west-1", fields["datacenter"])
+	// the fields of the entry take precedence over the static fields
+	require.Equal(t, "127.0.0.1", fields["host"])
+	require.NotContains(t, fields, "msg")
+	require.NotContains(t, fields, "pages_host")
+	require.Contains(t, fields, "time")
+
+	// the entry itself is not changed
+	require.Contains(t, entry.Data, "pages_host")
+}
+
+func TestFieldsFormatterWithoutFields(t *testing.T) {
+	formatter := &logrus.JSONFormatter{}
+
+	require.Same(t, formatter, newFieldsFormatter(formatter, map[string]string{}, nil))
+}
+
+func TestTruncate(t *testing.T) {
+	require.Equal(t, "abc", Truncate("abc", 3))
+	require.Equal(t, "ab...", Truncate("abc", 2))
+	require.Equal(t, "...", Truncate("abc", 0))
+}
@@ -0,0 +1,178 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the suffix of the rotated log files, which sorts them
+// by age
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// file is a log file, rotated when it grows over maxSize bytes or when it
+// was opened longer than maxAge ago. A zero maxSize or maxAge disables the
+// rotation. maxBackups rotated files are kept, 0 keeps them all.
+type file struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+}
+
+func openFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*file, error) {
+	f := &file{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write writes p to the log file, after rotating it when p would exceed its
+// size or when it is too old
+func (f *file) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if f.rotationDue(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// Reopen closes the log file and opens its path again, after it was moved
+// by an external rotation such as logrotate
+func (f *file) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f != nil {
+		f.f.Close()
+		f.f = nil
+	}
+
+	return f.open()
+}
+
+// Close closes the log file
+func (f *file) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f == nil {
+		return nil
+	}
+
+	err := f.f.Close()
+	f.f = nil
+
+	return err
+}
+
+func (f *file) open() error {
+	opened, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := opened.Stat()
+	if err != nil {
+		opened.Close()
+		return err
+	}
+
+	f.f = opened
+	f.size = info.Size()
+	f.openedAt = f.now()
+
+	return nil
+}
+
+func (f *file) rotationDue(size int64) bool {
+	// a file is not rotated empty, even when a single write exceeds maxSize
+	if f.size == 0 {
+		return false
+	}
+
+	if f.maxSize > 0 && f.size+size > f.maxSize {
+		return true
+	}
+
+	return f.maxAge > 0 && f.now().Sub(f.openedAt) >= f.maxAge
+}
+
+// rotate renames the log file after the current time and opens a new one
+func (f *file) rotate() error {
+	f.f.Close()
+	f.f = nil
+
+	if err := os.Rename(f.path, f.path+"."+f.now().UTC().Format(backupTimeFormat)); err != nil {
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.removeBackups()
+
+	return nil
+}
+
+// removeBackups removes the oldest rotated files above maxBackups
+func (f *file) removeBackups() {
+	if f.maxBackups <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+
+	backups := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(match, f.path+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+
+	if len(backups) <= f.maxBackups {
+		return
+	}
+
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-f.maxBackups] {
+		// the log file is being written, the errors are not logged
+		os.Remove(backup)
+	}
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func backups(t *testing.T, path string) []string {
+	t.Helper()
+
+	matches, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+
+	return matches
+}
+
+func TestFileRotatesOnSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.log")
+
+	f, err := openFile(path, 10, 0, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	_, err = f.Write([]byte("first\n"))
+	require.NoError(t, err)
+	require.Empty(t, backups(t, path))
+
+	_, err = f.Write([]byte("second\n"))
+	require.NoError(t, err)
+
+	rotated := backups(t, path)
+	require.Equal(t, []string{path + ".2022-03-01T12-00-00.000"}, rotated)
+
+	content, err := os.ReadFile(rotated[0])
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(content))
+
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second\n", string(content))
+}
+
+func TestFileRotatesOnAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.log")
+
+	f, err := openFile(path, 0, time.Hour, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	now := time.Now()
+	f.now = func() time.Time { return now }
+	f.openedAt = now
+
+	_, err = f.Write([]byte("first\n"))
+	require.NoError(t, err)
+
+	now = now.Add(59 * time.Minute)
+	_, err = f.Write([]byte("second\n"))
+	require.NoError(t, err)
+	require.Empty(t, backups(t, path))
+
+	now = now.Add(time.Minute)
+	_, err = f.Write([]byte("third\n"))
+	require.NoError(t, err)
+	require.Len(t, backups(t, path), 1)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "third\n", string(content))
+}
+
+func TestFileRemovesBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pages.log")
+
+	// files which are not rotated log files are kept
+	require.NoError(t, os.WriteFile(path+".gz", nil, 0600))
+
+	f, err := openFile(path, 1, 0, 2)
+	require.NoError(t, err)
+	defer f.Close()
+
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Second)
+		_, err = f.Write([]byte("line\n"))
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, []string{
+		path + ".2022-03-01T12-00-04.000",
+		path + ".2022-03-01T12-00-05.000",
+		path + ".gz",
+	}, backups(t, path))
+}
+
+func TestFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.log")
+
+	f, err := openFile(path, 0, 0, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("first\n"))
+	require.NoError(t, err)
+
+	// logrotate moves the file away before signaling
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, f.Reopen())
+
+	_, err = f.Write([]byte("second\n"))
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second\n", string(content))
+
+	content, err = os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(content))
+}
@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// journaldSocket is the socket of the native protocol of journald
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldFields are set by the hook itself, the log fields of the same
+// names are left out
+var journaldFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+}
+
+// journaldHook sends the log entries to journald with the native protocol,
+// the fields of an entry are sent as journal fields so that they can be
+// queried, e.g. `journalctl PAGES_HOST=group.gitlab.io`
+type journaldHook struct {
+	conn net.Conn
+}
+
+func newJournaldHook(socket string) (*journaldHook, error) {
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to journald: %w", err)
+	}
+
+	return &journaldHook{conn: conn}, nil
+}
+
+// Levels sends the entries of every level, the level of the logger applies
+func (h *journaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire sends entry as a single datagram
+func (h *journaldHook) Fire(entry *logrus.Entry) error {
+	_, err := h.conn.Write(journaldMessage(entry))
+
+	return err
+}
+
+func journaldMessage(entry *logrus.Entry) []byte {
+	var buf bytes.Buffer
+
+	writeJournaldField(&buf, "MESSAGE", entry.Message)
+	writeJournaldField(&buf, "PRIORITY", fmt.Sprint(severity(entry.Level)))
+	writeJournaldField(&buf, "SYSLOG_IDENTIFIER", appName)
+
+	fields := make([]string, 0, len(entry.Data))
+	for field := range entry.Data {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		name := journaldFieldName(field)
+		if name == "" || journaldFields[name] {
+			continue
+		}
+
+		value := entry.Data[field]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+
+		writeJournaldField(&buf, name, fmt.Sprint(value))
+	}
+
+	return buf.Bytes()
+}
+
+// writeJournaldField writes a field as NAME=value, or with the length of
+// the value when it spans several lines
+func writeJournaldField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value))) // nolint:errcheck // writes to a bytes.Buffer do not fail
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journaldFieldName returns the journal field of a log field, journal fields
+// are made of uppercase letters, digits and underscores, and the ones starting
+// with an underscore are reserved to journald
+func journaldFieldName(field string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, field)
+
+	name = strings.TrimLeft(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return ""
+	}
+
+	return name
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournaldHook(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "socket")
+
+	conn, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	hook, err := newJournaldHook(socket)
+	require.NoError(t, err)
+
+	newHookLogger(hook).WithFields(logrus.Fields{
+		"pages_host": "group.gitlab.io",
+		"error":      errors.New("not found"),
+		"message":    "left out",
+	}).Warn("domain not found")
+
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	require.Equal(t, "MESSAGE=domain not found\n"+
+		"PRIORITY=4\n"+
+		"SYSLOG_IDENTIFIER=gitlab-pages\n"+
+		"ERROR=not found\n"+
+		"PAGES_HOST=group.gitlab.io\n", string(buf[:n]))
+}
+
+func TestJournaldMessageMultiline(t *testing.T) {
+	entry := &logrus.Entry{Message: "panic\nstack", Level: logrus.PanicLevel, Data: logrus.Fields{}}
+
+	require.Equal(t, "MESSAGE\n\x0b\x00\x00\x00\x00\x00\x00\x00panic\nstack\n"+
+		"PRIORITY=0\n"+
+		"SYSLOG_IDENTIFIER=gitlab-pages\n", string(journaldMessage(entry)))
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	tests := map[string]string{
+		"pages_host":     "PAGES_HOST",
+		"req.method":     "REQ_METHOD",
+		"_private":       "PRIVATE",
+		"1st":            "",
+		"correlation_id": "CORRELATION_ID",
+	}
+
+	for field, expected := range tests {
+		require.Equal(t, expected, journaldFieldName(field), field)
+	}
+}
@@ -1,34 +1,99 @@
 package logging
 
 import (
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 	"gitlab.com/gitlab-org/labkit/correlation"
 	"gitlab.com/gitlab-org/labkit/log"
 
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
 )
 
+// accessLogDisabled is set while the access logs are disabled at runtime
+var accessLogDisabled int32
+
+// logFile is the file the system and access logs are written to, nil when
+// they are written to stderr
+var logFile *file
+
+// logHook sends the system and access logs to syslog or journald instead of
+// stderr or the log file, nil when not
+var logHook logrus.Hook
+
 // ConfigureLogging will initialize the system logger.
-func ConfigureLogging(format string, verbose bool) error {
+func ConfigureLogging(cfg *config.Log) error {
 	var levelOption log.LoggerOption
 
+	format := cfg.Format
 	if format == "" {
 		format = "json"
 	}
 
-	if verbose {
+	if cfg.Verbose {
 		levelOption = log.WithLogLevel("trace")
 	} else {
 		levelOption = log.WithLogLevel("info")
 	}
 
-	_, err := log.Initialize(
+	opts := []log.LoggerOption{
 		log.WithFormatter(format),
 		levelOption,
-	)
-	return err
+	}
+
+	if cfg.File != "" {
+		f, err := openFile(cfg.File, cfg.FileMaxSize, cfg.FileMaxAge, cfg.FileMaxBackups)
+		if err != nil {
+			return err
+		}
+
+		logFile = f
+		opts = append(opts, log.WithWriter(f))
+	}
+
+	hook, err := newHook(cfg)
+	if err != nil {
+		return err
+	}
+
+	if hook != nil {
+		logHook = hook
+		opts = append(opts, log.WithWriter(io.Discard))
+	}
+
+	if _, err := log.Initialize(opts...); err != nil {
+		return err
+	}
+
+	fieldMap, staticFields, err := cfg.Fields()
+	if err != nil {
+		return err
+	}
+
+	logger := logrus.StandardLogger()
+	logger.SetFormatter(newFieldsFormatter(logger.Formatter, fieldMap, staticFields))
+
+	if logHook != nil {
+		logger.AddHook(logHook)
+	}
+
+	return nil
+}
+
+func newHook(cfg *config.Log) (logrus.Hook, error) {
+	switch cfg.Target {
+	case config.LogTargetSyslog:
+		return newSyslogHook(cfg.SyslogAddress)
+	case config.LogTargetJournald:
+		return newJournaldHook(journaldSocket)
+	}
+
+	return nil, nil
 }
 
 // getAccessLogger will return the default logger, except when
@@ -40,14 +105,26 @@ func getAccessLogger(format string) (*logrus.Logger, error) {
 	}
 
 	accessLogger := log.New()
-	_, err := log.Initialize(
+	opts := []log.LoggerOption{
 		log.WithLogger(accessLogger),  // Configure `accessLogger`
 		log.WithFormatter("combined"), // Use the combined formatter
-	)
+	}
+	if logFile != nil {
+		opts = append(opts, log.WithWriter(logFile))
+	}
+	if logHook != nil {
+		opts = append(opts, log.WithWriter(io.Discard))
+	}
+
+	_, err := log.Initialize(opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	if logHook != nil {
+		accessLogger.AddHook(logHook)
+	}
+
 	return accessLogger, nil
 }
 
@@ -58,11 +135,74 @@ func BasicAccessLogger(handler http.Handler, format string, extraFields log.Extr
 		return nil, err
 	}
 
-	return log.AccessLogger(handler,
+	logged := log.AccessLogger(handler,
 		log.WithExtraFields(enrichExtraFields(extraFields)),
 		log.WithAccessLogger(accessLogger),
 		log.WithXFFAllowed(func(sip string) bool { return false }),
-	), nil
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !AccessLogEnabled() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		logged.ServeHTTP(w, r)
+	}), nil
+}
+
+// ReopenOnSignal reopens the log file every time the process receives sig,
+// for external rotation such as logrotate. It does nothing when the logs are
+// written to stderr.
+func ReopenOnSignal(sig os.Signal) {
+	if logFile == nil {
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig)
+
+	go func() {
+		for range signals {
+			if err := logFile.Reopen(); err != nil {
+				log.WithError(err).WithField("path", logFile.path).Error("failed to reopen the log file")
+			}
+		}
+	}()
+}
+
+// AccessLogEnabled returns false while the access logs are disabled
+func AccessLogEnabled() bool {
+	return atomic.LoadInt32(&accessLogDisabled) == 0
+}
+
+// SetAccessLog enables or disables the access logs of the handlers returned
+// by BasicAccessLogger
+func SetAccessLog(enabled bool) {
+	var disabled int32
+	if !enabled {
+		disabled = 1
+	}
+
+	atomic.StoreInt32(&accessLogDisabled, disabled)
+}
+
+// Level returns the level of the system logger
+func Level() string {
+	return logrus.GetLevel().String()
+}
+
+// SetLevel changes the level of the system logger, and of the access logs
+// unless they use the text format
+func SetLevel(level string) error {
+	l, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	logrus.SetLevel(l)
+
+	return nil
 }
 
 func enrichExtraFields(extraFields log.ExtraFieldsGeneratorFunc) log.ExtraFieldsGeneratorFunc {
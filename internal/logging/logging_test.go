@@ -1,9 +1,13 @@
 package logging
 
 import (
+	"bytes"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
@@ -85,3 +89,32 @@ func TestGetExtraLogFields(t *testing.T) {
 		})
 	}
 }
+
+func TestSetAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	defer logrus.SetOutput(os.Stderr)
+	defer SetAccessLog(true)
+
+	handler, err := BasicAccessLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "json", nil)
+	require.NoError(t, err)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/logged", nil))
+	require.Contains(t, buf.String(), "/logged")
+
+	SetAccessLog(false)
+	require.False(t, AccessLogEnabled())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/not-logged", nil))
+	require.NotContains(t, buf.String(), "/not-logged")
+}
+
+func TestSetLevel(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+
+	require.NoError(t, SetLevel("debug"))
+	require.Equal(t, "debug", Level())
+
+	require.Error(t, SetLevel("verbose"))
+	require.Equal(t, "debug", Level())
+}
@@ -0,0 +1,175 @@
+package logging
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	appName = "gitlab-pages"
+
+	// facilityDaemon is the syslog facility of system daemons
+	facilityDaemon = 3
+
+	// rfc5424Time is the timestamp of RFC 5424, which allows microseconds at
+	// most
+	rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+
+	syslogTimeout = 5 * time.Second
+)
+
+// syslogHook sends the log entries to a syslog server in the RFC 5424
+// format. The message is the entry formatted by its logger, so that it keeps
+// the log-format and the log fields.
+type syslogHook struct {
+	network  string
+	address  string
+	hostname string
+	pid      int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream bool
+}
+
+// newSyslogHook connects to the syslog server of address, formatted as
+// udp://host:port, tcp://host:port or unix:///path
+func newSyslogHook(address string) (*syslogHook, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	h := &syslogHook{
+		network:  u.Scheme,
+		address:  u.Host,
+		hostname: hostname,
+		pid:      os.Getpid(),
+	}
+	if h.network == "unix" {
+		h.address = u.Path
+	}
+
+	if err := h.connect(); err != nil {
+		return nil, fmt.Errorf("could not connect to syslog at %s: %w", address, err)
+	}
+
+	return h, nil
+}
+
+// connect dials the syslog server, the unix sockets such as /dev/log are
+// usually datagram sockets
+func (h *syslogHook) connect() error {
+	networks := []string{h.network}
+	if h.network == "unix" {
+		networks = []string{"unixgram", "unix"}
+	}
+
+	var err error
+	for _, network := range networks {
+		var conn net.Conn
+		conn, err = net.DialTimeout(network, h.address, syslogTimeout)
+		if err == nil {
+			h.conn = conn
+			h.stream = network == "tcp" || network == "unix"
+			return nil
+		}
+	}
+
+	return err
+}
+
+// Levels sends the entries of every level, the level of the logger applies
+func (h *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire sends entry, after reconnecting when the connection was lost
+func (h *syslogHook) Fire(entry *logrus.Entry) error {
+	formatted, err := entry.Logger.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	msg := h.message(entry, strings.TrimRight(string(formatted), "\n"))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conn != nil {
+		if err = h.write(msg); err == nil {
+			return nil
+		}
+
+		h.conn.Close()
+		h.conn = nil
+	}
+
+	if err := h.connect(); err != nil {
+		return err
+	}
+
+	return h.write(msg)
+}
+
+// message formats an RFC 5424 message, without message ID nor structured
+// data
+func (h *syslogHook) message(entry *logrus.Entry, msg string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		facilityDaemon*8+severity(entry.Level),
+		entry.Time.Format(rfc5424Time),
+		h.hostname,
+		appName,
+		h.pid,
+		msg,
+	)
+}
+
+// write frames msg by octet counting on TCP, as in RFC 6587, and by a newline
+// on unix stream sockets
+func (h *syslogHook) write(msg string) error {
+	if h.stream {
+		if h.network == "tcp" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		} else {
+			msg += "\n"
+		}
+	}
+
+	h.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+
+	_, err := h.conn.Write([]byte(msg))
+
+	return err
+}
+
+// severity returns the syslog severity of level, which journald uses as
+// priority
+func severity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0 // emerg
+	case logrus.FatalLevel:
+		return 2 // crit
+	case logrus.ErrorLevel:
+		return 3 // err
+	case logrus.WarnLevel:
+		return 4 // warning
+	case logrus.InfoLevel:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func newHookLogger(hook logrus.Hook) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(hook)
+
+	return logger
+}
+
+func TestSyslogHookUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	hook, err := newSyslogHook("udp://" + conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	newHookLogger(hook).WithField("pages_host", "group.gitlab.io").Warn("domain not found")
+
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	// <daemon.warning>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	pattern := fmt.Sprintf(`^<28>1 \S+ \S+ gitlab-pages %d - - \{.*"msg":"domain not found".*\}$`, os.Getpid())
+	require.Regexp(t, regexp.MustCompile(pattern), string(buf[:n]))
+	require.Contains(t, string(buf[:n]), `"pages_host":"group.gitlab.io"`)
+}
+
+func TestSyslogHookTCPReconnects(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	hook, err := newSyslogHook("tcp://" + listener.Addr().String())
+	require.NoError(t, err)
+
+	first, err := listener.Accept()
+	require.NoError(t, err)
+
+	logger := newHookLogger(hook)
+	logger.Info("first")
+
+	reader := bufio.NewReader(first)
+	var length int
+	_, err = fmt.Fscanf(reader, "%d ", &length)
+	require.NoError(t, err)
+
+	msg := make([]byte, length)
+	_, err = io.ReadFull(reader, msg)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(msg), "<30>1 "), "the messages are framed by octet counting")
+	require.Contains(t, string(msg), `"msg":"first"`)
+
+	// the server drops the connection, the writes fail once the peer reset
+	// is noticed
+	first.Close()
+	require.Eventually(t, func() bool {
+		logger.Info("second")
+
+		hook.mu.Lock()
+		defer hook.mu.Unlock()
+
+		return hook.conn != nil && hook.conn.LocalAddr().String() != first.RemoteAddr().String()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	second, err := listener.Accept()
+	require.NoError(t, err)
+	second.Close()
+}
+
+func TestSyslogHookUnixgram(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "log")
+
+	conn, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	hook, err := newSyslogHook("unix://" + socket)
+	require.NoError(t, err)
+	require.False(t, hook.stream)
+
+	newHookLogger(hook).Error("failed")
+
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(buf[:n]), "<27>1 "))
+}
+
+func TestSyslogHookUnreachable(t *testing.T) {
+	_, err := newSyslogHook("unix://" + filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
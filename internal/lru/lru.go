@@ -94,6 +94,17 @@ func (c *Cache) FindOrFetch(cacheNamespace, key string, fetchFn func() (interfac
 	return value, nil
 }
 
+// Len returns the number of items in the cache
+func (c *Cache) Len() int {
+	return c.cache.ItemCount()
+}
+
+// DeletePrefix removes the items of the keys starting with prefix, such as the
+// items of a namespace, and returns how many were removed
+func (c *Cache) DeletePrefix(prefix string) int {
+	return c.cache.DeletePrefix(prefix)
+}
+
 func WithCachedEntriesMetric(m *prometheus.GaugeVec) Option {
 	return func(c *Cache) {
 		c.metricCachedEntries = m
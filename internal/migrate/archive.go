@@ -0,0 +1,208 @@
+package migrate
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+type archiveStats struct {
+	sha256    string
+	fileCount int
+	size      int64
+}
+
+// writeArchive packages publicPath into a zip archive at archivePath with
+// all the entries under `public/`, the layout expected by zip serving.
+// The archive is written to a temporary file first so an interrupted
+// migration never leaves a partial archive behind.
+func writeArchive(publicPath, archivePath string) (*archiveStats, error) {
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(archivePath), ".migrate-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	stats := &archiveStats{}
+
+	zw := zip.NewWriter(io.MultiWriter(tmp, hash))
+
+	err = filepath.WalkDir(publicPath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		return addEntry(zw, publicPath, filePath, d, stats)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp.Name(), archivePath); err != nil {
+		return nil, err
+	}
+
+	stats.sha256 = hex.EncodeToString(hash.Sum(nil))
+
+	return stats, nil
+}
+
+func addEntry(zw *zip.Writer, publicPath, filePath string, d fs.DirEntry, stats *archiveStats) error {
+	relPath, err := filepath.Rel(publicPath, filePath)
+	if err != nil {
+		return err
+	}
+
+	fi, err := d.Info()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+
+	header.Name = path.Join(publicDir, filepath.ToSlash(relPath))
+
+	switch {
+	case fi.IsDir():
+		header.Name += "/"
+		_, err := zw.CreateHeader(header)
+		return err
+
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return err
+		}
+
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(w, target)
+		return err
+
+	case fi.Mode().IsRegular():
+		header.Method = zip.Deflate
+
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		n, err := io.Copy(w, f)
+		if err != nil {
+			return err
+		}
+
+		stats.fileCount++
+		stats.size += n
+
+		return nil
+
+	default:
+		// sockets, devices and pipes are never served
+		return nil
+	}
+}
+
+// verifyArchive reads every entry of the archive back, which validates its
+// checksum, and compares it with the content of publicPath
+func verifyArchive(publicPath, archivePath string) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		if err := verifyEntry(publicPath, file); err != nil {
+			return fmt.Errorf("%s: %w", file.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func verifyEntry(publicPath string, file *zip.File) error {
+	relPath, err := filepath.Rel(publicDir, filepath.FromSlash(file.Name))
+	if err != nil {
+		return err
+	}
+
+	diskPath := filepath.Join(publicPath, relPath)
+
+	fi, err := os.Lstat(diskPath)
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode().Type() != file.Mode().Type() {
+		return fmt.Errorf("file type changed from %v to %v", fi.Mode().Type(), file.Mode().Type())
+	}
+
+	if fi.IsDir() {
+		return nil
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+
+	var expected []byte
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(diskPath)
+		if err != nil {
+			return err
+		}
+		expected = []byte(target)
+	} else {
+		expected, err = os.ReadFile(diskPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !bytes.Equal(content, expected) {
+		return fmt.Errorf("content differs from %s", diskPath)
+	}
+
+	return nil
+}
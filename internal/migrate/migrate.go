@@ -0,0 +1,239 @@
+// Package migrate packages legacy disk deployments into zip archives that
+// can be imported by GitLab as Pages deployments.
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/namsral/flag"
+)
+
+// CommandName is the name of the subcommand running the migration
+const CommandName = "migrate-disk-to-zip"
+
+const publicDir = "public"
+
+var (
+	errNoPagesRoot  = errors.New("pages-root must be defined")
+	errNoOutputDir  = errors.New("output-dir must be defined")
+	errOutputInRoot = errors.New("output-dir must not be inside of pages-root")
+)
+
+// Options configure a migration
+type Options struct {
+	// PagesRoot is the directory holding the legacy `<namespace>/<project>/public` layout
+	PagesRoot string
+	// OutputDir is where the archives are written to, mirroring the project paths
+	OutputDir string
+	// Overwrite replaces archives already present in OutputDir
+	Overwrite bool
+	// Verify reads every archive back and compares it with the disk content
+	Verify bool
+}
+
+// Entry describes a single migrated project in the manifest, the fields
+// match the deployment attributes GitLab stores for a zip archive
+type Entry struct {
+	ProjectPath string `json:"project_path"`
+	ArchivePath string `json:"archive_path"`
+	SHA256      string `json:"sha256,omitempty"`
+	FileCount   int    `json:"file_count,omitempty"`
+	Size        int64  `json:"file_size,omitempty"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Manifest lists the outcome of a migration, it is written as JSON so GitLab
+// can import the archives as deployments
+type Manifest struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Failed returns the number of projects that could not be migrated
+func (m *Manifest) Failed() int {
+	failed := 0
+	for _, e := range m.Entries {
+		if e.Error != "" {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// Main parses the subcommand arguments, runs the migration and writes the
+// manifest. It returns the process exit code.
+func Main(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(CommandName, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	opts := Options{}
+	flags.StringVar(&opts.PagesRoot, "pages-root", "shared/pages", "The directory where pages are stored")
+	flags.StringVar(&opts.OutputDir, "output-dir", "", "The directory where the zip archives are written to")
+	flags.BoolVar(&opts.Overwrite, "overwrite", false, "Replace archives that already exist in output-dir")
+	flags.BoolVar(&opts.Verify, "verify", true, "Read every archive back and compare it with the content on disk")
+	manifestPath := flags.String("manifest", "", "File to write the JSON manifest to, defaults to stdout")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	manifest, err := Run(opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", CommandName, err)
+		return 1
+	}
+
+	out := stdout
+	if *manifestPath != "" {
+		f, err := os.Create(*manifestPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", CommandName, err)
+			return 1
+		}
+		defer f.Close()
+
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", CommandName, err)
+		return 1
+	}
+
+	if failed := manifest.Failed(); failed > 0 {
+		fmt.Fprintf(stderr, "%s: %d project(s) failed to migrate\n", CommandName, failed)
+		return 1
+	}
+
+	return 0
+}
+
+// Run packages every `public` directory found under opts.PagesRoot. A failure
+// of a single project is recorded in its manifest entry and does not stop the
+// migration of the others.
+func Run(opts Options) (*Manifest, error) {
+	root, output, err := validateOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := findProjects(root)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{Entries: make([]Entry, 0, len(projects))}
+
+	for _, projectPath := range projects {
+		manifest.Entries = append(manifest.Entries, migrateProject(root, output, projectPath, opts))
+	}
+
+	return manifest, nil
+}
+
+func validateOptions(opts Options) (string, string, error) {
+	if opts.PagesRoot == "" {
+		return "", "", errNoPagesRoot
+	}
+
+	if opts.OutputDir == "" {
+		return "", "", errNoOutputDir
+	}
+
+	root, err := filepath.Abs(opts.PagesRoot)
+	if err != nil {
+		return "", "", err
+	}
+
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", "", err
+	}
+
+	output, err := filepath.Abs(opts.OutputDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	if output == root || strings.HasPrefix(output, root+string(filepath.Separator)) {
+		return "", "", errOutputInRoot
+	}
+
+	return root, output, nil
+}
+
+// findProjects returns the paths relative to root of all the directories
+// holding a `public` directory, at least two levels deep (`<namespace>/<project>`)
+func findProjects(root string) ([]string, error) {
+	var projects []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() || d.Name() != publicDir {
+			return nil
+		}
+
+		projectPath, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+
+		if strings.Count(filepath.ToSlash(projectPath), "/") < 1 {
+			return nil
+		}
+
+		projects = append(projects, filepath.ToSlash(projectPath))
+
+		// content of the deployment is not a project on its own
+		return filepath.SkipDir
+	})
+
+	return projects, err
+}
+
+func migrateProject(root, output, projectPath string, opts Options) Entry {
+	entry := Entry{
+		ProjectPath: projectPath,
+		ArchivePath: filepath.Join(output, filepath.FromSlash(projectPath)+".zip"),
+	}
+
+	if !opts.Overwrite {
+		if _, err := os.Stat(entry.ArchivePath); err == nil {
+			entry.Skipped = true
+			return entry
+		}
+	}
+
+	publicPath := filepath.Join(root, filepath.FromSlash(projectPath), publicDir)
+
+	stats, err := writeArchive(publicPath, entry.ArchivePath)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.SHA256 = stats.sha256
+	entry.FileCount = stats.fileCount
+	entry.Size = stats.size
+
+	if opts.Verify {
+		if err := verifyArchive(publicPath, entry.ArchivePath); err != nil {
+			entry.Error = fmt.Sprintf("verification failed: %v", err)
+		}
+	}
+
+	return entry
+}
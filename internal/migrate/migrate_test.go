@@ -0,0 +1,166 @@
+package migrate
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func pagesRoot(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	files := map[string]string{
+		"group/project/public/index.html":            "<p>project</p>",
+		"group/project/public/css/main.css":          "body {}",
+		"group/project/config.json":                  `{"domains":[]}`,
+		"group/subgroup/nested/public/index.html":    "<p>nested</p>",
+		"group/subgroup/nested/public/public/a.html": "<p>directory named public</p>",
+		"group/no-deployment/README.md":              "not deployed",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	require.NoError(t, os.Symlink("index.html", filepath.Join(root, "group/project/public/home.html")))
+
+	return root
+}
+
+func TestRun(t *testing.T) {
+	root := pagesRoot(t)
+	output := t.TempDir()
+
+	manifest, err := Run(Options{PagesRoot: root, OutputDir: output, Verify: true})
+	require.NoError(t, err)
+	require.Zero(t, manifest.Failed())
+	require.Len(t, manifest.Entries, 2)
+
+	project := manifest.Entries[0]
+	require.Equal(t, "group/project", project.ProjectPath)
+	require.Equal(t, filepath.Join(output, "group", "project.zip"), project.ArchivePath)
+	require.Equal(t, 2, project.FileCount)
+	require.Equal(t, int64(len("<p>project</p>")+len("body {}")), project.Size)
+	require.Len(t, project.SHA256, 64)
+
+	require.Equal(t, []string{
+		"public/",
+		"public/css/",
+		"public/css/main.css",
+		"public/home.html",
+		"public/index.html",
+	}, archiveEntries(t, project.ArchivePath))
+
+	nested := manifest.Entries[1]
+	require.Equal(t, "group/subgroup/nested", nested.ProjectPath)
+	require.Equal(t, []string{
+		"public/",
+		"public/index.html",
+		"public/public/",
+		"public/public/a.html",
+	}, archiveEntries(t, nested.ArchivePath))
+}
+
+func TestRunSkipsExistingArchives(t *testing.T) {
+	root := pagesRoot(t)
+	output := t.TempDir()
+
+	_, err := Run(Options{PagesRoot: root, OutputDir: output})
+	require.NoError(t, err)
+
+	manifest, err := Run(Options{PagesRoot: root, OutputDir: output})
+	require.NoError(t, err)
+	require.True(t, manifest.Entries[0].Skipped)
+	require.Empty(t, manifest.Entries[0].SHA256)
+
+	manifest, err = Run(Options{PagesRoot: root, OutputDir: output, Overwrite: true})
+	require.NoError(t, err)
+	require.False(t, manifest.Entries[0].Skipped)
+	require.NotEmpty(t, manifest.Entries[0].SHA256)
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	root := pagesRoot(t)
+
+	tests := map[string]struct {
+		opts        Options
+		expectedErr error
+	}{
+		"no_pages_root": {
+			opts:        Options{OutputDir: t.TempDir()},
+			expectedErr: errNoPagesRoot,
+		},
+		"no_output_dir": {
+			opts:        Options{PagesRoot: root},
+			expectedErr: errNoOutputDir,
+		},
+		"output_dir_in_pages_root": {
+			opts:        Options{PagesRoot: root, OutputDir: filepath.Join(root, "archives")},
+			expectedErr: errOutputInRoot,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Run(tt.opts)
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestVerifyArchiveDetectsChanges(t *testing.T) {
+	root := pagesRoot(t)
+	publicPath := filepath.Join(root, "group", "project", "public")
+	archivePath := filepath.Join(t.TempDir(), "project.zip")
+
+	_, err := writeArchive(publicPath, archivePath)
+	require.NoError(t, err)
+	require.NoError(t, verifyArchive(publicPath, archivePath))
+
+	require.NoError(t, os.WriteFile(filepath.Join(publicPath, "index.html"), []byte("changed"), 0644))
+	require.Error(t, verifyArchive(publicPath, archivePath))
+}
+
+func TestMainWritesManifest(t *testing.T) {
+	root := pagesRoot(t)
+	output := t.TempDir()
+
+	var stdout, stderr bytes.Buffer
+	code := Main([]string{"-pages-root", root, "-output-dir", output}, &stdout, &stderr)
+	require.Zero(t, code, stderr.String())
+
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &manifest))
+	require.Len(t, manifest.Entries, 2)
+
+	code = Main([]string{"-pages-root", root}, io.Discard, &stderr)
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr.String(), errNoOutputDir.Error())
+}
+
+func archiveEntries(t *testing.T, archivePath string) []string {
+	t.Helper()
+
+	zr, err := zip.OpenReader(archivePath)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
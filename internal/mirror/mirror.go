@@ -0,0 +1,182 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/export"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/share"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// MirroredHeader is set on every mirrored request so the secondary
+// deployment can tell them apart from live traffic
+const MirroredHeader = "Gitlab-Pages-Mirrored"
+
+// headers that carry the identity of the user are never sent to the
+// secondary deployment
+var credentialHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "PRIVATE-TOKEN"}
+
+// credentialQueryParams are the query parameters that carry a token, removed
+// like the credential headers
+var credentialQueryParams = []string{share.QueryParam, export.QueryParam}
+
+// Mirror duplicates a sample of the read requests to a secondary Pages
+// deployment. Mirrored requests are sent in the background and their
+// responses are discarded, they never affect the response to the client.
+type Mirror struct {
+	target     *url.URL
+	sampleRate float64
+	timeout    time.Duration
+	client     *http.Client
+	inFlight   chan struct{}
+	random     func() float64
+}
+
+// New returns a Mirror sending requests to cfg.URL, or nil if mirroring is
+// disabled
+func New(cfg *config.Mirror) (*Mirror, error) {
+	if cfg.URL == "" || cfg.SamplePercentage <= 0 {
+		return nil, nil
+	}
+
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mirror{
+		target:     target,
+		sampleRate: cfg.SamplePercentage / 100,
+		timeout:    cfg.Timeout,
+		client: &http.Client{
+			Transport: httptransport.NewTransport(),
+			// the secondary responses are never relayed, including redirects
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		inFlight: make(chan struct{}, cfg.MaxInFlight),
+		random:   rand.Float64,
+	}, nil
+}
+
+// NewMiddleware returns middleware mirroring sampled requests before they are
+// served by handler. It returns handler as is when m is nil.
+func NewMiddleware(handler http.Handler, m *Mirror) http.Handler {
+	if m == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mirror(r)
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (m *Mirror) mirror(r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return
+	}
+
+	if m.random() >= m.sampleRate {
+		return
+	}
+
+	req, err := m.newRequest(r)
+	if err != nil {
+		metrics.MirroredRequests.WithLabelValues("error").Inc()
+		return
+	}
+
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		// the secondary is not keeping up, live traffic is never held back
+		metrics.MirroredRequests.WithLabelValues("dropped").Inc()
+		return
+	}
+
+	go func() {
+		defer func() { <-m.inFlight }()
+
+		m.send(req)
+	}()
+}
+
+// newRequest copies r without its body and credentials, it is created
+// synchronously as r must not be accessed once it has been served
+func (m *Mirror) newRequest(r *http.Request) (*http.Request, error) {
+	target := *m.target
+	target.Path = r.URL.Path
+	target.RawPath = r.URL.RawPath
+	target.RawQuery = withoutCredentials(r.URL.RawQuery)
+
+	// the request outlives the client connection, so it gets its own context
+	req, err := http.NewRequest(r.Method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = r.Header.Clone()
+	req.Host = r.Host
+
+	for _, h := range credentialHeaders {
+		req.Header.Del(h)
+	}
+	req.Header.Set(MirroredHeader, "true")
+
+	return req, nil
+}
+
+// withoutCredentials removes the credentialQueryParams from rawQuery, which
+// is kept as is when it has none of them
+func withoutCredentials(rawQuery string) string {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// the secondary may not parse it the same way
+		return ""
+	}
+
+	found := false
+	for _, param := range credentialQueryParams {
+		if _, ok := query[param]; ok {
+			query.Del(param)
+			found = true
+		}
+	}
+
+	if !found {
+		return rawQuery
+	}
+
+	return query.Encode()
+}
+
+func (m *Mirror) send(req *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	resp, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		metrics.MirroredRequests.WithLabelValues("error").Inc()
+		log.WithError(err).WithField("host", req.Host).Debug("failed to mirror request")
+		return
+	}
+
+	// nolint: errcheck
+	// best effort to discard and close the response body
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	metrics.MirroredRequests.WithLabelValues("sent").Inc()
+}
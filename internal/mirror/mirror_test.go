@@ -0,0 +1,170 @@
+package mirror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func newSecondary(t *testing.T, handler http.HandlerFunc) (*httptest.Server, chan *http.Request) {
+	t.Helper()
+
+	received := make(chan *http.Request, 10)
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		if handler != nil {
+			handler(w, r)
+		}
+	}))
+	t.Cleanup(secondary.Close)
+
+	return secondary, received
+}
+
+func newMirror(t *testing.T, url string, random float64) *Mirror {
+	t.Helper()
+
+	m, err := New(&config.Mirror{
+		URL:              url,
+		SamplePercentage: 50,
+		Timeout:          time.Second,
+		MaxInFlight:      1,
+	})
+	require.NoError(t, err)
+
+	m.random = func() float64 { return random }
+
+	return m
+}
+
+func TestNewDisabled(t *testing.T) {
+	m, err := New(&config.Mirror{})
+	require.NoError(t, err)
+	require.Nil(t, m)
+
+	m, err = New(&config.Mirror{URL: "http://pages-canary.example.com"})
+	require.NoError(t, err)
+	require.Nil(t, m)
+}
+
+func TestMirrorRequest(t *testing.T) {
+	secondary, received := newSecondary(t, nil)
+	handler := NewMiddleware(okHandler, newMirror(t, secondary.URL, 0.1))
+
+	r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/index.html?a=b", nil)
+	r.Header.Set("Cookie", "gitlab-pages=session")
+	r.Header.Set("Authorization", "Bearer token")
+	r.Header.Set("PRIVATE-TOKEN", "pat")
+	r.Header.Set("User-Agent", "test-agent")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	select {
+	case mirrored := <-received:
+		require.Equal(t, http.MethodGet, mirrored.Method)
+		require.Equal(t, "group.gitlab-example.com", mirrored.Host)
+		require.Equal(t, "/project/index.html?a=b", mirrored.URL.RequestURI())
+		require.Equal(t, "test-agent", mirrored.Header.Get("User-Agent"))
+		require.Equal(t, "true", mirrored.Header.Get(MirroredHeader))
+		require.Empty(t, mirrored.Header.Get("Cookie"))
+		require.Empty(t, mirrored.Header.Get("Authorization"))
+		require.Empty(t, mirrored.Header.Get("PRIVATE-TOKEN"))
+	case <-time.After(time.Second):
+		t.Fatal("request was not mirrored")
+	}
+}
+
+func TestWithoutCredentials(t *testing.T) {
+	tests := map[string]struct {
+		query    string
+		expected string
+	}{
+		"without_tokens": {
+			query:    "b=2&a=1",
+			expected: "b=2&a=1",
+		},
+		"share_token": {
+			query:    "a=1&pages_share_token=secret",
+			expected: "a=1",
+		},
+		"export_token": {
+			query:    "pages_export_token=secret",
+			expected: "",
+		},
+		"invalid": {
+			query:    "a=%zz&pages_share_token=secret",
+			expected: "",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.expected, withoutCredentials(tt.query))
+		})
+	}
+}
+
+func TestMirrorSkipsRequests(t *testing.T) {
+	tests := map[string]struct {
+		method string
+		random float64
+	}{
+		"not_sampled": {method: http.MethodGet, random: 0.7},
+		"write":       {method: http.MethodPost, random: 0.1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			secondary, received := newSecondary(t, nil)
+			handler := NewMiddleware(okHandler, newMirror(t, secondary.URL, tt.random))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, "https://group.gitlab-example.com/", nil))
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			select {
+			case <-received:
+				t.Fatal("request should not be mirrored")
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestMirrorDoesNotDelayResponses(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	secondary, received := newSecondary(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	handler := NewMiddleware(okHandler, newMirror(t, secondary.URL, 0.1))
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Less(t, time.Since(start), 500*time.Millisecond)
+	}
+
+	// only one request fits in flight, the others are dropped
+	<-received
+	select {
+	case <-received:
+		t.Fatal("requests above the in flight limit should be dropped")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
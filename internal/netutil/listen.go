@@ -0,0 +1,120 @@
+package netutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	errListenNetwork  = errors.New("network must be one of tcp, tcp4 or tcp6")
+	errListenFastOpen = errors.New("fastopen must be the length of the queue of pending connections")
+)
+
+// ListenOptions are the socket options of a listener, given as URI
+// parameters of its address, e.g. [::]:443?network=tcp6&reuseport=true
+type ListenOptions struct {
+	// Network selects the IP version, tcp listens on both IPv4 and IPv6 when
+	// the address is unspecified, tcp4 and tcp6 only on one of them
+	Network string
+	// ReusePort sets SO_REUSEPORT, so that multiple daemons can accept
+	// connections on the same address of a host
+	ReusePort bool
+	// FastOpen enables TCP Fast Open with a queue of FastOpen pending
+	// connections, 0 disables it
+	FastOpen int
+	// ProxyProtocol requires the connections to start with a PROXY protocol
+	// v1 or v2 header, which carries the address of the client behind a TCP
+	// load balancer
+	ProxyProtocol bool
+}
+
+// ParseListenAddress splits addr into the address to listen on and its
+// options
+func ParseListenAddress(addr string) (string, ListenOptions, error) {
+	opts := ListenOptions{Network: "tcp"}
+
+	i := strings.Index(addr, "?")
+	if i < 0 {
+		return addr, opts, nil
+	}
+
+	query, err := url.ParseQuery(addr[i+1:])
+	if err != nil {
+		return "", opts, err
+	}
+
+	addr = addr[:i]
+
+	for key, values := range query {
+		value := values[len(values)-1]
+
+		switch key {
+		case "network":
+			if value != "tcp" && value != "tcp4" && value != "tcp6" {
+				return "", opts, errListenNetwork
+			}
+			opts.Network = value
+		case "reuseport":
+			if opts.ReusePort, err = strconv.ParseBool(value); err != nil {
+				return "", opts, fmt.Errorf("invalid reuseport: %w", err)
+			}
+		case "fastopen":
+			if opts.FastOpen, err = strconv.Atoi(value); err != nil || opts.FastOpen < 0 {
+				return "", opts, errListenFastOpen
+			}
+		case "proxyprotocol":
+			if opts.ProxyProtocol, err = strconv.ParseBool(value); err != nil {
+				return "", opts, fmt.Errorf("invalid proxyprotocol: %w", err)
+			}
+		default:
+			return "", opts, fmt.Errorf("unknown listener option %q", key)
+		}
+	}
+
+	return addr, opts, nil
+}
+
+// Listen announces on addr, an address optionally followed by ListenOptions
+func Listen(addr string) (net.Listener, error) {
+	addr, opts, err := ParseListenAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	lc := net.ListenConfig{Control: opts.control}
+
+	return lc.Listen(context.Background(), opts.Network, addr)
+}
+
+// control sets the socket options before the socket is bound
+func (opts ListenOptions) control(network, address string, c syscall.RawConn) error {
+	var sockErr error
+
+	err := c.Control(func(fd uintptr) {
+		if opts.ReusePort {
+			if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); sockErr != nil {
+				sockErr = fmt.Errorf("setting SO_REUSEPORT: %w", sockErr)
+				return
+			}
+		}
+
+		if opts.FastOpen > 0 {
+			if sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, opts.FastOpen); sockErr != nil {
+				sockErr = fmt.Errorf("setting TCP_FASTOPEN: %w", sockErr)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
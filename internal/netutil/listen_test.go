@@ -0,0 +1,76 @@
+package netutil
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	tests := map[string]struct {
+		addr         string
+		expectedAddr string
+		expectedOpts ListenOptions
+		expectedErr  string
+	}{
+		"without_options": {
+			addr:         "127.0.0.1:80",
+			expectedAddr: "127.0.0.1:80",
+			expectedOpts: ListenOptions{Network: "tcp"},
+		},
+		"all_options": {
+			addr:         "[::]:443?network=tcp6&reuseport=true&fastopen=256&proxyprotocol=true",
+			expectedAddr: "[::]:443",
+			expectedOpts: ListenOptions{Network: "tcp6", ReusePort: true, FastOpen: 256, ProxyProtocol: true},
+		},
+		"invalid_network": {
+			addr:        ":80?network=udp",
+			expectedErr: errListenNetwork.Error(),
+		},
+		"invalid_reuseport": {
+			addr:        ":80?reuseport=maybe",
+			expectedErr: `invalid reuseport: strconv.ParseBool: parsing "maybe": invalid syntax`,
+		},
+		"invalid_proxyprotocol": {
+			addr:        ":80?proxyprotocol=v2",
+			expectedErr: `invalid proxyprotocol: strconv.ParseBool: parsing "v2": invalid syntax`,
+		},
+		"negative_fastopen": {
+			addr:        ":80?fastopen=-1",
+			expectedErr: errListenFastOpen.Error(),
+		},
+		"unknown_option": {
+			addr:        ":80?backlog=1024",
+			expectedErr: `unknown listener option "backlog"`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			addr, opts, err := ParseListenAddress(tt.addr)
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedAddr, addr)
+			require.Equal(t, tt.expectedOpts, opts)
+		})
+	}
+}
+
+func TestListenReusePort(t *testing.T) {
+	first, err := Listen("127.0.0.1:0?network=tcp4&reuseport=true")
+	require.NoError(t, err)
+	defer first.Close()
+
+	// a second process could accept connections on the same port
+	second, err := Listen(first.Addr().String() + "?network=tcp4&reuseport=true")
+	require.NoError(t, err)
+	defer second.Close()
+
+	_, err = net.Listen("tcp4", first.Addr().String())
+	require.Error(t, err, "the port can only be shared by sockets setting SO_REUSEPORT")
+}
@@ -0,0 +1,197 @@
+// Package prefetch opens the archive of a deployment as soon as GitLab
+// notifies Pages that the deployment completed, so that the first requests
+// after a deploy are not served from a cold cache.
+//
+// GitLab signs the notification with the secret shared with Pages, as the
+// hex-encoded HMAC-SHA256 of the body in the SignatureHeader. The archive is
+// opened from the lookup of the domain, the notification only names it by its
+// sha256.
+package prefetch
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// SignatureHeader holds the signature of the notification, as
+// `sha256=<hex-encoded HMAC-SHA256 of the body>`
+const SignatureHeader = "Gitlab-Pages-Signature"
+
+const (
+	maxBodySize = 64 * 1024
+	// maxConcurrent bounds the archives being prefetched at once, more
+	// notifications are rejected
+	maxConcurrent = 10
+	timeout       = time.Minute
+)
+
+var (
+	errInvalidSignature = errors.New("invalid signature")
+	errInvalidEvent     = errors.New("the event must have a domain and the sha256 of an archive")
+	errUnknownArchive   = errors.New("the archive is not served on the domain")
+)
+
+// Event is the notification of a completed deployment
+type Event struct {
+	Domain  string `json:"domain"`
+	Archive struct {
+		SHA256 string `json:"sha256"`
+	} `json:"archive"`
+}
+
+// Archives resolves the zip archives served on a domain
+type Archives interface {
+	// DomainArchives returns the paths of the zip archives served on the
+	// domain, by sha256, from a fresh lookup of the domain
+	DomainArchives(ctx context.Context, name string) (map[string]string, error)
+}
+
+// OpenFunc opens the archive at path, cached as sha256
+type OpenFunc func(ctx context.Context, path, sha256 string) error
+
+// Handler prefetches the archives of the deployments GitLab notifies
+type Handler struct {
+	secret   []byte
+	archives Archives
+	open     OpenFunc
+	slots    chan struct{}
+}
+
+// NewHandler returns a Handler verifying the notifications with secret. The
+// archive is resolved from the lookup of the domain in archives, and opened
+// with open.
+func NewHandler(secret []byte, archives Archives, open OpenFunc) *Handler {
+	return &Handler{
+		secret:   secret,
+		archives: archives,
+		open:     open,
+		slots:    make(chan struct{}, maxConcurrent),
+	}
+}
+
+// ServeHTTP accepts a signed notification and prefetches its archive in the
+// background
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(body) > maxBodySize {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !ValidSignature(h.secret, r.Header.Get(SignatureHeader), body) {
+		metrics.ArchivePrefetches.WithLabelValues("unauthorized").Inc()
+		http.Error(w, errInvalidSignature.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	event, err := parseEvent(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+	default:
+		metrics.ArchivePrefetches.WithLabelValues("rejected").Inc()
+		http.Error(w, "too many archives being prefetched", http.StatusServiceUnavailable)
+		return
+	}
+
+	go func() {
+		defer func() { <-h.slots }()
+
+		h.prefetch(event)
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ValidSignature returns whether header is the signature of body with secret,
+// as expected in the SignatureHeader
+func ValidSignature(secret []byte, header string, body []byte) bool {
+	if len(secret) == 0 || !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+func parseEvent(body []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+
+	if event.Domain == "" || event.Archive.SHA256 == "" {
+		return nil, errInvalidEvent
+	}
+
+	return &event, nil
+}
+
+// prefetch resolves the lookup of the domain and opens the archive of the
+// event, when the domain serves it
+func (h *Handler) prefetch(event *Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger := log.WithFields(log.Fields{
+		"domain": event.Domain,
+		"sha256": event.Archive.SHA256,
+	})
+
+	archives, err := h.archives.DomainArchives(ctx, strings.ToLower(event.Domain))
+	if err != nil {
+		metrics.ArchivePrefetches.WithLabelValues("failed").Inc()
+		logger.WithError(err).Warn("failed to resolve the lookup of the deployed domain")
+		return
+	}
+
+	path, ok := archives[event.Archive.SHA256]
+	if !ok {
+		metrics.ArchivePrefetches.WithLabelValues("unknown").Inc()
+		logger.WithError(errUnknownArchive).Warn("failed to prefetch the archive of the deployment")
+		return
+	}
+
+	if err := h.open(ctx, path, event.Archive.SHA256); err != nil {
+		metrics.ArchivePrefetches.WithLabelValues("failed").Inc()
+		logger.WithError(err).Warn("failed to prefetch the archive of the deployment")
+		return
+	}
+
+	metrics.ArchivePrefetches.WithLabelValues("prefetched").Inc()
+	logger.Info("prefetched the archive of the deployment")
+}
@@ -0,0 +1,199 @@
+package prefetch
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+)
+
+var secret = []byte("secret")
+
+const validEvent = `{"domain": "Group.GitLab.io", "archive": {"sha256": "abc"}}`
+
+// archivesStub serves the archives of group.gitlab.io and records the domains
+// resolved
+type archivesStub struct {
+	domains chan string
+}
+
+func (s *archivesStub) DomainArchives(_ context.Context, name string) (map[string]string, error) {
+	if s.domains != nil {
+		s.domains <- name
+	}
+
+	if name != "group.gitlab.io" {
+		return nil, domain.ErrDomainDoesNotExist
+	}
+
+	return map[string]string{"abc": "https://objects.example.com/public.zip"}, nil
+}
+
+func sign(body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandlerRejectsInvalidNotifications(t *testing.T) {
+	tests := map[string]struct {
+		method         string
+		body           string
+		signature      string
+		expectedStatus int
+	}{
+		"get": {
+			method:         http.MethodGet,
+			signature:      sign(""),
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		"no_signature": {
+			body:           validEvent,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"invalid_signature": {
+			body:           validEvent,
+			signature:      sign(validEvent + " "),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"invalid_json": {
+			body:           "{",
+			signature:      sign("{"),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"no_domain": {
+			body:           `{"archive": {"sha256": "abc"}}`,
+			signature:      sign(`{"archive": {"sha256": "abc"}}`),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"no_sha256": {
+			body:           `{"domain": "group.gitlab.io", "archive": {}}`,
+			signature:      sign(`{"domain": "group.gitlab.io", "archive": {}}`),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"too_large": {
+			body:           strings.Repeat(" ", maxBodySize+1),
+			signature:      sign(strings.Repeat(" ", maxBodySize+1)),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := NewHandler(secret, &archivesStub{}, func(context.Context, string, string) error {
+				require.FailNow(t, "the archive must not be opened")
+				return nil
+			})
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+
+			r := httptest.NewRequest(method, "/-/deployments", strings.NewReader(tt.body))
+			r.Header.Set(SignatureHeader, tt.signature)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestHandlerPrefetchesTheArchive(t *testing.T) {
+	opened := make(chan []string, 1)
+
+	s := &archivesStub{domains: make(chan string, 1)}
+
+	h := NewHandler(secret, s, func(_ context.Context, path, sha256 string) error {
+		opened <- []string{path, sha256}
+		return nil
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/-/deployments", strings.NewReader(validEvent))
+	r.Header.Set(SignatureHeader, sign(validEvent))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Equal(t, []string{"https://objects.example.com/public.zip", "abc"}, <-opened)
+	require.Equal(t, "group.gitlab.io", <-s.domains)
+}
+
+func TestHandlerIgnoresArchivesNotServedOnTheDomain(t *testing.T) {
+	tests := map[string]string{
+		"unknown_sha256": `{"domain": "group.gitlab.io", "archive": {"sha256": "other"}}`,
+		"unknown_domain": `{"domain": "other.gitlab.io", "archive": {"sha256": "abc"}}`,
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &archivesStub{domains: make(chan string)}
+
+			h := NewHandler(secret, s, func(context.Context, string, string) error {
+				require.FailNow(t, "the archive must not be opened")
+				return nil
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/-/deployments", strings.NewReader(body))
+			r.Header.Set(SignatureHeader, sign(body))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusAccepted, w.Code)
+			<-s.domains
+
+			// the slot is released once the archive is rejected
+			require.Eventually(t, func() bool { return len(h.slots) == 0 }, time.Second, time.Millisecond)
+		})
+	}
+}
+
+func TestHandlerRejectsNotificationsAboveTheConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	h := NewHandler(secret, &archivesStub{}, func(context.Context, string, string) error {
+		<-release
+		return nil
+	})
+
+	for i := 0; i <= maxConcurrent; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/-/deployments", strings.NewReader(validEvent))
+		r.Header.Set(SignatureHeader, sign(validEvent))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if i < maxConcurrent {
+			require.Equal(t, http.StatusAccepted, w.Code)
+		} else {
+			require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		}
+	}
+}
+
+func TestHandlerWithoutSecret(t *testing.T) {
+	h := NewHandler(nil, nil, nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/-/deployments", strings.NewReader(validEvent))
+	r.Header.Set(SignatureHeader, "sha256=")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -1,8 +1,10 @@
 package ratelimiter
 
 import (
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gitlab.com/gitlab-org/labkit/correlation"
@@ -17,16 +19,37 @@ const (
 	headerGitLabRealIP    = "GitLab-Real-IP"
 	headerXForwardedFor   = "X-Forwarded-For"
 	headerXForwardedProto = "X-Forwarded-Proto"
+	headerRetryAfter      = "Retry-After"
 )
 
 // Middleware returns middleware for rate-limiting clients
 func (rl *RateLimiter) Middleware(handler http.Handler) http.Handler {
-	if rl.limitPerSecond <= 0.0 {
+	if !rl.enabled() && len(rl.deniedNetworks) == 0 {
 		return handler
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if rl.requestAllowed(r) {
+		// the networks are evaluated before the token bucket
+		if sourceIPIn(r, rl.deniedNetworks) {
+			rl.countDecision(DecisionDenied)
+			httperrors.Serve403(w, r)
+			return
+		}
+
+		if !rl.enabled() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if sourceIPIn(r, rl.allowedNetworks) {
+			rl.countDecision(DecisionExempt)
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, retryAfter := rl.requestAllowed(r)
+		if allowed {
+			rl.countDecision(DecisionAllowed)
 			handler.ServeHTTP(w, r)
 			return
 		}
@@ -34,19 +57,45 @@ func (rl *RateLimiter) Middleware(handler http.Handler) http.Handler {
 		rl.logRateLimitedRequest(r)
 
 		if rl.blockedCount != nil {
-			rl.blockedCount.WithLabelValues(strconv.FormatBool(feature.EnforceIPRateLimits.Enabled())).Inc()
+			rl.blockedCount.WithLabelValues(strconv.FormatBool(rl.enforce)).Inc()
 		}
 
 		if rl.enforce {
-			httperrors.Serve429(w)
+			rl.countDecision(DecisionLimitedEnforced)
+			w.Header().Set(headerRetryAfter, strconv.Itoa(retryAfterSeconds(retryAfter)))
+			if rl.limited != nil {
+				rl.limited.ServeHTTP(w, r)
+			} else {
+				httperrors.Serve429(w, r)
+			}
 			return
 		}
 
+		rl.countDecision(DecisionLimitedDryRun)
 		handler.ServeHTTP(w, r)
 	})
 }
 
+// retryAfterSeconds rounds d up to the whole seconds of a Retry-After header,
+// so that clients do not retry before their next request is allowed
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+
+	return seconds
+}
+
+func (rl *RateLimiter) countDecision(decision string) {
+	if rl.decisions != nil {
+		rl.decisions.WithLabelValues(rl.name, decision).Inc()
+	}
+}
+
 func (rl *RateLimiter) logRateLimitedRequest(r *http.Request) {
+	limitPerSecond, burstSize := rl.limits(r)
+
 	log.WithFields(logrus.Fields{
 		"rate_limiter_name":             rl.name,
 		"correlation_id":                correlation.ExtractFromContext(r.Context()),
@@ -60,8 +109,9 @@ func (rl *RateLimiter) logRateLimitedRequest(r *http.Request) {
 		"x_forwarded_for":               r.Header.Get(headerXForwardedFor),
 		"gitlab_real_ip":                r.Header.Get(headerGitLabRealIP),
 		"rate_limiter_enabled":          feature.EnforceIPRateLimits.Enabled(),
-		"rate_limiter_limit_per_second": rl.limitPerSecond,
-		"rate_limiter_burst_size":       rl.burstSize,
+		"rate_limiter_enforced":         rl.enforce,
+		"rate_limiter_limit_per_second": limitPerSecond,
+		"rate_limiter_burst_size":       burstSize,
 	}). // TODO: change to Debug with https://gitlab.com/gitlab-org/gitlab-pages/-/issues/629
 		Info("request hit rate limit")
 }
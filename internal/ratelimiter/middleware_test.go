@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -124,6 +125,146 @@ func TestMiddlewareDenyRequestsAfterBurst(t *testing.T) {
 	}
 }
 
+func TestMiddlewareRetryAfter(t *testing.T) {
+	for _, enforce := range []bool{true, false} {
+		t.Run(strconv.FormatBool(enforce), func(t *testing.T) {
+			handler := New(
+				"rate_limiter",
+				WithNow(mockNow),
+				WithLimitPerSecond(0.1),
+				WithBurstSize(1),
+				WithEnforce(enforce),
+			).Middleware(next)
+
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				r := requestFor(remoteAddr, "http://gitlab.com")
+				r.Header.Set("Accept", "application/json")
+				handler.ServeHTTP(w, r)
+
+				if i == 0 || !enforce {
+					require.Empty(t, w.Header().Get("Retry-After"))
+					continue
+				}
+
+				require.Equal(t, http.StatusTooManyRequests, w.Code)
+				require.Equal(t, "10", w.Header().Get("Retry-After"))
+				require.Contains(t, w.Body.String(), `"retry_after":10`)
+			}
+		})
+	}
+}
+
+func TestMiddlewareNetworks(t *testing.T) {
+	_, allowed, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	_, denied, err := net.ParseCIDR("192.168.0.0/16")
+	require.NoError(t, err)
+
+	tcs := map[string]struct {
+		limit         float64
+		remoteAddr    string
+		expectedCodes []int
+		decision      string
+	}{
+		"allowed": {
+			limit:         1,
+			remoteAddr:    "10.1.2.3:40000",
+			expectedCodes: []int{http.StatusNoContent, http.StatusNoContent, http.StatusNoContent},
+			decision:      DecisionExempt,
+		},
+		"denied": {
+			limit:         1,
+			remoteAddr:    "192.168.1.1:40000",
+			expectedCodes: []int{http.StatusForbidden, http.StatusForbidden, http.StatusForbidden},
+			decision:      DecisionDenied,
+		},
+		"denied_without_limit": {
+			remoteAddr:    "192.168.1.1",
+			expectedCodes: []int{http.StatusForbidden, http.StatusForbidden, http.StatusForbidden},
+			decision:      DecisionDenied,
+		},
+		"other": {
+			limit:         1,
+			remoteAddr:    "172.16.0.1",
+			expectedCodes: []int{http.StatusNoContent, http.StatusTooManyRequests, http.StatusTooManyRequests},
+			decision:      DecisionLimitedEnforced,
+		},
+	}
+
+	for tn, tc := range tcs {
+		t.Run(tn, func(t *testing.T) {
+			decisions := prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "decisions",
+			}, []string{"limiter", "decision"})
+
+			handler := New(
+				"rate_limiter",
+				WithDecisionsMetric(decisions),
+				WithNow(mockNow),
+				WithLimitPerSecond(tc.limit),
+				WithBurstSize(1),
+				WithEnforce(true),
+				WithAllowedNetworks([]*net.IPNet{allowed}),
+				WithDeniedNetworks([]*net.IPNet{denied}),
+			).Middleware(next)
+
+			for i, expectedCode := range tc.expectedCodes {
+				code, _ := testhelpers.PerformRequest(t, handler, requestFor(tc.remoteAddr, "http://gitlab.com"))
+				require.Equal(t, expectedCode, code, "req: %d", i)
+			}
+
+			require.NotZero(t, testutil.ToFloat64(decisions.WithLabelValues("rate_limiter", tc.decision)))
+		})
+	}
+}
+
+func TestMiddlewareDecisionsMetric(t *testing.T) {
+	tcs := map[string]struct {
+		enforce          bool
+		expectedDecision string
+		expectedCode     int
+	}{
+		"dry_run": {
+			enforce:          false,
+			expectedDecision: DecisionLimitedDryRun,
+			expectedCode:     http.StatusNoContent,
+		},
+		"enforced": {
+			enforce:          true,
+			expectedDecision: DecisionLimitedEnforced,
+			expectedCode:     http.StatusTooManyRequests,
+		},
+	}
+
+	for tn, tc := range tcs {
+		t.Run(tn, func(t *testing.T) {
+			decisions := prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "decisions",
+			}, []string{"limiter", "decision"})
+
+			handler := New(
+				"rate_limiter",
+				WithDecisionsMetric(decisions),
+				WithNow(mockNow),
+				WithLimitPerSecond(1),
+				WithBurstSize(1),
+				WithEnforce(tc.enforce),
+			).Middleware(next)
+
+			for i := 0; i < 3; i++ {
+				code, _ := testhelpers.PerformRequest(t, handler, requestFor(remoteAddr, "http://gitlab.com"))
+				if i > 0 {
+					require.Equal(t, tc.expectedCode, code)
+				}
+			}
+
+			require.Equal(t, float64(1), testutil.ToFloat64(decisions.WithLabelValues("rate_limiter", DecisionAllowed)))
+			require.Equal(t, float64(2), testutil.ToFloat64(decisions.WithLabelValues("rate_limiter", tc.expectedDecision)))
+		})
+	}
+}
+
 func TestKeyFunc(t *testing.T) {
 	tt := map[string]struct {
 		keyFunc            KeyFunc
@@ -239,3 +380,26 @@ func newTestMetrics(t *testing.T) (*prometheus.GaugeVec, *prometheus.GaugeVec, *
 
 	return blockedGauge, cachedEntries, cacheReqs
 }
+
+func TestMiddlewareWithLimitedHandler(t *testing.T) {
+	limited := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	rl := New(
+		"rate_limiter",
+		WithNow(mockNow),
+		WithLimitPerSecond(1),
+		WithBurstSize(1),
+		WithEnforce(true),
+		WithLimitedHandler(limited),
+	)
+
+	handler := rl.Middleware(next)
+
+	code, _ := testhelpers.PerformRequest(t, handler, requestFor(remoteAddr, "http://gitlab.com"))
+	require.Equal(t, http.StatusNoContent, code)
+
+	code, _ = testhelpers.PerformRequest(t, handler, requestFor(remoteAddr, "http://gitlab.com"))
+	require.Equal(t, http.StatusTeapot, code, "requests above the limit are served by the limited handler")
+}
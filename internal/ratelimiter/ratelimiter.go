@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"net"
 	"net/http"
 	"time"
 
@@ -19,6 +20,21 @@ const (
 	// we have less than 4000 different hosts per minute
 	// https://log.gprd.gitlab.net/app/dashboards#/view/d52ab740-61a4-11ec-b20d-65f14d890d9b?_a=(viewMode:edit)&_g=h@42b0d52
 	DefaultDomainCacheSize = 4000
+
+	// only a fraction of the requests hit the auth endpoints
+	DefaultAuthCacheSize = 1000
+
+	// the paths with a rate limit are keyed by domain and pattern
+	DefaultPathCacheSize = 4000
+)
+
+// Decisions reported by the decisions metric
+const (
+	DecisionAllowed         = "allowed"
+	DecisionLimitedDryRun   = "limited-dry-run"
+	DecisionLimitedEnforced = "limited-enforced"
+	DecisionExempt          = "exempt"
+	DecisionDenied          = "denied"
 )
 
 // Option function to configure a RateLimiter
@@ -27,6 +43,10 @@ type Option func(*RateLimiter)
 // KeyFunc returns unique identifier for the subject of rate limit(e.g. client IP or domain)
 type KeyFunc func(*http.Request) string
 
+// LimitFunc returns the limit per second and burst size of the subject of rate
+// limit, ok is false when the defaults of the RateLimiter apply
+type LimitFunc func(*http.Request) (limitPerSecond float64, burstSize int, ok bool)
+
 // RateLimiter holds an LRU cache of elements to be rate limited.
 // It uses "golang.org/x/time/rate" as its Token Bucket rate limiter per source IP entry.
 // See example https://www.fatalerrors.org/a/design-and-implementation-of-time-rate-limiter-for-golang-standard-library.html
@@ -38,8 +58,15 @@ type RateLimiter struct {
 	limitPerSecond float64
 	burstSize      int
 	blockedCount   *prometheus.GaugeVec
+	decisions      *prometheus.CounterVec
 	cache          *lru.Cache
 	enforce        bool
+	limited        http.Handler
+
+	limitFunc LimitFunc
+
+	allowedNetworks []*net.IPNet
+	deniedNetworks  []*net.IPNet
 
 	cacheOptions []lru.Option
 }
@@ -56,7 +83,7 @@ func New(name string, opts ...Option) *RateLimiter {
 		opt(rl)
 	}
 
-	if rl.limitPerSecond > 0.0 {
+	if rl.enabled() {
 		rl.cache = lru.New(name, rl.cacheOptions...)
 	}
 
@@ -91,6 +118,21 @@ func WithBlockedCountMetric(m *prometheus.GaugeVec) Option {
 	}
 }
 
+// WithDecisionsMetric configures metric counting the allowed and limited requests
+func WithDecisionsMetric(m *prometheus.CounterVec) Option {
+	return func(rl *RateLimiter) {
+		rl.decisions = m
+	}
+}
+
+// WithLimitedHandler configures the handler serving the requests above the
+// limit when it is enforced, instead of a 429 error
+func WithLimitedHandler(handler http.Handler) Option {
+	return func(rl *RateLimiter) {
+		rl.limited = handler
+	}
+}
+
 // WithCacheMaxSize configures cache size for ratelimiter
 func WithCacheMaxSize(size int64) Option {
 	return func(rl *RateLimiter) {
@@ -120,6 +162,30 @@ func WithKeyFunc(f KeyFunc) Option {
 	}
 }
 
+// WithLimitFunc configures the limits overriding the defaults for some
+// subjects, e.g. the domains configured in GitLab
+func WithLimitFunc(f LimitFunc) Option {
+	return func(rl *RateLimiter) {
+		rl.limitFunc = f
+	}
+}
+
+// WithAllowedNetworks exempts the requests from the source IPs of networks
+// from the limit
+func WithAllowedNetworks(networks []*net.IPNet) Option {
+	return func(rl *RateLimiter) {
+		rl.allowedNetworks = networks
+	}
+}
+
+// WithDeniedNetworks rejects the requests from the source IPs of networks
+// before the limit is evaluated, even if it is not enforced
+func WithDeniedNetworks(networks []*net.IPNet) Option {
+	return func(rl *RateLimiter) {
+		rl.deniedNetworks = networks
+	}
+}
+
 // WithEnforce configures if requests are actually rejected, or we just report them as rejected in metrics
 func WithEnforce(enforce bool) Option {
 	return func(rl *RateLimiter) {
@@ -127,19 +193,78 @@ func WithEnforce(enforce bool) Option {
 	}
 }
 
-func (rl *RateLimiter) limiter(key string) *rate.Limiter {
+func (rl *RateLimiter) enabled() bool {
+	return rl.limitPerSecond > 0.0 || rl.limitFunc != nil
+}
+
+// sourceIPIn returns true if the source IP of the request belongs to one of
+// networks, whatever the key of the RateLimiter
+func sourceIPIn(r *http.Request, networks []*net.IPNet) bool {
+	if len(networks) == 0 {
+		return false
+	}
+
+	ip := net.ParseIP(request.GetRemoteAddrWithoutPort(r))
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// limits returns the limit per second and burst size applying to the request
+func (rl *RateLimiter) limits(r *http.Request) (float64, int) {
+	if rl.limitFunc != nil {
+		if limit, burst, ok := rl.limitFunc(r); ok && limit > 0.0 && burst > 0 {
+			return limit, burst
+		}
+	}
+
+	return rl.limitPerSecond, rl.burstSize
+}
+
+func (rl *RateLimiter) limiter(key string, limitPerSecond float64, burstSize int) *rate.Limiter {
 	limiterI, _ := rl.cache.FindOrFetch(key, key, func() (interface{}, error) {
-		return rate.NewLimiter(rate.Limit(rl.limitPerSecond), rl.burstSize), nil
+		return rate.NewLimiter(rate.Limit(limitPerSecond), burstSize), nil
 	})
 
 	return limiterI.(*rate.Limiter)
 }
 
-// requestAllowed checks if request is within the rate-limit
-func (rl *RateLimiter) requestAllowed(r *http.Request) bool {
+// requestAllowed checks if request is within the rate-limit, and otherwise
+// returns how long until the next request of its subject is allowed
+func (rl *RateLimiter) requestAllowed(r *http.Request) (bool, time.Duration) {
+	limitPerSecond, burstSize := rl.limits(r)
+	if limitPerSecond <= 0.0 {
+		return true, 0
+	}
+
 	rateLimitedKey := rl.keyFunc(r)
-	limiter := rl.limiter(rateLimitedKey)
+	limiter := rl.limiter(rateLimitedKey, limitPerSecond, burstSize)
+	now := rl.now()
+
+	// the limits of a subject change when GitLab updates its configuration
+	if limiter.Limit() != rate.Limit(limitPerSecond) {
+		limiter.SetLimitAt(now, rate.Limit(limitPerSecond))
+	}
+	if limiter.Burst() != burstSize {
+		limiter.SetBurstAt(now, burstSize)
+	}
 
 	// AllowN allows us to use the rl.now function, so we can test this more easily.
-	return limiter.AllowN(rl.now(), 1)
+	if limiter.AllowN(now, 1) {
+		return true, 0
+	}
+
+	// the reservation only reads the state of the bucket, the token is put back
+	reservation := limiter.ReserveN(now, 1)
+	defer reservation.CancelAt(now)
+
+	return false, reservation.DelayFrom(now)
 }
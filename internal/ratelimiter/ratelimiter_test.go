@@ -60,7 +60,7 @@ func TestRequestAllowed(t *testing.T) {
 			for i := 0; i < tc.reqNum; i++ {
 				r := requestFor("172.16.123.1", "https://domain.gitlab.io")
 
-				got := rl.requestAllowed(r)
+				got, _ := rl.requestAllowed(r)
 				if i < tc.burstSize {
 					require.Truef(t, got, "expected true for request no. %d", i)
 				} else {
@@ -87,7 +87,7 @@ func TestSingleRateLimiterWithMultipleSourceIPs(t *testing.T) {
 
 	testRequest := func(ip string, i int) {
 		r := requestFor(ip, "https://domain.gitlab.io")
-		got := rl.requestAllowed(r)
+		got, _ := rl.requestAllowed(r)
 		require.Truef(t, got, "expected true for %v request no. %d", ip, i)
 	}
 
@@ -99,6 +99,97 @@ func TestSingleRateLimiterWithMultipleSourceIPs(t *testing.T) {
 	}
 }
 
+func TestRequestAllowedWithLimitFunc(t *testing.T) {
+	limits := map[string]int{
+		"limited.gitlab.io": 1,
+		"busy.gitlab.io":    3,
+		"invalid.gitlab.io": 0,
+	}
+
+	rl := New(
+		"rate_limiter",
+		WithNow(mockNow),
+		WithKeyFunc(func(r *http.Request) string { return r.Host }),
+		WithLimitPerSecond(1),
+		WithBurstSize(2),
+		WithLimitFunc(func(r *http.Request) (float64, int, bool) {
+			burst, ok := limits[r.Host]
+			return 1, burst, ok
+		}),
+	)
+
+	allowed := func(domain string) int {
+		var count int
+		for i := 0; i < 5; i++ {
+			if allowed, _ := rl.requestAllowed(requestFor("172.16.123.1", "https://"+domain)); allowed {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	require.Equal(t, 1, allowed("limited.gitlab.io"))
+	require.Equal(t, 3, allowed("busy.gitlab.io"))
+	require.Equal(t, 2, allowed("invalid.gitlab.io"), "invalid limits fall back to the defaults")
+	require.Equal(t, 2, allowed("default.gitlab.io"))
+
+	t.Run("changed_limit", func(t *testing.T) {
+		limits["limited.gitlab.io"] = 4
+		require.Equal(t, 0, allowed("limited.gitlab.io"), "the bucket keeps its tokens")
+
+		now := validTime.Add(time.Minute)
+		rl.now = func() time.Time { return now }
+		require.Equal(t, 4, allowed("limited.gitlab.io"))
+	})
+
+	t.Run("without_default", func(t *testing.T) {
+		rl := New(
+			"rate_limiter",
+			WithNow(mockNow),
+			WithKeyFunc(func(r *http.Request) string { return r.Host }),
+			WithLimitFunc(func(r *http.Request) (float64, int, bool) {
+				return 1, 1, r.Host == "limited.gitlab.io"
+			}),
+		)
+
+		requestAllowed := func(domain string) bool {
+			allowed, _ := rl.requestAllowed(requestFor("172.16.123.1", "https://"+domain))
+			return allowed
+		}
+
+		for i := 0; i < 3; i++ {
+			require.True(t, requestAllowed("default.gitlab.io"))
+		}
+
+		require.True(t, requestAllowed("limited.gitlab.io"))
+		require.False(t, requestAllowed("limited.gitlab.io"))
+	})
+}
+
+func TestRequestAllowedRetryAfter(t *testing.T) {
+	rl := New(
+		"rate_limiter",
+		WithNow(mockNow),
+		WithLimitPerSecond(0.5),
+		WithBurstSize(2),
+	)
+
+	for i := 0; i < 2; i++ {
+		allowed, retryAfter := rl.requestAllowed(requestFor("172.16.123.1", "https://domain.gitlab.io"))
+		require.True(t, allowed)
+		require.Zero(t, retryAfter)
+	}
+
+	// the token of the next request is refilled in 2 seconds, checking it again
+	// does not consume it
+	for i := 0; i < 2; i++ {
+		allowed, retryAfter := rl.requestAllowed(requestFor("172.16.123.1", "https://domain.gitlab.io"))
+		require.False(t, allowed)
+		require.Equal(t, 2*time.Second, retryAfter)
+	}
+}
+
 func requestFor(remoteAddr, domain string) *http.Request {
 	r := httptest.NewRequest(http.MethodGet, domain, nil)
 	r.RemoteAddr = remoteAddr
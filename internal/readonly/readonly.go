@@ -0,0 +1,70 @@
+// Package readonly holds the read-only mode of the daemon. During a planned
+// maintenance of the GitLab API or of the object storage, a read-only daemon
+// keeps serving the domains and archives it has already cached, and the
+// deployments on the local disk, but does not look up or fetch anything new.
+// The mode can be switched at runtime, so that the caches warmed up before the
+// maintenance are kept.
+package readonly
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// ErrReadOnly is returned when serving a request would need a new API lookup
+// or archive fetch while the daemon is read-only
+var ErrReadOnly = errors.New("pages is in read-only mode")
+
+var enabled int32
+
+// Enabled returns whether the daemon is read-only
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Set enables or disables the read-only mode
+func Set(readOnly bool) {
+	var value int32
+	if readOnly {
+		value = 1
+	}
+
+	if atomic.SwapInt32(&enabled, value) != value {
+		log.WithField("read-only", readOnly).Info("switched the read-only mode")
+	}
+
+	metrics.ReadOnly.Set(float64(value))
+}
+
+// Toggle switches the read-only mode and returns whether it is now enabled
+func Toggle() bool {
+	for {
+		current := atomic.LoadInt32(&enabled)
+		if atomic.CompareAndSwapInt32(&enabled, current, 1-current) {
+			readOnly := current == 0
+			log.WithField("read-only", readOnly).Info("switched the read-only mode")
+			metrics.ReadOnly.Set(float64(1 - current))
+
+			return readOnly
+		}
+	}
+}
+
+// ToggleOnSignal toggles the read-only mode every time the process receives
+// sig
+func ToggleOnSignal(sig os.Signal) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig)
+
+	go func() {
+		for range signals {
+			Toggle()
+		}
+	}()
+}
@@ -0,0 +1,25 @@
+package readonly
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestSetAndToggle(t *testing.T) {
+	t.Cleanup(func() { Set(false) })
+
+	Set(true)
+	require.True(t, Enabled())
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.ReadOnly))
+
+	require.False(t, Toggle())
+	require.False(t, Enabled())
+	require.Equal(t, float64(0), testutil.ToFloat64(metrics.ReadOnly))
+
+	require.True(t, Toggle())
+	require.True(t, Enabled())
+}
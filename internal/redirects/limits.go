@@ -0,0 +1,42 @@
+package redirects
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	// defaultMaxPathSegments is the default limit of the number of path
+	// segments allowed in rules URLs
+	defaultMaxPathSegments = 25
+
+	// defaultMaxRuleCount is the default limit of the total number of rules
+	// allowed in _redirects
+	defaultMaxRuleCount = 1000
+)
+
+// the limits of the rules, accessed atomically
+var (
+	maxPathSegments int64 = defaultMaxPathSegments
+	maxRuleCount    int64 = defaultMaxRuleCount
+)
+
+// ConfigureLimits sets the maximum number of rules of a _redirects file
+// which are processed, and of path segments of their URLs. Large sites may
+// raise them at the cost of slower matching.
+func ConfigureLimits(ruleCount, pathSegments int) {
+	atomic.StoreInt64(&maxRuleCount, int64(ruleCount))
+	atomic.StoreInt64(&maxPathSegments, int64(pathSegments))
+}
+
+func ruleCountLimit() int {
+	return int(atomic.LoadInt64(&maxRuleCount))
+}
+
+func pathSegmentsLimit() int {
+	return int(atomic.LoadInt64(&maxPathSegments))
+}
+
+func errTooManyPathSegments() error {
+	return fmt.Errorf("url path cannot contain more than %d forward slashes", pathSegmentsLimit())
+}
@@ -0,0 +1,45 @@
+package redirects
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	netlifyRedirects "github.com/tj/go-redirects"
+)
+
+func TestConfigureLimits(t *testing.T) {
+	enablePlaceholders(t)
+
+	ConfigureLimits(2, 3)
+	t.Cleanup(func() { ConfigureLimits(defaultMaxRuleCount, defaultMaxPathSegments) })
+
+	require.NoError(t, validateURL("/a/b/c"))
+	require.EqualError(t, validateURL("/a/b/c/d"), "url path cannot contain more than 3 forward slashes")
+
+	rules, err := netlifyRedirects.ParseString(`
+/1.html /target1.html 301
+/2.html /target2.html 301
+/3.html /target3.html 301
+`)
+	require.NoError(t, err)
+
+	r := Redirects{rules: rules}
+
+	u, err := url.Parse("/2.html")
+	require.NoError(t, err)
+
+	toURL, status, err := r.Rewrite(u)
+	require.NoError(t, err)
+	require.Equal(t, "/target2.html", toURL.String())
+	require.Equal(t, http.StatusMovedPermanently, status)
+
+	u, err = url.Parse("/3.html")
+	require.NoError(t, err)
+
+	_, _, err = r.Rewrite(u)
+	require.ErrorIs(t, err, ErrNoRedirect)
+
+	require.Contains(t, r.Status(), "more than the maximum of 2 rules")
+}
@@ -2,6 +2,7 @@ package redirects
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 
@@ -91,17 +92,27 @@ func matchesRule(rule *netlifyRedirects.Rule, path string) (bool, string) {
 	// like `foo/:splat/bar` will result in a path like `foo//bar` if the splat
 	// character matches nothing. To avoid this, replace all instances
 	// of multiple subsequent forward slashes with a single forward slash.
+	// The slashes following the scheme of proxy rules are kept.
+	scheme := ""
+	if i := strings.Index(string(templatedToPath), "://"); i >= 0 && isProxyRule(*rule) {
+		scheme, templatedToPath = string(templatedToPath[:i+len("://")]), templatedToPath[i+len("://"):]
+	}
 	templatedToPath = regexMultipleSlashes.ReplaceAll(templatedToPath, []byte("/"))
 
-	return true, string(templatedToPath)
+	return true, scheme + string(templatedToPath)
 }
 
 // `match` returns:
 // 1. The first valid redirect or rewrite rule that matches the requested URL
 // 2. The URL to redirect/rewrite to
 //
+// Only the rules forced with `!` are matched when forcedOnly is true.
 // If no rule matches, this function returns `nil` and an empty string
-func (r *Redirects) match(path string) (*netlifyRedirects.Rule, string) {
+func (r *Redirects) match(u *url.URL, forcedOnly bool) (*netlifyRedirects.Rule, string) {
+	maxRuleCount := ruleCountLimit()
+
+	var query url.Values
+
 	for i := range r.rules {
 		if i >= maxRuleCount {
 			// do not process any more rules
@@ -112,11 +123,31 @@ func (r *Redirects) match(path string) (*netlifyRedirects.Rule, string) {
 		// G601: Implicit memory aliasing in for loop
 		rule := r.rules[i]
 
+		if forcedOnly && !rule.Force {
+			continue
+		}
+
 		if validateRule(rule) != nil {
 			continue
 		}
 
-		if isMatch, path := matchesRule(&rule, path); isMatch {
+		// the query parameters of the "from" URL must be in the request
+		from, conditions := splitQuery(rule.From)
+		if len(conditions) > 0 {
+			if query == nil {
+				query = u.Query()
+			}
+
+			placeholders, ok := matchQuery(conditions, query)
+			if !ok {
+				continue
+			}
+
+			rule.To = interpolateQuery(rule.To, placeholders)
+		}
+		rule.From = from
+
+		if isMatch, path := matchesRule(&rule, u.Path); isMatch {
 			return &rule, path
 		}
 	}
@@ -0,0 +1,75 @@
+package redirects
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	netlifyRedirects "github.com/tj/go-redirects"
+)
+
+// proxyHosts holds the map[string]bool of the upstream hosts rewrites may
+// proxy to
+var proxyHosts atomic.Value
+
+// ConfigureProxyHosts sets the upstream hosts the rules with status 200 may
+// proxy to, like Netlify's proxying rewrites to absolute URLs. No rule
+// proxies when hosts is empty.
+func ConfigureProxyHosts(hosts []string) {
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowed[strings.ToLower(host)] = true
+	}
+
+	proxyHosts.Store(allowed)
+}
+
+func proxyHostAllowed(host string) bool {
+	allowed, _ := proxyHosts.Load().(map[string]bool)
+
+	return allowed[strings.ToLower(host)]
+}
+
+// isProxyRule returns true if the rule rewrites to an absolute URL
+func isProxyRule(r netlifyRedirects.Rule) bool {
+	return r.Status == http.StatusOK && (strings.HasPrefix(r.To, "//") || strings.Contains(r.To, "://"))
+}
+
+// validateProxyURL runs validations against the URL of a proxy rule.
+// Returns `nil` if the URL is valid.
+func validateProxyURL(urlText string) error {
+	u, err := url.Parse(urlText)
+	if err != nil {
+		return errFailedToParseURL
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errNoDomainLevelRedirects
+	}
+
+	if !proxyHostAllowed(u.Hostname()) {
+		return errProxyHostNotAllowed
+	}
+
+	if err := validatePath(u.Path); err != nil {
+		return err
+	}
+
+	return validateQuery(u.RawQuery)
+}
+
+// proxyTarget returns the templated URL of a proxy rule if it still points
+// to an allowed host, placeholders can only be expanded in its path
+func proxyTarget(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if !proxyHostAllowed(u.Hostname()) {
+		return nil, errProxyHostNotAllowed
+	}
+
+	return u, nil
+}
@@ -0,0 +1,122 @@
+package redirects
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	netlifyRedirects "github.com/tj/go-redirects"
+)
+
+// allowProxyHosts allows the rules to proxy to hosts in tests
+func allowProxyHosts(t testing.TB, hosts ...string) {
+	ConfigureProxyHosts(hosts)
+	t.Cleanup(func() { ConfigureProxyHosts(nil) })
+}
+
+func TestRedirectsValidateProxyRule(t *testing.T) {
+	enablePlaceholders(t)
+	allowProxyHosts(t, "API.example.com")
+
+	tests := map[string]struct {
+		rule        string
+		expectedErr string
+	}{
+		"allowed_host": {
+			rule:        "/api/* https://api.example.com/v1/:splat 200",
+			expectedErr: "",
+		},
+		"allowed_host_without_path": {
+			rule:        "/api https://api.example.com 200",
+			expectedErr: "",
+		},
+		"host_not_allowed": {
+			rule:        "/api/* https://internal.example.com/:splat 200",
+			expectedErr: errProxyHostNotAllowed.Error(),
+		},
+		"schemaless_url": {
+			rule:        "/api/* //api.example.com/:splat 200",
+			expectedErr: errNoDomainLevelRedirects.Error(),
+		},
+		"unsupported_scheme": {
+			rule:        "/api/* ftp://api.example.com/:splat 200",
+			expectedErr: errNoDomainLevelRedirects.Error(),
+		},
+		"redirect_to_allowed_host": {
+			rule:        "/api/* https://api.example.com/:splat 301",
+			expectedErr: errNoDomainLevelRedirects.Error(),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rules, err := netlifyRedirects.ParseString(tt.rule)
+			require.NoError(t, err)
+
+			err = validateRule(rules[0])
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRedirectsRewriteProxy(t *testing.T) {
+	enablePlaceholders(t)
+
+	rules, err := netlifyRedirects.ParseString(`
+/api/*     https://api.example.com/v1/:splat    200
+/search    https://search.example.com/?q=pages  200
+/internal  https://internal.example.com/        200
+`)
+	require.NoError(t, err)
+
+	r := Redirects{rules: rules}
+
+	tests := map[string]struct {
+		allowedHosts []string
+		url          string
+		expectedURL  string
+	}{
+		"splat": {
+			allowedHosts: []string{"api.example.com"},
+			url:          "/api/projects/1",
+			expectedURL:  "https://api.example.com/v1/projects/1",
+		},
+		"query": {
+			allowedHosts: []string{"search.example.com"},
+			url:          "/search",
+			expectedURL:  "https://search.example.com/?q=pages",
+		},
+		"host_not_allowed": {
+			allowedHosts: []string{"api.example.com"},
+			url:          "/internal",
+		},
+		"proxying_disabled": {
+			url: "/api/projects/1",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			allowProxyHosts(t, tt.allowedHosts...)
+
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+
+			toURL, status, err := r.Rewrite(u)
+			if tt.expectedURL == "" {
+				require.ErrorIs(t, err, ErrNoRedirect)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, status)
+			require.Equal(t, tt.expectedURL, toURL.String())
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package redirects
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// preserveQuery is 1 when the query of requests is kept on redirects,
+// accessed atomically
+var preserveQuery int32
+
+// ConfigurePreserveQuery keeps the query of requests on the 301 and 302
+// redirects to URLs without a query
+func ConfigurePreserveQuery(preserve bool) {
+	var value int32
+	if preserve {
+		value = 1
+	}
+
+	atomic.StoreInt32(&preserveQuery, value)
+}
+
+func preservingQuery() bool {
+	return atomic.LoadInt32(&preserveQuery) == 1
+}
+
+// isQueryCondition returns true if field is a `key=value` query parameter
+// rather than the URL a rule redirects to
+func isQueryCondition(field string) bool {
+	return strings.Contains(field, "=") && !strings.HasPrefix(field, "/") && !strings.Contains(field, "://")
+}
+
+// normalizeQueryConditions moves the query parameters following the "from"
+// URL of rules, as in `/store id=:id /item/:id 301`, into its query, as in
+// `/store?id=:id /item/:id 301`. The parameters following the status are
+// conditions which are not supported.
+func normalizeQueryConditions(r io.Reader) (string, error) {
+	var sb strings.Builder
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+
+		fields := strings.Fields(line)
+		if len(fields) > 2 && !strings.HasPrefix(fields[0], "#") && isQueryCondition(fields[1]) {
+			n := 1
+			for n < len(fields)-1 && isQueryCondition(fields[n]) {
+				n++
+			}
+
+			if n < len(fields) && !isQueryCondition(fields[n]) {
+				separator := "?"
+				if strings.Contains(fields[0], "?") {
+					separator = "&"
+				}
+
+				from := fields[0] + separator + strings.Join(fields[1:n], "&")
+				line = strings.Join(append([]string{from}, fields[n:]...), " ")
+			}
+		}
+
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+
+	return sb.String(), s.Err()
+}
+
+// splitQuery returns the path of the "from" URL of a rule and the query
+// parameters requests must have to match it
+func splitQuery(from string) (string, url.Values) {
+	i := strings.Index(from, "?")
+	if i < 0 {
+		return from, nil
+	}
+
+	conditions, err := url.ParseQuery(from[i+1:])
+	if err != nil {
+		// validated with the rule
+		return from[:i], nil
+	}
+
+	return from[:i], conditions
+}
+
+// matchQuery returns the values of the `:placeholder` conditions if query
+// has all the parameters of conditions, with their value unless it is a
+// placeholder
+func matchQuery(conditions, query url.Values) (map[string]string, bool) {
+	placeholders := make(map[string]string, len(conditions))
+
+	for key, values := range conditions {
+		actual, ok := query[key]
+		if !ok || len(actual) == 0 {
+			return nil, false
+		}
+
+		expected := values[0]
+		if regexPlaceholder.MatchString(expected) {
+			placeholders[expected[1:]] = actual[0]
+			continue
+		}
+
+		if actual[0] != expected {
+			return nil, false
+		}
+	}
+
+	return placeholders, true
+}
+
+// pathValueEscaper escapes the characters of values which have a meaning in
+// the templates of paths
+var pathValueEscaper = strings.NewReplacer(":", "%3A", "$", "%24")
+
+// interpolateQuery replaces the `:placeholder` of the query conditions in
+// the "to" URL of a rule, escaping their values for the path or the query
+func interpolateQuery(to string, placeholders map[string]string) string {
+	if len(placeholders) == 0 {
+		return to
+	}
+
+	path, query := to, ""
+	if i := strings.Index(to, "?"); i >= 0 {
+		path, query = to[:i], to[i:]
+	}
+
+	path = regexPlaceholderReplacement.ReplaceAllStringFunc(path, func(placeholder string) string {
+		if value, ok := placeholders[placeholder[1:]]; ok {
+			return pathValueEscaper.Replace(url.PathEscape(value))
+		}
+
+		return placeholder
+	})
+
+	query = regexPlaceholderReplacement.ReplaceAllStringFunc(query, func(placeholder string) string {
+		if value, ok := placeholders[placeholder[1:]]; ok {
+			return url.QueryEscape(value)
+		}
+
+		return placeholder
+	})
+
+	return path + query
+}
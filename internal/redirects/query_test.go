@@ -0,0 +1,154 @@
+package redirects
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	netlifyRedirects "github.com/tj/go-redirects"
+)
+
+func TestNormalizeQueryConditions(t *testing.T) {
+	tests := map[string]string{
+		"/store id=:id  /item/:id  301":              "/store?id=:id /item/:id 301",
+		"/store id=:id tab=reviews /item/:id":        "/store?id=:id&tab=reviews /item/:id",
+		"/store?lang=en id=:id /item/:id 302":        "/store?lang=en&id=:id /item/:id 302",
+		"/api/* https://api.example.com/?a=b 200":    "/api/* https://api.example.com/?a=b 200",
+		"/goto.html /target.html 302 Country=us":     "/goto.html /target.html 302 Country=us",
+		"/store id=:id":                              "/store id=:id",
+		"# /store id=:id /item/:id":                  "# /store id=:id /item/:id",
+		"/store id=:id tab=reviews":                  "/store id=:id tab=reviews",
+		"/search q=:query /results?query=:query 301": "/search?q=:query /results?query=:query 301",
+	}
+
+	for line, expected := range tests {
+		t.Run(line, func(t *testing.T) {
+			normalized, err := normalizeQueryConditions(strings.NewReader(line))
+			require.NoError(t, err)
+			require.Equal(t, expected+"\n", normalized)
+		})
+	}
+}
+
+func TestRedirectsRewriteQuery(t *testing.T) {
+	enablePlaceholders(t)
+
+	content, err := normalizeQueryConditions(strings.NewReader(`
+/store id=:id                 /item/:id                   301
+/search q=:query              /results?query=:query       302
+/docs version=v1              /v1/docs/                   301
+/docs                         /latest/docs/               302
+/articles/:slug page=:page    /posts/:slug/page/:page/    200
+`))
+	require.NoError(t, err)
+
+	rules, err := netlifyRedirects.ParseString(content)
+	require.NoError(t, err)
+
+	r := Redirects{rules: rules}
+
+	tests := map[string]struct {
+		url            string
+		preserveQuery  bool
+		expectedURL    string
+		expectedStatus int
+	}{
+		"placeholder_in_path": {
+			url:            "/store?id=42",
+			expectedURL:    "/item/42",
+			expectedStatus: http.StatusMovedPermanently,
+		},
+		"placeholder_in_query": {
+			url:            "/search?q=gitlab+pages",
+			expectedURL:    "/results?query=gitlab+pages",
+			expectedStatus: http.StatusFound,
+		},
+		"escaped_value": {
+			url:            "/store?id=" + url.QueryEscape("a/b?c:$1"),
+			expectedURL:    "/item/a%2Fb%3Fc%3A%241",
+			expectedStatus: http.StatusMovedPermanently,
+		},
+		"escaped_query_value": {
+			url:            "/search?q=" + url.QueryEscape("a&admin=true"),
+			expectedURL:    "/results?query=a%26admin%3Dtrue",
+			expectedStatus: http.StatusFound,
+		},
+		"literal_value": {
+			url:            "/docs?version=v1",
+			expectedURL:    "/v1/docs/",
+			expectedStatus: http.StatusMovedPermanently,
+		},
+		"other_value": {
+			url:            "/docs?version=v2",
+			expectedURL:    "/latest/docs/",
+			expectedStatus: http.StatusFound,
+		},
+		"missing_parameter": {
+			url:            "/docs",
+			expectedURL:    "/latest/docs/",
+			expectedStatus: http.StatusFound,
+		},
+		"path_and_query_placeholders": {
+			url:            "/articles/pages?page=2",
+			expectedURL:    "/posts/pages/page/2/",
+			expectedStatus: http.StatusOK,
+		},
+		"query_not_preserved": {
+			url:            "/docs?version=v2&utm_source=feed",
+			expectedURL:    "/latest/docs/",
+			expectedStatus: http.StatusFound,
+		},
+		"query_preserved": {
+			url:            "/docs?version=v2&utm_source=feed",
+			preserveQuery:  true,
+			expectedURL:    "/latest/docs/?version=v2&utm_source=feed",
+			expectedStatus: http.StatusFound,
+		},
+		"query_of_rule_kept": {
+			url:            "/search?q=pages&utm_source=feed",
+			preserveQuery:  true,
+			expectedURL:    "/results?query=pages",
+			expectedStatus: http.StatusFound,
+		},
+		"query_not_preserved_on_rewrites": {
+			url:            "/articles/pages?page=2&utm_source=feed",
+			preserveQuery:  true,
+			expectedURL:    "/posts/pages/page/2/",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ConfigurePreserveQuery(tt.preserveQuery)
+			t.Cleanup(func() { ConfigurePreserveQuery(false) })
+
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+
+			toURL, status, err := r.Rewrite(u)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedURL, toURL.String())
+			require.Equal(t, tt.expectedStatus, status)
+		})
+	}
+}
+
+func TestRedirectsRewriteQueryNoMatch(t *testing.T) {
+	enablePlaceholders(t)
+
+	rules, err := netlifyRedirects.ParseString("/store?id=:id /item/:id 301")
+	require.NoError(t, err)
+
+	r := Redirects{rules: rules}
+
+	for _, rawURL := range []string{"/store", "/store?item=42", "/shop?id=42"} {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+
+		_, _, err = r.Rewrite(u)
+		require.ErrorIs(t, err, ErrNoRedirect, rawURL)
+	}
+}
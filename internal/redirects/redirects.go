@@ -6,6 +6,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
@@ -27,11 +29,9 @@ const (
 	// Check https://gitlab.com/gitlab-org/gitlab-pages/-/issues/472 before increasing this value
 	maxConfigSize = 64 * 1024
 
-	// maxPathSegments is used to limit the number of path segments allowed in rules URLs
-	maxPathSegments = 25
-
-	// maxRuleCount is used to limit the total number of rules allowed in _redirects
-	maxRuleCount = 1000
+	// maxRequestPathLength is the longest request path matched against the rules,
+	// longer paths never match to keep the matching cost bounded
+	maxRequestPathLength = 2048
 )
 
 var (
@@ -50,8 +50,7 @@ var (
 	errNoPlaceholders                  = errors.New("placeholders are not supported")
 	errNoParams                        = errors.New("params not supported")
 	errUnsupportedStatus               = errors.New("status not supported")
-	errNoForce                         = errors.New("force! not supported")
-	errTooManyPathSegments             = fmt.Errorf("url path cannot contain more than %d forward slashes", maxPathSegments)
+	errProxyHostNotAllowed             = errors.New("proxying to this host is not allowed")
 	regexpPlaceholder                  = regexp.MustCompile(`(?i)/:[a-z]+`)
 )
 
@@ -69,6 +68,8 @@ func (r *Redirects) Status() string {
 	messages := make([]string, 0, len(r.rules)+1)
 	messages = append(messages, fmt.Sprintf("%d rules", len(r.rules)))
 
+	maxRuleCount := ruleCountLimit()
+
 	for i, rule := range r.rules {
 		if i >= maxRuleCount {
 			messages = append([]string{
@@ -97,12 +98,36 @@ func (r *Redirects) Status() string {
 // Rewrite takes in a URL and uses the parsed Netlify rules to rewrite
 // the URL to the new location if it matches any rule
 func (r *Redirects) Rewrite(originalURL *url.URL) (*url.URL, int, error) {
-	rule, newPath := r.match(originalURL.Path)
+	return r.rewrite(originalURL, false)
+}
+
+// RewriteForced is like Rewrite, but only uses the rules forced with `!`,
+// which apply even when a file exists at the requested path
+func (r *Redirects) RewriteForced(originalURL *url.URL) (*url.URL, int, error) {
+	return r.rewrite(originalURL, true)
+}
+
+func (r *Redirects) rewrite(originalURL *url.URL, forcedOnly bool) (*url.URL, int, error) {
+	if len(originalURL.Path) > maxRequestPathLength {
+		return nil, 0, ErrNoRedirect
+	}
+
+	rule, newPath := r.match(originalURL, forcedOnly)
 	if rule == nil {
 		return nil, 0, ErrNoRedirect
 	}
 
-	newURL, err := url.Parse(newPath)
+	var newURL *url.URL
+	var err error
+	if isProxyRule(*rule) {
+		newURL, err = proxyTarget(newPath)
+	} else {
+		newURL, err = url.Parse(newPath)
+	}
+
+	if err == nil && newURL.RawQuery == "" && rule.Status != http.StatusOK && preservingQuery() {
+		newURL.RawQuery = originalURL.RawQuery
+	}
 
 	log.WithFields(log.Fields{
 		"url":         originalURL,
@@ -111,6 +136,7 @@ func (r *Redirects) Rewrite(originalURL *url.URL) (*url.URL, int, error) {
 		"rule.From":   rule.From,
 		"rule.To":     rule.To,
 		"rule.Status": rule.Status,
+		"rule.Force":  rule.Force,
 	}).Debug("Rewrite")
 	return newURL, rule.Status, err
 }
@@ -137,7 +163,12 @@ func ParseRedirects(ctx context.Context, root vfs.Root) *Redirects {
 	}
 	defer reader.Close()
 
-	redirectRules, err := netlifyRedirects.Parse(reader)
+	content, err := normalizeQueryConditions(io.LimitReader(reader, maxConfigSize))
+	if err != nil {
+		return &Redirects{error: errFailedToParseConfig}
+	}
+
+	redirectRules, err := netlifyRedirects.ParseString(content)
 	if err != nil {
 		return &Redirects{error: errFailedToParseConfig}
 	}
@@ -96,6 +96,14 @@ func TestRedirectsRewrite(t *testing.T) {
 			expectedStatus: http.StatusMovedPermanently,
 			expectedErr:    "",
 		},
+		{
+			name:           "does_not_match_paths_longer_than_the_limit",
+			url:            "/the-cake/" + strings.Repeat("a", maxRequestPathLength),
+			rule:           "/the-cake/* /is-a-lie 200",
+			expectedURL:    "",
+			expectedStatus: 0,
+			expectedErr:    ErrNoRedirect.Error(),
+		},
 		{
 			name:           "matches_splat_rule",
 			url:            "/the-cake/is-delicious",
@@ -154,6 +162,61 @@ func TestRedirectsRewrite(t *testing.T) {
 	}
 }
 
+func TestRedirectsRewriteForced(t *testing.T) {
+	rules, err := netlifyRedirects.ParseString(`
+/shadowed.html  /target.html  302
+/forced.html    /target.html  301!
+/shadowed.html  /forced.html  200!
+`)
+	require.NoError(t, err)
+
+	r := Redirects{rules: rules}
+
+	tests := map[string]struct {
+		url            string
+		expectedURL    string
+		expectedStatus int
+	}{
+		"forced_redirect": {
+			url:            "/forced.html",
+			expectedURL:    "/target.html",
+			expectedStatus: http.StatusMovedPermanently,
+		},
+		"forced_rewrite_after_unforced_rule": {
+			url:            "/shadowed.html",
+			expectedURL:    "/forced.html",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+
+			toURL, status, err := r.RewriteForced(u)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedURL, toURL.String())
+			require.Equal(t, tt.expectedStatus, status)
+		})
+	}
+
+	u, err := url.Parse("/other.html")
+	require.NoError(t, err)
+
+	_, _, err = r.RewriteForced(u)
+	require.ErrorIs(t, err, ErrNoRedirect)
+
+	// all the rules apply when no file exists
+	u, err = url.Parse("/shadowed.html")
+	require.NoError(t, err)
+
+	toURL, status, err := r.Rewrite(u)
+	require.NoError(t, err)
+	require.Equal(t, "/target.html", toURL.String())
+	require.Equal(t, http.StatusFound, status)
+}
+
 func TestRedirectsParseRedirects(t *testing.T) {
 	ctx := context.Background()
 
@@ -189,11 +252,15 @@ func TestRedirectsParseRedirects(t *testing.T) {
 			expectedRules: 0,
 			expectedErr:   errFileTooLarge.Error(),
 		},
-		// In future versions of `github.com/tj/go-redirects`,
-		// this may not throw a parsing error and this test could be removed
 		{
-			name:          "Parsing error is caught",
+			name:          "Query parameters following the from URL",
 			redirectsFile: "/store id=:id  /blog/:id  301",
+			expectedRules: 1,
+			expectedErr:   "",
+		},
+		{
+			name:          "Parsing error is caught",
+			redirectsFile: "/goto.html /target.html moved",
 			expectedRules: 0,
 			expectedErr:   errFailedToParseConfig.Error(),
 		},
@@ -222,7 +289,7 @@ func TestRedirectsParseRedirects(t *testing.T) {
 func TestMaxRuleCount(t *testing.T) {
 	root, tmpDir := testhelpers.TmpDir(t, "TooManyRules_tests")
 
-	err := os.WriteFile(path.Join(tmpDir, ConfigFile), []byte(strings.Repeat("/goto.html /target.html 301\n", maxRuleCount-1)+
+	err := os.WriteFile(path.Join(tmpDir, ConfigFile), []byte(strings.Repeat("/goto.html /target.html 301\n", defaultMaxRuleCount-1)+
 		"/1000.html /target1000 301\n"+
 		"/1001.html /target1001 301\n",
 	), 0600)
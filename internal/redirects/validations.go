@@ -38,21 +38,31 @@ func validateURL(urlText string) error {
 		return errNoStartingForwardSlashInURLPath
 	}
 
+	if err := validatePath(url.Path); err != nil {
+		return err
+	}
+
+	return validateQuery(url.RawQuery)
+}
+
+// validatePath runs the validations of the splats, placeholders and
+// segments against the path of a rule URL
+func validatePath(path string) error {
 	if feature.RedirectsPlaceholders.Enabled() {
 		// Limit the number of path segments a rule can contain.
 		// This prevents the matching logic from generating regular
 		// expressions that are too large/complex.
-		if strings.Count(url.Path, "/") > maxPathSegments {
-			return errTooManyPathSegments
+		if strings.Count(path, "/") > pathSegmentsLimit() {
+			return errTooManyPathSegments()
 		}
 	} else {
 		// No support for splats, https://docs.netlify.com/routing/redirects/redirect-options/#splats
-		if strings.Contains(url.Path, "*") {
+		if strings.Contains(path, "*") {
 			return errNoSplats
 		}
 
 		// No support for placeholders, https://docs.netlify.com/routing/redirects/redirect-options/#placeholders
-		if regexpPlaceholder.MatchString(url.Path) {
+		if regexpPlaceholder.MatchString(path) {
 			return errNoPlaceholders
 		}
 	}
@@ -60,6 +70,20 @@ func validateURL(urlText string) error {
 	return nil
 }
 
+// validateQuery runs validations against the query of a rule URL, whose
+// placeholders are only supported with the ones of paths
+func validateQuery(rawQuery string) error {
+	if _, err := url.ParseQuery(rawQuery); err != nil {
+		return errFailedToParseURL
+	}
+
+	if !feature.RedirectsPlaceholders.Enabled() && regexPlaceholderReplacement.MatchString(rawQuery) {
+		return errNoPlaceholders
+	}
+
+	return nil
+}
+
 // validateRule runs all validation rules on the provided rule.
 // Returns `nil` if the rule is valid
 func validateRule(r netlifyRedirects.Rule) error {
@@ -67,7 +91,11 @@ func validateRule(r netlifyRedirects.Rule) error {
 		return err
 	}
 
-	if err := validateURL(r.To); err != nil {
+	if isProxyRule(r) {
+		if err := validateProxyURL(r.To); err != nil {
+			return err
+		}
+	} else if err := validateURL(r.To); err != nil {
 		return err
 	}
 
@@ -84,10 +112,5 @@ func validateRule(r netlifyRedirects.Rule) error {
 		return errUnsupportedStatus
 	}
 
-	// No support for rules that use ! force
-	if r.Force {
-		return errNoForce
-	}
-
 	return nil
 }
@@ -37,7 +37,7 @@ func TestRedirectsValidateUrl(t *testing.T) {
 		},
 		"too_many_slashes": {
 			url:         strings.Repeat("/a", 26),
-			expectedErr: errTooManyPathSegments.Error(),
+			expectedErr: errTooManyPathSegments().Error(),
 		},
 		"placeholders": {
 			url:         "/news/:year/:month/:date/:slug",
@@ -51,6 +51,14 @@ func TestRedirectsValidateUrl(t *testing.T) {
 			url:         "/new/path/:splat",
 			expectedErr: "",
 		},
+		"query_placeholders": {
+			url:         "/store?id=:id",
+			expectedErr: "",
+		},
+		"invalid_query": {
+			url:         "/store?id=%zz",
+			expectedErr: errFailedToParseURL.Error(),
+		},
 	}
 
 	for name, tt := range tests {
@@ -82,6 +90,14 @@ func TestRedirectsValidateUrlNoPlaceholders(t *testing.T) {
 			url:         "/news/:year/:month/:date/:slug",
 			expectedErr: errNoPlaceholders.Error(),
 		},
+		"no_query_placeholders": {
+			url:         "/store?id=:id",
+			expectedErr: errNoPlaceholders.Error(),
+		},
+		"query_value": {
+			url:         "/docs?version=v1",
+			expectedErr: "",
+		},
 	}
 
 	for name, tt := range tests {
@@ -124,9 +140,9 @@ func TestRedirectsValidateRule(t *testing.T) {
 			rule:        "/goto.html /target.html 418",
 			expectedErr: errUnsupportedStatus.Error(),
 		},
-		"force_not_supported": {
+		"force": {
 			rule:        "/goto.html /target.html 302!",
-			expectedErr: errNoForce.Error(),
+			expectedErr: "",
 		},
 	}
 
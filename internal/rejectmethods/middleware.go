@@ -2,30 +2,46 @@ package rejectmethods
 
 import (
 	"net/http"
+	"strings"
 
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
 
-var acceptedMethods = map[string]bool{
-	http.MethodGet:     true,
-	http.MethodHead:    true,
-	http.MethodPost:    true,
-	http.MethodPut:     true,
-	http.MethodPatch:   true,
-	http.MethodDelete:  true,
-	http.MethodConnect: true,
-	http.MethodOptions: true,
-	http.MethodTrace:   true,
+// DefaultAllowedMethods are the methods needed to serve content, including
+// the CORS preflight requests
+var DefaultAllowedMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
 }
 
-// NewMiddleware returns middleware which rejects all unknown http methods
-func NewMiddleware(handler http.Handler) http.Handler {
+// NewMiddleware returns middleware which rejects the requests whose method is
+// not in methods, DefaultAllowedMethods when empty, with 405 Method Not Allowed
+func NewMiddleware(handler http.Handler, methods []string) http.Handler {
+	if len(methods) == 0 {
+		methods = DefaultAllowedMethods
+	}
+
+	allowedMethods := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		allowedMethods[method] = true
+	}
+	allow := strings.Join(methods, ", ")
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if acceptedMethods[r.Method] {
+		if allowedMethods[r.Method] {
 			handler.ServeHTTP(w, r)
-		} else {
-			metrics.RejectedRequestsCount.Inc()
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		metrics.RejectedRequestsCount.Inc()
+
+		// the body is not read to reuse the connection
+		if r.ContentLength != 0 {
+			w.Header().Set("Connection", "close")
 		}
+
+		w.Header().Set("Allow", allow)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 	})
 }
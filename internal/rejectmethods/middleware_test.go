@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -14,32 +15,53 @@ func TestNewMiddleware(t *testing.T) {
 		io.WriteString(w, "OK\n")
 	})
 
-	middleware := NewMiddleware(handler)
+	tests := map[string]struct {
+		methods         []string
+		acceptedMethods []string
+		rejectedMethods []string
+		expectedAllow   string
+	}{
+		"default_methods": {
+			acceptedMethods: []string{"GET", "HEAD", "OPTIONS"},
+			rejectedMethods: []string{"POST", "PUT", "PATCH", "DELETE", "CONNECT", "TRACE", "UNKNOWN"},
+			expectedAllow:   "GET, HEAD, OPTIONS",
+		},
+		"configured_methods": {
+			methods:         []string{"GET", "HEAD", "POST"},
+			acceptedMethods: []string{"GET", "HEAD", "POST"},
+			rejectedMethods: []string{"OPTIONS", "PUT", "UNKNOWN"},
+			expectedAllow:   "GET, HEAD, POST",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			middleware := NewMiddleware(handler, tt.methods)
 
-	acceptedMethods := []string{"GET", "HEAD", "POST", "PUT", "PATCH", "CONNECT", "OPTIONS", "TRACE"}
-	for _, method := range acceptedMethods {
-		t.Run(method, func(t *testing.T) {
-			tmpRequest, _ := http.NewRequest(method, "/", nil)
-			recorder := httptest.NewRecorder()
+			for _, method := range tt.acceptedMethods {
+				recorder := httptest.NewRecorder()
+				middleware.ServeHTTP(recorder, httptest.NewRequest(method, "/", nil))
 
-			middleware.ServeHTTP(recorder, tmpRequest)
+				require.Equal(t, http.StatusOK, recorder.Code, method)
+			}
 
-			result := recorder.Result()
-			defer result.Body.Close()
+			for _, method := range tt.rejectedMethods {
+				recorder := httptest.NewRecorder()
+				middleware.ServeHTTP(recorder, httptest.NewRequest(method, "/", nil))
 
-			require.Equal(t, http.StatusOK, result.StatusCode)
+				require.Equal(t, http.StatusMethodNotAllowed, recorder.Code, method)
+				require.Equal(t, tt.expectedAllow, recorder.Header().Get("Allow"), method)
+			}
 		})
 	}
+}
 
-	t.Run("UNKNOWN", func(t *testing.T) {
-		tmpRequest, _ := http.NewRequest("UNKNOWN", "/", nil)
-		recorder := httptest.NewRecorder()
-
-		middleware.ServeHTTP(recorder, tmpRequest)
+func TestNewMiddlewareClosesConnectionWithBody(t *testing.T) {
+	middleware := NewMiddleware(http.NotFoundHandler(), nil)
 
-		result := recorder.Result()
-		defer result.Body.Close()
+	recorder := httptest.NewRecorder()
+	middleware.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("data")))
 
-		require.Equal(t, http.StatusMethodNotAllowed, result.StatusCode)
-	})
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	require.Equal(t, "close", recorder.Header().Get("Connection"))
 }
@@ -0,0 +1,26 @@
+package requestid
+
+import (
+	"net/http"
+
+	"gitlab.com/gitlab-org/labkit/correlation"
+)
+
+// NewMiddleware returns middleware which echoes the correlation ID of the
+// request in the header response header, so users can report an ID that
+// can be found in the logs. It must be wrapped by the correlation ID
+// injection. An empty header disables the middleware.
+func NewMiddleware(handler http.Handler, header string) http.Handler {
+	if header == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// set before serving the request so error responses carry it too
+		if correlationID := correlation.ExtractFromContext(r.Context()); correlationID != "" {
+			w.Header().Set(header, correlationID)
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,58 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/labkit/correlation"
+)
+
+func TestNewMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		header         string
+		correlationID  string
+		expectedHeader string
+	}{
+		"default_header": {
+			header:         "X-Request-Id",
+			correlationID:  "01FHKV0JZ1F4SW8NA2TQMPQ7ES",
+			expectedHeader: "X-Request-Id",
+		},
+		"custom_header": {
+			header:         "X-Pages-Request-Id",
+			correlationID:  "01FHKV0JZ1F4SW8NA2TQMPQ7ES",
+			expectedHeader: "X-Pages-Request-Id",
+		},
+		"disabled": {
+			correlationID: "01FHKV0JZ1F4SW8NA2TQMPQ7ES",
+		},
+		"no_correlation_id": {
+			header: "X-Request-Id",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := NewMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "not found", http.StatusNotFound)
+			}), tt.header)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(correlation.ContextWithCorrelation(r.Context(), tt.correlationID))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusNotFound, w.Code)
+
+			if tt.expectedHeader == "" {
+				require.Empty(t, w.Header().Get("X-Request-Id"))
+				return
+			}
+
+			require.Equal(t, tt.correlationID, w.Header().Get(tt.expectedHeader))
+		})
+	}
+}
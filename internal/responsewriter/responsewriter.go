@@ -0,0 +1,76 @@
+// Package responsewriter holds what the http.ResponseWriter wrappers of the
+// middlewares share, so that the streamed responses and the connection
+// upgrades of proxied requests, such as websockets, go through any of them.
+package responsewriter
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ErrHijackNotSupported is returned by Hijack when the wrapped writer does not
+// support hijacking
+var ErrHijackNotSupported = errors.New("the response writer does not support hijacking")
+
+// Wrapper passes the optional interfaces of the wrapped http.ResponseWriter
+// through. The wrappers embed it, and override the methods whose behavior
+// they change.
+type Wrapper struct {
+	http.ResponseWriter
+}
+
+// Flush flushes the wrapped writer, when it supports it
+func (w Wrapper) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hijacks the connection of the wrapped writer
+func (w Wrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, ErrHijackNotSupported
+	}
+
+	return hijacker.Hijack()
+}
+
+// StatusWriter records the status of the response
+type StatusWriter struct {
+	Wrapper
+	status int
+}
+
+// NewStatusWriter returns a StatusWriter wrapping w
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{Wrapper: Wrapper{ResponseWriter: w}}
+}
+
+func (sw *StatusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *StatusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+
+	return sw.ResponseWriter.Write(b)
+}
+
+// Status returns the status of the response, 200 when the handler wrote
+// nothing
+func (sw *StatusWriter) Status() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+
+	return sw.status
+}
@@ -0,0 +1,55 @@
+package responsewriter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapper(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	w := Wrapper{ResponseWriter: recorder}
+
+	w.Flush()
+	require.True(t, recorder.Flushed)
+
+	_, _, err := w.Hijack()
+	require.ErrorIs(t, err, ErrHijackNotSupported)
+}
+
+func TestStatusWriter(t *testing.T) {
+	tests := map[string]struct {
+		handler        http.HandlerFunc
+		expectedStatus int
+	}{
+		"nothing_written": {
+			handler:        func(w http.ResponseWriter, r *http.Request) {},
+			expectedStatus: http.StatusOK,
+		},
+		"body_written": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		"status_written": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+				w.WriteHeader(http.StatusOK)
+			},
+			expectedStatus: http.StatusBadGateway,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			sw := NewStatusWriter(httptest.NewRecorder())
+			tt.handler(sw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			require.Equal(t, tt.expectedStatus, sw.Status())
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/readonly"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source"
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
@@ -19,14 +20,30 @@ func NewMiddleware(handler http.Handler, s source.Source) http.Handler {
 		// if we could not retrieve a domain from domains source we break the
 		// middleware chain and simply respond with 502 after logging this
 		host, d, err := getHostAndDomain(r, s)
+		if errors.Is(err, readonly.ErrReadOnly) {
+			logging.LogRequest(r).WithError(err).Info("the domain is not cached")
+
+			httperrors.Serve503(w, r)
+			return
+		}
+
+		if httperrors.IsClientAborted(r, err) {
+			httperrors.ServeClientAborted(w, r, "source", err)
+			return
+		}
+
 		if err != nil && !errors.Is(err, domain.ErrDomainDoesNotExist) {
 			metrics.DomainsSourceFailures.Inc()
 			logging.LogRequest(r).WithError(err).Error("could not fetch domain information from a source")
 
-			httperrors.Serve502(w)
+			httperrors.Serve502(w, r)
 			return
 		}
 
+		if d != nil && d.Deprecated {
+			w.Header().Set(domain.DeprecatedHeader, "true")
+		}
+
 		r = domain.ReqWithHostAndDomain(r, host, d)
 
 		handler.ServeHTTP(w, r)
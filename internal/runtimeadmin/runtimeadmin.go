@@ -0,0 +1,171 @@
+// Package runtimeadmin changes the log level, the access logs and the feature
+// flags read on every request while the daemon runs, so that they are changed
+// without a restart dropping the domain and zip archive caches.
+//
+// The changes are authorized by a JWT signed with the secret shared with
+// GitLab, and last until the daemon restarts.
+package runtimeadmin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/feature"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/jwtauth"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	// Path of the runtime settings
+	Path = "/-/runtime"
+
+	audience = "gitlab-pages-runtime-admin"
+
+	// maxLifetime bounds the lifetime of the tokens, they are minted for a
+	// single change
+	maxLifetime = 5 * time.Minute
+
+	// maxBodySize bounds the size of the changes
+	maxBodySize = 64 << 10
+)
+
+// State of the runtime settings
+type State struct {
+	LogLevel  string `json:"log_level"`
+	AccessLog bool   `json:"access_log"`
+	// Features are the states of the feature flags, by environment variable
+	Features map[string]bool `json:"features"`
+}
+
+// Change of the runtime settings, the settings left out are kept. A feature
+// flag set to null is read from its environment variable again.
+type Change struct {
+	LogLevel  *string          `json:"log_level,omitempty"`
+	AccessLog *bool            `json:"access_log,omitempty"`
+	Features  map[string]*bool `json:"features,omitempty"`
+}
+
+// Handler serves the runtime settings
+type Handler struct {
+	verifier *jwtauth.Verifier
+}
+
+// NewHandler returns a Handler for the requests authorized by a token signed
+// with secret
+func NewHandler(secret []byte) *Handler {
+	return &Handler{
+		verifier: jwtauth.NewVerifier(secret, audience, maxLifetime),
+	}
+}
+
+// ServeHTTP responds to `GET /-/runtime` with the State, and applies the
+// Change of a `PATCH /-/runtime` before responding with the new State
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch {
+		w.Header().Set("Allow", "GET, PATCH")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.authorize(r); err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gitlab-pages"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodPatch {
+		var change Change
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&change); err != nil {
+			http.Error(w, fmt.Sprintf("invalid change: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := apply(&change); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	json.NewEncoder(w).Encode(current())
+}
+
+// apply validates the whole change before applying it, so that an invalid
+// change applies nothing
+func apply(change *Change) error {
+	features := make(map[feature.Feature]*bool, len(change.Features))
+	for name, enabled := range change.Features {
+		f, ok := feature.Find(name)
+		if !ok {
+			return fmt.Errorf("unknown feature flag %q", name)
+		}
+
+		if !f.Runtime() {
+			return fmt.Errorf("%s: %w", name, feature.ErrNotRuntime)
+		}
+
+		features[f] = enabled
+	}
+
+	if change.LogLevel != nil {
+		if _, err := logrus.ParseLevel(*change.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	fields := log.Fields{}
+
+	if change.LogLevel != nil {
+		logging.SetLevel(*change.LogLevel) // nolint:errcheck // the level was parsed above
+		fields["log_level"] = *change.LogLevel
+	}
+
+	if change.AccessLog != nil {
+		logging.SetAccessLog(*change.AccessLog)
+		fields["access_log"] = *change.AccessLog
+	}
+
+	for f, enabled := range features {
+		if enabled == nil {
+			f.Reset()
+		} else {
+			f.Set(*enabled) // nolint:errcheck // only the runtime feature flags are left
+		}
+
+		fields[f.EnvVariable] = f.Enabled()
+	}
+
+	feature.ExportMetrics(metrics.FeatureFlag)
+	log.WithFields(fields).Info("changed the runtime settings")
+
+	return nil
+}
+
+func current() *State {
+	state := &State{
+		LogLevel:  logging.Level(),
+		AccessLog: logging.AccessLogEnabled(),
+		Features:  map[string]bool{},
+	}
+
+	for _, f := range feature.All() {
+		state.Features[f.EnvVariable] = f.Enabled()
+	}
+
+	return state
+}
+
+// authorize verifies that the token of the request grants the runtime admin
+func (h *Handler) authorize(r *http.Request) error {
+	return h.verifier.Verify(jwtauth.BearerToken(r), &jwt.RegisteredClaims{})
+}
@@ -0,0 +1,171 @@
+package runtimeadmin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/feature"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+)
+
+var secret = []byte("secret")
+
+func mint(t *testing.T, key []byte, aud string, expiresIn time.Duration) string {
+	t.Helper()
+
+	claims := jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{aud},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	require.NoError(t, err)
+
+	return token
+}
+
+func reset() {
+	logrus.SetLevel(logrus.InfoLevel)
+	logging.SetAccessLog(true)
+	feature.RedirectsPlaceholders.Reset()
+}
+
+func TestHandler(t *testing.T) {
+	tests := map[string]struct {
+		method         string
+		body           string
+		token          string
+		expectedStatus int
+		expectedState  State
+	}{
+		"get": {
+			method:         http.MethodGet,
+			token:          mint(t, secret, audience, time.Minute),
+			expectedStatus: http.StatusOK,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+		"patch": {
+			method:         http.MethodPatch,
+			body:           `{"log_level":"debug","access_log":false,"features":{"FF_ENABLE_PLACEHOLDERS":true}}`,
+			token:          mint(t, secret, audience, time.Minute),
+			expectedStatus: http.StatusOK,
+			expectedState:  State{LogLevel: "debug", AccessLog: false, Features: map[string]bool{"FF_ENABLE_PLACEHOLDERS": true}},
+		},
+		"patch_partial": {
+			method:         http.MethodPatch,
+			body:           `{"access_log":false}`,
+			token:          mint(t, secret, audience, time.Minute),
+			expectedStatus: http.StatusOK,
+			expectedState:  State{LogLevel: "info", AccessLog: false},
+		},
+		"invalid_level": {
+			method:         http.MethodPatch,
+			body:           `{"log_level":"verbose","access_log":false}`,
+			token:          mint(t, secret, audience, time.Minute),
+			expectedStatus: http.StatusBadRequest,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+		"invalid_level_with_features": {
+			method:         http.MethodPatch,
+			body:           `{"access_log":false,"features":{"FF_ENABLE_PLACEHOLDERS":true},"log_level":"verbose"}`,
+			token:          mint(t, secret, audience, time.Minute),
+			expectedStatus: http.StatusBadRequest,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+		"unknown_feature": {
+			method:         http.MethodPatch,
+			body:           `{"log_level":"debug","features":{"FF_UNKNOWN":true}}`,
+			token:          mint(t, secret, audience, time.Minute),
+			expectedStatus: http.StatusBadRequest,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+		"start_feature": {
+			method:         http.MethodPatch,
+			body:           `{"log_level":"debug","features":{"FF_ENFORCE_IP_RATE_LIMITS":true}}`,
+			token:          mint(t, secret, audience, time.Minute),
+			expectedStatus: http.StatusBadRequest,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+		"invalid_body": {
+			method:         http.MethodPatch,
+			body:           `{"log_level":`,
+			token:          mint(t, secret, audience, time.Minute),
+			expectedStatus: http.StatusBadRequest,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+		"post": {
+			method:         http.MethodPost,
+			body:           `{"access_log":false}`,
+			token:          mint(t, secret, audience, time.Minute),
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+		"no_token": {
+			method:         http.MethodPatch,
+			body:           `{"access_log":false}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+		"other_audience": {
+			method:         http.MethodPatch,
+			body:           `{"access_log":false}`,
+			token:          mint(t, secret, "gitlab-pages-cache-admin", time.Minute),
+			expectedStatus: http.StatusUnauthorized,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+		"long_lived": {
+			method:         http.MethodPatch,
+			body:           `{"access_log":false}`,
+			token:          mint(t, secret, audience, time.Hour),
+			expectedStatus: http.StatusUnauthorized,
+			expectedState:  State{LogLevel: "info", AccessLog: true},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reset()
+			defer reset()
+
+			req := httptest.NewRequest(tt.method, Path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			NewHandler(secret).ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+
+			state := current()
+			require.Equal(t, tt.expectedState.LogLevel, state.LogLevel)
+			require.Equal(t, tt.expectedState.AccessLog, state.AccessLog)
+			require.Equal(t, tt.expectedState.Features["FF_ENABLE_PLACEHOLDERS"], state.Features["FF_ENABLE_PLACEHOLDERS"])
+
+			if w.Code == http.StatusOK {
+				var body State
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+				require.Equal(t, state, &body)
+			}
+		})
+	}
+}
+
+func TestResetFeature(t *testing.T) {
+	defer reset()
+
+	enabled := true
+	require.NoError(t, apply(&Change{Features: map[string]*bool{"FF_ENABLE_PLACEHOLDERS": &enabled}}))
+	require.True(t, feature.RedirectsPlaceholders.Enabled())
+
+	require.NoError(t, apply(&Change{Features: map[string]*bool{"FF_ENABLE_PLACEHOLDERS": nil}}))
+	require.False(t, feature.RedirectsPlaceholders.Enabled(), "the flag is read from its environment variable again")
+}
@@ -0,0 +1,113 @@
+package disk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/lru"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+var errAssetChanged = errors.New("asset content changed within the same deployment")
+
+// assetCache keeps the content of small static assets in memory. Projects
+// often deploy identical files, such as framework bundles and fonts, so the
+// content is stored once per SHA-256 digest and shared by every deployment
+// serving it. The paths of a deployment only point to a digest, they are
+// cached per deployment SHA like the documents of the documentCache.
+// A nil *assetCache is valid and never caches anything.
+type assetCache struct {
+	paths       *lru.Cache
+	contents    *lru.Cache
+	maxFileSize int64
+}
+
+type assetRef struct {
+	digest  string
+	modTime time.Time
+}
+
+func newAssetCache(cfg *config.AssetCache) *assetCache {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+
+	newCache := func(op string) *lru.Cache {
+		return lru.New(op,
+			lru.WithExpirationInterval(cfg.TTL),
+			lru.WithMaxSize(cfg.Size),
+			lru.WithCachedEntriesMetric(metrics.AssetCachedEntries),
+			lru.WithCachedRequestsMetric(metrics.AssetCacheRequests),
+		)
+	}
+
+	return &assetCache{
+		paths:       newCache("asset_paths"),
+		contents:    newCache("asset_contents"),
+		maxFileSize: cfg.MaxFileSize,
+	}
+}
+
+// cacheable reports whether the asset can be served from the cache.
+// Assets without a SHA cannot be invalidated and are never cached.
+func (c *assetCache) cacheable(sha string, fi os.FileInfo) bool {
+	return c != nil && sha != "" && fi.Size() <= c.maxFileSize
+}
+
+func (c *assetCache) get(ctx context.Context, root vfs.Root, sha, fullPath string, fi os.FileInfo) (*document, error) {
+	// content read while resolving the digest, it is dropped in favor of
+	// the shared copy when another deployment already cached it
+	var fetched []byte
+
+	value, err := c.paths.FindOrFetch(sha+":", fullPath, func() (interface{}, error) {
+		content, err := readContent(ctx, root, fullPath, fi)
+		if err != nil {
+			return nil, err
+		}
+
+		fetched = content
+
+		return &assetRef{digest: digest(content), modTime: fi.ModTime()}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ref := value.(*assetRef)
+
+	content, err := c.contents.FindOrFetch("", ref.digest, func() (interface{}, error) {
+		if fetched != nil {
+			return fetched, nil
+		}
+
+		// the content expired before the path, it must not be shared under
+		// the digest unless it still matches
+		content, err := readContent(ctx, root, fullPath, fi)
+		if err != nil {
+			return nil, err
+		}
+
+		if digest(content) != ref.digest {
+			return nil, errAssetChanged
+		}
+
+		return content, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &document{content: content.([]byte), modTime: ref.modTime}, nil
+}
+
+func digest(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,75 @@
+package disk
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func newAssetsReader(t *testing.T) *Reader {
+	t.Helper()
+
+	reader := &Reader{fileSizeMetric: metrics.DiskServingFileSize, vfs: namedVFS{}}
+	reader.setAssetCache(newAssetCache(&config.AssetCache{
+		TTL:         time.Minute,
+		Size:        100,
+		MaxFileSize: 16,
+	}))
+
+	return reader
+}
+
+func TestServeFileCachesAssets(t *testing.T) {
+	reader := newAssetsReader(t)
+	root := newCountingRoot(t, map[string]string{"main.css": "body {}"})
+
+	for i := 0; i < 3; i++ {
+		w := serveFromRoot(t, reader, root, "main.css", "sha1")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "body {}", w.Body.String())
+		require.Equal(t, "text/css; charset=utf-8", w.Header().Get("Content-Type"))
+	}
+	require.Equal(t, 1, root.opens)
+
+	// large assets are always read from storage
+	require.NoError(t, os.WriteFile(filepath.Join(root.dir, "large.js"), make([]byte, 17), 0644))
+
+	serveFromRoot(t, reader, root, "large.js", "sha1")
+	serveFromRoot(t, reader, root, "large.js", "sha1")
+	require.Equal(t, 3, root.opens)
+}
+
+func TestAssetCacheSharesIdenticalContent(t *testing.T) {
+	assets := newAssetCache(&config.AssetCache{TTL: time.Minute, Size: 100, MaxFileSize: 16})
+
+	first := newCountingRoot(t, map[string]string{"vendor.js": "shared bundle"})
+	second := newCountingRoot(t, map[string]string{"bundle.js": "shared bundle"})
+	other := newCountingRoot(t, map[string]string{"vendor.js": "other bundle!"})
+
+	get := func(root *countingRoot, sha, path string) []byte {
+		fi, err := root.Lstat(context.Background(), path)
+		require.NoError(t, err)
+
+		asset, err := assets.get(context.Background(), root, sha, path, fi)
+		require.NoError(t, err)
+
+		return asset.content
+	}
+
+	firstContent := get(first, "sha1", "vendor.js")
+	secondContent := get(second, "sha2", "bundle.js")
+	otherContent := get(other, "sha3", "vendor.js")
+
+	require.Equal(t, "shared bundle", string(secondContent))
+	require.Same(t, &firstContent[0], &secondContent[0], "identical assets must share their content")
+	require.Equal(t, "other bundle!", string(otherContent))
+	require.NotSame(t, &firstContent[0], &otherContent[0])
+}
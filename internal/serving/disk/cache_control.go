@@ -0,0 +1,95 @@
+package disk
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+)
+
+// defaultCacheControl is the policy of the readers without a configured one
+const defaultCacheControl = "max-age=600"
+
+// cacheControlPolicy picks the Cache-Control of the files of the projects
+// without access control by their media type
+type cacheControlPolicy struct {
+	defaultPolicy string
+	types         map[string]string
+}
+
+// newCacheControlPolicy returns the policy of cfg, whose types must be
+// valid
+func newCacheControlPolicy(cfg *config.CacheControl) *cacheControlPolicy {
+	types, err := cfg.TypePolicies()
+	if err != nil {
+		// validated with the config
+		types = nil
+	}
+
+	return &cacheControlPolicy{
+		defaultPolicy: cfg.Default,
+		types:         types,
+	}
+}
+
+// policy returns the Cache-Control of the files of contentType, from the
+// most specific of its media type, its `type/*` and the default policy
+func (p *cacheControlPolicy) policy(contentType string) string {
+	if p == nil {
+		return defaultCacheControl
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return p.defaultPolicy
+	}
+
+	if policy, ok := p.types[mediaType]; ok {
+		return policy
+	}
+
+	if i := strings.Index(mediaType, "/"); i > 0 {
+		if policy, ok := p.types[mediaType[:i]+"/*"]; ok {
+			return policy
+		}
+	}
+
+	return p.defaultPolicy
+}
+
+// setHeaders sets the Cache-Control of the files of contentType, and their
+// Expires when the policy has a max-age
+func (p *cacheControlPolicy) setHeaders(header http.Header, contentType string) {
+	policy := p.policy(contentType)
+	if policy == "" {
+		return
+	}
+
+	header.Set("Cache-Control", policy)
+
+	if maxAge, ok := maxAge(policy); ok {
+		header.Set("Expires", time.Now().Add(maxAge).Format(time.RFC1123))
+	}
+}
+
+// maxAge returns the max-age directive of policy
+func maxAge(policy string) (time.Duration, bool) {
+	for _, directive := range strings.Split(policy, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(strings.Trim(directive[len("max-age="):], `"`), 10, 64)
+		if err != nil || seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,89 @@
+package disk
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+)
+
+func TestCacheControlPolicy(t *testing.T) {
+	p := newCacheControlPolicy(&config.CacheControl{
+		Default: "public, max-age=300",
+		Types: []string{
+			"text/html=no-cache",
+			"image/*=public, max-age=86400",
+			"image/svg+xml=public, max-age=60",
+			"application/json=",
+		},
+	})
+
+	tests := map[string]string{
+		"text/html; charset=utf-8": "no-cache",
+		"image/png":                "public, max-age=86400",
+		"image/svg+xml":            "public, max-age=60",
+		"application/json":         "",
+		"application/javascript":   "public, max-age=300",
+		"invalid":                  "public, max-age=300",
+	}
+
+	for contentType, expected := range tests {
+		t.Run(contentType, func(t *testing.T) {
+			require.Equal(t, expected, p.policy(contentType))
+		})
+	}
+
+	var unconfigured *cacheControlPolicy
+	require.Equal(t, defaultCacheControl, unconfigured.policy("text/html"))
+}
+
+func TestCacheControlPolicySetHeaders(t *testing.T) {
+	p := newCacheControlPolicy(&config.CacheControl{
+		Default: "public, max-age=3600",
+		Types:   []string{"text/html=no-cache", "application/json="},
+	})
+
+	header := http.Header{}
+	p.setHeaders(header, "image/png")
+	require.Equal(t, "public, max-age=3600", header.Get("Cache-Control"))
+
+	expires, err := time.Parse(time.RFC1123, header.Get("Expires"))
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Hour), expires, 2*time.Second)
+
+	header = http.Header{}
+	p.setHeaders(header, "text/html")
+	require.Equal(t, "no-cache", header.Get("Cache-Control"))
+	require.Empty(t, header.Get("Expires"), "no max-age")
+
+	header = http.Header{}
+	p.setHeaders(header, "application/json")
+	require.Empty(t, header)
+}
+
+func TestServeFileCacheControl(t *testing.T) {
+	s := newManifestDisk(t, config.AssetManifestRewrite)
+	s.reader.setCacheControlPolicy(newCacheControlPolicy(&config.CacheControl{
+		Default: "public, max-age=60",
+		Types:   []string{"text/html=no-cache"},
+	}))
+
+	w := serveManifestPath(t, s, "index.html", false)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	w = serveManifestPath(t, s, "main.js", false)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+
+	// the fingerprinted assets are immutable whatever the policy
+	w = serveManifestPath(t, s, "main.3f2a1b.js", false)
+	require.Equal(t, "public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+	// the files of projects with access control are never cached
+	w = serveManifestPath(t, s, "index.html", true)
+	require.Empty(t, w.Header().Get("Cache-Control"))
+}
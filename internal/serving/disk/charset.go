@@ -0,0 +1,203 @@
+package disk
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+)
+
+// charsetHeadSize is the size of the start of the files read to detect their
+// charset, HTML documents declare it in their first 1024 bytes
+const charsetHeadSize = 1024
+
+// legacyCharset is the charset of the files which are not valid UTF-8, the
+// default of browsers for legacy content
+const legacyCharset = "windows-1252"
+
+var byteOrderMarks = []struct {
+	bom  []byte
+	name string
+}{
+	{bom: []byte{0xef, 0xbb, 0xbf}, name: "utf-8"},
+	{bom: []byte{0xfe, 0xff}, name: "utf-16be"},
+	{bom: []byte{0xff, 0xfe}, name: "utf-16le"},
+}
+
+// charsetDetector picks the charset stated in the Content-Type of the
+// text/html and text/plain files, which otherwise is the charset of the
+// extension in the MIME database, if any
+type charsetDetector struct {
+	fallback string
+	sniff    bool
+}
+
+func newCharsetDetector(cfg *config.Charset) *charsetDetector {
+	fallback := cfg.Default
+	if _, name := charset.Lookup(fallback); name != "" {
+		fallback = name
+	}
+
+	return &charsetDetector{
+		fallback: fallback,
+		sniff:    cfg.Sniff,
+	}
+}
+
+// sniffs returns whether the charset of the files of contentType is
+// detected from their content
+func (d *charsetDetector) sniffs(contentType string) bool {
+	return d != nil && d.sniff && isText(contentType)
+}
+
+// contentType states the charset of the file starting with head in
+// contentType, head is only read when sniffing
+func (d *charsetDetector) contentType(contentType string, head []byte) string {
+	if d == nil || !isText(contentType) {
+		return contentType
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+
+	name := d.fallback
+	if d.sniff {
+		name = d.detect(mediaType, head)
+	}
+
+	if name == "" {
+		delete(params, "charset")
+	} else {
+		params["charset"] = name
+	}
+
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// detect returns the charset of a byte order mark, or the charset declared by
+// an HTML document. Otherwise files which are not valid UTF-8 are in a legacy
+// charset, and the others in UTF-8 unless they are only ASCII.
+func (d *charsetDetector) detect(mediaType string, head []byte) string {
+	for _, mark := range byteOrderMarks {
+		if bytes.HasPrefix(head, mark.bom) {
+			return mark.name
+		}
+	}
+
+	if mediaType == "text/html" {
+		if name := declaredCharset(head); name != "" {
+			return name
+		}
+	}
+
+	if len(head) == charsetHeadSize {
+		head = trimPartialRune(head)
+	}
+
+	switch {
+	case !utf8.Valid(head):
+		if d.fallback == "" || d.fallback == "utf-8" {
+			return legacyCharset
+		}
+
+		return d.fallback
+	case isASCII(head):
+		return d.fallback
+	default:
+		return "utf-8"
+	}
+}
+
+// declaredCharset returns the charset declared by a meta element at the start
+// of an HTML document
+func declaredCharset(head []byte) string {
+	z := html.NewTokenizer(bytes.NewReader(head))
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "meta":
+				if label := metaCharset(z, hasAttr); label != "" {
+					if _, name := charset.Lookup(label); name != "" {
+						return name
+					}
+				}
+			case "body":
+				return ""
+			}
+		}
+	}
+}
+
+// metaCharset returns the charset of a `<meta charset>` or of a
+// `<meta http-equiv="content-type">` element
+func metaCharset(z *html.Tokenizer, hasAttr bool) string {
+	var label, content string
+	var contentType bool
+
+	for hasAttr {
+		var key, value []byte
+		key, value, hasAttr = z.TagAttr()
+
+		switch string(key) {
+		case "charset":
+			label = string(value)
+		case "http-equiv":
+			contentType = strings.EqualFold(string(value), "content-type")
+		case "content":
+			content = string(value)
+		}
+	}
+
+	if label != "" {
+		return strings.TrimSpace(label)
+	}
+
+	if contentType {
+		if _, params, err := mime.ParseMediaType(content); err == nil {
+			return params["charset"]
+		}
+	}
+
+	return ""
+}
+
+func isText(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/html") || strings.HasPrefix(contentType, "text/plain")
+}
+
+// trimPartialRune removes a rune cut at the end of the head of a larger file
+func trimPartialRune(head []byte) []byte {
+	for i := len(head) - 1; i >= 0 && i > len(head)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(head[i]) {
+			if !utf8.FullRune(head[i:]) {
+				return head[:i]
+			}
+
+			break
+		}
+	}
+
+	return head
+}
+
+func isASCII(head []byte) bool {
+	for _, b := range head {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,133 @@
+package disk
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestCharsetDetectorContentType(t *testing.T) {
+	tests := map[string]struct {
+		cfg         config.Charset
+		contentType string
+		head        string
+		expected    string
+	}{
+		"default": {
+			cfg:         config.Charset{Default: "utf-8"},
+			contentType: "text/html; charset=utf-8",
+			head:        `<meta charset="iso-8859-1">`,
+			expected:    "text/html; charset=utf-8",
+		},
+		"default_alias": {
+			cfg:         config.Charset{Default: "latin1"},
+			contentType: "text/plain",
+			expected:    "text/plain; charset=windows-1252",
+		},
+		"no_default": {
+			cfg:         config.Charset{},
+			contentType: "text/html; charset=utf-8",
+			expected:    "text/html",
+		},
+		"not_text": {
+			cfg:         config.Charset{Default: "windows-1252", Sniff: true},
+			contentType: "text/css; charset=utf-8",
+			head:        "body {}",
+			expected:    "text/css; charset=utf-8",
+		},
+		"sniff_meta_charset": {
+			cfg:         config.Charset{Default: "utf-8", Sniff: true},
+			contentType: "text/html; charset=utf-8",
+			head:        `<!DOCTYPE html><html><head><meta charset="ISO-8859-1"><title>caf` + "\xe9</title>",
+			expected:    "text/html; charset=windows-1252",
+		},
+		"sniff_meta_http_equiv": {
+			cfg:         config.Charset{Default: "utf-8", Sniff: true},
+			contentType: "text/html; charset=utf-8",
+			head:        `<head><meta http-equiv="Content-Type" content="text/html; charset=Shift_JIS"></head>`,
+			expected:    "text/html; charset=shift_jis",
+		},
+		"sniff_meta_in_body": {
+			cfg:         config.Charset{Default: "utf-8", Sniff: true},
+			contentType: "text/html; charset=utf-8",
+			head:        `<body><meta charset="shift_jis">`,
+			expected:    "text/html; charset=utf-8",
+		},
+		"sniff_meta_in_text": {
+			cfg:         config.Charset{Default: "utf-8", Sniff: true},
+			contentType: "text/plain; charset=utf-8",
+			head:        `<meta charset="shift_jis">`,
+			expected:    "text/plain; charset=utf-8",
+		},
+		"sniff_bom": {
+			cfg:         config.Charset{Default: "utf-8", Sniff: true},
+			contentType: "text/plain; charset=utf-8",
+			head:        "\xff\xfeh\x00i\x00",
+			expected:    "text/plain; charset=utf-16le",
+		},
+		// the head of a larger file cut in the middle of a rune
+		"sniff_utf8": {
+			cfg:         config.Charset{Default: "windows-1252", Sniff: true},
+			contentType: "text/plain",
+			head:        "caf\xc3\xa9" + strings.Repeat(" ", charsetHeadSize-7) + "\xe2\x82",
+			expected:    "text/plain; charset=utf-8",
+		},
+		"sniff_ascii": {
+			cfg:         config.Charset{Default: "utf-8", Sniff: true},
+			contentType: "text/plain",
+			head:        "plain text",
+			expected:    "text/plain; charset=utf-8",
+		},
+		"sniff_legacy": {
+			cfg:         config.Charset{Default: "utf-8", Sniff: true},
+			contentType: "text/plain; charset=utf-8",
+			head:        "caf\xe9 cr\xe8me",
+			expected:    "text/plain; charset=windows-1252",
+		},
+		"sniff_legacy_default": {
+			cfg:         config.Charset{Default: "shift_jis", Sniff: true},
+			contentType: "text/plain; charset=utf-8",
+			head:        "\x93\xfa\x96\x7b",
+			expected:    "text/plain; charset=shift_jis",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := newCharsetDetector(&tt.cfg)
+			require.Equal(t, tt.expected, d.contentType(tt.contentType, []byte(tt.head)))
+		})
+	}
+}
+
+func TestServeFileStatesCharset(t *testing.T) {
+	reader := &Reader{fileSizeMetric: metrics.DiskServingFileSize, vfs: namedVFS{}}
+	root := newCountingRoot(t, map[string]string{
+		"legacy.html": `<html><head><meta charset="windows-1252"></head><body>caf` + "\xe9</body></html>",
+		"notes.txt":   "caf\xe9",
+		"main.css":    "body {}",
+	})
+
+	w := serveFromRoot(t, reader, root, "legacy.html", "")
+	require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Equal(t, 1, root.opens)
+
+	reader.setCharsetDetector(newCharsetDetector(&config.Charset{Default: "utf-8", Sniff: true}))
+
+	w = serveFromRoot(t, reader, root, "legacy.html", "")
+	require.Equal(t, "text/html; charset=windows-1252", w.Header().Get("Content-Type"))
+	require.Equal(t, "<html><head><meta charset=\"windows-1252\"></head><body>caf\xe9</body></html>", w.Body.String())
+
+	w = serveFromRoot(t, reader, root, "notes.txt", "")
+	require.Equal(t, "text/plain; charset=windows-1252", w.Header().Get("Content-Type"))
+
+	// only text files are read to detect their charset
+	opens := root.opens
+	w = serveFromRoot(t, reader, root, "main.css", "")
+	require.Equal(t, "text/css; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Equal(t, opens+1, root.opens)
+}
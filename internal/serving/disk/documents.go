@@ -0,0 +1,80 @@
+package disk
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/lru"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// documentCache keeps the content of small HTML documents in memory so
+// popular pages are served without reading the archive or the disk.
+// Documents are cached per deployment SHA, a new deployment changes the SHA
+// of the lookup path and its documents are fetched again.
+// A nil *documentCache is valid and never caches anything.
+type documentCache struct {
+	cache       *lru.Cache
+	maxFileSize int64
+}
+
+type document struct {
+	content []byte
+	modTime time.Time
+}
+
+func newDocumentCache(cfg *config.HTMLCache) *documentCache {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+
+	return &documentCache{
+		cache: lru.New("html",
+			lru.WithExpirationInterval(cfg.TTL),
+			lru.WithMaxSize(cfg.Size),
+			lru.WithCachedEntriesMetric(metrics.HTMLCachedEntries),
+			lru.WithCachedRequestsMetric(metrics.HTMLCacheRequests),
+		),
+		maxFileSize: cfg.MaxFileSize,
+	}
+}
+
+// cacheable reports whether the document can be served from the cache.
+// Documents without a SHA cannot be invalidated and are never cached.
+func (c *documentCache) cacheable(sha, contentType string, fi os.FileInfo) bool {
+	return c != nil &&
+		sha != "" &&
+		strings.HasPrefix(contentType, "text/html") &&
+		fi.Size() <= c.maxFileSize
+}
+
+func (c *documentCache) get(ctx context.Context, root vfs.Root, sha, fullPath string, fi os.FileInfo) (*document, error) {
+	value, err := c.cache.FindOrFetch(sha+":", fullPath, func() (interface{}, error) {
+		content, err := readContent(ctx, root, fullPath, fi)
+		if err != nil {
+			return nil, err
+		}
+
+		return &document{content: content, modTime: fi.ModTime()}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*document), nil
+}
+
+func readContent(ctx context.Context, root vfs.Root, fullPath string, fi os.FileInfo) ([]byte, error) {
+	file, err := root.Open(ctx, fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, fi.Size()))
+}
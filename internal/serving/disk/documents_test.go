@@ -0,0 +1,136 @@
+package disk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// countingRoot serves files from a directory and counts how often they are opened
+type countingRoot struct {
+	dir   string
+	opens int
+}
+
+func (r *countingRoot) Lstat(ctx context.Context, name string) (os.FileInfo, error) {
+	return os.Lstat(filepath.Join(r.dir, name))
+}
+
+func (r *countingRoot) Readlink(ctx context.Context, name string) (string, error) {
+	return os.Readlink(filepath.Join(r.dir, name))
+}
+
+func (r *countingRoot) Open(ctx context.Context, name string) (vfs.File, error) {
+	r.opens++
+	return os.Open(filepath.Join(r.dir, name))
+}
+
+func newCountingRoot(t *testing.T, files map[string]string) *countingRoot {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	return &countingRoot{dir: dir}
+}
+
+type namedVFS struct {
+	vfs.VFS
+}
+
+func (namedVFS) Name() string {
+	return "test"
+}
+
+func newDocumentsReader(t *testing.T) *Reader {
+	t.Helper()
+
+	reader := &Reader{fileSizeMetric: metrics.DiskServingFileSize, vfs: namedVFS{}}
+	reader.setDocumentCache(newDocumentCache(&config.HTMLCache{
+		TTL:         time.Minute,
+		Size:        100,
+		MaxFileSize: 16,
+	}))
+
+	return reader
+}
+
+func serveFromRoot(t *testing.T, reader *Reader, root vfs.Root, path, sha string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/"+path, nil)
+
+	require.True(t, reader.serveFile(context.Background(), w, r, root, path, sha, false, false))
+
+	return w
+}
+
+func TestServeFileCachesHTMLDocuments(t *testing.T) {
+	reader := newDocumentsReader(t)
+	root := newCountingRoot(t, map[string]string{"index.html": "<p>cached</p>"})
+
+	for i := 0; i < 3; i++ {
+		w := serveFromRoot(t, reader, root, "index.html", "sha1")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "<p>cached</p>", w.Body.String())
+		require.Equal(t, `"sha1"`, w.Header().Get("ETag"))
+		require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	}
+	require.Equal(t, 1, root.opens)
+
+	// a new deployment is read from storage again
+	require.NoError(t, os.WriteFile(filepath.Join(root.dir, "index.html"), []byte("<p>new</p>"), 0644))
+
+	w := serveFromRoot(t, reader, root, "index.html", "sha2")
+	require.Equal(t, "<p>new</p>", w.Body.String())
+	require.Equal(t, 2, root.opens)
+}
+
+func TestServeFileDoesNotCacheDocuments(t *testing.T) {
+	tests := map[string]struct {
+		path string
+		sha  string
+	}{
+		"not_html":  {path: "main.css", sha: "sha1"},
+		"too_large": {path: "large.html", sha: "sha1"},
+		"no_sha":    {path: "index.html"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reader := newDocumentsReader(t)
+			root := newCountingRoot(t, map[string]string{
+				"main.css":   "body {}",
+				"large.html": strings.Repeat("a", 17),
+				"index.html": "<p>index</p>",
+			})
+
+			serveFromRoot(t, reader, root, tt.path, tt.sha)
+			serveFromRoot(t, reader, root, tt.path, tt.sha)
+			require.Equal(t, 2, root.opens)
+		})
+	}
+}
+
+func TestServeFileWithoutDocumentCache(t *testing.T) {
+	reader := &Reader{fileSizeMetric: metrics.DiskServingFileSize, vfs: namedVFS{}}
+	root := newCountingRoot(t, map[string]string{"index.html": "<p>index</p>"})
+
+	serveFromRoot(t, reader, root, "index.html", "sha1")
+	serveFromRoot(t, reader, root, "index.html", "sha1")
+	require.Equal(t, 2, root.opens)
+}
@@ -27,6 +27,15 @@ var compressedEncodingsPriority = []string{
 	"gzip",
 }
 
+func init() {
+	// browsers only compile streamed WebAssembly served as application/wasm,
+	// load modules and decode images of these types only, and the MIME
+	// database of older systems lacks them
+	mime.AddExtensionType(".wasm", "application/wasm")
+	mime.AddExtensionType(".mjs", "text/javascript")
+	mime.AddExtensionType(".avif", "image/avif")
+}
+
 func endsWithSlash(path string) bool {
 	return strings.HasSuffix(path, "/")
 }
@@ -35,14 +44,27 @@ func endsWithoutHTMLExtension(path string) bool {
 	return !strings.HasSuffix(path, ".html")
 }
 
-// Detect file's content-type either by extension or mime-sniffing.
+// typeByExtension returns the media type of the files with ext, configured
+// with -mime-type or else from the MIME database
+func (reader *Reader) typeByExtension(ext string) string {
+	if contentType, ok := reader.mimeTypeMapping()[strings.ToLower(ext)]; ok {
+		return contentType
+	}
+
+	return mime.TypeByExtension(ext)
+}
+
+// Detect file's content-type either by extension or mime-sniffing, and state
+// the charset of text files.
 // Implementation is adapted from Golang's `http.serveContent()`
 // See https://github.com/golang/go/blob/902fc114272978a40d2e65c2510a18e870077559/src/net/http/fs.go#L194
 func (reader *Reader) detectContentType(ctx context.Context, root vfs.Root, path string) (string, error) {
-	contentType := mime.TypeByExtension(filepath.Ext(path))
+	contentType := reader.typeByExtension(filepath.Ext(path))
+	charsets := reader.charsetDetector()
 
-	if contentType == "" {
-		var buf [512]byte
+	var head []byte
+	if contentType == "" || charsets.sniffs(contentType) {
+		var buf [charsetHeadSize]byte
 
 		file, err := root.Open(ctx, path)
 		if err != nil {
@@ -52,12 +74,16 @@ func (reader *Reader) detectContentType(ctx context.Context, root vfs.Root, path
 		defer file.Close()
 
 		// Using `io.ReadFull()` because `file.Read()` may be chunked.
-		// Ignoring errors because we don't care if the 512 bytes cannot be read.
+		// Ignoring errors because we don't care if the whole buffer cannot be read.
 		n, _ := io.ReadFull(file, buf[:])
-		contentType = http.DetectContentType(buf[:n])
+		head = buf[:n]
+	}
+
+	if contentType == "" {
+		contentType = http.DetectContentType(head)
 	}
 
-	return contentType, nil
+	return charsets.contentType(contentType, head), nil
 }
 
 func (reader *Reader) handleContentEncoding(ctx context.Context, w http.ResponseWriter, r *http.Request, root vfs.Root, fullPath string) string {
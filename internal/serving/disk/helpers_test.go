@@ -0,0 +1,45 @@
+package disk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestServeFileMIMETypes(t *testing.T) {
+	reader := &Reader{fileSizeMetric: metrics.DiskServingFileSize, vfs: namedVFS{}}
+	root := newCountingRoot(t, map[string]string{
+		"module.mjs":  "export default 1",
+		"image.avif":  "avif",
+		"model.GLB":   "glTF",
+		"readme.ext1": "notes",
+		"data.json":   "{}",
+	})
+
+	mapping, err := (&config.MIMETypes{Extensions: []string{
+		".glb=model/gltf-binary",
+		".EXT1=text/plain",
+		".json=application/ld+json",
+	}}).Mapping()
+	require.NoError(t, err)
+
+	reader.setMIMETypeMapping(mapping)
+
+	tests := map[string]string{
+		"module.mjs":  "text/javascript; charset=utf-8",
+		"image.avif":  "image/avif",
+		"model.GLB":   "model/gltf-binary",
+		"readme.ext1": "text/plain",
+		"data.json":   "application/ld+json",
+	}
+
+	for file, expected := range tests {
+		t.Run(file, func(t *testing.T) {
+			w := serveFromRoot(t, reader, root, file, "")
+			require.Equal(t, expected, w.Header().Get("Content-Type"))
+		})
+	}
+}
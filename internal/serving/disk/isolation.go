@@ -0,0 +1,94 @@
+package disk
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/isolation"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/lru"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	isolationCacheTTL  = 10 * time.Minute
+	isolationCacheSize = 1000
+)
+
+// isolationCache keeps the parsed `_headers` files of deployments per SHA,
+// so they are not read for every file served. A nil *isolationCache is
+// valid and never sets any header.
+type isolationCache struct {
+	cache *lru.Cache
+}
+
+func newIsolationCache(cfg *config.DiskServing) *isolationCache {
+	if !cfg.IsolationHeaders {
+		return nil
+	}
+
+	return &isolationCache{
+		cache: lru.New("isolation_headers",
+			lru.WithExpirationInterval(isolationCacheTTL),
+			lru.WithMaxSize(isolationCacheSize),
+			lru.WithCachedEntriesMetric(metrics.DiskCachedEntries),
+			lru.WithCachedRequestsMetric(metrics.DiskCacheRequests),
+		),
+	}
+}
+
+// get returns the headers of the deployment served under prefix. Invalid
+// files are logged and treated as empty. The files of deployments without a
+// SHA are ignored, they could not be cached and would be read for every file
+// served.
+func (c *isolationCache) get(ctx context.Context, root vfs.Root, sha, prefix string) *isolation.Headers {
+	if c == nil || sha == "" {
+		return nil
+	}
+
+	parse := func() (interface{}, error) {
+		headers, err := isolation.Parse(ctx, root, prefix)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			// not cached, the next request reads the file again
+			return nil, ctxErr
+		} else if err != nil {
+			log.WithError(err).WithField("sha256", sha).Debug("ignoring invalid _headers file")
+			return &isolation.Headers{}, nil
+		}
+
+		return headers, nil
+	}
+
+	headers, err := c.cache.FindOrFetch(sha+":", prefix, parse)
+	if err != nil {
+		return nil
+	}
+
+	return headers.(*isolation.Headers)
+}
+
+// setIsolationHeaders sets the cross-origin isolation headers the deployment
+// opts in to for the requested path
+func (reader *Reader) setIsolationHeaders(ctx context.Context, h serving.Handler, root vfs.Root) {
+	headers := reader.isolationCache().get(ctx, root, h.LookupPath.SHA256, h.LookupPath.Prefix)
+	headers.Apply(h.Writer.Header(), strings.TrimPrefix(h.Request.URL.Path, strings.TrimSuffix(h.LookupPath.Prefix, "/")))
+}
+
+func (reader *Reader) isolationCache() *isolationCache {
+	reader.mu.RLock()
+	defer reader.mu.RUnlock()
+
+	return reader.isolation
+}
+
+func (reader *Reader) setIsolationCache(isolation *isolationCache) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+
+	reader.isolation = isolation
+}
@@ -0,0 +1,113 @@
+package disk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestIsolationHeaders(t *testing.T) {
+	root := newCountingRoot(t, map[string]string{
+		"_headers":   "/project/app*\n  Cross-Origin-Opener-Policy: same-origin\n  Cross-Origin-Embedder-Policy: require-corp\n",
+		"app.html":   "<p>app</p>",
+		"app.wasm":   "\x00asm\x01\x00\x00\x00",
+		"index.html": "<p>index</p>",
+	})
+
+	s := &Disk{reader: Reader{
+		fileSizeMetric: metrics.DiskServingFileSize,
+		vfs:            rootVFS{root: root},
+		isolation:      newIsolationCache(&config.DiskServing{IsolationHeaders: true}),
+	}}
+
+	tests := map[string]struct {
+		subPath      string
+		expectedType string
+		expectedCOOP string
+		expectedCOEP string
+	}{
+		"isolated page": {
+			subPath:      "app.html",
+			expectedType: "text/html; charset=utf-8",
+			expectedCOOP: "same-origin",
+			expectedCOEP: "require-corp",
+		},
+		"isolated module": {
+			subPath:      "app.wasm",
+			expectedType: "application/wasm",
+			expectedCOOP: "same-origin",
+			expectedCOEP: "require-corp",
+		},
+		"other page": {
+			subPath:      "index.html",
+			expectedType: "text/html; charset=utf-8",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/"+tt.subPath, nil)
+
+			require.True(t, s.ServeFileHTTP(serving.Handler{
+				Writer:     w,
+				Request:    r,
+				LookupPath: &serving.LookupPath{Prefix: "/project/", SHA256: "sha1"},
+				SubPath:    tt.subPath,
+			}))
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, tt.expectedType, w.Header().Get("Content-Type"))
+			require.Equal(t, tt.expectedCOOP, w.Header().Get("Cross-Origin-Opener-Policy"))
+			require.Equal(t, tt.expectedCOEP, w.Header().Get("Cross-Origin-Embedder-Policy"))
+		})
+	}
+}
+
+func TestIsolationHeadersIgnored(t *testing.T) {
+	root := newCountingRoot(t, map[string]string{
+		"_headers": "/*\n  Cross-Origin-Opener-Policy: same-origin\n",
+		"app.html": "<p>app</p>",
+	})
+
+	tests := map[string]struct {
+		enabled bool
+		sha     string
+	}{
+		"disabled": {
+			sha: "sha1",
+		},
+		"without_sha": {
+			enabled: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &Disk{reader: Reader{
+				fileSizeMetric: metrics.DiskServingFileSize,
+				vfs:            rootVFS{root: root},
+				isolation:      newIsolationCache(&config.DiskServing{IsolationHeaders: tt.enabled}),
+			}}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/app.html", nil)
+
+			require.True(t, s.ServeFileHTTP(serving.Handler{
+				Writer:     w,
+				Request:    r,
+				LookupPath: &serving.LookupPath{Prefix: "/project/", SHA256: tt.sha},
+				SubPath:    "app.html",
+			}))
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Empty(t, w.Header().Get("Cross-Origin-Opener-Policy"))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package disk
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/assetmanifest"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/lru"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	manifestCacheTTL  = 10 * time.Minute
+	manifestCacheSize = 1000
+
+	// immutableMaxAge is the cache lifetime of fingerprinted files
+	immutableMaxAge = 365 * 24 * time.Hour
+)
+
+// manifestCache keeps the parsed asset manifests of deployments per SHA, so
+// they are not read for every file served. A nil *manifestCache is valid
+// and means asset manifests are disabled.
+type manifestCache struct {
+	cache *lru.Cache
+	mode  string
+}
+
+func newManifestCache(cfg *config.AssetManifest) *manifestCache {
+	if cfg.Mode == config.AssetManifestDisabled {
+		return nil
+	}
+
+	return &manifestCache{
+		cache: lru.New("asset_manifests",
+			lru.WithExpirationInterval(manifestCacheTTL),
+			lru.WithMaxSize(manifestCacheSize),
+			lru.WithCachedEntriesMetric(metrics.DiskCachedEntries),
+			lru.WithCachedRequestsMetric(metrics.DiskCacheRequests),
+		),
+		mode: cfg.Mode,
+	}
+}
+
+// get returns the manifest of the deployment served under prefix. Invalid
+// manifests are logged and treated as empty, the deployment is served as if
+// it had none. The manifests of deployments without a SHA are ignored, they
+// could not be cached and would be read for every file served.
+func (c *manifestCache) get(ctx context.Context, root vfs.Root, sha, prefix string) *assetmanifest.Manifest {
+	if c == nil || sha == "" {
+		return nil
+	}
+
+	parse := func() (interface{}, error) {
+		manifest, err := assetmanifest.Parse(ctx, root, prefix)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			// not cached, the next request reads the manifest again
+			return nil, ctxErr
+		} else if err != nil {
+			log.WithError(err).WithField("sha256", sha).Debug("ignoring invalid asset manifest")
+			return &assetmanifest.Manifest{}, nil
+		}
+
+		return manifest, nil
+	}
+
+	manifest, err := c.cache.FindOrFetch(sha+":", prefix, parse)
+	if err != nil {
+		return nil
+	}
+
+	return manifest.(*assetmanifest.Manifest)
+}
@@ -0,0 +1,130 @@
+package disk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// rootVFS serves every deployment from the same root
+type rootVFS struct {
+	namedVFS
+	root vfs.Root
+}
+
+func (v rootVFS) Root(ctx context.Context, path string, cacheKey string) (vfs.Root, error) {
+	return v.root, nil
+}
+
+func newManifestDisk(t *testing.T, mode string) *Disk {
+	t.Helper()
+
+	root := newCountingRoot(t, map[string]string{
+		"asset-manifest.json": `{"files": {"main.js": "/project/main.3f2a1b.js"}}`,
+		"main.3f2a1b.js":      "console.log('main')",
+		"index.html":          "<p>index</p>",
+	})
+
+	s := &Disk{reader: Reader{fileSizeMetric: metrics.DiskServingFileSize, vfs: rootVFS{root: root}}}
+	s.reader.setManifestCache(newManifestCache(&config.AssetManifest{Mode: mode}))
+
+	return s
+}
+
+func serveManifestPath(t *testing.T, s *Disk, subPath string, accessControl bool) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return serveManifestPathSHA(t, s, subPath, "sha1", accessControl)
+}
+
+func serveManifestPathSHA(t *testing.T, s *Disk, subPath, sha string, accessControl bool) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/"+subPath, nil)
+
+	require.True(t, s.ServeFileHTTP(serving.Handler{
+		Writer:  w,
+		Request: r,
+		LookupPath: &serving.LookupPath{
+			Prefix:           "/project/",
+			SHA256:           sha,
+			HasAccessControl: accessControl,
+		},
+		SubPath: subPath,
+	}))
+
+	return w
+}
+
+func TestAssetManifestImmutableFiles(t *testing.T) {
+	s := newManifestDisk(t, config.AssetManifestRewrite)
+
+	w := serveManifestPath(t, s, "main.3f2a1b.js", false)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+
+	w = serveManifestPath(t, s, "index.html", false)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "max-age=600", w.Header().Get("Cache-Control"))
+
+	w = serveManifestPath(t, s, "main.3f2a1b.js", true)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("Cache-Control"))
+}
+
+func TestAssetManifestLogicalPaths(t *testing.T) {
+	t.Run("rewrite", func(t *testing.T) {
+		s := newManifestDisk(t, config.AssetManifestRewrite)
+
+		w := serveManifestPath(t, s, "main.js", false)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "console.log('main')", w.Body.String())
+		require.Equal(t, "max-age=600", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		s := newManifestDisk(t, config.AssetManifestRedirect)
+
+		w := serveManifestPath(t, s, "main.js", false)
+		require.Equal(t, http.StatusFound, w.Code)
+		require.Equal(t, "/project/main.3f2a1b.js", w.Header().Get("Location"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		s := newManifestDisk(t, config.AssetManifestDisabled)
+
+		w := serveManifestPath(t, s, "main.3f2a1b.js", false)
+		require.Equal(t, "max-age=600", w.Header().Get("Cache-Control"))
+
+		require.False(t, s.ServeFileHTTP(serving.Handler{
+			Writer:     httptest.NewRecorder(),
+			Request:    httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/main.js", nil),
+			LookupPath: &serving.LookupPath{Prefix: "/project/", SHA256: "sha1"},
+			SubPath:    "main.js",
+		}))
+	})
+}
+
+func TestAssetManifestWithoutSHA(t *testing.T) {
+	s := newManifestDisk(t, config.AssetManifestRewrite)
+
+	w := serveManifestPathSHA(t, s, "main.3f2a1b.js", "", false)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "max-age=600", w.Header().Get("Cache-Control"))
+
+	require.False(t, s.ServeFileHTTP(serving.Handler{
+		Writer:     httptest.NewRecorder(),
+		Request:    httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/main.js", nil),
+		LookupPath: &serving.LookupPath{Prefix: "/project/"},
+		SubPath:    "main.js",
+	}))
+}
@@ -1,24 +1,31 @@
 package disk
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"gitlab.com/gitlab-org/labkit/errortracking"
 
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/readonly"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/redirects"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/symlink"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/proxy"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
 	vfsServing "gitlab.com/gitlab-org/gitlab-pages/internal/vfs/serving"
 )
@@ -27,6 +34,17 @@ import (
 type Reader struct {
 	fileSizeMetric *prometheus.HistogramVec
 	vfs            vfs.VFS
+
+	mu        sync.RWMutex
+	documents *documentCache
+	assets    *assetCache
+	manifests *manifestCache
+	charsets  *charsetDetector
+	isolation *isolationCache
+	redirects *redirectsCache
+
+	cacheControl *cacheControlPolicy
+	mimeTypes    map[string]string
 }
 
 // Show the user some validation messages for their _redirects file
@@ -39,6 +57,16 @@ func (reader *Reader) serveRedirectsStatus(h serving.Handler, redirects *redirec
 
 // tryRedirects returns true if it successfully handled request
 func (reader *Reader) tryRedirects(h serving.Handler) bool {
+	return reader.applyRedirects(h, (*redirects.Redirects).Rewrite)
+}
+
+// tryForcedRedirects returns true if it successfully handled request with a
+// rule forced with `!`, which applies even when a file exists
+func (reader *Reader) tryForcedRedirects(h serving.Handler) bool {
+	return reader.applyRedirects(h, (*redirects.Redirects).RewriteForced)
+}
+
+func (reader *Reader) applyRedirects(h serving.Handler, rewrite func(*redirects.Redirects, *url.URL) (*url.URL, int, error)) bool {
 	ctx := h.Request.Context()
 
 	root, served := reader.root(h)
@@ -46,9 +74,9 @@ func (reader *Reader) tryRedirects(h serving.Handler) bool {
 		return served
 	}
 
-	r := redirects.ParseRedirects(ctx, root)
+	r := reader.redirectsCache().get(ctx, root, h.LookupPath.SHA256)
 
-	rewrittenURL, status, err := r.Rewrite(h.Request.URL)
+	rewrittenURL, status, err := rewrite(r, h.Request.URL)
 	if err != nil {
 		if err != redirects.ErrNoRedirect {
 			// We assume that rewrite failure is not fatal
@@ -58,12 +86,22 @@ func (reader *Reader) tryRedirects(h serving.Handler) bool {
 		return false
 	}
 
+	if status == http.StatusOK && rewrittenURL.IsAbs() {
+		proxy.ServeRewrite(h.Writer, h.Request, rewrittenURL)
+		return true
+	}
+
 	if status == http.StatusOK {
 		h.SubPath = strings.TrimPrefix(rewrittenURL.Path, h.LookupPath.Prefix)
 		return reader.tryFile(h)
 	}
 
-	http.Redirect(h.Writer, h.Request, rewrittenURL.Path, status)
+	target := rewrittenURL.Path
+	if rewrittenURL.RawQuery != "" {
+		target += "?" + rewrittenURL.RawQuery
+	}
+
+	http.Redirect(h.Writer, h.Request, target, status)
 	return true
 }
 
@@ -103,12 +141,55 @@ func (reader *Reader) tryFile(h serving.Handler) bool {
 	// Serve status of `_redirects` under `_redirects`
 	// We check if the final resolved path is `_redirects` after symlink traversal
 	if fullPath == redirects.ConfigFile {
-		r := redirects.ParseRedirects(ctx, root)
+		r := reader.redirectsCache().get(ctx, root, h.LookupPath.SHA256)
 		reader.serveRedirectsStatus(h, r)
 		return true
 	}
 
-	return reader.serveFile(ctx, h.Writer, h.Request, root, fullPath, h.LookupPath.SHA256, h.LookupPath.HasAccessControl)
+	reader.setIsolationHeaders(ctx, h, root)
+
+	// Fingerprinted files of the asset manifest never change
+	immutable := !h.LookupPath.HasAccessControl &&
+		reader.manifestCache().get(ctx, root, h.LookupPath.SHA256, h.LookupPath.Prefix).Immutable(fullPath)
+
+	return reader.serveFile(ctx, h.Writer, h.Request, root, fullPath, h.LookupPath.SHA256, h.LookupPath.HasAccessControl, immutable)
+}
+
+// tryAssetManifest returns true if it successfully handled request for a
+// logical path of the asset manifest
+func (reader *Reader) tryAssetManifest(h serving.Handler) bool {
+	manifests := reader.manifestCache()
+	if manifests == nil {
+		return false
+	}
+
+	ctx := h.Request.Context()
+
+	root, served := reader.root(h)
+	if root == nil {
+		return served
+	}
+
+	target, ok := manifests.get(ctx, root, h.LookupPath.SHA256, h.LookupPath.Prefix).Lookup(h.SubPath)
+	if !ok {
+		return false
+	}
+
+	if manifests.mode == config.AssetManifestRedirect {
+		http.Redirect(h.Writer, h.Request, path.Join("/", h.LookupPath.Prefix, target), http.StatusFound)
+		return true
+	}
+
+	fullPath, err := reader.resolvePath(ctx, root, target)
+	if err != nil {
+		return false
+	}
+
+	reader.setIsolationHeaders(ctx, h, root)
+
+	// the logical path is served with the usual caching, the next
+	// deployment may map it to another file
+	return reader.serveFile(ctx, h.Writer, h.Request, root, fullPath, h.LookupPath.SHA256, h.LookupPath.HasAccessControl, false)
 }
 
 func redirectPath(request *http.Request) string {
@@ -140,8 +221,8 @@ func (reader *Reader) tryNotFound(h serving.Handler) bool {
 	err = reader.serveCustomFile(ctx, h.Writer, h.Request, http.StatusNotFound, root, page404)
 	if err != nil {
 		// Handle context.Canceled error as not exist https://gitlab.com/gitlab-org/gitlab-pages/-/issues/669
-		if errors.Is(err, context.Canceled) {
-			logging.LogRequest(h.Request).WithError(err).Warn("user cancelled request")
+		if httperrors.IsClientAborted(h.Request, err) {
+			httperrors.LogClientAborted(h.Request, "serveCustomFile", err)
 			return false
 		}
 
@@ -193,17 +274,9 @@ func (reader *Reader) resolvePath(ctx context.Context, root vfs.Root, subPath ..
 	return fullPath, nil
 }
 
-func (reader *Reader) serveFile(ctx context.Context, w http.ResponseWriter, r *http.Request, root vfs.Root, origPath, sha string, accessControl bool) bool {
+func (reader *Reader) serveFile(ctx context.Context, w http.ResponseWriter, r *http.Request, root vfs.Root, origPath, sha string, accessControl, immutable bool) bool {
 	fullPath := reader.handleContentEncoding(ctx, w, r, root, origPath)
 
-	file, err := root.Open(ctx, fullPath)
-	if err != nil {
-		httperrors.Serve500WithRequest(w, r, "root.Open", err)
-		return true
-	}
-
-	defer file.Close()
-
 	fi, err := root.Lstat(ctx, fullPath)
 	if err != nil {
 		httperrors.Serve500WithRequest(w, r, "root.Lstat", err)
@@ -213,22 +286,54 @@ func (reader *Reader) serveFile(ctx context.Context, w http.ResponseWriter, r *h
 	ce := w.Header().Get("Content-Encoding")
 	w.Header().Set("ETag", fmt.Sprintf("%q", etag(ce, sha)))
 
-	if !accessControl {
-		// Set caching headers
-		w.Header().Set("Cache-Control", "max-age=600")
-		w.Header().Set("Expires", time.Now().Add(10*time.Minute).Format(time.RFC1123))
-	}
-
 	contentType, err := reader.detectContentType(ctx, root, origPath)
 	if err != nil {
-		httperrors.Serve500WithRequest(w, r, "detectContentType", err)
+		serveReadError(w, r, "detectContentType", err)
 		return true
 	}
 
 	w.Header().Set("Content-Type", contentType)
 
+	if immutable {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int64(immutableMaxAge.Seconds())))
+		w.Header().Set("Expires", time.Now().Add(immutableMaxAge).Format(time.RFC1123))
+	} else if !accessControl {
+		reader.cacheControlPolicy().setHeaders(w.Header(), contentType)
+	}
+
 	reader.fileSizeMetric.WithLabelValues(reader.vfs.Name()).Observe(float64(fi.Size()))
 
+	// Compressed variants are served from storage as they are
+	if documents := reader.documentCache(); ce == "" && documents.cacheable(sha, contentType, fi) {
+		doc, err := documents.get(ctx, root, sha, fullPath, fi)
+		if err != nil {
+			serveReadError(w, r, "documents.get", err)
+			return true
+		}
+
+		http.ServeContent(w, r, origPath, doc.modTime, bytes.NewReader(doc.content))
+		return true
+	}
+
+	if assets := reader.assetCache(); ce == "" && assets.cacheable(sha, fi) {
+		asset, err := assets.get(ctx, root, sha, fullPath, fi)
+		if err != nil {
+			serveReadError(w, r, "assets.get", err)
+			return true
+		}
+
+		http.ServeContent(w, r, origPath, asset.modTime, bytes.NewReader(asset.content))
+		return true
+	}
+
+	file, err := root.Open(ctx, fullPath)
+	if err != nil {
+		serveReadError(w, r, "root.Open", err)
+		return true
+	}
+
+	defer file.Close()
+
 	// Support vfs.SeekableFile if available (uncompressed files)
 	if rs, ok := file.(vfs.SeekableFile); ok {
 		http.ServeContent(w, r, origPath, fi.ModTime(), rs)
@@ -240,6 +345,102 @@ func (reader *Reader) serveFile(ctx context.Context, w http.ResponseWriter, r *h
 	return true
 }
 
+// serveReadError replies 503 when the file could not be read because the VFS
+// is saturated, the request can be retried, and 500 otherwise
+func serveReadError(w http.ResponseWriter, r *http.Request, caller string, err error) {
+	if errors.Is(err, vfs.ErrSaturated) {
+		logging.LogRequest(r).WithError(err).Warn("too many requests waiting for the VFS")
+		httperrors.Serve503(w, r)
+		return
+	}
+
+	httperrors.Serve500WithRequest(w, r, caller, err)
+}
+
+func (reader *Reader) documentCache() *documentCache {
+	reader.mu.RLock()
+	defer reader.mu.RUnlock()
+
+	return reader.documents
+}
+
+func (reader *Reader) setDocumentCache(documents *documentCache) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+
+	reader.documents = documents
+}
+
+func (reader *Reader) manifestCache() *manifestCache {
+	reader.mu.RLock()
+	defer reader.mu.RUnlock()
+
+	return reader.manifests
+}
+
+func (reader *Reader) setManifestCache(manifests *manifestCache) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+
+	reader.manifests = manifests
+}
+
+func (reader *Reader) charsetDetector() *charsetDetector {
+	reader.mu.RLock()
+	defer reader.mu.RUnlock()
+
+	return reader.charsets
+}
+
+func (reader *Reader) setCharsetDetector(charsets *charsetDetector) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+
+	reader.charsets = charsets
+}
+
+func (reader *Reader) cacheControlPolicy() *cacheControlPolicy {
+	reader.mu.RLock()
+	defer reader.mu.RUnlock()
+
+	return reader.cacheControl
+}
+
+func (reader *Reader) setCacheControlPolicy(cacheControl *cacheControlPolicy) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+
+	reader.cacheControl = cacheControl
+}
+
+func (reader *Reader) mimeTypeMapping() map[string]string {
+	reader.mu.RLock()
+	defer reader.mu.RUnlock()
+
+	return reader.mimeTypes
+}
+
+func (reader *Reader) setMIMETypeMapping(mimeTypes map[string]string) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+
+	reader.mimeTypes = mimeTypes
+}
+
+func (reader *Reader) assetCache() *assetCache {
+	reader.mu.RLock()
+	defer reader.mu.RUnlock()
+
+	return reader.assets
+}
+
+func (reader *Reader) setAssetCache(assets *assetCache) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+
+	reader.assets = assets
+}
+
 func etag(contentEncoding, sha string) string {
 	if contentEncoding == "" {
 		return sha
@@ -293,9 +494,38 @@ func (reader *Reader) root(h serving.Handler) (vfs.Root, bool) {
 		return nil, false
 	}
 
-	if errors.Is(err, context.Canceled) {
-		// Handle context.Canceled error as not found exist https://gitlab.com/gitlab-org/gitlab-pages/-/issues/669
-		httperrors.Serve404(h.Writer)
+	if httperrors.IsClientAborted(h.Request, err) {
+		httperrors.ServeClientAborted(h.Writer, h.Request, "vfs.Root", err)
+		return nil, true
+	}
+
+	if errors.Is(err, vfs.ErrLimitExceeded) {
+		logging.LogRequest(h.Request).WithError(err).Error("deployment exceeds the limits of the VFS")
+		httperrors.Serve502(h.Writer, h.Request)
+		return nil, true
+	}
+
+	if errors.Is(err, vfs.ErrChecksumMismatch) {
+		logging.LogRequest(h.Request).WithError(err).Error("deployment archive does not match its SHA256, the object storage may be corrupted or the archive URL stale")
+		httperrors.Serve502(h.Writer, h.Request)
+		return nil, true
+	}
+
+	if errors.Is(err, vfs.ErrSaturated) {
+		logging.LogRequest(h.Request).WithError(err).Warn("too many requests waiting for the VFS")
+		httperrors.Serve503(h.Writer, h.Request)
+		return nil, true
+	}
+
+	if errors.Is(err, vfs.ErrEgressBudgetExceeded) {
+		logging.LogRequest(h.Request).WithError(err).Info("the deployment is not opened")
+		httperrors.Serve503(h.Writer, h.Request)
+		return nil, true
+	}
+
+	if errors.Is(err, readonly.ErrReadOnly) {
+		logging.LogRequest(h.Request).WithError(err).Info("the deployment is not cached")
+		httperrors.Serve503(h.Writer, h.Request)
 		return nil, true
 	}
 
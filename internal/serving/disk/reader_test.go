@@ -1,10 +1,15 @@
 package disk
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
 )
 
 func Test_redirectPath(t *testing.T) {
@@ -58,6 +63,31 @@ func Test_redirectPath(t *testing.T) {
 	}
 }
 
+func TestServeReadError(t *testing.T) {
+	tests := map[string]struct {
+		err          error
+		expectedCode int
+	}{
+		"saturated": {
+			err:          fmt.Errorf("%w: hot pool", vfs.ErrSaturated),
+			expectedCode: http.StatusServiceUnavailable,
+		},
+		"other": {
+			err:          errors.New("read failed"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			serveReadError(w, newRequest(t, "https://domain.gitlab.io/index.html"), "assets.get", test.err)
+			require.Equal(t, test.expectedCode, w.Code)
+		})
+	}
+}
+
 func newRequest(t *testing.T, url string) *http.Request {
 	t.Helper()
 
@@ -0,0 +1,64 @@
+package disk
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/lru"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/redirects"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	redirectsCacheTTL  = 10 * time.Minute
+	redirectsCacheSize = 1000
+)
+
+// redirectsCache keeps the parsed `_redirects` files of deployments per
+// SHA, so the rules forced with `!` can be checked before serving any file.
+// A nil *redirectsCache is valid and parses the file every time.
+type redirectsCache struct {
+	cache *lru.Cache
+}
+
+func newRedirectsCache() *redirectsCache {
+	return &redirectsCache{
+		cache: lru.New("redirects",
+			lru.WithExpirationInterval(redirectsCacheTTL),
+			lru.WithMaxSize(redirectsCacheSize),
+			lru.WithCachedEntriesMetric(metrics.DiskCachedEntries),
+			lru.WithCachedRequestsMetric(metrics.DiskCacheRequests),
+		),
+	}
+}
+
+// get returns the rules of the deployment with sha
+func (c *redirectsCache) get(ctx context.Context, root vfs.Root, sha string) *redirects.Redirects {
+	// deployments without a SHA cannot be invalidated
+	if c == nil || sha == "" {
+		return redirects.ParseRedirects(ctx, root)
+	}
+
+	rules, err := c.cache.FindOrFetch(sha+":", redirects.ConfigFile, func() (interface{}, error) {
+		rules := redirects.ParseRedirects(ctx, root)
+		if err := ctx.Err(); err != nil {
+			// not cached, the next request reads the file again
+			return nil, err
+		}
+
+		return rules, nil
+	})
+	if err != nil {
+		return &redirects.Redirects{}
+	}
+
+	return rules.(*redirects.Redirects)
+}
+
+func (reader *Reader) redirectsCache() *redirectsCache {
+	reader.mu.RLock()
+	defer reader.mu.RUnlock()
+
+	return reader.redirects
+}
@@ -0,0 +1,55 @@
+package disk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestServeFileHTTPForcedRedirects(t *testing.T) {
+	root := newCountingRoot(t, map[string]string{
+		"_redirects": "/project/old.html /project/new.html 301!\n" +
+			"/project/shadowed.html /project/new.html 302\n",
+		"old.html":      "<p>old</p>",
+		"shadowed.html": "<p>shadowed</p>",
+		"new.html":      "<p>new</p>",
+	})
+
+	s := &Disk{reader: Reader{
+		fileSizeMetric: metrics.DiskServingFileSize,
+		vfs:            rootVFS{root: root},
+		redirects:      newRedirectsCache(),
+	}}
+
+	serve := func(subPath string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "https://group.gitlab-example.com/project/"+subPath, nil)
+
+		require.True(t, s.ServeFileHTTP(serving.Handler{
+			Writer:     w,
+			Request:    r,
+			LookupPath: &serving.LookupPath{Prefix: "/project/", SHA256: "sha1"},
+			SubPath:    subPath,
+		}))
+
+		return w
+	}
+
+	w := serve("old.html")
+	require.Equal(t, http.StatusMovedPermanently, w.Code, "the forced rule shadows the file")
+	require.Equal(t, "/project/new.html", w.Header().Get("Location"))
+
+	w = serve("shadowed.html")
+	require.Equal(t, http.StatusOK, w.Code, "the file takes precedence over the rule")
+	require.Equal(t, "<p>shadowed</p>", w.Body.String())
+
+	opens := root.opens
+
+	serve("old.html")
+	require.Equal(t, opens, root.opens, "the rules are cached per deployment")
+}
@@ -16,10 +16,18 @@ type Disk struct {
 // ServeFileHTTP serves a file from disk and returns true. It returns false
 // when a file could not been found.
 func (s *Disk) ServeFileHTTP(h serving.Handler) bool {
+	if s.reader.tryForcedRedirects(h) {
+		return true
+	}
+
 	if s.reader.tryFile(h) {
 		return true
 	}
 
+	if s.reader.tryAssetManifest(h) {
+		return true
+	}
+
 	if s.reader.tryRedirects(h) {
 		return true
 	}
@@ -27,6 +35,12 @@ func (s *Disk) ServeFileHTTP(h serving.Handler) bool {
 	return false
 }
 
+// ServeRedirectsHTTP applies the `_redirects` rules of the project and
+// returns true if one matched
+func (s *Disk) ServeRedirectsHTTP(h serving.Handler) bool {
+	return s.reader.tryRedirects(h)
+}
+
 // ServeNotFoundHTTP tries to read a custom 404 page
 func (s *Disk) ServeNotFoundHTTP(h serving.Handler) {
 	if s.reader.tryNotFound(h) {
@@ -34,11 +48,26 @@ func (s *Disk) ServeNotFoundHTTP(h serving.Handler) {
 	}
 
 	// Generic 404
-	httperrors.Serve404(h.Writer)
+	httperrors.Serve404(h.Writer, h.Request)
 }
 
-// Reconfigure VFS
+// Reconfigure VFS, the in-memory caches, the asset manifests, the
+// cross-origin isolation headers, the media
+// types and charset of files and the Cache-Control policies
 func (s *Disk) Reconfigure(cfg *config.Config) error {
+	mimeTypes, err := cfg.MIMETypes.Mapping()
+	if err != nil {
+		return err
+	}
+
+	s.reader.setDocumentCache(newDocumentCache(&cfg.HTMLCache))
+	s.reader.setCharsetDetector(newCharsetDetector(&cfg.Charset))
+	s.reader.setAssetCache(newAssetCache(&cfg.AssetCache))
+	s.reader.setManifestCache(newManifestCache(&cfg.AssetManifest))
+	s.reader.setIsolationCache(newIsolationCache(&cfg.Disk))
+	s.reader.setCacheControlPolicy(newCacheControlPolicy(&cfg.CacheControl))
+	s.reader.setMIMETypeMapping(mimeTypes)
+
 	return s.reader.vfs.Reconfigure(cfg)
 }
 
@@ -49,6 +78,7 @@ func New(vfs vfs.VFS) serving.Serving {
 		reader: Reader{
 			fileSizeMetric: metrics.DiskServingFileSize,
 			vfs:            vfs,
+			redirects:      newRedirectsCache(),
 		},
 	}
 }
@@ -1,6 +1,8 @@
 package zip
 
 import (
+	"context"
+
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk"
@@ -8,10 +10,27 @@ import (
 	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs/zip"
 )
 
-var instance = disk.New(vfs.Instrumented(zip.New(&config.ZipServing{})))
+var (
+	archives = zip.New(&config.ZipServing{})
+	zipVFS   = vfs.Instrumented(archives)
+	instance = disk.New(zipVFS)
+)
 
 // Instance returns a serving instance that is capable of reading files
 // from a zip archives opened from a URL, most likely stored in object storage
 func Instance() serving.Serving {
 	return instance
 }
+
+// Prefetch opens the archive at path and keeps it in the cache of the
+// instance, so that the requests for it are not served from a cold cache
+func Prefetch(ctx context.Context, path, sha256 string) error {
+	_, err := zipVFS.Root(ctx, path, sha256)
+
+	return err
+}
+
+// Archives returns the cache of the archives opened by the instance
+func Archives() zip.Cache {
+	return archives.(zip.Cache)
+}
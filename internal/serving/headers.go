@@ -0,0 +1,55 @@
+package serving
+
+import (
+	"net/http"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/responsewriter"
+)
+
+// headersWriter sets the headers of the project on its response once it is
+// written, so that they are not left on the writer when the project does not
+// serve the request. They replace the headers of the same names set by the
+// serving or by the -header flag.
+type headersWriter struct {
+	responsewriter.Wrapper
+	headers     http.Header
+	wroteHeader bool
+}
+
+// newHeadersWriter returns w unchanged when the project has no headers
+func newHeadersWriter(w http.ResponseWriter, lookupPath *LookupPath) http.ResponseWriter {
+	if lookupPath == nil || len(lookupPath.Headers) == 0 {
+		return w
+	}
+
+	return &headersWriter{Wrapper: responsewriter.Wrapper{ResponseWriter: w}, headers: lookupPath.Headers}
+}
+
+func (hw *headersWriter) WriteHeader(status int) {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+
+		for name, values := range hw.headers {
+			hw.Header()[name] = values
+		}
+	}
+
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+func (hw *headersWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+
+	return hw.ResponseWriter.Write(b)
+}
+
+// Flush supports the streamed responses of proxied requests
+func (hw *headersWriter) Flush() {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+
+	hw.Wrapper.Flush()
+}
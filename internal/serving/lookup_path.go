@@ -1,5 +1,7 @@
 package serving
 
+import "net/http"
+
 // LookupPath holds a domain project configuration needed to handle a request
 type LookupPath struct {
 	ServingType        string // Serving type being used, like `zip`
@@ -10,4 +12,7 @@ type LookupPath struct {
 	IsHTTPSOnly        bool
 	HasAccessControl   bool
 	ProjectID          uint64
+	SSOGroupID         uint64      // SSOGroupID is the group enforcing its SSO on the visitors of the project, if any
+	SSOSignInURL       string      // SSOSignInURL is the SSO page of that group
+	Headers            http.Header // Headers are set on the responses of the project
 }
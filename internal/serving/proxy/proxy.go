@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+)
+
+var instance = New()
+
+// sessionCookie is the name of the session cookie of the access control
+const sessionCookie = "gitlab-pages"
+
+// Proxy forwards the requests of a lookup path to the upstream URL held in
+// its path, such as a preview backend. Responses are streamed as they
+// arrive, so server-sent events work, and connection upgrades such as
+// websockets are supported. Only upstreams whose host is allowed are
+// proxied, so GitLab cannot be used to reach arbitrary internal services, and
+// the session cookie of Pages is never forwarded to them.
+type Proxy struct {
+	// the transport is not metered, metered round trippers wrap response
+	// bodies which would break connection upgrades
+	transport http.RoundTripper
+
+	mu           sync.RWMutex
+	allowedHosts map[string]bool
+	idleTimeout  time.Duration
+	maxBytes     int64
+}
+
+// New returns a proxy that does not allow any upstream until it has been
+// reconfigured
+func New() *Proxy {
+	return &Proxy{transport: httptransport.NewTransport()}
+}
+
+// Instance returns the proxy serving instance
+func Instance() serving.Serving {
+	return instance
+}
+
+// ServeFileHTTP proxies the request to the upstream, it always returns true
+func (p *Proxy) ServeFileHTTP(h serving.Handler) bool {
+	upstream, err := p.upstream(h.LookupPath.Path)
+	if err != nil {
+		logging.LogRequest(h.Request).WithError(err).Error("refusing to proxy the request")
+		httperrors.Serve502(h.Writer, h.Request)
+		return true
+	}
+
+	subPath := h.SubPath
+	if strings.HasSuffix(h.Request.URL.Path, "/") && !strings.HasSuffix(subPath, "/") {
+		// the sub path is cleaned, the trailing slash matters to most backends
+		subPath += "/"
+	}
+
+	target := &url.URL{
+		Scheme: upstream.Scheme,
+		Host:   upstream.Host,
+		Path:   strings.TrimSuffix(upstream.Path, "/") + "/" + strings.TrimPrefix(subPath, "/"),
+	}
+
+	p.forward(h.Writer, h.Request, target, nil)
+
+	return true
+}
+
+// ServeRewrite proxies the request to target, the upstream URL of a rewrite
+// of `_redirects` whose host has been allowed by the redirects package
+func ServeRewrite(w http.ResponseWriter, r *http.Request, target *url.URL) {
+	instance.forward(w, r, target, nil)
+}
+
+// ServeUpgrade proxies a request for a connection upgrade, such as a
+// websocket, to target with header set on the upstream request. The upgraded
+// connection has the limits of the proxy lookups.
+func ServeUpgrade(w http.ResponseWriter, r *http.Request, target *url.URL, header http.Header) {
+	instance.forward(w, r, target, header)
+}
+
+// IsUpgrade returns whether r asks for a connection upgrade
+func IsUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Stream closes body once it has been idle or transferred more bytes than
+// the limits of the proxy lookups allow, so that responses streamed from
+// other upstreams are bounded the same way
+func Stream(body io.ReadCloser) io.ReadCloser {
+	idleTimeout, maxBytes := instance.limits()
+
+	return newStream(body, idleTimeout, maxBytes)
+}
+
+func (p *Proxy) limits() (time.Duration, int64) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.idleTimeout, p.maxBytes
+}
+
+// forward proxies the request to target, keeping the query of the request
+// unless target has one, with header set on the upstream request
+func (p *Proxy) forward(w http.ResponseWriter, req *http.Request, target *url.URL, header http.Header) {
+	idleTimeout, maxBytes := p.limits()
+
+	if maxBytes > 0 && req.Body != nil {
+		req.Body = http.MaxBytesReader(w, req.Body, maxBytes)
+	}
+
+	reverseProxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = target.Scheme
+			r.URL.Host = target.Host
+			r.URL.Path = target.Path
+			r.URL.RawPath = target.RawPath
+			if target.RawQuery != "" {
+				r.URL.RawQuery = target.RawQuery
+			}
+			r.Host = target.Host
+
+			removeCookie(r.Header, sessionCookie)
+			for name, values := range header {
+				r.Header[name] = values
+			}
+		},
+		Transport: p.transport,
+		// flush every write so events reach clients as they are sent
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			s := newStream(resp.Body, idleTimeout, maxBytes)
+
+			if backend, ok := resp.Body.(io.Writer); ok && resp.StatusCode == http.StatusSwitchingProtocols {
+				resp.Body = &upgradedStream{stream: s, w: backend}
+				return nil
+			}
+
+			resp.Body = s
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if httperrors.IsClientAborted(r, err) {
+				httperrors.ServeClientAborted(w, r, "proxy", err)
+				return
+			}
+
+			logging.LogRequest(r).WithError(err).WithField("upstream_host", target.Host).Error("failed to proxy the request")
+			httperrors.Serve502(w, r)
+		},
+	}
+
+	reverseProxy.ServeHTTP(w, req)
+}
+
+// ServeNotFoundHTTP serves the generic 404 page, not found responses of the
+// upstream are proxied as they are
+func (p *Proxy) ServeNotFoundHTTP(h serving.Handler) {
+	httperrors.Serve404(h.Writer, h.Request)
+}
+
+// Reconfigure sets the allowed upstream hosts and the limits of streams
+func (p *Proxy) Reconfigure(cfg *config.Config) error {
+	allowedHosts := make(map[string]bool, len(cfg.Proxy.AllowedHosts))
+	for _, host := range cfg.Proxy.AllowedHosts {
+		allowedHosts[strings.ToLower(host)] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.allowedHosts = allowedHosts
+	p.idleTimeout = cfg.Proxy.IdleTimeout
+	p.maxBytes = cfg.Proxy.MaxBytes
+
+	return nil
+}
+
+func (p *Proxy) upstream(rawURL string) (*url.URL, error) {
+	upstream, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if upstream.Scheme != "http" && upstream.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported upstream scheme %q", upstream.Scheme)
+	}
+
+	p.mu.RLock()
+	allowed := p.allowedHosts[strings.ToLower(upstream.Hostname())]
+	p.mu.RUnlock()
+
+	if !allowed {
+		return nil, fmt.Errorf("upstream host %q is not allowed", upstream.Hostname())
+	}
+
+	return upstream, nil
+}
+
+// removeCookie removes the cookie called name from the Cookie header
+func removeCookie(header http.Header, name string) {
+	r := http.Request{Header: header}
+
+	var kept []string
+	for _, cookie := range r.Cookies() {
+		if cookie.Name != name {
+			kept = append(kept, cookie.String())
+		}
+	}
+
+	header.Del("Cookie")
+	if len(kept) > 0 {
+		header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
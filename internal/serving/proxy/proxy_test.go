@@ -0,0 +1,323 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+)
+
+// newPagesServer proxies every request under /project/ to upstream
+func newPagesServer(t *testing.T, upstream string, cfg config.Proxy) *httptest.Server {
+	t.Helper()
+
+	p := New()
+	require.NoError(t, p.Reconfigure(&config.Config{Proxy: cfg}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ServeFileHTTP(serving.Handler{
+			Writer:     w,
+			Request:    r,
+			LookupPath: &serving.LookupPath{ServingType: "proxy", Prefix: "/project/", Path: upstream},
+			SubPath:    strings.TrimPrefix(r.URL.Path, "/project/"),
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func allowed(t *testing.T, upstream string) []string {
+	t.Helper()
+
+	u, err := url.Parse(upstream)
+	require.NoError(t, err)
+
+	return []string{u.Hostname()}
+}
+
+func TestServeFileHTTP(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s cookie=%q", r.Method, r.URL.Path, r.Header.Get("Cookie"))
+	}))
+	defer upstream.Close()
+
+	tests := map[string]struct {
+		allowedHosts   []string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		"allowed_upstream": {
+			allowedHosts:   allowed(t, upstream.URL),
+			path:           "/project/api/items",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `GET /preview/api/items cookie="theme=dark"`,
+		},
+		"trailing_slash": {
+			allowedHosts:   allowed(t, upstream.URL),
+			path:           "/project/api/",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `GET /preview/api/ cookie="theme=dark"`,
+		},
+		"upstream_not_allowed": {
+			path:           "/project/api/items",
+			expectedStatus: http.StatusBadGateway,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newPagesServer(t, upstream.URL+"/preview", config.Proxy{
+				AllowedHosts: tt.allowedHosts,
+				IdleTimeout:  time.Minute,
+			})
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Cookie", "gitlab-pages=session; theme=dark")
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			if tt.expectedBody != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedBody, string(body), "the session cookie is not forwarded")
+			}
+		})
+	}
+}
+
+func TestServeFileHTTPClientAborted(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	p := New()
+	require.NoError(t, p.Reconfigure(&config.Config{Proxy: config.Proxy{
+		AllowedHosts: allowed(t, upstream.URL),
+		IdleTimeout:  time.Minute,
+	}}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	p.ServeFileHTTP(serving.Handler{
+		Writer:     w,
+		Request:    httptest.NewRequest(http.MethodGet, "/project/api/items", nil).WithContext(ctx),
+		LookupPath: &serving.LookupPath{ServingType: "proxy", Prefix: "/project/", Path: upstream.URL},
+		SubPath:    "api/items",
+	})
+
+	require.Equal(t, httperrors.StatusClientClosedRequest, w.Code)
+}
+
+func TestServeFileHTTPStreamsEvents(t *testing.T) {
+	next := make(chan struct{})
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for i := 0; i < 2; i++ {
+			fmt.Fprintf(w, "data: event %d\n\n", i)
+			w.(http.Flusher).Flush()
+			<-next
+		}
+	}))
+	defer upstream.Close()
+	defer close(next)
+
+	server := newPagesServer(t, upstream.URL, config.Proxy{
+		AllowedHosts: allowed(t, upstream.URL),
+		IdleTimeout:  time.Minute,
+	})
+
+	resp, err := http.Get(server.URL + "/project/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	for i := 0; i < 2; i++ {
+		// each event is received before the upstream sends the next one
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("data: event %d\n", i), line)
+
+		_, err = reader.ReadString('\n')
+		require.NoError(t, err)
+
+		next <- struct{}{}
+	}
+}
+
+func TestServeFileHTTPUpgradesConnections(t *testing.T) {
+	// the upstream echoes lines over the upgraded connection
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "echo", r.Header.Get("Upgrade"))
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			rw.WriteString(line)
+			rw.Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	dial := func(t *testing.T, server *httptest.Server) (net.Conn, *bufio.Reader) {
+		t.Helper()
+
+		conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		fmt.Fprint(conn, "GET /project/socket HTTP/1.1\r\nHost: pages\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+		return conn, reader
+	}
+
+	t.Run("echo", func(t *testing.T) {
+		server := newPagesServer(t, upstream.URL, config.Proxy{
+			AllowedHosts: allowed(t, upstream.URL),
+			IdleTimeout:  time.Minute,
+		})
+
+		conn, reader := dial(t, server)
+
+		for _, message := range []string{"hello\n", "world\n"} {
+			_, err := conn.Write([]byte(message))
+			require.NoError(t, err)
+
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			require.Equal(t, message, line)
+		}
+	})
+
+	t.Run("idle_timeout", func(t *testing.T) {
+		server := newPagesServer(t, upstream.URL, config.Proxy{
+			AllowedHosts: allowed(t, upstream.URL),
+			IdleTimeout:  50 * time.Millisecond,
+		})
+
+		conn, reader := dial(t, server)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+		_, err := reader.ReadString('\n')
+		require.ErrorIs(t, err, io.EOF, "the idle connection is closed")
+	})
+
+	t.Run("max_bytes", func(t *testing.T) {
+		server := newPagesServer(t, upstream.URL, config.Proxy{
+			AllowedHosts: allowed(t, upstream.URL),
+			IdleTimeout:  time.Minute,
+			MaxBytes:     16,
+		})
+
+		conn, reader := dial(t, server)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+		_, err := conn.Write([]byte("short\n"))
+		require.NoError(t, err)
+
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "short\n", line)
+
+		_, err = conn.Write([]byte("this message exceeds the limit\n"))
+		require.NoError(t, err)
+
+		_, err = reader.ReadString('\n')
+		require.ErrorIs(t, err, io.EOF, "the connection is closed above the limit")
+	})
+}
+
+func TestServeRewrite(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s?%s cookie=%q", r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Cookie"))
+	}))
+	defer upstream.Close()
+
+	require.NoError(t, instance.Reconfigure(&config.Config{Proxy: config.Proxy{IdleTimeout: time.Minute}}))
+
+	tests := map[string]struct {
+		target       string
+		expectedBody string
+	}{
+		"request_query": {
+			target:       upstream.URL + "/v1/items",
+			expectedBody: `GET /v1/items?page=2 cookie="theme=dark"`,
+		},
+		"target_query": {
+			target:       upstream.URL + "/search?q=pages",
+			expectedBody: `GET /search?q=pages cookie="theme=dark"`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			target, err := url.Parse(tt.target)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodGet, "http://group.gitlab-example.com/project/api/items?page=2", nil)
+			r.Header.Set("Cookie", "gitlab-pages=session; theme=dark")
+
+			w := httptest.NewRecorder()
+			ServeRewrite(w, r, target)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, tt.expectedBody, w.Body.String(), "the session cookie is not forwarded")
+		})
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	tests := map[string]struct {
+		header   http.Header
+		expected bool
+	}{
+		"websocket":        {header: http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}}, expected: true},
+		"connection_list":  {header: http.Header{"Connection": {"keep-alive, upgrade"}, "Upgrade": {"websocket"}}, expected: true},
+		"no_upgrade":       {header: http.Header{"Connection": {"Upgrade"}}},
+		"no_connection":    {header: http.Header{"Upgrade": {"websocket"}}},
+		"plain_keep_alive": {header: http.Header{"Connection": {"keep-alive"}}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.expected, IsUpgrade(&http.Request{Header: tt.header}))
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errMaxBytes = errors.New("proxied stream exceeds the maximum number of bytes")
+
+// stream closes a proxied response body once it has been idle for longer
+// than idleTimeout or once more than maxBytes have been transferred, an
+// idleTimeout or a maxBytes of 0 means unlimited
+type stream struct {
+	io.ReadCloser
+
+	idleTimeout time.Duration
+	maxBytes    int64
+
+	// accessed atomically, an upgraded connection is read and written
+	// concurrently
+	bytes      int64
+	lastActive int64
+
+	// the timer fires on its own goroutine, possibly before newStream returns
+	mu        sync.Mutex
+	timer     *time.Timer
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newStream(body io.ReadCloser, idleTimeout time.Duration, maxBytes int64) *stream {
+	s := &stream{
+		ReadCloser:  body,
+		idleTimeout: idleTimeout,
+		maxBytes:    maxBytes,
+		lastActive:  time.Now().UnixNano(),
+	}
+
+	if idleTimeout > 0 {
+		s.mu.Lock()
+		s.timer = time.AfterFunc(idleTimeout, s.checkIdle)
+		s.mu.Unlock()
+	}
+
+	return s
+}
+
+// checkIdle closes the stream or waits for the remaining idle time
+func (s *stream) checkIdle() {
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&s.lastActive)))
+	if idle >= s.idleTimeout {
+		s.Close()
+		return
+	}
+
+	s.mu.Lock()
+	s.timer.Reset(s.idleTimeout - idle)
+	s.mu.Unlock()
+}
+
+// transferred records n bytes of activity, it returns errMaxBytes and closes
+// the stream once the limit is exceeded
+func (s *stream) transferred(n int) error {
+	atomic.StoreInt64(&s.lastActive, time.Now().UnixNano())
+
+	total := atomic.AddInt64(&s.bytes, int64(n))
+	if s.maxBytes > 0 && total > s.maxBytes {
+		s.Close()
+		return errMaxBytes
+	}
+
+	return nil
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	if limitErr := s.transferred(n); limitErr != nil {
+		return n, limitErr
+	}
+
+	return n, err
+}
+
+func (s *stream) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		s.mu.Unlock()
+
+		s.closeErr = s.ReadCloser.Close()
+	})
+
+	return s.closeErr
+}
+
+// upgradedStream is the backend side of an upgraded connection, such as a
+// websocket, whose limits cover the bytes sent in both directions
+type upgradedStream struct {
+	*stream
+	w io.Writer
+}
+
+func (s *upgradedStream) Write(p []byte) (int, error) {
+	if err := s.transferred(len(p)); err != nil {
+		return 0, err
+	}
+
+	return s.w.Write(p)
+}
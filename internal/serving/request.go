@@ -13,7 +13,7 @@ type Request struct {
 // ServeFileHTTP forwards serving request handler to the serving itself
 func (s *Request) ServeFileHTTP(w http.ResponseWriter, r *http.Request) bool {
 	handler := Handler{
-		Writer:     w,
+		Writer:     newHeadersWriter(w, s.LookupPath),
 		Request:    r,
 		LookupPath: s.LookupPath,
 		SubPath:    s.SubPath,
@@ -25,7 +25,7 @@ func (s *Request) ServeFileHTTP(w http.ResponseWriter, r *http.Request) bool {
 // ServeNotFoundHTTP forwards serving request handler to the serving itself
 func (s *Request) ServeNotFoundHTTP(w http.ResponseWriter, r *http.Request) {
 	handler := Handler{
-		Writer:     w,
+		Writer:     newHeadersWriter(w, s.LookupPath),
 		Request:    r,
 		LookupPath: s.LookupPath,
 		SubPath:    s.SubPath,
@@ -33,3 +33,21 @@ func (s *Request) ServeNotFoundHTTP(w http.ResponseWriter, r *http.Request) {
 
 	s.Serving.ServeNotFoundHTTP(handler)
 }
+
+// ServeRedirectsHTTP applies the `_redirects` rules of the project, it
+// returns false if none matches or the serving does not support them
+func (s *Request) ServeRedirectsHTTP(w http.ResponseWriter, r *http.Request) bool {
+	redirectsServing, ok := s.Serving.(RedirectsServing)
+	if !ok {
+		return false
+	}
+
+	handler := Handler{
+		Writer:     newHeadersWriter(w, s.LookupPath),
+		Request:    r,
+		LookupPath: s.LookupPath,
+		SubPath:    s.SubPath,
+	}
+
+	return redirectsServing.ServeRedirectsHTTP(handler)
+}
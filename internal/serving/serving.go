@@ -8,3 +8,9 @@ type Serving interface {
 	ServeNotFoundHTTP(Handler)
 	Reconfigure(config *config.Config) error
 }
+
+// RedirectsServing is implemented by the servings whose projects may have
+// `_redirects` rules
+type RedirectsServing interface {
+	ServeRedirectsHTTP(Handler) bool
+}
@@ -0,0 +1,67 @@
+package unpublished
+
+import (
+	"net/http"
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+)
+
+var instance = &Unpublished{}
+
+// Unpublished serves a placeholder for deployments that are not yet
+// published or have been retired
+type Unpublished struct {
+	mu   sync.RWMutex
+	page []byte
+}
+
+// Instance returns a serving instance that serves the configured
+// placeholder page for every request
+func Instance() serving.Serving {
+	return instance
+}
+
+// ServeFileHTTP serves the placeholder page, it always returns true
+func (u *Unpublished) ServeFileHTTP(h serving.Handler) bool {
+	u.serve(h)
+
+	return true
+}
+
+// ServeNotFoundHTTP serves the placeholder page
+func (u *Unpublished) ServeNotFoundHTTP(h serving.Handler) {
+	u.serve(h)
+}
+
+// Reconfigure sets the placeholder page, the generic 404 page is served when
+// none is configured
+func (u *Unpublished) Reconfigure(cfg *config.Config) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.page = cfg.General.UnpublishedPage
+
+	return nil
+}
+
+func (u *Unpublished) serve(h serving.Handler) {
+	u.mu.RLock()
+	page := u.page
+	u.mu.RUnlock()
+
+	// the placeholder must not outlive the publication window in caches
+	h.Writer.Header().Set("Cache-Control", "no-store")
+
+	if len(page) == 0 {
+		httperrors.Serve404(h.Writer, h.Request)
+		return
+	}
+
+	h.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	h.Writer.Header().Set("X-Content-Type-Options", "nosniff")
+	h.Writer.WriteHeader(http.StatusNotFound)
+	h.Writer.Write(page)
+}
@@ -0,0 +1,281 @@
+// Package share verifies the share links of private projects. A share link
+// lets a visitor without a GitLab account view a project with access control
+// enabled, to share a preview with external stakeholders.
+//
+// The link holds a JWT signed with a key derived from the secret of the
+// authentication, which is never shared with GitLab, so that the links handed
+// to external visitors are not valid for the GitLab API. GitLab mints links
+// for the project members it authorized with the Handler, authorized by a JWT
+// signed with the secret shared with GitLab.
+package share
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/securecookie"
+	"golang.org/x/crypto/hkdf"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/jwtauth"
+)
+
+// QueryParam is the query parameter holding the token of a share link, named
+// so that it is masked in the logs
+const QueryParam = "pages_share_token"
+
+const (
+	audience = "gitlab-pages-share"
+	issuer   = "gitlab-pages-share"
+
+	// mintAudience is the audience of the tokens authorizing the Handler,
+	// which expire within mintMaxLifetime
+	mintAudience    = "gitlab-pages-share-admin"
+	mintMaxLifetime = 5 * time.Minute
+
+	maxBodySize = 64 * 1024
+)
+
+var (
+	errInvalidToken = errors.New("the share link is not valid for this project")
+	errRedeemed     = errors.New("the one-time share link was already used")
+	errInvalidLink  = errors.New("the link must have an http(s) url, a project_id and an expires_in within the maximum lifetime")
+)
+
+// Claims of the token of a share link
+type Claims struct {
+	jwt.RegisteredClaims
+	Host      string `json:"host"`
+	ProjectID uint64 `json:"project_id"`
+	// OneTime links are only redeemed once
+	OneTime bool `json:"one_time,omitempty"`
+}
+
+// LinkKey returns the key signing the share links, derived from the secret
+// of the authentication
+func LinkKey(authSecret string) ([]byte, error) {
+	key := make([]byte, 32)
+	hkdfReader := hkdf.New(sha256.New, []byte(authSecret), []byte{}, []byte("PAGES_SHARE_LINK_KEY"))
+	if _, err := io.ReadFull(hkdfReader, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Redemptions remember the one-time tokens redeemed until they expire
+type Redemptions interface {
+	// Redeem returns whether the one-time token id was not redeemed yet,
+	// and remembers it until expiry
+	Redeem(ctx context.Context, id string, expiry time.Time) (bool, error)
+}
+
+// Verifier verifies the tokens of share links and remembers the one-time
+// tokens redeemed until they expire
+type Verifier struct {
+	verifier    *jwtauth.Verifier
+	redemptions Redemptions
+}
+
+// NewVerifier returns a Verifier of the tokens signed with key that expire
+// within maxLifetime. The one-time tokens are redeemed in the memory of the
+// process, once per Pages instance, unless UseRedemptions shares them.
+func NewVerifier(key []byte, maxLifetime time.Duration) *Verifier {
+	return &Verifier{
+		verifier:    jwtauth.NewVerifier(key, audience, maxLifetime),
+		redemptions: newMemoryRedemptions(),
+	}
+}
+
+// UseRedemptions remembers the one-time tokens redeemed in redemptions, such
+// as a store shared by all Pages instances
+func (v *Verifier) UseRedemptions(redemptions Redemptions) {
+	v.redemptions = redemptions
+}
+
+// Verify returns the claims of token when it grants access to the project at
+// host. A one-time token is redeemed by its first verification.
+func (v *Verifier) Verify(ctx context.Context, token, host string, projectID uint64) (*Claims, error) {
+	claims := &Claims{}
+	if err := v.verifier.Verify(token, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != issuer || projectID == 0 ||
+		claims.ProjectID != projectID || !strings.EqualFold(claims.Host, host) {
+		return nil, errInvalidToken
+	}
+
+	if claims.OneTime {
+		if claims.ID == "" {
+			return nil, errInvalidToken
+		}
+
+		redeemed, err := v.redemptions.Redeem(ctx, claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			return nil, err
+		} else if !redeemed {
+			return nil, errRedeemed
+		}
+	}
+
+	return claims, nil
+}
+
+// memoryRedemptions remember the one-time tokens redeemed by this process
+type memoryRedemptions struct {
+	mu       sync.Mutex
+	redeemed map[string]time.Time
+	now      func() time.Time
+}
+
+func newMemoryRedemptions() *memoryRedemptions {
+	return &memoryRedemptions{
+		redeemed: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Redeem returns whether the one-time token id was not redeemed yet
+func (m *memoryRedemptions) Redeem(_ context.Context, id string, expiry time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for redeemedID, redeemedExpiry := range m.redeemed {
+		if now.After(redeemedExpiry) {
+			delete(m.redeemed, redeemedID)
+		}
+	}
+
+	if _, ok := m.redeemed[id]; ok {
+		return false, nil
+	}
+
+	m.redeemed[id] = expiry
+
+	return true, nil
+}
+
+// Mint returns the token of a share link of the project at host, signed with
+// key
+func Mint(key []byte, host string, projectID uint64, expiresAt time.Time, oneTime bool) (string, error) {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        base64.RawURLEncoding.EncodeToString(securecookie.GenerateRandomKey(16)),
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Host:      strings.ToLower(host),
+		ProjectID: projectID,
+		OneTime:   oneTime,
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// Link is a request to mint a share link
+type Link struct {
+	// URL of the project the link is for
+	URL       string `json:"url"`
+	ProjectID uint64 `json:"project_id"`
+	// ExpiresIn is the lifetime of the link in seconds
+	ExpiresIn int64 `json:"expires_in"`
+	OneTime   bool  `json:"one_time"`
+}
+
+type mintedLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Handler mints share links. The requests are authorized by a JWT signed
+// with the secret shared with GitLab, like the cache admin requests.
+type Handler struct {
+	verifier    *jwtauth.Verifier
+	key         []byte
+	maxLifetime time.Duration
+}
+
+// NewHandler returns a Handler of the requests authorized by a token signed
+// with secret, minting links signed with key that expire within maxLifetime
+func NewHandler(secret, key []byte, maxLifetime time.Duration) *Handler {
+	return &Handler{
+		verifier:    jwtauth.NewVerifier(secret, mintAudience, mintMaxLifetime),
+		key:         key,
+		maxLifetime: maxLifetime,
+	}
+}
+
+// ServeHTTP mints the share link of an authorized Link request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.verifier.Verify(jwtauth.BearerToken(r), &jwt.RegisteredClaims{}); err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gitlab-pages"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(body) > maxBodySize {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	link, u, err := h.parseLink(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(link.ExpiresIn) * time.Second).Truncate(time.Second)
+
+	token, err := Mint(h.key, u.Hostname(), link.ProjectID, expiresAt, link.OneTime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := u.Query()
+	query.Set(QueryParam, token)
+	u.RawQuery = query.Encode()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mintedLink{URL: u.String(), ExpiresAt: expiresAt.UTC()})
+}
+
+func (h *Handler) parseLink(body []byte) (*Link, *url.URL, error) {
+	var link Link
+	if err := json.Unmarshal(body, &link); err != nil {
+		return nil, nil, err
+	}
+
+	u, err := url.Parse(link.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" ||
+		link.ProjectID == 0 || link.ExpiresIn <= 0 || link.ExpiresIn > int64(h.maxLifetime/time.Second) {
+		return nil, nil, errInvalidLink
+	}
+
+	return &link, u, nil
+}
@@ -0,0 +1,229 @@
+package share
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/labkit/mask"
+)
+
+var (
+	secret = []byte("0123456789abcdef0123456789abcdef")
+	key    = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestLinkKey(t *testing.T) {
+	linkKey, err := LinkKey("auth-secret")
+	require.NoError(t, err)
+	require.Len(t, linkKey, 32)
+
+	other, err := LinkKey("other-auth-secret")
+	require.NoError(t, err)
+	require.NotEqual(t, linkKey, other)
+}
+
+func TestVerify(t *testing.T) {
+	valid, err := Mint(key, "Group.Example.io", 1, time.Now().Add(time.Minute), false)
+	require.NoError(t, err)
+
+	tooLong, err := Mint(key, "group.example.io", 1, time.Now().Add(2*time.Hour), false)
+	require.NoError(t, err)
+
+	expired, err := Mint(key, "group.example.io", 1, time.Now().Add(-time.Minute), false)
+	require.NoError(t, err)
+
+	// the secret shared with GitLab does not sign share links
+	otherSecret, err := Mint(secret, "group.example.io", 1, time.Now().Add(time.Minute), false)
+	require.NoError(t, err)
+
+	// a token of another issuer is not a share link
+	otherIssuer, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "gitlab-pages",
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Host:      "group.example.io",
+		ProjectID: 1,
+	}).SignedString(key)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		token     string
+		host      string
+		projectID uint64
+		valid     bool
+	}{
+		"valid":           {token: valid, host: "group.example.io", projectID: 1, valid: true},
+		"other_host":      {token: valid, host: "other.example.io", projectID: 1},
+		"other_project":   {token: valid, host: "group.example.io", projectID: 2},
+		"no_project":      {token: valid, host: "group.example.io", projectID: 0},
+		"too_long":        {token: tooLong, host: "group.example.io", projectID: 1},
+		"expired":         {token: expired, host: "group.example.io", projectID: 1},
+		"other_secret":    {token: otherSecret, host: "group.example.io", projectID: 1},
+		"other_issuer":    {token: otherIssuer, host: "group.example.io", projectID: 1},
+		"malformed_token": {token: "token", host: "group.example.io", projectID: 1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims, err := NewVerifier(key, time.Hour).Verify(context.Background(), tt.token, tt.host, tt.projectID)
+			if !tt.valid {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, uint64(1), claims.ProjectID)
+		})
+	}
+}
+
+func TestVerifyOneTime(t *testing.T) {
+	verifier := NewVerifier(key, time.Hour)
+
+	token, err := Mint(key, "group.example.io", 1, time.Now().Add(time.Minute), true)
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(context.Background(), token, "group.example.io", 1)
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(context.Background(), token, "group.example.io", 1)
+	require.ErrorIs(t, err, errRedeemed)
+
+	// redeemed tokens are forgotten once expired
+	redemptions := verifier.redemptions.(*memoryRedemptions)
+	redemptions.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+
+	other, err := Mint(key, "group.example.io", 1, time.Now().Add(3*time.Minute), true)
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(context.Background(), other, "group.example.io", 1)
+	require.NoError(t, err)
+	require.Len(t, redemptions.redeemed, 1)
+}
+
+func TestVerifyOneTimeSharedRedemptions(t *testing.T) {
+	redemptions := newMemoryRedemptions()
+
+	first := NewVerifier(key, time.Hour)
+	first.UseRedemptions(redemptions)
+
+	second := NewVerifier(key, time.Hour)
+	second.UseRedemptions(redemptions)
+
+	token, err := Mint(key, "group.example.io", 1, time.Now().Add(time.Minute), true)
+	require.NoError(t, err)
+
+	_, err = first.Verify(context.Background(), token, "group.example.io", 1)
+	require.NoError(t, err)
+
+	_, err = second.Verify(context.Background(), token, "group.example.io", 1)
+	require.ErrorIs(t, err, errRedeemed)
+}
+
+func mintToken(t *testing.T, audience string) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}).SignedString(secret)
+	require.NoError(t, err)
+
+	return token
+}
+
+func TestHandler(t *testing.T) {
+	handler := NewHandler(secret, key, time.Hour)
+
+	tests := map[string]struct {
+		link           Link
+		token          string
+		expectedStatus int
+	}{
+		"minted": {
+			link:           Link{URL: "https://group.example.io/project/?a=b", ProjectID: 1, ExpiresIn: 60, OneTime: true},
+			token:          mintToken(t, mintAudience),
+			expectedStatus: http.StatusOK,
+		},
+		"unauthorized": {
+			link:           Link{URL: "https://group.example.io/project/", ProjectID: 1, ExpiresIn: 60},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"other_audience": {
+			link:           Link{URL: "https://group.example.io/project/", ProjectID: 1, ExpiresIn: 60},
+			token:          mintToken(t, audience),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"no_project": {
+			link:           Link{URL: "https://group.example.io/project/", ExpiresIn: 60},
+			token:          mintToken(t, mintAudience),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"too_long": {
+			link:           Link{URL: "https://group.example.io/project/", ProjectID: 1, ExpiresIn: 7200},
+			token:          mintToken(t, mintAudience),
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid_url": {
+			link:           Link{URL: "ftp://group.example.io/project/", ProjectID: 1, ExpiresIn: 60},
+			token:          mintToken(t, mintAudience),
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(tt.link)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodPost, "/-/shares", bytes.NewReader(body))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var minted mintedLink
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &minted))
+			require.WithinDuration(t, time.Now().Add(time.Minute), minted.ExpiresAt, 2*time.Second)
+
+			u, err := url.Parse(minted.URL)
+			require.NoError(t, err)
+			require.Equal(t, "b", u.Query().Get("a"))
+
+			claims, err := NewVerifier(key, time.Hour).Verify(context.Background(), u.Query().Get(QueryParam), "group.example.io", 1)
+			require.NoError(t, err)
+			require.True(t, claims.OneTime)
+		})
+	}
+}
+
+func TestHandlerRejectsOtherMethods(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHandler(secret, key, time.Hour).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/shares", nil))
+
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestQueryParamIsMasked(t *testing.T) {
+	masked := mask.URL("https://group.example.io/project/?" + QueryParam + "=secret-token")
+
+	require.NotContains(t, masked, "secret-token")
+}
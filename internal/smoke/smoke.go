@@ -0,0 +1,350 @@
+// Package smoke runs a scripted set of requests against a running Pages
+// daemon and reports which of them behaved as expected. It is meant to be
+// used as a post-deploy gate in deployment pipelines.
+package smoke
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/namsral/flag"
+)
+
+// CommandName is the name of the subcommand running the smoke test
+const CommandName = "smoke"
+
+var (
+	errNoHost    = errors.New("host must be defined")
+	errNoAddress = errors.New("at least one of http or https must be defined")
+	errNoPath    = errors.New("path must start with /")
+)
+
+// Options configure a smoke test
+type Options struct {
+	// Host is the Pages domain requested
+	Host string
+	// Path is a page of the domain expected to be served, it should end with
+	// a slash to test the redirect of directories
+	Path string
+	// HTTP and HTTPS are the base URLs of the listeners of the daemon, such
+	// as http://127.0.0.1:8090. A check is skipped when its listener is empty.
+	HTTP  string
+	HTTPS string
+	// Insecure skips the verification of the certificate served over HTTPS
+	Insecure bool
+	// Headers are the custom headers expected in the response, as `Name: value`
+	Headers []string
+	// Timeout of every request
+	Timeout time.Duration
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Name    string
+	Passed  bool
+	Skipped bool
+	Message string
+}
+
+// Report lists the outcome of every check
+type Report struct {
+	Results []Result
+}
+
+// Failed returns the number of checks that did not pass
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if !result.Passed && !result.Skipped {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// Write prints a line per check followed by a summary
+func (r *Report) Write(w io.Writer) {
+	passed, skipped := 0, 0
+
+	for _, result := range r.Results {
+		status := "FAIL"
+		switch {
+		case result.Skipped:
+			status = "SKIP"
+			skipped++
+		case result.Passed:
+			status = "PASS"
+			passed++
+		}
+
+		fmt.Fprintf(w, "%s %-8s %s\n", status, result.Name, result.Message)
+	}
+
+	fmt.Fprintf(w, "%d passed, %d failed, %d skipped\n", passed, r.Failed(), skipped)
+}
+
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+// Main parses the subcommand arguments, runs the smoke test and prints its
+// report. It returns the process exit code.
+func Main(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(CommandName, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var headers headerFlags
+
+	opts := Options{}
+	flags.StringVar(&opts.Host, "host", "", "The Pages domain to test, for example group.example.io")
+	flags.StringVar(&opts.Path, "path", "/", "A page of the domain expected to be served, ending with / to test the redirect of directories")
+	flags.StringVar(&opts.HTTP, "http", "http://127.0.0.1:80", "Base URL of the HTTP listener of the daemon, empty to skip the HTTP checks")
+	flags.StringVar(&opts.HTTPS, "https", "", "Base URL of the HTTPS listener of the daemon, empty to skip the HTTPS checks")
+	flags.BoolVar(&opts.Insecure, "insecure", false, "Do not verify the certificate served over HTTPS")
+	flags.Var(&headers, "header", "A custom header expected in the response as `Name: value`, can be repeated")
+	flags.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "Timeout of every request")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	opts.Headers = headers
+
+	report, err := Run(opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", CommandName, err)
+		return 2
+	}
+
+	report.Write(stdout)
+
+	if report.Failed() > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// Run performs the checks described by opts against the daemon
+func Run(opts Options) (*Report, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	c := &checker{opts: opts, client: newClient(opts)}
+	report := &Report{}
+
+	// the headers are checked on the secure response if there is one
+	base := opts.HTTPS
+	if base == "" {
+		base = opts.HTTP
+	}
+
+	report.Results = append(report.Results,
+		c.checkPage("http", opts.HTTP),
+		c.checkPage("https", opts.HTTPS),
+		c.checkRedirect(base),
+		c.checkNotFound(base),
+		c.checkHeaders(base),
+	)
+
+	return report, nil
+}
+
+func (opts *Options) validate() error {
+	if opts.Host == "" {
+		return errNoHost
+	}
+
+	if opts.HTTP == "" && opts.HTTPS == "" {
+		return errNoAddress
+	}
+
+	if !strings.HasPrefix(opts.Path, "/") {
+		return errNoPath
+	}
+
+	return nil
+}
+
+func newClient(opts Options) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		ServerName: opts.Host,
+		// nolint: gosec
+		// verification can be disabled explicitly, e.g. for self-signed certificates
+		InsecureSkipVerify: opts.Insecure,
+	}
+
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type checker struct {
+	opts   Options
+	client *http.Client
+}
+
+// get requests path of the domain from the listener at base
+func (c *checker) get(base, path string) (*http.Response, error) {
+	u, err := url.Parse(strings.TrimSuffix(base, "/") + path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = c.opts.Host
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// nolint: errcheck
+	// the body is not checked
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// checkPage expects the page to be served, or to be redirected to HTTPS when
+// requested over HTTP
+func (c *checker) checkPage(name, base string) Result {
+	if base == "" {
+		return Result{Name: name, Skipped: true, Message: "no listener configured"}
+	}
+
+	resp, err := c.get(base, c.opts.Path)
+	if err != nil {
+		return Result{Name: name, Message: err.Error()}
+	}
+
+	message := fmt.Sprintf("GET %s responded with %d", c.opts.Path, resp.StatusCode)
+
+	if resp.StatusCode == http.StatusOK {
+		return Result{Name: name, Passed: true, Message: message}
+	}
+
+	location := resp.Header.Get("Location")
+	if name == "http" && isRedirect(resp.StatusCode) && strings.HasPrefix(location, "https://") {
+		return Result{Name: name, Passed: true, Message: message + " to " + location}
+	}
+
+	return Result{Name: name, Message: message + ", expected 200"}
+}
+
+// checkRedirect expects a directory requested without a trailing slash to
+// be redirected
+func (c *checker) checkRedirect(base string) Result {
+	const name = "redirect"
+
+	if c.opts.Path == "/" || !strings.HasSuffix(c.opts.Path, "/") {
+		return Result{Name: name, Skipped: true, Message: "path is not a directory below /"}
+	}
+
+	path := strings.TrimSuffix(c.opts.Path, "/")
+
+	resp, err := c.get(base, path)
+	if err != nil {
+		return Result{Name: name, Message: err.Error()}
+	}
+
+	location := resp.Header.Get("Location")
+	message := fmt.Sprintf("GET %s responded with %d", path, resp.StatusCode)
+
+	if !isRedirect(resp.StatusCode) || !strings.HasSuffix(location, c.opts.Path) {
+		return Result{Name: name, Message: message + ", expected a redirect to " + c.opts.Path}
+	}
+
+	return Result{Name: name, Passed: true, Message: message + " to " + location}
+}
+
+// checkNotFound expects a missing page to be reported as such
+func (c *checker) checkNotFound(base string) Result {
+	const name = "404"
+
+	dir := c.opts.Path
+	if !strings.HasSuffix(dir, "/") {
+		dir = strings.TrimSuffix(path.Dir(dir), "/") + "/"
+	}
+
+	missing := fmt.Sprintf("%sgitlab-pages-smoke-%d", dir, rand.Int63())
+
+	resp, err := c.get(base, missing)
+	if err != nil {
+		return Result{Name: name, Message: err.Error()}
+	}
+
+	message := fmt.Sprintf("GET %s responded with %d", missing, resp.StatusCode)
+	if resp.StatusCode != http.StatusNotFound {
+		return Result{Name: name, Message: message + ", expected 404"}
+	}
+
+	return Result{Name: name, Passed: true, Message: message}
+}
+
+// checkHeaders expects the page to be served with the custom headers
+func (c *checker) checkHeaders(base string) Result {
+	const name = "headers"
+
+	if len(c.opts.Headers) == 0 {
+		return Result{Name: name, Skipped: true, Message: "no header expected"}
+	}
+
+	resp, err := c.get(base, c.opts.Path)
+	if err != nil {
+		return Result{Name: name, Message: err.Error()}
+	}
+
+	var missing []string
+	for _, header := range c.opts.Headers {
+		key, value := splitHeader(header)
+		if resp.Header.Get(key) != value {
+			missing = append(missing, header)
+		}
+	}
+
+	if len(missing) > 0 {
+		return Result{Name: name, Message: "missing " + strings.Join(missing, ", ")}
+	}
+
+	return Result{Name: name, Passed: true, Message: strings.Join(c.opts.Headers, ", ")}
+}
+
+func splitHeader(header string) (string, string) {
+	parts := strings.SplitN(header, ":", 2)
+	if len(parts) == 1 {
+		return strings.TrimSpace(parts[0]), ""
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+func isRedirect(code int) bool {
+	return code >= 300 && code < 400
+}
@@ -0,0 +1,139 @@
+package smoke
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func pagesServer(t *testing.T, secure bool) *httptest.Server {
+	t.Helper()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "group.example.io" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/project/":
+			w.Header().Set("X-Custom", "value")
+			w.WriteHeader(http.StatusOK)
+		case "/project":
+			http.Redirect(w, r, "//group.example.io/project/", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server := httptest.NewServer(handler)
+	if secure {
+		server = httptest.NewTLSServer(handler)
+	}
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestRun(t *testing.T) {
+	opts := Options{
+		Host:     "group.example.io",
+		Path:     "/project/",
+		HTTP:     pagesServer(t, false).URL,
+		HTTPS:    pagesServer(t, true).URL,
+		Insecure: true,
+		Headers:  []string{"X-Custom: value"},
+		Timeout:  time.Second,
+	}
+
+	report, err := Run(opts)
+	require.NoError(t, err)
+	require.Zero(t, report.Failed())
+	require.Len(t, report.Results, 5)
+
+	for _, result := range report.Results {
+		require.True(t, result.Passed, result.Name)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	opts := Options{
+		Host:    "group.example.io",
+		Path:    "/missing/",
+		HTTP:    pagesServer(t, false).URL,
+		Headers: []string{"X-Custom: value"},
+		Timeout: time.Second,
+	}
+
+	report, err := Run(opts)
+	require.NoError(t, err)
+
+	outcome := map[string]string{}
+	for _, result := range report.Results {
+		switch {
+		case result.Skipped:
+			outcome[result.Name] = "skipped"
+		case result.Passed:
+			outcome[result.Name] = "passed"
+		default:
+			outcome[result.Name] = "failed"
+		}
+	}
+
+	require.Equal(t, map[string]string{
+		"http":     "failed",
+		"https":    "skipped",
+		"redirect": "failed",
+		"404":      "passed",
+		"headers":  "failed",
+	}, outcome)
+	require.Equal(t, 3, report.Failed())
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	tests := map[string]struct {
+		opts        Options
+		expectedErr error
+	}{
+		"no_host": {
+			opts:        Options{HTTP: "http://127.0.0.1", Path: "/"},
+			expectedErr: errNoHost,
+		},
+		"no_listener": {
+			opts:        Options{Host: "group.example.io", Path: "/"},
+			expectedErr: errNoAddress,
+		},
+		"relative_path": {
+			opts:        Options{Host: "group.example.io", HTTP: "http://127.0.0.1", Path: "project/"},
+			expectedErr: errNoPath,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Run(tt.opts)
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestMainWritesReport(t *testing.T) {
+	server := pagesServer(t, false)
+
+	var stdout, stderr bytes.Buffer
+	code := Main([]string{"-host", "group.example.io", "-path", "/project/", "-http", server.URL}, &stdout, &stderr)
+	require.Zero(t, code, stderr.String())
+	require.Contains(t, stdout.String(), "PASS redirect")
+	require.Contains(t, stdout.String(), "3 passed, 0 failed, 2 skipped")
+
+	code = Main([]string{"-host", "group.example.io", "-path", "/missing/", "-http", server.URL}, &stdout, &stderr)
+	require.Equal(t, 1, code)
+
+	code = Main([]string{"-http", server.URL}, &stdout, &stderr)
+	require.Equal(t, 2, code)
+	require.Contains(t, stderr.String(), errNoHost.Error())
+}
@@ -9,3 +9,20 @@ type Client interface {
 	// Resolve retrieves an VirtualDomain from the GitLab API and wraps it into a Lookup
 	GetLookup(ctx context.Context, domain string) Lookup
 }
+
+// BatchClient is a Client able to retrieve the lookups of several domains
+// with a single request
+type BatchClient interface {
+	Client
+	// GetLookups retrieves the lookups of domains, in the same order
+	GetLookups(ctx context.Context, domains []string) []Lookup
+}
+
+// ConditionalClient is a Client able to refresh a lookup only if it has been
+// modified since it was retrieved
+type ConditionalClient interface {
+	Client
+	// GetLookupIfModified retrieves the lookup of domain, or returns a copy of
+	// cached with NotModified set if GitLab reports that it has not changed
+	GetLookupIfModified(ctx context.Context, domain string, cached *Lookup) Lookup
+}
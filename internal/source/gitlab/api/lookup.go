@@ -5,4 +5,16 @@ type Lookup struct {
 	Name   string
 	Error  error
 	Domain *VirtualDomain
+
+	// Deprecated is set when GitLab reported the domain as removed and its
+	// last known lookup is still served during a grace period
+	Deprecated bool
+
+	// ETag and LastModified are the validators GitLab sent with the lookup,
+	// they are used to refresh it with a conditional request
+	ETag         string
+	LastModified string
+	// NotModified is set when GitLab confirmed that a refreshed lookup has
+	// not changed since it was retrieved
+	NotModified bool
 }
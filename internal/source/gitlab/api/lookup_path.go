@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 // LookupPath represents a lookup path for a virtual domain
 type LookupPath struct {
 	ProjectID     int    `json:"project_id,omitempty"`
@@ -7,6 +9,26 @@ type LookupPath struct {
 	HTTPSOnly     bool   `json:"https_only,omitempty"`
 	Prefix        string `json:"prefix,omitempty"`
 	Source        Source `json:"source,omitempty"`
+
+	// PublishAt and UnpublishAt restrict the time window during which the
+	// deployment is served
+	PublishAt   *time.Time `json:"publish_at,omitempty"`
+	UnpublishAt *time.Time `json:"unpublish_at,omitempty"`
+
+	// GroupSSO is set when the group of the project enforces its SSO on the
+	// visitors of the private site
+	GroupSSO *GroupSSO `json:"group_sso,omitempty"`
+
+	// Headers are added to the responses of the project, by name
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// GroupSSO describes the SSO enforced by the group of a project
+type GroupSSO struct {
+	GroupID int `json:"group_id"`
+	// SignInURL is the SSO page of the group, visitors are sent to it with a
+	// `redirect` parameter to come back to the site
+	SignInURL string `json:"sign_in_url"`
 }
 
 // Source describes GitLab Page serving variant
@@ -17,3 +39,16 @@ type Source struct {
 	Count  int    `json:"file_count,omitempty"`
 	Size   int    `json:"file_size,omitempty"`
 }
+
+// IsPublished returns true if the deployment is within its publication window at t
+func (l *LookupPath) IsPublished(t time.Time) bool {
+	if l.PublishAt != nil && t.Before(*l.PublishAt) {
+		return false
+	}
+
+	if l.UnpublishAt != nil && !t.Before(*l.UnpublishAt) {
+		return false
+	}
+
+	return true
+}
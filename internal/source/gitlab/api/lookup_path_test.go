@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupPathIsPublished(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	tests := map[string]struct {
+		lookup   LookupPath
+		expected bool
+	}{
+		"no_window":             {lookup: LookupPath{}, expected: true},
+		"published":             {lookup: LookupPath{PublishAt: &before}, expected: true},
+		"not_yet_published":     {lookup: LookupPath{PublishAt: &after}, expected: false},
+		"published_at_now":      {lookup: LookupPath{PublishAt: &now}, expected: true},
+		"not_yet_unpublished":   {lookup: LookupPath{UnpublishAt: &after}, expected: true},
+		"unpublished":           {lookup: LookupPath{UnpublishAt: &before}, expected: false},
+		"unpublished_at_now":    {lookup: LookupPath{UnpublishAt: &now}, expected: false},
+		"within_window":         {lookup: LookupPath{PublishAt: &before, UnpublishAt: &after}, expected: true},
+		"window_already_closed": {lookup: LookupPath{PublishAt: &before, UnpublishAt: &before}, expected: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.expected, tt.lookup.IsPublished(now))
+		})
+	}
+}
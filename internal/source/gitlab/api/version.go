@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Version1 is the original payload of the internal Pages API, served as
+	// plain application/json by every GitLab version
+	Version1 = 1
+
+	// MaxVersion is the highest version of the internal Pages API supported.
+	// A version is only added with the fields of its payload that the client
+	// parses, and is then served with a versioned media type.
+	MaxVersion = Version1
+)
+
+const mediaTypePrefix = "application/vnd.gitlab-pages.v"
+
+// MediaType returns the media type used to request and serve the given
+// version of the internal Pages API
+func MediaType(version int) string {
+	if version <= Version1 {
+		return "application/json"
+	}
+
+	return fmt.Sprintf("%s%d+json", mediaTypePrefix, version)
+}
+
+// AcceptHeader returns the Accept header value for requesting the given
+// version. Version 0 asks for the highest supported version while still
+// accepting the original payload from older GitLab versions.
+func AcceptHeader(version int) string {
+	if version == 0 {
+		version = MaxVersion
+		if version > Version1 {
+			return MediaType(version) + ", application/json;q=0.9"
+		}
+	}
+
+	return MediaType(version)
+}
+
+// VersionFromContentType returns the version of the internal Pages API that
+// was served with the given Content-Type header. It can be higher than
+// MaxVersion, such payloads can't be parsed.
+func VersionFromContentType(contentType string) int {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, mediaTypePrefix) {
+		return Version1
+	}
+
+	version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(mediaType, mediaTypePrefix), "+json"))
+	if err != nil || version < Version1 {
+		return Version1
+	}
+
+	return version
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptHeader(t *testing.T) {
+	require.Equal(t, "application/json", AcceptHeader(0))
+	require.Equal(t, "application/json", AcceptHeader(Version1))
+	require.Equal(t, "application/vnd.gitlab-pages.v2+json", AcceptHeader(2))
+}
+
+func TestVersionFromContentType(t *testing.T) {
+	tests := map[string]struct {
+		contentType string
+		expected    int
+	}{
+		"empty":               {contentType: "", expected: Version1},
+		"json":                {contentType: "application/json", expected: Version1},
+		"json_with_charset":   {contentType: "application/json; charset=utf-8", expected: Version1},
+		"v2":                  {contentType: "application/vnd.gitlab-pages.v2+json", expected: 2},
+		"v2_with_charset":     {contentType: "application/vnd.gitlab-pages.v2+json; charset=utf-8", expected: 2},
+		"v2_case_insensitive": {contentType: "Application/VND.GitLab-Pages.V2+JSON", expected: 2},
+		"invalid_version":     {contentType: "application/vnd.gitlab-pages.vX+json", expected: Version1},
+		"malformed":           {contentType: "application/json; ;", expected: Version1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.expected, VersionFromContentType(tt.contentType))
+		})
+	}
+}
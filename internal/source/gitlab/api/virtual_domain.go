@@ -6,5 +6,24 @@ type VirtualDomain struct {
 	Certificate string `json:"certificate,omitempty"`
 	Key         string `json:"key,omitempty"`
 
+	TLS *TLSPolicy `json:"tls,omitempty"`
+
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+
 	LookupPaths []LookupPath `json:"lookup_paths"`
 }
+
+// TLSPolicy represents the TLS settings of a virtual domain that override the
+// instance defaults
+type TLSPolicy struct {
+	MinVersion           string `json:"min_version,omitempty"`
+	ClientAuth           string `json:"client_auth,omitempty"`
+	ClientCACertificates string `json:"client_ca_certificates,omitempty"`
+}
+
+// RateLimit represents the rate limit of a virtual domain that overrides the
+// instance default
+type RateLimit struct {
+	LimitPerSecond float64 `json:"limit_per_second"`
+	Burst          int     `json:"burst"`
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// batcher groups the lookups of the domains which are not cached yet into
+// batch requests, so that a burst of cache misses, such as after a restart,
+// results in a few requests to GitLab. A batch is sent once it has maxSize
+// domains, or window after its first domain.
+type batcher struct {
+	client  api.BatchClient
+	maxSize int
+	window  time.Duration
+
+	mux     sync.Mutex
+	pending *batch
+}
+
+// batch is a group of domains looked up with a single request
+type batch struct {
+	domains []string
+	lookups []api.Lookup
+	timer   *time.Timer
+	send    sync.Once
+	done    chan struct{}
+}
+
+func newBatcher(client api.BatchClient, maxSize int, window time.Duration) *batcher {
+	return &batcher{
+		client:  client,
+		maxSize: maxSize,
+		window:  window,
+	}
+}
+
+// GetLookup adds domain to the pending batch and waits for its lookup
+func (b *batcher) GetLookup(ctx context.Context, domain string) api.Lookup {
+	b.mux.Lock()
+	p := b.pending
+	if p == nil {
+		p = &batch{done: make(chan struct{})}
+		p.timer = time.AfterFunc(b.window, func() { b.send(p) })
+		b.pending = p
+	}
+
+	i := len(p.domains)
+	p.domains = append(p.domains, domain)
+	full := len(p.domains) >= b.maxSize
+	if full {
+		b.pending = nil
+	}
+	b.mux.Unlock()
+
+	if full {
+		p.timer.Stop()
+		go b.send(p)
+	}
+
+	select {
+	case <-ctx.Done():
+		return api.Lookup{Name: domain, Error: fmt.Errorf("batch lookup: %w", ctx.Err())}
+	case <-p.done:
+		return p.lookups[i]
+	}
+}
+
+// send looks up the domains of p once, no domains are added to p afterwards
+func (b *batcher) send(p *batch) {
+	b.mux.Lock()
+	if b.pending == p {
+		b.pending = nil
+	}
+	b.mux.Unlock()
+
+	p.send.Do(func() {
+		metrics.DomainsSourceLookupBatchSize.Observe(float64(len(p.domains)))
+
+		// the batch is shared, it is not bound to the context of any lookup
+		p.lookups = b.client.GetLookups(context.Background(), p.domains)
+		close(p.done)
+	})
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+)
+
+type batchClientMock struct {
+	mux     sync.Mutex
+	batches [][]string
+	release chan struct{}
+}
+
+func (c *batchClientMock) GetLookup(ctx context.Context, domain string) api.Lookup {
+	return c.GetLookups(ctx, []string{domain})[0]
+}
+
+func (c *batchClientMock) GetLookups(_ context.Context, domains []string) []api.Lookup {
+	c.mux.Lock()
+	c.batches = append(c.batches, domains)
+	c.mux.Unlock()
+
+	if c.release != nil {
+		<-c.release
+	}
+
+	lookups := make([]api.Lookup, len(domains))
+	for i, name := range domains {
+		lookups[i] = api.Lookup{Name: name, Domain: &api.VirtualDomain{}}
+		if name == "missing.gitlab.io" {
+			lookups[i] = api.Lookup{Name: name, Error: domain.ErrDomainDoesNotExist}
+		}
+	}
+
+	return lookups
+}
+
+func (c *batchClientMock) batchSizes() []int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	sizes := []int{}
+	for _, batch := range c.batches {
+		sizes = append(sizes, len(batch))
+	}
+
+	return sizes
+}
+
+func TestBatcher(t *testing.T) {
+	t.Run("full_batches", func(t *testing.T) {
+		client := &batchClientMock{}
+		b := newBatcher(client, 3, time.Hour)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				name := fmt.Sprintf("group%d.gitlab.io", i)
+				lookup := b.GetLookup(context.Background(), name)
+				require.NoError(t, lookup.Error)
+				require.Equal(t, name, lookup.Name)
+			}(i)
+		}
+		wg.Wait()
+
+		require.Equal(t, []int{3, 3}, client.batchSizes())
+	})
+
+	t.Run("window", func(t *testing.T) {
+		client := &batchClientMock{}
+		b := newBatcher(client, 100, 100*time.Millisecond)
+
+		var wg sync.WaitGroup
+		for _, name := range []string{"group.gitlab.io", "missing.gitlab.io"} {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				b.GetLookup(context.Background(), name)
+			}(name)
+		}
+		wg.Wait()
+
+		require.Equal(t, []int{2}, client.batchSizes())
+		require.ErrorIs(t, b.GetLookup(context.Background(), "missing.gitlab.io").Error, domain.ErrDomainDoesNotExist)
+		require.Equal(t, []int{2, 1}, client.batchSizes())
+	})
+
+	t.Run("context_done", func(t *testing.T) {
+		client := &batchClientMock{release: make(chan struct{})}
+		defer close(client.release)
+
+		b := newBatcher(client, 1, time.Hour)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		lookup := b.GetLookup(ctx, "group.gitlab.io")
+		require.ErrorIs(t, lookup.Error, context.DeadlineExceeded)
+	})
+}
+
+func TestRetrieveCoalescesDomain(t *testing.T) {
+	client := &batchClientMock{release: make(chan struct{})}
+	r := NewRetriever(client, time.Second, time.Millisecond, 1)
+
+	lookups := make(chan api.Lookup, 3)
+	for i := 0; i < 3; i++ {
+		go func() { lookups <- r.Retrieve(context.Background(), "group.gitlab.io", nil) }()
+	}
+
+	require.Eventually(t, func() bool {
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		return len(r.inflight) == 1 && len(client.batchSizes()) == 1
+	}, time.Second, time.Millisecond)
+
+	// the retrievals waiting for the one in progress are not sent
+	time.Sleep(10 * time.Millisecond)
+	close(client.release)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, (<-lookups).Error)
+	}
+
+	require.Equal(t, []int{1}, client.batchSizes())
+	require.Empty(t, r.inflight)
+}
+
+func TestNewCacheWithLookupBatches(t *testing.T) {
+	cc := testCacheConfig
+	cc.LookupBatchSize = 10
+	cc.LookupBatchWindow = 10 * time.Millisecond
+
+	client := &batchClientMock{}
+	cache := NewCache(client, &cc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			lookup := cache.Resolve(context.Background(), fmt.Sprintf("group%d.gitlab.io", i))
+			require.NoError(t, lookup.Error)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, []int{5}, client.batchSizes())
+}
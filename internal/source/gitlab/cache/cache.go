@@ -3,24 +3,39 @@ package cache
 import (
 	"context"
 	"fmt"
+	"time"
+
+	"gitlab.com/gitlab-org/labkit/log"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/readonly"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
 
 // Cache is a short and long caching mechanism for GitLab source
 type Cache struct {
-	store     Store
-	retriever *Retriever
+	store                    Store
+	retriever                *Retriever
+	removedDomainGracePeriod time.Duration
+
+	// maxStale is how long an expired lookup is served while it cannot be
+	// refreshed
+	maxStale time.Duration
 }
 
 // NewCache creates a new instance of Cache.
 func NewCache(client api.Client, cc *config.Cache) *Cache {
 	r := NewRetriever(client, cc.RetrievalTimeout, cc.MaxRetrievalInterval, cc.MaxRetrievalRetries)
+	if bc, ok := client.(api.BatchClient); ok && cc.LookupBatchSize > 1 {
+		r.batcher = newBatcher(bc, cc.LookupBatchSize, cc.LookupBatchWindow)
+	}
+
 	return &Cache{
-		store:     newMemStore(cc),
-		retriever: r,
+		store:                    newMemStore(cc),
+		retriever:                r,
+		removedDomainGracePeriod: cc.RemovedDomainGracePeriod,
+		maxStale:                 cc.MaxStale,
 	}
 }
 
@@ -73,6 +88,14 @@ func NewCache(client api.Client, cc *config.Cache) *Cache {
 //  - we create a lookup that contains information about an error
 //  - we cache this response
 //  - we pass this lookup upstream to all the clients
+//
+// A lookup which cannot be refreshed because the GitLab API fails is served
+// stale, up to `maxStale` after it expired, while it is refreshed in the
+// background on the next requests.
+//
+// While Pages is read-only, the cached lookups are served without being
+// refreshed and kept past their expiry, and the domains which are not cached
+// yet fail with readonly.ErrReadOnly.
 func (c *Cache) Resolve(ctx context.Context, domain string) *api.Lookup {
 	entry := c.store.LoadOrCreate(domain)
 
@@ -82,20 +105,36 @@ func (c *Cache) Resolve(ctx context.Context, domain string) *api.Lookup {
 	}
 
 	if entry.NeedsRefresh() {
-		c.Refresh(entry)
+		if readonly.Enabled() {
+			// the lookup cannot be refreshed, it is kept until it can
+			c.store.Extend(domain, entry)
+		} else {
+			c.Refresh(entry)
+		}
+
+		if entry.IsExpired() {
+			metrics.DomainsSourceCacheStaleHits.Inc()
+		}
 
 		metrics.DomainsSourceCacheHit.Inc()
 		return entry.Lookup()
 	}
 
 	metrics.DomainsSourceCacheMiss.Inc()
-	return c.retrieve(ctx, entry)
+
+	if readonly.Enabled() {
+		return &api.Lookup{Name: domain, Error: readonly.ErrReadOnly}
+	}
+
+	return c.retrieve(ctx, entry, nil)
 }
 
-func (c *Cache) retrieve(ctx context.Context, entry *Entry) *api.Lookup {
+// retrieve resolves the lookup of entry, cached is the last successful
+// lookup of the domain if the entry is being refreshed
+func (c *Cache) retrieve(ctx context.Context, entry *Entry, cached *api.Lookup) *api.Lookup {
 	// We run the code within an additional func() to run both `e.setResponse`
 	// and `c.retriever.Retrieve` asynchronously.
-	entry.retrieve.Do(func() { go func() { entry.setResponse(c.retriever.Retrieve(ctx, entry.domain)) }() })
+	entry.retrieve.Do(func() { go func() { entry.setResponse(c.retriever.Retrieve(ctx, entry.domain, cached)) }() })
 
 	var lookup *api.Lookup
 	select {
@@ -108,6 +147,31 @@ func (c *Cache) retrieve(ctx context.Context, entry *Entry) *api.Lookup {
 	return lookup
 }
 
+// Evict removes the lookup of domain from the cache, so that it is retrieved
+// again on its next request. It returns false when domain is not cached.
+func (c *Cache) Evict(domain string) bool {
+	return c.store.Delete(domain)
+}
+
+// Clear removes the lookups of all the domains from the cache, it returns how
+// many domains were cached
+func (c *Cache) Clear() int {
+	return c.store.Clear()
+}
+
+// Lookups returns the lookups of the domains which are cached and have been
+// retrieved
+func (c *Cache) Lookups() []*api.Lookup {
+	var lookups []*api.Lookup
+	for _, entry := range c.store.Entries() {
+		if lookup := entry.Lookup(); lookup != nil {
+			lookups = append(lookups, lookup)
+		}
+	}
+
+	return lookups
+}
+
 // Refresh will update the entry in the store only when it gets resolved successfully.
 // If an existing successful entry exists, it will only be replaced if the new resolved
 // entry is successful too.
@@ -122,14 +186,57 @@ func (c *Cache) Refresh(entry *Entry) {
 func (c *Cache) refreshFunc(e *Entry) {
 	entry := newCacheEntry(e.domain, e.refreshTimeout, e.expirationTimeout)
 
-	c.retrieve(context.Background(), entry)
+	// a lookup that GitLab reports as not modified is reused as it is
+	var cached *api.Lookup
+	if e.isSuccessful() {
+		cached = e.Lookup()
+	}
+
+	c.retrieve(context.Background(), entry, cached)
 
 	// do not replace existing Entry `e.response` when `entry.response` has an error
-	// and `e` has not expired. See https://gitlab.com/gitlab-org/gitlab-pages/-/issues/281.
-	if !e.isExpired() && entry.hasTemporaryError() {
+	// and `e` has not expired for longer than maxStale.
+	// See https://gitlab.com/gitlab-org/gitlab-pages/-/issues/281.
+	if !e.isStale(c.maxStale) && entry.hasTemporaryError() {
 		entry.response = e.response
-		entry.refreshedOriginalTimestamp = e.created
+		entry.refreshedOriginalTimestamp = e.originalTimestamp()
+		entry.removedAt = e.removedAt
 	}
 
+	c.keepRemovedDomain(e, entry)
+
 	c.store.ReplaceOrCreate(e.domain, entry)
 }
+
+// keepRemovedDomain replaces the response of the refreshed entry with the
+// last known lookup of e when GitLab reports the domain as removed, until
+// the grace period has passed. It protects against a site being taken down
+// instantly by an accidental deletion.
+func (c *Cache) keepRemovedDomain(e, entry *Entry) {
+	if c.removedDomainGracePeriod <= 0 || entry.domainExists() || !e.isSuccessful() {
+		return
+	}
+
+	removedAt := e.removedAt
+	if removedAt.IsZero() {
+		removedAt = time.Now()
+	}
+
+	logger := log.WithFields(log.Fields{
+		"domain":     e.domain,
+		"removed_at": removedAt,
+	})
+
+	if time.Since(removedAt) > c.removedDomainGracePeriod {
+		logger.Warn("grace period of removed domain is over, the domain is not served anymore")
+		return
+	}
+
+	lookup := *e.response
+	lookup.Deprecated = true
+
+	entry.response = &lookup
+	entry.removedAt = removedAt
+
+	logger.Warn("domain was removed from GitLab, serving its last known content during the grace period")
+}
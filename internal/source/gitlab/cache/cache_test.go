@@ -11,6 +11,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/readonly"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
 )
 
@@ -240,3 +242,213 @@ func TestResolve(t *testing.T) {
 		})
 	})
 }
+
+type conditionalClientMock struct {
+	cached chan *api.Lookup
+}
+
+func (c *conditionalClientMock) GetLookup(ctx context.Context, domain string) api.Lookup {
+	return c.GetLookupIfModified(ctx, domain, nil)
+}
+
+func (c *conditionalClientMock) GetLookupIfModified(_ context.Context, domain string, cached *api.Lookup) api.Lookup {
+	c.cached <- cached
+
+	if cached != nil {
+		lookup := *cached
+		lookup.NotModified = true
+
+		return lookup
+	}
+
+	return api.Lookup{Name: domain, Domain: &api.VirtualDomain{}, ETag: `"v1"`}
+}
+
+func TestResolveReadOnly(t *testing.T) {
+	readonly.Set(true)
+	t.Cleanup(func() { readonly.Set(false) })
+
+	t.Run("when item is not cached", func(t *testing.T) {
+		withTestCache(resolverConfig{buffered: true}, nil, func(cache *Cache, resolver *clientMock) {
+			lookup := cache.Resolve(context.Background(), "my.gitlab.com")
+
+			require.ErrorIs(t, lookup.Error, readonly.ErrReadOnly)
+			require.Equal(t, "my.gitlab.com", lookup.Name)
+			require.Equal(t, 0, len(resolver.lookups))
+		})
+	})
+
+	t.Run("when item is in long cache only", func(t *testing.T) {
+		withTestCache(resolverConfig{buffered: true}, nil, func(cache *Cache, resolver *clientMock) {
+			cache.withTestEntry(entryConfig{expired: true, retrieved: true}, func(entry *Entry) {
+				// the entry is not refreshed, and kept past its expiry while
+				// it is requested
+				for i := 0; i < 15; i++ {
+					lookup := cache.Resolve(context.Background(), "my.gitlab.com")
+
+					require.NoError(t, lookup.Error)
+					require.Equal(t, "my.gitlab.com", lookup.Name)
+
+					time.Sleep(testCacheConfig.CacheExpiry / 10)
+				}
+
+				require.Same(t, entry, cache.store.LoadOrCreate("my.gitlab.com"))
+				require.Equal(t, 0, len(resolver.lookups))
+			})
+		})
+	})
+}
+
+func TestRefreshWithConditionalClient(t *testing.T) {
+	client := &conditionalClientMock{cached: make(chan *api.Lookup, 2)}
+	cache := NewCache(client, &testCacheConfig)
+
+	entry := newCacheEntry("my.gitlab.com", time.Second, time.Minute)
+	lookup := cache.retrieve(context.Background(), entry, nil)
+	require.NoError(t, lookup.Error)
+	require.Nil(t, <-client.cached, "the first retrieval is unconditional")
+
+	cache.refreshFunc(entry)
+	require.Equal(t, entry.Lookup(), <-client.cached)
+
+	refreshed := cache.store.LoadOrCreate("my.gitlab.com").Lookup()
+	require.True(t, refreshed.NotModified)
+	require.Equal(t, `"v1"`, refreshed.ETag)
+	require.Equal(t, entry.Lookup().Domain, refreshed.Domain)
+}
+
+func TestKeepRemovedDomain(t *testing.T) {
+	served := api.Lookup{Name: "my.gitlab.com", Domain: &api.VirtualDomain{}}
+	removed := api.Lookup{Name: "my.gitlab.com", Error: domain.ErrDomainDoesNotExist}
+
+	newEntry := func(lookup api.Lookup, removedAt time.Time) *Entry {
+		entry := newCacheEntry("my.gitlab.com", time.Second, time.Second)
+		entry.setResponse(lookup)
+		entry.removedAt = removedAt
+
+		return entry
+	}
+
+	tests := map[string]struct {
+		gracePeriod        time.Duration
+		previous           api.Lookup
+		previousRemovedAt  time.Time
+		refreshed          api.Lookup
+		expectedDeprecated bool
+	}{
+		"grace_period_disabled": {
+			previous:  served,
+			refreshed: removed,
+		},
+		"domain_removed": {
+			gracePeriod:        time.Hour,
+			previous:           served,
+			refreshed:          removed,
+			expectedDeprecated: true,
+		},
+		"domain_removed_within_grace_period": {
+			gracePeriod:        time.Hour,
+			previous:           served,
+			previousRemovedAt:  time.Now().Add(-time.Minute),
+			refreshed:          removed,
+			expectedDeprecated: true,
+		},
+		"grace_period_over": {
+			gracePeriod:       time.Hour,
+			previous:          served,
+			previousRemovedAt: time.Now().Add(-2 * time.Hour),
+			refreshed:         removed,
+		},
+		"domain_never_served": {
+			gracePeriod: time.Hour,
+			previous:    removed,
+			refreshed:   removed,
+		},
+		"domain_restored": {
+			gracePeriod:       time.Hour,
+			previous:          served,
+			previousRemovedAt: time.Now().Add(-time.Minute),
+			refreshed:         served,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cache := &Cache{removedDomainGracePeriod: tt.gracePeriod}
+			previous := newEntry(tt.previous, tt.previousRemovedAt)
+			refreshed := newEntry(tt.refreshed, time.Time{})
+
+			cache.keepRemovedDomain(previous, refreshed)
+
+			lookup := refreshed.Lookup()
+			require.Equal(t, tt.expectedDeprecated, lookup.Deprecated)
+
+			if !tt.expectedDeprecated {
+				require.Equal(t, tt.refreshed, *lookup)
+				require.True(t, refreshed.removedAt.IsZero())
+				return
+			}
+
+			require.NoError(t, lookup.Error)
+			require.Equal(t, tt.previous.Domain, lookup.Domain)
+			require.False(t, refreshed.removedAt.IsZero())
+			require.False(t, previous.Lookup().Deprecated, "previous lookup must not be modified")
+
+			if !tt.previousRemovedAt.IsZero() {
+				require.Equal(t, tt.previousRemovedAt, refreshed.removedAt, "grace period must not be extended")
+			}
+		})
+	}
+}
+
+func TestEvict(t *testing.T) {
+	client := &conditionalClientMock{cached: make(chan *api.Lookup, 2)}
+	cache := NewCache(client, &testCacheConfig)
+
+	require.False(t, cache.Evict("my.gitlab.com"))
+
+	require.NoError(t, cache.Resolve(context.Background(), "my.gitlab.com").Error)
+	require.Nil(t, <-client.cached)
+
+	require.True(t, cache.Evict("my.gitlab.com"))
+	require.False(t, cache.Evict("my.gitlab.com"))
+
+	// the evicted domain is retrieved again, unconditionally
+	require.NoError(t, cache.Resolve(context.Background(), "my.gitlab.com").Error)
+	require.Nil(t, <-client.cached)
+}
+
+func TestClear(t *testing.T) {
+	cache := NewCache(&batchClientMock{}, &testCacheConfig)
+
+	require.Zero(t, cache.Clear())
+
+	for _, domain := range []string{"a.gitlab.io", "missing.gitlab.io"} {
+		cache.Resolve(context.Background(), domain)
+	}
+	require.Len(t, cache.Lookups(), 2)
+
+	require.Equal(t, 2, cache.Clear())
+	require.Empty(t, cache.Lookups())
+}
+
+func TestMaxEntries(t *testing.T) {
+	cc := testCacheConfig
+	cc.CacheExpiry = time.Minute
+	cc.MaxEntries = 3
+
+	store := newMemStore(&cc)
+
+	for _, domain := range []string{"a.gitlab.io", "b.gitlab.io", "c.gitlab.io"} {
+		store.LoadOrCreate(domain)
+		time.Sleep(time.Millisecond)
+	}
+
+	// a.gitlab.io is the closest to its expiry
+	store.LoadOrCreate("d.gitlab.io")
+
+	items := store.(*memstore).store.Items()
+	require.Len(t, items, 3)
+	require.NotContains(t, items, "a.gitlab.io")
+	require.Contains(t, items, "d.gitlab.io")
+}
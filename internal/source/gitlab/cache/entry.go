@@ -24,6 +24,7 @@ type Entry struct {
 	response                   *api.Lookup
 	refreshTimeout             time.Duration
 	expirationTimeout          time.Duration
+	removedAt                  time.Time
 }
 
 func newCacheEntry(domain string, refreshTimeout, entryExpirationTimeout time.Duration) *Entry {
@@ -73,12 +74,27 @@ func (e *Entry) setResponse(lookup api.Lookup) {
 	close(e.retrieved)
 }
 
+// IsExpired returns true if the entry is older than its expiration timeout,
+// it is then only served while it is stale, see Cache.Resolve
+func (e *Entry) IsExpired() bool {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+
+	return e.isExpired()
+}
+
 func (e *Entry) isOutdated() bool {
+	return time.Since(e.originalTimestamp()) > e.refreshTimeout
+}
+
+// originalTimestamp is when the response of the entry was retrieved, the
+// refreshes that failed keep it
+func (e *Entry) originalTimestamp() time.Time {
 	if !e.refreshedOriginalTimestamp.IsZero() {
-		return time.Since(e.refreshedOriginalTimestamp) > e.refreshTimeout
+		return e.refreshedOriginalTimestamp
 	}
 
-	return time.Since(e.created) > e.refreshTimeout
+	return e.created
 }
 
 func (e *Entry) isResolved() bool {
@@ -86,11 +102,16 @@ func (e *Entry) isResolved() bool {
 }
 
 func (e *Entry) isExpired() bool {
-	if !e.refreshedOriginalTimestamp.IsZero() {
-		return time.Since(e.refreshedOriginalTimestamp) > e.expirationTimeout
-	}
+	return e.isStale(0)
+}
+
+// isStale returns true if the entry expired more than maxStale ago
+func (e *Entry) isStale(maxStale time.Duration) bool {
+	return time.Since(e.originalTimestamp()) > e.expirationTimeout+maxStale
+}
 
-	return time.Since(e.created) > e.expirationTimeout
+func (e *Entry) isSuccessful() bool {
+	return e.response != nil && e.response.Error == nil
 }
 
 func (e *Entry) domainExists() bool {
@@ -102,7 +102,7 @@ func TestEntryRefresh(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), cc.RetrievalTimeout)
 		defer cancel()
 
-		lookup := cache.retrieve(ctx, entry)
+		lookup := cache.retrieve(ctx, entry, nil)
 		require.NoError(t, lookup.Error)
 
 		require.Eventually(t, entry.NeedsRefresh, 100*time.Millisecond, time.Millisecond, "entry should need refresh")
@@ -122,13 +122,14 @@ func TestEntryRefresh(t *testing.T) {
 	t.Run("entry is the different when FF_DISABLE_REFRESH_TEMPORARY_ERROR is set to true", func(t *testing.T) {
 		client.failed = false
 		err := os.Setenv("FF_DISABLE_REFRESH_TEMPORARY_ERROR", "true")
+		defer os.Unsetenv("FF_DISABLE_REFRESH_TEMPORARY_ERROR")
 
 		entry := newCacheEntry("test.gitlab.io", cc.EntryRefreshTimeout, cc.CacheExpiry)
 
 		ctx, cancel := context.WithTimeout(context.Background(), cc.RetrievalTimeout)
 		defer cancel()
 
-		lookup := cache.retrieve(ctx, entry)
+		lookup := cache.retrieve(ctx, entry, nil)
 		require.NoError(t, lookup.Error)
 
 		require.Eventually(t, entry.NeedsRefresh, 100*time.Millisecond, time.Millisecond, "entry should need refresh")
@@ -154,7 +155,7 @@ func TestEntryRefresh(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), cc.RetrievalTimeout)
 		defer cancel()
 
-		lookup := cache.retrieve(ctx, entry)
+		lookup := cache.retrieve(ctx, entry, nil)
 		require.Error(t, lookup.Error)
 		require.Eventually(t, entry.NeedsRefresh, 100*time.Millisecond, time.Millisecond, "entry should need refresh")
 
@@ -171,6 +172,63 @@ func TestEntryRefresh(t *testing.T) {
 	})
 }
 
+func TestEntryRefreshStale(t *testing.T) {
+	cc := &config.Cache{
+		CacheExpiry:          time.Minute,
+		EntryRefreshTimeout:  time.Second,
+		RetrievalTimeout:     50 * time.Millisecond,
+		MaxRetrievalInterval: time.Millisecond,
+		MaxRetrievalRetries:  1,
+		MaxStale:             time.Hour,
+	}
+
+	tests := map[string]struct {
+		age           time.Duration
+		expectedStale bool
+	}{
+		"expired_within_max_stale": {
+			age:           cc.CacheExpiry + time.Minute,
+			expectedStale: true,
+		},
+		"expired_beyond_max_stale": {
+			age: cc.CacheExpiry + cc.MaxStale + time.Minute,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &lookupMock{
+				responses: map[string]api.Lookup{
+					"test.gitlab.io": {Name: "test.gitlab.io", Domain: &api.VirtualDomain{}},
+				},
+			}
+			cache := NewCache(client, cc)
+
+			// the first refresh fails, the entry was retrieved age ago
+			entry := newCacheEntry("test.gitlab.io", cc.EntryRefreshTimeout, cc.CacheExpiry)
+			entry.setResponse(api.Lookup{Name: "test.gitlab.io", Domain: &api.VirtualDomain{}})
+			entry.created = time.Now().Add(-tt.age)
+			cache.store.ReplaceOrCreate("test.gitlab.io", entry)
+
+			require.True(t, entry.NeedsRefresh())
+			require.True(t, entry.IsExpired())
+
+			cache.refreshFunc(entry)
+			require.True(t, client.failed)
+
+			storedEntry := loadEntry(t, "test.gitlab.io", cache.store)
+			if !tt.expectedStale {
+				require.Error(t, storedEntry.Lookup().Error)
+				return
+			}
+
+			require.NoError(t, storedEntry.Lookup().Error, "the stale lookup is served")
+			require.Equal(t, entry.created, storedEntry.refreshedOriginalTimestamp)
+			require.True(t, storedEntry.NeedsRefresh(), "the stale lookup is refreshed on the next request")
+		})
+	}
+}
+
 func loadEntry(t *testing.T, domain string, store Store) *Entry {
 	t.Helper()
 
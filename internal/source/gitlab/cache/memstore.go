@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -14,14 +15,18 @@ type memstore struct {
 	mux                    *sync.RWMutex
 	entryRefreshTimeout    time.Duration
 	entryExpirationTimeout time.Duration
+
+	// maxEntries bounds the number of entries, 0 means unlimited
+	maxEntries int
 }
 
 func newMemStore(cc *config.Cache) Store {
 	return &memstore{
-		store:                  cache.New(cc.CacheExpiry, cc.CacheCleanupInterval),
+		store:                  cache.New(cc.CacheExpiry+cc.MaxStale, cc.CacheCleanupInterval),
 		mux:                    &sync.RWMutex{},
 		entryRefreshTimeout:    cc.EntryRefreshTimeout,
 		entryExpirationTimeout: cc.CacheExpiry,
+		maxEntries:             cc.MaxEntries,
 	}
 }
 
@@ -43,18 +48,117 @@ func (m *memstore) LoadOrCreate(domain string) *Entry {
 		return entry.(*Entry)
 	}
 
+	m.makeRoom()
+
 	newEntry := newCacheEntry(domain, m.entryRefreshTimeout, m.entryExpirationTimeout)
 	m.store.SetDefault(domain, newEntry)
 
 	return newEntry
 }
 
+// makeRoom evicts the expired entries, and then the entries closest to their
+// expiry, when the store is full. It evicts 1% more entries than needed so
+// that the entries are not scanned on every new domain. It must be called
+// with the write lock held.
+func (m *memstore) makeRoom() {
+	if m.maxEntries <= 0 || m.store.ItemCount() < m.maxEntries {
+		return
+	}
+
+	m.store.DeleteExpired()
+
+	excess := m.store.ItemCount() - m.maxEntries + 1
+	if excess <= 0 {
+		return
+	}
+
+	excess += m.maxEntries / 100
+
+	items := m.store.Items()
+	domains := make([]string, 0, len(items))
+	for domain := range items {
+		domains = append(domains, domain)
+	}
+
+	sort.Slice(domains, func(i, j int) bool {
+		return items[domains[i]].Expiration < items[domains[j]].Expiration
+	})
+
+	if excess > len(domains) {
+		excess = len(domains)
+	}
+
+	for _, domain := range domains[:excess] {
+		m.store.Delete(domain)
+	}
+}
+
 func (m *memstore) ReplaceOrCreate(domain string, entry *Entry) *Entry {
 	m.mux.Lock()
 	defer m.mux.Unlock()
 
 	m.store.Delete(domain)
+	m.makeRoom()
 	m.store.SetDefault(domain, entry)
 
 	return entry
 }
+
+// Extend delays the expiry of the entry of domain before it expires, so that
+// it is kept while it cannot be refreshed
+func (m *memstore) Extend(domain string, entry *Entry) {
+	m.mux.RLock()
+	current, expiry, exists := m.store.GetWithExpiration(domain)
+	m.mux.RUnlock()
+
+	if !exists || current != entry || time.Until(expiry) > m.entryRefreshTimeout {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if current, exists = m.store.Get(domain); exists && current == entry {
+		m.store.SetDefault(domain, entry)
+	}
+}
+
+// Delete removes the entry of domain, it returns false when domain is not
+// cached
+func (m *memstore) Delete(domain string) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if _, exists := m.store.Get(domain); !exists {
+		return false
+	}
+
+	m.store.Delete(domain)
+
+	return true
+}
+
+// Entries returns the entries of the domains which have not expired
+func (m *memstore) Entries() []*Entry {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	items := m.store.Items()
+	entries := make([]*Entry, 0, len(items))
+	for _, item := range items {
+		entries = append(entries, item.Object.(*Entry))
+	}
+
+	return entries
+}
+
+// Clear removes all the entries, it returns how many were cached
+func (m *memstore) Clear() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	count := m.store.ItemCount()
+	m.store.Flush()
+
+	return count
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"gitlab.com/gitlab-org/labkit/correlation"
@@ -12,6 +13,8 @@ import (
 	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/client"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/tracing"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
 
 // Retriever is an utility type that performs an HTTP request with backoff in
@@ -21,6 +24,21 @@ type Retriever struct {
 	retrievalTimeout     time.Duration
 	maxRetrievalInterval time.Duration
 	maxRetrievalRetries  int
+
+	// batcher looks up the domains which are not cached in batches, it is
+	// nil when the batch lookups are disabled
+	batcher *batcher
+
+	// inflight are the retrievals in progress by domain, the concurrent
+	// retrievals of a domain wait for the same result
+	mux      sync.Mutex
+	inflight map[string]*retrieval
+}
+
+// retrieval is a retrieval of a domain in progress
+type retrieval struct {
+	done   chan struct{}
+	lookup api.Lookup
 }
 
 // NewRetriever creates a Retriever with a client
@@ -30,17 +48,48 @@ func NewRetriever(client api.Client, retrievalTimeout, maxRetrievalInterval time
 		retrievalTimeout:     retrievalTimeout,
 		maxRetrievalInterval: maxRetrievalInterval,
 		maxRetrievalRetries:  maxRetrievalRetries,
+		inflight:             make(map[string]*retrieval),
 	}
 }
 
 // Retrieve retrieves a lookup response from external source with timeout and
-// backoff. It has its own context with timeout.
-func (r *Retriever) Retrieve(originalCtx context.Context, domain string) (lookup api.Lookup) {
+// backoff, see retrieve. A domain which is already being retrieved is not
+// requested again, the result of the retrieval in progress is returned.
+func (r *Retriever) Retrieve(originalCtx context.Context, domain string, cached *api.Lookup) api.Lookup {
+	r.mux.Lock()
+	if inflight, ok := r.inflight[domain]; ok {
+		r.mux.Unlock()
+		metrics.DomainsSourceCoalescedLookups.Inc()
+
+		<-inflight.done
+		return inflight.lookup
+	}
+
+	inflight := &retrieval{done: make(chan struct{})}
+	r.inflight[domain] = inflight
+	r.mux.Unlock()
+
+	inflight.lookup = r.retrieve(originalCtx, domain, cached)
+
+	r.mux.Lock()
+	delete(r.inflight, domain)
+	r.mux.Unlock()
+	close(inflight.done)
+
+	return inflight.lookup
+}
+
+// retrieve retrieves a lookup response from external source with timeout and
+// backoff. It has its own context with timeout. When cached is not nil and
+// the client supports it, the lookup is only transferred again if it has been
+// modified.
+func (r *Retriever) retrieve(originalCtx context.Context, domain string, cached *api.Lookup) (lookup api.Lookup) {
 	logMsg := ""
 
-	// forward correlation_id from originalCtx to the new independent context
+	// forward correlation_id and the trace from originalCtx to the new
+	// independent context
 	correlationID := correlation.ExtractFromContext(originalCtx)
-	ctx := correlation.ContextWithCorrelation(context.Background(), correlationID)
+	ctx := correlation.ContextWithCorrelation(tracing.Detach(originalCtx), correlationID)
 
 	ctx, cancel := context.WithTimeout(ctx, r.retrievalTimeout)
 	defer cancel()
@@ -49,7 +98,7 @@ func (r *Retriever) Retrieve(originalCtx context.Context, domain string) (lookup
 	case <-ctx.Done():
 		logMsg = "retrieval context done"
 		lookup = api.Lookup{Error: fmt.Errorf(logMsg+": %w", ctx.Err())}
-	case lookup = <-r.resolveWithBackoff(ctx, domain):
+	case lookup = <-r.resolveWithBackoff(ctx, domain, cached):
 		logMsg = "retrieval response sent"
 	}
 
@@ -59,22 +108,26 @@ func (r *Retriever) Retrieve(originalCtx context.Context, domain string) (lookup
 		"lookup_name":      lookup.Name,
 		"lookup_paths":     lookup.Domain,
 		"lookup_error":     lookup.Error,
+		"not_modified":     lookup.NotModified,
 	}).WithError(ctx.Err()).Debug(logMsg)
 
 	return lookup
 }
 
-func (r *Retriever) resolveWithBackoff(ctx context.Context, domainName string) <-chan api.Lookup {
+func (r *Retriever) resolveWithBackoff(ctx context.Context, domainName string, cached *api.Lookup) <-chan api.Lookup {
 	response := make(chan api.Lookup)
 
 	go func() {
 		var lookup api.Lookup
 
 		for i := 1; i <= r.maxRetrievalRetries; i++ {
-			lookup = r.client.GetLookup(ctx, domainName)
+			lookup = r.getLookup(ctx, domainName, cached)
 			if lookup.Error == nil || errors.Is(lookup.Error, domain.ErrDomainDoesNotExist) ||
-				errors.Is(lookup.Error, client.ErrUnauthorizedAPI) {
-				// do not retry if the domain does not exist or there is an auth error
+				errors.Is(lookup.Error, client.ErrUnauthorizedAPI) ||
+				errors.Is(lookup.Error, client.ErrLookupTooLarge) ||
+				errors.Is(lookup.Error, client.ErrTooManyLookupPaths) {
+				// do not retry if the domain does not exist, there is an auth error
+				// or the domain configuration exceeds a limit
 				break
 			}
 
@@ -87,3 +140,15 @@ func (r *Retriever) resolveWithBackoff(ctx context.Context, domainName string) <
 
 	return response
 }
+
+func (r *Retriever) getLookup(ctx context.Context, domainName string, cached *api.Lookup) api.Lookup {
+	if client, ok := r.client.(api.ConditionalClient); ok && cached != nil {
+		return client.GetLookupIfModified(ctx, domainName, cached)
+	}
+
+	if r.batcher != nil {
+		return r.batcher.GetLookup(ctx, domainName)
+	}
+
+	return r.client.GetLookup(ctx, domainName)
+}
@@ -4,4 +4,8 @@ package cache
 type Store interface {
 	LoadOrCreate(domain string) *Entry
 	ReplaceOrCreate(domain string, entry *Entry) *Entry
+	Extend(domain string, entry *Entry)
+	Delete(domain string) bool
+	Entries() []*Entry
+	Clear() int
 }
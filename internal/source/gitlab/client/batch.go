@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+)
+
+// GetLookups returns the lookups of domains, in the same order, retrieved
+// with a single request to the batch endpoint of the internal API. GitLab
+// responds with an object of the configuration of each host, the hosts
+// which are not Pages domains are missing from it. The lookups are retrieved
+// one by one from GitLab versions without the batch endpoint.
+// It implements api.BatchClient.
+func (gc *Client) GetLookups(ctx context.Context, domains []string) []api.Lookup {
+	if atomic.LoadInt32(&gc.batchUnsupported) == 0 {
+		lookups, err := gc.getBatch(ctx, domains)
+		if !errors.Is(err, errNotFound) {
+			return lookups
+		}
+
+		atomic.StoreInt32(&gc.batchUnsupported, 1)
+	}
+
+	lookups := make([]api.Lookup, len(domains))
+
+	var wg sync.WaitGroup
+	for i := range domains {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lookups[i] = gc.GetLookup(ctx, domains[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return lookups
+}
+
+func (gc *Client) getBatch(ctx context.Context, domains []string) ([]api.Lookup, error) {
+	lookups := make([]api.Lookup, len(domains))
+	for i := range domains {
+		lookups[i].Name = domains[i]
+	}
+
+	fail := func(err error) ([]api.Lookup, error) {
+		for i := range lookups {
+			lookups[i] = api.Lookup{Name: domains[i], Error: err}
+		}
+
+		return lookups, err
+	}
+
+	resp, err := gc.get(ctx, "/api/v4/internal/pages/batch", url.Values{"host": domains}, nil)
+	if err != nil {
+		return fail(err)
+	}
+
+	if resp == nil {
+		return fail(errors.New("unexpected empty batch response"))
+	}
+
+	// the maximum size applies to each domain of the batch
+	maxSize := gc.maxLookupSize * int64(len(domains))
+	body := newSizeLimitedReader(resp.Body, maxSize)
+	defer func() {
+		io.Copy(io.Discard, body)
+		resp.Body.Close()
+	}()
+
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		err := fmt.Errorf("%w of %d bytes", ErrLookupTooLarge, maxSize)
+		countRejectedLookup(err)
+
+		return fail(err)
+	}
+
+	domainsByHost, err := decodeBatch(body)
+	if err != nil {
+		countRejectedLookup(err)
+
+		return fail(err)
+	}
+
+	for i := range lookups {
+		raw, ok := domainsByHost[domains[i]]
+		if !ok || bytes.Equal(raw, []byte("null")) {
+			lookups[i].Error = domain.ErrDomainDoesNotExist
+			continue
+		}
+
+		lookups[i].Domain, lookups[i].Error = decodeVirtualDomain(bytes.NewReader(raw), gc.maxLookupPaths)
+		if lookups[i].Error != nil {
+			lookups[i].Domain = nil
+			countRejectedLookup(lookups[i].Error)
+		}
+	}
+
+	return lookups, nil
+}
+
+// decodeBatch decodes the configuration of each host of a batch response,
+// the configurations are decoded with decodeVirtualDomain afterwards
+func decodeBatch(r io.Reader) (map[string]json.RawMessage, error) {
+	domainsByHost := map[string]json.RawMessage{}
+	if err := json.NewDecoder(r).Decode(&domainsByHost); err != nil {
+		return nil, err
+	}
+
+	return domainsByHost, nil
+}
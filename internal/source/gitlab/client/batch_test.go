@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+)
+
+func TestGetLookups(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/internal/pages/batch", func(w http.ResponseWriter, r *http.Request) {
+		validateToken(t, r.Header.Get("Gitlab-Pages-Api-Request"))
+		require.Equal(t, []string{"group.gitlab.io", "missing.gitlab.io", "null.gitlab.io", "large.gitlab.io"}, r.URL.Query()["host"])
+
+		fmt.Fprint(w, `{
+			"group.gitlab.io": {"certificate":"foo","key":"bar","lookup_paths":[{"prefix":"/a/"}]},
+			"null.gitlab.io": null,
+			"large.gitlab.io": {"lookup_paths":[{"prefix":"/a/"},{"prefix":"/b/"}]}
+		}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := defaultClient(t, server.URL)
+	client.maxLookupPaths = 1
+
+	lookups := client.GetLookups(context.Background(), []string{"group.gitlab.io", "missing.gitlab.io", "null.gitlab.io", "large.gitlab.io"})
+	require.Len(t, lookups, 4)
+
+	require.NoError(t, lookups[0].Error)
+	require.Equal(t, "group.gitlab.io", lookups[0].Name)
+	require.Equal(t, "foo", lookups[0].Domain.Certificate)
+	require.Len(t, lookups[0].Domain.LookupPaths, 1)
+
+	require.ErrorIs(t, lookups[1].Error, domain.ErrDomainDoesNotExist)
+	require.ErrorIs(t, lookups[2].Error, domain.ErrDomainDoesNotExist)
+
+	require.ErrorIs(t, lookups[3].Error, ErrTooManyLookupPaths)
+	require.Nil(t, lookups[3].Domain)
+}
+
+func TestGetLookupsWithoutBatchEndpoint(t *testing.T) {
+	var batchRequests int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/internal/pages/batch", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&batchRequests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/api/v4/internal/pages", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("host") == "missing.gitlab.io" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		fmt.Fprint(w, `{"certificate":"foo","key":"bar","lookup_paths":[]}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := defaultClient(t, server.URL)
+
+	for i := 0; i < 2; i++ {
+		lookups := client.GetLookups(context.Background(), []string{"group.gitlab.io", "missing.gitlab.io"})
+		require.Len(t, lookups, 2)
+		require.NoError(t, lookups[0].Error)
+		require.Equal(t, "foo", lookups[0].Domain.Certificate)
+		require.ErrorIs(t, lookups[1].Error, domain.ErrDomainDoesNotExist)
+	}
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&batchRequests), "the batch endpoint is not requested again")
+}
+
+func TestGetLookupsErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/internal/pages/batch", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := defaultClient(t, server.URL)
+
+	lookups := client.GetLookups(context.Background(), []string{"group.gitlab.io", "other.gitlab.io"})
+	require.Len(t, lookups, 2)
+	for i, name := range []string{"group.gitlab.io", "other.gitlab.io"} {
+		require.Equal(t, name, lookups[i].Name)
+		require.ErrorIs(t, lookups[i].Error, ErrUnauthorizedAPI)
+	}
+}
@@ -2,16 +2,17 @@ package client
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"go.opentelemetry.io/otel/attribute"
 
 	"gitlab.com/gitlab-org/labkit/correlation"
 
@@ -19,6 +20,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/tracing"
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
 
@@ -35,12 +37,41 @@ const transportClientName = "gitlab_internal_api"
 // See https://gitlab.com/gitlab-org/gitlab-pages/-/issues/535 for more details.
 var ErrUnauthorizedAPI = errors.New("pages endpoint unauthorized")
 
+// errNotModified is returned when GitLab responds to a conditional request
+// with http.StatusNotModified
+var errNotModified = errors.New("not modified")
+
+// errNotFound is returned when GitLab responds with http.StatusNotFound, as
+// GitLab versions without the batch endpoint do
+var errNotFound = errors.New("HTTP status: 404")
+
+// errUnsupportedAPIVersion is returned when GitLab responds with a version
+// of the internal Pages API higher than api.MaxVersion, whose payload can't
+// be parsed
+var errUnsupportedAPIVersion = errors.New("unsupported internal Pages API version")
+
 // Client is a HTTP client to access Pages internal API
 type Client struct {
 	secretKey      []byte
 	baseURL        *url.URL
 	httpClient     *http.Client
 	jwtTokenExpiry time.Duration
+
+	// apiVersion is the version of the internal Pages API requested from
+	// GitLab, 0 negotiates the highest version supported by both sides
+	apiVersion int
+	// negotiatedVersion is the version GitLab responded with last,
+	// accessed atomically
+	negotiatedVersion int32
+
+	// maxLookupSize and maxLookupPaths limit the configuration of a domain
+	// accepted from GitLab, 0 means unlimited
+	maxLookupSize  int64
+	maxLookupPaths int
+
+	// batchUnsupported is set once GitLab has responded that it has no batch
+	// endpoint, accessed atomically
+	batchUnsupported int32
 }
 
 // NewClient initializes and returns new Client baseUrl is
@@ -86,7 +117,22 @@ func NewClient(baseURL string, secretKey []byte, connectionTimeout, jwtTokenExpi
 
 // NewFromConfig creates a new client from Config struct
 func NewFromConfig(cfg *config.GitLab) (*Client, error) {
-	return NewClient(cfg.InternalServer, cfg.APISecretKey, cfg.ClientHTTPTimeout, cfg.JWTTokenExpiration)
+	client, err := NewClient(cfg.InternalServer, cfg.APISecretKey, cfg.ClientHTTPTimeout, cfg.JWTTokenExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	client.apiVersion = cfg.APIVersion
+	client.maxLookupSize = cfg.MaxLookupSize
+	client.maxLookupPaths = cfg.MaxLookupPaths
+
+	return client, nil
+}
+
+// APIVersion returns the version of the internal Pages API negotiated with
+// GitLab, it is 0 until the first successful response has been received
+func (gc *Client) APIVersion() int {
+	return int(atomic.LoadInt32(&gc.negotiatedVersion))
 }
 
 // Resolve returns a VirtualDomain configuration wrapped into a Lookup for a
@@ -100,10 +146,51 @@ func (gc *Client) Resolve(ctx context.Context, host string) *api.Lookup {
 // GetLookup returns a VirtualDomain configuration wrapped into a Lookup for a
 // given host
 func (gc *Client) GetLookup(ctx context.Context, host string) api.Lookup {
+	return gc.GetLookupIfModified(ctx, host, nil)
+}
+
+// GetLookupIfModified returns a VirtualDomain configuration wrapped into a
+// Lookup for a given host. When cached holds the validators of a previous
+// lookup the request is conditional, and a copy of cached is returned if
+// GitLab responds that the domain has not been modified, which avoids
+// transferring domains with many lookup paths on every refresh.
+// It implements api.ConditionalClient.
+func (gc *Client) GetLookupIfModified(ctx context.Context, host string, cached *api.Lookup) api.Lookup {
+	ctx, span := tracing.Start(ctx, "gitlab.lookup", attribute.String("domain", host))
+	defer span.End()
+
+	lookup := gc.getLookupIfModified(ctx, host, cached)
+	if !errors.Is(lookup.Error, domain.ErrDomainDoesNotExist) {
+		tracing.RecordError(span, lookup.Error)
+	}
+	span.SetAttributes(attribute.Bool("not_modified", lookup.NotModified))
+
+	return lookup
+}
+
+func (gc *Client) getLookupIfModified(ctx context.Context, host string, cached *api.Lookup) api.Lookup {
 	params := url.Values{}
 	params.Set("host", host)
 
-	resp, err := gc.get(ctx, "/api/v4/internal/pages", params)
+	header := http.Header{}
+	if cached != nil && cached.Error == nil && cached.Domain != nil {
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := gc.get(ctx, "/api/v4/internal/pages", params, header)
+	if errors.Is(err, errNotModified) && len(header) > 0 {
+		lookup := *cached
+		lookup.Deprecated = false
+		lookup.NotModified = true
+
+		return lookup
+	}
+
 	if err != nil {
 		return api.Lookup{Name: host, Error: err}
 	}
@@ -112,22 +199,39 @@ func (gc *Client) GetLookup(ctx context.Context, host string) api.Lookup {
 		return api.Lookup{Name: host, Error: domain.ErrDomainDoesNotExist}
 	}
 
+	body := newSizeLimitedReader(resp.Body, gc.maxLookupSize)
+
 	// ensure that entire response body has been read and close it, to make it
 	// possible to reuse HTTP connection. In case of a JSON being invalid and
 	// larger than 512 bytes, the response body will not be closed properly, thus
-	// we need to close it manually in every case.
+	// we need to close it manually in every case. The body is read up to the
+	// maximum size only, a larger one is not worth keeping the connection.
 	defer func() {
-		io.Copy(io.Discard, resp.Body)
+		io.Copy(io.Discard, body)
 		resp.Body.Close()
 	}()
 
-	lookup := api.Lookup{Name: host}
-	lookup.Error = json.NewDecoder(resp.Body).Decode(&lookup.Domain)
+	lookup := api.Lookup{
+		Name:         host,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	if gc.maxLookupSize > 0 && resp.ContentLength > gc.maxLookupSize {
+		lookup.Error = fmt.Errorf("%w of %d bytes", ErrLookupTooLarge, gc.maxLookupSize)
+	} else {
+		lookup.Domain, lookup.Error = decodeVirtualDomain(body, gc.maxLookupPaths)
+	}
+
+	if lookup.Error != nil {
+		lookup.Domain = nil
+		countRejectedLookup(lookup.Error)
+	}
 
 	return lookup
 }
 
-func (gc *Client) get(ctx context.Context, path string, params url.Values) (*http.Response, error) {
+func (gc *Client) get(ctx context.Context, path string, params url.Values, header http.Header) (*http.Response, error) {
 	endpoint, err := gc.endpoint(path, params)
 	if err != nil {
 		return nil, err
@@ -137,6 +241,11 @@ func (gc *Client) get(ctx context.Context, path string, params url.Values) (*htt
 	if err != nil {
 		return nil, err
 	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
 	resp, err := gc.httpClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -148,6 +257,18 @@ func (gc *Client) get(ctx context.Context, path string, params url.Values) (*htt
 
 	// StatusOK means we should return the API response
 	if resp.StatusCode == http.StatusOK {
+		version := api.VersionFromContentType(resp.Header.Get("Content-Type"))
+		if version > api.MaxVersion {
+			// nolint: errcheck
+			// best effort to discard and close the response body
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			return nil, fmt.Errorf("%w: %d", errUnsupportedAPIVersion, version)
+		}
+
+		atomic.StoreInt32(&gc.negotiatedVersion, int32(version))
+
 		return resp, nil
 	}
 
@@ -159,8 +280,12 @@ func (gc *Client) get(ctx context.Context, path string, params url.Values) (*htt
 	// StatusNoContent means that a domain does not exist, it is not an error
 	if resp.StatusCode == http.StatusNoContent {
 		return nil, nil
+	} else if resp.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
 	} else if resp.StatusCode == http.StatusUnauthorized {
 		return nil, ErrUnauthorizedAPI
+	} else if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
 	}
 
 	return nil, fmt.Errorf("HTTP status: %d", resp.StatusCode)
@@ -196,17 +321,23 @@ func (gc *Client) request(ctx context.Context, method string, endpoint *url.URL)
 		return nil, err
 	}
 	req.Header.Set("Gitlab-Pages-Api-Request", token)
+	req.Header.Set("Accept", api.AcceptHeader(gc.apiVersion))
 
 	return req, nil
 }
 
 func (gc *Client) token() (string, error) {
+	return signToken(gc.secretKey, gc.jwtTokenExpiry)
+}
+
+// signToken returns the token authenticating Pages with the internal API
+func signToken(secretKey []byte, expiry time.Duration) (string, error) {
 	claims := jwt.RegisteredClaims{
 		Issuer:    "gitlab-pages",
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(gc.jwtTokenExpiry)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiry)),
 	}
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(gc.secretKey)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secretKey)
 	if err != nil {
 		return "", err
 	}
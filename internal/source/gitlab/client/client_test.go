@@ -17,6 +17,7 @@ import (
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/fixture"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
 )
 
 const (
@@ -183,6 +184,25 @@ func TestMissingDomain(t *testing.T) {
 	require.Nil(t, lookup.Domain)
 }
 
+func TestNullDomain(t *testing.T) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/v4/internal/pages", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "null")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := defaultClient(t, server.URL)
+
+	lookup := client.GetLookup(context.Background(), "group.gitlab.io")
+
+	require.ErrorIs(t, lookup.Error, domain.ErrDomainDoesNotExist)
+	require.Nil(t, lookup.Domain)
+}
+
 func TestGetVirtualDomainAuthenticatedRequest(t *testing.T) {
 	mux := http.NewServeMux()
 
@@ -234,6 +254,164 @@ func TestGetVirtualDomainAuthenticatedRequest(t *testing.T) {
 	require.Equal(t, "mygroup/myproject/public/", lookupPath.Source.Path)
 }
 
+func TestAPIVersionNegotiation(t *testing.T) {
+	tests := map[string]struct {
+		apiVersion          int
+		responseContentType string
+		expectedAccept      string
+		expectedVersion     int
+	}{
+		"negotiated": {
+			responseContentType: "application/json",
+			expectedAccept:      "application/json",
+			expectedVersion:     1,
+		},
+		"pinned_to_v1": {
+			apiVersion:          1,
+			responseContentType: "application/json",
+			expectedAccept:      "application/json",
+			expectedVersion:     1,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v4/internal/pages", func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, tt.expectedAccept, r.Header.Get("Accept"))
+
+				w.Header().Set("Content-Type", tt.responseContentType)
+				fmt.Fprint(w, `{"lookup_paths":[]}`)
+			})
+
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			client := defaultClient(t, server.URL)
+			client.apiVersion = tt.apiVersion
+			require.Zero(t, client.APIVersion(), "version is unknown before the first response")
+
+			lookup := client.GetLookup(context.Background(), "group.gitlab.io")
+			require.NoError(t, lookup.Error)
+			require.Equal(t, tt.expectedVersion, client.APIVersion())
+		})
+	}
+}
+
+func TestAPIVersionUnsupported(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/internal/pages", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", api.MediaType(api.MaxVersion+1))
+		fmt.Fprint(w, `{"lookup_paths":[]}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := defaultClient(t, server.URL)
+
+	lookup := client.GetLookup(context.Background(), "group.gitlab.io")
+	require.ErrorIs(t, lookup.Error, errUnsupportedAPIVersion)
+	require.Nil(t, lookup.Domain)
+	require.Zero(t, client.APIVersion(), "an unsupported version is not negotiated")
+}
+
+func TestGetLookupIfModified(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/internal/pages", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			require.Equal(t, lastModified, r.Header.Get("If-Modified-Since"))
+
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprint(w, `{"lookup_paths":[{"prefix":"/"}]}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := defaultClient(t, server.URL)
+
+	lookup := client.GetLookupIfModified(context.Background(), "group.gitlab.io", nil)
+	require.NoError(t, lookup.Error)
+	require.False(t, lookup.NotModified)
+	require.Equal(t, `"v1"`, lookup.ETag)
+	require.Equal(t, lastModified, lookup.LastModified)
+
+	cached := lookup
+	cached.Deprecated = true
+
+	lookup = client.GetLookupIfModified(context.Background(), "group.gitlab.io", &cached)
+	require.NoError(t, lookup.Error)
+	require.True(t, lookup.NotModified)
+	require.False(t, lookup.Deprecated)
+	require.Equal(t, cached.Domain, lookup.Domain)
+	require.Equal(t, `"v1"`, lookup.ETag)
+
+	// a failed lookup is never sent as a validator
+	failed := api.Lookup{Name: "group.gitlab.io", ETag: `"v1"`, Error: errors.New("failed")}
+
+	lookup = client.GetLookupIfModified(context.Background(), "group.gitlab.io", &failed)
+	require.NoError(t, lookup.Error)
+	require.False(t, lookup.NotModified)
+	require.Len(t, lookup.Domain.LookupPaths, 1)
+}
+
+func TestGetLookupLimits(t *testing.T) {
+	const response = `{"certificate":"foo","key":"bar","lookup_paths":[{"prefix":"/a/"},{"prefix":"/b/"}]}`
+
+	tests := map[string]struct {
+		maxLookupSize  int64
+		maxLookupPaths int
+		expectedErr    error
+	}{
+		"within_limits": {
+			maxLookupSize:  int64(len(response)),
+			maxLookupPaths: 2,
+		},
+		"too_large": {
+			maxLookupSize: int64(len(response)) - 1,
+			expectedErr:   ErrLookupTooLarge,
+		},
+		"too_many_lookup_paths": {
+			maxLookupPaths: 1,
+			expectedErr:    ErrTooManyLookupPaths,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v4/internal/pages", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, response)
+			})
+
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			client := defaultClient(t, server.URL)
+			client.maxLookupSize = tt.maxLookupSize
+			client.maxLookupPaths = tt.maxLookupPaths
+
+			lookup := client.GetLookup(context.Background(), "group.gitlab.io")
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, lookup.Error, tt.expectedErr)
+				require.Nil(t, lookup.Domain)
+				return
+			}
+
+			require.NoError(t, lookup.Error)
+			require.Len(t, lookup.Domain.LookupPaths, 2)
+		})
+	}
+}
+
 func validateToken(t *testing.T, tokenString string) {
 	t.Helper()
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+var (
+	// ErrLookupTooLarge is returned when the configuration of a domain sent
+	// by GitLab is larger than the configured maximum size
+	ErrLookupTooLarge = errors.New("domain configuration exceeds the maximum size")
+	// ErrTooManyLookupPaths is returned when the configuration of a domain
+	// sent by GitLab has more lookup paths than the configured maximum
+	ErrTooManyLookupPaths = errors.New("domain configuration exceeds the maximum number of lookup paths")
+)
+
+// sizeLimitedReader fails with ErrLookupTooLarge once more than limit bytes
+// have been read from r, a limit of 0 or less means unlimited
+type sizeLimitedReader struct {
+	r         io.Reader
+	limit     int64
+	remaining int64
+}
+
+func newSizeLimitedReader(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+
+	return &sizeLimitedReader{r: r, limit: limit, remaining: limit}
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// a body of exactly limit bytes is fine, probe for more
+		var probe [1]byte
+		if n, err := l.r.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+
+		return 0, fmt.Errorf("%w of %d bytes", ErrLookupTooLarge, l.limit)
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+
+	return n, err
+}
+
+// decodeVirtualDomain decodes a VirtualDomain from r, lookup paths are
+// decoded one by one so a domain with too many of them is rejected before it
+// has been read entirely. A null domain does not exist.
+func decodeVirtualDomain(r io.Reader, maxLookupPaths int) (*api.VirtualDomain, error) {
+	dec := json.NewDecoder(r)
+
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if token == nil {
+		return nil, domain.ErrDomainDoesNotExist
+	}
+
+	if token != json.Delim('{') {
+		return nil, fmt.Errorf("unexpected JSON token %v, expected {", token)
+	}
+
+	// all the fields but the lookup paths are small, they are decoded into
+	// the VirtualDomain at once to keep its JSON tags authoritative
+	fields := map[string]json.RawMessage{}
+	var lookupPaths []api.LookupPath
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected JSON token %v", token)
+		}
+
+		if key != "lookup_paths" {
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return nil, err
+			}
+
+			fields[key] = value
+			continue
+		}
+
+		lookupPaths, err = decodeLookupPaths(dec, maxLookupPaths)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var virtualDomain api.VirtualDomain
+	if err := json.Unmarshal(raw, &virtualDomain); err != nil {
+		return nil, err
+	}
+
+	virtualDomain.LookupPaths = lookupPaths
+
+	return &virtualDomain, nil
+}
+
+func decodeLookupPaths(dec *json.Decoder, maxLookupPaths int) ([]api.LookupPath, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if token == nil {
+		return nil, nil
+	}
+
+	if token != json.Delim('[') {
+		return nil, fmt.Errorf("unexpected JSON token %v, expected lookup paths", token)
+	}
+
+	lookupPaths := []api.LookupPath{}
+
+	for dec.More() {
+		if maxLookupPaths > 0 && len(lookupPaths) >= maxLookupPaths {
+			return nil, fmt.Errorf("%w of %d", ErrTooManyLookupPaths, maxLookupPaths)
+		}
+
+		var lookupPath api.LookupPath
+		if err := dec.Decode(&lookupPath); err != nil {
+			return nil, err
+		}
+
+		lookupPaths = append(lookupPaths, lookupPath)
+	}
+
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, err
+	}
+
+	return lookupPaths, nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("unexpected JSON token %v, expected %v", token, delim)
+	}
+
+	return nil
+}
+
+// countRejectedLookup counts lookups rejected for exceeding a limit
+func countRejectedLookup(err error) {
+	switch {
+	case errors.Is(err, ErrLookupTooLarge):
+		metrics.DomainsSourceRejectedLookups.WithLabelValues("size").Inc()
+	case errors.Is(err, ErrTooManyLookupPaths):
+		metrics.DomainsSourceRejectedLookups.WithLabelValues("lookup_paths").Inc()
+	}
+}
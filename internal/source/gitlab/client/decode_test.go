@@ -0,0 +1,81 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+)
+
+func TestDecodeVirtualDomain(t *testing.T) {
+	tests := map[string]struct {
+		body                string
+		maxLookupPaths      int
+		expectedErr         error
+		expectedLookupPaths int
+	}{
+		"unlimited": {
+			body:                `{"certificate":"foo","lookup_paths":[{"prefix":"/a"},{"prefix":"/b"}],"key":"bar"}`,
+			expectedLookupPaths: 2,
+		},
+		"at_the_limit": {
+			body:                `{"certificate":"foo","lookup_paths":[{"prefix":"/a"},{"prefix":"/b"}],"key":"bar"}`,
+			maxLookupPaths:      2,
+			expectedLookupPaths: 2,
+		},
+		"too_many_lookup_paths": {
+			body:           `{"certificate":"foo","lookup_paths":[{"prefix":"/a"},{"prefix":"/b"}],"key":"bar"}`,
+			maxLookupPaths: 1,
+			expectedErr:    ErrTooManyLookupPaths,
+		},
+		"null_lookup_paths": {
+			body:           `{"certificate":"foo","lookup_paths":null,"key":"bar"}`,
+			maxLookupPaths: 1,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			domain, err := decodeVirtualDomain(strings.NewReader(tt.body), tt.maxLookupPaths)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, "foo", domain.Certificate)
+			require.Equal(t, "bar", domain.Key)
+			require.Len(t, domain.LookupPaths, tt.expectedLookupPaths)
+		})
+	}
+}
+
+func TestDecodeVirtualDomainInvalid(t *testing.T) {
+	for _, body := range []string{``, `[]`, `{"lookup_paths":{}}`, `{"lookup_paths":[{"prefix":1}]}`, `{"key":"bar"`} {
+		_, err := decodeVirtualDomain(strings.NewReader(body), 0)
+		require.Error(t, err, body)
+	}
+}
+
+func TestDecodeVirtualDomainNull(t *testing.T) {
+	virtualDomain, err := decodeVirtualDomain(strings.NewReader(`null`), 0)
+	require.ErrorIs(t, err, domain.ErrDomainDoesNotExist)
+	require.Nil(t, virtualDomain)
+}
+
+func TestSizeLimitedReader(t *testing.T) {
+	content, err := io.ReadAll(newSizeLimitedReader(strings.NewReader("12345"), 5))
+	require.NoError(t, err)
+	require.Equal(t, "12345", string(content))
+
+	_, err = io.ReadAll(newSizeLimitedReader(strings.NewReader("123456"), 5))
+	require.True(t, errors.Is(err, ErrLookupTooLarge))
+
+	content, err = io.ReadAll(newSizeLimitedReader(strings.NewReader("123456"), 0))
+	require.NoError(t, err)
+	require.Equal(t, "123456", string(content))
+}
@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	grpccorrelation "gitlab.com/gitlab-org/labkit/correlation/grpc"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/pagespb"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// grpcTokenMetadata carries the same token as the Gitlab-Pages-Api-Request
+// header of the internal API
+const grpcTokenMetadata = "gitlab-pages-api-request"
+
+// GRPCClient is a gRPC client of the domain lookups of GitLab, it keeps a
+// single connection open instead of a request per lookup, and receives the
+// domains as protobuf messages, see pagespb
+type GRPCClient struct {
+	conn    *grpc.ClientConn
+	lookups pagespb.LookupServiceClient
+	timeout time.Duration
+
+	// maxLookupSize and maxLookupPaths limit the configuration of a domain
+	// accepted from GitLab, 0 means unlimited
+	maxLookupSize  int64
+	maxLookupPaths int
+
+	// responded is set once GitLab has responded, accessed atomically
+	responded int32
+}
+
+// NewGRPCClient returns a GRPCClient of the gRPC server at address, a
+// grpc:// or grpcs:// URL, without connecting to it yet
+func NewGRPCClient(address string, secretKey []byte, connectionTimeout, jwtTokenExpiry time.Duration) (*GRPCClient, error) {
+	if len(address) == 0 || len(secretKey) == 0 {
+		return nil, errors.New("GitLab gRPC server or API secret has not been provided")
+	}
+
+	parsedURL, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if connectionTimeout == 0 {
+		return nil, errors.New("GitLab gRPC client connection timeout has not been provided")
+	}
+
+	if jwtTokenExpiry == 0 {
+		return nil, errors.New("GitLab JWT token expiry has not been provided")
+	}
+
+	var transport grpc.DialOption
+	switch parsedURL.Scheme {
+	case "grpc":
+		transport = grpc.WithInsecure()
+	case "grpcs":
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12}))
+	default:
+		return nil, fmt.Errorf("unsupported GitLab gRPC server scheme %q", parsedURL.Scheme)
+	}
+
+	conn, err := grpc.Dial(parsedURL.Host,
+		transport,
+		grpc.WithPerRPCCredentials(tokenCredentials{secretKey: secretKey, expiry: jwtTokenExpiry}),
+		grpc.WithChainUnaryInterceptor(
+			grpccorrelation.UnaryClientCorrelationInterceptor(grpccorrelation.WithClientName(transportClientName)),
+			meteredUnaryInterceptor,
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GRPCClient{conn: conn, lookups: pagespb.NewLookupServiceClient(conn), timeout: connectionTimeout}, nil
+}
+
+// NewGRPCFromConfig creates a new gRPC client from Config struct
+func NewGRPCFromConfig(cfg *config.GitLab) (*GRPCClient, error) {
+	client, err := NewGRPCClient(cfg.GRPCServer, cfg.APISecretKey, cfg.ClientHTTPTimeout, cfg.JWTTokenExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	client.maxLookupSize = cfg.MaxLookupSize
+	client.maxLookupPaths = cfg.MaxLookupPaths
+
+	return client, nil
+}
+
+// APIVersion returns the version of the internal Pages API matching the
+// messages of the gRPC server, it is 0 until GitLab has responded
+func (gc *GRPCClient) APIVersion() int {
+	if atomic.LoadInt32(&gc.responded) == 0 {
+		return 0
+	}
+
+	return api.MaxVersion
+}
+
+// Close closes the connection to the gRPC server
+func (gc *GRPCClient) Close() error {
+	return gc.conn.Close()
+}
+
+// Resolve returns a VirtualDomain configuration wrapped into a Lookup for a
+// given host. It implements api.Resolve type.
+func (gc *GRPCClient) Resolve(ctx context.Context, host string) *api.Lookup {
+	lookup := gc.GetLookup(ctx, host)
+
+	return &lookup
+}
+
+// GetLookup returns a VirtualDomain configuration wrapped into a Lookup for a
+// given host
+func (gc *GRPCClient) GetLookup(ctx context.Context, host string) api.Lookup {
+	return gc.GetLookupIfModified(ctx, host, nil)
+}
+
+// GetLookupIfModified returns a VirtualDomain configuration wrapped into a
+// Lookup for a given host, or a copy of cached if its etag is still current.
+// It implements api.ConditionalClient.
+func (gc *GRPCClient) GetLookupIfModified(ctx context.Context, host string, cached *api.Lookup) api.Lookup {
+	req := &pagespb.VirtualDomainRequest{Host: host}
+	conditional := cached != nil && cached.Error == nil && cached.Domain != nil && cached.ETag != ""
+	if conditional {
+		req.IfNoneMatch = cached.ETag
+	}
+
+	resp, err := gc.invoke(ctx, req)
+	if err != nil {
+		countRejectedLookup(err)
+
+		return api.Lookup{Name: host, Error: err}
+	}
+
+	atomic.StoreInt32(&gc.responded, 1)
+
+	if resp.GetNotModified() {
+		if !conditional {
+			return api.Lookup{Name: host, Error: errors.New("unexpected not modified response")}
+		}
+
+		lookup := *cached
+		lookup.Deprecated = false
+		lookup.NotModified = true
+
+		return lookup
+	}
+
+	if resp.GetDomain() == nil {
+		return api.Lookup{Name: host, Error: domain.ErrDomainDoesNotExist}
+	}
+
+	virtualDomain, err := virtualDomainFromProto(resp.GetDomain(), gc.maxLookupPaths)
+	if err != nil {
+		countRejectedLookup(err)
+
+		return api.Lookup{Name: host, Error: err}
+	}
+
+	return api.Lookup{Name: host, ETag: resp.GetEtag(), Domain: virtualDomain}
+}
+
+func (gc *GRPCClient) invoke(ctx context.Context, req *pagespb.VirtualDomainRequest) (*pagespb.VirtualDomainResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, gc.timeout)
+	defer cancel()
+
+	maxSize := math.MaxInt32
+	if gc.maxLookupSize > 0 && gc.maxLookupSize < math.MaxInt32 {
+		maxSize = int(gc.maxLookupSize)
+	}
+
+	resp, err := gc.lookups.GetVirtualDomain(ctx, req, grpc.MaxCallRecvMsgSize(maxSize))
+	if err == nil {
+		return resp, nil
+	}
+
+	switch status.Code(err) {
+	case codes.NotFound:
+		return nil, domain.ErrDomainDoesNotExist
+	case codes.Unauthenticated:
+		return nil, ErrUnauthorizedAPI
+	case codes.ResourceExhausted:
+		return nil, fmt.Errorf("%w of %d bytes", ErrLookupTooLarge, maxSize)
+	}
+
+	return nil, err
+}
+
+// meteredUnaryInterceptor records the calls to the gRPC server with the
+// metrics of the internal API, labelled with the gRPC status code
+func meteredUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+
+	code := httpStatusCode(status.Code(err))
+	metrics.DomainsSourceAPICallDuration.WithLabelValues(code).Observe(time.Since(start).Seconds())
+	metrics.DomainsSourceAPIReqTotal.WithLabelValues(code).Inc()
+
+	return err
+}
+
+// grpcHTTPStatus maps the gRPC codes to the HTTP status codes the internal API
+// responds with, so that the metrics of both transports share their labels
+var grpcHTTPStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499, // client closed request
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+func httpStatusCode(code codes.Code) string {
+	httpStatus, ok := grpcHTTPStatus[code]
+	if !ok {
+		httpStatus = http.StatusInternalServerError
+	}
+
+	return strconv.Itoa(httpStatus)
+}
+
+// tokenCredentials sends a new token with every call
+type tokenCredentials struct {
+	secretKey []byte
+	expiry    time.Duration
+}
+
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := signToken(c.secretKey, c.expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{grpcTokenMetadata: token}, nil
+}
+
+// RequireTransportSecurity is false so that grpc:// servers can be used
+// inside a trusted network, as with the http internal API
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
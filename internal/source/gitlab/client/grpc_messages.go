@@ -0,0 +1,86 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/pagespb"
+)
+
+// virtualDomainFromProto returns the api.VirtualDomain of a message of the
+// gRPC server, a domain with more than maxLookupPaths lookup paths is rejected
+func virtualDomainFromProto(d *pagespb.VirtualDomain, maxLookupPaths int) (*api.VirtualDomain, error) {
+	if maxLookupPaths > 0 && len(d.GetLookupPaths()) > maxLookupPaths {
+		return nil, fmt.Errorf("%w of %d", ErrTooManyLookupPaths, maxLookupPaths)
+	}
+
+	domain := &api.VirtualDomain{
+		Certificate: d.GetCertificate(),
+		Key:         d.GetKey(),
+	}
+
+	if tls := d.GetTls(); tls != nil {
+		domain.TLS = &api.TLSPolicy{
+			MinVersion:           tls.GetMinVersion(),
+			ClientAuth:           tls.GetClientAuth(),
+			ClientCACertificates: tls.GetClientCaCertificates(),
+		}
+	}
+
+	if limit := d.GetRateLimit(); limit != nil {
+		domain.RateLimit = &api.RateLimit{
+			LimitPerSecond: limit.GetLimitPerSecond(),
+			Burst:          int(limit.GetBurst()),
+		}
+	}
+
+	for _, l := range d.GetLookupPaths() {
+		domain.LookupPaths = append(domain.LookupPaths, lookupPathFromProto(l))
+	}
+
+	return domain, nil
+}
+
+func lookupPathFromProto(l *pagespb.LookupPath) api.LookupPath {
+	lookupPath := api.LookupPath{
+		ProjectID:     int(l.GetProjectId()),
+		AccessControl: l.GetAccessControl(),
+		HTTPSOnly:     l.GetHttpsOnly(),
+		Prefix:        l.GetPrefix(),
+		Source: api.Source{
+			Type:   l.GetSource().GetType(),
+			Path:   l.GetSource().GetPath(),
+			SHA256: l.GetSource().GetSha256(),
+			Count:  int(l.GetSource().GetFileCount()),
+			Size:   int(l.GetSource().GetFileSize()),
+		},
+		PublishAt:   timeFromProto(l.GetPublishAt()),
+		UnpublishAt: timeFromProto(l.GetUnpublishAt()),
+	}
+
+	if sso := l.GetGroupSso(); sso != nil {
+		lookupPath.GroupSSO = &api.GroupSSO{
+			GroupID:   int(sso.GetGroupId()),
+			SignInURL: sso.GetSignInUrl(),
+		}
+	}
+
+	if len(l.GetHeaders()) > 0 {
+		lookupPath.Headers = l.GetHeaders()
+	}
+
+	return lookupPath
+}
+
+func timeFromProto(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+
+	t := ts.AsTime()
+
+	return &t
+}
@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/pagespb"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestVirtualDomainFromProto(t *testing.T) {
+	publishAt := time.Date(2021, 10, 1, 12, 30, 0, 500, time.UTC)
+
+	sent := &pagespb.VirtualDomain{
+		Certificate: "cert",
+		Key:         "key",
+		Tls:         &pagespb.TLSPolicy{MinVersion: "tls1.3", ClientAuth: "require"},
+		RateLimit:   &pagespb.RateLimit{LimitPerSecond: 2.5, Burst: 10},
+		LookupPaths: []*pagespb.LookupPath{
+			{
+				ProjectId:     123,
+				AccessControl: true,
+				HttpsOnly:     true,
+				Prefix:        "/project",
+				Source:        &pagespb.Source{Type: "zip", Path: "https://example.com/a.zip", Sha256: "sha", FileCount: 3, FileSize: 4096},
+				PublishAt:     timestamppb.New(publishAt),
+				GroupSso:      &pagespb.GroupSSO{GroupId: 9, SignInUrl: "https://gitlab.example.com/groups/g/-/saml/sso"},
+				Headers:       map[string]string{"Content-Security-Policy": "default-src 'self'", "X-Empty": ""},
+			},
+			{Prefix: "/"},
+		},
+	}
+
+	expected := &api.VirtualDomain{
+		Certificate: "cert",
+		Key:         "key",
+		TLS:         &api.TLSPolicy{MinVersion: "tls1.3", ClientAuth: "require"},
+		RateLimit:   &api.RateLimit{LimitPerSecond: 2.5, Burst: 10},
+		LookupPaths: []api.LookupPath{
+			{
+				ProjectID:     123,
+				AccessControl: true,
+				HTTPSOnly:     true,
+				Prefix:        "/project",
+				Source:        api.Source{Type: "zip", Path: "https://example.com/a.zip", SHA256: "sha", Count: 3, Size: 4096},
+				PublishAt:     &publishAt,
+				GroupSSO:      &api.GroupSSO{GroupID: 9, SignInURL: "https://gitlab.example.com/groups/g/-/saml/sso"},
+				Headers:       map[string]string{"Content-Security-Policy": "default-src 'self'", "X-Empty": ""},
+			},
+			{Prefix: "/"},
+		},
+	}
+
+	// the domain goes through the wire format, as it does from the server
+	b, err := proto.Marshal(sent)
+	require.NoError(t, err)
+
+	received := &pagespb.VirtualDomain{}
+	require.NoError(t, proto.Unmarshal(b, received))
+
+	domain, err := virtualDomainFromProto(received, 0)
+	require.NoError(t, err)
+	require.Equal(t, expected, domain)
+
+	t.Run("too_many_lookup_paths", func(t *testing.T) {
+		_, err := virtualDomainFromProto(received, 1)
+		require.ErrorIs(t, err, ErrTooManyLookupPaths)
+	})
+}
+
+func TestGRPCClientGetLookup(t *testing.T) {
+	tokens := make(chan string, 1)
+	client := grpcTestClient(t, func(ctx context.Context, req *pagespb.VirtualDomainRequest) (*pagespb.VirtualDomainResponse, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if len(md.Get(grpcTokenMetadata)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "missing token")
+		}
+
+		select {
+		case tokens <- md.Get(grpcTokenMetadata)[0]:
+		default:
+		}
+
+		switch req.GetHost() {
+		case "group.gitlab.io":
+			if req.GetIfNoneMatch() == `"v1"` {
+				return &pagespb.VirtualDomainResponse{NotModified: true}, nil
+			}
+
+			return &pagespb.VirtualDomainResponse{
+				Etag: `"v1"`,
+				Domain: &pagespb.VirtualDomain{
+					LookupPaths: []*pagespb.LookupPath{{ProjectId: 1, Prefix: "/"}, {ProjectId: 2, Prefix: "/a"}},
+				},
+			}, nil
+		case "unauthorized.gitlab.io":
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+
+	require.Zero(t, client.APIVersion())
+
+	lookup := client.GetLookup(context.Background(), "group.gitlab.io")
+	require.NoError(t, lookup.Error)
+	require.Equal(t, `"v1"`, lookup.ETag)
+	require.Len(t, lookup.Domain.LookupPaths, 2)
+	require.Equal(t, api.MaxVersion, client.APIVersion())
+	validateToken(t, <-tokens)
+
+	t.Run("not_modified", func(t *testing.T) {
+		refreshed := client.GetLookupIfModified(context.Background(), "group.gitlab.io", &lookup)
+		require.NoError(t, refreshed.Error)
+		require.True(t, refreshed.NotModified)
+		require.Equal(t, lookup.Domain, refreshed.Domain)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		before := testutil.ToFloat64(metrics.DomainsSourceAPIReqTotal.WithLabelValues("404"))
+
+		lookup := client.GetLookup(context.Background(), "missing.gitlab.io")
+		require.ErrorIs(t, lookup.Error, domain.ErrDomainDoesNotExist)
+		require.Equal(t, before+1, testutil.ToFloat64(metrics.DomainsSourceAPIReqTotal.WithLabelValues("404")))
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		lookup := client.GetLookup(context.Background(), "unauthorized.gitlab.io")
+		require.ErrorIs(t, lookup.Error, ErrUnauthorizedAPI)
+	})
+
+	t.Run("too_many_lookup_paths", func(t *testing.T) {
+		client.maxLookupPaths = 1
+		defer func() { client.maxLookupPaths = 0 }()
+
+		lookup := client.GetLookup(context.Background(), "group.gitlab.io")
+		require.ErrorIs(t, lookup.Error, ErrTooManyLookupPaths)
+		require.Nil(t, lookup.Domain)
+	})
+
+	t.Run("too_large", func(t *testing.T) {
+		client.maxLookupSize = 8
+		defer func() { client.maxLookupSize = 0 }()
+
+		lookup := client.GetLookup(context.Background(), "group.gitlab.io")
+		require.ErrorIs(t, lookup.Error, ErrLookupTooLarge)
+	})
+}
+
+func TestNewGRPCClientInvalidConfiguration(t *testing.T) {
+	tests := map[string]string{
+		"no_address":   "",
+		"http_address": "https://gitlab.example.com",
+	}
+
+	for name, address := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewGRPCClient(address, secretKey(t), defaultClientConnTimeout, defaultJWTTokenExpiry)
+			require.Error(t, err)
+		})
+	}
+}
+
+// lookupServer answers the lookups with handler
+type lookupServer struct {
+	pagespb.UnimplementedLookupServiceServer
+
+	handler func(context.Context, *pagespb.VirtualDomainRequest) (*pagespb.VirtualDomainResponse, error)
+}
+
+func (s *lookupServer) GetVirtualDomain(ctx context.Context, req *pagespb.VirtualDomainRequest) (*pagespb.VirtualDomainResponse, error) {
+	return s.handler(ctx, req)
+}
+
+// grpcTestClient returns a client of a gRPC server answering the lookups
+// with handler
+func grpcTestClient(t *testing.T, handler func(context.Context, *pagespb.VirtualDomainRequest) (*pagespb.VirtualDomainResponse, error)) *GRPCClient {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	pagespb.RegisterLookupServiceServer(server, &lookupServer{handler: handler})
+
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := NewGRPCClient("grpc://"+listener.Addr().String(), secretKey(t), defaultClientConnTimeout, defaultJWTTokenExpiry)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
@@ -3,14 +3,19 @@ package gitlab
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gitlab.com/gitlab-org/labkit/log"
+	"golang.org/x/net/http/httpguts"
 
+	"gitlab.com/gitlab-org/gitlab-pages/internal/deprecation"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
-	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/local"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/zip"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/proxy"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/unpublished"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
 )
 
@@ -22,7 +27,7 @@ var (
 // `size` argument is DEPRECATED, see
 // https://gitlab.com/gitlab-org/gitlab-pages/issues/272
 func fabricateLookupPath(size int, lookup api.LookupPath) *serving.LookupPath {
-	return &serving.LookupPath{
+	lookupPath := &serving.LookupPath{
 		ServingType:        lookup.Source.Type,
 		Path:               lookup.Source.Path,
 		SHA256:             lookup.Source.SHA256,
@@ -32,10 +37,68 @@ func fabricateLookupPath(size int, lookup api.LookupPath) *serving.LookupPath {
 		HasAccessControl:   lookup.AccessControl,
 		ProjectID:          uint64(lookup.ProjectID),
 	}
+
+	if lookup.GroupSSO != nil && lookup.GroupSSO.GroupID > 0 {
+		lookupPath.SSOGroupID = uint64(lookup.GroupSSO.GroupID)
+		lookupPath.SSOSignInURL = lookup.GroupSSO.SignInURL
+	}
+
+	lookupPath.Headers = fabricateHeaders(lookup.Headers)
+
+	return lookupPath
 }
 
-// fabricateServing fabricates serving based on the GitLab API response
-func (g *Gitlab) fabricateServing(lookup api.LookupPath) (serving.Serving, error) {
+// reservedHeaders are managed by Pages itself, or would affect the other
+// projects sharing the domain, and cannot be set by a project
+var reservedHeaders = map[string]bool{
+	"Connection":                true,
+	"Content-Encoding":          true,
+	"Content-Length":            true,
+	"Content-Range":             true,
+	"Content-Type":              true,
+	"Date":                      true,
+	"Keep-Alive":                true,
+	"Location":                  true,
+	"Proxy-Connection":          true,
+	"Set-Cookie":                true,
+	"Strict-Transport-Security": true,
+	"Te":                        true,
+	"Trailer":                   true,
+	"Transfer-Encoding":         true,
+	"Upgrade":                   true,
+	"Vary":                      true,
+	"Www-Authenticate":          true,
+}
+
+// fabricateHeaders returns the headers of a project, the invalid and the
+// reserved ones are left out. The lookup paths are fabricated for every
+// request, so they are left out silently.
+func fabricateHeaders(headers map[string]string) http.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	fabricated := make(http.Header, len(headers))
+	for name, value := range headers {
+		canonical := http.CanonicalHeaderKey(name)
+
+		if !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidHeaderFieldValue(value) || reservedHeaders[canonical] {
+			continue
+		}
+
+		fabricated.Set(canonical, value)
+	}
+
+	return fabricated
+}
+
+// fabricateServing fabricates serving based on the GitLab API response, a
+// placeholder is served for deployments outside of their publication window
+func (g *Gitlab) fabricateServing(lookup api.LookupPath, now time.Time) (serving.Serving, error) {
+	if !lookup.IsPublished(now) {
+		return unpublished.Instance(), nil
+	}
+
 	source := lookup.Source
 	if err := g.checkDiskAllowed(lookup.ProjectID, source); err != nil {
 		return nil, err
@@ -43,16 +106,19 @@ func (g *Gitlab) fabricateServing(lookup api.LookupPath) (serving.Serving, error
 
 	switch source.Type {
 	case "file":
-		return local.Instance(), nil
+		deprecation.Warn(deprecation.KindSource, "file", "serving from disk is deprecated, deploy the site again so that it is served from a zip archive")
+		return g.disk, nil
 	case "zip":
 		return zip.Instance(), nil
+	case "proxy":
+		return proxy.Instance(), nil
 	}
 
 	return nil, fmt.Errorf("gitlab: unknown serving source type: %q", source.Type)
 }
 
 func (g *Gitlab) checkDiskAllowed(projectID int, source api.Source) error {
-	if !g.enableDisk {
+	if g.disk == nil {
 		if source.Type == "file" || strings.HasPrefix(source.Path, "file://") {
 			log.WithError(ErrDiskDisabled).WithFields(logrus.Fields{
 				"project_id":  projectID,
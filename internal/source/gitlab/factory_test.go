@@ -1,11 +1,15 @@
 package gitlab
 
 import (
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/local"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/unpublished"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
 )
 
@@ -27,34 +31,89 @@ func TestFabricateLookupPath(t *testing.T) {
 		require.Equal(t, path.Prefix, "/")
 		require.True(t, path.IsNamespaceProject)
 	})
+
+	t.Run("when the group of the project enforces SSO", func(t *testing.T) {
+		lookup := api.LookupPath{
+			Prefix:   "/",
+			GroupSSO: &api.GroupSSO{GroupID: 7, SignInURL: "https://gitlab.example.com/groups/group/-/saml/sso"},
+		}
+
+		path := fabricateLookupPath(1, lookup)
+
+		require.Equal(t, uint64(7), path.SSOGroupID)
+		require.Equal(t, "https://gitlab.example.com/groups/group/-/saml/sso", path.SSOSignInURL)
+	})
 }
 
 func TestFabricateServing(t *testing.T) {
 	t.Run("when lookup path requires disk serving", func(t *testing.T) {
 		g := Gitlab{
-			enableDisk: true,
+			disk: local.Instance(),
 		}
 
 		lookup := api.LookupPath{
 			Prefix: "/",
 			Source: api.Source{Type: "file"},
 		}
-		srv, err := g.fabricateServing(lookup)
+		srv, err := g.fabricateServing(lookup, time.Now())
 		require.NoError(t, err)
 		require.IsType(t, &disk.Disk{}, srv)
 	})
 
 	t.Run("when lookup path requires disk serving but disk is disabled", func(t *testing.T) {
-		g := Gitlab{
-			enableDisk: false,
-		}
+		g := Gitlab{}
 
 		lookup := api.LookupPath{
 			Prefix: "/",
 			Source: api.Source{Type: "file"},
 		}
-		srv, err := g.fabricateServing(lookup)
+		srv, err := g.fabricateServing(lookup, time.Now())
 		require.EqualError(t, err, ErrDiskDisabled.Error())
 		require.Nil(t, srv)
 	})
+
+	t.Run("when lookup path is outside of its publication window", func(t *testing.T) {
+		g := Gitlab{
+			disk: local.Instance(),
+		}
+
+		now := time.Now()
+		later := now.Add(time.Hour)
+		lookup := api.LookupPath{
+			Prefix:    "/",
+			Source:    api.Source{Type: "file"},
+			PublishAt: &later,
+		}
+
+		srv, err := g.fabricateServing(lookup, now)
+		require.NoError(t, err)
+		require.IsType(t, &unpublished.Unpublished{}, srv)
+
+		srv, err = g.fabricateServing(lookup, later)
+		require.NoError(t, err)
+		require.IsType(t, &disk.Disk{}, srv)
+	})
+}
+
+func TestFabricateHeaders(t *testing.T) {
+	lookup := api.LookupPath{
+		Prefix: "/",
+		Headers: map[string]string{
+			"content-security-policy":      "default-src 'self'",
+			"Cross-Origin-Embedder-Policy": "require-corp",
+			"Set-Cookie":                   "session=1; Domain=gitlab.io",
+			"strict-transport-security":    "max-age=31536000; includeSubDomains",
+			"Invalid Name":                 "value",
+			"X-Invalid-Value":              "line\nbreak",
+		},
+	}
+
+	path := fabricateLookupPath(1, lookup)
+
+	require.Equal(t, http.Header{
+		"Content-Security-Policy":      {"default-src 'self'"},
+		"Cross-Origin-Embedder-Policy": {"require-corp"},
+	}, path.Headers)
+
+	require.Nil(t, fabricateLookupPath(1, api.LookupPath{Prefix: "/"}).Headers)
 }
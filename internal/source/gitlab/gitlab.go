@@ -7,56 +7,193 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"time"
 
 	"gitlab.com/gitlab-org/labkit/log"
+	"go.opentelemetry.io/otel/attribute"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/local"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/cache"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/client"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/tracing"
 )
 
 // Gitlab source represent a new domains configuration source. We fetch all the
 // information about domains from GitLab instance.
 type Gitlab struct {
-	client     api.Resolver
-	enableDisk bool
+	client    api.Resolver
+	apiClient apiClient
+	// disk serves the deployments from the pages-root directory, it is nil
+	// when disk access is disabled
+	disk serving.Serving
+}
+
+// apiClient is the client of the domain lookups, over http or gRPC
+type apiClient interface {
+	api.ConditionalClient
+	APIVersion() int
 }
 
 // New returns a new instance of gitlab domain source.
 func New(cfg *config.GitLab) (*Gitlab, error) {
-	glClient, err := client.NewFromConfig(cfg)
+	var glClient apiClient
+	var err error
+	if cfg.APITransport == config.GitLabAPITransportGRPC {
+		glClient, err = client.NewGRPCFromConfig(cfg)
+	} else {
+		glClient, err = client.NewFromConfig(cfg)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	g := &Gitlab{
-		client:     cache.NewCache(glClient, &cfg.Cache),
-		enableDisk: cfg.EnableDisk,
+		client:    cache.NewCache(glClient, &cfg.Cache),
+		apiClient: glClient,
+	}
+
+	if cfg.EnableDisk {
+		g.disk = local.Instance()
 	}
 
 	return g, nil
 }
 
+// APIVersion returns the version of the internal Pages API negotiated with
+// GitLab, it is 0 until GitLab has responded
+func (g *Gitlab) APIVersion() int {
+	if g.apiClient == nil {
+		return 0
+	}
+
+	return g.apiClient.APIVersion()
+}
+
+// EvictDomain removes the lookup of name from the cache of the domains, it
+// returns false when the domain is not cached
+func (g *Gitlab) EvictDomain(name string) bool {
+	c, ok := g.client.(*cache.Cache)
+	if !ok {
+		return false
+	}
+
+	return c.Evict(name)
+}
+
+// CachedDomains returns the number of domains in the cache of the domains
+func (g *Gitlab) CachedDomains() int {
+	c, ok := g.client.(*cache.Cache)
+	if !ok {
+		return 0
+	}
+
+	return len(c.Lookups())
+}
+
+// ClearDomains removes all the domains from the cache of the domains, it
+// returns how many were cached
+func (g *Gitlab) ClearDomains() int {
+	c, ok := g.client.(*cache.Cache)
+	if !ok {
+		return 0
+	}
+
+	return c.Clear()
+}
+
+// ProjectArchives returns the cache keys of the zip archives of the project,
+// as found in the lookups of its domains in the cache of the domains
+func (g *Gitlab) ProjectArchives(projectID int) []string {
+	c, ok := g.client.(*cache.Cache)
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for _, lookup := range c.Lookups() {
+		if lookup.Domain == nil {
+			continue
+		}
+
+		for _, lookupPath := range lookup.Domain.LookupPaths {
+			if lookupPath.ProjectID == projectID && lookupPath.Source.Type == "zip" && lookupPath.Source.SHA256 != "" {
+				keys = append(keys, lookupPath.Source.SHA256)
+			}
+		}
+	}
+
+	return keys
+}
+
+// DomainArchives returns the paths of the zip archives served on the domain,
+// by sha256. The domain is evicted from the cache first, so that the lookup
+// of a deployment that just completed replaces the cached one.
+func (g *Gitlab) DomainArchives(ctx context.Context, name string) (map[string]string, error) {
+	g.EvictDomain(name)
+
+	lookup := g.client.Resolve(ctx, name)
+	if lookup.Error != nil {
+		return nil, lookup.Error
+	}
+
+	archives := map[string]string{}
+	for _, lookupPath := range lookup.Domain.LookupPaths {
+		if lookupPath.Source.Type == "zip" && lookupPath.Source.SHA256 != "" {
+			archives[lookupPath.Source.SHA256] = lookupPath.Source.Path
+		}
+	}
+
+	return archives, nil
+}
+
 // GetDomain return a representation of a domain that we have fetched from
 // GitLab
 func (g *Gitlab) GetDomain(ctx context.Context, name string) (*domain.Domain, error) {
+	ctx, span := tracing.Start(ctx, "domain.resolve", attribute.String("domain", name))
+	defer span.End()
+
 	lookup := g.client.Resolve(ctx, name)
 
 	if lookup.Error != nil {
+		if !errors.Is(lookup.Error, domain.ErrDomainDoesNotExist) {
+			tracing.RecordError(span, lookup.Error)
+		}
+
 		if errors.Is(lookup.Error, client.ErrUnauthorizedAPI) {
 			log.WithError(lookup.Error).Error("Pages cannot communicate with an instance of the GitLab API. Please sync your gitlab-secrets.json file: https://docs.gitlab.com/ee/administration/pages/#pages-cannot-communicate-with-an-instance-of-the-gitlab-api")
 		}
 
+		if errors.Is(lookup.Error, client.ErrLookupTooLarge) || errors.Is(lookup.Error, client.ErrTooManyLookupPaths) {
+			log.WithError(lookup.Error).WithField("domain", name).Error("the configuration of the domain is too large to be served, see gitlab-lookup-max-size and gitlab-lookup-max-paths")
+		}
+
 		return nil, lookup.Error
 	}
 
 	// TODO introduce a second-level cache for domains, invalidate using etags
 	// from first-level cache
 	d := domain.New(name, lookup.Domain.Certificate, lookup.Domain.Key, g)
+	d.Deprecated = lookup.Deprecated
+
+	if policy := lookup.Domain.TLS; policy != nil {
+		d.TLSPolicy = &domain.TLSPolicy{
+			MinVersion:           policy.MinVersion,
+			ClientAuth:           policy.ClientAuth,
+			ClientCACertificates: policy.ClientCACertificates,
+		}
+	}
+
+	if limit := lookup.Domain.RateLimit; limit != nil {
+		d.RateLimit = &domain.RateLimit{
+			LimitPerSecond: limit.LimitPerSecond,
+			Burst:          limit.Burst,
+		}
+	}
 
 	return d, nil
 }
@@ -87,7 +224,7 @@ func (g *Gitlab) Resolve(r *http.Request) (*serving.Request, error) {
 				subPath = strings.TrimPrefix(urlPath, lookup.Prefix)
 			}
 
-			srv, err := g.fabricateServing(lookup)
+			srv, err := g.fabricateServing(lookup, time.Now())
 			if err != nil {
 				return nil, err
 			}
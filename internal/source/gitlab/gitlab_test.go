@@ -4,10 +4,14 @@ import (
 	"context"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/local"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/api"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/cache"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/source/gitlab/client"
 )
 
@@ -32,6 +36,19 @@ func TestGetDomain(t *testing.T) {
 		require.Nil(t, domain)
 	})
 
+	t.Run("when the domain has a rate limit", func(t *testing.T) {
+		c := client.StubClient{Lookup: &api.Lookup{Domain: &api.VirtualDomain{
+			RateLimit: &api.RateLimit{LimitPerSecond: 5, Burst: 10},
+		}}}
+		source := Gitlab{client: c}
+
+		domain, err := source.GetDomain(context.Background(), "test.gitlab.io")
+		require.NoError(t, err)
+
+		require.Equal(t, 5.0, domain.RateLimit.LimitPerSecond)
+		require.Equal(t, 10, domain.RateLimit.Burst)
+	})
+
 	t.Run("when pages endpoint is unauthorized", func(t *testing.T) {
 		c := client.StubClient{Lookup: &api.Lookup{Error: client.ErrUnauthorizedAPI}}
 		source := Gitlab{client: c}
@@ -43,7 +60,7 @@ func TestGetDomain(t *testing.T) {
 
 func TestResolve(t *testing.T) {
 	client := client.StubClient{File: "client/testdata/test.gitlab.io.json"}
-	source := Gitlab{client: client, enableDisk: true}
+	source := Gitlab{client: client, disk: local.Instance()}
 
 	t.Run("when requesting nested group project with root path", func(t *testing.T) {
 		target := "https://test.gitlab.io:443/my/pages/project/"
@@ -112,7 +129,7 @@ func TestResolve(t *testing.T) {
 // Test proves fix for https://gitlab.com/gitlab-org/gitlab-pages/-/issues/576
 func TestResolveLookupPathsOrderDoesNotMatter(t *testing.T) {
 	client := client.StubClient{File: "client/testdata/group-first.gitlab.io.json"}
-	source := Gitlab{client: client, enableDisk: true}
+	source := Gitlab{client: client, disk: local.Instance()}
 
 	tests := map[string]struct {
 		target              string
@@ -151,3 +168,74 @@ func TestResolveLookupPathsOrderDoesNotMatter(t *testing.T) {
 		})
 	}
 }
+
+type lookupsClient map[string]*api.VirtualDomain
+
+func (c lookupsClient) GetLookup(_ context.Context, host string) api.Lookup {
+	return api.Lookup{Name: host, Domain: c[host]}
+}
+
+func TestProjectArchives(t *testing.T) {
+	zipPath := func(projectID int, sha256 string) api.LookupPath {
+		return api.LookupPath{ProjectID: projectID, Source: api.Source{Type: "zip", SHA256: sha256}}
+	}
+
+	c := lookupsClient{
+		"group.gitlab.io": {LookupPaths: []api.LookupPath{
+			zipPath(1, "first"),
+			zipPath(2, "second"),
+			{ProjectID: 3, Source: api.Source{Type: "file", SHA256: "disk"}},
+		}},
+		"custom.example.com": {LookupPaths: []api.LookupPath{zipPath(1, "custom")}},
+	}
+
+	source := Gitlab{client: cache.NewCache(c, &config.Cache{
+		CacheExpiry:          time.Minute,
+		CacheCleanupInterval: time.Minute,
+		EntryRefreshTimeout:  time.Minute,
+		RetrievalTimeout:     time.Second,
+		MaxRetrievalInterval: time.Millisecond,
+		MaxRetrievalRetries:  1,
+	})}
+
+	for name := range c {
+		_, err := source.GetDomain(context.Background(), name)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, 2, source.CachedDomains())
+	require.ElementsMatch(t, []string{"first", "custom"}, source.ProjectArchives(1))
+	require.Equal(t, []string{"second"}, source.ProjectArchives(2))
+	require.Empty(t, source.ProjectArchives(3), "the disk deployments have no archive")
+
+	require.Equal(t, 2, source.ClearDomains())
+	require.Empty(t, source.ProjectArchives(1))
+}
+
+func TestDomainArchives(t *testing.T) {
+	c := lookupsClient{
+		"group.gitlab.io": {LookupPaths: []api.LookupPath{
+			{ProjectID: 1, Source: api.Source{Type: "zip", Path: "https://objects.example.com/first.zip", SHA256: "first"}},
+			{ProjectID: 2, Source: api.Source{Type: "file", Path: "group/project/public/"}},
+		}},
+	}
+
+	source := Gitlab{client: cache.NewCache(c, &config.Cache{
+		CacheExpiry:          time.Minute,
+		CacheCleanupInterval: time.Minute,
+		EntryRefreshTimeout:  time.Minute,
+		RetrievalTimeout:     time.Second,
+		MaxRetrievalInterval: time.Millisecond,
+		MaxRetrievalRetries:  1,
+	})}
+
+	archives, err := source.DomainArchives(context.Background(), "group.gitlab.io")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"first": "https://objects.example.com/first.zip"}, archives)
+
+	c["group.gitlab.io"].LookupPaths[0].Source = api.Source{Type: "zip", Path: "https://objects.example.com/second.zip", SHA256: "second"}
+
+	archives, err = source.DomainArchives(context.Background(), "group.gitlab.io")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"second": "https://objects.example.com/second.zip"}, archives, "the cached lookup is replaced")
+}
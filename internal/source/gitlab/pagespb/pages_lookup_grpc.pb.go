@@ -0,0 +1,111 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: pages_lookup.proto
+
+package pagespb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// LookupServiceClient is the client API for LookupService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LookupServiceClient interface {
+	// GetVirtualDomain returns the configuration of a host. It fails with
+	// NOT_FOUND when the host is not a Pages domain, and UNAUTHENTICATED when
+	// the gitlab-pages-api-request metadata is not a valid token.
+	GetVirtualDomain(ctx context.Context, in *VirtualDomainRequest, opts ...grpc.CallOption) (*VirtualDomainResponse, error)
+}
+
+type lookupServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLookupServiceClient(cc grpc.ClientConnInterface) LookupServiceClient {
+	return &lookupServiceClient{cc}
+}
+
+func (c *lookupServiceClient) GetVirtualDomain(ctx context.Context, in *VirtualDomainRequest, opts ...grpc.CallOption) (*VirtualDomainResponse, error) {
+	out := new(VirtualDomainResponse)
+	err := c.cc.Invoke(ctx, "/gitlab.pages.v1.LookupService/GetVirtualDomain", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LookupServiceServer is the server API for LookupService service.
+// All implementations must embed UnimplementedLookupServiceServer
+// for forward compatibility
+type LookupServiceServer interface {
+	// GetVirtualDomain returns the configuration of a host. It fails with
+	// NOT_FOUND when the host is not a Pages domain, and UNAUTHENTICATED when
+	// the gitlab-pages-api-request metadata is not a valid token.
+	GetVirtualDomain(context.Context, *VirtualDomainRequest) (*VirtualDomainResponse, error)
+	mustEmbedUnimplementedLookupServiceServer()
+}
+
+// UnimplementedLookupServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedLookupServiceServer struct {
+}
+
+func (UnimplementedLookupServiceServer) GetVirtualDomain(context.Context, *VirtualDomainRequest) (*VirtualDomainResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVirtualDomain not implemented")
+}
+func (UnimplementedLookupServiceServer) mustEmbedUnimplementedLookupServiceServer() {}
+
+// UnsafeLookupServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LookupServiceServer will
+// result in compilation errors.
+type UnsafeLookupServiceServer interface {
+	mustEmbedUnimplementedLookupServiceServer()
+}
+
+func RegisterLookupServiceServer(s grpc.ServiceRegistrar, srv LookupServiceServer) {
+	s.RegisterService(&LookupService_ServiceDesc, srv)
+}
+
+func _LookupService_GetVirtualDomain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VirtualDomainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LookupServiceServer).GetVirtualDomain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gitlab.pages.v1.LookupService/GetVirtualDomain",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LookupServiceServer).GetVirtualDomain(ctx, req.(*VirtualDomainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// LookupService_ServiceDesc is the grpc.ServiceDesc for LookupService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LookupService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gitlab.pages.v1.LookupService",
+	HandlerType: (*LookupServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetVirtualDomain",
+			Handler:    _LookupService_GetVirtualDomain_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pages_lookup.proto",
+}
@@ -0,0 +1,388 @@
+// Package stapling staples OCSP responses to the certificates served by the
+// HTTPS listeners, so that clients do not query the OCSP responder of the CA
+// themselves.
+//
+// The responses are fetched and refreshed in the background, a handshake
+// never waits for the responder: a certificate is served without a staple
+// until its first response is fetched.
+//
+// The certificates are uploaded by the users, so a responder is only queried
+// for a certificate signed by the next certificate of its chain, over http or
+// https, and never at a private address.
+package stapling
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	// RefreshInterval is how often the responses are refreshed and the
+	// certificates no longer served are forgotten
+	RefreshInterval = time.Minute
+
+	// retryInterval is how long a failed fetch waits before the next one
+	retryInterval = 5 * time.Minute
+
+	// minRefresh bounds the refreshes of the responses with a short validity
+	minRefresh = time.Minute
+
+	// unusedTTL is how long the response of a certificate no longer served is
+	// kept
+	unusedTTL = 24 * time.Hour
+
+	fetchTimeout    = 10 * time.Second
+	maxResponseSize = 64 * 1024
+)
+
+var (
+	errUnsupportedResponder = errors.New("unsupported OCSP responder URL")
+	errPrivateResponder     = errors.New("the OCSP responder is at a private address")
+
+	// privateNetworks are the ranges not covered by the net.IP helpers
+	privateNetworks = parseNetworks("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+)
+
+type entry struct {
+	chain    [][]byte
+	staple   []byte
+	expiry   time.Time
+	refresh  time.Time
+	lastUsed time.Time
+	fetching bool
+}
+
+// Stapler caches the OCSP responses of the served certificates. A nil
+// *Stapler staples nothing.
+type Stapler struct {
+	mu         sync.Mutex
+	entries    map[[sha256.Size]byte]*entry
+	httpClient *http.Client
+	now        func() time.Time
+
+	// public reports whether a responder may be dialed at ip
+	public func(ip net.IP) bool
+}
+
+// New returns an empty Stapler
+func New() *Stapler {
+	s := &Stapler{
+		entries: make(map[[sha256.Size]byte]*entry),
+		now:     time.Now,
+		public:  isPublicIP,
+	}
+
+	s.httpClient = &http.Client{
+		Transport: s.transport(),
+		Timeout:   fetchTimeout,
+	}
+
+	return s
+}
+
+// transport dials the responders directly, so that the address checked is the
+// one connected to
+func (s *Stapler) transport() *http.Transport {
+	dialer := &net.Dialer{Timeout: fetchTimeout, Control: s.control}
+
+	t := httptransport.NewTransport()
+	t.Proxy = nil
+	t.DialTLS = nil
+	t.DialContext = dialer.DialContext
+
+	return t
+}
+
+func (s *Stapler) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !s.public(ip) {
+		return fmt.Errorf("%w: %s", errPrivateResponder, address)
+	}
+
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// Start refreshes the responses every interval in the background
+func (s *Stapler) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.refreshDue()
+		}
+	}()
+}
+
+// Staple returns cert with its OCSP response, or cert itself while no valid
+// response is known. The certificates without their issuer in the chain are
+// never stapled.
+func (s *Stapler) Staple(cert *tls.Certificate) *tls.Certificate {
+	if s == nil || cert == nil || len(cert.Certificate) < 2 {
+		return cert
+	}
+
+	key := sha256.Sum256(cert.Certificate[0])
+	now := s.now()
+
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{chain: cert.Certificate}
+		s.entries[key] = e
+	}
+
+	e.lastUsed = now
+	staple := e.valid(now)
+	fetch := s.due(e, now)
+	s.mu.Unlock()
+
+	if fetch {
+		go s.refresh(e)
+	}
+
+	if staple == nil {
+		return cert
+	}
+
+	stapled := *cert
+	stapled.OCSPStaple = staple
+
+	return &stapled
+}
+
+// valid returns the response of e while it is valid
+func (e *entry) valid(now time.Time) []byte {
+	if e.staple == nil || !now.Before(e.expiry) {
+		return nil
+	}
+
+	return e.staple
+}
+
+// due reports whether the response of e must be fetched, and marks it as
+// fetching. It must be called with s.mu held.
+func (s *Stapler) due(e *entry, now time.Time) bool {
+	if e.fetching || now.Before(e.refresh) {
+		return false
+	}
+
+	e.fetching = true
+
+	return true
+}
+
+// refreshDue refreshes the responses due for a refresh, and forgets the
+// certificates no longer served
+func (s *Stapler) refreshDue() {
+	now := s.now()
+
+	var due []*entry
+
+	s.mu.Lock()
+	for key, e := range s.entries {
+		if now.Sub(e.lastUsed) > unusedTTL {
+			delete(s.entries, key)
+			continue
+		}
+
+		if s.due(e, now) {
+			due = append(due, e)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range due {
+		s.refresh(e)
+	}
+}
+
+func (s *Stapler) refresh(e *entry) {
+	staple, expiry, refresh, err := s.fetch(e.chain)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.fetching = false
+
+	if err != nil {
+		log.WithError(err).Warn("failed to fetch the OCSP response of a certificate")
+		e.refresh = s.now().Add(retryInterval)
+		return
+	}
+
+	e.staple = staple
+	e.expiry = expiry
+	e.refresh = refresh
+}
+
+// fetch returns the response of the certificate of chain if it is good, its
+// expiry and when to refresh it
+func (s *Stapler) fetch(chain [][]byte) ([]byte, time.Time, time.Time, error) {
+	now := s.now()
+
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+
+	issuer, err := x509.ParseCertificate(chain[1])
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+
+	if len(leaf.OCSPServer) == 0 {
+		// nothing to fetch until the certificate is forgotten
+		return nil, time.Time{}, now.Add(unusedTTL), nil
+	}
+
+	// the responder of a certificate that was not issued by the next one of
+	// its chain is never queried
+	responder, err := responderURL(leaf.OCSPServer[0])
+	if err == nil {
+		err = leaf.CheckSignatureFrom(issuer)
+	}
+
+	if err != nil {
+		log.WithError(err).Warn("not querying the OCSP responder of a certificate")
+		return nil, time.Time{}, now.Add(unusedTTL), nil
+	}
+
+	raw, err := s.request(responder, leaf, issuer)
+	if err != nil {
+		metrics.OCSPStapleFetches.WithLabelValues("error").Inc()
+		return nil, time.Time{}, time.Time{}, err
+	}
+
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		metrics.OCSPStapleFetches.WithLabelValues("error").Inc()
+		return nil, time.Time{}, time.Time{}, err
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		metrics.OCSPStapleFetches.WithLabelValues("good").Inc()
+	case ocsp.Revoked:
+		metrics.OCSPStapleFetches.WithLabelValues("revoked").Inc()
+		log.WithField("serial", leaf.SerialNumber.String()).Error("a served certificate is revoked")
+
+		return nil, time.Time{}, now.Add(retryInterval), nil
+	default:
+		metrics.OCSPStapleFetches.WithLabelValues("unknown").Inc()
+
+		return nil, time.Time{}, now.Add(retryInterval), nil
+	}
+
+	// responses without a next update are only stapled until the next
+	// refresh
+	expiry := resp.NextUpdate
+	if expiry.IsZero() {
+		expiry = now.Add(retryInterval)
+	}
+
+	// refresh halfway through the validity of the response
+	refresh := resp.ThisUpdate.Add(expiry.Sub(resp.ThisUpdate) / 2)
+	if refresh.Before(now.Add(minRefresh)) {
+		refresh = now.Add(minRefresh)
+	}
+
+	return raw, expiry, refresh, nil
+}
+
+// responderURL returns rawURL if it is an http or https URL
+func responderURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%w: %q", errUnsupportedResponder, rawURL)
+	}
+
+	return u.String(), nil
+}
+
+func (s *Stapler) request(responder string, leaf, issuer *x509.Certificate) ([]byte, error) {
+	body, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responder, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the OCSP responder %q responded with %d", responder, res.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+}
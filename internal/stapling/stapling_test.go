@@ -0,0 +1,281 @@
+package stapling
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type responder struct {
+	*httptest.Server
+	issuer   *x509.Certificate
+	key      crypto.Signer
+	status   int
+	requests int32
+}
+
+// newResponder returns an OCSP responder answering with status for the
+// certificates issued by its CA
+func newResponder(t *testing.T, status int) *responder {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Pages Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	issuer, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	r := &responder{issuer: issuer, key: key, status: status}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&r.requests, 1)
+
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		ocspReq, err := ocsp.ParseRequest(body)
+		require.NoError(t, err)
+
+		resp, err := ocsp.CreateResponse(r.issuer, r.issuer, ocsp.Response{
+			Status:       r.status,
+			SerialNumber: ocspReq.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, r.key)
+		require.NoError(t, err)
+
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+// certificate returns a certificate issued by the CA of r, checked at
+// ocspServer
+func (r *responder) certificate(t *testing.T, ocspServer ...string) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "group.gitlab-example.com"},
+		DNSNames:     []string{"group.gitlab-example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   ocspServer,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, r.issuer, key.Public(), r.key)
+	require.NoError(t, err)
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, r.issuer.Raw},
+		PrivateKey:  key,
+	}
+}
+
+// newTestStapler returns a Stapler querying the responders at any address
+func newTestStapler() *Stapler {
+	s := New()
+	s.public = func(net.IP) bool { return true }
+
+	return s
+}
+
+func (r *responder) requestCount() int32 {
+	return atomic.LoadInt32(&r.requests)
+}
+
+func TestStaple(t *testing.T) {
+	r := newResponder(t, ocsp.Good)
+	cert := r.certificate(t, r.URL)
+
+	s := newTestStapler()
+
+	// the first handshake does not wait for the responder
+	require.Same(t, cert, s.Staple(cert))
+
+	require.Eventually(t, func() bool {
+		return s.Staple(cert).OCSPStaple != nil
+	}, time.Second, 10*time.Millisecond)
+
+	stapled := s.Staple(cert)
+	require.Equal(t, cert.Certificate, stapled.Certificate)
+	require.Nil(t, cert.OCSPStaple, "the certificate is not modified")
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+
+	resp, err := ocsp.ParseResponseForCert(stapled.OCSPStaple, leaf, r.issuer)
+	require.NoError(t, err)
+	require.Equal(t, ocsp.Good, resp.Status)
+
+	require.Equal(t, int32(1), r.requestCount(), "the response is cached")
+}
+
+func TestStapleRevoked(t *testing.T) {
+	r := newResponder(t, ocsp.Revoked)
+	cert := r.certificate(t, r.URL)
+
+	s := newTestStapler()
+	s.Staple(cert)
+
+	require.Eventually(t, func() bool {
+		return r.requestCount() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.Never(t, func() bool {
+		return s.Staple(cert).OCSPStaple != nil
+	}, 100*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestStapleWithoutResponder(t *testing.T) {
+	r := newResponder(t, ocsp.Good)
+
+	s := newTestStapler()
+
+	withoutIssuer := r.certificate(t, r.URL)
+	withoutIssuer.Certificate = withoutIssuer.Certificate[:1]
+	require.Same(t, withoutIssuer, s.Staple(withoutIssuer))
+
+	withoutOCSPServer := r.certificate(t)
+	require.Same(t, withoutOCSPServer, s.Staple(withoutOCSPServer))
+
+	s.refreshDue()
+
+	require.Same(t, withoutOCSPServer, s.Staple(withoutOCSPServer))
+	require.Zero(t, r.requestCount())
+
+	var disabled *Stapler
+	require.Same(t, withoutIssuer, disabled.Staple(withoutIssuer))
+}
+
+func TestRefreshDue(t *testing.T) {
+	r := newResponder(t, ocsp.Good)
+	cert := r.certificate(t, r.URL)
+
+	now := time.Now()
+
+	s := newTestStapler()
+	s.now = func() time.Time { return now }
+
+	s.mu.Lock()
+	s.entries[[32]byte{}] = &entry{chain: cert.Certificate, lastUsed: now}
+	s.mu.Unlock()
+
+	s.refreshDue()
+	require.Equal(t, int32(1), r.requestCount())
+
+	// the response is refreshed halfway through its validity
+	s.refreshDue()
+	require.Equal(t, int32(1), r.requestCount())
+
+	now = now.Add(31 * time.Minute)
+	s.refreshDue()
+	require.Equal(t, int32(2), r.requestCount())
+
+	// the certificates no longer served are forgotten
+	now = now.Add(unusedTTL + time.Minute)
+	s.refreshDue()
+	require.Equal(t, int32(2), r.requestCount())
+	require.Empty(t, s.entries)
+}
+
+func TestStapleRejectsPrivateResponder(t *testing.T) {
+	r := newResponder(t, ocsp.Good)
+	cert := r.certificate(t, r.URL)
+
+	s := New()
+
+	_, _, _, err := s.fetch(cert.Certificate)
+	require.ErrorIs(t, err, errPrivateResponder)
+	require.Zero(t, r.requestCount())
+}
+
+func TestStapleNotQueried(t *testing.T) {
+	r := newResponder(t, ocsp.Good)
+	other := newResponder(t, ocsp.Good)
+
+	notSigned := r.certificate(t, r.URL)
+	notSigned.Certificate[1] = other.issuer.Raw
+
+	tests := map[string]*tls.Certificate{
+		"not_signed_by_issuer": notSigned,
+		"file_responder":       r.certificate(t, "file:///etc/passwd"),
+		"gopher_responder":     r.certificate(t, "gopher://"+r.Listener.Addr().String()),
+		"relative_responder":   r.certificate(t, "/ocsp"),
+	}
+
+	for name, cert := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+
+			s := newTestStapler()
+			s.now = func() time.Time { return now }
+
+			staple, _, refresh, err := s.fetch(cert.Certificate)
+			require.NoError(t, err)
+			require.Nil(t, staple)
+			require.Equal(t, now.Add(unusedTTL), refresh, "the certificate is not checked again")
+		})
+	}
+
+	require.Zero(t, r.requestCount())
+	require.Zero(t, other.requestCount())
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"1.1.1.1":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"0.0.0.0":         false,
+		"10.1.2.3":        false,
+		"172.20.0.1":      false,
+		"192.168.1.1":     false,
+		"100.64.0.1":      false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+	}
+
+	for ip, public := range tests {
+		t.Run(ip, func(t *testing.T) {
+			require.Equal(t, public, isPublicIP(net.ParseIP(ip)))
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// Package status serves the status page of the daemon. Legacy monitors get
+// the plain `success`. When enabled, the clients that accept application/json
+// get a Document of the state of the daemon, so automation can consume it
+// directly.
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httputil"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/readonly"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// SchemaVersion is the version of the Document, bumped on incompatible changes
+const SchemaVersion = 1
+
+const (
+	plainType = "text/plain"
+	jsonType  = "application/json"
+)
+
+// Document is the JSON status of the daemon
+type Document struct {
+	SchemaVersion int     `json:"schema_version"`
+	Version       string  `json:"version"`
+	Revision      string  `json:"revision"`
+	Ready         bool    `json:"ready"`
+	ReadOnly      bool    `json:"read_only"`
+	StartedAt     string  `json:"started_at"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	// Weight is only set when the node scores its load balancer weight
+	Weight  *int             `json:"weight,omitempty"`
+	Sources Sources          `json:"sources"`
+	Caches  map[string]Cache `json:"caches"`
+}
+
+// Sources is the state of the domain sources
+type Sources struct {
+	GitLab GitLabSource `json:"gitlab"`
+}
+
+// GitLabSource is the state of the GitLab API domain source
+type GitLabSource struct {
+	// APIVersion is the version of the API in use, 0 until it is known
+	APIVersion  int     `json:"api_version"`
+	APIRequests float64 `json:"api_requests"`
+	APIFailures float64 `json:"api_failures"`
+}
+
+// Cache is the state of a cache since the start of the daemon
+type Cache struct {
+	Entries float64 `json:"entries"`
+	Hits    float64 `json:"hits"`
+	Misses  float64 `json:"misses"`
+}
+
+// Options of the Handler
+type Options struct {
+	Version  string
+	Revision string
+	// Ready reports whether the daemon serves the domains
+	Ready func() bool
+	// APIVersion returns the version of the GitLab API in use, if any
+	APIVersion func() int
+	// Weight returns the load balancer weight of the node, if any
+	Weight func() int
+	// JSON serves the Document to the clients that accept application/json.
+	// The Document is served on the status path of every domain, so it is
+	// off unless the operator opts in.
+	JSON bool
+}
+
+// Handler serves the status page
+type Handler struct {
+	opts    Options
+	started time.Time
+	now     func() time.Time
+}
+
+// NewHandler returns a Handler of a daemon started now
+func NewHandler(opts Options) *Handler {
+	return &Handler{
+		opts:    opts,
+		started: time.Now(),
+		now:     time.Now,
+	}
+}
+
+// ServeHTTP responds with `success`, or the Document when it is enabled and
+// the client prefers application/json. Both respond with 503 while the daemon
+// is not ready.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	apiVersion := 0
+	if h.opts.APIVersion != nil {
+		apiVersion = h.opts.APIVersion()
+	}
+
+	if apiVersion > 0 {
+		w.Header().Set("Gitlab-Pages-Api-Version", strconv.Itoa(apiVersion))
+	}
+
+	if h.opts.JSON {
+		w.Header().Add("Vary", "Accept")
+	}
+
+	ready := h.opts.Ready == nil || h.opts.Ready()
+
+	if !h.opts.JSON || httputil.NegotiateContentType(r, []string{plainType, jsonType}, plainType) != jsonType {
+		if ready {
+			w.Write([]byte("success\n"))
+		} else {
+			http.Error(w, "not yet ready", http.StatusServiceUnavailable)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonType)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(h.document(ready, apiVersion))
+}
+
+func (h *Handler) document(ready bool, apiVersion int) *Document {
+	doc := &Document{
+		SchemaVersion: SchemaVersion,
+		Version:       h.opts.Version,
+		Revision:      h.opts.Revision,
+		Ready:         ready,
+		ReadOnly:      readonly.Enabled(),
+		StartedAt:     h.started.UTC().Format(time.RFC3339),
+		UptimeSeconds: h.now().Sub(h.started).Truncate(time.Second).Seconds(),
+		Sources: Sources{
+			GitLab: GitLabSource{APIVersion: apiVersion},
+		},
+	}
+
+	if h.opts.Weight != nil {
+		weight := h.opts.Weight()
+		doc.Weight = &weight
+	}
+
+	for _, m := range collect(metrics.DomainsSourceAPIReqTotal) {
+		doc.Sources.GitLab.APIRequests += m.value
+		if status := m.labels["status_code"]; status == "error" || strings.HasPrefix(status, "5") {
+			doc.Sources.GitLab.APIFailures += m.value
+		}
+	}
+
+	doc.Caches = Caches()
+
+	return doc
+}
+
+// Caches returns the state of the domain cache and of the caches of the zip
+// archives, by name
+func Caches() map[string]Cache {
+	caches := map[string]Cache{}
+
+	domains := Cache{}
+	for _, m := range collect(metrics.DomainsSourceCacheHit) {
+		domains.Hits += m.value
+	}
+	for _, m := range collect(metrics.DomainsSourceCacheMiss) {
+		domains.Misses += m.value
+	}
+	caches["domains"] = domains
+
+	for _, m := range collect(metrics.ZipCachedEntries) {
+		cache := caches[m.labels["op"]]
+		cache.Entries += m.value
+		caches[m.labels["op"]] = cache
+	}
+
+	for _, m := range collect(metrics.ZipCacheRequests) {
+		cache := caches[m.labels["op"]]
+		switch result := m.labels["cache"]; {
+		case strings.HasPrefix(result, "hit"):
+			cache.Hits += m.value
+		case result == "miss":
+			cache.Misses += m.value
+		}
+		caches[m.labels["op"]] = cache
+	}
+
+	return caches
+}
+
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+// collect returns the value and labels of the counters and gauges of c
+func collect(c prometheus.Collector) []sample {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var samples []sample
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+
+		s := sample{labels: make(map[string]string, len(pb.Label))}
+		for _, label := range pb.Label {
+			s.labels[label.GetName()] = label.GetValue()
+		}
+
+		switch {
+		case pb.Counter != nil:
+			s.value = pb.Counter.GetValue()
+		case pb.Gauge != nil:
+			s.value = pb.Gauge.GetValue()
+		default:
+			continue
+		}
+
+		samples = append(samples, s)
+	}
+
+	return samples
+}
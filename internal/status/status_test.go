@@ -0,0 +1,128 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+func TestServeHTTPNegotiatesPlainText(t *testing.T) {
+	h := NewHandler(Options{Ready: func() bool { return true }})
+
+	for _, accept := range []string{"", "*/*", "text/html,application/xhtml+xml,*/*;q=0.8", "text/plain"} {
+		t.Run(accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/@status", nil)
+			req.Header.Set("Accept", accept)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, "success\n", w.Body.String())
+		})
+	}
+}
+
+func TestServeHTTPNotReady(t *testing.T) {
+	h := NewHandler(Options{Ready: func() bool { return false }, JSON: true})
+
+	tests := map[string]struct {
+		accept       string
+		expectedType string
+	}{
+		"plain": {accept: "text/plain", expectedType: "text/plain; charset=utf-8"},
+		"json":  {accept: "application/json", expectedType: "application/json"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/@status", nil)
+			req.Header.Set("Accept", tt.accept)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusServiceUnavailable, w.Code)
+			require.Equal(t, tt.expectedType, w.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestServeHTTPDocument(t *testing.T) {
+	h := NewHandler(Options{
+		Version:    "v1.2.3",
+		Revision:   "abcdef",
+		Ready:      func() bool { return true },
+		APIVersion: func() int { return 1 },
+		Weight:     func() int { return 75 },
+		JSON:       true,
+	})
+	h.started = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return h.started.Add(90*time.Second + time.Millisecond) }
+
+	metrics.DomainsSourceCacheHit.Inc()
+	metrics.ZipCachedEntries.WithLabelValues("archive").Inc()
+	defer metrics.ZipCachedEntries.WithLabelValues("archive").Dec()
+	metrics.ZipCacheRequests.WithLabelValues("archive", "hit-refresh").Inc()
+
+	req := httptest.NewRequest(http.MethodGet, "/@status", nil)
+	req.Header.Set("Accept", "application/json")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.Equal(t, "1", w.Header().Get("Gitlab-Pages-Api-Version"))
+	require.Equal(t, "Accept", w.Header().Get("Vary"))
+
+	var doc Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	require.Equal(t, SchemaVersion, doc.SchemaVersion)
+	require.Equal(t, "v1.2.3", doc.Version)
+	require.Equal(t, "abcdef", doc.Revision)
+	require.True(t, doc.Ready)
+	require.False(t, doc.ReadOnly)
+	require.Equal(t, "2021-01-01T00:00:00Z", doc.StartedAt)
+	require.Equal(t, float64(90), doc.UptimeSeconds)
+	require.NotNil(t, doc.Weight)
+	require.Equal(t, 75, *doc.Weight)
+	require.Equal(t, 1, doc.Sources.GitLab.APIVersion)
+	require.GreaterOrEqual(t, doc.Caches["domains"].Hits, float64(1))
+	require.GreaterOrEqual(t, doc.Caches["archive"].Entries, float64(1))
+	require.GreaterOrEqual(t, doc.Caches["archive"].Hits, float64(1))
+}
+
+func TestServeHTTPDocumentDisabled(t *testing.T) {
+	h := NewHandler(Options{Version: "v1.2.3", Ready: func() bool { return true }})
+
+	req := httptest.NewRequest(http.MethodGet, "/@status", nil)
+	req.Header.Set("Accept", "application/json")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "success\n", w.Body.String())
+	require.Empty(t, w.Header().Get("Vary"))
+}
+
+func TestDocumentWithoutWeight(t *testing.T) {
+	h := NewHandler(Options{JSON: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/@status", nil)
+	req.Header.Set("Accept", "application/json")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), `"weight"`)
+	require.Empty(t, w.Header().Get("Gitlab-Pages-Api-Version"))
+}
@@ -0,0 +1,134 @@
+// Package tarpit answers the requests of scanners with deliberately slow
+// minimal responses, raising the cost of scanning Pages domains. The number
+// of requests held at once is bounded, legitimate traffic is never delayed.
+package tarpit
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// Reasons for tarpitting a request, reported by the metrics
+const (
+	ReasonScanner     = "scanner"
+	ReasonRateLimited = "rate_limited"
+)
+
+// DefaultPathSuffixes are the paths probed by scanners which are never
+// served by static sites, used when no suffix is configured
+var DefaultPathSuffixes = []string{
+	"/.env",
+	"/.git/config",
+	"/wp-login.php",
+	"/xmlrpc.php",
+	"/.aws/credentials",
+	"/phpinfo.php",
+}
+
+// Tarpit holds the requests of scanners for a delay before responding
+type Tarpit struct {
+	delay    time.Duration
+	budget   chan struct{}
+	suffixes []string
+}
+
+// New returns a Tarpit configured by cfg, or nil if it is disabled
+func New(cfg *config.Tarpit) *Tarpit {
+	if cfg.Delay <= 0 {
+		return nil
+	}
+
+	configured := cfg.PathSuffixes
+	if len(configured) == 0 {
+		configured = DefaultPathSuffixes
+	}
+
+	suffixes := make([]string, 0, len(configured))
+	for _, suffix := range configured {
+		suffixes = append(suffixes, strings.ToLower(suffix))
+	}
+
+	return &Tarpit{
+		delay:    cfg.Delay,
+		budget:   make(chan struct{}, cfg.MaxConcurrent),
+		suffixes: suffixes,
+	}
+}
+
+// Middleware tarpits the requests of paths probed by scanners, which would
+// otherwise be served by handler
+func (t *Tarpit) Middleware(handler http.Handler) http.Handler {
+	if t == nil {
+		return handler
+	}
+
+	tarpitted := t.Handler(ReasonScanner, http.StatusNotFound, handler)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.isScanner(r) {
+			tarpitted.ServeHTTP(w, r)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Handler responds with status after the delay of the tarpit. The request
+// is served by fallback instead when the tarpit already holds as many
+// requests as it can.
+func (t *Tarpit) Handler(reason string, status int, fallback http.Handler) http.Handler {
+	if t == nil {
+		return fallback
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case t.budget <- struct{}{}:
+			defer func() { <-t.budget }()
+		default:
+			metrics.TarpitRequests.WithLabelValues(reason, "budget_exhausted").Inc()
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		metrics.TarpitRequests.WithLabelValues(reason, "tarpitted").Inc()
+		metrics.TarpitInFlight.Inc()
+		defer metrics.TarpitInFlight.Dec()
+
+		t.serve(w, r, status)
+	})
+}
+
+func (t *Tarpit) serve(w http.ResponseWriter, r *http.Request, status int) {
+	timer := time.NewTimer(t.delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, http.StatusText(status))
+}
+
+func (t *Tarpit) isScanner(r *http.Request) bool {
+	path := strings.ToLower(r.URL.Path)
+
+	for _, suffix := range t.suffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
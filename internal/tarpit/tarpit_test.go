@@ -0,0 +1,103 @@
+package tarpit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+)
+
+var next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusTeapot)
+})
+
+func TestNewDisabled(t *testing.T) {
+	tp := New(&config.Tarpit{MaxConcurrent: 10})
+	require.Nil(t, tp)
+
+	w := httptest.NewRecorder()
+	tp.Middleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.env", nil))
+	require.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		suffixes       []string
+		path           string
+		expectedStatus int
+		expectedDelay  bool
+	}{
+		"legitimate_request": {
+			path:           "/project/index.html",
+			expectedStatus: http.StatusTeapot,
+		},
+		"default_suffix": {
+			path:           "/project/.env",
+			expectedStatus: http.StatusNotFound,
+			expectedDelay:  true,
+		},
+		"default_suffix_case_insensitive": {
+			path:           "/WP-Login.php",
+			expectedStatus: http.StatusNotFound,
+			expectedDelay:  true,
+		},
+		"configured_suffix": {
+			suffixes:       []string{"/Admin.ASPX"},
+			path:           "/admin.aspx",
+			expectedStatus: http.StatusNotFound,
+			expectedDelay:  true,
+		},
+		"default_suffixes_replaced": {
+			suffixes:       []string{"/admin.aspx"},
+			path:           "/.env",
+			expectedStatus: http.StatusTeapot,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tp := New(&config.Tarpit{Delay: 50 * time.Millisecond, MaxConcurrent: 1, PathSuffixes: tt.suffixes})
+
+			w := httptest.NewRecorder()
+			start := time.Now()
+			tp.Middleware(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			require.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedDelay {
+				require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+				require.Equal(t, "Not Found\n", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerBudget(t *testing.T) {
+	tp := New(&config.Tarpit{Delay: time.Minute, MaxConcurrent: 1})
+	handler := tp.Handler(ReasonRateLimited, http.StatusTooManyRequests, next)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	held := make(chan struct{})
+	go func() {
+		defer close(held)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	}()
+
+	require.Eventually(t, func() bool {
+		return len(tp.budget) == 1
+	}, time.Second, time.Millisecond)
+
+	// the tarpit is full, the request is answered by the fallback at once
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusTeapot, w.Code)
+
+	// clients giving up release the budget
+	cancel()
+	<-held
+	require.Empty(t, tp.budget)
+}
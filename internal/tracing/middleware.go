@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"net/http"
+
+	"gitlab.com/gitlab-org/labkit/correlation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/request"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/responsewriter"
+)
+
+// NewMiddleware returns middleware serving the requests in a server span,
+// which continues the trace of their traceparent header. It must be wrapped
+// by the correlation ID injection, the middleware is a no-op when the traces
+// are not exported.
+func NewMiddleware(handler http.Handler) http.Handler {
+	if !Enabled() {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		scheme := request.SchemeHTTP
+		if request.IsHTTPS(r) {
+			scheme = request.SchemeHTTPS
+		}
+
+		// the query is left out as it may carry tokens
+		ctx, span := otel.Tracer(serviceName).Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPSchemeKey.String(scheme),
+				semconv.HTTPHostKey.String(r.Host),
+				semconv.HTTPTargetKey.String(r.URL.Path),
+				semconv.HTTPUserAgentKey.String(r.UserAgent()),
+				attribute.String("correlation_id", correlation.ExtractFromContext(r.Context())),
+			),
+		)
+		defer span.End()
+
+		sw := responsewriter.NewStatusWriter(w)
+		handler.ServeHTTP(sw, r.WithContext(ctx))
+
+		status := sw.Status()
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer))
+	})
+}
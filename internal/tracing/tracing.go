@@ -0,0 +1,174 @@
+// Package tracing exports OpenTelemetry traces of the requests served by
+// Pages, so that Pages shows up in the distributed traces of Workhorse and
+// Rails. The trace of a request is continued from its W3C traceparent
+// header, and is propagated to the GitLab API, the object storage and the
+// artifacts server.
+//
+// The spans are not recorded until Configure is called with an OTLP
+// endpoint.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+)
+
+const (
+	serviceName = "gitlab-pages"
+
+	// defaultURLPath is the path of the traces of an OTLP/HTTP collector
+	defaultURLPath = "/v1/traces"
+)
+
+var enabled int32
+
+// Enabled returns true when the traces are exported
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Configure exports the traces to the OTLP/HTTP collector of cfg. It returns
+// a function flushing the spans not exported yet, to be called on shutdown.
+func Configure(cfg config.Tracing) (func(context.Context) error, error) {
+	if cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	u, err := url.Parse(cfg.OTLPEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+
+	urlPath := defaultURLPath
+	if u.Path != "" && u.Path != "/" {
+		urlPath = u.Path
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(urlPath),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		// the traces started by Workhorse or Rails follow their sampling
+		// decision, so that the traces are complete
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+
+	setProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func setProvider(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	atomic.StoreInt32(&enabled, 1)
+}
+
+// Start starts a span named name, the child of the span of ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(serviceName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// RecordError marks span as failed by err, when err is not nil
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Detach returns a context carrying the span of ctx but none of its deadline
+// and cancellation, for the work outliving the request that started it
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+}
+
+// NewRoundTripper returns a http.RoundTripper sending the requests of client
+// with next, see RoundTrip
+func NewRoundTripper(next http.RoundTripper, client string) http.RoundTripper {
+	return &roundTripper{next: next, client: client}
+}
+
+type roundTripper struct {
+	next   http.RoundTripper
+	client string
+}
+
+func (rt *roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return RoundTrip(rt.next, rt.client, r)
+}
+
+// RoundTrip sends r with next in a client span, and propagates the trace to
+// the server in the traceparent header. The span ends once the response
+// headers are received.
+func RoundTrip(next http.RoundTripper, client string, r *http.Request) (*http.Response, error) {
+	if !Enabled() {
+		return next.RoundTrip(r)
+	}
+
+	ctx, span := otel.Tracer(serviceName).Start(r.Context(), client+" "+r.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(r.Method),
+			semconv.HTTPURLKey.String(redactURL(r.URL)),
+			semconv.NetPeerNameKey.String(r.URL.Hostname()),
+		),
+	)
+	defer span.End()
+
+	// a round tripper must not modify the request
+	r = r.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	resp, err := next.RoundTrip(r)
+	if err != nil {
+		RecordError(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(resp.StatusCode)...)
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(resp.StatusCode, trace.SpanKindClient))
+
+	return resp, nil
+}
+
+// redactURL leaves out the query and the credentials of u, the URLs of the
+// object storage are signed in their query
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	redacted.ForceQuery = false
+
+	return redacted.String()
+}
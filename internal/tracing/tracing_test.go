@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	setProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	t.Cleanup(func() {
+		atomic.StoreInt32(&enabled, 0)
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	return recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+
+	return attrs
+}
+
+func TestConfigureDisabled(t *testing.T) {
+	shutdown, err := Configure(config.Tracing{})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+	require.False(t, Enabled())
+
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	require.NotNil(t, NewMiddleware(handler))
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+
+	var ctx context.Context
+	handler := NewMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "http://group.gitlab.io/project/?token=secret", nil)
+	req.Header.Set("traceparent", traceparent)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+
+	span := spans[0]
+	require.Equal(t, trace.SpanKindServer, span.SpanKind())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	require.Equal(t, span.SpanContext(), trace.SpanContextFromContext(ctx))
+
+	attrs := attributes(span)
+	require.Equal(t, "/project/", attrs["http.target"].AsString())
+	require.Equal(t, int64(http.StatusNotFound), attrs["http.status_code"].AsInt64())
+	require.Equal(t, codes.Unset, span.Status().Code, "client errors are not errors of the server")
+}
+
+func TestRoundTrip(t *testing.T) {
+	recorder := record(t)
+
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, parent := Start(context.Background(), "parent")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/archive.zip?X-Amz-Signature=secret", nil)
+	require.NoError(t, err)
+
+	resp, err := NewRoundTripper(http.DefaultTransport, "zip_vfs").RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	parent.End()
+
+	require.Empty(t, req.Header.Get("traceparent"), "the request is not modified")
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	span := spans[0]
+	require.Equal(t, "zip_vfs GET", span.Name())
+	require.Equal(t, trace.SpanKindClient, span.SpanKind())
+	require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	require.Contains(t, header, span.SpanContext().SpanID().String())
+	require.Equal(t, server.URL+"/archive.zip", attributes(span)["http.url"].AsString())
+	require.Equal(t, codes.Error, span.Status().Code)
+}
+
+func TestDetach(t *testing.T) {
+	record(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, span := Start(ctx, "request")
+	defer span.End()
+
+	detached := Detach(ctx)
+	cancel()
+
+	require.NoError(t, detached.Err())
+	require.Equal(t, span.SpanContext(), trace.SpanContextFromContext(detached))
+}
+
+func TestRecordError(t *testing.T) {
+	recorder := record(t)
+
+	_, span := Start(context.Background(), "zip.open")
+	RecordError(span, nil)
+	span.End()
+
+	_, span = Start(context.Background(), "zip.open")
+	RecordError(span, context.DeadlineExceeded)
+	span.End()
+
+	spans := recorder.Ended()
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+	require.Equal(t, context.DeadlineExceeded.Error(), spans[1].Status().Description)
+}
@@ -3,9 +3,16 @@ package urilimiter
 import (
 	"net/http"
 
+	"gitlab.com/gitlab-org/labkit/log"
+
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httperrors"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
 
+// maxLoggedURILength is the length URIs are truncated to in the logs
+const maxLoggedURILength = 256
+
 func NewMiddleware(handler http.Handler, limit int) http.Handler {
 	if limit == 0 {
 		return handler
@@ -13,6 +20,15 @@ func NewMiddleware(handler http.Handler, limit int) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if len(r.RequestURI) > limit {
+			metrics.OversizedRequestsCount.WithLabelValues("uri").Inc()
+
+			log.WithFields(log.Fields{
+				"host":       r.Host,
+				"uri":        logging.Truncate(r.RequestURI, maxLoggedURILength),
+				"uri_length": len(r.RequestURI),
+				"limit":      limit,
+			}).Info("request URI too long")
+
 			httperrors.Serve414(w)
 
 			return
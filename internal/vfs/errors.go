@@ -0,0 +1,21 @@
+package vfs
+
+import "errors"
+
+// ErrLimitExceeded is returned when the content of a root exceeds a
+// configured limit and cannot be served
+var ErrLimitExceeded = errors.New("vfs limit exceeded")
+
+// ErrSaturated is returned when a root cannot be opened or read because too
+// many requests are already waiting for it, the request can be retried later
+var ErrSaturated = errors.New("vfs is saturated")
+
+// ErrEgressBudgetExceeded is returned when a root is not opened because the
+// egress budget of the object storage is spent, the request can be retried
+// once the budget window resets
+var ErrEgressBudgetExceeded = errors.New("object storage egress budget exceeded")
+
+// ErrChecksumMismatch is returned when the content of a root does not match
+// the checksum of its deployment, because the storage is corrupted or serves
+// a stale version of it
+var ErrChecksumMismatch = errors.New("vfs checksum mismatch")
@@ -0,0 +1,147 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/lru"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// attributeCache keeps the results of metadata operations for a short time.
+// On network filesystems like NFS every Lstat and Readlink is a round trip
+// to the server, and resolving a single request can issue dozens of them.
+// Missing files are cached as well, as probing for `index.html`, `.html`
+// and compressed variants mostly hits paths that do not exist.
+// A nil *attributeCache is valid and calls through to the filesystem.
+type attributeCache struct {
+	cache *lru.Cache
+}
+
+type rootResult struct {
+	rootPath string
+	err      error
+}
+
+type lstatResult struct {
+	fi  os.FileInfo
+	err error
+}
+
+type readlinkResult struct {
+	target string
+	err    error
+}
+
+func newAttributeCache(ttl time.Duration, maxSize int64) *attributeCache {
+	return &attributeCache{
+		cache: lru.New("attributes",
+			lru.WithExpirationInterval(ttl),
+			lru.WithMaxSize(maxSize),
+			lru.WithCachedEntriesMetric(metrics.DiskCachedEntries),
+			lru.WithCachedRequestsMetric(metrics.DiskCacheRequests),
+		),
+	}
+}
+
+func (c *attributeCache) root(path string) (string, error) {
+	if c == nil {
+		return resolveRoot(path)
+	}
+
+	value, err := c.cache.FindOrFetch("root:", path, func() (interface{}, error) {
+		rootPath, err := resolveRoot(path)
+		if err != nil && !isCacheable(err) {
+			return nil, err
+		}
+
+		return &rootResult{rootPath: rootPath, err: err}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	res := value.(*rootResult)
+	return res.rootPath, res.err
+}
+
+func (c *attributeCache) lstat(fullPath string) (os.FileInfo, error) {
+	if c == nil {
+		return os.Lstat(fullPath)
+	}
+
+	value, err := c.cache.FindOrFetch("lstat:", fullPath, func() (interface{}, error) {
+		fi, err := os.Lstat(fullPath)
+		if err != nil && !isCacheable(err) {
+			return nil, err
+		}
+
+		return &lstatResult{fi: fi, err: err}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := value.(*lstatResult)
+	return res.fi, res.err
+}
+
+func (c *attributeCache) readlink(fullPath string) (string, error) {
+	if c == nil {
+		return os.Readlink(fullPath)
+	}
+
+	value, err := c.cache.FindOrFetch("readlink:", fullPath, func() (interface{}, error) {
+		target, err := os.Readlink(fullPath)
+		if err != nil && !isCacheable(err) {
+			return nil, err
+		}
+
+		return &readlinkResult{target: target, err: err}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	res := value.(*readlinkResult)
+	return res.target, res.err
+}
+
+// isCacheable reports whether a failed operation can be cached. Only errors
+// describing the state of the filesystem are, transient failures like
+// timeouts of a network mount are retried on the next request.
+func isCacheable(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) ||
+		errors.Is(err, errNotDirectory) ||
+		errors.Is(err, unix.ENOTDIR) ||
+		errors.Is(err, unix.EINVAL)
+}
+
+func resolveRoot(path string) (string, error) {
+	rootPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rootPath, err = filepath.EvalSymlinks(rootPath)
+	if err != nil {
+		return "", fmt.Errorf("could not evaluate symlinks: %w", err)
+	}
+
+	fi, err := os.Lstat(rootPath)
+	if err != nil {
+		return "", err
+	}
+
+	if !fi.Mode().IsDir() {
+		return "", errNotDirectory
+	}
+
+	return rootPath, nil
+}
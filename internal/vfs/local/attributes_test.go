@@ -0,0 +1,97 @@
+package local
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+)
+
+func TestAttributeCache(t *testing.T) {
+	tmpDir, cleanup := tmpDir(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tmpDir, "file")
+	require.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+	require.NoError(t, os.Symlink("file", filepath.Join(tmpDir, "link")))
+
+	cachedVFS := &VFS{}
+	require.NoError(t, cachedVFS.Reconfigure(&config.Config{
+		Disk: config.DiskServing{AttributeCacheTTL: time.Hour, AttributeCacheSize: 100},
+	}))
+
+	ctx := context.Background()
+	root, err := cachedVFS.Root(ctx, tmpDir, "")
+	require.NoError(t, err)
+
+	_, err = root.Lstat(ctx, "missing")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	fi, err := root.Lstat(ctx, "file")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), fi.Size())
+
+	target, err := root.Readlink(ctx, "link")
+	require.NoError(t, err)
+	require.Equal(t, "file", target)
+
+	// changes on disk are not visible until the entries expire
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "missing"), []byte{}, 0644))
+	require.NoError(t, os.Remove(filePath))
+	require.NoError(t, os.Remove(filepath.Join(tmpDir, "link")))
+
+	_, err = root.Lstat(ctx, "missing")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	fi, err = root.Lstat(ctx, "file")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), fi.Size())
+
+	target, err = root.Readlink(ctx, "link")
+	require.NoError(t, err)
+	require.Equal(t, "file", target)
+
+	// the cache is dropped on reconfigure
+	require.NoError(t, cachedVFS.Reconfigure(&config.Config{}))
+
+	root, err = cachedVFS.Root(ctx, tmpDir, "")
+	require.NoError(t, err)
+
+	_, err = root.Lstat(ctx, "missing")
+	require.NoError(t, err)
+
+	_, err = root.Lstat(ctx, "file")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestAttributeCacheRoot(t *testing.T) {
+	tmpDir, cleanup := tmpDir(t)
+	defer cleanup()
+
+	cache := newAttributeCache(time.Hour, 100)
+	dirPath := filepath.Join(tmpDir, "dir")
+
+	_, err := cache.root(dirPath)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, os.Mkdir(dirPath, 0755))
+
+	// the missing root is still cached
+	_, err = cache.root(dirPath)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "file"), []byte{}, 0644))
+
+	_, err = cache.root(filepath.Join(tmpDir, "file"))
+	require.ErrorIs(t, err, errNotDirectory)
+
+	rootPath, err := cache.root(tmpDir)
+	require.NoError(t, err)
+	require.Equal(t, tmpDir, rootPath)
+}
@@ -0,0 +1,202 @@
+package local
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// handlePool shares open file handles between concurrent and subsequent
+// requests for the same file. Opening a file on a network filesystem requires
+// a lookup and an open call on the server, for popular assets this is the
+// largest part of the metadata traffic.
+// Handles are read using ReadAt, so a single handle can be safely used by many
+// readers at the same time. A handle is kept for ttl after it has been opened,
+// so an updated file is served at most ttl later.
+// A nil *handlePool is valid and opens a new handle for every call.
+type handlePool struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	handles   map[string]*pooledHandle
+	nextSweep time.Time
+}
+
+// maxPooledHandles limits the number of file descriptors kept open by the
+// pool, files opened while the pool is full are not pooled
+const maxPooledHandles = 1000
+
+type pooledHandle struct {
+	file      *os.File
+	size      int64
+	expiresAt time.Time
+
+	// refs counts the readers currently using the file, the file is closed
+	// once it is removed from the pool and refs drops to 0
+	refs    int
+	removed bool
+}
+
+// pooledFile is a reader of a pooled handle. Closing it releases the handle
+// back to the pool instead of closing the file.
+type pooledFile struct {
+	*io.SectionReader
+
+	once    sync.Once
+	release func()
+}
+
+func (f *pooledFile) Close() error {
+	f.once.Do(f.release)
+	return nil
+}
+
+func newHandlePool(ttl time.Duration) *handlePool {
+	return &handlePool{
+		ttl:     ttl,
+		now:     time.Now,
+		handles: make(map[string]*pooledHandle),
+	}
+}
+
+func (p *handlePool) open(fullPath string) (vfs.File, error) {
+	if p == nil {
+		file, _, err := openRegularFile(fullPath)
+		return file, err
+	}
+
+	p.mu.Lock()
+	p.removeExpired()
+	h := p.handles[fullPath]
+	if h != nil && p.now().After(h.expiresAt) {
+		p.remove(fullPath, h)
+		h = nil
+	}
+	if h != nil {
+		h.refs++
+	}
+	p.mu.Unlock()
+
+	if h != nil {
+		metrics.DiskCacheRequests.WithLabelValues("file-handles", "hit").Inc()
+		return p.reader(h), nil
+	}
+
+	file, fi, err := openRegularFile(fullPath)
+	if err != nil {
+		metrics.DiskCacheRequests.WithLabelValues("file-handles", "error").Inc()
+		return nil, err
+	}
+
+	metrics.DiskCacheRequests.WithLabelValues("file-handles", "miss").Inc()
+
+	h = &pooledHandle{
+		file:      file,
+		size:      fi.Size(),
+		expiresAt: p.now().Add(p.ttl),
+		refs:      1,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// another request could have opened the same file in the meantime
+	if existing := p.handles[fullPath]; existing != nil {
+		p.remove(fullPath, existing)
+	}
+
+	if len(p.handles) >= maxPooledHandles {
+		return file, nil
+	}
+
+	p.handles[fullPath] = h
+	metrics.DiskCachedEntries.WithLabelValues("file-handles").Inc()
+
+	return p.reader(h), nil
+}
+
+func (p *handlePool) reader(h *pooledHandle) vfs.File {
+	return &pooledFile{
+		SectionReader: io.NewSectionReader(h.file, 0, h.size),
+		release: func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+
+			h.refs--
+			if h.removed && h.refs == 0 {
+				h.file.Close()
+			}
+		},
+	}
+}
+
+// close removes all handles from the pool, the ones in use are closed
+// once they are released
+func (p *handlePool) close() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for fullPath, h := range p.handles {
+		p.remove(fullPath, h)
+	}
+}
+
+// removeExpired walks the pool at most once per ttl, it needs to be called
+// with p.mu held
+func (p *handlePool) removeExpired() {
+	now := p.now()
+	if now.Before(p.nextSweep) {
+		return
+	}
+	p.nextSweep = now.Add(p.ttl)
+
+	for fullPath, h := range p.handles {
+		if now.After(h.expiresAt) {
+			p.remove(fullPath, h)
+		}
+	}
+}
+
+// remove needs to be called with p.mu held
+func (p *handlePool) remove(fullPath string, h *pooledHandle) {
+	delete(p.handles, fullPath)
+	metrics.DiskCachedEntries.WithLabelValues("file-handles").Dec()
+
+	h.removed = true
+	if h.refs == 0 {
+		h.file.Close()
+	}
+}
+
+func openRegularFile(fullPath string) (*os.File, os.FileInfo, error) {
+	file, err := os.OpenFile(fullPath, os.O_RDONLY|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// We do a `Stat()` on a file due to race-conditions
+	// Someone could update (unlikely) a file between `Stat()/Open()`
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		file.Close()
+		return nil, nil, errNotFile
+	}
+
+	return file, fi, nil
+}
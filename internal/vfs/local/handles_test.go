@@ -0,0 +1,92 @@
+package local
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+)
+
+func TestHandlePool(t *testing.T) {
+	tmpDir, cleanup := tmpDir(t)
+	defer cleanup()
+
+	filePath := filepath.Join(tmpDir, "file")
+	require.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+
+	now := time.Now()
+	pool := newHandlePool(time.Minute)
+	pool.now = func() time.Time { return now }
+
+	first, err := pool.open(filePath)
+	require.NoError(t, err)
+
+	second, err := pool.open(filePath)
+	require.NoError(t, err)
+
+	h := pool.handles[filePath]
+	require.NotNil(t, h)
+	require.Equal(t, 2, h.refs)
+
+	// readers have their own offset
+	requireContent(t, first, "content")
+	requireContent(t, second, "content")
+
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close(), "closing twice releases the handle once")
+	require.Equal(t, 1, h.refs)
+
+	// the expired handle is replaced, the old one is closed once released
+	require.NoError(t, os.WriteFile(filePath, []byte("updated"), 0644))
+	now = now.Add(2 * time.Minute)
+
+	third, err := pool.open(filePath)
+	require.NoError(t, err)
+	requireContent(t, third, "updated")
+	require.NotSame(t, h, pool.handles[filePath])
+
+	_, err = h.file.Stat()
+	require.NoError(t, err, "file is still in use")
+
+	require.NoError(t, second.Close())
+	_, err = h.file.Stat()
+	require.ErrorIs(t, err, os.ErrClosed)
+
+	require.NoError(t, third.Close())
+
+	pool.close()
+	require.Empty(t, pool.handles)
+}
+
+func TestHandlePoolOpenErrors(t *testing.T) {
+	tmpDir, cleanup := tmpDir(t)
+	defer cleanup()
+
+	require.NoError(t, os.Symlink("missing", filepath.Join(tmpDir, "link")))
+
+	pool := newHandlePool(time.Minute)
+
+	_, err := pool.open(filepath.Join(tmpDir, "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = pool.open(filepath.Join(tmpDir, "link"))
+	require.Error(t, err, "symlinks are not followed")
+
+	_, err = pool.open(tmpDir)
+	require.ErrorIs(t, err, errNotFile)
+
+	require.Empty(t, pool.handles)
+}
+
+func requireContent(t *testing.T, file vfs.File, expected string) {
+	t.Helper()
+
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.Equal(t, expected, string(content))
+}
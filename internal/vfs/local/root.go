@@ -8,8 +8,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"golang.org/x/sys/unix"
-
 	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
 )
 
@@ -26,6 +24,9 @@ func (i *invalidPathError) Error() string {
 
 type Root struct {
 	rootPath string
+
+	attributes *attributeCache
+	handles    *handlePool
 }
 
 func (r *Root) validatePath(path string) (string, string, error) {
@@ -51,7 +52,7 @@ func (r *Root) Lstat(ctx context.Context, name string) (os.FileInfo, error) {
 		return nil, err
 	}
 
-	return os.Lstat(fullPath)
+	return r.attributes.lstat(fullPath)
 }
 
 func (r *Root) Readlink(ctx context.Context, name string) (string, error) {
@@ -60,7 +61,7 @@ func (r *Root) Readlink(ctx context.Context, name string) (string, error) {
 		return "", err
 	}
 
-	target, err := os.Readlink(fullPath)
+	target, err := r.attributes.readlink(fullPath)
 	if err != nil {
 		return "", err
 	}
@@ -86,22 +87,5 @@ func (r *Root) Open(ctx context.Context, name string) (vfs.File, error) {
 		return nil, err
 	}
 
-	file, err := os.OpenFile(fullPath, os.O_RDONLY|unix.O_NOFOLLOW, 0)
-	if err != nil {
-		return nil, err
-	}
-
-	// We do a `Stat()` on a file due to race-conditions
-	// Someone could update (unlikely) a file between `Stat()/Open()`
-	fi, err := file.Stat()
-	if err != nil {
-		return nil, err
-	}
-
-	if !fi.Mode().IsRegular() {
-		file.Close()
-		return nil, errNotFile
-	}
-
-	return file, nil
+	return r.handles.open(fullPath)
 }
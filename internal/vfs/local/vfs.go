@@ -3,9 +3,7 @@ package local
 import (
 	"context"
 	"errors"
-	"fmt"
-	"os"
-	"path/filepath"
+	"sync"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
@@ -13,36 +11,56 @@ import (
 
 var errNotDirectory = errors.New("path needs to be a directory")
 
-type VFS struct{}
+// VFS serves files from the local disk. Metadata operations and open file
+// handles can be cached, see Reconfigure.
+type VFS struct {
+	mu         sync.RWMutex
+	attributes *attributeCache
+	handles    *handlePool
+}
 
-func (localFs VFS) Root(ctx context.Context, path string, cacheKey string) (vfs.Root, error) {
-	rootPath, err := filepath.Abs(path)
-	if err != nil {
-		return nil, err
-	}
+func (localFs *VFS) Root(ctx context.Context, path string, cacheKey string) (vfs.Root, error) {
+	attributes, handles := localFs.caches()
 
-	rootPath, err = filepath.EvalSymlinks(rootPath)
-	if err != nil {
-		return nil, fmt.Errorf("could not evaluate symlinks: %w", err)
-	}
-
-	fi, err := os.Lstat(rootPath)
+	rootPath, err := attributes.root(path)
 	if err != nil {
 		return nil, err
 	}
 
-	if !fi.Mode().IsDir() {
-		return nil, errNotDirectory
-	}
-
-	return &Root{rootPath: rootPath}, nil
+	return &Root{rootPath: rootPath, attributes: attributes, handles: handles}, nil
 }
 
 func (localFs *VFS) Name() string {
 	return "local"
 }
 
-func (localFs *VFS) Reconfigure(*config.Config) error {
-	// noop
+// Reconfigure enables the attribute cache and the file handle pool when their
+// TTL is configured. Entries cached so far are dropped.
+func (localFs *VFS) Reconfigure(cfg *config.Config) error {
+	var attributes *attributeCache
+	if cfg.Disk.AttributeCacheTTL > 0 {
+		attributes = newAttributeCache(cfg.Disk.AttributeCacheTTL, cfg.Disk.AttributeCacheSize)
+	}
+
+	var handles *handlePool
+	if cfg.Disk.FileHandleCacheTTL > 0 {
+		handles = newHandlePool(cfg.Disk.FileHandleCacheTTL)
+	}
+
+	localFs.mu.Lock()
+	previous := localFs.handles
+	localFs.attributes = attributes
+	localFs.handles = handles
+	localFs.mu.Unlock()
+
+	previous.close()
+
 	return nil
 }
+
+func (localFs *VFS) caches() (*attributeCache, *handlePool) {
+	localFs.mu.RLock()
+	defer localFs.mu.RUnlock()
+
+	return localFs.attributes, localFs.handles
+}
@@ -43,7 +43,7 @@ func serveContent(w http.ResponseWriter, r *http.Request, modtime time.Time, con
 		// this shouldn't happen
 		errortracking.Capture(errUnknownContentType, errortracking.WithRequest(r), errortracking.WithStackTrace())
 		logging.LogRequest(r).WithError(errUnknownContentType).Error("could not serve content")
-		httperrors.Serve500(w)
+		httperrors.Serve500(w, r)
 
 		return
 	}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path"
 	"strconv"
@@ -19,6 +20,7 @@ import (
 	"gitlab.com/gitlab-org/labkit/log"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httprange"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/tracing"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
@@ -34,6 +36,8 @@ var (
 	errNotFile     = errors.New("not a file")
 )
 
+var errTooManyFiles = fmt.Errorf("%w: too many files in archive", vfs.ErrLimitExceeded)
+
 type archiveStatus int
 
 const (
@@ -53,8 +57,27 @@ type zipArchive struct {
 	done        chan struct{}
 	openTimeout time.Duration
 
+	// maxFiles fails opening archives with more entries, entries deeper than
+	// maxPathDepth are ignored, 0 means unlimited
+	maxFiles     int
+	maxPathDepth int
+
+	prefetch  httprange.Prefetch
+	diskCache *httprange.DiskCache
+
+	// checksum is the SHA256 the archive is verified against, if set
+	checksum string
+
+	coldPool *workerPool
+	hotPool  *workerPool
+
 	cacheNamespace string
 
+	// localFS maps the file:// archives, which are otherwise read with
+	// resource
+	localFS  http.FileSystem
+	mapped   *mappedFile
+	mmap     bool
 	resource *httprange.Resource
 	reader   *httprange.RangedReader
 	archive  *zip.Reader
@@ -71,6 +94,14 @@ func newArchive(fs *zipVFS, openTimeout time.Duration) *zipArchive {
 		files:          make(map[string]*zip.File),
 		directories:    make(map[string]*zip.FileHeader),
 		openTimeout:    openTimeout,
+		maxFiles:       fs.maxFiles,
+		maxPathDepth:   fs.maxPathDepth,
+		coldPool:       fs.coldPool,
+		hotPool:        fs.hotPool,
+		localFS:        fs.localFS,
+		mmap:           fs.mmap,
+		prefetch:       fs.prefetch,
+		diskCache:      fs.diskCache,
 		cacheNamespace: strconv.FormatInt(atomic.AddInt64(fs.archiveCount, 1), 10) + ":",
 	}
 }
@@ -86,13 +117,19 @@ func (a *zipArchive) openArchive(parentCtx context.Context, url string) (err err
 		return err
 	}
 
+	parentCtx, span := tracing.Start(parentCtx, "zip.open")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	ctx, cancel := context.WithTimeout(parentCtx, a.openTimeout)
 	defer cancel()
 
 	a.once.Do(func() {
 		// read archive once in its own routine with its own timeout
 		// if parentCtx is canceled, readArchive will continue regardless and will be cached in memory
-		go a.readArchive(url)
+		go a.readArchive(tracing.Detach(parentCtx), url)
 	})
 
 	// wait for readArchive to be done or return if the parent context is canceled
@@ -114,36 +151,82 @@ func (a *zipArchive) openArchive(parentCtx context.Context, url string) (err err
 
 // readArchive creates an httprange.Resource that can read the archive's contents and stores a slice of *zip.Files
 // that can be accessed later when calling any of th vfs.VFS operations
-func (a *zipArchive) readArchive(url string) {
+func (a *zipArchive) readArchive(parentCtx context.Context, url string) {
 	defer close(a.done)
 
+	parentCtx, span := tracing.Start(parentCtx, "zip.read")
+	defer func() {
+		tracing.RecordError(span, a.err)
+		span.End()
+	}()
+
 	// readArchive with a timeout separate from openArchive's
-	ctx, cancel := context.WithTimeout(context.Background(), a.openTimeout)
+	ctx, cancel := context.WithTimeout(parentCtx, a.openTimeout)
 	defer cancel()
 
-	a.resource, a.err = httprange.NewResource(ctx, url, a.fs.httpClient)
-	if a.err != nil {
+	release, err := a.coldPool.acquire(ctx)
+	if err != nil {
+		a.err = err
 		metrics.ZipOpened.WithLabelValues("error").Inc()
 		return
 	}
+	defer release()
 
-	// load all archive files into memory using a cached ranged reader
-	a.reader = httprange.NewRangedReader(a.resource)
-	a.reader.WithCachedReader(ctx, func() {
-		a.archive, a.err = zip.NewReader(a.reader, a.resource.Size)
-	})
+	if !a.readMappedArchive(url) {
+		a.resource, a.err = httprange.NewResourceWithFallback(ctx, url, a.fs.httpClient, a.fs.rangeFallbackSize)
+		if a.err != nil {
+			metrics.ZipOpened.WithLabelValues("error").Inc()
+			return
+		}
+
+		// load all archive files into memory using a cached ranged reader
+		a.reader = httprange.NewRangedReader(a.resource).
+			WithPrefetch(a.prefetch).
+			WithDiskCache(a.diskCache)
+		a.reader.WithCachedReader(ctx, func() {
+			a.archive, a.err = zip.NewReader(a.reader, a.resource.Size)
+		})
+	}
 
 	if a.archive == nil || a.err != nil {
 		metrics.ZipOpened.WithLabelValues("error").Inc()
 		return
 	}
 
+	if err := a.verifyChecksum(ctx); err != nil {
+		a.archive = nil
+		a.err = err
+		metrics.ZipOpened.WithLabelValues("error").Inc()
+		return
+	}
+
+	// a zip bomb of millions of entries is rejected before building the index
+	if a.maxFiles > 0 && len(a.archive.File) > a.maxFiles {
+		log.ContextLogger(ctx).WithFields(log.Fields{
+			"files":     len(a.archive.File),
+			"max_files": a.maxFiles,
+		}).Warn("zip archive has too many files, it is not served")
+
+		a.archive = nil
+		a.err = errTooManyFiles
+		metrics.ZipLimitsExceeded.WithLabelValues("files").Inc()
+		metrics.ZipOpened.WithLabelValues("error").Inc()
+		return
+	}
+
+	var tooDeep int
+
 	// TODO: Improve preprocessing of zip archives https://gitlab.com/gitlab-org/gitlab-pages/-/issues/432
 	for _, file := range a.archive.File {
 		if !strings.HasPrefix(file.Name, dirPrefix) {
 			continue
 		}
 
+		if a.tooDeep(file.Name) {
+			tooDeep++
+			continue
+		}
+
 		if file.Mode().IsDir() {
 			a.directories[file.Name] = &file.FileHeader
 		} else {
@@ -153,6 +236,14 @@ func (a *zipArchive) readArchive(url string) {
 		a.addPathDirectory(file.Name)
 	}
 
+	if tooDeep > 0 {
+		metrics.ZipLimitsExceeded.WithLabelValues("path_depth").Inc()
+		log.ContextLogger(ctx).WithFields(log.Fields{
+			"ignored_entries": tooDeep,
+			"max_path_depth":  a.maxPathDepth,
+		}).Warn("zip archive has entries nested too deep, they are not served")
+	}
+
 	// recycle memory
 	a.archive.File = nil
 
@@ -162,6 +253,41 @@ func (a *zipArchive) readArchive(url string) {
 	metrics.ZipArchiveEntriesCached.Add(fileCount)
 }
 
+// readMappedArchive reads the file:// archive of url from its mapping,
+// returning false if it can't be mapped, or mapping is disabled, so that it
+// is read with the file:// transport instead
+func (a *zipArchive) readMappedArchive(url string) bool {
+	if !a.mmap || a.localFS == nil || !strings.HasPrefix(url, "file://") {
+		return false
+	}
+
+	mapped, err := openMappedFile(a.localFS, url)
+	if err != nil {
+		return false
+	}
+
+	a.mapped = mapped
+	a.archive, a.err = zip.NewReader(mapped, mapped.Size())
+
+	return true
+}
+
+// verifyChecksum reads the whole archive to compare its SHA256 to checksum
+func (a *zipArchive) verifyChecksum(ctx context.Context) error {
+	if a.checksum == "" {
+		return nil
+	}
+
+	if a.mapped != nil {
+		return verifySHA256(io.NewSectionReader(a.mapped, 0, a.mapped.Size()), a.checksum)
+	}
+
+	reader := httprange.NewReader(ctx, a.resource, 0, a.resource.Size)
+	defer reader.Close()
+
+	return verifySHA256(reader, a.checksum)
+}
+
 // addPathDirectory adds a directory for a given path
 func (a *zipArchive) addPathDirectory(pathname string) {
 	// Split dir and file from `path`
@@ -179,15 +305,37 @@ func (a *zipArchive) addPathDirectory(pathname string) {
 	}
 }
 
+// tooDeep returns true if name, a path including dirPrefix, is nested deeper
+// than the maximum path depth
+func (a *zipArchive) tooDeep(name string) bool {
+	if a.maxPathDepth <= 0 {
+		return false
+	}
+
+	name = strings.Trim(strings.TrimPrefix(name, dirPrefix), "/")
+
+	return strings.Count(name, "/") >= a.maxPathDepth
+}
+
 func (a *zipArchive) findFile(name string) *zip.File {
 	name = path.Clean(dirPrefix + name)
 
+	// such paths are not indexed, the lookup of every parent directory of
+	// a deep request path ends here
+	if a.tooDeep(name) {
+		return nil
+	}
+
 	return a.files[name]
 }
 
 func (a *zipArchive) findDirectory(name string) *zip.FileHeader {
 	name = path.Clean(dirPrefix + name)
 
+	if a.tooDeep(name) {
+		return nil
+	}
+
 	return a.directories[name+"/"]
 }
 
@@ -205,22 +353,39 @@ func (a *zipArchive) Open(ctx context.Context, name string) (vfs.File, error) {
 		return nil, errNotFile
 	}
 
+	// the worker is held until the first read is set up or the file is closed
+	release, err := a.hotPool.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	dataOffset, err := a.fs.dataOffsetCache.FindOrFetch(a.cacheNamespace, name, func() (interface{}, error) {
 		return file.DataOffset()
 	})
 	if err != nil {
+		release()
 		return nil, err
 	}
 
 	// only read from dataOffset up to the size of the compressed file
-	reader := a.reader.SectionReader(ctx, dataOffset.(int64), int64(file.CompressedSize64))
+	section := func() io.ReadCloser {
+		if a.mapped != nil {
+			return a.mapped.SectionReader(dataOffset.(int64), int64(file.CompressedSize64))
+		}
+
+		return a.reader.SectionReader(ctx, dataOffset.(int64), int64(file.CompressedSize64))
+	}
 
 	switch file.Method {
 	case zip.Deflate:
-		return newDeflateReader(reader), nil
+		// seekable so that the byte ranges of the file are served
+		return withRelease(newSeekableDeflateReader(section, int64(file.UncompressedSize64)), release), nil
 	case zip.Store:
-		return reader, nil
+		return withRelease(section(), release), nil
+	case zstdMethod:
+		return withRelease(newSeekableZstdReader(section, int64(file.UncompressedSize64)), release), nil
 	default:
+		release()
 		return nil, fmt.Errorf("unsupported compression method: %x", file.Method)
 	}
 }
@@ -255,6 +420,12 @@ func (a *zipArchive) Readlink(ctx context.Context, name string) (string, error)
 	}
 
 	symlinkValue, err := a.fs.readlinkCache.FindOrFetch(a.cacheNamespace, name, func() (interface{}, error) {
+		release, err := a.hotPool.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
 		rc, err := file.Open()
 		if err != nil {
 			return nil, err
@@ -289,6 +460,16 @@ func (a *zipArchive) Readlink(ctx context.Context, name string) (string, error)
 // onEvicted called by the zipVFS.cache when an archive is removed from the cache
 func (a *zipArchive) onEvicted() {
 	metrics.ZipArchiveEntriesCached.Sub(float64(len(a.files)))
+
+	// the mapping is released once the archive is read, the files still
+	// open keep it until they are closed
+	go func() {
+		<-a.done
+
+		if a.mapped != nil {
+			a.mapped.close()
+		}
+	}()
 }
 
 func (a *zipArchive) openStatus() (archiveStatus, error) {
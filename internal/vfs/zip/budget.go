@@ -0,0 +1,149 @@
+package zip
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// egressWarningRatio is the share of the budget above which a warning is
+// logged, once per window
+const egressWarningRatio = 0.8
+
+// egressBudget counts the bytes read from the object storage per window.
+// Once the budget of a window is spent, the archives already opened are still
+// served, but no other archive is opened until the next window.
+type egressBudget struct {
+	mu     sync.Mutex
+	limit  int64
+	window time.Duration
+	start  time.Time
+	used   int64
+	warned bool
+	spent  bool
+	now    func() time.Time
+}
+
+func newEgressBudget(limit int64, window time.Duration) *egressBudget {
+	b := &egressBudget{now: time.Now}
+	b.configure(limit, window)
+
+	return b
+}
+
+// configure sets the limit of the budget per window, 0 means unlimited. The
+// bytes used in the current window are kept.
+func (b *egressBudget) configure(limit int64, window time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.limit = limit
+	b.window = window
+	b.reportUsage()
+}
+
+func (b *egressBudget) add(n int64) {
+	metrics.ObjectStorageEgressBytes.Add(float64(n))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.roll()
+	b.used += n
+
+	if b.limit <= 0 {
+		return
+	}
+
+	b.reportUsage()
+
+	if !b.warned && float64(b.used) >= egressWarningRatio*float64(b.limit) {
+		b.warned = true
+		b.logger().Warn("the object storage egress budget is nearly spent")
+	}
+
+	if !b.spent && b.used >= b.limit {
+		b.spent = true
+		b.logger().Error("the object storage egress budget is spent, archives are not opened until the window resets")
+	}
+}
+
+func (b *egressBudget) logger() *logrus.Entry {
+	return log.WithFields(log.Fields{
+		"used_bytes":   b.used,
+		"budget_bytes": b.limit,
+		"window_start": b.start,
+	})
+}
+
+// exceeded returns whether the budget of the current window is spent
+func (b *egressBudget) exceeded() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.roll()
+
+	return b.limit > 0 && b.used >= b.limit
+}
+
+// roll starts a new window once the current one is over
+func (b *egressBudget) roll() {
+	now := b.now()
+	if b.window > 0 && now.Sub(b.start) < b.window {
+		return
+	}
+
+	b.start = now
+	b.used = 0
+	b.warned = false
+	b.spent = false
+	b.reportUsage()
+}
+
+func (b *egressBudget) reportUsage() {
+	usage := 0.0
+	if b.limit > 0 {
+		usage = float64(b.used) / float64(b.limit)
+	}
+
+	metrics.ObjectStorageEgressBudgetUsage.Set(usage)
+}
+
+// egressRoundTripper counts the bytes of the responses of the object storage
+// in the budget. Archives served from the local disk are not counted.
+type egressRoundTripper struct {
+	httptransport.Transport
+	budget *egressBudget
+}
+
+func (rt *egressRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := rt.Transport.RoundTrip(r)
+	if err != nil || r.URL.Scheme == "file" {
+		return res, err
+	}
+
+	res.Body = &countingBody{ReadCloser: res.Body, budget: rt.budget}
+
+	return res, nil
+}
+
+type countingBody struct {
+	io.ReadCloser
+	budget *egressBudget
+}
+
+func (cb *countingBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	if n > 0 {
+		cb.budget.add(int64(n))
+	}
+
+	return n, err
+}
@@ -0,0 +1,62 @@
+package zip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+)
+
+func TestEgressBudget(t *testing.T) {
+	now := time.Now()
+
+	b := newEgressBudget(100, time.Hour)
+	b.now = func() time.Time { return now }
+
+	b.add(80)
+	require.False(t, b.exceeded())
+	require.True(t, b.warned)
+
+	b.add(20)
+	require.True(t, b.exceeded())
+
+	// the budget is spent until the window resets
+	now = now.Add(59 * time.Minute)
+	require.True(t, b.exceeded())
+
+	now = now.Add(2 * time.Minute)
+	require.False(t, b.exceeded())
+	require.False(t, b.warned)
+}
+
+func TestEgressBudgetUnlimited(t *testing.T) {
+	b := newEgressBudget(0, time.Hour)
+
+	b.add(1 << 40)
+	require.False(t, b.exceeded())
+}
+
+func TestVFSRootEgressBudget(t *testing.T) {
+	url, cleanup := newZipFileServerURL(t, "group/zip.gitlab.io/public.zip", nil)
+	defer cleanup()
+
+	cfg := zipCfg
+	cfg.EgressBudget = 1
+	cfg.EgressBudgetWindow = time.Hour
+
+	zfs := New(&cfg)
+
+	cached, err := zfs.Root(context.Background(), url+"/public.zip", "cached")
+	require.NoError(t, err)
+
+	// the archives already opened are still served
+	root, err := zfs.Root(context.Background(), url+"/public.zip", "cached")
+	require.NoError(t, err)
+	require.Same(t, cached, root)
+
+	_, err = zfs.Root(context.Background(), url+"/public.zip", "not-cached")
+	require.ErrorIs(t, err, vfs.ErrEgressBudgetExceeded)
+}
@@ -0,0 +1,39 @@
+package zip
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+)
+
+// isSHA256 returns true if key is a hex-encoded SHA256, as the cache keys
+// of the deployments are
+func isSHA256(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(key)
+
+	return err == nil
+}
+
+// verifySHA256 returns vfs.ErrChecksumMismatch if the SHA256 of the content
+// of r is not expected
+func verifySHA256(r io.Reader, expected string) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: archive SHA256 is %s, expected %s", vfs.ErrChecksumMismatch, actual, expected)
+	}
+
+	return nil
+}
@@ -64,3 +64,122 @@ func newDeflateReader(r io.ReadCloser) *deflateReader {
 		flateReader: flate.NewReader(br),
 	}
 }
+
+// maxDecompressions bounds how many times a compressed file is decompressed
+// from its start for a single request, each time costs a range request to the
+// object storage and the decompression of the file up to the offset sought.
+// Two are enough for the ranges of a request in ascending order and one
+// range before them.
+const maxDecompressions = 2
+
+var (
+	errSeekInvalidWhence     = errors.New("deflatereader: invalid whence")
+	errSeekNegativeOffset    = errors.New("deflatereader: negative offset")
+	errTooManyDecompressions = errors.New("deflatereader: too many backward seeks")
+)
+
+// seekableReader serves the byte ranges of a compressed file. The file is
+// decompressed from its start on the first read: seeking forward discards
+// the bytes in between, and seeking backward decompresses the file again, up
+// to maxDecompressions times.
+// Implements the io.ReadSeekCloser interface.
+type seekableReader struct {
+	open       func() io.ReadCloser
+	decompress func(io.ReadCloser) (io.ReadCloser, error)
+	size       int64
+
+	reader         io.ReadCloser
+	pos            int64
+	offset         int64
+	decompressions int
+}
+
+func newSeekableDeflateReader(open func() io.ReadCloser, size int64) *seekableReader {
+	return &seekableReader{
+		open: open,
+		decompress: func(r io.ReadCloser) (io.ReadCloser, error) {
+			return newDeflateReader(r), nil
+		},
+		size: size,
+	}
+}
+
+// Read decompresses the file from the offset last sought to
+func (r *seekableReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.reader == nil || r.offset < r.pos {
+		if r.reader != nil {
+			r.reader.Close()
+			r.reader = nil
+		}
+
+		if r.decompressions >= maxDecompressions {
+			return 0, errTooManyDecompressions
+		}
+		r.decompressions++
+
+		reader, err := r.decompress(r.open())
+		if err != nil {
+			r.reader = nil
+			return 0, err
+		}
+
+		r.reader = reader
+		r.pos = 0
+	}
+
+	if r.offset > r.pos {
+		n, err := io.CopyN(io.Discard, r.reader, r.offset-r.pos)
+		r.pos += n
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return 0, err
+		}
+	}
+
+	n, err := r.reader.Read(p)
+	r.pos += int64(n)
+	r.offset = r.pos
+
+	return n, err
+}
+
+// Seek sets the offset of the next Read, relative to the uncompressed size
+// of the file for io.SeekEnd
+func (r *seekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errSeekInvalidWhence
+	}
+
+	if offset < 0 {
+		return 0, errSeekNegativeOffset
+	}
+
+	r.offset = offset
+
+	return offset, nil
+}
+
+// Close the reader of the file, if it was read
+func (r *seekableReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+
+	err := r.reader.Close()
+	r.reader = nil
+
+	return err
+}
@@ -0,0 +1,163 @@
+package zip
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"sync"
+	"syscall"
+)
+
+var (
+	errNotMappable = errors.New("archive can't be mapped")
+	errUnmapped    = errors.New("archive is unmapped")
+	errMappedFault = errors.New("archive mapping faulted, it may have been truncated or replaced")
+)
+
+// mappedFile is a local archive mapped in memory, read without going through
+// the file:// transport. It is unmapped once the archive and all the files
+// opened from it are closed.
+// Implements the io.ReaderAt interface that can be used with archive/zip.
+type mappedFile struct {
+	mu   sync.Mutex
+	data []byte
+	// refs counts the archive and its readers, the file is unmapped when
+	// it drops to 0
+	refs int
+}
+
+// openMappedFile maps the archive of the file:// URL rawURL, opened from
+// fileSystem so that only the allowed paths are mapped
+func openMappedFile(fileSystem http.FileSystem, rawURL string) (*mappedFile, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fileSystem.Open(u.Path)
+	if err != nil {
+		return nil, err
+	}
+	// the mapping outlives the file descriptor
+	defer f.Close()
+
+	osFile, ok := f.(*os.File)
+	if !ok {
+		return nil, errNotMappable
+	}
+
+	fi, err := osFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// empty files can't be mapped, and are not valid archives either
+	if fi.Size() <= 0 || int64(int(fi.Size())) != fi.Size() {
+		return nil, errNotMappable
+	}
+
+	data, err := syscall.Mmap(int(osFile.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mappedFile{data: data, refs: 1}, nil
+}
+
+// Size of the mapped archive
+func (m *mappedFile) Size() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return int64(len(m.data))
+}
+
+func (m *mappedFile) acquire() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.refs == 0 {
+		return false
+	}
+
+	m.refs++
+
+	return true
+}
+
+func (m *mappedFile) release() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refs--
+	if m.refs > 0 {
+		return
+	}
+
+	syscall.Munmap(m.data) // nolint:errcheck // the mapping is not used anymore
+	m.data = nil
+}
+
+// ReadAt copies the bytes of the archive from offset into buf. A page of the
+// mapping which can no longer be read, as the archive was truncated or its
+// network filesystem went away, fails the read instead of the process.
+func (m *mappedFile) ReadAt(buf []byte, offset int64) (n int, err error) {
+	if !m.acquire() {
+		return 0, errUnmapped
+	}
+	defer m.release()
+
+	if offset >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if recover() != nil {
+			n, err = 0, errMappedFault
+		}
+	}()
+
+	n = copy(buf, m.data[offset:])
+	if n < len(buf) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// SectionReader returns a reader of size bytes of the archive from offset,
+// the archive stays mapped until it is closed
+func (m *mappedFile) SectionReader(offset, size int64) io.ReadCloser {
+	section := &mappedSection{SectionReader: io.NewSectionReader(m, offset, size)}
+	if m.acquire() {
+		section.release = m.release
+	}
+
+	return section
+}
+
+// close releases the reference of the archive to the mapping
+func (m *mappedFile) close() {
+	m.release()
+}
+
+// mappedSection implements the io.ReadSeekCloser interface
+type mappedSection struct {
+	*io.SectionReader
+	once    sync.Once
+	release func()
+}
+
+func (s *mappedSection) Close() error {
+	s.once.Do(func() {
+		if s.release != nil {
+			s.release()
+		}
+	})
+
+	return nil
+}
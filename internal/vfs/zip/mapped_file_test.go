@@ -0,0 +1,104 @@
+package zip
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/httpfs"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/testhelpers"
+)
+
+func TestMappedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "public.zip")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0600))
+
+	localFS, err := httpfs.NewFileSystemPath([]string{dir})
+	require.NoError(t, err)
+
+	m, err := openMappedFile(localFS, "file://"+path)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), m.Size())
+
+	buf := make([]byte, 4)
+	n, err := m.ReadAt(buf, 8)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, "89", string(buf[:n]))
+
+	// the open sections keep the file mapped once the archive is closed
+	section := m.SectionReader(2, 3)
+	m.close()
+
+	data, err := io.ReadAll(section)
+	require.NoError(t, err)
+	require.Equal(t, "234", string(data))
+
+	require.NoError(t, section.Close())
+	require.NoError(t, section.Close(), "closing twice releases the mapping once")
+
+	_, err = m.ReadAt(buf, 0)
+	require.ErrorIs(t, err, errUnmapped)
+
+	_, err = io.ReadAll(m.SectionReader(0, 1))
+	require.ErrorIs(t, err, errUnmapped)
+}
+
+func TestOpenMappedFileNotAllowed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "public.zip")
+	require.NoError(t, os.WriteFile(path, []byte("content"), 0600))
+
+	localFS, err := httpfs.NewFileSystemPath([]string{filepath.Join(dir, "allowed")})
+	require.NoError(t, err)
+
+	_, err = openMappedFile(localFS, "file://"+path)
+	require.ErrorIs(t, err, os.ErrPermission)
+}
+
+func TestMappedFileTruncated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "public.zip")
+	pageSize := os.Getpagesize()
+	require.NoError(t, os.WriteFile(path, make([]byte, 2*pageSize), 0600))
+
+	localFS, err := httpfs.NewFileSystemPath([]string{dir})
+	require.NoError(t, err)
+
+	m, err := openMappedFile(localFS, "file://"+path)
+	require.NoError(t, err)
+	defer m.close()
+
+	// the archive is replaced in place while it is mapped
+	require.NoError(t, os.Truncate(path, 0))
+
+	_, err = m.ReadAt(make([]byte, 1), int64(pageSize))
+	require.ErrorIs(t, err, errMappedFault)
+}
+
+func TestLocalArchivesNotMappedByDefault(t *testing.T) {
+	_, cleanup := newZipFileServerURL(t, "group/zip.gitlab.io/public.zip", nil)
+	defer cleanup()
+
+	cfg := zipCfg
+	cfg.AllowedPaths = []string{testhelpers.Getwd(t)}
+
+	fs := New(&cfg).(*zipVFS)
+	require.NoError(t, fs.Reconfigure(&config.Config{Zip: cfg}))
+
+	root, err := fs.Root(context.Background(), testhelpers.ToFileProtocol(t, "group/zip.gitlab.io/public.zip"), "key")
+	require.NoError(t, err)
+
+	zip, ok := root.(*zipArchive)
+	require.True(t, ok)
+	require.Nil(t, zip.mapped)
+
+	f, err := zip.Open(context.Background(), "index.html")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
@@ -0,0 +1,131 @@
+package zip
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+const (
+	coldPool = "cold"
+	hotPool  = "hot"
+)
+
+// workerPool bounds the number of concurrent fetches from object storage.
+// Archives being opened (cold) and files read from opened archives (hot) have
+// their own pool, so a storm of cold opens cannot starve the active sites.
+type workerPool struct {
+	name     string
+	workers  chan struct{}
+	maxQueue int64
+	err      error
+
+	// the `int64` needs to be 64bit aligned on some 32bit systems
+	queued *int64
+}
+
+// newWorkerPool returns nil, an unlimited pool, if workers is 0
+func newWorkerPool(name string, workers, queue int) *workerPool {
+	if workers <= 0 {
+		return nil
+	}
+
+	return &workerPool{
+		name:     name,
+		workers:  make(chan struct{}, workers),
+		maxQueue: int64(queue),
+		err:      fmt.Errorf("%w: %s pool", vfs.ErrSaturated, name),
+		queued:   new(int64),
+	}
+}
+
+// acquire waits for a worker and returns the function releasing it. The
+// request is rejected when the queue is full or ctx is done before a worker
+// is available.
+func (p *workerPool) acquire(ctx context.Context) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case p.workers <- struct{}{}:
+		return p.release(), nil
+	default:
+	}
+
+	if atomic.AddInt64(p.queued, 1) > p.maxQueue {
+		atomic.AddInt64(p.queued, -1)
+		metrics.ZipPoolRejected.WithLabelValues(p.name).Inc()
+		return nil, p.err
+	}
+
+	metrics.ZipPoolQueueLength.WithLabelValues(p.name).Inc()
+	defer func() {
+		atomic.AddInt64(p.queued, -1)
+		metrics.ZipPoolQueueLength.WithLabelValues(p.name).Dec()
+	}()
+
+	select {
+	case p.workers <- struct{}{}:
+		return p.release(), nil
+	case <-ctx.Done():
+		metrics.ZipPoolRejected.WithLabelValues(p.name).Inc()
+		return nil, fmt.Errorf("%w: %v", p.err, ctx.Err())
+	}
+}
+
+func (p *workerPool) release() func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(func() { <-p.workers })
+	}
+}
+
+// pooledFile holds a worker of the hot pool until the first read from object
+// storage returns, a slow client does not keep the worker for the whole transfer
+type pooledFile struct {
+	vfs.File
+	release func()
+}
+
+func (f *pooledFile) Read(p []byte) (int, error) {
+	defer f.release()
+
+	return f.File.Read(p)
+}
+
+func (f *pooledFile) Close() error {
+	defer f.release()
+
+	return f.File.Close()
+}
+
+type pooledSeekableFile struct {
+	vfs.SeekableFile
+	release func()
+}
+
+func (f *pooledSeekableFile) Read(p []byte) (int, error) {
+	defer f.release()
+
+	return f.SeekableFile.Read(p)
+}
+
+func (f *pooledSeekableFile) Close() error {
+	defer f.release()
+
+	return f.SeekableFile.Close()
+}
+
+func withRelease(file vfs.File, release func()) vfs.File {
+	if seekable, ok := file.(vfs.SeekableFile); ok {
+		return &pooledSeekableFile{SeekableFile: seekable, release: release}
+	}
+
+	return &pooledFile{File: file, release: release}
+}
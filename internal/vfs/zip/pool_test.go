@@ -0,0 +1,64 @@
+package zip
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
+)
+
+func TestWorkerPoolQueue(t *testing.T) {
+	p := newWorkerPool(hotPool, 1, 1)
+
+	release, err := p.acquire(context.Background())
+	require.NoError(t, err)
+
+	acquired := make(chan error)
+	go func() {
+		queuedRelease, err := p.acquire(context.Background())
+		if err == nil {
+			queuedRelease()
+		}
+		acquired <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(p.queued) == 1
+	}, time.Second, time.Millisecond)
+
+	_, err = p.acquire(context.Background())
+	require.ErrorIs(t, err, vfs.ErrSaturated, "requests are rejected once the queue is full")
+
+	// releasing twice must not free a second worker
+	release()
+	release()
+
+	require.NoError(t, <-acquired)
+}
+
+func TestWorkerPoolTimeout(t *testing.T) {
+	p := newWorkerPool(coldPool, 1, 1)
+
+	release, err := p.acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = p.acquire(ctx)
+	require.ErrorIs(t, err, vfs.ErrSaturated)
+}
+
+func TestWorkerPoolUnlimited(t *testing.T) {
+	p := newWorkerPool(hotPool, 0, 0)
+	require.Nil(t, p)
+
+	release, err := p.acquire(context.Background())
+	require.NoError(t, err)
+	release()
+}
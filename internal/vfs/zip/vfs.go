@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io/fs"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httprange"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/httptransport"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/lru"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/readonly"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
@@ -29,6 +31,10 @@ const (
 	// this gives around 2MB of raw memory needed without acceleration structures
 	defaultReadlinkItems              = 10000
 	defaultReadlinkExpirationInterval = time.Hour
+
+	// a full archive cache evicts 1/archiveEvictionBatch of its archives at
+	// once, so that it is not scanned for every archive added
+	archiveEvictionBatch = 16
 )
 
 var (
@@ -38,6 +44,20 @@ var (
 
 type lruCache interface {
 	FindOrFetch(cacheNamespace, key string, fetchFn func() (interface{}, error)) (interface{}, error)
+	Len() int
+	DeletePrefix(prefix string) int
+}
+
+// Cache of the archives opened by the zip VFS, it is purged on request
+type Cache interface {
+	// CacheEntries returns the number of entries of the archive cache and of
+	// the LRU caches of the archives, by name
+	CacheEntries() map[string]int
+	// PurgeArchives removes the archives cached under keys, it returns how
+	// many were cached
+	PurgeArchives(keys ...string) int
+	// ClearArchives removes all the archives, it returns how many were cached
+	ClearArchives() int
 }
 
 // zipVFS is a simple cached implementation of the vfs.VFS interface
@@ -49,6 +69,29 @@ type zipVFS struct {
 	cacheExpirationInterval time.Duration
 	cacheRefreshInterval    time.Duration
 	cacheCleanupInterval    time.Duration
+	// cacheMaxArchives is the number of archives cached, 0 means unlimited
+	cacheMaxArchives int
+
+	// maxFiles and maxPathDepth limit the archives that are indexed, 0 means
+	// unlimited
+	maxFiles     int
+	maxPathDepth int
+
+	prefetch  httprange.Prefetch
+	diskCache *httprange.DiskCache
+	// rangeFallbackSize is the size of the largest archive downloaded in
+	// full when the object storage does not support range requests
+	rangeFallbackSize int64
+
+	// verifySHA256 verifies the archives against their cache key, the
+	// SHA256 of their deployment
+	verifySHA256 bool
+	// mmap maps the file:// archives in memory
+	mmap bool
+
+	coldPool *workerPool
+	hotPool  *workerPool
+	budget   *egressBudget
 
 	dataOffsetCache lruCache
 	readlinkCache   lruCache
@@ -57,27 +100,44 @@ type zipVFS struct {
 	// https://gitlab.com/gitlab-org/gitlab/-/issues/337261
 	archiveCount *int64
 	httpClient   *http.Client
+	// localFS opens the file:// archives within the allowed paths
+	localFS http.FileSystem
 }
 
 // New creates a zipVFS instance that can be used by a serving request
 func New(cfg *config.ZipServing) vfs.VFS {
+	budget := newEgressBudget(cfg.EgressBudget, cfg.EgressBudgetWindow)
+
 	zipVFS := &zipVFS{
 		cacheExpirationInterval: cfg.ExpirationInterval,
 		cacheRefreshInterval:    cfg.RefreshInterval,
 		cacheCleanupInterval:    cfg.CleanupInterval,
+		cacheMaxArchives:        cfg.MaxArchives,
 		openTimeout:             cfg.OpenTimeout,
+		maxFiles:                cfg.MaxFiles,
+		verifySHA256:            cfg.VerifySHA256,
+		mmap:                    cfg.Mmap,
+		prefetch:                httprange.Prefetch{Concurrency: cfg.PrefetchConcurrency, ChunkSize: cfg.PrefetchChunkSize},
+		rangeFallbackSize:       cfg.RangeFallbackSize,
+		maxPathDepth:            cfg.MaxPathDepth,
+		coldPool:                newWorkerPool(coldPool, cfg.ColdWorkers, cfg.ColdQueue),
+		hotPool:                 newWorkerPool(hotPool, cfg.HotWorkers, cfg.HotQueue),
+		budget:                  budget,
 		httpClient: &http.Client{
 			// TODO: make this timeout configurable
 			// https://gitlab.com/gitlab-org/gitlab-pages/-/issues/457
 			Timeout: 30 * time.Minute,
-			Transport: httptransport.NewMeteredRoundTripper(
-				httptransport.NewTransport(),
-				"zip_vfs",
-				metrics.HTTPRangeTraceDuration,
-				metrics.HTTPRangeRequestDuration,
-				metrics.HTTPRangeRequestsTotal,
-				httptransport.DefaultTTFBTimeout,
-			),
+			Transport: &egressRoundTripper{
+				Transport: httptransport.NewMeteredRoundTripper(
+					httptransport.NewTransport(),
+					"zip_vfs",
+					metrics.HTTPRangeTraceDuration,
+					metrics.HTTPRangeRequestDuration,
+					metrics.HTTPRangeRequestsTotal,
+					httptransport.DefaultTTFBTimeout,
+				).(httptransport.Transport),
+				budget: budget,
+			},
 		},
 		archiveCount: new(int64),
 	}
@@ -113,17 +173,38 @@ func (zfs *zipVFS) Reconfigure(cfg *config.Config) error {
 	zfs.cacheExpirationInterval = cfg.Zip.ExpirationInterval
 	zfs.cacheRefreshInterval = cfg.Zip.RefreshInterval
 	zfs.cacheCleanupInterval = cfg.Zip.CleanupInterval
+	zfs.cacheMaxArchives = cfg.Zip.MaxArchives
+	zfs.maxFiles = cfg.Zip.MaxFiles
+	zfs.verifySHA256 = cfg.Zip.VerifySHA256
+	zfs.mmap = cfg.Zip.Mmap
+	zfs.prefetch = httprange.Prefetch{Concurrency: cfg.Zip.PrefetchConcurrency, ChunkSize: cfg.Zip.PrefetchChunkSize}
+	zfs.rangeFallbackSize = cfg.Zip.RangeFallbackSize
+	zfs.maxPathDepth = cfg.Zip.MaxPathDepth
+	// workers held by archives of the previous cache are released to the
+	// pools they were acquired from
+	zfs.coldPool = newWorkerPool(coldPool, cfg.Zip.ColdWorkers, cfg.Zip.ColdQueue)
+	zfs.hotPool = newWorkerPool(hotPool, cfg.Zip.HotWorkers, cfg.Zip.HotQueue)
+	zfs.budget.configure(cfg.Zip.EgressBudget, cfg.Zip.EgressBudgetWindow)
 
 	if err := zfs.reconfigureTransport(cfg); err != nil {
 		return err
 	}
 
+	if err := zfs.reconfigureDiskCache(cfg); err != nil {
+		return err
+	}
+
 	zfs.resetCache()
 
 	return nil
 }
 
 func (zfs *zipVFS) reconfigureTransport(cfg *config.Config) error {
+	// without allowed paths the archives are only opened over http(s)
+	if len(cfg.Zip.AllowedPaths) == 0 {
+		return nil
+	}
+
 	fsTransport, err := httpfs.NewFileSystemPath(cfg.Zip.AllowedPaths)
 	if err != nil {
 		return err
@@ -131,6 +212,24 @@ func (zfs *zipVFS) reconfigureTransport(cfg *config.Config) error {
 
 	zfs.httpClient.Transport.(httptransport.Transport).
 		RegisterProtocol("file", http.NewFileTransport(fsTransport))
+	zfs.localFS = fsTransport
+
+	return nil
+}
+
+func (zfs *zipVFS) reconfigureDiskCache(cfg *config.Config) error {
+	zfs.diskCache = nil
+
+	if cfg.Zip.RangeCacheDir == "" {
+		return nil
+	}
+
+	diskCache, err := httprange.NewDiskCache(cfg.Zip.RangeCacheDir, cfg.Zip.RangeCacheSize, cfg.Zip.RangeCacheMaxRangeSize)
+	if err != nil {
+		return err
+	}
+
+	zfs.diskCache = diskCache
 
 	return nil
 }
@@ -189,12 +288,19 @@ func (zfs *zipVFS) findOrCreateArchive(key string) (*zipArchive, error) {
 
 	archive, expiry, found := zfs.cache.GetWithExpiration(key)
 	if found {
-		status, _ := archive.(*zipArchive).openStatus()
+		status, err := archive.(*zipArchive).openStatus()
 		switch status {
 		case archiveOpening:
 			metrics.ZipCacheRequests.WithLabelValues("archive", "hit-opening").Inc()
 
 		case archiveOpenError:
+			if errors.Is(err, vfs.ErrSaturated) {
+				// the archive was never fetched, it is opened again
+				metrics.ZipCacheRequests.WithLabelValues("archive", "saturated").Inc()
+				archive = nil
+				break
+			}
+
 			// this means that archive is likely corrupted
 			// we keep it for duration of cache entry expiry (negative cache)
 			metrics.ZipCacheRequests.WithLabelValues("archive", "hit-open-error").Inc()
@@ -216,12 +322,27 @@ func (zfs *zipVFS) findOrCreateArchive(key string) (*zipArchive, error) {
 	}
 
 	if archive == nil {
-		archive = newArchive(zfs, zfs.openTimeout)
+		if readonly.Enabled() {
+			metrics.ZipCacheRequests.WithLabelValues("archive", "read-only").Inc()
+			return nil, readonly.ErrReadOnly
+		}
+
+		if zfs.budget.exceeded() {
+			metrics.ZipCacheRequests.WithLabelValues("archive", "egress-budget-exceeded").Inc()
+			return nil, vfs.ErrEgressBudgetExceeded
+		}
+
+		created := newArchive(zfs, zfs.openTimeout)
+		if zfs.verifySHA256 && isSHA256(key) {
+			created.checksum = key
+		}
+		archive = created
 
 		// We call delete to ensure that expired item
 		// is properly evicted as there's a bug in a cache library:
 		// https://github.com/patrickmn/go-cache/issues/48
 		zfs.cache.Delete(key)
+		zfs.evictArchives()
 
 		// if adding the archive to the cache fails it means it's already been added before
 		// this is done to find concurrent additions.
@@ -237,6 +358,42 @@ func (zfs *zipVFS) findOrCreateArchive(key string) (*zipArchive, error) {
 	return archive.(*zipArchive), nil
 }
 
+// evictArchives makes room for archives in a full cache, by evicting the
+// expired archives and then a batch of the ones closest to expiring, in a
+// single pass over the cache.
+// It needs to be called with cacheLock held.
+func (zfs *zipVFS) evictArchives() {
+	if zfs.cacheMaxArchives <= 0 || zfs.cache.ItemCount() < zfs.cacheMaxArchives {
+		return
+	}
+
+	zfs.cache.DeleteExpired()
+
+	items := zfs.cache.Items()
+	if len(items) < zfs.cacheMaxArchives {
+		return
+	}
+
+	evict := len(items) - zfs.cacheMaxArchives + 1 + zfs.cacheMaxArchives/archiveEvictionBatch
+	if evict > len(items) {
+		evict = len(items)
+	}
+
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return items[keys[i]].Expiration < items[keys[j]].Expiration
+	})
+
+	for _, key := range keys[:evict] {
+		zfs.cache.Delete(key)
+		metrics.ZipCacheRequests.WithLabelValues("archive", "evicted").Inc()
+	}
+}
+
 // findOrOpenArchive gets archive from cache and tries to open it
 func (zfs *zipVFS) findOrOpenArchive(ctx context.Context, key, path string) (*zipArchive, error) {
 	zipArchive, err := zfs.findOrCreateArchive(key)
@@ -251,3 +408,60 @@ func (zfs *zipVFS) findOrOpenArchive(ctx context.Context, key, path string) (*zi
 
 	return zipArchive, nil
 }
+
+// CacheEntries returns the number of entries of the archive cache and of the
+// LRU caches of the archives, by name
+func (zfs *zipVFS) CacheEntries() map[string]int {
+	zfs.cacheLock.Lock()
+	archives := zfs.cache.ItemCount()
+	zfs.cacheLock.Unlock()
+
+	return map[string]int{
+		"archive":     archives,
+		"data-offset": zfs.dataOffsetCache.Len(),
+		"readlink":    zfs.readlinkCache.Len(),
+	}
+}
+
+// PurgeArchives removes the archives cached under keys, along with their
+// entries of the LRU caches, so that they are opened again on their next
+// request. It returns how many of the archives were cached.
+func (zfs *zipVFS) PurgeArchives(keys ...string) int {
+	zfs.cacheLock.Lock()
+	defer zfs.cacheLock.Unlock()
+
+	purged := 0
+	for _, key := range keys {
+		archive, found := zfs.cache.Get(key)
+		if !found {
+			continue
+		}
+
+		zfs.cache.Delete(key)
+		zfs.dataOffsetCache.DeletePrefix(archive.(*zipArchive).cacheNamespace)
+		zfs.readlinkCache.DeletePrefix(archive.(*zipArchive).cacheNamespace)
+		metrics.ZipCacheRequests.WithLabelValues("archive", "purged").Inc()
+		purged++
+	}
+
+	return purged
+}
+
+// ClearArchives removes all the archives and the entries of the LRU caches,
+// it returns how many archives were cached
+func (zfs *zipVFS) ClearArchives() int {
+	zfs.cacheLock.Lock()
+	keys := make([]string, 0, zfs.cache.ItemCount())
+	for key := range zfs.cache.Items() {
+		keys = append(keys, key)
+	}
+	zfs.cacheLock.Unlock()
+
+	purged := zfs.PurgeArchives(keys...)
+
+	// the entries of the archives evicted before are not reachable anymore
+	zfs.dataOffsetCache.DeletePrefix("")
+	zfs.readlinkCache.DeletePrefix("")
+
+	return purged
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"io"
 	"io/fs"
+	"strconv"
 	"testing"
 	"time"
 
 	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/readonly"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/testhelpers"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/vfs"
 
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
@@ -73,6 +76,175 @@ func TestVFSRoot(t *testing.T) {
 	}
 }
 
+func TestVFSRootReadOnly(t *testing.T) {
+	url, cleanup := newZipFileServerURL(t, "group/zip.gitlab.io/public.zip", nil)
+	defer cleanup()
+
+	vfs := New(&zipCfg)
+
+	cached, err := vfs.Root(context.Background(), url+"/public.zip", "cached")
+	require.NoError(t, err)
+
+	readonly.Set(true)
+	t.Cleanup(func() { readonly.Set(false) })
+
+	root, err := vfs.Root(context.Background(), url+"/public.zip", "cached")
+	require.NoError(t, err)
+	require.Same(t, cached, root)
+
+	_, err = vfs.Root(context.Background(), url+"/public.zip", "not-cached")
+	require.ErrorIs(t, err, readonly.ErrReadOnly)
+}
+
+func TestVFSRootMaxArchives(t *testing.T) {
+	url, cleanup := newZipFileServerURL(t, "group/zip.gitlab.io/public.zip", nil)
+	defer cleanup()
+
+	cfg := zipCfg
+	cfg.MaxArchives = 2
+
+	vfs := New(&cfg).(*zipVFS)
+
+	first, err := vfs.Root(context.Background(), url+"/public.zip", "first")
+	require.NoError(t, err)
+
+	// the archives are added with increasing expirations
+	time.Sleep(time.Millisecond)
+
+	_, err = vfs.Root(context.Background(), url+"/public.zip", "second")
+	require.NoError(t, err)
+
+	evicted := testutil.ToFloat64(metrics.ZipCacheRequests.WithLabelValues("archive", "evicted"))
+
+	_, err = vfs.Root(context.Background(), url+"/public.zip", "third")
+	require.NoError(t, err)
+	require.Equal(t, 2, vfs.cache.ItemCount())
+	require.Equal(t, evicted+1, testutil.ToFloat64(metrics.ZipCacheRequests.WithLabelValues("archive", "evicted")))
+
+	_, found := vfs.cache.Get("first")
+	require.False(t, found, "the archive closest to expiring is evicted")
+
+	_, found = vfs.cache.Get("second")
+	require.True(t, found)
+
+	root, err := vfs.Root(context.Background(), url+"/public.zip", "first")
+	require.NoError(t, err)
+	require.NotSame(t, first, root)
+}
+
+func TestVFSRootMaxArchivesEvictsBatch(t *testing.T) {
+	url, cleanup := newZipFileServerURL(t, "group/zip.gitlab.io/public.zip", nil)
+	defer cleanup()
+
+	cfg := zipCfg
+	cfg.MaxArchives = 2 * archiveEvictionBatch
+
+	vfs := New(&cfg).(*zipVFS)
+
+	for i := 0; i < cfg.MaxArchives; i++ {
+		_, err := vfs.Root(context.Background(), url+"/public.zip", strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+
+	_, err := vfs.Root(context.Background(), url+"/public.zip", "last")
+	require.NoError(t, err)
+
+	// one archive makes room for itself and for 2 more
+	require.Equal(t, cfg.MaxArchives-2, vfs.cache.ItemCount())
+
+	_, found := vfs.cache.Get("last")
+	require.True(t, found)
+}
+
+func TestVFSPurgeArchives(t *testing.T) {
+	url, cleanup := newZipFileServerURL(t, "group/zip.gitlab.io/public.zip", nil)
+	defer cleanup()
+
+	vfs := New(&zipCfg).(*zipVFS)
+
+	for _, key := range []string{"first", "second"} {
+		root, err := vfs.Root(context.Background(), url+"/public.zip", key)
+		require.NoError(t, err)
+
+		f, err := root.Open(context.Background(), "index.html")
+		require.NoError(t, err)
+		f.Close()
+	}
+
+	require.Equal(t, map[string]int{"archive": 2, "data-offset": 2, "readlink": 0}, vfs.CacheEntries())
+
+	require.Equal(t, 1, vfs.PurgeArchives("first", "missing"))
+	require.Eventually(t, func() bool {
+		return vfs.CacheEntries()["data-offset"] == 1
+	}, time.Second, time.Millisecond, "the LRU entries of the archive are purged")
+	require.Equal(t, 1, vfs.CacheEntries()["archive"])
+
+	require.Equal(t, 1, vfs.ClearArchives())
+	require.Eventually(t, func() bool {
+		return vfs.CacheEntries()["data-offset"] == 0
+	}, time.Second, time.Millisecond)
+	require.Equal(t, 0, vfs.CacheEntries()["archive"])
+}
+
+func TestVFSRootVerifySHA256(t *testing.T) {
+	const sha256 = "d6b318b399cfe9a1c8483e49847ee49a2676d8cfd6df57ec64d971ad03640a75"
+
+	url, cleanup := newZipFileServerURL(t, "group/zip.gitlab.io/public.zip", nil)
+	defer cleanup()
+
+	cfg := zipCfg
+	cfg.VerifySHA256 = true
+	cfg.Mmap = true
+	cfg.AllowedPaths = []string{testhelpers.Getwd(t)}
+
+	fs := New(&cfg).(*zipVFS)
+	require.NoError(t, fs.Reconfigure(&config.Config{Zip: cfg}))
+
+	tests := map[string]struct {
+		path        string
+		cacheKey    string
+		expectedErr error
+	}{
+		"matching": {
+			path:     url + "/public.zip",
+			cacheKey: sha256,
+		},
+		"not_matching": {
+			path:        url + "/public.zip",
+			cacheKey:    "0000000000000000000000000000000000000000000000000000000000000000",
+			expectedErr: vfs.ErrChecksumMismatch,
+		},
+		"not_a_sha256": {
+			path:     url + "/public.zip",
+			cacheKey: "not-a-sha256",
+		},
+		"mapped_matching": {
+			path:     testhelpers.ToFileProtocol(t, "group/zip.gitlab.io/public.zip"),
+			cacheKey: "D6B318B399CFE9A1C8483E49847EE49A2676D8CFD6DF57EC64D971AD03640A75",
+		},
+		"mapped_not_matching": {
+			path:        testhelpers.ToFileProtocol(t, "group/zip.gitlab.io/public.zip"),
+			cacheKey:    "1111111111111111111111111111111111111111111111111111111111111111",
+			expectedErr: vfs.ErrChecksumMismatch,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			root, err := fs.Root(context.Background(), tt.path, tt.cacheKey)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+
+			_, err = root.Open(context.Background(), "index.html")
+			require.NoError(t, err)
+		})
+	}
+}
+
 func TestVFSFindOrOpenArchiveConcurrentAccess(t *testing.T) {
 	testServerURL, cleanup := newZipFileServerURL(t, "group/zip.gitlab.io/public.zip", nil)
 	defer cleanup()
@@ -239,8 +411,19 @@ func TestVFSReconfigureTransport(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "unsupported protocol scheme \"file\"")
 
-	// reconfigure VFS with allowed paths and try to open file://
+	// without allowed paths, e.g. with the disk source disabled, the file
+	// protocol stays unregistered
 	cfg := zipCfg
+	cfg.AllowedPaths = nil
+
+	err = vfs.Reconfigure(&config.Config{Zip: cfg})
+	require.NoError(t, err)
+
+	_, err = vfs.Root(context.Background(), fileURL, key)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported protocol scheme \"file\"")
+
+	// reconfigure VFS with allowed paths and try to open file://
 	cfg.AllowedPaths = []string{testhelpers.Getwd(t)}
 
 	err = vfs.Reconfigure(&config.Config{Zip: cfg})
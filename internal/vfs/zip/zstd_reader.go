@@ -0,0 +1,60 @@
+package zip
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdMethod is the compression method of the zstd-compressed entries, as
+// written by some build tools
+const zstdMethod uint16 = 93
+
+// zstdReader wrapper to support reading zstd-compressed files.
+// Implements the io.ReadCloser interface.
+type zstdReader struct {
+	closer  io.Closer
+	decoder *zstd.Decoder
+}
+
+func newZstdReader(r io.ReadCloser) (*zstdReader, error) {
+	// a single goroutine decodes the file, as it is streamed to the client
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return &zstdReader{closer: r, decoder: decoder}, nil
+}
+
+func newSeekableZstdReader(open func() io.ReadCloser, size int64) *seekableReader {
+	return &seekableReader{
+		open: open,
+		decompress: func(r io.ReadCloser) (io.ReadCloser, error) {
+			return newZstdReader(r)
+		},
+		size: size,
+	}
+}
+
+// Read from decoder
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.decoder == nil {
+		return 0, ErrClosedReader
+	}
+
+	return r.decoder.Read(p)
+}
+
+// Close the decoder and the file it reads
+func (r *zstdReader) Close() error {
+	if r.decoder == nil {
+		return ErrClosedReader
+	}
+
+	r.decoder.Close()
+	r.decoder = nil
+
+	return r.closer.Close()
+}
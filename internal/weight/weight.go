@@ -0,0 +1,226 @@
+// Package weight scores the health of a Pages node for the load balancer.
+// Instead of a binary up or down, the node reports a weight between 1% and
+// 100%, so traffic shifts gradually away from a node whose GitLab API calls
+// fail, whose domain cache is cold or which serves server errors. The weight
+// follows the protocol of the HAProxy agent-check.
+package weight
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"gitlab.com/gitlab-org/labkit/log"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/responsewriter"
+	"gitlab.com/gitlab-org/gitlab-pages/metrics"
+)
+
+// agentTimeout bounds the time a load balancer agent connection is kept open
+const agentTimeout = 5 * time.Second
+
+// sample holds the counters of the signals at a point in time
+type sample struct {
+	apiRequests  float64
+	apiFailures  float64
+	cacheHits    float64
+	cacheMisses  float64
+	requests     int64
+	serverErrors int64
+}
+
+// Scorer samples the health signals of the node at an interval and computes
+// its weight
+type Scorer struct {
+	// the `int64` fields need to be 64bit aligned on some 32bit systems
+	requests     int64
+	serverErrors int64
+
+	ready func() bool
+
+	mu   sync.RWMutex
+	last sample
+	// api, cache and errors are the health of each signal between 0 and 1
+	api    float64
+	cache  float64
+	errors float64
+	weight float64
+}
+
+// New returns a Scorer of a node which is drained while ready returns false.
+// The domain cache of a new node is cold, it starts at half of the weight.
+func New(ready func() bool) *Scorer {
+	s := &Scorer{
+		ready:  ready,
+		api:    1,
+		errors: 1,
+	}
+
+	s.weight = s.target()
+	s.last = s.sample()
+
+	return s
+}
+
+// Start updates the weight every interval
+func (s *Scorer) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.update(s.sample())
+		}
+	}()
+}
+
+// Middleware counts the responses of handler and its server errors
+func (s *Scorer) Middleware(handler http.Handler) http.Handler {
+	if s == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := responsewriter.NewStatusWriter(w)
+		handler.ServeHTTP(sw, r)
+
+		atomic.AddInt64(&s.requests, 1)
+		if sw.Status() >= http.StatusInternalServerError {
+			atomic.AddInt64(&s.serverErrors, 1)
+		}
+	})
+}
+
+// Weight returns the weight of the node between 1 and 100, or 0 when it
+// must be drained
+func (s *Scorer) Weight() int {
+	if s.ready != nil && !s.ready() {
+		return 0
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int(math.Max(1, math.Round(s.weight)))
+}
+
+// ServeHTTP responds with the weight in the format of the HAProxy agent-check
+func (s *Scorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	io.WriteString(w, s.agentResponse())
+}
+
+// ServeAgent answers every connection accepted by l with the weight, as
+// expected by the HAProxy agent-check, until l is closed
+func (s *Scorer) ServeAgent(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+
+			conn.SetDeadline(time.Now().Add(agentTimeout))
+			if _, err := io.WriteString(conn, s.agentResponse()); err != nil {
+				log.WithError(err).Debug("failed to report the weight to the load balancer agent")
+			}
+		}()
+	}
+}
+
+func (s *Scorer) agentResponse() string {
+	weight := s.Weight()
+	if weight == 0 {
+		return "drain\n"
+	}
+
+	return fmt.Sprintf("ready %d%%\n", weight)
+}
+
+func (s *Scorer) sample() sample {
+	return sample{
+		apiRequests: counterSum(metrics.DomainsSourceAPIReqTotal, nil),
+		apiFailures: counterSum(metrics.DomainsSourceAPIReqTotal, func(status string) bool {
+			return status == "error" || strings.HasPrefix(status, "5")
+		}),
+		cacheHits:    counterSum(metrics.DomainsSourceCacheHit, nil),
+		cacheMisses:  counterSum(metrics.DomainsSourceCacheMiss, nil),
+		requests:     atomic.LoadInt64(&s.requests),
+		serverErrors: atomic.LoadInt64(&s.serverErrors),
+	}
+}
+
+// update scores the signals over the interval since the last sample. A
+// signal without any activity keeps its score.
+func (s *Scorer) update(current sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := s.last
+	s.last = current
+
+	if requests := current.apiRequests - last.apiRequests; requests > 0 {
+		s.api = 1 - (current.apiFailures-last.apiFailures)/requests
+	}
+
+	if lookups := current.cacheHits - last.cacheHits + current.cacheMisses - last.cacheMisses; lookups > 0 {
+		s.cache = (current.cacheHits - last.cacheHits) / lookups
+	}
+
+	s.errors = 1
+	if requests := current.requests - last.requests; requests > 0 {
+		s.errors = 1 - float64(current.serverErrors-last.serverErrors)/float64(requests)
+	}
+
+	// move halfway to the target, so that a single bad interval does not
+	// shift all of the traffic at once
+	s.weight += (s.target() - s.weight) / 2
+
+	metrics.HealthScore.WithLabelValues("api").Set(s.api)
+	metrics.HealthScore.WithLabelValues("cache").Set(s.cache)
+	metrics.HealthScore.WithLabelValues("errors").Set(s.errors)
+	metrics.HealthScore.WithLabelValues("weight").Set(s.weight)
+}
+
+// target is the weight the node converges to. A node that cannot reach the
+// API or has a cold cache still serves the cached domains and keeps at
+// least half of its weight for each, server errors lower it down to 0.
+func (s *Scorer) target() float64 {
+	return 100 * (0.5 + 0.5*s.api) * (0.5 + 0.5*s.cache) * s.errors
+}
+
+// counterSum returns the sum of the counters collected from c. When match
+// is set, only the counters whose first label value it accepts are summed.
+func counterSum(c prometheus.Collector, match func(string) bool) float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var sum float64
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil || pb.Counter == nil {
+			continue
+		}
+
+		if match == nil || (len(pb.Label) > 0 && match(pb.Label[0].GetValue())) {
+			sum += pb.Counter.GetValue()
+		}
+	}
+
+	return sum
+}
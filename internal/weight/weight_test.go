@@ -0,0 +1,115 @@
+package weight
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScorerWeight(t *testing.T) {
+	s := New(nil)
+
+	// the domain cache of a new node is cold
+	require.Equal(t, 50, s.Weight())
+
+	// a warm cache moves the weight halfway to 100% per interval
+	s.update(sample{cacheHits: 10})
+	require.Equal(t, 75, s.Weight())
+
+	s.update(sample{cacheHits: 20})
+	require.Equal(t, 88, s.Weight())
+
+	// the GitLab API is unreachable and the cache misses, the cached
+	// domains are still served
+	s.update(sample{cacheHits: 20, cacheMisses: 10, apiRequests: 10, apiFailures: 10})
+	require.Equal(t, 56, s.Weight())
+
+	// the API recovered, but half of the requests are server errors
+	s.update(sample{cacheHits: 30, cacheMisses: 10, apiRequests: 20, apiFailures: 10, requests: 10, serverErrors: 5})
+	require.Equal(t, 53, s.Weight())
+
+	// every request fails
+	for i := int64(1); i <= 10; i++ {
+		s.update(sample{cacheHits: 30, cacheMisses: 10, apiRequests: 20, apiFailures: 10, requests: 10 + 10*i, serverErrors: 5 + 10*i})
+	}
+	require.Equal(t, 1, s.Weight())
+}
+
+func TestScorerSignalsWithoutActivityKeepTheirScore(t *testing.T) {
+	s := New(nil)
+
+	s.update(sample{cacheHits: 5, cacheMisses: 5, apiRequests: 4, apiFailures: 2})
+	require.Equal(t, 0.5, s.cache)
+	require.Equal(t, 0.5, s.api)
+
+	s.update(sample{cacheHits: 5, cacheMisses: 5, apiRequests: 4, apiFailures: 2})
+	require.Equal(t, 0.5, s.cache)
+	require.Equal(t, 0.5, s.api)
+	require.Equal(t, float64(1), s.errors)
+}
+
+func TestScorerMiddleware(t *testing.T) {
+	s := New(nil)
+
+	handler := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+
+	for _, path := range []string{"/", "/fail", "/", "/fail"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	current := s.sample()
+	require.Equal(t, int64(4), current.requests)
+	require.Equal(t, int64(2), current.serverErrors)
+}
+
+func TestScorerServeHTTP(t *testing.T) {
+	ready := false
+	s := New(func() bool { return ready })
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/weight", nil))
+	require.Equal(t, "drain\n", w.Body.String())
+
+	ready = true
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/weight", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	require.Equal(t, "ready 50%\n", w.Body.String())
+}
+
+func TestScorerServeAgent(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := New(nil)
+
+	done := make(chan error)
+	go func() {
+		done <- s.ServeAgent(l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// HAProxy may send agent-send before reading the weight
+	_, err = conn.Write([]byte("pages\n"))
+	require.NoError(t, err)
+
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "ready 50%\n", string(response))
+
+	require.NoError(t, l.Close())
+	require.Error(t, <-done)
+}
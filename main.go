@@ -5,6 +5,7 @@ import (
 	"io"
 	"math/rand"
 	"os"
+	"runtime"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -12,7 +13,12 @@ import (
 	"gitlab.com/gitlab-org/labkit/log"
 
 	cfg "gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/deprecation"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/feature"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/fixturegen"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/logging"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/migrate"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/smoke"
 	"gitlab.com/gitlab-org/gitlab-pages/internal/validateargs"
 	"gitlab.com/gitlab-org/gitlab-pages/metrics"
 )
@@ -58,26 +64,36 @@ func appMain() {
 		}
 	}
 
-	err = logging.ConfigureLogging(config.Log.Format, config.Log.Verbose)
+	err = logging.ConfigureLogging(&config.Log)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to initialize logging")
 	}
 
 	cfg.LogConfig(config)
 
+	deprecation.SetInterval(config.General.DeprecationWarningInterval)
+	cfg.ReportDeprecatedFlags()
+
 	log.WithFields(log.Fields{
 		"version":  VERSION,
 		"revision": REVISION,
 	}).Info("GitLab Pages")
 	log.Info("URL: https://gitlab.com/gitlab-org/gitlab-pages")
 
-	if err := os.Chdir(config.General.RootDir); err != nil {
-		fatal(err, "could not change directory into pagesRoot")
+	metrics.BuildInfo.WithLabelValues(VERSION, REVISION, runtime.Version()).Set(1)
+	metrics.GitLabBuildInfo.WithLabelValues(VERSION, "").Set(1)
+	feature.ExportMetrics(metrics.FeatureFlag)
+
+	if config.GitLab.EnableDisk {
+		if err := os.Chdir(config.General.RootDir); err != nil {
+			fatal(err, "could not change directory into pagesRoot")
+		}
 	}
 
 	for _, cs := range [][]io.Closer{
 		createAppListeners(config),
 		createMetricsListener(config),
+		createWeightAgentListener(config),
 	} {
 		defer closeAll(cs)
 	}
@@ -100,6 +116,7 @@ func createAppListeners(config *cfg.Config) []io.Closer {
 	var httpsListeners []uintptr
 	var proxyListeners []uintptr
 	var httpsProxyv2Listeners []uintptr
+	var httpProxyv2Listeners []uintptr
 
 	for _, addr := range config.ListenHTTPStrings.Split() {
 		l, f := createSocket(addr)
@@ -109,7 +126,11 @@ func createAppListeners(config *cfg.Config) []io.Closer {
 			"listener": addr,
 		}).Debug("Set up HTTP listener")
 
-		httpListeners = append(httpListeners, f.Fd())
+		if hasProxyProtocol(addr) {
+			httpProxyv2Listeners = append(httpProxyv2Listeners, f.Fd())
+		} else {
+			httpListeners = append(httpListeners, f.Fd())
+		}
 	}
 
 	for _, addr := range config.ListenHTTPSStrings.Split() {
@@ -120,7 +141,12 @@ func createAppListeners(config *cfg.Config) []io.Closer {
 			"listener": addr,
 		}).Debug("Set up HTTPS listener")
 
-		httpsListeners = append(httpsListeners, f.Fd())
+		// an HTTPS listener with the PROXY protocol is an HTTPS PROXYv2 one
+		if hasProxyProtocol(addr) {
+			httpsProxyv2Listeners = append(httpsProxyv2Listeners, f.Fd())
+		} else {
+			httpsListeners = append(httpsListeners, f.Fd())
+		}
 	}
 
 	for _, addr := range config.ListenProxyStrings.Split() {
@@ -150,6 +176,7 @@ func createAppListeners(config *cfg.Config) []io.Closer {
 		HTTPS:        httpsListeners,
 		Proxy:        proxyListeners,
 		HTTPSProxyv2: httpsProxyv2Listeners,
+		HTTPProxyv2:  httpProxyv2Listeners,
 	}
 
 	return closers
@@ -174,6 +201,25 @@ func createMetricsListener(config *cfg.Config) []io.Closer {
 	return []io.Closer{l, f}
 }
 
+// createWeightAgentListener returns net.Listener and *os.File instances. The
+// caller must ensure they don't get closed or garbage-collected (which
+// implies closing) too soon.
+func createWeightAgentListener(config *cfg.Config) []io.Closer {
+	addr := config.General.WeightAgentAddress
+	if addr == "" {
+		return nil
+	}
+
+	l, f := createSocket(addr)
+	config.ListenWeightAgent = f.Fd()
+
+	log.WithFields(log.Fields{
+		"listener": addr,
+	}).Debug("Set up weight agent listener")
+
+	return []io.Closer{l, f}
+}
+
 func printVersion(showVersion bool, version string) {
 	if showVersion {
 		fmt.Fprintf(os.Stdout, "%s\n", version)
@@ -184,6 +230,18 @@ func printVersion(showVersion bool, version string) {
 func main() {
 	logrus.SetOutput(os.Stderr)
 
+	if len(os.Args) > 1 && os.Args[1] == migrate.CommandName {
+		os.Exit(migrate.Main(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == smoke.CommandName {
+		os.Exit(smoke.Main(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == fixturegen.CommandName {
+		os.Exit(fixturegen.Main(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	rand.Seed(time.Now().UnixNano())
 
 	metrics.MustRegister()
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+	"gitlab.com/gitlab-org/labkit/log"
+)
+
+// flushSize is the amount of encoded metrics sent to the scraper at once
+const flushSize = 64 * 1024
+
+// Handler serves the metrics of the default registry. The response is
+// compressed when the scraper accepts gzip, and it is flushed while the
+// metric families are being encoded, so large scrapes are streamed in
+// chunks instead of being held in memory until they are complete.
+func Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handlerFor(prometheus.DefaultGatherer))
+}
+
+func handlerFor(gatherer prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mfs, err := gatherer.Gather()
+		if err != nil {
+			log.WithError(err).Error("failed to gather metrics")
+			http.Error(w, "failed to gather metrics", http.StatusInternalServerError)
+			return
+		}
+
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		sw := newStreamWriter(w, gzipAccepted(r.Header))
+		defer sw.Close()
+
+		enc := expfmt.NewEncoder(sw, format)
+		for _, mf := range mfs {
+			if err := enc.Encode(mf); err != nil {
+				// the response has started, the scraper gets a truncated body
+				log.WithError(err).WithField("metric", mf.GetName()).Error("failed to encode metrics")
+				return
+			}
+
+			sw.flushIfNeeded()
+		}
+
+		if closer, ok := enc.(expfmt.Closer); ok {
+			closer.Close()
+		}
+	})
+}
+
+func gzipAccepted(header http.Header) bool {
+	for _, encoding := range strings.Split(header.Get("Accept-Encoding"), ",") {
+		encoding = strings.TrimSpace(encoding)
+		if encoding == "gzip" || strings.HasPrefix(encoding, "gzip;") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// streamWriter compresses the response if needed and flushes it to the
+// client every flushSize bytes
+type streamWriter struct {
+	w       io.Writer
+	gz      *gzip.Writer
+	flusher http.Flusher
+	pending int
+}
+
+func newStreamWriter(w http.ResponseWriter, compress bool) *streamWriter {
+	sw := &streamWriter{w: w}
+	sw.flusher, _ = w.(http.Flusher)
+
+	if compress {
+		w.Header().Set("Content-Encoding", "gzip")
+		sw.gz = gzip.NewWriter(w)
+		sw.w = sw.gz
+	}
+
+	return sw
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	sw.pending += n
+
+	return n, err
+}
+
+func (sw *streamWriter) flushIfNeeded() {
+	if sw.pending < flushSize {
+		return
+	}
+
+	sw.pending = 0
+
+	if sw.gz != nil {
+		sw.gz.Flush()
+	}
+
+	if sw.flusher != nil {
+		sw.flusher.Flush()
+	}
+}
+
+func (sw *streamWriter) Close() error {
+	if sw.gz != nil {
+		return sw.gz.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	// a family larger than flushSize, like per-domain metrics would be
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_requests_total"}, []string{"domain"})
+	for i := 0; i < 5000; i++ {
+		requests.WithLabelValues("group-" + strconv.Itoa(i) + ".example.io").Inc()
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(requests)
+
+	tests := map[string]struct {
+		acceptEncoding string
+		expectedGzip   bool
+	}{
+		"plain":       {},
+		"gzip":        {acceptEncoding: "gzip, deflate", expectedGzip: true},
+		"gzip_qvalue": {acceptEncoding: "br, gzip;q=0.8", expectedGzip: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+
+			handlerFor(registry).ServeHTTP(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.True(t, w.Flushed, "large responses are streamed")
+
+			var body io.Reader = w.Body
+			if tt.expectedGzip {
+				require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+				gz, err := gzip.NewReader(w.Body)
+				require.NoError(t, err)
+				body = gz
+			} else {
+				require.Empty(t, w.Header().Get("Content-Encoding"))
+			}
+
+			content, err := io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, 5000, strings.Count(string(content), "\ntest_requests_total{"))
+			require.Contains(t, string(content), `test_requests_total{domain="group-4999.example.io"} 1`)
+		})
+	}
+}
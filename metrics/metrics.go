@@ -17,12 +17,55 @@ var (
 		Help: "The number of GitLab domains API cache misses",
 	})
 
+	// DomainsSourceCacheStaleHits is the number of expired lookups served
+	// while they could not be refreshed
+	DomainsSourceCacheStaleHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gitlab_pages_domains_source_cache_stale_hits_total",
+		Help: "The number of expired GitLab domains lookups served while they could not be refreshed",
+	})
+
 	// DomainsSourceFailures is the number of GitLab API calls that failed
 	DomainsSourceFailures = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "gitlab_pages_domains_source_failures_total",
 		Help: "The number of GitLab API calls that failed",
 	})
 
+	// DomainsSourceRejectedLookups is the number of lookups received from the
+	// GitLab API that were rejected for exceeding a limit
+	DomainsSourceRejectedLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gitlab_pages_domains_source_rejected_lookups_total",
+		Help: "The number of GitLab domains API lookups rejected for exceeding a limit",
+	}, []string{"reason"})
+
+	// DomainsSourceCoalescedLookups is the number of lookups which waited for
+	// the retrieval of the same domain in progress instead of calling the API
+	DomainsSourceCoalescedLookups = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gitlab_pages_domains_source_coalesced_lookups_total",
+		Help: "The number of GitLab domains API lookups coalesced with a retrieval of the same domain in progress",
+	})
+
+	// DomainsSourceLookupBatchSize is the number of domains of the batch
+	// lookups sent to the GitLab API
+	DomainsSourceLookupBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gitlab_pages_domains_source_lookup_batch_size",
+		Help:    "The number of domains looked up with a single GitLab domains API request",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 8),
+	})
+
+	// DomainsSourceCacheEvictions counts the requests to evict a domain from
+	// the cache of the GitLab source, by result
+	DomainsSourceCacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gitlab_pages_domains_source_cache_evictions_total",
+		Help: "The number of requests to evict a domain from the GitLab domains cache, by result",
+	}, []string{"result"})
+
+	// CacheAdminRequests counts the requests to the cache admin endpoints, by
+	// operation and result
+	CacheAdminRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gitlab_pages_cache_admin_requests_total",
+		Help: "The number of requests to clear, purge or report on the caches, by operation and result",
+	}, []string{"op", "result"})
+
 	// DomainsSourceAPIReqTotal is the number of calls made to the GitLab API that returned a 4XX error
 	DomainsSourceAPIReqTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "gitlab_pages_domains_source_api_requests_total",
@@ -106,6 +149,27 @@ var (
 		[]string{"request_stage"},
 	)
 
+	// HTTPRangeRetriesTotal is the number of requests to a httprange.Resource
+	// retried after a transient failure
+	HTTPRangeRetriesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gitlab_pages_httprange_retries_total",
+		Help: "The number of requests made by the zip VFS to a Resource retried after a transient failure",
+	})
+
+	// HTTPRangeCacheRequests is the number of httprange disk cache
+	// hits/misses/evictions
+	HTTPRangeCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gitlab_pages_httprange_cache_requests",
+		Help: "The number of ranges of a Resource read from the disk cache (hit), fetched (miss) or evicted from it",
+	}, []string{"op"})
+
+	// HTTPRangeCacheSize is the size in bytes of the ranges in the httprange
+	// disk cache
+	HTTPRangeCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gitlab_pages_httprange_cache_size_bytes",
+		Help: "The size in bytes of the ranges in the disk cache",
+	})
+
 	// HTTPRangeOpenRequests is the number of open requests made by httprange.Reader
 	HTTPRangeOpenRequests = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "gitlab_pages_httprange_open_requests",
@@ -157,10 +221,153 @@ var (
 		},
 	)
 
+	// ZipLimitsExceeded is the number of times a limit of zip serving was hit
+	ZipLimitsExceeded = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_zip_limits_exceeded_total",
+			Help: "The number of times a zip archive exceeded the maximum number of files or path depth",
+		},
+		[]string{"limit"},
+	)
+
+	// ZipPoolQueueLength is the number of zip fetches waiting for a worker
+	ZipPoolQueueLength = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_zip_pool_queue_length",
+			Help: "The number of zip archive opens (cold) and file reads (hot) waiting for a worker",
+		},
+		[]string{"pool"},
+	)
+
+	// ZipPoolRejected is the number of zip fetches rejected by a saturated pool
+	ZipPoolRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_zip_pool_rejected_total",
+			Help: "The number of zip archive opens (cold) and file reads (hot) rejected because the queue of their pool was full",
+		},
+		[]string{"pool"},
+	)
+
+	// DiskCacheRequests is the number of disk serving attribute and file
+	// handle cache hits/misses
+	DiskCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_disk_cache_requests",
+			Help: "The number of disk serving attribute and file handle cache hits/misses",
+		},
+		[]string{"op", "cache"},
+	)
+
+	// DiskCachedEntries is the number of entries in the disk serving caches
+	DiskCachedEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_disk_cached_entries",
+			Help: "The number of entries in the disk serving caches",
+		},
+		[]string{"op"},
+	)
+
+	// HTMLCacheRequests is the number of HTML document cache hits/misses
+	HTMLCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_html_cache_requests",
+			Help: "The number of HTML document cache hits/misses",
+		},
+		[]string{"op", "cache"},
+	)
+
+	// HTMLCachedEntries is the number of HTML documents in the cache
+	HTMLCachedEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_html_cached_entries",
+			Help: "The number of HTML documents in the cache",
+		},
+		[]string{"op"},
+	)
+
+	// AssetCacheRequests is the number of asset cache hits/misses, a hit of
+	// the contents means an asset was shared with another deployment
+	AssetCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_asset_cache_requests",
+			Help: "The number of asset cache hits/misses",
+		},
+		[]string{"op", "cache"},
+	)
+
+	// AssetCachedEntries is the number of entries in the asset cache
+	AssetCachedEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_asset_cached_entries",
+			Help: "The number of entries in the asset cache",
+		},
+		[]string{"op"},
+	)
+
+	// ArtifactsCacheRequests is the number of artifacts response cache
+	// hits/misses
+	ArtifactsCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_artifacts_cache_requests",
+			Help: "The number of artifacts response cache hits/misses",
+		},
+		[]string{"op", "cache"},
+	)
+
+	// ArtifactsCachedEntries is the number of entries in the artifacts
+	// response cache
+	ArtifactsCachedEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_artifacts_cached_entries",
+			Help: "The number of entries in the artifacts response cache",
+		},
+		[]string{"op"},
+	)
+
+	// ArtifactsServerUp is whether the last request to an artifacts server
+	// succeeded
+	ArtifactsServerUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_artifacts_server_up",
+			Help: "Whether the last request to an artifacts server succeeded (1) or failed over (0)",
+		},
+		[]string{"server"},
+	)
+
+	// ArtifactsServerFailures is the number of requests to an artifacts
+	// server which failed with a connection error or a 5xx response
+	ArtifactsServerFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_artifacts_server_failures",
+			Help: "The number of requests to an artifacts server which failed with a connection error or a 5xx response",
+		},
+		[]string{"server"},
+	)
+
+	// MirroredRequests is the number of requests mirrored to a secondary
+	// deployment by result
+	MirroredRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_mirrored_requests",
+			Help: "The number of requests mirrored to a secondary deployment by result (sent, error or dropped)",
+		},
+		[]string{"result"},
+	)
+
+	// OversizedRequestsCount is the number of requests rejected for exceeding
+	// the URI, header or body size limits
+	OversizedRequestsCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_oversized_requests",
+			Help: "The number of requests rejected for exceeding the URI, header or body size limits",
+		},
+		[]string{"limit"},
+	)
+
 	RejectedRequestsCount = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "gitlab_pages_unknown_method_rejected_requests",
-			Help: "The number of requests with unknown HTTP method which were rejected",
+			Help: "The number of requests with an unknown or disallowed HTTP method which were rejected",
 		},
 	)
 
@@ -248,6 +455,230 @@ var (
 		},
 		[]string{"enforced"},
 	)
+
+	// RateLimitAuthCacheRequests is the number of cache hits/misses
+	RateLimitAuthCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_rate_limit_auth_cache_requests",
+			Help: "The number of auth source_ip cache hits/misses in the rate limiter",
+		},
+		[]string{"op", "cache"},
+	)
+
+	// RateLimitAuthCachedEntries is the number of entries in the cache
+	RateLimitAuthCachedEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_rate_limit_auth_cached_entries",
+			Help: "The number of entries in the cache",
+		},
+		[]string{"op"},
+	)
+
+	// RateLimitAuthBlockedCount is the number of requests to the auth endpoints that have
+	// been blocked by the auth rate limiter
+	RateLimitAuthBlockedCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_rate_limit_auth_blocked_count",
+			Help: "The number of requests to the auth endpoints that have been blocked by the auth rate limiter",
+		},
+		[]string{"enforced"},
+	)
+
+	// RateLimitPathCacheRequests is the number of cache hits/misses
+	RateLimitPathCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_rate_limit_path_cache_requests",
+			Help: "The number of path cache hits/misses in the rate limiter",
+		},
+		[]string{"op", "cache"},
+	)
+
+	// RateLimitPathCachedEntries is the number of entries in the cache
+	RateLimitPathCachedEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_rate_limit_path_cached_entries",
+			Help: "The number of entries in the cache",
+		},
+		[]string{"op"},
+	)
+
+	// RateLimitPathBlockedCount is the number of requests to the paths with a
+	// rate limit that have been blocked by the path rate limiter
+	RateLimitPathBlockedCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_rate_limit_path_blocked_count",
+			Help: "The number of requests to the paths with a rate limit that have been blocked by the path rate limiter",
+		},
+		[]string{"enforced"},
+	)
+
+	// RateLimitDecisions is the number of decisions taken by the rate limiters
+	RateLimitDecisions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_rate_limit_decisions_total",
+			Help: "The number of requests allowed or limited by each rate limiter, limited requests are only rejected when enforced",
+		},
+		[]string{"limiter", "decision"},
+	)
+
+	// TarpitRequests is the number of requests tarpitted, or answered
+	// immediately because the tarpit was full
+	TarpitRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_tarpit_requests_total",
+			Help: "The number of requests of scanners and above the rate limits that were tarpitted or answered immediately because the tarpit was full",
+		},
+		[]string{"reason", "outcome"},
+	)
+
+	// TarpitInFlight is the number of requests currently held by the tarpit
+	TarpitInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_tarpit_in_flight_requests",
+			Help: "The number of requests currently held by the tarpit",
+		},
+	)
+
+	// DeprecationsUsed is the number of uses of deprecated features
+	DeprecationsUsed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_deprecations_total",
+			Help: "The number of uses of deprecated flags, serving sources and GitLab API payloads",
+		},
+		[]string{"kind", "name"},
+	)
+
+	// BuildInfo is always 1, labeled with the version of the running daemon
+	BuildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_build_info",
+			Help: "A metric with a constant value of 1 labeled with the version, revision and Go version of GitLab Pages",
+		},
+		[]string{"version", "revision", "go_version"},
+	)
+
+	// GitLabBuildInfo is the build info metric of labkit, which only
+	// registers it when it serves the metrics itself
+	GitLabBuildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_build_info",
+			Help: "Current build info for this GitLab Service",
+		},
+		[]string{"version", "built"},
+	)
+
+	// FeatureFlag is 1 for the current state of each feature flag
+	FeatureFlag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_feature_flag",
+			Help: "The state of the feature flags, 1 for the current state of a flag and 0 for the other",
+		},
+		[]string{"name", "state"},
+	)
+
+	// HealthScore is the health of the node reported to the load balancer,
+	// per signal between 0 and 1, and the resulting weight between 0 and 100
+	HealthScore = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gitlab_pages_health_score",
+			Help: "The health of the node per signal between 0 and 1, and the weight reported to the load balancer between 0 and 100",
+		},
+		[]string{"signal"},
+	)
+
+	// ObjectStorageEgressBytes is the number of bytes read from the object
+	// storage by zip serving
+	ObjectStorageEgressBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gitlab_pages_object_storage_egress_bytes_total",
+		Help: "The number of bytes read from the object storage by zip serving",
+	})
+
+	// ObjectStorageEgressBudgetUsage is the share of the object storage
+	// egress budget used in the current window
+	ObjectStorageEgressBudgetUsage = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gitlab_pages_object_storage_egress_budget_usage",
+		Help: "The share of zip-egress-budget used in the current window, above 1 archives are no longer opened",
+	})
+
+	// ArchivePrefetches counts the archives prefetched on the deployment
+	// notifications of GitLab, by status
+	ArchivePrefetches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_archive_prefetches_total",
+			Help: "The number of archives prefetched on the deployment notifications of GitLab, by status",
+		},
+		[]string{"status"},
+	)
+
+	// ShareLinks counts the share links of private projects presented by
+	// visitors, by result
+	ShareLinks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_share_links_total",
+			Help: "The number of share links of private projects presented by visitors, by result",
+		},
+		[]string{"result"},
+	)
+
+	// DeploymentExports counts the downloads of the archives of deployments
+	// by their owners, by result
+	DeploymentExports = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_deployment_exports_total",
+			Help: "The number of downloads of the archives of deployments, by result",
+		},
+		[]string{"result"},
+	)
+
+	// ClientAbortedRequests counts the requests the clients aborted before they
+	// were served, by operation, they are not counted as errors
+	ClientAbortedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_client_aborted_requests_total",
+			Help: "The number of requests the clients aborted before they were served, by operation",
+		},
+		[]string{"op"},
+	)
+
+	// OCSPStapleFetches counts the OCSP responses fetched for the served
+	// certificates, by result
+	OCSPStapleFetches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_ocsp_staple_fetches_total",
+			Help: "The number of OCSP responses fetched for the served certificates, by result",
+		},
+		[]string{"result"},
+	)
+
+	// RootCertificateReloads counts the reloads of the root certificate, by
+	// result
+	RootCertificateReloads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gitlab_pages_root_certificate_reloads_total",
+			Help: "The number of reloads of the root certificate, by result",
+		},
+		[]string{"result"},
+	)
+
+	// CompressedResponses counts the responses compressed with gzip
+	CompressedResponses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gitlab_pages_compressed_responses_total",
+		Help: "The number of responses compressed with gzip",
+	})
+
+	// CompressionSavedBytes counts the bytes not sent thanks to the gzip
+	// compression of the responses
+	CompressionSavedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gitlab_pages_compression_saved_bytes_total",
+		Help: "The number of bytes not sent thanks to the gzip compression of the responses",
+	})
+
+	// ReadOnly is 1 while the daemon serves only from its caches and the
+	// local disk
+	ReadOnly = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gitlab_pages_read_only",
+		Help: "Whether Pages is in read-only mode and refuses new API lookups and archive fetches",
+	})
 )
 
 // MustRegister collectors with the Prometheus client
@@ -259,18 +690,42 @@ func MustRegister() {
 		DomainsSourceAPICallDuration,
 		DomainsSourceAPITraceDuration,
 		DomainsSourceFailures,
+		DomainsSourceRejectedLookups,
+		DomainsSourceCoalescedLookups,
+		DomainsSourceLookupBatchSize,
+		DomainsSourceCacheStaleHits,
+		DomainsSourceCacheEvictions,
+		CacheAdminRequests,
 		DiskServingFileSize,
 		ServingTime,
 		VFSOperations,
 		HTTPRangeRequestsTotal,
 		HTTPRangeRequestDuration,
 		HTTPRangeTraceDuration,
+		HTTPRangeRetriesTotal,
+		HTTPRangeCacheRequests,
+		HTTPRangeCacheSize,
 		HTTPRangeOpenRequests,
 		ZipOpened,
 		ZipOpenedEntriesCount,
 		ZipCacheRequests,
 		ZipArchiveEntriesCached,
 		ZipCachedEntries,
+		ZipLimitsExceeded,
+		ZipPoolQueueLength,
+		ZipPoolRejected,
+		DiskCacheRequests,
+		DiskCachedEntries,
+		HTMLCacheRequests,
+		HTMLCachedEntries,
+		AssetCacheRequests,
+		AssetCachedEntries,
+		ArtifactsCacheRequests,
+		ArtifactsCachedEntries,
+		ArtifactsServerUp,
+		ArtifactsServerFailures,
+		MirroredRequests,
+		OversizedRequestsCount,
 		RejectedRequestsCount,
 		LimitListenerMaxConns,
 		LimitListenerConcurrentConns,
@@ -279,5 +734,33 @@ func MustRegister() {
 		RateLimitSourceIPCacheRequests,
 		RateLimitSourceIPCachedEntries,
 		RateLimitSourceIPBlockedCount,
+		RateLimitDomainCacheRequests,
+		RateLimitDomainCachedEntries,
+		RateLimitDomainBlockedCount,
+		RateLimitAuthCacheRequests,
+		RateLimitAuthCachedEntries,
+		RateLimitAuthBlockedCount,
+		RateLimitPathCacheRequests,
+		RateLimitPathCachedEntries,
+		RateLimitPathBlockedCount,
+		RateLimitDecisions,
+		TarpitRequests,
+		TarpitInFlight,
+		DeprecationsUsed,
+		BuildInfo,
+		GitLabBuildInfo,
+		FeatureFlag,
+		HealthScore,
+		ReadOnly,
+		ArchivePrefetches,
+		ShareLinks,
+		DeploymentExports,
+		ClientAbortedRequests,
+		OCSPStapleFetches,
+		RootCertificateReloads,
+		CompressedResponses,
+		CompressionSavedBytes,
+		ObjectStorageEgressBytes,
+		ObjectStorageEgressBudgetUsage,
 	)
 }
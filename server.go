@@ -47,6 +47,13 @@ func (a *theApp) listenAndServe(config listenerConfig) error {
 	// create server
 	server := &http.Server{Handler: config.handler, TLSConfig: config.tlsConfig}
 
+	// Leave room above max-header-bytes so that oversized headers reach the
+	// headerlimiter middleware, which answers with a 431 and counts them,
+	// instead of being rejected silently while reading the request
+	if maxHeaderBytes := a.config.General.MaxHeaderBytes; maxHeaderBytes > 0 {
+		server.MaxHeaderBytes = 2 * maxHeaderBytes
+	}
+
 	// ensure http2 is enabled even if TLSConfig is not null
 	// See https://github.com/golang/go/blob/97cee43c93cfccded197cd281f0a5885cdb605b4/src/net/http/server.go#L2947-L2954
 	if server.TLSConfig != nil {
@@ -1,6 +1,8 @@
 package acceptance_test
 
 import (
+	"compress/gzip"
+	"io"
 	"mime"
 	"net/http"
 	"testing"
@@ -37,6 +39,20 @@ func TestMIMETypes(t *testing.T) {
 	}
 }
 
+func TestCustomMIMETypes(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("mime-type", ".webmanifest=application/x-web-app-manifest+json"),
+	)
+
+	rsp, err := GetPageFromListener(t, httpListener, "group.gitlab-example.com", "project/file.webmanifest")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "application/x-web-app-manifest+json", rsp.Header.Get("Content-Type"))
+}
+
 func TestCompressedEncoding(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -76,3 +92,34 @@ func TestCompressedEncoding(t *testing.T) {
 		})
 	}
 }
+
+func TestOnTheFlyCompression(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("compress-responses", "true"),
+		withExtraArgument("compress-min-size", "1"),
+	)
+
+	plain, err := GetPageFromListener(t, httpListener, "group.gitlab-example.com", "project/index.html")
+	require.NoError(t, err)
+	defer plain.Body.Close()
+
+	expected, err := io.ReadAll(plain.Body)
+	require.NoError(t, err)
+
+	header := http.Header{"Accept-Encoding": []string{"gzip"}}
+	rsp, err := GetPageFromListenerWithHeaders(t, httpListener, "group.gitlab-example.com", "project/index.html", header)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "gzip", rsp.Header.Get("Content-Encoding"))
+	require.Contains(t, rsp.Header.Values("Vary"), "Accept-Encoding")
+
+	gz, err := gzip.NewReader(rsp.Body)
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	require.Equal(t, expected, body)
+}
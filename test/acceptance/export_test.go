@@ -0,0 +1,112 @@
+package acceptance_test
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/fixture"
+)
+
+func exportToken(t *testing.T, host string, projectID uint64) string {
+	t.Helper()
+
+	secret, err := base64.StdEncoding.DecodeString(fixture.GitLabAPISecretKey)
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{
+		"aud":        "gitlab-pages-export",
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"host":       host,
+		"project_id": projectID,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	require.NoError(t, err)
+
+	return token
+}
+
+func TestDeploymentExportResumesDownload(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("deployment-export", "true"),
+	)
+
+	archive, err := os.ReadFile("../../shared/pages/@hashed/zip-from-disk.gitlab.io/public.zip")
+	require.NoError(t, err)
+
+	header := http.Header{"Authorization": {"Bearer " + exportToken(t, "zip-from-disk.gitlab.io", 123)}}
+
+	rsp, err := GetPageFromListenerWithHeaders(t, httpListener, "zip-from-disk.gitlab.io", "/-/deployment.zip", header)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "application/zip", rsp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.Equal(t, archive, body)
+
+	header.Set("Range", "bytes=100-")
+	header.Set("If-Range", rsp.Header.Get("ETag"))
+
+	rsp, err = GetPageFromListenerWithHeaders(t, httpListener, "zip-from-disk.gitlab.io", "/-/deployment.zip", header)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	require.Equal(t, http.StatusPartialContent, rsp.StatusCode)
+
+	body, err = io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	require.Equal(t, archive[100:], body)
+}
+
+func TestDeploymentExportRequiresToken(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("deployment-export", "true"),
+	)
+
+	tests := map[string]string{
+		"no token":      "",
+		"other project": exportToken(t, "zip-from-disk.gitlab.io", 124),
+		"other host":    exportToken(t, "zip.gitlab.io", 123),
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			header := http.Header{}
+			if token != "" {
+				header.Set("Authorization", "Bearer "+token)
+			}
+
+			rsp, err := GetPageFromListenerWithHeaders(t, httpListener, "zip-from-disk.gitlab.io", "/-/deployment.zip", header)
+			require.NoError(t, err)
+			rsp.Body.Close()
+
+			require.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+		})
+	}
+}
+
+func TestDeploymentExportDisabledByDefault(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+	)
+
+	header := http.Header{"Authorization": {"Bearer " + exportToken(t, "zip-from-disk.gitlab.io", 123)}}
+
+	rsp, err := GetPageFromListenerWithHeaders(t, httpListener, "zip-from-disk.gitlab.io", "/-/deployment.zip", header)
+	require.NoError(t, err)
+	rsp.Body.Close()
+
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+}
@@ -0,0 +1,51 @@
+package acceptance_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderLimits(t *testing.T) {
+	tests := map[string]struct {
+		cookieSize     int
+		expectedStatus int
+	}{
+		"with_headers_below_the_limit": {
+			cookieSize:     512,
+			expectedStatus: http.StatusOK,
+		},
+		"with_headers_exceeding_the_limit": {
+			cookieSize:     4096,
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+	}
+
+	RunPagesProcess(t, withListeners([]ListenSpec{httpsListener}), withExtraArgument("max-header-bytes", "2048"))
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Cookie", "a="+strings.Repeat("b", tt.cookieSize))
+
+			rsp, err := GetPageFromListenerWithHeaders(t, httpsListener, "group.gitlab-example.com", "project/", header)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, rsp.Body.Close())
+			}()
+
+			require.Equal(t, tt.expectedStatus, rsp.StatusCode)
+
+			b, err := io.ReadAll(rsp.Body)
+			require.NoError(t, err)
+			if tt.expectedStatus == http.StatusOK {
+				require.Equal(t, "project-subdir\n", string(b))
+			} else {
+				require.Contains(t, string(b), "Request Header Fields Too Large")
+			}
+		})
+	}
+}
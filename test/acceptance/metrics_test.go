@@ -2,6 +2,7 @@ package acceptance_test
 
 import (
 	"io"
+	"net"
 	"net/http"
 	"testing"
 
@@ -25,6 +26,7 @@ func TestPrometheusMetricsCanBeScraped(t *testing.T) {
 
 	resp, err := http.Get("http://127.0.0.1:42345/metrics")
 	require.NoError(t, err)
+	require.True(t, resp.Uncompressed, "the transport requests gzip and decompresses the metrics")
 
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
@@ -55,4 +57,80 @@ func TestPrometheusMetricsCanBeScraped(t *testing.T) {
 	require.Contains(t, string(body), "gitlab_pages_limit_listener_max_conns")
 	require.Contains(t, string(body), "gitlab_pages_limit_listener_concurrent_conns")
 	require.Contains(t, string(body), "gitlab_pages_limit_listener_waiting_conns")
+	// build info and feature flags
+	require.Contains(t, string(body), "gitlab_pages_build_info{")
+	require.Contains(t, string(body), "gitlab_build_info{")
+	require.Contains(t, string(body), `gitlab_pages_feature_flag{name="FF_ENABLE_PLACEHOLDERS"`)
+}
+
+func TestDeprecationsAreListed(t *testing.T) {
+	RunPagesProcess(t,
+		withExtraArgument("metrics-address", ":42346"),
+		withExtraArgument("daemon-uid", "0"),
+	)
+
+	resp, err := http.Get("http://127.0.0.1:42346/-/deprecations")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `"kind":"flag","name":"daemon-uid"`)
+}
+
+func TestWeightIsReportedToTheLoadBalancer(t *testing.T) {
+	RunPagesProcess(t,
+		withExtraArgument("metrics-address", ":42347"),
+		withExtraArgument("listen-weight-agent", "127.0.0.1:42348"),
+	)
+
+	resp, err := http.Get("http://127.0.0.1:42347/-/weight")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Regexp(t, `^ready \d+%\n$`, string(body))
+
+	conn, err := net.Dial("tcp", "127.0.0.1:42348")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	agent, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Regexp(t, `^ready \d+%\n$`, string(agent))
+}
+
+func TestPprofIsServedByDefault(t *testing.T) {
+	RunPagesProcess(t,
+		withExtraArgument("metrics-address", ":42349"),
+	)
+
+	for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+		resp, err := http.Get("http://127.0.0.1:42349" + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, path)
+	}
+
+	resp, err := GetPageFromListener(t, httpListener, "zip.gitlab.io", "/debug/pprof/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.NotEqual(t, http.StatusOK, resp.StatusCode, "the profiles are never served on the public listeners")
+}
+
+func TestPprofIsNotServedWhenDisabled(t *testing.T) {
+	RunPagesProcess(t,
+		withExtraArgument("metrics-address", ":42350"),
+		withExtraArgument("enable-pprof", "false"),
+	)
+
+	for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+		resp, err := http.Get("http://127.0.0.1:42350" + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
 }
@@ -2,7 +2,9 @@ package acceptance_test
 
 import (
 	"io"
+	"net"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -56,3 +58,40 @@ func TestProxyv2(t *testing.T) {
 		})
 	}
 }
+
+func TestProxyProtocolOnHTTPListener(t *testing.T) {
+	addr := net.JoinHostPort("127.0.0.1", "39100")
+
+	logBuf := RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("listen-http", addr+"?proxyprotocol=true"),
+	)
+
+	client := &http.Client{Transport: &http.Transport{DialContext: Proxyv2DialContext}}
+
+	req, err := http.NewRequest("GET", "http://"+addr+"/project/", nil)
+	require.NoError(t, err)
+	req.Host = "group.gitlab-example.com"
+
+	response, err := client.Do(req)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "project-subdir\n")
+
+	// the dummy client IP 10.1.1.1 is set by Proxyv2DialContext
+	require.Eventually(t, func() bool {
+		return strings.Contains(logBuf.String(), "\"remote_ip\":\"10.1.1.1\"")
+	}, time.Second, time.Millisecond)
+
+	// the requests without a PROXY protocol header are refused
+	response, err = http.Get("http://" + addr + "/project/")
+	require.NoError(t, err)
+	response.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
@@ -24,7 +24,7 @@ func TestRedirectStatusPage(t *testing.T) {
 	require.NoError(t, err)
 	defer rsp.Body.Close()
 
-	require.Contains(t, string(body), "14 rules")
+	require.Contains(t, string(body), "16 rules")
 	require.Equal(t, http.StatusOK, rsp.StatusCode)
 }
 
@@ -89,6 +89,20 @@ func TestRedirect(t *testing.T) {
 			expectedStatus:   http.StatusMovedPermanently,
 			expectedLocation: "/project-redirects/careers/assistant-to-the-regional-manager.html",
 		},
+		// Forced rule (302!) takes precedence over the file on disk
+		{
+			host:             "group.redirects.gitlab-example.com",
+			path:             "/project-redirects/forced.html",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/project-redirects/magic-land.html",
+		},
+		// Query parameter (id=:id) interpolated into the target
+		{
+			host:             "group.redirects.gitlab-example.com",
+			path:             "/project-redirects/store?id=42",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/project-redirects/item/42",
+		},
 	}
 
 	for _, tt := range tests {
@@ -102,3 +116,37 @@ func TestRedirect(t *testing.T) {
 		})
 	}
 }
+
+func TestNamespaceRedirects(t *testing.T) {
+	tests := map[string]struct {
+		extraArgs        []string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		"namespace_fallback": {
+			extraArgs:        []string{"-redirects-namespace-fallback"},
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "/magic-land.html",
+		},
+		"disabled": {
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			RunPagesProcess(t,
+				withListeners([]ListenSpec{httpListener}),
+				withArguments(tt.extraArgs),
+			)
+
+			// the project has no rule for this path, its namespace project does
+			rsp, err := GetRedirectPage(t, httpListener, "group.redirects.gitlab-example.com", "/project-redirects/moved.html")
+			require.NoError(t, err)
+			defer rsp.Body.Close()
+
+			require.Equal(t, tt.expectedStatus, rsp.StatusCode)
+			require.Equal(t, tt.expectedLocation, rsp.Header.Get("Location"))
+		})
+	}
+}
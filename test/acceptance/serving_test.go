@@ -2,6 +2,7 @@ package acceptance_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -33,6 +34,28 @@ func TestUnknownProjectReturnsNotFound(t *testing.T) {
 	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
 }
 
+func TestNotFoundReturnsJSONWhenAccepted(t *testing.T) {
+	RunPagesProcess(t)
+
+	header := http.Header{"Accept": []string{"application/json"}}
+	rsp, err := GetPageFromListenerWithHeaders(t, httpListener, "invalid.invalid", "/", header)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+	require.Equal(t, "application/json; charset=utf-8", rsp.Header.Get("Content-Type"))
+
+	var body struct {
+		Code          int    `json:"code"`
+		Message       string `json:"message"`
+		CorrelationID string `json:"correlation_id"`
+	}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&body))
+	require.Equal(t, http.StatusNotFound, body.Code)
+	require.NotEmpty(t, body.Message)
+	require.NotEmpty(t, body.CorrelationID)
+}
+
 func TestGroupDomainReturns200(t *testing.T) {
 	RunPagesProcess(t)
 
@@ -210,7 +233,7 @@ func TestCORSAllowsMethod(t *testing.T) {
 		{
 			name:           "cors-forbids-post",
 			method:         http.MethodPost,
-			expectedStatus: http.StatusOK,
+			expectedStatus: http.StatusMethodNotAllowed,
 			expectedOrigin: "",
 		},
 	}
@@ -244,6 +267,23 @@ func TestCustomHeaders(t *testing.T) {
 	}
 }
 
+func TestSecurityHeaders(t *testing.T) {
+	RunPagesProcess(t,
+		withExtraArgument("security-headers", "basic"),
+		withExtraArgument("header", "X-Frame-Options: DENY"),
+	)
+
+	for _, spec := range supportedListeners() {
+		rsp, err := GetPageFromListener(t, spec, "group.gitlab-example.com:", "project/")
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+		require.Equal(t, http.StatusOK, rsp.StatusCode)
+		require.Equal(t, "nosniff", rsp.Header.Get("X-Content-Type-Options"))
+		require.Equal(t, "strict-origin-when-cross-origin", rsp.Header.Get("Referrer-Policy"))
+		require.Equal(t, []string{"DENY"}, rsp.Header.Values("X-Frame-Options"))
+	}
+}
+
 func TestKnownHostWithPortReturns200(t *testing.T) {
 	RunPagesProcess(t)
 
@@ -581,3 +621,22 @@ func TestSlowRequests(t *testing.T) {
 		return true
 	}, time.Second, time.Millisecond)
 }
+
+func TestReadOnlyRespondsUnavailableToDomainsWhichAreNotCached(t *testing.T) {
+	RunPagesProcess(t,
+		withoutWait,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("read-only", "true"),
+	)
+
+	// the listener is ready once it responds, every domain is unavailable
+	require.Eventually(t, func() bool {
+		rsp, err := GetPageFromListener(t, httpListener, "group.gitlab-example.com", "/index.html")
+		if err != nil {
+			return false
+		}
+		rsp.Body.Close()
+
+		return rsp.StatusCode == http.StatusServiceUnavailable
+	}, 5*time.Second, 100*time.Millisecond)
+}
@@ -1,6 +1,7 @@
 package acceptance_test
 
 import (
+	"encoding/json"
 	"net/http"
 	"testing"
 
@@ -18,3 +19,45 @@ func TestStatusPage(t *testing.T) {
 	defer rsp.Body.Close()
 	require.Equal(t, http.StatusOK, rsp.StatusCode)
 }
+
+func TestStatusPageReportsAPIVersion(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("pages-status", "/@statuscheck"),
+	)
+
+	rsp, err := GetPageFromListener(t, httpListener, "group.gitlab-example.com", "project/")
+	require.NoError(t, err)
+	rsp.Body.Close()
+
+	rsp, err = GetPageFromListener(t, httpListener, "group.gitlab-example.com", "@statuscheck")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "1", rsp.Header.Get("Gitlab-Pages-Api-Version"))
+}
+
+func TestStatusPageServesJSONDocument(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("pages-status", "/@statuscheck"),
+		withExtraArgument("pages-status-json", "true"),
+	)
+
+	header := http.Header{"Accept": []string{"application/json"}}
+	rsp, err := GetPageFromListenerWithHeaders(t, httpListener, "group.gitlab-example.com", "@statuscheck", header)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	require.Equal(t, "application/json", rsp.Header.Get("Content-Type"))
+
+	var doc struct {
+		SchemaVersion int    `json:"schema_version"`
+		Revision      string `json:"revision"`
+		Ready         bool   `json:"ready"`
+	}
+	require.NoError(t, json.NewDecoder(rsp.Body).Decode(&doc))
+	require.Equal(t, 1, doc.SchemaVersion)
+	require.NotEmpty(t, doc.Revision)
+	require.True(t, doc.Ready)
+}
@@ -118,3 +118,40 @@ func TestTLSVersions(t *testing.T) {
 		})
 	}
 }
+
+func TestDomainTLSPolicy(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpsListener}),
+	)
+
+	tests := map[string]struct {
+		serverName  string
+		tlsClient   uint16
+		expectError bool
+	}{
+		"domain requiring tls1.3 rejects tls1.2": {serverName: "tls-policy.gitlab.io", tlsClient: tls.VersionTLS12, expectError: true},
+		"domain requiring tls1.3 accepts tls1.3": {serverName: "tls-policy.gitlab.io", tlsClient: tls.VersionTLS13},
+		"domain without policy accepts tls1.2":   {serverName: "zip.gitlab.io", tlsClient: tls.VersionTLS12},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, cleanup := ClientWithConfig(&tls.Config{
+				ServerName: tc.serverName,
+				MaxVersion: tc.tlsClient,
+				// the test certificate is not issued for the test domains
+				InsecureSkipVerify: true,
+			})
+			defer cleanup()
+
+			rsp, err := client.Get(httpsListener.URL("/"))
+
+			if tc.expectError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				rsp.Body.Close()
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package acceptance_test
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -22,3 +23,63 @@ func TestUnknownHTTPMethod(t *testing.T) {
 
 	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
 }
+
+func TestDisallowedHTTPMethod(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+	)
+
+	req, err := http.NewRequest(http.MethodPost, httpListener.URL("project/"), strings.NewReader("data"))
+	require.NoError(t, err)
+	req.Host = "group.gitlab-example.com"
+
+	resp, err := DoPagesRequest(t, httpListener, req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	require.Equal(t, "GET, HEAD, OPTIONS", resp.Header.Get("Allow"))
+}
+
+func TestAllowedHTTPMethods(t *testing.T) {
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("allowed-methods", "GET,POST"),
+		withExtraArgument("max-body-bytes", "10"),
+	)
+
+	tests := map[string]struct {
+		method         string
+		body           string
+		expectedStatus int
+	}{
+		"post_allowed": {
+			method:         http.MethodPost,
+			body:           "data",
+			expectedStatus: http.StatusOK,
+		},
+		"post_body_too_large": {
+			method:         http.MethodPost,
+			body:           strings.Repeat("a", 11),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		"head_not_allowed": {
+			method:         http.MethodHead,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, httpListener.URL("project/"), strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Host = "group.gitlab-example.com"
+
+			resp, err := DoPagesRequest(t, httpListener, req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -102,6 +104,154 @@ func TestZipServing(t *testing.T) {
 	}
 }
 
+func TestZipServingRange(t *testing.T) {
+	runObjectStorage(t, "../../shared/pages/group/zip.gitlab.io/public.zip")
+
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+	)
+
+	// subdir/linked.html is deflated in the archive
+	tests := map[string]struct {
+		rangeHeader        string
+		expectedStatusCode int
+		expectedContent    string
+		expectedRange      string
+	}{
+		"start": {
+			rangeHeader:        "bytes=0-6",
+			expectedStatusCode: http.StatusPartialContent,
+			expectedContent:    "symlink",
+			expectedRange:      "bytes 0-6/33",
+		},
+		"middle": {
+			rangeHeader:        "bytes=14-19",
+			expectedStatusCode: http.StatusPartialContent,
+			expectedContent:    "subdir",
+			expectedRange:      "bytes 14-19/33",
+		},
+		"suffix": {
+			rangeHeader:        "bytes=-12",
+			expectedStatusCode: http.StatusPartialContent,
+			expectedContent:    "linked.html\n",
+			expectedRange:      "bytes 21-32/33",
+		},
+		"unsatisfiable": {
+			rangeHeader:        "bytes=40-50",
+			expectedStatusCode: http.StatusRequestedRangeNotSatisfiable,
+			expectedRange:      "bytes */33",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			header := http.Header{"Range": []string{tt.rangeHeader}}
+
+			response, err := GetPageFromListenerWithHeaders(t, httpListener, "zip.gitlab.io", "/subdir/linked.html", header)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			require.Equal(t, tt.expectedStatusCode, response.StatusCode)
+			require.Equal(t, tt.expectedRange, response.Header.Get("Content-Range"))
+
+			if tt.expectedContent == "" {
+				return
+			}
+
+			body, err := io.ReadAll(response.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, tt.expectedContent, string(body))
+		})
+	}
+}
+
+func TestZipServingPublicationWindow(t *testing.T) {
+	runObjectStorage(t, "../../shared/pages/group/zip.gitlab.io/public.zip")
+
+	placeholder := filepath.Join(t.TempDir(), "unpublished.html")
+	require.NoError(t, os.WriteFile(placeholder, []byte("<p>Coming soon</p>"), 0644))
+
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("unpublished-page", placeholder),
+	)
+
+	tests := map[string]struct {
+		urlSuffix          string
+		expectedStatusCode int
+		expectedContent    string
+	}{
+		"within_publication_window": {
+			urlSuffix:          "/",
+			expectedStatusCode: http.StatusOK,
+			expectedContent:    "zip.gitlab.io/project/index.html\n",
+		},
+		"before_publish_at": {
+			urlSuffix:          "/embargoed/index.html",
+			expectedStatusCode: http.StatusNotFound,
+			expectedContent:    "<p>Coming soon</p>",
+		},
+		"after_unpublish_at": {
+			urlSuffix:          "/retired/",
+			expectedStatusCode: http.StatusNotFound,
+			expectedContent:    "<p>Coming soon</p>",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			response, err := GetPageFromListener(t, httpListener, "zip-publication-window.gitlab.io", tt.urlSuffix)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			require.Equal(t, tt.expectedStatusCode, response.StatusCode)
+
+			body, err := io.ReadAll(response.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, tt.expectedContent, string(body))
+		})
+	}
+}
+
+func TestZipServingProjectHeaders(t *testing.T) {
+	runObjectStorage(t, "../../shared/pages/group/zip.gitlab.io/public.zip")
+
+	RunPagesProcess(t,
+		withListeners([]ListenSpec{httpListener}),
+		withExtraArgument("header", "Cache-Control: no-cache"),
+	)
+
+	tests := map[string]struct {
+		urlSuffix          string
+		expectedStatusCode int
+	}{
+		"file": {
+			urlSuffix:          "/",
+			expectedStatusCode: http.StatusOK,
+		},
+		"not_found": {
+			urlSuffix:          "/missing.html",
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			response, err := GetPageFromListener(t, httpListener, "zip-headers.gitlab.io", tt.urlSuffix)
+			require.NoError(t, err)
+			defer response.Body.Close()
+
+			require.Equal(t, tt.expectedStatusCode, response.StatusCode)
+			require.Equal(t, "default-src 'self'", response.Header.Get("Content-Security-Policy"))
+			require.Equal(t, "same-origin", response.Header.Get("Cross-Origin-Opener-Policy"))
+			require.Equal(t, []string{"public, max-age=3600"}, response.Header.Values("Cache-Control"), "the project replaces the -header flag")
+			require.Empty(t, response.Header.Get("Set-Cookie"))
+		})
+	}
+}
+
 func TestZipServingCache(t *testing.T) {
 	runObjectStorage(t, "../../shared/pages/group/zip.gitlab.io/public.zip")
 
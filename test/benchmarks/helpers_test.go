@@ -0,0 +1,235 @@
+package benchmarks
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/auth"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/config"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/domain"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/routing"
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+	zipserving "gitlab.com/gitlab-org/gitlab-pages/internal/serving/disk/zip"
+)
+
+const (
+	pagesDomain   = "gitlab-example.com"
+	publicDomain  = "public." + pagesDomain
+	privateDomain = "private." + pagesDomain
+
+	redirectsCount = 999
+)
+
+// site is a zip deployment generated for the benchmarks
+type site struct {
+	files map[string]string
+}
+
+func defaultSite() site {
+	return site{
+		files: map[string]string{
+			"index.html":     strings.Repeat("<p>GitLab Pages benchmark</p>\n", 200),
+			"404.html":       "<p>not found</p>\n",
+			"assets/app.js":  strings.Repeat("console.log('benchmark');\n", 2000),
+			"assets/app.css": strings.Repeat("body { margin: 0; }\n", 500),
+		},
+	}
+}
+
+func redirectsHeavySite() site {
+	s := defaultSite()
+
+	var rules strings.Builder
+	for i := 0; i < redirectsCount; i++ {
+		fmt.Fprintf(&rules, "/old/page-%d.html /new/page-%d.html 301\n", i, i)
+	}
+	s.files["_redirects"] = rules.String()
+
+	return s
+}
+
+func writeZip(tb testing.TB, s site) string {
+	tb.Helper()
+
+	f, err := os.CreateTemp(archivesDir, "*.zip")
+	require.NoError(tb, err)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range s.files {
+		w, err := zw.Create("public/" + name)
+		require.NoError(tb, err)
+
+		_, err = w.Write([]byte(content))
+		require.NoError(tb, err)
+	}
+	require.NoError(tb, zw.Close())
+
+	return "file://" + f.Name()
+}
+
+// stubResolver serves every request from a single lookup path
+type stubResolver struct {
+	lookupPath *serving.LookupPath
+}
+
+func (r *stubResolver) Resolve(req *http.Request) (*serving.Request, error) {
+	return &serving.Request{
+		Serving:    zipserving.Instance(),
+		LookupPath: r.lookupPath,
+		SubPath:    strings.TrimPrefix(req.URL.Path, r.lookupPath.Prefix),
+	}, nil
+}
+
+// stubSource is a domains source backed by a static map
+type stubSource map[string]*domain.Domain
+
+func (s stubSource) GetDomain(_ context.Context, host string) (*domain.Domain, error) {
+	d, ok := s[host]
+	if !ok {
+		return nil, domain.ErrDomainDoesNotExist
+	}
+
+	return d, nil
+}
+
+func (s stubSource) add(host string, lookupPath *serving.LookupPath) {
+	s[host] = domain.New(host, "", "", &stubResolver{lookupPath: lookupPath})
+}
+
+// archivesDir holds the archives generated by the benchmarks, it is the only
+// path the zip serving is allowed to read from
+var archivesDir string
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "gitlab-pages-benchmarks")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archivesDir = dir
+
+	// keep the benchmark output readable
+	logrus.SetOutput(io.Discard)
+
+	cfg := &config.Config{
+		Zip: config.ZipServing{
+			ExpirationInterval: time.Minute,
+			CleanupInterval:    30 * time.Second,
+			RefreshInterval:    30 * time.Second,
+			OpenTimeout:        30 * time.Second,
+			AllowedPaths:       []string{dir},
+		},
+	}
+
+	if err := zipserving.Instance().Reconfigure(cfg); err != nil {
+		panic(err)
+	}
+
+	return m.Run()
+}
+
+// newPipeline builds the subset of the application handler pipeline involved
+// in serving content: domain routing, authentication, authorization and the
+// file or not found handler
+func newPipeline(src stubSource, a *auth.Auth) http.Handler {
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := domain.FromRequest(r)
+		if !d.ServeFileHTTP(w, r) {
+			d.ServeNotFoundHTTP(w, r)
+		}
+	}))
+
+	handler = a.AuthorizationMiddleware(handler)
+	handler = a.AuthenticationMiddleware(handler, src)
+
+	return routing.NewMiddleware(handler, src)
+}
+
+// newAuthAPI starts a stub of the GitLab OAuth and pages_access API endpoints
+func newAuthAPI(tb testing.TB) *httptest.Server {
+	tb.Helper()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			fmt.Fprint(w, `{"access_token":"abc"}`)
+		case "/api/v4/projects/1000/pages_access", "/api/v4/user":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	tb.Cleanup(api.Close)
+
+	return api
+}
+
+func newAuth(tb testing.TB, apiURL string) *auth.Auth {
+	tb.Helper()
+
+	a, err := auth.New([]string{pagesDomain}, "something-very-secret-for-benchmarks", "id", "secret",
+		"https://projects."+pagesDomain+"/auth", apiURL, apiURL, "api")
+	require.NoError(tb, err)
+
+	return a
+}
+
+// login performs the OAuth flow against the pipeline and returns the session
+// cookies of an authenticated user for the given host
+func login(tb testing.TB, handler http.Handler, a *auth.Auth, host string) []*http.Cookie {
+	tb.Helper()
+
+	rec := serve(handler, newRequest(host, "/index.html"))
+	require.Equal(tb, http.StatusFound, rec.Code)
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(tb, err)
+
+	code, err := a.EncryptAndSignCode("https://"+host, "1")
+	require.NoError(tb, err)
+
+	callback := newRequest(host, "/auth?code="+code+"&state="+location.Query().Get("state"))
+	for _, c := range rec.Result().Cookies() {
+		callback.AddCookie(c)
+	}
+
+	rec = serve(handler, callback)
+	require.Equal(tb, http.StatusFound, rec.Code)
+
+	return rec.Result().Cookies()
+}
+
+// newRequest creates an HTTPS request the way it is received by the server,
+// with the target in RequestURI being only the path
+func newRequest(host, target string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Host = host
+	r.URL.Scheme = "https"
+
+	return r
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	return rec
+}
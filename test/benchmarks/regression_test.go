@@ -0,0 +1,108 @@
+package benchmarks
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	gate      = flag.Bool("bench-gate", false, "Run the serving benchmarks and compare them against the baseline")
+	update    = flag.Bool("bench-update", false, "Run the serving benchmarks and overwrite the baseline with the results")
+	baseline  = flag.String("bench-baseline", "testdata/baseline.json", "Path to the baseline results")
+	tolerance = flag.Float64("bench-tolerance", 1.5, "Maximum allowed ratio between the current and the baseline results")
+)
+
+// result holds the numbers of a single benchmark run that are compared
+// between runs
+type result struct {
+	NsPerOp     int64 `json:"ns_per_op"`
+	AllocsPerOp int64 `json:"allocs_per_op"`
+	BytesPerOp  int64 `json:"bytes_per_op"`
+}
+
+// TestServingRegressions compares the serving benchmarks against the
+// committed baseline. It only runs when -bench-gate or -bench-update is given.
+func TestServingRegressions(t *testing.T) {
+	if !*gate && !*update {
+		t.Skip("run with -bench-gate to compare against the baseline or -bench-update to refresh it")
+	}
+
+	current := runServingBenchmarks(t)
+
+	if *update {
+		writeBaseline(t, *baseline, current)
+		return
+	}
+
+	expected := readBaseline(t, *baseline)
+
+	for _, name := range benchmarkNames() {
+		t.Run(name, func(t *testing.T) {
+			base, ok := expected[name]
+			if !ok {
+				t.Skipf("no baseline recorded for %q, run with -bench-update", name)
+			}
+
+			compare(t, "ns/op", base.NsPerOp, current[name].NsPerOp)
+			compare(t, "allocs/op", base.AllocsPerOp, current[name].AllocsPerOp)
+			compare(t, "B/op", base.BytesPerOp, current[name].BytesPerOp)
+		})
+	}
+}
+
+func runServingBenchmarks(t *testing.T) map[string]result {
+	t.Helper()
+
+	results := make(map[string]result, len(servingBenchmarks))
+	for _, name := range benchmarkNames() {
+		res := testing.Benchmark(servingBenchmarks[name])
+		require.NotZero(t, res.N, "benchmark %q failed", name)
+
+		results[name] = result{
+			NsPerOp:     res.NsPerOp(),
+			AllocsPerOp: res.AllocsPerOp(),
+			BytesPerOp:  res.AllocedBytesPerOp(),
+		}
+
+		t.Logf("%s: %s %s", name, res.String(), res.MemString())
+	}
+
+	return results
+}
+
+func compare(t *testing.T, unit string, base, current int64) {
+	t.Helper()
+
+	if base == 0 {
+		return
+	}
+
+	ratio := float64(current) / float64(base)
+	require.LessOrEqualf(t, ratio, *tolerance,
+		"regression in %s: baseline %d, current %d (%.2fx, tolerance %.2fx)", unit, base, current, ratio, *tolerance)
+}
+
+func readBaseline(t *testing.T, path string) map[string]result {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var results map[string]result
+	require.NoError(t, json.Unmarshal(content, &results))
+
+	return results
+}
+
+func writeBaseline(t *testing.T, path string, results map[string]result) {
+	t.Helper()
+
+	content, err := json.MarshalIndent(results, "", "  ")
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, append(content, '\n'), 0600))
+}
@@ -0,0 +1,160 @@
+package benchmarks
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"gitlab.com/gitlab-org/gitlab-pages/internal/serving"
+)
+
+// servingBenchmarks are the scenarios covered by the regression gate, see README.md
+var servingBenchmarks = map[string]func(b *testing.B){
+	"cold_zip_open":           benchmarkColdZipOpen,
+	"hot_cached_file":         benchmarkHotCachedFile,
+	"redirects_heavy_site":    benchmarkRedirectsHeavySite,
+	"access_controlled_html":  benchmarkAccessControlledHTML,
+	"not_found_custom_404":    benchmarkNotFoundCustom404,
+	"hot_cached_large_assets": benchmarkHotCachedLargeAsset,
+}
+
+func BenchmarkServing(b *testing.B) {
+	for _, name := range benchmarkNames() {
+		b.Run(name, servingBenchmarks[name])
+	}
+}
+
+func benchmarkNames() []string {
+	names := make([]string, 0, len(servingBenchmarks))
+	for name := range servingBenchmarks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// benchmarkColdZipOpen measures serving a file from an archive that is not cached yet
+func benchmarkColdZipOpen(b *testing.B) {
+	archive := writeZip(b, defaultSite())
+
+	lookupPath := &serving.LookupPath{Prefix: "/", Path: archive}
+	src := stubSource{}
+	src.add(publicDomain, lookupPath)
+	handler := newPipeline(src, newAuth(b, ""))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// a new cache key forces the archive to be opened again
+		lookupPath.SHA256 = fmt.Sprintf("cold-%d", i)
+
+		assertStatus(b, serve(handler, newRequest(publicDomain, "/index.html")), http.StatusOK)
+	}
+}
+
+// benchmarkHotCachedFile measures serving a small HTML file from an already opened archive
+func benchmarkHotCachedFile(b *testing.B) {
+	handler := newPublicSitePipeline(b, defaultSite())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		assertStatus(b, serve(handler, newRequest(publicDomain, "/index.html")), http.StatusOK)
+	}
+}
+
+// benchmarkHotCachedLargeAsset measures serving a bigger asset from an already opened archive
+func benchmarkHotCachedLargeAsset(b *testing.B) {
+	handler := newPublicSitePipeline(b, defaultSite())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		assertStatus(b, serve(handler, newRequest(publicDomain, "/assets/app.js")), http.StatusOK)
+	}
+}
+
+// benchmarkRedirectsHeavySite measures matching the last rule of a _redirects
+// file close to the maximum number of rules
+func benchmarkRedirectsHeavySite(b *testing.B) {
+	handler := newPublicSitePipeline(b, redirectsHeavySite())
+	target := fmt.Sprintf("/old/page-%d.html", redirectsCount-1)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		assertStatus(b, serve(handler, newRequest(publicDomain, target)), http.StatusMovedPermanently)
+	}
+}
+
+// benchmarkNotFoundCustom404 measures serving the custom 404 page of a project
+func benchmarkNotFoundCustom404(b *testing.B) {
+	handler := newPublicSitePipeline(b, defaultSite())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		assertStatus(b, serve(handler, newRequest(publicDomain, "/missing.html")), http.StatusNotFound)
+	}
+}
+
+// benchmarkAccessControlledHTML measures serving an HTML document of a private
+// project for a logged in user, including the pages_access check against the API
+func benchmarkAccessControlledHTML(b *testing.B) {
+	archive := writeZip(b, defaultSite())
+
+	api := newAuthAPI(b)
+	a := newAuth(b, api.URL)
+
+	src := stubSource{}
+	src.add(privateDomain, &serving.LookupPath{
+		Prefix:           "/",
+		Path:             archive,
+		SHA256:           archive,
+		HasAccessControl: true,
+		ProjectID:        1000,
+	})
+	handler := newPipeline(src, a)
+	cookies := login(b, handler, a, privateDomain)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r := newRequest(privateDomain, "/index.html")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+
+		assertStatus(b, serve(handler, r), http.StatusOK)
+	}
+}
+
+func newPublicSitePipeline(b *testing.B, s site) http.Handler {
+	b.Helper()
+
+	archive := writeZip(b, s)
+
+	src := stubSource{}
+	src.add(publicDomain, &serving.LookupPath{Prefix: "/", Path: archive, SHA256: archive})
+	handler := newPipeline(src, newAuth(b, ""))
+
+	// warm up the archive cache
+	assertStatus(b, serve(handler, newRequest(publicDomain, "/")), http.StatusOK)
+
+	return handler
+}
+
+func assertStatus(b *testing.B, rec *httptest.ResponseRecorder, expected int) {
+	if rec.Code != expected {
+		b.Fatalf("unexpected status code: got %d, expected %d", rec.Code, expected)
+	}
+}